@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"runtime/debug"
 	"strconv"
 	"syscall"
 	"time"
@@ -17,46 +18,69 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
+// Set via -ldflags "-X main.version=... -X main.buildTime=... -X main.gitCommit=..."
 var (
 	version   = "0.1.0"
 	buildTime = "unknown"
+	gitCommit = ""
 )
 
 func main() {
 	// Command line flags with environment variable fallbacks
 	var (
-		dbPath   = flag.String("db", getEnv("DB_PATH", "upgrader.db"), "Path to SQLite database (env: DB_PATH)")
-		bind     = flag.String("bind", getEnv("BIND_ADDRESS", "0.0.0.0"), "Bind address/interface (env: BIND_ADDRESS)")
-		port     = flag.Int("port", getEnvInt("PORT", 8080), "HTTP server port (env: PORT)")
-		logLevel = flag.String("log-level", getEnv("LOG_LEVEL", "info"), "Log level (debug, info, warn, error) (env: LOG_LEVEL)")
-		workers  = flag.Int("workers", getEnvInt("WORKERS", 0), "Number of concurrent upgrade workers (env: WORKERS, 0 = use database setting)")
-		showVer  = flag.Bool("version", false, "Show version and exit")
+		dbPath       = flag.String("db", getEnv("DB_PATH", "upgrader.db"), "Path to SQLite database, or DSN for other drivers (env: DB_PATH)")
+		dbDriver     = flag.String("db-driver", getEnv("DB_DRIVER", database.DriverSQLite), "Database driver (sqlite, postgres) (env: DB_DRIVER)")
+		bind         = flag.String("bind", getEnv("BIND_ADDRESS", "0.0.0.0"), "Bind address/interface (env: BIND_ADDRESS)")
+		port         = flag.Int("port", getEnvInt("PORT", 8080), "HTTP server port (env: PORT)")
+		logLevel     = flag.String("log-level", getEnv("LOG_LEVEL", "info"), "Log level (debug, info, warn, error) (env: LOG_LEVEL)")
+		logFormat    = flag.String("log-format", getEnv("LOG_FORMAT", ""), "Log format (console, json) (env: LOG_FORMAT, empty = use database setting)")
+		workers      = flag.Int("workers", getEnvInt("WORKERS", 0), "Number of concurrent upgrade workers (env: WORKERS, 0 = use database setting)")
+		healthNoAuth = flag.Bool("health-no-auth", getEnvBool("HEALTH_NO_AUTH", false), "Allow /api/health without a bearer token (env: HEALTH_NO_AUTH)")
+		encKey       = flag.String("encryption-key", getEnv("UPGRADER_KEY", ""), "Master key for encrypting CMTS community strings at rest (env: UPGRADER_KEY)")
+		showVer      = flag.Bool("version", false, "Show version and exit")
 	)
 	flag.Parse()
 
+	if gitCommit == "" {
+		gitCommit = vcsRevision()
+	}
+
 	if *showVer {
-		fmt.Printf("Firmware Upgrader v%s (built: %s)\n", version, buildTime)
+		fmt.Printf("Firmware Upgrader v%s (built: %s, commit: %s)\n", version, buildTime, gitCommit)
 		os.Exit(0)
 	}
 
-	// Configure logging
-	setupLogging(*logLevel)
-
-	log.Info().
-		Str("version", version).
-		Str("db_path", *dbPath).
-		Str("bind", *bind).
-		Int("port", *port).
-		Msg("Starting Firmware Upgrader")
+	// Configure logging; the format may still come from the database below
+	setupLogging(*logLevel, *logFormat)
 
 	// Initialize database
-	db, err := database.New(*dbPath)
+	db, err := database.Open(*dbDriver, *dbPath)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to initialize database")
 	}
 	defer db.Close()
 
-	log.Info().Str("path", *dbPath).Msg("Database initialized successfully")
+	if err := db.SetEncryptionKey(*encKey); err != nil {
+		log.Fatal().Err(err).Msg("Failed to configure encryption key")
+	}
+	if !db.EncryptionEnabled() {
+		log.Warn().Msg("No encryption key configured (-encryption-key or UPGRADER_KEY); CMTS community strings are stored in plaintext")
+	}
+
+	if *logFormat == "" {
+		if format, err := db.GetSetting("log_format"); err == nil && format != "" {
+			setupLogging(*logLevel, format)
+		}
+	}
+
+	log.Info().
+		Str("version", version).
+		Str("db_driver", *dbDriver).
+		Str("bind", *bind).
+		Int("port", *port).
+		Msg("Starting Firmware Upgrader")
+
+	log.Info().Str("driver", *dbDriver).Msg("Database initialized successfully")
 
 	// Load settings from database
 	settings, err := db.ListSettings()
@@ -75,16 +99,39 @@ func main() {
 	}
 
 	discoveryInterval, _ := strconv.Atoi(settings["discovery_interval"])
+	evaluationInterval, _ := strconv.Atoi(settings["evaluation_interval"])
+	scheduleInterval, _ := strconv.Atoi(settings["poll_interval"])
 	jobTimeout, _ := strconv.Atoi(settings["job_timeout"])
-	retryAttempts, _ := strconv.Atoi(settings["retry_attempts"])
+	upgradePollInterval, _ := strconv.Atoi(settings["upgrade_poll_interval"])
+	retryAttempts, err := strconv.Atoi(settings["retry_attempts"])
+	if err != nil {
+		retryAttempts = -1 // the engine's default; 0 means never retry
+	}
 	maxPerCMTS, _ := strconv.Atoi(settings["max_upgrades_per_cmts"])
+	discoveryConcurrency, err := strconv.Atoi(settings["discovery_concurrency"])
+	if err != nil || discoveryConcurrency < 0 {
+		discoveryConcurrency = 5
+	}
+	retryBudget, _ := strconv.Atoi(settings["retry_budget"])
+	retryBudgetPerCMTS, _ := strconv.Atoi(settings["retry_budget_per_cmts"])
+	retryBudgetWindow, _ := strconv.Atoi(settings["retry_budget_window"])
+	snmpBudget, _ := strconv.Atoi(settings["snmp_budget"])
 
-	if discoveryInterval == 0 {
+	if discoveryInterval <= 0 {
 		discoveryInterval = 60
 	}
+	if evaluationInterval <= 0 {
+		evaluationInterval = 2 * discoveryInterval
+	}
+	if scheduleInterval <= 0 {
+		scheduleInterval = 30
+	}
 	if jobTimeout == 0 {
 		jobTimeout = 300
 	}
+	if upgradePollInterval <= 0 {
+		upgradePollInterval = 10
+	}
 	if retryAttempts == 0 {
 		retryAttempts = 3
 	}
@@ -95,9 +142,17 @@ func main() {
 	log.Info().
 		Int("workers", workersCount).
 		Int("discovery_interval", discoveryInterval).
+		Int("evaluation_interval", evaluationInterval).
+		Int("poll_interval", scheduleInterval).
 		Int("job_timeout", jobTimeout).
+		Int("upgrade_poll_interval", upgradePollInterval).
 		Int("retry_attempts", retryAttempts).
 		Int("max_per_cmts", maxPerCMTS).
+		Int("discovery_concurrency", discoveryConcurrency).
+		Int("retry_budget", retryBudget).
+		Int("retry_budget_per_cmts", retryBudgetPerCMTS).
+		Int("snmp_budget", snmpBudget).
+		Str("snmp_scheduling_policy", settings["snmp_scheduling_policy"]).
 		Msg("Settings loaded from database")
 
 	// Create context for graceful shutdown
@@ -106,11 +161,20 @@ func main() {
 
 	// Initialize upgrade engine
 	eng := engine.New(db, engine.Config{
-		Workers:       workersCount,
-		RetryAttempts: retryAttempts,
-		PollInterval:  time.Duration(discoveryInterval) * time.Second,
-		JobTimeout:    time.Duration(jobTimeout) * time.Second,
-		MaxPerCMTS:    maxPerCMTS,
+		Workers:              workersCount,
+		RetryAttempts:        retryAttempts,
+		ScheduleInterval:     time.Duration(scheduleInterval) * time.Second,
+		DiscoveryInterval:    time.Duration(discoveryInterval) * time.Second,
+		EvaluationInterval:   time.Duration(evaluationInterval) * time.Second,
+		JobTimeout:           time.Duration(jobTimeout) * time.Second,
+		UpgradePollInterval:  time.Duration(upgradePollInterval) * time.Second,
+		MaxPerCMTS:           maxPerCMTS,
+		DiscoveryConcurrency: discoveryConcurrency,
+		RetryBudget:          retryBudget,
+		RetryBudgetPerCMTS:   retryBudgetPerCMTS,
+		RetryBudgetWindow:    time.Duration(retryBudgetWindow) * time.Second,
+		SNMPBudget:           snmpBudget,
+		SchedulingPolicy:     settings["snmp_scheduling_policy"],
 	})
 
 	// Start engine in background
@@ -124,9 +188,13 @@ func main() {
 
 	// Initialize API server
 	srv := api.NewServer(db, eng, api.Config{
-		Bind:    *bind,
-		Port:    *port,
-		WebRoot: "./web",
+		Bind:             *bind,
+		Port:             *port,
+		WebRoot:          "./web",
+		HealthBypassAuth: *healthNoAuth,
+		Version:          version,
+		BuildTime:        buildTime,
+		GitCommit:        gitCommit,
 	})
 
 	// Start server in background
@@ -148,23 +216,30 @@ func main() {
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer shutdownCancel()
 
-	// Cancel engine context
-	cancel()
-
-	// Shutdown HTTP server
-	if err := srv.Shutdown(shutdownCtx); err != nil {
-		log.Error().Err(err).Msg("Error during server shutdown")
+	// Drain jobs, stop schedulers, stop HTTP server, then close the database
+	report := eng.Shutdown(shutdownCtx, srv.Shutdown)
+	if err := report.Err(); err != nil {
+		log.Error().Err(err).Int("interrupted_jobs", report.InterruptedJobs).Msg("Error during shutdown")
+		return
 	}
 
 	log.Info().Msg("Firmware Upgrader shut down gracefully")
 }
 
-func setupLogging(level string) {
-	// Pretty console logging for development
-	log.Logger = log.Output(zerolog.ConsoleWriter{
-		Out:        os.Stdout,
-		TimeFormat: time.RFC3339,
-	})
+func setupLogging(level, format string) {
+	if format == "json" {
+		// zerolog's native JSON lines, for log aggregation pipelines
+		log.Logger = zerolog.New(os.Stdout).With().Timestamp().Logger()
+	} else {
+		// Pretty console logging for development
+		log.Logger = log.Output(zerolog.ConsoleWriter{
+			Out:        os.Stdout,
+			TimeFormat: time.RFC3339,
+		})
+		if format != "console" && format != "" {
+			log.Warn().Str("provided", format).Msg("Unknown log format, using 'console'")
+		}
+	}
 
 	// Set log level
 	switch level {
@@ -182,6 +257,19 @@ func setupLogging(level string) {
 	}
 }
 
+// vcsRevision returns the commit the Go toolchain stamped into the binary,
+// for builds that didn't set main.gitCommit
+func vcsRevision() string {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				return setting.Value
+			}
+		}
+	}
+	return "unknown"
+}
+
 // getEnv gets an environment variable or returns a default value
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
@@ -199,3 +287,13 @@ func getEnvInt(key string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+// getEnvBool gets an environment variable as bool or returns a default value
+func getEnvBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolVal, err := strconv.ParseBool(value); err == nil {
+			return boolVal
+		}
+	}
+	return defaultValue
+}
@@ -2,11 +2,23 @@ package api
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
+	"io"
+	"math"
+	"net"
 	"net/http"
+	"net/url"
+	"runtime"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/awksedgreep/firmware-upgrader/internal/database"
@@ -14,6 +26,7 @@ import (
 	"github.com/awksedgreep/firmware-upgrader/internal/models"
 	"github.com/gorilla/mux"
 	"github.com/rs/zerolog/log"
+	"golang.org/x/time/rate"
 )
 
 // Config holds API server configuration
@@ -21,6 +34,13 @@ type Config struct {
 	Bind    string
 	Port    int
 	WebRoot string
+	// HealthBypassAuth lets /api/health through without a bearer token
+	HealthBypassAuth bool
+	// Version, BuildTime and GitCommit describe the running build; main
+	// has them injected via -ldflags
+	Version   string
+	BuildTime string
+	GitCommit string
 }
 
 // Server represents the HTTP API server
@@ -31,16 +51,25 @@ type Server struct {
 	router    *mux.Router
 	server    *http.Server
 	templates map[string]*template.Template
+
+	// limiters holds a rate limiter per client IP for rateLimitMiddleware;
+	// rateLimit caches the api_rate_limit setting they enforce
+	limiters      map[string]*clientLimiter
+	limitersSwept time.Time
+	rateLimit     float64
+	limitersMu    sync.Mutex
 }
 
 // NewServer creates a new API server
 func NewServer(db *database.DB, eng *engine.Engine, config Config) *Server {
 	s := &Server{
-		db:     db,
-		engine: eng,
-		config: config,
-		router: mux.NewRouter(),
+		db:       db,
+		engine:   eng,
+		config:   config,
+		router:   mux.NewRouter(),
+		limiters: make(map[string]*clientLimiter),
 	}
+	s.loadRateLimit()
 
 	// Load templates
 	if err := s.loadTemplates(); err != nil {
@@ -132,6 +161,7 @@ func (s *Server) Shutdown(ctx context.Context) error {
 // setupRoutes configures all API routes
 func (s *Server) setupRoutes() {
 	// Middleware
+	s.router.Use(s.requestIDMiddleware)
 	s.router.Use(s.loggingMiddleware)
 	s.router.Use(s.corsMiddleware)
 
@@ -146,51 +176,106 @@ func (s *Server) setupRoutes() {
 	s.router.HandleFunc("/edit-cmts", s.handleEditCMTSPage).Methods("GET")
 	s.router.HandleFunc("/edit-rule", s.handleEditRulePage).Methods("GET")
 
-	// Form submission handlers
-	s.router.HandleFunc("/api/cmts/update", s.handleUpdateCMTSForm).Methods("POST")
+	// Orchestrator probes are registered ahead of the authenticated API
+	s.router.HandleFunc("/api/live", s.handleLive).Methods("GET")
+	s.router.HandleFunc("/api/ready", s.handleReady).Methods("GET")
 
 	// API routes
 	api := s.router.PathPrefix("/api").Subrouter()
+	api.Use(s.rateLimitMiddleware)
+	api.Use(s.authMiddleware)
+
+	// Auth routes
+	api.HandleFunc("/auth/rotate-token", s.handleRotateToken).Methods("POST")
 
 	// CMTS routes
 	api.HandleFunc("/cmts", s.handleListCMTS).Methods("GET")
 	api.HandleFunc("/cmts", s.handleCreateCMTS).Methods("POST")
+	api.HandleFunc("/cmts/batch", s.handleCreateCMTSBatch).Methods("POST")
+	api.HandleFunc("/cmts/test", s.handleTestUnsavedCMTS).Methods("POST")
+	api.HandleFunc("/cmts/update", s.handleUpdateCMTSForm).Methods("POST")
 	api.HandleFunc("/cmts/{id:[0-9]+}", s.handleGetCMTS).Methods("GET")
 	api.HandleFunc("/cmts/{id:[0-9]+}", s.handleUpdateCMTS).Methods("PUT")
 	api.HandleFunc("/cmts/{id:[0-9]+}", s.handleDeleteCMTS).Methods("DELETE")
 	api.HandleFunc("/cmts/{id:[0-9]+}/discover", s.handleDiscoverModems).Methods("POST")
+	api.HandleFunc("/cmts/{id:[0-9]+}/test", s.handleTestCMTS).Methods("POST")
+	api.HandleFunc("/cmts/{id:[0-9]+}/modems", s.handleListCMTSModems).Methods("GET")
+	api.HandleFunc("/cmts/{id:[0-9]+}/modems", s.handleDeleteCMTSModems).Methods("DELETE")
+	api.HandleFunc("/cmts/{id:[0-9]+}/modems/reset", s.handleResetCMTSModems).Methods("POST")
+	api.HandleFunc("/cmts/{id:[0-9]+}/restore", s.handleRestoreCMTS).Methods("POST")
+	api.HandleFunc("/cmts/{id:[0-9]+}/upgrade-progress", s.handleCMTSUpgradeProgress).Methods("GET")
 	api.HandleFunc("/discovery/trigger", s.handleTriggerAllDiscovery).Methods("POST")
 
 	// Modem routes
 	api.HandleFunc("/modems", s.handleListModems).Methods("GET")
+	api.HandleFunc("/modems/search", s.handleSearchModem).Methods("GET")
 	api.HandleFunc("/modems/{id:[0-9]+}", s.handleGetModem).Methods("GET")
+	api.HandleFunc("/modems/{id:[0-9]+}/upgrade", s.handleUpgradeModem).Methods("POST")
+	api.HandleFunc("/modems/{id:[0-9]+}/reboot", s.handleRebootModem).Methods("POST")
+	api.HandleFunc("/modems/{id:[0-9]+}/tags", s.handleSetModemTags).Methods("PUT")
+	api.HandleFunc("/modems/{id:[0-9]+}/matching-rules", s.handleModemMatchingRules).Methods("GET")
+	api.HandleFunc("/modems/{id:[0-9]+}/signal-history", s.handleModemSignalHistory).Methods("GET")
 
 	// Rule routes
 	api.HandleFunc("/rules", s.handleListRules).Methods("GET")
 	api.HandleFunc("/rules", s.handleCreateRule).Methods("POST")
+	api.HandleFunc("/rules/export", s.handleExportRules).Methods("GET")
+	api.HandleFunc("/rules/import", s.handleImportRules).Methods("POST")
 	api.HandleFunc("/rules/{id:[0-9]+}", s.handleGetRule).Methods("GET")
 	api.HandleFunc("/rules/{id:[0-9]+}", s.handleUpdateRule).Methods("PUT")
 	api.HandleFunc("/rules/{id:[0-9]+}", s.handleDeleteRule).Methods("DELETE")
+	api.HandleFunc("/rules/{id:[0-9]+}/evaluate", s.handleEvaluateRule).Methods("POST")
+	api.HandleFunc("/rules/{id:[0-9]+}/clone", s.handleCloneRule).Methods("POST")
+	api.HandleFunc("/rules/{id:[0-9]+}/stats", s.handleGetRuleStats).Methods("GET")
 	api.HandleFunc("/rules/evaluate", s.handleEvaluateRules).Methods("POST")
 
 	// Job routes
 	api.HandleFunc("/jobs", s.handleListJobs).Methods("GET")
+	api.HandleFunc("/jobs/stream", s.handleJobStream).Methods("GET")
+	api.HandleFunc("/jobs/export.csv", s.handleExportJobs).Methods("GET")
+	api.HandleFunc("/jobs/dead-letter", s.handleListDeadLetterJobs).Methods("GET")
+	api.HandleFunc("/jobs/dead-letter/requeue", s.handleRequeueDeadLetterJobs).Methods("POST")
+	api.HandleFunc("/jobs/retry-failed", s.handleRetryFailedJobs).Methods("POST")
 	api.HandleFunc("/jobs/{id:[0-9]+}", s.handleGetJob).Methods("GET")
+	api.HandleFunc("/jobs/{id:[0-9]+}/logs", s.handleGetJobLogs).Methods("GET")
 	api.HandleFunc("/jobs/{id:[0-9]+}/retry", s.handleRetryJob).Methods("POST")
+	api.HandleFunc("/jobs/{id:[0-9]+}/cancel", s.handleCancelJob).Methods("POST")
+
+	// Campaign routes
+	api.HandleFunc("/campaigns", s.handleListCampaigns).Methods("GET")
+	api.HandleFunc("/campaigns", s.handleCreateCampaign).Methods("POST")
+	api.HandleFunc("/campaigns/{id:[0-9]+}", s.handleGetCampaign).Methods("GET")
+	api.HandleFunc("/campaigns/{id:[0-9]+}/cancel", s.handleCancelCampaign).Methods("POST")
 
 	// Activity log routes
 	api.HandleFunc("/activity-log", s.handleListActivityLogs).Methods("GET")
+	api.HandleFunc("/activity-log/export.csv", s.handleExportActivityLogs).Methods("GET")
 
 	// Settings routes
 	api.HandleFunc("/settings", s.handleListSettings).Methods("GET")
 	api.HandleFunc("/settings", s.handleUpdateSettings).Methods("PUT")
+	api.HandleFunc("/settings/schema", s.handleSettingsSchema).Methods("GET")
 	api.HandleFunc("/settings/{key}", s.handleGetSetting).Methods("GET")
 	api.HandleFunc("/settings/{key}", s.handleUpdateSetting).Methods("PUT")
 
+	// Backup routes
+	api.HandleFunc("/backup", s.handleBackup).Methods("GET")
+	api.HandleFunc("/restore", s.handleRestore).Methods("POST")
+
+	// Report routes
+	api.HandleFunc("/reports/firmware-drift", s.handleFirmwareDriftReport).Methods("GET")
+	api.HandleFunc("/reports/firmware-distribution", s.handleFirmwareDistributionReport).Methods("GET")
+	api.HandleFunc("/reports/vendor-distribution", s.handleVendorDistributionReport).Methods("GET")
+
 	// Health and metrics routes
 	api.HandleFunc("/health", s.handleHealth).Methods("GET")
+	api.HandleFunc("/version", s.handleVersion).Methods("GET")
 	api.HandleFunc("/metrics", s.handleMetrics).Methods("GET")
 	api.HandleFunc("/dashboard", s.handleDashboard).Methods("GET")
+	api.HandleFunc("/admin/engine", s.handleEngineStatus).Methods("GET")
+	api.HandleFunc("/engine/status", s.handleEngineStatus).Methods("GET")
+	api.HandleFunc("/engine/pause", s.handlePauseEngine).Methods("POST")
+	api.HandleFunc("/engine/resume", s.handleResumeEngine).Methods("POST")
 
 	// Static assets (CSS, JS)
 	if s.config.WebRoot != "" {
@@ -280,20 +365,46 @@ func (s *Server) handleUpdateCMTSForm(w http.ResponseWriter, r *http.Request) {
 
 	enabled := r.FormValue("enabled") == "true"
 
+	maxOids := 0
+	if value := r.FormValue("snmp_max_oids"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil {
+			maxOids = n
+		}
+	}
+
 	cmts := &models.CMTS{
-		ID:                id,
-		Name:              r.FormValue("name"),
-		IPAddress:         r.FormValue("ip_address"),
-		SNMPPort:          snmpPort,
-		CommunityRead:     r.FormValue("community_read"),
-		CommunityWrite:    r.FormValue("community_write"),
-		CMCommunityString: r.FormValue("cm_community_string"),
-		SNMPVersion:       snmpVersion,
-		Enabled:           enabled,
-	}
-
-	// Update the CMTS
-	if err := s.db.UpdateCMTS(cmts); err != nil {
+		ID:                 id,
+		Name:               r.FormValue("name"),
+		IPAddress:          r.FormValue("ip_address"),
+		SNMPPort:           snmpPort,
+		CommunityRead:      r.FormValue("community_read"),
+		CommunityWrite:     r.FormValue("community_write"),
+		CMCommunityString:  r.FormValue("cm_community_string"),
+		SNMPVersion:        snmpVersion,
+		Enabled:            enabled,
+		MaxFirmwareVersion: strings.TrimSpace(r.FormValue("max_firmware_version")),
+		SNMPMaxOids:        maxOids,
+	}
+
+	err = s.keepRedactedSecrets(cmts)
+	if err == nil {
+		err = s.db.UpdateCMTS(cmts)
+	}
+
+	// Map errors as handleUpdateCMTS does
+	var validationErr *models.ValidationError
+	switch {
+	case err == nil:
+	case err == models.ErrNotFound:
+		http.Error(w, "CMTS not found", http.StatusNotFound)
+		return
+	case err == models.ErrDuplicate:
+		http.Error(w, fmt.Sprintf("A CMTS with IP address %s already exists", cmts.IPAddress), http.StatusConflict)
+		return
+	case errors.As(err, &validationErr):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	default:
 		log.Error().Err(err).Int("cmts_id", id).Msg("Failed to update CMTS")
 		http.Error(w, "Failed to update CMTS", http.StatusInternalServerError)
 		return
@@ -313,11 +424,54 @@ func (s *Server) handleUpdateCMTSForm(w http.ResponseWriter, r *http.Request) {
 
 // Middleware
 
+// requestIDHeader carries a request's correlation ID in and out
+const requestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds client-supplied request IDs
+const maxRequestIDLength = 64
+
+type requestIDKey struct{}
+
+// requestIDMiddleware tags each request with an ID, reusing the client's
+// X-Request-ID when it is sane, and echoes it in the response so a client
+// can quote it when reporting a problem
+func (s *Server) requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = models.NewTraceID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// validRequestID accepts IDs of letters, digits, '-', '_', '.' and ':', so a
+// client can't inject arbitrary text into the logs
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("-_.:", c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// requestID returns the ID requestIDMiddleware gave r
+func requestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey{}).(string)
+	return id
+}
+
 func (s *Server) loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 		next.ServeHTTP(w, r)
 		log.Debug().
+			Str("request_id", requestID(r)).
 			Str("method", r.Method).
 			Str("path", r.URL.Path).
 			Dur("duration", time.Since(start)).
@@ -325,11 +479,23 @@ func (s *Server) loggingMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// corsMiddleware allows cross-origin requests from the origins listed in the
+// cors_allowed_origins setting. A "*" entry allows any origin; otherwise the
+// request's Origin is echoed back only if it is listed.
 func (s *Server) corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Add("Vary", "Origin")
+
+		allowed, err := s.db.GetSetting("cors_allowed_origins")
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to load CORS allowed origins")
+		}
+		if origin := allowedOrigin(allowed, r.Header.Get("Origin")); origin != "" {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Request-ID")
+		w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID")
 
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
@@ -340,8 +506,212 @@ func (s *Server) corsMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// allowedOrigin returns the Access-Control-Allow-Origin value for a request
+// from origin given the comma-separated allowlist, or "" if origin isn't
+// allowed
+func allowedOrigin(allowlist, origin string) string {
+	for _, entry := range strings.Split(allowlist, ",") {
+		entry = strings.TrimSuffix(strings.TrimSpace(entry), "/")
+		if entry == "*" {
+			return "*"
+		}
+		if origin != "" && strings.EqualFold(entry, origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
+// authMiddleware requires a bearer token matching the api_token setting.
+// An empty token disables authentication.
+func (s *Server) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.config.HealthBypassAuth && r.URL.Path == "/api/health" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, err := s.db.GetSetting("api_token")
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to load API token")
+			s.respondError(w, http.StatusInternalServerError, "Failed to load authentication settings")
+			return
+		}
+
+		if token == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			s.respondError(w, http.StatusUnauthorized, "Invalid or missing bearer token")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// limiterIdle is how long a client's rate limiter is kept after its last
+// request; stale limiters are swept at most once per limiterIdle
+const limiterIdle = 10 * time.Minute
+
+// clientLimiter is one client's request budget
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// loadRateLimit caches the api_rate_limit setting so requests don't each
+// read it from the database. It runs at startup and after settings change;
+// a new limit starts every client with a fresh budget.
+func (s *Server) loadRateLimit() {
+	limit := 0.0
+	if value, err := s.db.GetSetting("api_rate_limit"); err == nil && value != "" {
+		limit, _ = strconv.ParseFloat(value, 64)
+	}
+
+	s.limitersMu.Lock()
+	defer s.limitersMu.Unlock()
+	if limit != s.rateLimit {
+		s.rateLimit = limit
+		s.limiters = make(map[string]*clientLimiter)
+	}
+}
+
+// rateLimitMiddleware limits each client IP to api_rate_limit requests per
+// second, with bursts of up to one second's worth. 0 disables the limit.
+// Requests from localhost are never limited.
+func (s *Server) rateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.limitersMu.Lock()
+		limit := s.rateLimit
+		s.limitersMu.Unlock()
+		if limit <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		host := clientIP(r)
+		if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		allowed, wait := s.takeToken(host)
+		if !allowed {
+			retryAfter := int(wait.Seconds()) + 1
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			log.Warn().
+				Str("client", host).
+				Str("path", r.URL.Path).
+				Float64("limit", limit).
+				Msg("API rate limit exceeded")
+			s.respondError(w, http.StatusTooManyRequests, "Rate limit exceeded")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientIP returns the IP address a request came from
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// takeToken spends one of client's tokens, sweeping idle limiters as it
+// goes. If none is available it reports how long until one is.
+func (s *Server) takeToken(client string) (bool, time.Duration) {
+	now := time.Now()
+
+	s.limitersMu.Lock()
+	defer s.limitersMu.Unlock()
+
+	if now.Sub(s.limitersSwept) > limiterIdle {
+		for ip, cl := range s.limiters {
+			if now.Sub(cl.lastSeen) > limiterIdle {
+				delete(s.limiters, ip)
+			}
+		}
+		s.limitersSwept = now
+	}
+
+	cl, ok := s.limiters[client]
+	if !ok {
+		burst := int(s.rateLimit)
+		if burst < 1 {
+			burst = 1
+		}
+		cl = &clientLimiter{limiter: rate.NewLimiter(rate.Limit(s.rateLimit), burst)}
+		s.limiters[client] = cl
+	}
+	cl.lastSeen = now
+
+	reservation := cl.limiter.ReserveN(now, 1)
+	if wait := reservation.DelayFrom(now); wait > 0 {
+		reservation.CancelAt(now)
+		return false, wait
+	}
+	return true, 0
+}
+
 // Helper functions
 
+// defaultMaxListItems applies when the max_list_items setting is missing or invalid
+const defaultMaxListItems = 1000
+
+// maxListItems returns the most items a list endpoint may return in one response
+func (s *Server) maxListItems() int {
+	value, err := s.db.GetSetting("max_list_items")
+	if err != nil {
+		return defaultMaxListItems
+	}
+	max, err := strconv.Atoi(value)
+	if err != nil || max <= 0 {
+		return defaultMaxListItems
+	}
+	return max
+}
+
+// defaultMaxRetries returns the retry_attempts setting, which rules that
+// don't set max_retries inherit. 0 is kept, so failed upgrades aren't retried.
+func (s *Server) defaultMaxRetries() int {
+	value, err := s.db.GetSetting("retry_attempts")
+	if err != nil {
+		return models.DefaultMaxRetries
+	}
+	retries, err := strconv.Atoi(value)
+	if err != nil || retries < 0 {
+		return models.DefaultMaxRetries
+	}
+	if retries > models.MaxRuleRetries {
+		return models.MaxRuleRetries
+	}
+	return retries
+}
+
+// markStale applies the cleanup_offline_minutes setting to modems, so their
+// is_stale flag agrees with the cleanup that marks them offline
+func (s *Server) markStale(modems ...*models.CableModem) {
+	value, _ := s.db.GetSetting("cleanup_offline_minutes")
+	threshold := models.ModemStaleThreshold(value)
+	for _, modem := range modems {
+		modem.StaleAfter = threshold
+	}
+}
+
+// markTruncated flags a list response that was cut off at limit items
+func (s *Server) markTruncated(w http.ResponseWriter, limit int) {
+	w.Header().Set("X-Result-Truncated", "true")
+	w.Header().Set("Warning", fmt.Sprintf(`199 - "results truncated to %d items, use limit and offset to page"`, limit))
+}
+
 func (s *Server) respondJSON(w http.ResponseWriter, status int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -354,6 +724,33 @@ func (s *Server) respondError(w http.ResponseWriter, statusCode int, message str
 	s.respondJSON(w, statusCode, map[string]string{"error": message})
 }
 
+// handleRotateToken generates a new API token and returns it once
+func (s *Server) handleRotateToken(w http.ResponseWriter, r *http.Request) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		log.Error().Err(err).Msg("Failed to generate API token")
+		s.respondError(w, http.StatusInternalServerError, "Failed to generate token")
+		return
+	}
+	token := hex.EncodeToString(buf)
+
+	if err := s.db.SetSetting("api_token", token); err != nil {
+		log.Error().Err(err).Msg("Failed to store API token")
+		s.respondError(w, http.StatusInternalServerError, "Failed to store token")
+		return
+	}
+
+	// Log activity (never include the token itself)
+	s.db.LogActivity(&models.ActivityLog{
+		EventType:  models.EventSystemEvent,
+		EntityType: "setting",
+		EntityID:   0,
+		Message:    "Rotated API token",
+	})
+
+	s.respondJSON(w, http.StatusOK, map[string]string{"token": token})
+}
+
 // handleHealth returns service health status
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	// Check database connectivity
@@ -363,16 +760,128 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 			"status":  "unhealthy",
 			"error":   "database connection failed",
 			"details": err.Error(),
+			"subsystems": map[string]interface{}{
+				"database": map[string]string{"status": "failed"},
+			},
 		})
 		return
 	}
 
-	s.respondJSON(w, http.StatusOK, map[string]interface{}{
-		"status":     "healthy",
-		"version":    "v0.5.0",
-		"database":   "connected",
-		"total_cmts": len(cmtsList),
+	// An engine that hasn't started yet is reported but not held against
+	// the service; /api/ready covers startup
+	liveness := s.engine.Liveness()
+	engineStatus, workerStatus := "ok", "ok"
+	switch {
+	case liveness.LastHeartbeat == nil:
+		engineStatus, workerStatus = "starting", "starting"
+	case liveness.Stalled:
+		engineStatus = "stalled"
+	}
+	if liveness.LastHeartbeat != nil && liveness.RunningWorkers < liveness.Workers {
+		workerStatus = "degraded"
+	}
+
+	status, code := "healthy", http.StatusOK
+	if engineStatus == "stalled" || workerStatus == "degraded" {
+		status, code = "degraded", http.StatusServiceUnavailable
+	}
+
+	s.respondJSON(w, code, map[string]interface{}{
+		"status":        status,
+		"version":       s.config.Version,
+		"database":      "connected",
+		"total_cmts":    len(cmtsList),
+		"engine_paused": s.engine.Paused(),
+		"subsystems": map[string]interface{}{
+			"database": map[string]string{"status": "ok"},
+			"engine": map[string]interface{}{
+				"status":              engineStatus,
+				"last_heartbeat":      liveness.LastHeartbeat,
+				"stale_after_seconds": int(liveness.StaleAfter.Seconds()),
+			},
+			"workers": map[string]interface{}{
+				"status":     workerStatus,
+				"running":    liveness.RunningWorkers,
+				"configured": liveness.Workers,
+			},
+		},
+	})
+}
+
+// handleVersion reports which build is running
+func (s *Server) handleVersion(w http.ResponseWriter, r *http.Request) {
+	s.respondJSON(w, http.StatusOK, map[string]string{
+		"version":    s.config.Version,
+		"build_time": s.config.BuildTime,
+		"go_version": runtime.Version(),
+		"git_commit": s.config.GitCommit,
+	})
+}
+
+// handleEngineStatus returns a snapshot of the upgrade engine's internal state
+func (s *Server) handleEngineStatus(w http.ResponseWriter, r *http.Request) {
+	s.respondJSON(w, http.StatusOK, s.engine.Status())
+}
+
+// handlePauseEngine stops new upgrades from being created or started
+func (s *Server) handlePauseEngine(w http.ResponseWriter, r *http.Request) {
+	if err := s.engine.Pause(); err != nil {
+		log.Error().Err(err).Msg("Failed to pause engine")
+		s.respondError(w, http.StatusInternalServerError, "Failed to pause engine")
+		return
+	}
+
+	s.db.LogActivity(&models.ActivityLog{
+		EventType:  models.EventSystemEvent,
+		EntityType: "system",
+		Message:    "Upgrade engine paused",
+	})
+
+	s.respondJSON(w, http.StatusOK, map[string]bool{"paused": true})
+}
+
+// handleResumeEngine lets the engine create and start upgrades again
+func (s *Server) handleResumeEngine(w http.ResponseWriter, r *http.Request) {
+	if err := s.engine.Resume(); err != nil {
+		log.Error().Err(err).Msg("Failed to resume engine")
+		s.respondError(w, http.StatusInternalServerError, "Failed to resume engine")
+		return
+	}
+
+	s.db.LogActivity(&models.ActivityLog{
+		EventType:  models.EventSystemEvent,
+		EntityType: "system",
+		Message:    "Upgrade engine resumed",
 	})
+
+	s.respondJSON(w, http.StatusOK, map[string]bool{"paused": false})
+}
+
+// handleLive reports that the process is up
+func (s *Server) handleLive(w http.ResponseWriter, r *http.Request) {
+	s.respondJSON(w, http.StatusOK, map[string]string{"status": "alive"})
+}
+
+// handleReady reports whether the service can accept traffic
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	if err := s.db.Ping(); err != nil {
+		s.respondJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
+			"status":  "not_ready",
+			"error":   "database not ready",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if !s.engine.Ready() {
+		s.respondJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
+			"status": "not_ready",
+			"error":  "engine not started",
+		})
+		return
+	}
+
+	s.respondJSON(w, http.StatusOK, map[string]string{"status": "ready"})
 }
 
 // handleMetrics returns system metrics
@@ -435,7 +944,7 @@ func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
 	rules, _ := s.db.ListRules()
 	pendingJobs, _ := s.db.ListJobs(models.JobStatusPending, 0)
 	inProgressJobs, _ := s.db.ListJobs(models.JobStatusInProgress, 0)
-	recentActivity, _ := s.db.ListActivityLogs(10, 0)
+	recentActivity, _ := s.db.ListActivityLogs(database.ActivityLogFilter{}, 10, 0)
 
 	// Count enabled items
 	enabledCMTS := 0
@@ -468,8 +977,38 @@ func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
 
 // CMTS Handlers
 
+// handleListCMTS lists CMTS devices. Without enabled, q, limit or offset
+// every CMTS is returned, as before filtering was added.
 func (s *Server) handleListCMTS(w http.ResponseWriter, r *http.Request) {
-	cmtsList, err := s.db.ListCMTS()
+	query := r.URL.Query()
+
+	var cmtsList []*models.CMTS
+	var total int
+	var err error
+	switch {
+	case query.Has("enabled") || query.Has("q") || query.Has("limit") || query.Has("offset"):
+		maxItems := s.maxListItems()
+		limit := maxItems
+		if l := query.Get("limit"); l != "" {
+			limit, _ = strconv.Atoi(l)
+		}
+		if limit <= 0 || limit > maxItems {
+			limit = maxItems
+		}
+
+		offset := 0
+		if o, err := strconv.Atoi(query.Get("offset")); err == nil && o > 0 {
+			offset = o
+		}
+
+		cmtsList, total, err = s.db.ListCMTSFiltered(query.Get("enabled") == "true", query.Get("q"), limit, offset)
+	case query.Get("include_deleted") == "true":
+		cmtsList, err = s.db.ListCMTSIncludingDeleted()
+		total = len(cmtsList)
+	default:
+		cmtsList, err = s.db.ListCMTS()
+		total = len(cmtsList)
+	}
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to list CMTS")
 		s.respondError(w, http.StatusInternalServerError, "Failed to list CMTS")
@@ -479,7 +1018,13 @@ func (s *Server) handleListCMTS(w http.ResponseWriter, r *http.Request) {
 	if cmtsList == nil {
 		cmtsList = []*models.CMTS{}
 	}
+	if !includeSecrets(r) {
+		for _, cmts := range cmtsList {
+			redactSecrets(cmts)
+		}
+	}
 
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
 	s.respondJSON(w, http.StatusOK, cmtsList)
 }
 
@@ -491,6 +1036,10 @@ func (s *Server) handleCreateCMTS(w http.ResponseWriter, r *http.Request) {
 	}
 
 	id, err := s.db.CreateCMTS(&cmts)
+	if err == models.ErrDuplicate {
+		s.respondError(w, http.StatusConflict, fmt.Sprintf("A CMTS with IP address %s already exists", cmts.IPAddress))
+		return
+	}
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to create CMTS")
 		s.respondError(w, http.StatusBadRequest, err.Error())
@@ -511,6 +1060,75 @@ func (s *Server) handleCreateCMTS(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// handleCreateCMTSBatch creates several CMTS at once, skipping invalid and
+// duplicate entries
+func (s *Server) handleCreateCMTSBatch(w http.ResponseWriter, r *http.Request) {
+	var list []*models.CMTS
+	if err := json.NewDecoder(r.Body).Decode(&list); err != nil {
+		s.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if len(list) == 0 {
+		s.respondError(w, http.StatusBadRequest, "At least one CMTS is required")
+		return
+	}
+
+	ids, errs, err := s.db.CreateCMTSBatch(list)
+	if err == models.ErrDuplicate {
+		// Another request took an IP between the check and the insert
+		s.respondError(w, http.StatusConflict, "A CMTS in the batch reuses the IP address of an existing CMTS; nothing was created")
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to create CMTS batch")
+		s.respondError(w, http.StatusInternalServerError, "Failed to create CMTS batch")
+		return
+	}
+
+	results := make([]map[string]interface{}, len(list))
+	created := 0
+	for i, id := range ids {
+		if id == 0 {
+			message := errs[i].Error()
+			if errs[i] == models.ErrDuplicate {
+				message = fmt.Sprintf("A CMTS with IP address %s already exists", list[i].IPAddress)
+			}
+			results[i] = map[string]interface{}{
+				"index":   i,
+				"success": false,
+				"error":   message,
+			}
+			continue
+		}
+
+		created++
+		results[i] = map[string]interface{}{
+			"index":   i,
+			"success": true,
+			"id":      id,
+		}
+
+		s.db.LogActivity(&models.ActivityLog{
+			EventType:  models.EventCMTSAdded,
+			EntityType: "cmts",
+			EntityID:   id,
+			Message:    fmt.Sprintf("Added CMTS: %s", list[i].Name),
+		})
+	}
+
+	status := http.StatusCreated
+	if created < len(list) {
+		status = http.StatusMultiStatus
+	}
+
+	s.respondJSON(w, status, map[string]interface{}{
+		"created": created,
+		"failed":  len(list) - created,
+		"results": results,
+	})
+}
+
 func (s *Server) handleGetCMTS(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, _ := strconv.Atoi(vars["id"])
@@ -525,10 +1143,54 @@ func (s *Server) handleGetCMTS(w http.ResponseWriter, r *http.Request) {
 		s.respondError(w, http.StatusInternalServerError, "Failed to get CMTS")
 		return
 	}
+	if !includeSecrets(r) {
+		redactSecrets(cmts)
+	}
 
 	s.respondJSON(w, http.StatusOK, cmts)
 }
 
+// redactedSecret stands in for a secret in API responses. Sending it back on
+// update keeps the stored value.
+const redactedSecret = "********"
+
+// includeSecrets reports whether the caller asked for SNMP communities
+// with ?include_secrets=true
+func includeSecrets(r *http.Request) bool {
+	return r.URL.Query().Get("include_secrets") == "true"
+}
+
+// redactSecrets hides a CMTS's write and cable modem communities from an API
+// response
+func redactSecrets(cmts *models.CMTS) {
+	if cmts.CommunityWrite != "" {
+		cmts.CommunityWrite = redactedSecret
+	}
+	if cmts.CMCommunityString != "" {
+		cmts.CMCommunityString = redactedSecret
+	}
+}
+
+// keepRedactedSecrets restores the stored communities when an update echoes
+// back the redacted placeholder from a GET
+func (s *Server) keepRedactedSecrets(cmts *models.CMTS) error {
+	if cmts.CommunityWrite != redactedSecret && cmts.CMCommunityString != redactedSecret {
+		return nil
+	}
+
+	existing, err := s.db.GetCMTS(cmts.ID)
+	if err != nil {
+		return err
+	}
+	if cmts.CommunityWrite == redactedSecret {
+		cmts.CommunityWrite = existing.CommunityWrite
+	}
+	if cmts.CMCommunityString == redactedSecret {
+		cmts.CMCommunityString = existing.CMCommunityString
+	}
+	return nil
+}
+
 func (s *Server) handleUpdateCMTS(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, _ := strconv.Atoi(vars["id"])
@@ -540,7 +1202,23 @@ func (s *Server) handleUpdateCMTS(w http.ResponseWriter, r *http.Request) {
 	}
 	cmts.ID = id
 
-	if err := s.db.UpdateCMTS(&cmts); err != nil {
+	err := s.keepRedactedSecrets(&cmts)
+	if err == models.ErrNotFound {
+		s.respondError(w, http.StatusNotFound, "CMTS not found")
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to update CMTS")
+		s.respondError(w, http.StatusInternalServerError, "Failed to update CMTS")
+		return
+	}
+
+	err = s.db.UpdateCMTS(&cmts)
+	if err == models.ErrDuplicate {
+		s.respondError(w, http.StatusConflict, fmt.Sprintf("A CMTS with IP address %s already exists", cmts.IPAddress))
+		return
+	}
+	if err != nil {
 		log.Error().Err(err).Msg("Failed to update CMTS")
 		s.respondError(w, http.StatusBadRequest, err.Error())
 		return
@@ -582,6 +1260,36 @@ func (s *Server) handleDeleteCMTS(w http.ResponseWriter, r *http.Request) {
 	s.respondJSON(w, http.StatusOK, map[string]bool{"success": true})
 }
 
+// handleRestoreCMTS undoes a soft delete
+func (s *Server) handleRestoreCMTS(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	if err := s.db.RestoreCMTS(id); err != nil {
+		if err == models.ErrNotFound {
+			s.respondError(w, http.StatusNotFound, "Deleted CMTS not found")
+			return
+		}
+		if err == models.ErrDuplicate {
+			s.respondError(w, http.StatusConflict, "Another CMTS now uses this CMTS's IP address")
+			return
+		}
+		log.Error().Err(err).Msg("Failed to restore CMTS")
+		s.respondError(w, http.StatusInternalServerError, "Failed to restore CMTS")
+		return
+	}
+
+	// Log activity
+	s.db.LogActivity(&models.ActivityLog{
+		EventType:  models.EventCMTSRestored,
+		EntityType: "cmts",
+		EntityID:   id,
+		Message:    fmt.Sprintf("Restored CMTS ID: %d", id),
+	})
+
+	s.respondJSON(w, http.StatusOK, map[string]bool{"success": true})
+}
+
 func (s *Server) handleDiscoverModems(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, _ := strconv.Atoi(vars["id"])
@@ -597,9 +1305,52 @@ func (s *Server) handleDiscoverModems(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func (s *Server) handleTriggerAllDiscovery(w http.ResponseWriter, r *http.Request) {
-	log.Info().Msg("Manual trigger: discovery for all CMTS")
-
+// handleTestCMTS checks SNMP connectivity to a saved CMTS
+func (s *Server) handleTestCMTS(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	cmts, err := s.db.GetCMTS(id)
+	if err == models.ErrNotFound {
+		s.respondError(w, http.StatusNotFound, "CMTS not found")
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get CMTS")
+		s.respondError(w, http.StatusInternalServerError, "Failed to get CMTS")
+		return
+	}
+
+	result, err := s.engine.TestCMTSConnection(cmts)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.respondJSON(w, http.StatusOK, result)
+}
+
+// handleTestUnsavedCMTS checks SNMP connectivity using the CMTS settings in
+// the request body, so a configuration can be tried before it is saved
+func (s *Server) handleTestUnsavedCMTS(w http.ResponseWriter, r *http.Request) {
+	var cmts models.CMTS
+	if err := json.NewDecoder(r.Body).Decode(&cmts); err != nil {
+		s.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	result, err := s.engine.TestCMTSConnection(&cmts)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.respondJSON(w, http.StatusOK, result)
+}
+
+func (s *Server) handleTriggerAllDiscovery(w http.ResponseWriter, r *http.Request) {
+	log.Info().Msg("Manual trigger: discovery for all CMTS")
+
 	cmtsList, err := s.db.ListCMTS()
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to list CMTS")
@@ -636,267 +1387,1542 @@ func (s *Server) handleListModems(w http.ResponseWriter, r *http.Request) {
 		cmtsID, _ = strconv.Atoi(id)
 	}
 
-	modems, err := s.db.ListModems(cmtsID)
+	maxItems := s.maxListItems()
+	limit := maxItems
+	if l := r.URL.Query().Get("limit"); l != "" {
+		limit, _ = strconv.Atoi(l)
+	}
+	if limit <= 0 || limit > maxItems {
+		limit = maxItems
+	}
+
+	offset := 0
+	if o := r.URL.Query().Get("offset"); o != "" {
+		offset, _ = strconv.Atoi(o)
+	}
+
+	// Fetch one extra row to detect whether more remain
+	modems, err := s.db.ListModemsPage(cmtsID, limit+1, offset)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to list modems")
 		s.respondError(w, http.StatusInternalServerError, "Failed to list modems")
 		return
 	}
 
+	if len(modems) > limit {
+		modems = modems[:limit]
+		s.markTruncated(w, limit)
+	}
+
 	if modems == nil {
 		modems = []*models.CableModem{}
 	}
+	s.markStale(modems...)
 
 	s.respondJSON(w, http.StatusOK, modems)
 }
 
-func (s *Server) handleGetModem(w http.ResponseWriter, r *http.Request) {
+func (s *Server) handleListCMTSModems(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, _ := strconv.Atoi(vars["id"])
 
-	modem, err := s.db.GetModem(id)
+	_, err := s.db.GetCMTS(id)
 	if err == models.ErrNotFound {
-		s.respondError(w, http.StatusNotFound, "Modem not found")
+		s.respondError(w, http.StatusNotFound, "CMTS not found")
 		return
 	}
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to get modem")
-		s.respondError(w, http.StatusInternalServerError, "Failed to get modem")
+		log.Error().Err(err).Msg("Failed to get CMTS")
+		s.respondError(w, http.StatusInternalServerError, "Failed to get CMTS")
 		return
 	}
 
-	s.respondJSON(w, http.StatusOK, modem)
-}
-
-// Rule Handlers
-
-func (s *Server) handleListRules(w http.ResponseWriter, r *http.Request) {
-	rules, err := s.db.ListRules()
+	limit := s.maxListItems()
+	modems, err := s.db.ListModemsPage(id, limit+1, 0)
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to list rules")
-		s.respondError(w, http.StatusInternalServerError, "Failed to list rules")
+		log.Error().Err(err).Msg("Failed to list modems")
+		s.respondError(w, http.StatusInternalServerError, "Failed to list modems")
 		return
 	}
 
-	if rules == nil {
-		rules = []*models.UpgradeRule{}
+	if len(modems) > limit {
+		modems = modems[:limit]
+		s.markTruncated(w, limit)
 	}
 
-	s.respondJSON(w, http.StatusOK, rules)
-}
-
-func (s *Server) handleCreateRule(w http.ResponseWriter, r *http.Request) {
-	var rule models.UpgradeRule
-	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
-		s.respondError(w, http.StatusBadRequest, "Invalid request body")
-		return
+	if modems == nil {
+		modems = []*models.CableModem{}
 	}
+	s.markStale(modems...)
 
-	id, err := s.db.CreateRule(&rule)
+	counts, err := s.db.CountModemsByStatus(id)
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to create rule")
-		s.respondError(w, http.StatusBadRequest, err.Error())
+		log.Error().Err(err).Msg("Failed to count modems")
+		s.respondError(w, http.StatusInternalServerError, "Failed to count modems")
 		return
 	}
 
-	// Log activity
-	s.db.LogActivity(&models.ActivityLog{
-		EventType:  models.EventRuleCreated,
-		EntityType: "rule",
-		EntityID:   id,
-		Message:    fmt.Sprintf("Created rule: %s", rule.Name),
-	})
+	summary := map[string]int{"online": 0, "offline": 0, "partial": 0, "denied": 0}
+	for status, count := range counts {
+		summary[status] = count
+	}
 
-	s.respondJSON(w, http.StatusCreated, map[string]interface{}{
-		"success": true,
-		"id":      id,
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"modems":  modems,
+		"summary": summary,
 	})
 }
 
-func (s *Server) handleGetRule(w http.ResponseWriter, r *http.Request) {
+// handleDeleteCMTSModems purges every modem on a CMTS, for decommissioned
+// nodes. Modems with a pending or in-progress job are kept and listed.
+func (s *Server) handleDeleteCMTSModems(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, _ := strconv.Atoi(vars["id"])
 
-	rule, err := s.db.GetRule(id)
-	if err == models.ErrNotFound {
-		s.respondError(w, http.StatusNotFound, "Rule not found")
+	if !s.cmtsExists(w, id) {
 		return
 	}
+
+	deleted, skipped, err := s.db.DeleteModemsByCMTS(id)
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to get rule")
-		s.respondError(w, http.StatusInternalServerError, "Failed to get rule")
+		log.Error().Err(err).Int("cmts_id", id).Msg("Failed to delete modems")
+		s.respondError(w, http.StatusInternalServerError, "Failed to delete modems")
 		return
 	}
+	s.logModemsDeleted(id, deleted, skipped)
 
-	s.respondJSON(w, http.StatusOK, rule)
+	if skipped == nil {
+		skipped = []string{}
+	}
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"deleted": deleted,
+		"skipped": skipped,
+	})
 }
 
-func (s *Server) handleUpdateRule(w http.ResponseWriter, r *http.Request) {
+// handleResetCMTSModems deletes a CMTS's stale modems and starts a fresh
+// discovery to repopulate it. Stale uses the same cleanup_offline_minutes
+// threshold as is_stale.
+func (s *Server) handleResetCMTSModems(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, _ := strconv.Atoi(vars["id"])
 
-	var rule models.UpgradeRule
-	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
-		s.respondError(w, http.StatusBadRequest, "Invalid request body")
+	if !s.cmtsExists(w, id) {
 		return
 	}
-	rule.ID = id
 
-	if err := s.db.UpdateRule(&rule); err != nil {
-		log.Error().Err(err).Msg("Failed to update rule")
-		s.respondError(w, http.StatusBadRequest, err.Error())
+	value, _ := s.db.GetSetting("cleanup_offline_minutes")
+	seenBefore := time.Now().Add(-models.ModemStaleThreshold(value))
+	deleted, skipped, err := s.db.DeleteStaleModemsByCMTS(id, seenBefore)
+	if err != nil {
+		log.Error().Err(err).Int("cmts_id", id).Msg("Failed to delete stale modems")
+		s.respondError(w, http.StatusInternalServerError, "Failed to delete stale modems")
 		return
 	}
+	s.logModemsDeleted(id, deleted, skipped)
 
-	// Log activity
-	s.db.LogActivity(&models.ActivityLog{
-		EventType:  models.EventRuleUpdated,
-		EntityType: "rule",
-		EntityID:   id,
-		Message:    fmt.Sprintf("Updated rule: %s", rule.Name),
-	})
+	go func() {
+		if err := s.engine.DiscoverModems(id); err != nil {
+			log.Error().Err(err).Int("cmts_id", id).Msg("Discovery failed")
+		}
+	}()
 
-	s.respondJSON(w, http.StatusOK, map[string]bool{"success": true})
+	if skipped == nil {
+		skipped = []string{}
+	}
+	s.respondJSON(w, http.StatusAccepted, map[string]interface{}{
+		"deleted": deleted,
+		"skipped": skipped,
+		"message": "Discovery started",
+	})
 }
 
-func (s *Server) handleDeleteRule(w http.ResponseWriter, r *http.Request) {
+// handleCMTSUpgradeProgress reports how many of a CMTS's upgrade jobs are
+// pending, in progress, completed and failed over its whole lifetime.
+// Skipped jobs, including cancelled ones, aren't counted towards the total.
+func (s *Server) handleCMTSUpgradeProgress(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, _ := strconv.Atoi(vars["id"])
 
-	if err := s.db.DeleteRule(id); err != nil {
-		if err == models.ErrNotFound {
-			s.respondError(w, http.StatusNotFound, "Rule not found")
-			return
-		}
-		log.Error().Err(err).Msg("Failed to delete rule")
-		s.respondError(w, http.StatusInternalServerError, "Failed to delete rule")
+	if !s.cmtsExists(w, id) {
 		return
 	}
 
-	// Log activity
-	s.db.LogActivity(&models.ActivityLog{
-		EventType:  models.EventRuleDeleted,
-		EntityType: "rule",
-		EntityID:   id,
-		Message:    fmt.Sprintf("Deleted rule ID: %d", id),
-	})
-
-	s.respondJSON(w, http.StatusOK, map[string]bool{"success": true})
-}
+	counts, err := s.db.CountCMTSJobsByStatus(id)
+	if err != nil {
+		log.Error().Err(err).Int("cmts_id", id).Msg("Failed to count CMTS jobs")
+		s.respondError(w, http.StatusInternalServerError, "Failed to get upgrade progress")
+		return
+	}
 
-// Job Handlers
+	jobs := map[string]int{}
+	total := 0
+	for _, status := range []string{
+		models.JobStatusPending,
+		models.JobStatusInProgress,
+		models.JobStatusCompleted,
+		models.JobStatusFailed,
+	} {
+		jobs[status] = counts[status]
+		total += counts[status]
+	}
 
-func (s *Server) handleListJobs(w http.ResponseWriter, r *http.Request) {
-	status := r.URL.Query().Get("status")
-	limit := 100
-	if l := r.URL.Query().Get("limit"); l != "" {
-		limit, _ = strconv.Atoi(l)
+	percent := 0.0
+	if total > 0 {
+		percent = math.Round(float64(jobs[models.JobStatusCompleted])*1000/float64(total)) / 10
 	}
 
-	jobs, err := s.db.ListJobs(status, limit)
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"cmts_id":          id,
+		"jobs":             jobs,
+		"total":            total,
+		"percent_complete": percent,
+	})
+}
+
+// cmtsExists responds 404 or 500 and returns false unless CMTS id exists
+func (s *Server) cmtsExists(w http.ResponseWriter, id int) bool {
+	_, err := s.db.GetCMTS(id)
+	if err == models.ErrNotFound {
+		s.respondError(w, http.StatusNotFound, "CMTS not found")
+		return false
+	}
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to list jobs")
-		s.respondError(w, http.StatusInternalServerError, "Failed to list jobs")
-		return
+		log.Error().Err(err).Msg("Failed to get CMTS")
+		s.respondError(w, http.StatusInternalServerError, "Failed to get CMTS")
+		return false
 	}
+	return true
+}
 
-	if jobs == nil {
-		jobs = []*models.UpgradeJob{}
+// logModemsDeleted records a bulk modem delete in the activity log
+func (s *Server) logModemsDeleted(cmtsID, deleted int, skipped []string) {
+	message := fmt.Sprintf("Deleted %d modems from CMTS ID: %d", deleted, cmtsID)
+	if len(skipped) > 0 {
+		message += fmt.Sprintf(" (%d with active jobs kept)", len(skipped))
 	}
-
-	s.respondJSON(w, http.StatusOK, jobs)
+	s.db.LogActivity(&models.ActivityLog{
+		EventType:  models.EventModemsDeleted,
+		EntityType: "cmts",
+		EntityID:   cmtsID,
+		Message:    message,
+	})
 }
 
-func (s *Server) handleGetJob(w http.ResponseWriter, r *http.Request) {
+func (s *Server) handleGetModem(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, _ := strconv.Atoi(vars["id"])
 
-	job, err := s.db.GetJob(id)
+	if r.URL.Query().Get("refresh") == "true" {
+		s.refreshModem(w, id)
+		return
+	}
+
+	modem, err := s.db.GetModem(id)
 	if err == models.ErrNotFound {
-		s.respondError(w, http.StatusNotFound, "Job not found")
+		s.respondError(w, http.StatusNotFound, "Modem not found")
 		return
 	}
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to get job")
-		s.respondError(w, http.StatusInternalServerError, "Failed to get job")
+		log.Error().Err(err).Msg("Failed to get modem")
+		s.respondError(w, http.StatusInternalServerError, "Failed to get modem")
 		return
 	}
+	s.markStale(modem)
 
-	s.respondJSON(w, http.StatusOK, job)
+	s.respondJSON(w, http.StatusOK, modem)
 }
 
-func (s *Server) handleRetryJob(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id, _ := strconv.Atoi(vars["id"])
-
-	job, err := s.db.GetJob(id)
+// refreshModem responds with the modem's live SNMP readings, or with its
+// cached row marked stale if the modem can't be queried
+func (s *Server) refreshModem(w http.ResponseWriter, id int) {
+	modem, err := s.engine.RefreshModem(id)
+	stale := err != nil
+	if err != nil && err != models.ErrNotFound {
+		log.Warn().Err(err).Int("modem_id", id).Msg("Live modem refresh failed, returning cached data")
+		modem, err = s.db.GetModem(id)
+	}
 	if err == models.ErrNotFound {
-		s.respondError(w, http.StatusNotFound, "Job not found")
+		s.respondError(w, http.StatusNotFound, "Modem not found")
 		return
 	}
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to get job")
-		s.respondError(w, http.StatusInternalServerError, "Failed to get job")
+		log.Error().Err(err).Msg("Failed to get modem")
+		s.respondError(w, http.StatusInternalServerError, "Failed to get modem")
 		return
 	}
 
-	// Reset job status
-	job.Status = models.JobStatusPending
-	job.RetryCount = 0
-	job.ErrorMessage = nil
-	job.StartedAt = nil
-	job.CompletedAt = nil
+	// Embed the modem's JSON form, not the modem, so its MarshalJSON isn't
+	// promoted over the stale field
+	s.markStale(modem)
+	s.respondJSON(w, http.StatusOK, struct {
+		models.ModemJSON
+		Stale bool `json:"stale"`
+	}{modem.JSON(time.Now()), stale})
+}
 
-	if err := s.db.UpdateJob(job); err != nil {
-		log.Error().Err(err).Msg("Failed to retry job")
-		s.respondError(w, http.StatusInternalServerError, "Failed to retry job")
+// handleSearchModem finds a modem on any CMTS by MAC, in whatever notation
+// the caller has, and returns it with its upgrade history
+func (s *Server) handleSearchModem(w http.ResponseWriter, r *http.Request) {
+	raw := r.URL.Query().Get("mac")
+	if raw == "" {
+		s.respondError(w, http.StatusBadRequest, "mac query parameter is required")
 		return
 	}
 
-	s.respondJSON(w, http.StatusOK, map[string]bool{"success": true})
-}
+	mac, err := engine.NormalizeMAC(raw)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, fmt.Sprintf("Unrecognized MAC address %q; use e.g. 00:01:5C:11:22:33, 00-01-5C-11-22-33, 0001.5C11.2233 or 00015C112233", raw))
+		return
+	}
 
-func (s *Server) handleEvaluateRules(w http.ResponseWriter, r *http.Request) {
-	log.Info().Msg("Manual trigger: rule evaluation")
+	modem, err := s.db.GetModemByMAC(mac)
+	if err == models.ErrNotFound {
+		s.respondError(w, http.StatusNotFound, fmt.Sprintf("No modem with MAC %s has been discovered on any CMTS", mac))
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Str("mac", mac).Msg("Failed to search modem")
+		s.respondError(w, http.StatusInternalServerError, "Failed to search modem")
+		return
+	}
 
-	go func() {
-		if err := s.engine.EvaluateRules(); err != nil {
-			log.Error().Err(err).Msg("Rule evaluation failed")
-		}
-	}()
+	jobs, err := s.db.ListJobsByMAC(mac)
+	if err != nil {
+		log.Error().Err(err).Str("mac", mac).Msg("Failed to list modem jobs")
+		s.respondError(w, http.StatusInternalServerError, "Failed to list modem jobs")
+		return
+	}
+	if jobs == nil {
+		jobs = []*models.UpgradeJob{}
+	}
+	s.markStale(modem)
 
-	s.respondJSON(w, http.StatusAccepted, map[string]string{
-		"message": "Rule evaluation started",
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"modem": modem,
+		"jobs":  jobs,
 	})
 }
 
-// Activity Log Handlers
-
-func (s *Server) handleListActivityLogs(w http.ResponseWriter, r *http.Request) {
-	limit := 50
+// handleFirmwareDriftReport lists modems no longer running the firmware they
+// were upgraded to, such as after a factory reset
+func (s *Server) handleFirmwareDriftReport(w http.ResponseWriter, r *http.Request) {
+	limit := 100
 	if l := r.URL.Query().Get("limit"); l != "" {
 		limit, _ = strconv.Atoi(l)
 	}
-
-	offset := 0
-	if o := r.URL.Query().Get("offset"); o != "" {
-		offset, _ = strconv.Atoi(o)
+	if maxItems := s.maxListItems(); limit <= 0 || limit > maxItems {
+		limit = maxItems
 	}
 
-	logs, err := s.db.ListActivityLogs(limit, offset)
+	modems, err := s.db.ListFirmwareDrift(limit + 1)
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to list activity logs")
-		s.respondError(w, http.StatusInternalServerError, "Failed to list activity logs")
+		log.Error().Err(err).Msg("Failed to build firmware drift report")
+		s.respondError(w, http.StatusInternalServerError, "Failed to build firmware drift report")
 		return
 	}
 
-	if logs == nil {
-		logs = []*models.ActivityLog{}
+	if len(modems) > limit {
+		modems = modems[:limit]
+		s.markTruncated(w, limit)
+	}
+
+	if modems == nil {
+		modems = []*models.CableModem{}
+	}
+	s.markStale(modems...)
+
+	s.respondJSON(w, http.StatusOK, modems)
+}
+
+// handleFirmwareDistributionReport counts modems per firmware version, with
+// modems of unknown firmware reported separately
+func (s *Server) handleFirmwareDistributionReport(w http.ResponseWriter, r *http.Request) {
+	cmtsID := 0
+	if c := r.URL.Query().Get("cmts_id"); c != "" {
+		id, err := strconv.Atoi(c)
+		if err != nil || id <= 0 {
+			s.respondError(w, http.StatusBadRequest, "Invalid cmts_id")
+			return
+		}
+		cmtsID = id
+	}
+
+	counts, err := s.db.FirmwareDistribution(cmtsID)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to build firmware distribution report")
+		s.respondError(w, http.StatusInternalServerError, "Failed to build firmware distribution report")
+		return
+	}
+
+	unknown := counts[""]
+	delete(counts, "")
+
+	total := unknown
+	for _, count := range counts {
+		total += count
+	}
+
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"versions": counts,
+		"unknown":  unknown,
+		"total":    total,
+	})
+}
+
+// handleVendorDistributionReport counts modems per vendor, optionally for one
+// CMTS, with modems whose OUI isn't in the vendor table reported as unknown
+func (s *Server) handleVendorDistributionReport(w http.ResponseWriter, r *http.Request) {
+	cmtsID := 0
+	if c := r.URL.Query().Get("cmts_id"); c != "" {
+		id, err := strconv.Atoi(c)
+		if err != nil || id <= 0 {
+			s.respondError(w, http.StatusBadRequest, "Invalid cmts_id")
+			return
+		}
+		cmtsID = id
+	}
+
+	counts, err := s.db.VendorDistribution(cmtsID)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to build vendor distribution report")
+		s.respondError(w, http.StatusInternalServerError, "Failed to build vendor distribution report")
+		return
+	}
+
+	unknown := counts[""]
+	delete(counts, "")
+
+	total := unknown
+	for _, count := range counts {
+		total += count
+	}
+
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"vendors": counts,
+		"unknown": unknown,
+		"total":   total,
+	})
+}
+
+// handleUpgradeModem queues an ad-hoc upgrade for one modem without a rule
+func (s *Server) handleUpgradeModem(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	var req struct {
+		TFTPServerIP     string `json:"tftp_server_ip"`
+		FirmwareFilename string `json:"firmware_filename"`
+		// Operator identifies who asked, for the activity log
+		Operator string `json:"operator"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	job, err := s.engine.QueueManualUpgrade(id, req.TFTPServerIP, req.FirmwareFilename)
+	if err != nil {
+		switch err {
+		case models.ErrNotFound:
+			s.respondError(w, http.StatusNotFound, "Modem not found")
+		case models.ErrInvalidTFTPServer, models.ErrInvalidFirmware, models.ErrModemOffline:
+			s.respondError(w, http.StatusBadRequest, err.Error())
+		case models.ErrUpgradeActive:
+			s.respondError(w, http.StatusConflict, err.Error())
+		default:
+			log.Error().Err(err).Int("modem_id", id).Msg("Failed to queue manual upgrade")
+			s.respondError(w, http.StatusInternalServerError, "Failed to queue upgrade")
+		}
+		return
+	}
+
+	operator := req.Operator
+	if operator == "" {
+		operator = "unknown"
+	}
+	details, _ := json.Marshal(map[string]string{
+		"operator":   operator,
+		"client_ip":  clientIP(r),
+		"firmware":   job.FirmwareFilename,
+		"request_id": requestID(r),
+	})
+	s.db.LogActivity(&models.ActivityLog{
+		EventType:  models.EventUpgradeManual,
+		EntityType: "job",
+		EntityID:   job.ID,
+		Message:    fmt.Sprintf("Manual upgrade of modem %s to %s requested by %s", job.MACAddress, job.FirmwareFilename, operator),
+		Details:    string(details),
+	})
+
+	log.Info().
+		Str("request_id", requestID(r)).
+		Int("job_id", job.ID).
+		Str("trace_id", job.TraceID).
+		Msg("Manual upgrade queued")
+
+	s.respondJSON(w, http.StatusCreated, map[string]interface{}{
+		"success":  true,
+		"job_id":   job.ID,
+		"trace_id": job.TraceID,
+	})
+}
+
+// handleSetModemTags replaces a modem's tags
+func (s *Server) handleSetModemTags(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	var req struct {
+		Tags []string `json:"tags"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	err := s.db.SetModemTags(id, req.Tags)
+	if err == models.ErrNotFound {
+		s.respondError(w, http.StatusNotFound, "Modem not found")
+		return
+	}
+	if err == models.ErrInvalidTag {
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Int("modem_id", id).Msg("Failed to set modem tags")
+		s.respondError(w, http.StatusInternalServerError, "Failed to set modem tags")
+		return
+	}
+
+	modem, err := s.db.GetModem(id)
+	if err != nil {
+		log.Error().Err(err).Int("modem_id", id).Msg("Failed to get modem")
+		s.respondError(w, http.StatusInternalServerError, "Failed to get modem")
+		return
+	}
+
+	s.db.LogActivity(&models.ActivityLog{
+		EventType:  models.EventModemTagsUpdated,
+		EntityType: "modem",
+		EntityID:   id,
+		Message:    fmt.Sprintf("Set tags of modem %s to [%s]", modem.MACAddress, strings.Join(modem.Tags, ", ")),
+	})
+	s.markStale(modem)
+
+	s.respondJSON(w, http.StatusOK, modem)
+}
+
+// handleModemMatchingRules lists every enabled rule matching a modem and
+// marks the one evaluation would apply, to explain which rule wins
+func (s *Server) handleModemMatchingRules(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	matches, err := s.engine.MatchingRules(id)
+	if err == models.ErrNotFound {
+		s.respondError(w, http.StatusNotFound, "Modem not found")
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Int("modem_id", id).Msg("Failed to match rules")
+		s.respondError(w, http.StatusInternalServerError, "Failed to match rules")
+		return
+	}
+
+	s.respondJSON(w, http.StatusOK, matches)
+}
+
+// handleModemSignalHistory returns a modem's signal readings, oldest first,
+// optionally only those recorded since an RFC3339 timestamp
+func (s *Server) handleModemSignalHistory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	since, _, err := parseTimeRange(r.URL.Query())
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if _, err := s.db.GetModem(id); err != nil {
+		if err == models.ErrNotFound {
+			s.respondError(w, http.StatusNotFound, "Modem not found")
+			return
+		}
+		log.Error().Err(err).Msg("Failed to get modem")
+		s.respondError(w, http.StatusInternalServerError, "Failed to get modem")
+		return
+	}
+
+	readings, err := s.db.GetSignalHistory(id, since)
+	if err != nil {
+		log.Error().Err(err).Int("modem_id", id).Msg("Failed to get signal history")
+		s.respondError(w, http.StatusInternalServerError, "Failed to get signal history")
+		return
+	}
+
+	s.respondJSON(w, http.StatusOK, readings)
+}
+
+// handleRebootModem resets one modem over SNMP. The body is optional.
+func (s *Server) handleRebootModem(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	var req struct {
+		// Operator identifies who asked, for the activity log
+		Operator string `json:"operator"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		s.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	modem, err := s.engine.RebootModem(id)
+	if err != nil {
+		switch err {
+		case models.ErrNotFound:
+			s.respondError(w, http.StatusNotFound, "Modem not found")
+		case models.ErrModemNoIP, models.ErrNoModemCommunity:
+			s.respondError(w, http.StatusBadRequest, err.Error())
+		case models.ErrUpgradeActive:
+			s.respondError(w, http.StatusConflict, err.Error())
+		default:
+			log.Error().Err(err).Int("modem_id", id).Msg("Failed to reboot modem")
+			s.respondError(w, http.StatusInternalServerError, "Failed to reboot modem")
+		}
+		return
+	}
+
+	operator := req.Operator
+	if operator == "" {
+		operator = "unknown"
+	}
+	details, _ := json.Marshal(map[string]string{
+		"operator":  operator,
+		"client_ip": clientIP(r),
+	})
+	s.db.LogActivity(&models.ActivityLog{
+		EventType:  models.EventModemReboot,
+		EntityType: "modem",
+		EntityID:   modem.ID,
+		Message:    fmt.Sprintf("Reboot of modem %s requested by %s", modem.MACAddress, operator),
+		Details:    string(details),
+	})
+
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+	})
+}
+
+// Rule Handlers
+
+func (s *Server) handleListRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := s.db.ListRules()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list rules")
+		s.respondError(w, http.StatusInternalServerError, "Failed to list rules")
+		return
+	}
+
+	if rules == nil {
+		rules = []*models.UpgradeRule{}
+	}
+
+	s.respondJSON(w, http.StatusOK, rules)
+}
+
+func (s *Server) handleCreateRule(w http.ResponseWriter, r *http.Request) {
+	rule := models.UpgradeRule{MaxRetries: s.defaultMaxRetries()}
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		s.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	id, err := s.db.CreateRule(&rule)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to create rule")
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Log activity
+	s.db.LogActivity(&models.ActivityLog{
+		EventType:  models.EventRuleCreated,
+		EntityType: "rule",
+		EntityID:   id,
+		Message:    fmt.Sprintf("Created rule: %s", rule.Name),
+	})
+
+	s.respondJSON(w, http.StatusCreated, map[string]interface{}{
+		"success": true,
+		"id":      id,
+	})
+}
+
+// handleCloneRule copies a rule under a new name. The copy starts disabled so
+// it can be edited before it creates any jobs.
+func (s *Server) handleCloneRule(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	source, err := s.db.GetRule(id)
+	if err == models.ErrNotFound {
+		s.respondError(w, http.StatusNotFound, "Rule not found")
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get rule")
+		s.respondError(w, http.StatusInternalServerError, "Failed to get rule")
+		return
+	}
+
+	clone := *source
+	clone.ID = 0
+	clone.Name = source.Name + " (copy)"
+	clone.Enabled = false
+
+	cloneID, err := s.db.CreateRule(&clone)
+	if err != nil {
+		log.Error().Err(err).Int("rule_id", id).Msg("Failed to clone rule")
+		s.respondError(w, http.StatusInternalServerError, "Failed to clone rule")
+		return
+	}
+
+	s.db.LogActivity(&models.ActivityLog{
+		EventType:  models.EventRuleCreated,
+		EntityType: "rule",
+		EntityID:   cloneID,
+		Message:    fmt.Sprintf("Created rule %s as a copy of %s", clone.Name, source.Name),
+	})
+
+	s.respondJSON(w, http.StatusCreated, map[string]interface{}{
+		"success": true,
+		"id":      cloneID,
+	})
+}
+
+func (s *Server) handleExportRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := s.db.ListRules()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list rules")
+		s.respondError(w, http.StatusInternalServerError, "Failed to list rules")
+		return
+	}
+
+	specs := make([]models.RuleSpec, 0, len(rules))
+	for _, rule := range rules {
+		specs = append(specs, rule.Spec())
+	}
+
+	s.respondJSON(w, http.StatusOK, specs)
+}
+
+func (s *Server) handleImportRules(w http.ResponseWriter, r *http.Request) {
+	var specs []models.RuleSpec
+	if err := json.NewDecoder(r.Body).Decode(&specs); err != nil {
+		s.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	rules := make([]*models.UpgradeRule, len(specs))
+	for i, spec := range specs {
+		rules[i] = spec.Rule()
+		if spec.MaxRetries == nil {
+			rules[i].MaxRetries = s.defaultMaxRetries()
+		}
+	}
+
+	created, updated, err := s.db.ImportRules(rules)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to import rules")
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Log activity
+	s.db.LogActivity(&models.ActivityLog{
+		EventType:  models.EventRulesImported,
+		EntityType: "rule",
+		Message:    fmt.Sprintf("Imported rules: %d created, %d updated", created, updated),
+	})
+
+	s.respondJSON(w, http.StatusOK, map[string]int{
+		"created": created,
+		"updated": updated,
+	})
+}
+
+func (s *Server) handleGetRule(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	rule, err := s.db.GetRule(id)
+	if err == models.ErrNotFound {
+		s.respondError(w, http.StatusNotFound, "Rule not found")
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get rule")
+		s.respondError(w, http.StatusInternalServerError, "Failed to get rule")
+		return
+	}
+
+	s.respondJSON(w, http.StatusOK, rule)
+}
+
+// handleGetRuleStats reports a rule's job counts and average upgrade time,
+// so operators can estimate how long a rollout will take
+func (s *Server) handleGetRuleStats(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	if _, err := s.db.GetRule(id); err != nil {
+		if err == models.ErrNotFound {
+			s.respondError(w, http.StatusNotFound, "Rule not found")
+			return
+		}
+		log.Error().Err(err).Msg("Failed to get rule")
+		s.respondError(w, http.StatusInternalServerError, "Failed to get rule")
+		return
+	}
+
+	avg, err := s.db.AverageUpgradeDuration(id)
+	if err != nil {
+		log.Error().Err(err).Int("rule_id", id).Msg("Failed to average upgrade duration")
+		s.respondError(w, http.StatusInternalServerError, "Failed to get rule stats")
+		return
+	}
+
+	jobs, err := s.db.CountRuleJobsByStatus(id)
+	if err != nil {
+		log.Error().Err(err).Int("rule_id", id).Msg("Failed to count rule jobs")
+		s.respondError(w, http.StatusInternalServerError, "Failed to get rule stats")
+		return
+	}
+
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"rule_id":                  id,
+		"average_duration_seconds": avg,
+		"jobs":                     jobs,
+	})
+}
+
+func (s *Server) handleUpdateRule(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	// Keep the rule's retry limit if the client doesn't send one
+	var rule models.UpgradeRule
+	wasEnabled := false
+	if existing, err := s.db.GetRule(id); err == nil {
+		rule.MaxRetries = existing.MaxRetries
+		wasEnabled = existing.Enabled
+	}
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		s.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	rule.ID = id
+
+	if err := s.db.UpdateRule(&rule); err != nil {
+		log.Error().Err(err).Msg("Failed to update rule")
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Log activity
+	s.db.LogActivity(&models.ActivityLog{
+		EventType:  models.EventRuleUpdated,
+		EntityType: "rule",
+		EntityID:   id,
+		Message:    fmt.Sprintf("Updated rule: %s", rule.Name),
+	})
+
+	resp := map[string]interface{}{"success": true}
+
+	// Disabling a rule only stops new jobs unless the caller also asks for
+	// the ones it already queued to be dropped
+	if wasEnabled && !rule.Enabled && r.URL.Query().Get("cancel_pending") == "true" {
+		skipped, err := s.db.SkipPendingJobsByRule(id)
+		if err != nil {
+			log.Error().Err(err).Int("rule_id", id).Msg("Failed to skip pending rule jobs")
+			s.respondError(w, http.StatusInternalServerError, "Rule updated but failed to cancel pending jobs")
+			return
+		}
+		if skipped > 0 {
+			s.db.LogActivity(&models.ActivityLog{
+				EventType:  models.EventUpgradeCancelled,
+				EntityType: "rule",
+				EntityID:   id,
+				Message:    fmt.Sprintf("Cancelled %d pending jobs of disabled rule: %s", skipped, rule.Name),
+			})
+		}
+		log.Info().
+			Int("rule_id", id).
+			Int("jobs_skipped", skipped).
+			Msg("Skipped pending jobs of disabled rule")
+		resp["jobs_skipped"] = skipped
+	}
+
+	s.respondJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleDeleteRule(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	if err := s.db.DeleteRule(id); err != nil {
+		if err == models.ErrNotFound {
+			s.respondError(w, http.StatusNotFound, "Rule not found")
+			return
+		}
+		log.Error().Err(err).Msg("Failed to delete rule")
+		s.respondError(w, http.StatusInternalServerError, "Failed to delete rule")
+		return
+	}
+
+	// Log activity
+	s.db.LogActivity(&models.ActivityLog{
+		EventType:  models.EventRuleDeleted,
+		EntityType: "rule",
+		EntityID:   id,
+		Message:    fmt.Sprintf("Deleted rule ID: %d", id),
+	})
+
+	s.respondJSON(w, http.StatusOK, map[string]bool{"success": true})
+}
+
+// Job Handlers
+
+func (s *Server) handleListJobs(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	limit := 100
+	if l := r.URL.Query().Get("limit"); l != "" {
+		limit, _ = strconv.Atoi(l)
+	}
+	if maxItems := s.maxListItems(); limit <= 0 || limit > maxItems {
+		limit = maxItems
+	}
+
+	jobs, err := s.db.ListJobs(status, limit+1)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list jobs")
+		s.respondError(w, http.StatusInternalServerError, "Failed to list jobs")
+		return
+	}
+
+	if len(jobs) > limit {
+		jobs = jobs[:limit]
+		s.markTruncated(w, limit)
+	}
+
+	if jobs == nil {
+		jobs = []*models.UpgradeJob{}
+	}
+
+	s.respondJSON(w, http.StatusOK, jobs)
+}
+
+// handleListDeadLetterJobs lists failed jobs that exhausted their retries
+func (s *Server) handleListDeadLetterJobs(w http.ResponseWriter, r *http.Request) {
+	limit := 100
+	if l := r.URL.Query().Get("limit"); l != "" {
+		limit, _ = strconv.Atoi(l)
+	}
+	if maxItems := s.maxListItems(); limit <= 0 || limit > maxItems {
+		limit = maxItems
+	}
+
+	jobs, err := s.db.ListDeadLetterJobs(limit + 1)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list dead-letter jobs")
+		s.respondError(w, http.StatusInternalServerError, "Failed to list dead-letter jobs")
+		return
+	}
+
+	if len(jobs) > limit {
+		jobs = jobs[:limit]
+		s.markTruncated(w, limit)
+	}
+
+	if jobs == nil {
+		jobs = []*models.UpgradeJob{}
+	}
+
+	s.respondJSON(w, http.StatusOK, jobs)
+}
+
+// handleRequeueDeadLetterJobs sends dead-letter jobs back to PENDING. The
+// body may name job_ids; an empty body requeues the whole queue.
+func (s *Server) handleRequeueDeadLetterJobs(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		JobIDs []int `json:"job_ids"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.respondError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+
+	requeued, err := s.db.RequeueDeadLetterJobs(req.JobIDs)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to requeue dead-letter jobs")
+		s.respondError(w, http.StatusInternalServerError, "Failed to requeue dead-letter jobs")
+		return
+	}
+
+	s.db.LogActivity(&models.ActivityLog{
+		EventType:  models.EventSystemEvent,
+		EntityType: "job",
+		Message:    fmt.Sprintf("Requeued %d dead-letter jobs", requeued),
+	})
+
+	s.respondJSON(w, http.StatusOK, map[string]int{"requeued": requeued})
+}
+
+// handleRetryFailedJobs re-queues every FAILED job, optionally only those on
+// one CMTS or from one rule
+func (s *Server) handleRetryFailedJobs(w http.ResponseWriter, r *http.Request) {
+	var filter database.JobFilter
+	query := r.URL.Query()
+	if v := query.Get("cmts_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || id <= 0 {
+			s.respondError(w, http.StatusBadRequest, "Invalid cmts_id")
+			return
+		}
+		filter.CMTSID = id
+	}
+	if v := query.Get("rule_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || id <= 0 {
+			s.respondError(w, http.StatusBadRequest, "Invalid rule_id")
+			return
+		}
+		filter.RuleID = id
+	}
+
+	retried, err := s.db.RetryFailedJobs(filter)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to retry failed jobs")
+		s.respondError(w, http.StatusInternalServerError, "Failed to retry failed jobs")
+		return
+	}
+
+	s.db.LogActivity(&models.ActivityLog{
+		EventType:  models.EventSystemEvent,
+		EntityType: "job",
+		Message:    fmt.Sprintf("Re-queued %d failed jobs", retried),
+	})
+
+	s.respondJSON(w, http.StatusOK, map[string]int{"retried": retried})
+}
+
+// sseHeartbeatInterval keeps idle event streams alive through proxies
+const sseHeartbeatInterval = 30 * time.Second
+
+// handleJobStream pushes job status changes to the client as Server-Sent Events
+func (s *Server) handleJobStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		s.respondError(w, http.StatusInternalServerError, "Streaming not supported")
+		return
+	}
+
+	// The stream outlives the server's write timeout
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	events, unsubscribe := s.engine.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+			flusher.Flush()
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				log.Error().Err(err).Msg("Failed to encode job event")
+				continue
+			}
+			fmt.Fprintf(w, "event: job\ndata: %s\n\n", data)
+			flusher.Flush()
+		}
+	}
+}
+
+func (s *Server) handleGetJob(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	job, err := s.db.GetJob(id)
+	if err == models.ErrNotFound {
+		s.respondError(w, http.StatusNotFound, "Job not found")
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get job")
+		s.respondError(w, http.StatusInternalServerError, "Failed to get job")
+		return
+	}
+
+	s.respondJSON(w, http.StatusOK, job)
+}
+
+// handleGetJobLogs returns the activity logged for one job, oldest first,
+// so its start, retries and outcome can be read as a timeline
+func (s *Server) handleGetJobLogs(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	if _, err := s.db.GetJob(id); err != nil {
+		if err == models.ErrNotFound {
+			s.respondError(w, http.StatusNotFound, "Job not found")
+			return
+		}
+		log.Error().Err(err).Msg("Failed to get job")
+		s.respondError(w, http.StatusInternalServerError, "Failed to get job")
+		return
+	}
+
+	logs, err := s.db.ListActivityLogsByEntity("job", id)
+	if err != nil {
+		log.Error().Err(err).Int("job_id", id).Msg("Failed to list job logs")
+		s.respondError(w, http.StatusInternalServerError, "Failed to list job logs")
+		return
+	}
+
+	s.respondJSON(w, http.StatusOK, logs)
+}
+
+func (s *Server) handleRetryJob(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	job, err := s.db.GetJob(id)
+	if err == models.ErrNotFound {
+		s.respondError(w, http.StatusNotFound, "Job not found")
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get job")
+		s.respondError(w, http.StatusInternalServerError, "Failed to get job")
+		return
+	}
+	if job.ModemID == 0 {
+		s.respondError(w, http.StatusConflict, "The job's modem has been deleted")
+		return
+	}
+
+	// Reset job status. The job keeps its own MaxRetries, so it gets the
+	// same number of attempts its rule gave it originally.
+	job.Status = models.JobStatusPending
+	job.RetryCount = 0
+	job.ErrorMessage = nil
+	job.StartedAt = nil
+	job.CompletedAt = nil
+	job.NextRetryAt = nil
+	job.DeadLetter = false
+
+	if err := s.db.UpdateJob(job); err != nil {
+		log.Error().Err(err).Msg("Failed to retry job")
+		s.respondError(w, http.StatusInternalServerError, "Failed to retry job")
+		return
+	}
+
+	s.respondJSON(w, http.StatusOK, map[string]bool{"success": true})
+}
+
+func (s *Server) handleCancelJob(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	if err := s.engine.CancelJob(id); err != nil {
+		if err == models.ErrNotFound {
+			s.respondError(w, http.StatusNotFound, "Job not found")
+			return
+		}
+		if err == models.ErrInvalidJobState {
+			s.respondError(w, http.StatusConflict, "Only pending or in-progress jobs can be cancelled")
+			return
+		}
+		log.Error().Err(err).Int("job_id", id).Msg("Failed to cancel job")
+		s.respondError(w, http.StatusInternalServerError, "Failed to cancel job")
+		return
+	}
+
+	s.respondJSON(w, http.StatusOK, map[string]bool{"success": true})
+}
+
+// evaluationWaitTimeout bounds a synchronous ?wait=true evaluation. It stays
+// under the HTTP server's WriteTimeout so the response can still be sent.
+const evaluationWaitTimeout = 10 * time.Second
+
+func (s *Server) handleEvaluateRules(w http.ResponseWriter, r *http.Request) {
+	if s.engine.Paused() {
+		s.respondError(w, http.StatusConflict, "Engine is paused")
+		return
+	}
+
+	if wait, _ := strconv.ParseBool(r.URL.Query().Get("wait")); wait {
+		s.evaluateRulesAndReport(w)
+		return
+	}
+
+	log.Info().Msg("Manual trigger: rule evaluation")
+
+	go func() {
+		if err := s.engine.EvaluateRules(); err != nil {
+			log.Error().Err(err).Msg("Rule evaluation failed")
+		}
+	}()
+
+	s.respondJSON(w, http.StatusAccepted, map[string]string{
+		"message": "Rule evaluation started",
+	})
+}
+
+// evaluateRulesAndReport runs an evaluation pass and responds with its
+// summary. If the pass outlives evaluationWaitTimeout it keeps running in the
+// background and the client gets 504.
+func (s *Server) evaluateRulesAndReport(w http.ResponseWriter) {
+	log.Info().Msg("Manual trigger: synchronous rule evaluation")
+
+	type result struct {
+		summary *engine.EvaluationSummary
+		err     error
+	}
+	done := make(chan result, 1)
+	go func() {
+		summary, err := s.engine.EvaluateRulesReport()
+		done <- result{summary, err}
+	}()
+
+	select {
+	case res := <-done:
+		if res.err != nil {
+			log.Error().Err(res.err).Msg("Rule evaluation failed")
+			s.respondError(w, http.StatusInternalServerError, "Rule evaluation failed")
+			return
+		}
+		s.respondJSON(w, http.StatusOK, res.summary)
+	case <-time.After(evaluationWaitTimeout):
+		s.respondError(w, http.StatusGatewayTimeout, "Rule evaluation is still running")
+	}
+}
+
+func (s *Server) handleEvaluateRule(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	rule, err := s.db.GetRule(id)
+	if err == models.ErrNotFound {
+		s.respondError(w, http.StatusNotFound, "Rule not found")
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get rule")
+		s.respondError(w, http.StatusInternalServerError, "Failed to get rule")
+		return
+	}
+	if !rule.Enabled {
+		s.respondError(w, http.StatusConflict, "Rule is disabled")
+		return
+	}
+	if s.engine.Paused() {
+		s.respondError(w, http.StatusConflict, "Engine is paused")
+		return
+	}
+
+	log.Info().Int("rule_id", id).Msg("Manual trigger: single rule evaluation")
+
+	go func() {
+		if _, err := s.engine.EvaluateRule(id); err != nil {
+			log.Error().Err(err).Int("rule_id", id).Msg("Rule evaluation failed")
+		}
+	}()
+
+	s.respondJSON(w, http.StatusAccepted, map[string]string{
+		"message": "Rule evaluation started",
+	})
+}
+
+// Campaign Handlers
+
+func (s *Server) handleListCampaigns(w http.ResponseWriter, r *http.Request) {
+	campaigns, err := s.db.ListCampaigns()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list campaigns")
+		s.respondError(w, http.StatusInternalServerError, "Failed to list campaigns")
+		return
+	}
+
+	if campaigns == nil {
+		campaigns = []*models.Campaign{}
+	}
+
+	s.respondJSON(w, http.StatusOK, campaigns)
+}
+
+// handleCreateCampaign schedules a paced one-shot rollout. start_at defaults
+// to now.
+func (s *Server) handleCreateCampaign(w http.ResponseWriter, r *http.Request) {
+	var campaign models.Campaign
+	if err := json.NewDecoder(r.Body).Decode(&campaign); err != nil {
+		s.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if campaign.StartAt.IsZero() {
+		campaign.StartAt = time.Now()
+	}
+
+	id, err := s.db.CreateCampaign(&campaign)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to create campaign")
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.db.LogActivity(&models.ActivityLog{
+		EventType:  models.EventCampaignCreated,
+		EntityType: "campaign",
+		EntityID:   id,
+		Message: fmt.Sprintf("Created campaign %s: %d jobs/minute from %s",
+			campaign.Name, campaign.RatePerMinute, campaign.StartAt.Format(time.RFC3339)),
+	})
+
+	s.respondJSON(w, http.StatusCreated, map[string]interface{}{
+		"success": true,
+		"id":      id,
+	})
+}
+
+// handleGetCampaign returns a campaign with its jobs counted by status
+func (s *Server) handleGetCampaign(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	campaign, err := s.db.GetCampaign(id)
+	if err == models.ErrNotFound {
+		s.respondError(w, http.StatusNotFound, "Campaign not found")
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get campaign")
+		s.respondError(w, http.StatusInternalServerError, "Failed to get campaign")
+		return
+	}
+
+	jobs, err := s.db.CountCampaignJobsByStatus(id)
+	if err != nil {
+		log.Error().Err(err).Int("campaign_id", id).Msg("Failed to count campaign jobs")
+		s.respondError(w, http.StatusInternalServerError, "Failed to get campaign progress")
+		return
+	}
+
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"campaign": campaign,
+		"jobs":     jobs,
+	})
+}
+
+// handleCancelCampaign stops a campaign and cancels its unstarted jobs
+func (s *Server) handleCancelCampaign(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	if err := s.engine.CancelCampaign(id); err != nil {
+		if err == models.ErrNotFound {
+			s.respondError(w, http.StatusNotFound, "Campaign not found")
+			return
+		}
+		if err == models.ErrCampaignFinished {
+			s.respondError(w, http.StatusConflict, "Only scheduled or running campaigns can be cancelled")
+			return
+		}
+		log.Error().Err(err).Int("campaign_id", id).Msg("Failed to cancel campaign")
+		s.respondError(w, http.StatusInternalServerError, "Failed to cancel campaign")
+		return
+	}
+
+	s.respondJSON(w, http.StatusOK, map[string]bool{"success": true})
+}
+
+// Activity Log Handlers
+
+func (s *Server) handleListActivityLogs(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	limit := 50
+	if l := query.Get("limit"); l != "" {
+		limit, _ = strconv.Atoi(l)
+	}
+
+	offset := 0
+	if o := query.Get("offset"); o != "" {
+		offset, _ = strconv.Atoi(o)
+	}
+
+	filter := database.ActivityLogFilter{EventType: query.Get("event_type")}
+	var err error
+	if filter.Since, filter.Until, err = parseTimeRange(query); err != nil {
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	logs, err := s.db.ListActivityLogs(filter, limit, offset)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list activity logs")
+		s.respondError(w, http.StatusInternalServerError, "Failed to list activity logs")
+		return
+	}
+
+	if logs == nil {
+		logs = []*models.ActivityLog{}
 	}
 
 	s.respondJSON(w, http.StatusOK, logs)
 }
 
+// handleExportActivityLogs streams filtered activity logs as CSV for archival
+func (s *Server) handleExportActivityLogs(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	if format := query.Get("format"); format != "" && format != "csv" {
+		s.respondError(w, http.StatusBadRequest, "Unsupported export format: "+format)
+		return
+	}
+
+	filter := database.ActivityLogFilter{EventType: query.Get("event_type")}
+	var err error
+	if filter.Since, filter.Until, err = parseTimeRange(query); err != nil {
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// A large export can take longer than the server's write timeout
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", `attachment; filename="activity-log.csv"`)
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "created_at", "event_type", "entity_type", "entity_id", "message", "details"})
+
+	rows := 0
+	err = s.db.StreamActivityLogs(filter, func(entry *models.ActivityLog) error {
+		rows++
+		return cw.Write([]string{
+			strconv.Itoa(entry.ID),
+			entry.CreatedAt.UTC().Format(time.RFC3339),
+			entry.EventType,
+			entry.EntityType,
+			strconv.Itoa(entry.EntityID),
+			entry.Message,
+			entry.Details,
+		})
+	})
+	cw.Flush()
+
+	if err != nil {
+		// Headers are already sent, so the best we can do is log and truncate
+		log.Error().Err(err).Int("rows", rows).Msg("Failed to export activity logs")
+	}
+}
+
+// parseTimeRange reads the optional RFC3339 since and until query parameters
+func parseTimeRange(query url.Values) (since, until time.Time, err error) {
+	if v := query.Get("since"); v != "" {
+		if since, err = time.Parse(time.RFC3339, v); err != nil {
+			return since, until, errors.New("invalid since timestamp, expected RFC3339")
+		}
+	}
+	if v := query.Get("until"); v != "" {
+		if until, err = time.Parse(time.RFC3339, v); err != nil {
+			return since, until, errors.New("invalid until timestamp, expected RFC3339")
+		}
+	}
+	return since, until, nil
+}
+
+// handleExportJobs streams every matching job as CSV for audits
+func (s *Server) handleExportJobs(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	filter := database.JobFilter{Status: query.Get("status")}
+	var err error
+	if filter.Since, filter.Until, err = parseTimeRange(query); err != nil {
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// A large export can take longer than the server's write timeout
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", `attachment; filename="jobs.csv"`)
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "mac", "cmts_id", "rule_id", "status", "firmware", "retry_count",
+		"created_at", "started_at", "completed_at", "error_message"})
+
+	rows := 0
+	err = s.db.StreamJobs(filter, func(job *models.UpgradeJob) error {
+		rows++
+		errorMessage := ""
+		if job.ErrorMessage != nil {
+			errorMessage = *job.ErrorMessage
+		}
+		return cw.Write([]string{
+			strconv.Itoa(job.ID),
+			job.MACAddress,
+			strconv.Itoa(job.CMTSID),
+			strconv.Itoa(job.RuleID),
+			job.Status,
+			job.FirmwareFilename,
+			strconv.Itoa(job.RetryCount),
+			job.CreatedAt.UTC().Format(time.RFC3339),
+			formatCSVTime(job.StartedAt),
+			formatCSVTime(job.CompletedAt),
+			errorMessage,
+		})
+	})
+	cw.Flush()
+
+	if err != nil {
+		// Headers are already sent, so the best we can do is log and truncate
+		log.Error().Err(err).Int("rows", rows).Msg("Failed to export jobs")
+	}
+}
+
+// formatCSVTime formats an optional timestamp for export, empty if unset
+func formatCSVTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
 // Settings Handlers
 
 func (s *Server) handleListSettings(w http.ResponseWriter, r *http.Request) {
@@ -906,10 +2932,34 @@ func (s *Server) handleListSettings(w http.ResponseWriter, r *http.Request) {
 		s.respondError(w, http.StatusInternalServerError, "Failed to list settings")
 		return
 	}
+	for key, value := range settings {
+		settings[key] = redactSetting(key, value)
+	}
 
 	s.respondJSON(w, http.StatusOK, settings)
 }
 
+// secretSettings are settings whose values are redacted from API responses
+// and activity logs
+var secretSettings = map[string]bool{
+	"api_token": true,
+}
+
+// redactSetting returns value, or redactedSecret if key is a secret that is
+// set
+func redactSetting(key, value string) string {
+	if secretSettings[key] && value != "" {
+		return redactedSecret
+	}
+	return value
+}
+
+// handleSettingsSchema describes every known setting so clients can render
+// a suitable input and validate before saving
+func (s *Server) handleSettingsSchema(w http.ResponseWriter, r *http.Request) {
+	s.respondJSON(w, http.StatusOK, models.SettingSchema())
+}
+
 func (s *Server) handleGetSetting(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	key := vars["key"]
@@ -922,7 +2972,7 @@ func (s *Server) handleGetSetting(w http.ResponseWriter, r *http.Request) {
 
 	s.respondJSON(w, http.StatusOK, map[string]string{
 		"key":   key,
-		"value": value,
+		"value": redactSetting(key, value),
 	})
 }
 
@@ -933,6 +2983,20 @@ func (s *Server) handleUpdateSettings(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Reject the whole update if any value is invalid. A secret echoed back
+	// redacted from a GET is left unchanged.
+	for key, value := range settings {
+		if secretSettings[key] && value == redactedSecret {
+			delete(settings, key)
+			continue
+		}
+		if err := models.ValidateSetting(key, value); err != nil {
+			s.respondError(w, http.StatusBadRequest, fmt.Sprintf("%s: %v", key, err))
+			return
+		}
+		warnUnknownSetting(key)
+	}
+
 	// Update each setting
 	for key, value := range settings {
 		if err := s.db.SetSetting(key, value); err != nil {
@@ -946,9 +3010,10 @@ func (s *Server) handleUpdateSettings(w http.ResponseWriter, r *http.Request) {
 			EventType:  models.EventSystemEvent,
 			EntityType: "setting",
 			EntityID:   0,
-			Message:    fmt.Sprintf("Updated setting: %s = %s", key, value),
+			Message:    fmt.Sprintf("Updated setting: %s = %s", key, redactSetting(key, value)),
 		})
 	}
+	s.loadRateLimit()
 
 	s.respondJSON(w, http.StatusOK, map[string]bool{"success": true})
 }
@@ -966,6 +3031,17 @@ func (s *Server) handleUpdateSetting(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if secretSettings[key] && req.Value == redactedSecret {
+		s.respondJSON(w, http.StatusOK, map[string]bool{"success": true})
+		return
+	}
+
+	if err := models.ValidateSetting(key, req.Value); err != nil {
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	warnUnknownSetting(key)
+
 	if err := s.db.SetSetting(key, req.Value); err != nil {
 		log.Error().Err(err).Msg("Failed to update setting")
 		s.respondError(w, http.StatusInternalServerError, "Failed to update setting")
@@ -977,8 +3053,219 @@ func (s *Server) handleUpdateSetting(w http.ResponseWriter, r *http.Request) {
 		EventType:  models.EventSystemEvent,
 		EntityType: "setting",
 		EntityID:   0,
-		Message:    fmt.Sprintf("Updated setting: %s = %s", key, req.Value),
+		Message:    fmt.Sprintf("Updated setting: %s = %s", key, redactSetting(key, req.Value)),
 	})
+	s.loadRateLimit()
 
 	s.respondJSON(w, http.StatusOK, map[string]bool{"success": true})
 }
+
+// warnUnknownSetting logs updates to keys the settings schema doesn't
+// describe. They are still stored so new settings need no schema entry,
+// but an unexpected key is often a typo.
+func warnUnknownSetting(key string) {
+	if _, ok := models.LookupSetting(key); !ok {
+		log.Warn().Str("key", key).Msg("Updating setting with no schema entry")
+	}
+}
+
+// Backup Handlers
+
+// backupExcludedSettings are never written to or restored from a backup.
+// Restoring api_token would silently change who can call the API, and the
+// evaluation allowlist's CMTS IDs go in the backup by name instead.
+var backupExcludedSettings = map[string]bool{
+	"api_token":                 true,
+	"evaluation_cmts_allowlist": true,
+}
+
+// handleBackup exports CMTS, rules and settings as one JSON document. Write
+// communities are redacted unless ?include_secrets=true.
+func (s *Server) handleBackup(w http.ResponseWriter, r *http.Request) {
+	cmtsList, err := s.db.ListCMTS()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list CMTS")
+		s.respondError(w, http.StatusInternalServerError, "Failed to create backup")
+		return
+	}
+
+	rules, err := s.db.ListRules()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list rules")
+		s.respondError(w, http.StatusInternalServerError, "Failed to create backup")
+		return
+	}
+
+	settings, err := s.db.ListSettings()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list settings")
+		s.respondError(w, http.StatusInternalServerError, "Failed to create backup")
+		return
+	}
+	allowlist := allowlistNames(settings["evaluation_cmts_allowlist"], cmtsList)
+	for key := range backupExcludedSettings {
+		delete(settings, key)
+	}
+
+	secrets := includeSecrets(r)
+	backup := models.Backup{
+		SchemaVersion:           models.BackupSchemaVersion,
+		CreatedAt:               time.Now().UTC(),
+		CMTS:                    make([]models.CMTSSpec, 0, len(cmtsList)),
+		Rules:                   make([]models.RuleSpec, 0, len(rules)),
+		Settings:                settings,
+		EvaluationCMTSAllowlist: allowlist,
+	}
+	for _, cmts := range cmtsList {
+		if !secrets {
+			redactSecrets(cmts)
+		}
+		backup.CMTS = append(backup.CMTS, cmts.Spec())
+	}
+	for _, rule := range rules {
+		backup.Rules = append(backup.Rules, rule.Spec())
+	}
+
+	w.Header().Set("Content-Disposition", `attachment; filename="firmware-upgrader-backup.json"`)
+	s.respondJSON(w, http.StatusOK, backup)
+}
+
+// allowlistNames turns the evaluation_cmts_allowlist setting's CMTS IDs into
+// names. IDs of CMTS that no longer exist are dropped.
+func allowlistNames(value string, cmtsList []*models.CMTS) []string {
+	byID := make(map[int]string, len(cmtsList))
+	for _, cmts := range cmtsList {
+		byID[cmts.ID] = cmts.Name
+	}
+
+	names := []string{}
+	for _, part := range strings.Split(value, ",") {
+		id, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		if name, ok := byID[id]; ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// handleRestore applies a backup from handleBackup in one transaction
+func (s *Server) handleRestore(w http.ResponseWriter, r *http.Request) {
+	var backup models.Backup
+	if err := json.NewDecoder(r.Body).Decode(&backup); err != nil {
+		s.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if backup.SchemaVersion < 1 || backup.SchemaVersion > models.BackupSchemaVersion {
+		s.respondError(w, http.StatusBadRequest, fmt.Sprintf("Unsupported backup schema_version %d (this server reads 1 to %d)",
+			backup.SchemaVersion, models.BackupSchemaVersion))
+		return
+	}
+
+	for key, value := range backup.Settings {
+		if backupExcludedSettings[key] {
+			delete(backup.Settings, key)
+			continue
+		}
+		if err := models.ValidateSetting(key, value); err != nil {
+			s.respondError(w, http.StatusBadRequest, fmt.Sprintf("%s: %v", key, err))
+			return
+		}
+		warnUnknownSetting(key)
+	}
+
+	defaultRetries := s.defaultMaxRetries()
+	for i := range backup.Rules {
+		if backup.Rules[i].MaxRetries == nil {
+			backup.Rules[i].MaxRetries = &defaultRetries
+		}
+	}
+
+	// A redacted write community keeps the stored one, or none for a new CMTS
+	if err := s.keepRedactedBackupSecrets(backup.CMTS); err != nil {
+		log.Error().Err(err).Msg("Failed to list CMTS")
+		s.respondError(w, http.StatusInternalServerError, "Failed to restore backup")
+		return
+	}
+
+	result, err := s.db.RestoreBackup(&backup)
+	if errors.Is(err, models.ErrDuplicate) {
+		s.respondError(w, http.StatusConflict, fmt.Sprintf("Backup reuses the IP address of another CMTS; nothing was restored: %v", err))
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to restore backup")
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.loadRateLimit()
+	// The engine only reads engine_paused at startup
+	if value, ok := backup.Settings["engine_paused"]; ok {
+		if paused, _ := strconv.ParseBool(value); paused != s.engine.Paused() {
+			if paused {
+				err = s.engine.Pause()
+			} else {
+				err = s.engine.Resume()
+			}
+			if err != nil {
+				log.Error().Err(err).Msg("Failed to apply restored engine_paused")
+			}
+		}
+	}
+
+	s.db.LogActivity(&models.ActivityLog{
+		EventType:  models.EventConfigRestored,
+		EntityType: "system",
+		Message: fmt.Sprintf("Restored configuration backup: %d CMTS created, %d updated; %d rules created, %d updated; %d settings",
+			result.CMTSCreated, result.CMTSUpdated, result.RulesCreated, result.RulesUpdated, result.Settings),
+	})
+
+	s.respondJSON(w, http.StatusOK, result)
+}
+
+// keepRedactedBackupSecrets swaps redacted communities in a backup for those
+// stored on the CMTS of the same name
+func (s *Server) keepRedactedBackupSecrets(specs []models.CMTSSpec) error {
+	redacted := false
+	for _, spec := range specs {
+		if spec.CommunityWrite == redactedSecret || spec.CMCommunityString == redactedSecret {
+			redacted = true
+			break
+		}
+	}
+	if !redacted {
+		return nil
+	}
+
+	existing, err := s.db.ListCMTS()
+	if err != nil {
+		return err
+	}
+	stored := make(map[string]*models.CMTS, len(existing))
+	for _, cmts := range existing {
+		if _, ok := stored[cmts.Name]; !ok {
+			stored[cmts.Name] = cmts
+		}
+	}
+
+	for i := range specs {
+		cmts, ok := stored[specs[i].Name]
+		if specs[i].CommunityWrite == redactedSecret {
+			specs[i].CommunityWrite = ""
+			if ok {
+				specs[i].CommunityWrite = cmts.CommunityWrite
+			}
+		}
+		if specs[i].CMCommunityString == redactedSecret {
+			specs[i].CMCommunityString = ""
+			if ok {
+				specs[i].CMCommunityString = cmts.CMCommunityString
+			}
+		}
+	}
+	return nil
+}
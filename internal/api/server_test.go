@@ -1,11 +1,18 @@
 package api
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"encoding/csv"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/awksedgreep/firmware-upgrader/internal/database"
 	"github.com/awksedgreep/firmware-upgrader/internal/engine"
@@ -43,6 +50,86 @@ func setupTestServer(t *testing.T) (*Server, *database.DB) {
 
 // CMTS Tests
 
+func TestRateLimitMiddleware(t *testing.T) {
+	server, db := setupTestServer(t)
+	defer db.Close()
+
+	// The limit is cached, and refreshed when it's updated through the API
+	if err := db.SetSetting("api_rate_limit", "1"); err != nil {
+		t.Fatalf("Failed to set rate limit: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest("GET", "/api/cmts", nil)
+		req.RemoteAddr = "192.0.2.9:40000"
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected the stale cached limit until settings change, got %d", w.Code)
+		}
+	}
+	req := httptest.NewRequest("PUT", "/api/settings/api_rate_limit", strings.NewReader(`{"value":"1"}`))
+	req.RemoteAddr = "127.0.0.1:40000"
+	rec := httptest.NewRecorder()
+	server.router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Failed to update rate limit: %d %s", rec.Code, rec.Body.String())
+	}
+
+	request := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/cmts", nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := request("192.0.2.10:40000"); w.Code != http.StatusOK {
+		t.Fatalf("Expected first request allowed, got %d", w.Code)
+	}
+	w := request("192.0.2.10:40001")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status 429, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("Expected a Retry-After header")
+	}
+
+	// Limits are per client, and localhost is exempt
+	if w := request("192.0.2.11:40000"); w.Code != http.StatusOK {
+		t.Errorf("Expected another client allowed, got %d", w.Code)
+	}
+	for i := 0; i < 5; i++ {
+		if w := request("127.0.0.1:40000"); w.Code != http.StatusOK {
+			t.Fatalf("Expected localhost never limited, got %d", w.Code)
+		}
+	}
+}
+
+func TestTakeTokenWait(t *testing.T) {
+	server, db := setupTestServer(t)
+	defer db.Close()
+
+	if err := db.SetSetting("api_rate_limit", "2"); err != nil {
+		t.Fatalf("Failed to set rate limit: %v", err)
+	}
+	server.loadRateLimit()
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := server.takeToken("192.0.2.10"); !ok {
+			t.Fatalf("Expected burst token %d to be allowed", i+1)
+		}
+	}
+	ok, wait := server.takeToken("192.0.2.10")
+	if ok || wait <= 0 || wait > 500*time.Millisecond {
+		t.Errorf("Expected an empty budget with up to 500ms wait, got %v %v", ok, wait)
+	}
+
+	// A denied request doesn't spend a token, so the wait doesn't grow
+	if _, again := server.takeToken("192.0.2.10"); again > wait+50*time.Millisecond {
+		t.Errorf("Expected the wait to stay near %v, got %v", wait, again)
+	}
+}
+
 func TestHandleListCMTS(t *testing.T) {
 	server, db := setupTestServer(t)
 	defer db.Close()
@@ -99,6 +186,99 @@ func TestHandleCreateCMTS(t *testing.T) {
 	if _, ok := response["id"]; !ok {
 		t.Error("Expected id in response")
 	}
+
+	// The same IP again conflicts
+	cmts.Name = "Same IP"
+	body, _ = json.Marshal(cmts)
+	req = httptest.NewRequest("POST", "/api/cmts", bytes.NewBuffer(body))
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 for a duplicate IP, got %d", w.Code)
+	}
+}
+
+func TestHandleCreateCMTSBatch(t *testing.T) {
+	server, db := setupTestServer(t)
+	defer db.Close()
+
+	list := []models.CMTS{
+		{Name: "Batch CMTS 1", IPAddress: "192.168.2.1", SNMPPort: 161, CommunityRead: "public", SNMPVersion: 2, Enabled: true},
+		{Name: "Batch CMTS 2", IPAddress: "", SNMPPort: 161, CommunityRead: "public", SNMPVersion: 2},
+	}
+
+	body, _ := json.Marshal(list)
+	req := httptest.NewRequest("POST", "/api/cmts/batch", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusMultiStatus {
+		t.Fatalf("Expected status 207, got %d", w.Code)
+	}
+
+	var response struct {
+		Created int `json:"created"`
+		Failed  int `json:"failed"`
+		Results []struct {
+			Index   int    `json:"index"`
+			Success bool   `json:"success"`
+			ID      int    `json:"id"`
+			Error   string `json:"error"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if response.Created != 1 || response.Failed != 1 {
+		t.Errorf("Expected 1 created and 1 failed, got %d and %d", response.Created, response.Failed)
+	}
+	if len(response.Results) != 2 {
+		t.Fatalf("Expected 2 results, got %d", len(response.Results))
+	}
+	if !response.Results[0].Success || response.Results[0].ID == 0 {
+		t.Errorf("Expected first entry to succeed, got %+v", response.Results[0])
+	}
+	if response.Results[1].Success || response.Results[1].Error == "" {
+		t.Errorf("Expected second entry to fail validation, got %+v", response.Results[1])
+	}
+
+	if _, err := db.GetCMTS(response.Results[0].ID); err != nil {
+		t.Errorf("Expected created CMTS to exist: %v", err)
+	}
+
+	// A CMTS IP already in use fails only its own entry
+	duplicate := []models.CMTS{list[0], list[0]}
+	duplicate[1].IPAddress = "192.168.2.3"
+	body, _ = json.Marshal(duplicate)
+	req = httptest.NewRequest("POST", "/api/cmts/batch", bytes.NewBuffer(body))
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusMultiStatus {
+		t.Fatalf("Expected status 207, got %d", w.Code)
+	}
+	response.Results = nil
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Created != 1 || response.Results[0].Success || !strings.Contains(response.Results[0].Error, "already exists") {
+		t.Errorf("Expected the duplicate reported and the rest created, got %+v", response)
+	}
+
+	// All-valid batches return 201
+	list[0].IPAddress = "192.168.2.2"
+	body, _ = json.Marshal(list[:1])
+	req = httptest.NewRequest("POST", "/api/cmts/batch", bytes.NewBuffer(body))
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Errorf("Expected status 201, got %d", w.Code)
+	}
 }
 
 func TestHandleCreateCMTSInvalidBody(t *testing.T) {
@@ -139,6 +319,69 @@ func TestHandleGetCMTS(t *testing.T) {
 	}
 }
 
+func TestHandleCMTSRedactsCommunities(t *testing.T) {
+	server, db := setupTestServer(t)
+	defer db.Close()
+
+	get := func(path string) models.CMTS {
+		t.Helper()
+		req := httptest.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s: expected status 200, got %d", path, w.Code)
+		}
+		var cmts models.CMTS
+		if err := json.NewDecoder(w.Body).Decode(&cmts); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return cmts
+	}
+
+	redacted := get("/api/cmts/1")
+	if redacted.CommunityWrite != redactedSecret || redacted.CMCommunityString != redactedSecret {
+		t.Errorf("Expected redacted communities, got %q / %q", redacted.CommunityWrite, redacted.CMCommunityString)
+	}
+	if got := get("/api/cmts/1?include_secrets=true"); got.CommunityWrite != "private" || got.CMCommunityString != "cable-modem" {
+		t.Errorf("Expected communities 'private' / 'cable-modem' when requested, got %q / %q", got.CommunityWrite, got.CMCommunityString)
+	}
+
+	req := httptest.NewRequest("GET", "/api/cmts", nil)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	var list []models.CMTS
+	if err := json.NewDecoder(w.Body).Decode(&list); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	for _, cmts := range list {
+		if cmts.CommunityWrite != "" && cmts.CommunityWrite != redactedSecret {
+			t.Errorf("Expected redacted write community in list, got %q", cmts.CommunityWrite)
+		}
+		if cmts.CMCommunityString != "" && cmts.CMCommunityString != redactedSecret {
+			t.Errorf("Expected redacted cable modem community in list, got %q", cmts.CMCommunityString)
+		}
+	}
+
+	// Echoing the placeholders back keeps the stored communities
+	redacted.Name = "Renamed CMTS"
+	body, _ := json.Marshal(redacted)
+	req = httptest.NewRequest("PUT", "/api/cmts/1", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	updated, err := db.GetCMTS(1)
+	if err != nil {
+		t.Fatalf("Failed to get CMTS: %v", err)
+	}
+	if updated.Name != "Renamed CMTS" || updated.CommunityWrite != "private" || updated.CMCommunityString != "cable-modem" {
+		t.Errorf("Expected renamed CMTS keeping its communities, got %q / %q / %q", updated.Name, updated.CommunityWrite, updated.CMCommunityString)
+	}
+}
+
 func TestHandleGetCMTSNotFound(t *testing.T) {
 	server, db := setupTestServer(t)
 	defer db.Close()
@@ -153,6 +396,38 @@ func TestHandleGetCMTSNotFound(t *testing.T) {
 	}
 }
 
+func TestHandleTestCMTSNotFound(t *testing.T) {
+	server, db := setupTestServer(t)
+	defer db.Close()
+
+	req := httptest.NewRequest("POST", "/api/cmts/999/test", nil)
+	w := httptest.NewRecorder()
+
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", w.Code)
+	}
+}
+
+func TestHandleTestUnsavedCMTSInvalid(t *testing.T) {
+	server, db := setupTestServer(t)
+	defer db.Close()
+
+	body := `{"name":"Lab CMTS","ip_address":"192.0.2.10","snmp_port":161,"snmp_version":2}`
+	req := httptest.NewRequest("POST", "/api/cmts/test", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "community") {
+		t.Errorf("Expected community error, got %s", w.Body.String())
+	}
+}
+
 func TestHandleUpdateCMTS(t *testing.T) {
 	server, db := setupTestServer(t)
 	defer db.Close()
@@ -189,6 +464,41 @@ func TestHandleUpdateCMTS(t *testing.T) {
 	}
 }
 
+func TestHandleUpdateCMTSFormErrors(t *testing.T) {
+	server, db := setupTestServer(t)
+	defer db.Close()
+
+	if _, err := db.CreateCMTS(&models.CMTS{
+		Name:          "Second CMTS",
+		IPAddress:     "192.168.1.2",
+		SNMPPort:      161,
+		CommunityRead: "public",
+		SNMPVersion:   2,
+	}); err != nil {
+		t.Fatalf("Failed to create CMTS: %v", err)
+	}
+
+	form := "&ip_address=%s&community_read=public&community_write=private&snmp_version=2"
+	for _, tt := range []struct {
+		name string
+		body string
+		want int
+	}{
+		{"valid", "id=1&name=Edited" + fmt.Sprintf(form, "192.168.1.1"), http.StatusSeeOther},
+		{"invalid", "id=1&name=" + fmt.Sprintf(form, "192.168.1.1"), http.StatusBadRequest},
+		{"duplicate IP", "id=1&name=Edited" + fmt.Sprintf(form, "192.168.1.2"), http.StatusConflict},
+		{"unknown CMTS", "id=99&name=Edited" + fmt.Sprintf(form, "192.168.1.99"), http.StatusNotFound},
+	} {
+		req := httptest.NewRequest("POST", "/api/cmts/update", strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s: expected status %d, got %d (%s)", tt.name, tt.want, w.Code, w.Body.String())
+		}
+	}
+}
+
 func TestHandleDeleteCMTS(t *testing.T) {
 	server, db := setupTestServer(t)
 	defer db.Close()
@@ -209,6 +519,91 @@ func TestHandleDeleteCMTS(t *testing.T) {
 	}
 }
 
+func TestHandleListCMTSIncludeDeleted(t *testing.T) {
+	server, db := setupTestServer(t)
+	defer db.Close()
+
+	db.DeleteCMTS(1)
+
+	for _, tt := range []struct {
+		query string
+		want  int
+	}{
+		{"", 0},
+		{"?include_deleted=true", 1},
+	} {
+		req := httptest.NewRequest("GET", "/api/cmts"+tt.query, nil)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+
+		var list []*models.CMTS
+		if err := json.NewDecoder(w.Body).Decode(&list); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if len(list) != tt.want {
+			t.Errorf("GET /api/cmts%s: expected %d CMTS, got %d", tt.query, tt.want, len(list))
+		}
+	}
+
+	req := httptest.NewRequest("POST", "/api/cmts/1/restore", nil)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 on restore, got %d", w.Code)
+	}
+	if _, err := db.GetCMTS(1); err != nil {
+		t.Errorf("Expected CMTS to be restored: %v", err)
+	}
+}
+
+func TestHandleListCMTSFiltered(t *testing.T) {
+	server, db := setupTestServer(t)
+	defer db.Close()
+
+	for i, name := range []string{"Edge North", "Edge South", "Core West"} {
+		db.CreateCMTS(&models.CMTS{
+			Name:          name,
+			IPAddress:     fmt.Sprintf("10.1.1.%d", i+1),
+			SNMPPort:      161,
+			CommunityRead: "public",
+			SNMPVersion:   2,
+			Enabled:       name != "Edge South",
+		})
+	}
+
+	for _, tt := range []struct {
+		query string
+		want  int
+		total string
+	}{
+		{"", 4, "4"},
+		{"?enabled=true", 3, "3"},
+		{"?q=edge", 2, "2"},
+		{"?q=edge&enabled=true", 1, "1"},
+		{"?limit=2&offset=1", 2, "4"},
+		{"?offset=-5&limit=bogus", 4, "4"},
+	} {
+		req := httptest.NewRequest("GET", "/api/cmts"+tt.query, nil)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET /api/cmts%s: expected status 200, got %d", tt.query, w.Code)
+		}
+		var list []*models.CMTS
+		if err := json.NewDecoder(w.Body).Decode(&list); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if len(list) != tt.want {
+			t.Errorf("GET /api/cmts%s: expected %d CMTS, got %d", tt.query, tt.want, len(list))
+		}
+		if got := w.Header().Get("X-Total-Count"); got != tt.total {
+			t.Errorf("GET /api/cmts%s: expected X-Total-Count %s, got %q", tt.query, tt.total, got)
+		}
+	}
+}
+
 // Modem Tests
 
 func TestHandleListModems(t *testing.T) {
@@ -259,230 +654,625 @@ func TestHandleListModemsWithCMTSFilter(t *testing.T) {
 	}
 }
 
-func TestHandleGetModem(t *testing.T) {
+func TestHandleListCMTSModems(t *testing.T) {
 	server, db := setupTestServer(t)
 	defer db.Close()
 
-	req := httptest.NewRequest("GET", "/api/modems/1", nil)
+	for i, status := range []string{"offline", "offline", "denied"} {
+		db.UpsertModem(&models.CableModem{
+			CMTSID:     1,
+			MACAddress: fmt.Sprintf("00:01:5C:BB:00:%02X", i),
+			Status:     status,
+		})
+	}
+
+	req := httptest.NewRequest("GET", "/api/cmts/1/modems", nil)
 	w := httptest.NewRecorder()
 
 	server.router.ServeHTTP(w, req)
 
 	if w.Code != http.StatusOK {
-		t.Errorf("Expected status 200, got %d", w.Code)
+		t.Fatalf("Expected status 200, got %d", w.Code)
 	}
 
-	var modem models.CableModem
-	if err := json.NewDecoder(w.Body).Decode(&modem); err != nil {
+	var resp struct {
+		Modems  []*models.CableModem `json:"modems"`
+		Summary map[string]int       `json:"summary"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
 		t.Fatalf("Failed to decode response: %v", err)
 	}
 
-	if modem.ID != 1 {
-		t.Errorf("Expected ID 1, got %d", modem.ID)
+	if len(resp.Modems) != 4 {
+		t.Errorf("Expected 4 modems, got %d", len(resp.Modems))
 	}
-}
 
-func TestHandleGetModemNotFound(t *testing.T) {
-	server, db := setupTestServer(t)
-	defer db.Close()
+	want := map[string]int{"online": 1, "offline": 2, "partial": 0, "denied": 1}
+	for status, count := range want {
+		if resp.Summary[status] != count {
+			t.Errorf("Expected %d %s modems, got %d", count, status, resp.Summary[status])
+		}
+	}
 
-	req := httptest.NewRequest("GET", "/api/modems/999", nil)
-	w := httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/api/cmts/99/modems", nil)
+	w = httptest.NewRecorder()
 
 	server.router.ServeHTTP(w, req)
 
 	if w.Code != http.StatusNotFound {
-		t.Errorf("Expected status 404, got %d", w.Code)
+		t.Errorf("Expected status 404 for missing CMTS, got %d", w.Code)
 	}
 }
 
-// Rule Tests
-
-func TestHandleListRules(t *testing.T) {
+func TestHandleDeleteCMTSModems(t *testing.T) {
 	server, db := setupTestServer(t)
 	defer db.Close()
 
-	req := httptest.NewRequest("GET", "/api/rules", nil)
+	db.UpsertModem(&models.CableModem{CMTSID: 1, MACAddress: "00:01:5C:BB:10:01", Status: "online"})
+	busy, err := db.GetModemByMAC("00:01:5C:BB:10:01")
+	if err != nil {
+		t.Fatalf("Failed to get modem: %v", err)
+	}
+	db.CreateJob(&models.UpgradeJob{
+		ModemID:    busy.ID,
+		RuleID:     1,
+		CMTSID:     1,
+		MACAddress: busy.MACAddress,
+		Status:     models.JobStatusInProgress,
+	})
+
+	req := httptest.NewRequest("DELETE", "/api/cmts/1/modems", nil)
 	w := httptest.NewRecorder()
 
 	server.router.ServeHTTP(w, req)
 
 	if w.Code != http.StatusOK {
-		t.Errorf("Expected status 200, got %d", w.Code)
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
 	}
 
-	var rules []*models.UpgradeRule
-	if err := json.NewDecoder(w.Body).Decode(&rules); err != nil {
+	var resp struct {
+		Deleted int      `json:"deleted"`
+		Skipped []string `json:"skipped"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
 		t.Fatalf("Failed to decode response: %v", err)
 	}
+	if resp.Deleted != 1 {
+		t.Errorf("Expected the fixture modem deleted, got %d", resp.Deleted)
+	}
+	if len(resp.Skipped) != 1 || resp.Skipped[0] != busy.MACAddress {
+		t.Errorf("Expected %s skipped, got %v", busy.MACAddress, resp.Skipped)
+	}
 
-	if len(rules) != 1 {
-		t.Errorf("Expected 1 rule, got %d", len(rules))
+	for _, tc := range []struct{ method, path string }{
+		{"DELETE", "/api/cmts/99/modems"},
+		{"POST", "/api/cmts/99/modems/reset"},
+	} {
+		req = httptest.NewRequest(tc.method, tc.path, nil)
+		w = httptest.NewRecorder()
+
+		server.router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusNotFound {
+			t.Errorf("Expected status 404 for %s %s, got %d", tc.method, tc.path, w.Code)
+		}
 	}
 }
 
-func TestHandleCreateRule(t *testing.T) {
+func TestHandleCMTSUpgradeProgress(t *testing.T) {
 	server, db := setupTestServer(t)
 	defer db.Close()
 
-	rule := models.UpgradeRule{
-		Name:             "New Rule",
-		Description:      "Test rule",
-		MatchType:        "MAC_RANGE",
-		MatchCriteria:    `{"start_mac":"00:01:5C:00:00:00","end_mac":"00:01:5C:FF:FF:FF"}`,
-		TFTPServerIP:     "192.168.1.50",
-		FirmwareFilename: "firmware.bin",
-		Enabled:          true,
-		Priority:         100,
+	for _, status := range []string{
+		models.JobStatusCompleted,
+		models.JobStatusCompleted,
+		models.JobStatusCompleted,
+		models.JobStatusFailed,
+		models.JobStatusInProgress,
+		models.JobStatusPending,
+		models.JobStatusSkipped,
+	} {
+		if _, err := db.CreateJob(&models.UpgradeJob{
+			ModemID:    1,
+			RuleID:     1,
+			CMTSID:     1,
+			MACAddress: "00:01:5C:11:22:33",
+			Status:     status,
+		}); err != nil {
+			t.Fatalf("Failed to create job: %v", err)
+		}
 	}
 
-	body, _ := json.Marshal(rule)
-	req := httptest.NewRequest("POST", "/api/rules", bytes.NewBuffer(body))
-	req.Header.Set("Content-Type", "application/json")
+	req := httptest.NewRequest("GET", "/api/cmts/1/upgrade-progress", nil)
 	w := httptest.NewRecorder()
 
 	server.router.ServeHTTP(w, req)
 
-	if w.Code != http.StatusCreated {
-		t.Errorf("Expected status 201, got %d", w.Code)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
 	}
 
-	var response map[string]interface{}
-	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+	var resp struct {
+		CMTSID          int            `json:"cmts_id"`
+		Jobs            map[string]int `json:"jobs"`
+		Total           int            `json:"total"`
+		PercentComplete float64        `json:"percent_complete"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
 		t.Fatalf("Failed to decode response: %v", err)
 	}
+	if resp.CMTSID != 1 || resp.Total != 6 || resp.PercentComplete != 50 {
+		t.Errorf("Expected 6 jobs on CMTS 1 at 50%%, got %+v", resp)
+	}
+	if resp.Jobs[models.JobStatusPending] != 1 || resp.Jobs[models.JobStatusInProgress] != 1 ||
+		resp.Jobs[models.JobStatusCompleted] != 3 || resp.Jobs[models.JobStatusFailed] != 1 {
+		t.Errorf("Unexpected job counts: %v", resp.Jobs)
+	}
+	if _, ok := resp.Jobs[models.JobStatusSkipped]; ok {
+		t.Errorf("Expected skipped jobs left out, got %v", resp.Jobs)
+	}
 
-	if _, ok := response["id"]; !ok {
-		t.Error("Expected id in response")
+	// A CMTS without jobs reports zeros rather than dividing by zero
+	idle, err := db.CreateCMTS(&models.CMTS{
+		Name:          "Idle CMTS",
+		IPAddress:     "10.1.1.50",
+		SNMPPort:      161,
+		CommunityRead: "public",
+		SNMPVersion:   2,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create CMTS: %v", err)
 	}
-}
+	req = httptest.NewRequest("GET", fmt.Sprintf("/api/cmts/%d/upgrade-progress", idle), nil)
+	w = httptest.NewRecorder()
 
-func TestHandleCreateRuleInvalidMatchType(t *testing.T) {
-	server, db := setupTestServer(t)
-	defer db.Close()
+	server.router.ServeHTTP(w, req)
 
-	rule := models.UpgradeRule{
-		Name:             "Invalid Rule",
-		MatchType:        "INVALID_TYPE",
-		MatchCriteria:    `{"pattern":"test"}`,
-		TFTPServerIP:     "192.168.1.50",
-		FirmwareFilename: "firmware.bin",
+	resp.Jobs = nil
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if w.Code != http.StatusOK || resp.Total != 0 || resp.PercentComplete != 0 || len(resp.Jobs) != 4 {
+		t.Errorf("Expected empty progress for an idle CMTS, got %d %+v", w.Code, resp)
 	}
 
-	body, _ := json.Marshal(rule)
-	req := httptest.NewRequest("POST", "/api/rules", bytes.NewBuffer(body))
-	req.Header.Set("Content-Type", "application/json")
-	w := httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/api/cmts/999/upgrade-progress", nil)
+	w = httptest.NewRecorder()
 
 	server.router.ServeHTTP(w, req)
 
-	if w.Code != http.StatusBadRequest {
-		t.Errorf("Expected status 400, got %d", w.Code)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", w.Code)
 	}
 }
 
-func TestHandleGetRule(t *testing.T) {
+func TestHandleListModemsTruncated(t *testing.T) {
 	server, db := setupTestServer(t)
 	defer db.Close()
 
-	req := httptest.NewRequest("GET", "/api/rules/1", nil)
-	w := httptest.NewRecorder()
-
+	for i := 0; i < 25; i++ {
+		err := db.UpsertModem(&models.CableModem{
+			CMTSID:     1,
+			MACAddress: fmt.Sprintf("00:01:5C:AA:00:%02X", i),
+			IPAddress:  fmt.Sprintf("10.0.1.%d", i+1),
+			Status:     "online",
+		})
+		if err != nil {
+			t.Fatalf("Failed to create modem: %v", err)
+		}
+	}
+	db.SetSetting("max_list_items", "10")
+
+	tests := []struct {
+		name          string
+		query         string
+		wantCount     int
+		wantTruncated bool
+	}{
+		{"default cap", "", 10, true},
+		{"limit above cap", "?limit=500", 10, true},
+		{"explicit page", "?limit=5&offset=5", 5, true},
+		{"last page", "?limit=10&offset=20", 6, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/modems"+tt.query, nil)
+			w := httptest.NewRecorder()
+
+			server.router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d", w.Code)
+			}
+
+			var modems []*models.CableModem
+			if err := json.NewDecoder(w.Body).Decode(&modems); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+
+			if len(modems) != tt.wantCount {
+				t.Errorf("Expected %d modems, got %d", tt.wantCount, len(modems))
+			}
+
+			truncated := w.Header().Get("X-Result-Truncated") == "true"
+			if truncated != tt.wantTruncated {
+				t.Errorf("Expected truncated=%v, got %v", tt.wantTruncated, truncated)
+			}
+			if truncated && w.Header().Get("Warning") == "" {
+				t.Error("Expected Warning header on truncated response")
+			}
+		})
+	}
+}
+
+func TestHandleGetModem(t *testing.T) {
+	server, db := setupTestServer(t)
+	defer db.Close()
+
+	req := httptest.NewRequest("GET", "/api/modems/1", nil)
+	w := httptest.NewRecorder()
+
 	server.router.ServeHTTP(w, req)
 
 	if w.Code != http.StatusOK {
 		t.Errorf("Expected status 200, got %d", w.Code)
 	}
 
-	var rule models.UpgradeRule
-	if err := json.NewDecoder(w.Body).Decode(&rule); err != nil {
+	var modem struct {
+		models.CableModem
+		StaleSeconds *int  `json:"stale_seconds"`
+		IsStale      *bool `json:"is_stale"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&modem); err != nil {
 		t.Fatalf("Failed to decode response: %v", err)
 	}
 
-	if rule.ID != 1 {
-		t.Errorf("Expected ID 1, got %d", rule.ID)
+	if modem.ID != 1 {
+		t.Errorf("Expected ID 1, got %d", modem.ID)
+	}
+	if modem.StaleSeconds == nil || modem.IsStale == nil || *modem.IsStale {
+		t.Errorf("Expected a freshly seen modem with staleness fields, got %+v", modem)
 	}
 }
 
-func TestHandleUpdateRule(t *testing.T) {
+func TestHandleUpgradeModem(t *testing.T) {
 	server, db := setupTestServer(t)
 	defer db.Close()
 
-	rule := models.UpgradeRule{
-		Name:             "Updated Rule",
-		Description:      "Updated description",
-		MatchType:        "MAC_RANGE",
-		MatchCriteria:    `{"start_mac":"00:01:5C:00:00:00","end_mac":"00:01:5C:FF:FF:FF"}`,
-		TFTPServerIP:     "192.168.1.50",
-		FirmwareFilename: "firmware-v2.bin",
-		Enabled:          false,
-		Priority:         200,
+	body := `{"tftp_server_ip":"192.168.1.50","firmware_filename":"firmware-v2.0.0.bin","operator":"jdoe"}`
+	req := httptest.NewRequest("POST", "/api/modems/1/upgrade", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
 	}
 
-	body, _ := json.Marshal(rule)
-	req := httptest.NewRequest("PUT", "/api/rules/1", bytes.NewBuffer(body))
-	req.Header.Set("Content-Type", "application/json")
+	var result struct {
+		JobID int `json:"job_id"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if _, err := db.GetJob(result.JobID); err != nil {
+		t.Errorf("Expected job %d to exist: %v", result.JobID, err)
+	}
+
+	logs, _ := db.ListActivityLogs(database.ActivityLogFilter{EventType: models.EventUpgradeManual}, 10, 0)
+	if len(logs) != 1 || !strings.Contains(logs[0].Message, "jdoe") || !strings.Contains(logs[0].Details, "client_ip") {
+		t.Errorf("Expected manual upgrade logged with operator, got %+v", logs)
+	}
+
+	// A second request while the first is pending is rejected
+	req = httptest.NewRequest("POST", "/api/modems/1/upgrade", strings.NewReader(body))
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/api/modems/999/upgrade", strings.NewReader(body))
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", w.Code)
+	}
+}
+
+func TestHandleModemSignalHistory(t *testing.T) {
+	server, db := setupTestServer(t)
+	defer db.Close()
+
+	db.UpsertModem(&models.CableModem{
+		CMTSID:      1,
+		MACAddress:  "00:01:5C:11:22:33",
+		SignalLevel: 3.2,
+		Status:      "online",
+	})
+
+	req := httptest.NewRequest("GET", "/api/modems/1/signal-history", nil)
 	w := httptest.NewRecorder()
 
 	server.router.ServeHTTP(w, req)
 
 	if w.Code != http.StatusOK {
-		t.Errorf("Expected status 200, got %d", w.Code)
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var readings []models.SignalReading
+	if err := json.NewDecoder(w.Body).Decode(&readings); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	// The fixture's discovery recorded the first reading
+	if len(readings) != 2 || readings[1].SignalLevel == nil || *readings[1].SignalLevel != 3.2 {
+		t.Errorf("Expected the latest reading at 3.2 dBmV, got %+v", readings)
 	}
 
-	// Verify update
-	updated, err := db.GetRule(1)
-	if err != nil {
-		t.Fatalf("Failed to get updated rule: %v", err)
+	since := url.QueryEscape(time.Now().Add(time.Hour).Format(time.RFC3339))
+	for _, tc := range []struct {
+		path string
+		code int
+	}{
+		{"/api/modems/1/signal-history?since=" + since, http.StatusOK},
+		{"/api/modems/1/signal-history?since=yesterday", http.StatusBadRequest},
+		{"/api/modems/999/signal-history", http.StatusNotFound},
+	} {
+		req = httptest.NewRequest("GET", tc.path, nil)
+		w = httptest.NewRecorder()
+
+		server.router.ServeHTTP(w, req)
+
+		if w.Code != tc.code {
+			t.Errorf("%s: expected status %d, got %d", tc.path, tc.code, w.Code)
+		}
+		if tc.code == http.StatusOK && strings.TrimSpace(w.Body.String()) != "[]" {
+			t.Errorf("%s: expected no readings, got %s", tc.path, w.Body.String())
+		}
 	}
+}
 
-	if updated.Name != "Updated Rule" {
-		t.Errorf("Expected name 'Updated Rule', got %s", updated.Name)
+func TestHandleRebootModem(t *testing.T) {
+	server, db := setupTestServer(t)
+	defer db.Close()
+
+	req := httptest.NewRequest("POST", "/api/modems/999/reboot", nil)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", w.Code)
 	}
-	if updated.Priority != 200 {
-		t.Errorf("Expected priority 200, got %d", updated.Priority)
+
+	// Modems without an IP can't be reached over SNMP
+	if err := db.UpsertModem(&models.CableModem{CMTSID: 1, MACAddress: "00:01:5C:11:22:33", Status: "offline"}); err != nil {
+		t.Fatalf("Failed to update modem: %v", err)
+	}
+	req = httptest.NewRequest("POST", "/api/modems/1/reboot", strings.NewReader(`{"operator":"jdoe"}`))
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400, got %d: %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), models.ErrModemNoIP.Message) {
+		t.Errorf("Expected no IP error, got %s", w.Body.String())
+	}
+
+	logs, _ := db.ListActivityLogs(database.ActivityLogFilter{EventType: models.EventModemReboot}, 10, 0)
+	if len(logs) != 0 {
+		t.Errorf("Expected no reboot logged for a rejected request, got %d", len(logs))
 	}
 }
 
-func TestHandleDeleteRule(t *testing.T) {
+func TestHandleGetModemRefresh(t *testing.T) {
 	server, db := setupTestServer(t)
 	defer db.Close()
 
-	req := httptest.NewRequest("DELETE", "/api/rules/1", nil)
+	req := httptest.NewRequest("GET", "/api/modems/999?refresh=true", nil)
 	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", w.Code)
+	}
+
+	// A modem without an IP can't be queried, so the cached row comes back
+	if err := db.UpsertModem(&models.CableModem{CMTSID: 1, MACAddress: "00:01:5C:11:22:33", Status: "offline"}); err != nil {
+		t.Fatalf("Failed to update modem: %v", err)
+	}
+	req = httptest.NewRequest("GET", "/api/modems/1?refresh=true", nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var got struct {
+		MACAddress string `json:"mac_address"`
+		Status     string `json:"status"`
+		Stale      *bool  `json:"stale"`
+		IsStale    *bool  `json:"is_stale"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if got.MACAddress != "00:01:5C:11:22:33" || got.Status != "offline" || got.IsStale == nil {
+		t.Errorf("Expected the cached modem, got %+v", got)
+	}
+	if got.Stale == nil || !*got.Stale {
+		t.Error("Expected cached fallback to be marked stale")
+	}
 
+	req = httptest.NewRequest("GET", "/api/modems/1", nil)
+	w = httptest.NewRecorder()
 	server.router.ServeHTTP(w, req)
+	if strings.Contains(w.Body.String(), `"stale"`) {
+		t.Errorf("Expected no stale flag without refresh, got %s", w.Body.String())
+	}
+}
+
+func TestHandleModemMatchingRules(t *testing.T) {
+	server, db := setupTestServer(t)
+	defer db.Close()
+
+	// A lower-priority rule that also matches the fixture modem
+	if _, err := db.CreateRule(&models.UpgradeRule{
+		Name:             "Vendor Rule",
+		MatchType:        "SYSDESCR_REGEX",
+		MatchCriteria:    `{"pattern":".*"}`,
+		TFTPServerIP:     "192.168.1.50",
+		FirmwareFilename: "firmware-v1.5.0.bin",
+		Enabled:          true,
+		Priority:         10,
+	}); err != nil {
+		t.Fatalf("Failed to create rule: %v", err)
+	}
 
+	req := httptest.NewRequest("GET", "/api/modems/1/matching-rules", nil)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
 	if w.Code != http.StatusOK {
-		t.Errorf("Expected status 200, got %d", w.Code)
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
 	}
 
-	// Verify deletion
-	_, err := db.GetRule(1)
-	if err != models.ErrNotFound {
-		t.Error("Expected rule to be deleted")
+	var matches []struct {
+		Name     string `json:"name"`
+		Priority int    `json:"priority"`
+		Selected bool   `json:"selected"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&matches); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(matches) != 2 {
+		t.Fatalf("Expected 2 matching rules, got %+v", matches)
+	}
+	if matches[0].Name != "Test Rule" || !matches[0].Selected {
+		t.Errorf("Expected Test Rule first and selected, got %+v", matches[0])
+	}
+	if matches[1].Name != "Vendor Rule" || matches[1].Selected {
+		t.Errorf("Expected Vendor Rule second and not selected, got %+v", matches[1])
+	}
+
+	req = httptest.NewRequest("GET", "/api/modems/999/matching-rules", nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", w.Code)
 	}
 }
 
-// Job Tests
+func TestHandleSetModemTags(t *testing.T) {
+	server, db := setupTestServer(t)
+	defer db.Close()
 
-func TestHandleListJobs(t *testing.T) {
+	req := httptest.NewRequest("PUT", "/api/modems/1/tags", strings.NewReader(`{"tags":["business","lab"]}`))
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var modem models.CableModem
+	if err := json.NewDecoder(w.Body).Decode(&modem); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if strings.Join(modem.Tags, ",") != "business,lab" {
+		t.Errorf("Expected tags [business lab], got %v", modem.Tags)
+	}
+
+	req = httptest.NewRequest("PUT", "/api/modems/1/tags", strings.NewReader(`{"tags":[""]}`))
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest("PUT", "/api/modems/999/tags", strings.NewReader(`{"tags":["lab"]}`))
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", w.Code)
+	}
+}
+
+func TestHandleGetModemNotFound(t *testing.T) {
 	server, db := setupTestServer(t)
 	defer db.Close()
 
-	// Create a test job
-	db.CreateJob(&models.UpgradeJob{
+	req := httptest.NewRequest("GET", "/api/modems/999", nil)
+	w := httptest.NewRecorder()
+
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", w.Code)
+	}
+}
+
+func TestHandleSearchModem(t *testing.T) {
+	server, db := setupTestServer(t)
+	defer db.Close()
+
+	if _, err := db.CreateJob(&models.UpgradeJob{
 		ModemID:          1,
 		RuleID:           1,
 		CMTSID:           1,
 		MACAddress:       "00:01:5C:11:22:33",
-		Status:           models.JobStatusPending,
+		Status:           models.JobStatusCompleted,
 		TFTPServerIP:     "192.168.1.50",
 		FirmwareFilename: "firmware.bin",
 		MaxRetries:       3,
-	})
+	}); err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
 
-	req := httptest.NewRequest("GET", "/api/jobs", nil)
+	// Whatever notation the ticket uses finds the fixture modem
+	for _, mac := range []string{"00:01:5C:11:22:33", "00-01-5c-11-22-33", "0001.5C11.2233", "00015c112233"} {
+		req := httptest.NewRequest("GET", "/api/modems/search?mac="+url.QueryEscape(mac), nil)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200 for %s, got %d", mac, w.Code)
+		}
+
+		var result struct {
+			Modem models.CableModem   `json:"modem"`
+			Jobs  []models.UpgradeJob `json:"jobs"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if result.Modem.ID != 1 {
+			t.Errorf("Expected modem 1 for %s, got %d", mac, result.Modem.ID)
+		}
+		if len(result.Jobs) != 1 {
+			t.Errorf("Expected 1 job for %s, got %d", mac, len(result.Jobs))
+		}
+	}
+
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"", http.StatusBadRequest},
+		{"?mac=not-a-mac", http.StatusBadRequest},
+		{"?mac=00:01:5C:99:99:99", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/api/modems/search"+tt.query, nil)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("GET /api/modems/search%s: expected status %d, got %d", tt.query, tt.want, w.Code)
+		}
+	}
+}
+
+// Rule Tests
+
+func TestHandleListRules(t *testing.T) {
+	server, db := setupTestServer(t)
+	defer db.Close()
+
+	req := httptest.NewRequest("GET", "/api/rules", nil)
 	w := httptest.NewRecorder()
 
 	server.router.ServeHTTP(w, req)
@@ -491,44 +1281,1936 @@ func TestHandleListJobs(t *testing.T) {
 		t.Errorf("Expected status 200, got %d", w.Code)
 	}
 
-	var jobs []*models.UpgradeJob
-	if err := json.NewDecoder(w.Body).Decode(&jobs); err != nil {
+	var rules []*models.UpgradeRule
+	if err := json.NewDecoder(w.Body).Decode(&rules); err != nil {
 		t.Fatalf("Failed to decode response: %v", err)
 	}
 
-	if len(jobs) == 0 {
-		t.Error("Expected at least one job")
+	if len(rules) != 1 {
+		t.Errorf("Expected 1 rule, got %d", len(rules))
 	}
 }
 
-func TestHandleListJobsWithStatusFilter(t *testing.T) {
+func TestHandleCreateRule(t *testing.T) {
 	server, db := setupTestServer(t)
 	defer db.Close()
 
-	// Create jobs with different statuses
-	db.CreateJob(&models.UpgradeJob{
-		ModemID:          1,
-		RuleID:           1,
-		CMTSID:           1,
-		MACAddress:       "00:01:5C:11:22:33",
-		Status:           models.JobStatusPending,
+	rule := models.UpgradeRule{
+		Name:             "New Rule",
+		Description:      "Test rule",
+		MatchType:        "MAC_RANGE",
+		MatchCriteria:    `{"start_mac":"00:01:5C:00:00:00","end_mac":"00:01:5C:FF:FF:FF"}`,
 		TFTPServerIP:     "192.168.1.50",
 		FirmwareFilename: "firmware.bin",
-		MaxRetries:       3,
-	})
+		Enabled:          true,
+		Priority:         100,
+	}
 
-	db.CreateJob(&models.UpgradeJob{
-		ModemID:          1,
-		RuleID:           1,
-		CMTSID:           1,
-		MACAddress:       "00:01:5C:11:22:44",
-		Status:           models.JobStatusCompleted,
-		TFTPServerIP:     "192.168.1.50",
-		FirmwareFilename: "firmware.bin",
-		MaxRetries:       3,
-	})
+	body, _ := json.Marshal(rule)
+	req := httptest.NewRequest("POST", "/api/rules", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Errorf("Expected status 201, got %d", w.Code)
+	}
+
+	var response map[string]interface{}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if _, ok := response["id"]; !ok {
+		t.Error("Expected id in response")
+	}
+}
+
+func TestHandleCloneRule(t *testing.T) {
+	server, db := setupTestServer(t)
+	defer db.Close()
+
+	req := httptest.NewRequest("POST", "/api/rules/1/clone", nil)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var response map[string]interface{}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	id := int(response["id"].(float64))
+
+	source, _ := db.GetRule(1)
+	clone, err := db.GetRule(id)
+	if err != nil {
+		t.Fatalf("Failed to get clone: %v", err)
+	}
+	if id == source.ID || clone.Name != "Test Rule (copy)" || clone.Enabled {
+		t.Errorf("Expected a disabled copy named \"Test Rule (copy)\", got %+v", clone)
+	}
+	if clone.MatchCriteria != source.MatchCriteria || clone.Priority != source.Priority ||
+		clone.FirmwareFilename != source.FirmwareFilename || clone.MaxRetries != source.MaxRetries {
+		t.Errorf("Expected the copy to keep the source's settings, got %+v from %+v", clone, source)
+	}
+	if !source.Enabled {
+		t.Error("Expected the source rule to stay enabled")
+	}
+
+	req = httptest.NewRequest("POST", "/api/rules/999/clone", nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a missing rule, got %d", w.Code)
+	}
+}
+
+func TestHandleRuleMaxRetries(t *testing.T) {
+	server, db := setupTestServer(t)
+	defer db.Close()
+
+	if err := db.SetSetting("retry_attempts", "5"); err != nil {
+		t.Fatalf("Failed to set retry_attempts: %v", err)
+	}
+
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+	rule := `{"name":"Retry Rule","match_type":"MAC_RANGE",` +
+		`"match_criteria":"{\"start_mac\":\"00:01:5C:00:00:00\",\"end_mac\":\"00:01:5C:FF:FF:FF\"}",` +
+		`"tftp_server_ip":"192.168.1.50","firmware_filename":"firmware.bin"`
+
+	// A rule without max_retries inherits the retry_attempts setting
+	w := send("POST", "/api/rules", rule+"}")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var created map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&created)
+	id := int(created["id"].(float64))
+	stored, err := db.GetRule(id)
+	if err != nil {
+		t.Fatalf("Failed to get rule: %v", err)
+	}
+	if stored.MaxRetries != 5 {
+		t.Errorf("Expected max retries from retry_attempts (5), got %d", stored.MaxRetries)
+	}
+
+	// An update that leaves it out keeps the rule's value
+	stored.MaxRetries = 0
+	db.UpdateRule(stored)
+	if w := send("PUT", fmt.Sprintf("/api/rules/%d", id), rule+`,"priority":5}`); w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if stored, _ = db.GetRule(id); stored.MaxRetries != 0 {
+		t.Errorf("Expected update to keep max retries 0, got %d", stored.MaxRetries)
+	}
+
+	if w := send("POST", "/api/rules", rule+`,"name":"Too Many","max_retries":11}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for max_retries 11, got %d", w.Code)
+	}
+
+	// retry_attempts 0 is inherited as no retries, not as unset
+	if err := db.SetSetting("retry_attempts", "0"); err != nil {
+		t.Fatalf("Failed to set retry_attempts: %v", err)
+	}
+	if server.defaultMaxRetries() != 0 {
+		t.Errorf("Expected retry_attempts 0 to give max retries 0, got %d", server.defaultMaxRetries())
+	}
+}
+
+func TestHandleCreateRuleInvalidMatchType(t *testing.T) {
+	server, db := setupTestServer(t)
+	defer db.Close()
+
+	rule := models.UpgradeRule{
+		Name:             "Invalid Rule",
+		MatchType:        "INVALID_TYPE",
+		MatchCriteria:    `{"pattern":"test"}`,
+		TFTPServerIP:     "192.168.1.50",
+		FirmwareFilename: "firmware.bin",
+	}
+
+	body, _ := json.Marshal(rule)
+	req := httptest.NewRequest("POST", "/api/rules", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+}
+
+func TestHandleGetRule(t *testing.T) {
+	server, db := setupTestServer(t)
+	defer db.Close()
+
+	req := httptest.NewRequest("GET", "/api/rules/1", nil)
+	w := httptest.NewRecorder()
+
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+
+	var rule models.UpgradeRule
+	if err := json.NewDecoder(w.Body).Decode(&rule); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if rule.ID != 1 {
+		t.Errorf("Expected ID 1, got %d", rule.ID)
+	}
+}
+
+func TestHandleUpdateRule(t *testing.T) {
+	server, db := setupTestServer(t)
+	defer db.Close()
+
+	rule := models.UpgradeRule{
+		Name:             "Updated Rule",
+		Description:      "Updated description",
+		MatchType:        "MAC_RANGE",
+		MatchCriteria:    `{"start_mac":"00:01:5C:00:00:00","end_mac":"00:01:5C:FF:FF:FF"}`,
+		TFTPServerIP:     "192.168.1.50",
+		FirmwareFilename: "firmware-v2.bin",
+		Enabled:          false,
+		Priority:         200,
+	}
+
+	body, _ := json.Marshal(rule)
+	req := httptest.NewRequest("PUT", "/api/rules/1", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+
+	// Verify update
+	updated, err := db.GetRule(1)
+	if err != nil {
+		t.Fatalf("Failed to get updated rule: %v", err)
+	}
+
+	if updated.Name != "Updated Rule" {
+		t.Errorf("Expected name 'Updated Rule', got %s", updated.Name)
+	}
+	if updated.Priority != 200 {
+		t.Errorf("Expected priority 200, got %d", updated.Priority)
+	}
+}
+
+func TestHandleUpdateRuleCancelPending(t *testing.T) {
+	server, db := setupTestServer(t)
+	defer db.Close()
+
+	createJob := func(status string) int {
+		id, err := db.CreateJob(&models.UpgradeJob{
+			ModemID:    1,
+			RuleID:     1,
+			CMTSID:     1,
+			MACAddress: "00:01:5C:11:22:33",
+			Status:     status,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create job: %v", err)
+		}
+		return id
+	}
+	pending := createJob(models.JobStatusPending)
+	running := createJob(models.JobStatusInProgress)
+
+	update := func(query string, enabled bool) map[string]interface{} {
+		rule, err := db.GetRule(1)
+		if err != nil {
+			t.Fatalf("Failed to get rule: %v", err)
+		}
+		rule.Enabled = enabled
+		body, _ := json.Marshal(rule)
+		req := httptest.NewRequest("PUT", "/api/rules/1"+query, bytes.NewBuffer(body))
+		w := httptest.NewRecorder()
+
+		server.router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var resp map[string]interface{}
+		json.NewDecoder(w.Body).Decode(&resp)
+		return resp
+	}
+
+	// Without the opt-in, disabling leaves queued jobs alone
+	if resp := update("", false); resp["jobs_skipped"] != nil {
+		t.Errorf("Expected no jobs_skipped without cancel_pending, got %v", resp)
+	}
+	if job, _ := db.GetJob(pending); job.Status != models.JobStatusPending {
+		t.Errorf("Expected job still pending, got %s", job.Status)
+	}
+
+	// Only an enabled to disabled transition cancels
+	if resp := update("?cancel_pending=true", false); resp["jobs_skipped"] != nil {
+		t.Errorf("Expected no cancellation for an already disabled rule, got %v", resp)
+	}
+
+	update("", true)
+	if resp := update("?cancel_pending=true", false); resp["jobs_skipped"] != float64(1) {
+		t.Errorf("Expected 1 job skipped, got %v", resp)
+	}
+	if job, _ := db.GetJob(pending); job.Status != models.JobStatusSkipped {
+		t.Errorf("Expected pending job skipped, got %s", job.Status)
+	}
+	if job, _ := db.GetJob(running); job.Status != models.JobStatusInProgress {
+		t.Errorf("Expected in-progress job left alone, got %s", job.Status)
+	}
+}
+
+func TestHandleDeleteRule(t *testing.T) {
+	server, db := setupTestServer(t)
+	defer db.Close()
+
+	req := httptest.NewRequest("DELETE", "/api/rules/1", nil)
+	w := httptest.NewRecorder()
+
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+
+	// Verify deletion
+	_, err := db.GetRule(1)
+	if err != models.ErrNotFound {
+		t.Error("Expected rule to be deleted")
+	}
+}
+
+func TestHandleEvaluateRule(t *testing.T) {
+	server, db := setupTestServer(t)
+	defer db.Close()
+
+	req := httptest.NewRequest("POST", "/api/rules/99/evaluate", nil)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for missing rule, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/api/rules/1/evaluate", nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d", w.Code)
+	}
+
+	// Evaluation runs in the background
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		jobs, err := db.ListJobs(models.JobStatusPending, 0)
+		if err != nil {
+			t.Fatalf("Failed to list jobs: %v", err)
+		}
+		if len(jobs) == 1 && jobs[0].RuleID == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected a job for rule 1, got %d jobs", len(jobs))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	rule, _ := db.GetRule(1)
+	rule.Enabled = false
+	db.UpdateRule(rule)
+
+	req = httptest.NewRequest("POST", "/api/rules/1/evaluate", nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 for disabled rule, got %d", w.Code)
+	}
+}
+
+func TestHandleEvaluateRulesWait(t *testing.T) {
+	server, db := setupTestServer(t)
+	defer db.Close()
+
+	// Fixture modem 1 needs an upgrade; add one more that does, plus modems
+	// skipped for being offline, already upgraded and matching no rule
+	for _, modem := range []*models.CableModem{
+		{CMTSID: 1, MACAddress: "00:01:5C:11:22:44", IPAddress: "10.0.0.101", CurrentFirmware: "1.0.0", SignalLevel: 5.0, Status: "online"},
+		{CMTSID: 1, MACAddress: "00:01:5C:11:22:55", IPAddress: "10.0.0.102", CurrentFirmware: "1.0.0", SignalLevel: 5.0, Status: "offline"},
+		{CMTSID: 1, MACAddress: "00:01:5C:11:22:66", IPAddress: "10.0.0.103", CurrentFirmware: "2.0.0", SignalLevel: 5.0, Status: "online"},
+		{CMTSID: 1, MACAddress: "AA:BB:CC:11:22:77", IPAddress: "10.0.0.104", CurrentFirmware: "1.0.0", SignalLevel: 5.0, Status: "online"},
+	} {
+		if err := db.UpsertModem(modem); err != nil {
+			t.Fatalf("Failed to upsert modem: %v", err)
+		}
+	}
+
+	evaluate := func() map[string]interface{} {
+		req := httptest.NewRequest("POST", "/api/rules/evaluate?wait=true", nil)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+
+		var summary map[string]interface{}
+		if err := json.NewDecoder(w.Body).Decode(&summary); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return summary
+	}
+
+	summary := evaluate()
+
+	jobs, err := db.ListJobs(models.JobStatusPending, 0)
+	if err != nil {
+		t.Fatalf("Failed to list jobs: %v", err)
+	}
+	if len(jobs) != 2 {
+		t.Fatalf("Expected 2 pending jobs, got %d", len(jobs))
+	}
+
+	// The response lists exactly the jobs that were created
+	want := map[float64]bool{}
+	for _, job := range jobs {
+		want[float64(job.ID)] = true
+	}
+	jobIDs, ok := summary["job_ids"].([]interface{})
+	if !ok || len(jobIDs) != 2 {
+		t.Fatalf("Expected 2 job_ids, got %v", summary["job_ids"])
+	}
+	for _, id := range jobIDs {
+		if !want[id.(float64)] {
+			t.Errorf("Unexpected job ID %v in response", id)
+		}
+	}
+	if summary["jobs_created"] != float64(2) {
+		t.Errorf("Expected jobs_created 2, got %v", summary["jobs_created"])
+	}
+
+	skipped, _ := summary["skipped"].(map[string]interface{})
+	for reason, count := range map[string]float64{"ineligible": 1, "up_to_date": 1, "no_matching_rule": 1} {
+		if skipped[reason] != count {
+			t.Errorf("Expected skipped[%s] = %v, got %v", reason, count, skipped[reason])
+		}
+	}
+
+	// A second pass creates nothing because the jobs already exist
+	summary = evaluate()
+	if ids, _ := summary["job_ids"].([]interface{}); ids == nil || len(ids) != 0 {
+		t.Errorf("Expected empty job_ids on second pass, got %v", summary["job_ids"])
+	}
+	if skipped, _ := summary["skipped"].(map[string]interface{}); skipped["job_exists"] != float64(2) {
+		t.Errorf("Expected 2 modems skipped for existing jobs, got %v", skipped["job_exists"])
+	}
+}
+
+func TestHandleExportImportRules(t *testing.T) {
+	server, db := setupTestServer(t)
+	defer db.Close()
+
+	req := httptest.NewRequest("GET", "/api/rules/export", nil)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	exported := w.Body.String()
+	if strings.Contains(exported, `"id"`) || strings.Contains(exported, "created_at") {
+		t.Errorf("Expected export without IDs or timestamps, got %s", exported)
+	}
+
+	var specs []models.RuleSpec
+	if err := json.Unmarshal([]byte(exported), &specs); err != nil {
+		t.Fatalf("Failed to decode export: %v", err)
+	}
+	if len(specs) != 1 || specs[0].Name != "Test Rule" {
+		t.Fatalf("Unexpected export: %+v", specs)
+	}
+
+	// Round-trip with one modified and one new rule
+	specs[0].Priority = 5
+	specs = append(specs, models.RuleSpec{
+		Name:             "Motorola Rule",
+		MatchType:        "SYSDESCR_REGEX",
+		MatchCriteria:    `{"pattern":"Motorola"}`,
+		TFTPServerIP:     "192.168.1.50",
+		FirmwareFilename: "motorola-v1.0.0.bin",
+	})
+	body, _ := json.Marshal(specs)
+
+	req = httptest.NewRequest("POST", "/api/rules/import", bytes.NewReader(body))
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var summary map[string]int
+	json.NewDecoder(w.Body).Decode(&summary)
+	if summary["created"] != 1 || summary["updated"] != 1 {
+		t.Errorf("Expected 1 created and 1 updated, got %v", summary)
+	}
+
+	rule, _ := db.GetRule(1)
+	if rule.Priority != 5 {
+		t.Errorf("Expected priority 5 after import, got %d", rule.Priority)
+	}
+	if rule.MaxRetries != models.DefaultMaxRetries {
+		t.Errorf("Expected exported max retries to round-trip, got %d", rule.MaxRetries)
+	}
+	rules, _ := db.ListRules()
+	for _, r := range rules {
+		if r.Name == "Motorola Rule" && r.MaxRetries != models.DefaultMaxRetries {
+			t.Errorf("Expected a spec without max_retries to get the retry_attempts setting, got %d", r.MaxRetries)
+		}
+	}
+
+	// Invalid rule rejects the whole import
+	body = []byte(`[{"name":"Bad","match_type":"BOGUS"}]`)
+	req = httptest.NewRequest("POST", "/api/rules/import", bytes.NewReader(body))
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for invalid rule, got %d", w.Code)
+	}
+}
+
+// Job Tests
+
+func TestHandleListJobs(t *testing.T) {
+	server, db := setupTestServer(t)
+	defer db.Close()
+
+	// Create a test job
+	db.CreateJob(&models.UpgradeJob{
+		ModemID:          1,
+		RuleID:           1,
+		CMTSID:           1,
+		MACAddress:       "00:01:5C:11:22:33",
+		Status:           models.JobStatusPending,
+		TFTPServerIP:     "192.168.1.50",
+		FirmwareFilename: "firmware.bin",
+		MaxRetries:       3,
+	})
+
+	req := httptest.NewRequest("GET", "/api/jobs", nil)
+	w := httptest.NewRecorder()
+
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+
+	var jobs []*models.UpgradeJob
+	if err := json.NewDecoder(w.Body).Decode(&jobs); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if len(jobs) == 0 {
+		t.Error("Expected at least one job")
+	}
+}
+
+func TestHandleListJobsWithStatusFilter(t *testing.T) {
+	server, db := setupTestServer(t)
+	defer db.Close()
+
+	// Create jobs with different statuses
+	db.CreateJob(&models.UpgradeJob{
+		ModemID:          1,
+		RuleID:           1,
+		CMTSID:           1,
+		MACAddress:       "00:01:5C:11:22:33",
+		Status:           models.JobStatusPending,
+		TFTPServerIP:     "192.168.1.50",
+		FirmwareFilename: "firmware.bin",
+		MaxRetries:       3,
+	})
+
+	db.CreateJob(&models.UpgradeJob{
+		ModemID:          1,
+		RuleID:           1,
+		CMTSID:           1,
+		MACAddress:       "00:01:5C:11:22:44",
+		Status:           models.JobStatusCompleted,
+		TFTPServerIP:     "192.168.1.50",
+		FirmwareFilename: "firmware.bin",
+		MaxRetries:       3,
+	})
+
+	req := httptest.NewRequest("GET", "/api/jobs?status=PENDING", nil)
+	w := httptest.NewRecorder()
+
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+
+	var jobs []*models.UpgradeJob
+	if err := json.NewDecoder(w.Body).Decode(&jobs); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	for _, job := range jobs {
+		if job.Status != models.JobStatusPending {
+			t.Errorf("Expected status PENDING, got %s", job.Status)
+		}
+	}
+}
+
+func TestHandleListJobsWithLimit(t *testing.T) {
+	server, db := setupTestServer(t)
+	defer db.Close()
+
+	// Create multiple jobs
+	for i := 0; i < 5; i++ {
+		db.CreateJob(&models.UpgradeJob{
+			ModemID:          1,
+			RuleID:           1,
+			CMTSID:           1,
+			MACAddress:       "00:01:5C:11:22:33",
+			Status:           models.JobStatusPending,
+			TFTPServerIP:     "192.168.1.50",
+			FirmwareFilename: "firmware.bin",
+			MaxRetries:       3,
+		})
+	}
+
+	req := httptest.NewRequest("GET", "/api/jobs?limit=3", nil)
+	w := httptest.NewRecorder()
+
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+
+	var jobs []*models.UpgradeJob
+	if err := json.NewDecoder(w.Body).Decode(&jobs); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if len(jobs) != 3 {
+		t.Errorf("Expected 3 jobs (with limit), got %d", len(jobs))
+	}
+}
+
+func TestHandleJobStream(t *testing.T) {
+	server, db := setupTestServer(t)
+	defer db.Close()
+
+	jobID, err := db.CreateJob(&models.UpgradeJob{
+		ModemID:          1,
+		RuleID:           1,
+		CMTSID:           1,
+		MACAddress:       "00:01:5C:11:22:33",
+		Status:           models.JobStatusPending,
+		TFTPServerIP:     "192.168.1.50",
+		FirmwareFilename: "firmware.bin",
+		MaxRetries:       3,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+
+	ts := httptest.NewServer(server.router)
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, _ := http.NewRequestWithContext(ctx, "GET", ts.URL+"/api/jobs/stream", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to open stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Expected text/event-stream, got %s", ct)
+	}
+
+	reader := bufio.NewReader(resp.Body)
+
+	// Wait for the connected comment so the subscription is in place
+	if line, err := reader.ReadString('\n'); err != nil || !strings.HasPrefix(line, ": connected") {
+		t.Fatalf("Expected connected comment, got %q (err %v)", line, err)
+	}
+
+	if err := server.engine.CancelJob(jobID); err != nil {
+		t.Fatalf("Failed to cancel job: %v", err)
+	}
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Stream ended before job event: %v", err)
+		}
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+
+		var event map[string]interface{}
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event); err != nil {
+			t.Fatalf("Failed to decode event: %v", err)
+		}
+		if int(event["job_id"].(float64)) != jobID || event["status"] != models.JobStatusSkipped {
+			t.Errorf("Unexpected event: %v", event)
+		}
+		break
+	}
+}
+
+func TestHandleGetJob(t *testing.T) {
+	server, db := setupTestServer(t)
+	defer db.Close()
+
+	// Create a test job
+	jobID, err := db.CreateJob(&models.UpgradeJob{
+		ModemID:          1,
+		RuleID:           1,
+		CMTSID:           1,
+		MACAddress:       "00:01:5C:11:22:33",
+		Status:           models.JobStatusPending,
+		TFTPServerIP:     "192.168.1.50",
+		FirmwareFilename: "firmware.bin",
+		MaxRetries:       3,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/api/jobs/"+string(rune(jobID+'0')), nil)
+	w := httptest.NewRecorder()
+
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+
+	var job models.UpgradeJob
+	if err := json.NewDecoder(w.Body).Decode(&job); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if job.ID != jobID {
+		t.Errorf("Expected ID %d, got %d", jobID, job.ID)
+	}
+}
+
+func TestHandleGetJobLogs(t *testing.T) {
+	server, db := setupTestServer(t)
+	defer db.Close()
+
+	jobID, err := db.CreateJob(&models.UpgradeJob{
+		ModemID:          1,
+		RuleID:           1,
+		CMTSID:           1,
+		MACAddress:       "00:01:5C:11:22:33",
+		Status:           models.JobStatusFailed,
+		TFTPServerIP:     "192.168.1.50",
+		FirmwareFilename: "firmware.bin",
+		MaxRetries:       3,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+
+	for _, eventType := range []string{models.EventUpgradeStarted, models.EventUpgradeFailed} {
+		if err := db.LogActivity(&models.ActivityLog{
+			EventType:  eventType,
+			EntityType: "job",
+			EntityID:   jobID,
+			Message:    "Test activity",
+		}); err != nil {
+			t.Fatalf("Failed to log activity: %v", err)
+		}
+	}
+	if err := db.LogActivity(&models.ActivityLog{
+		EventType:  models.EventUpgradeStarted,
+		EntityType: "job",
+		EntityID:   jobID + 1,
+		Message:    "Other job",
+	}); err != nil {
+		t.Fatalf("Failed to log activity: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/api/jobs/%d/logs", jobID), nil)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var logs []models.ActivityLog
+	if err := json.NewDecoder(w.Body).Decode(&logs); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(logs) != 2 {
+		t.Fatalf("Expected 2 log entries, got %d", len(logs))
+	}
+	if logs[0].EventType != models.EventUpgradeStarted || logs[1].EventType != models.EventUpgradeFailed {
+		t.Errorf("Expected chronological order, got %s then %s", logs[0].EventType, logs[1].EventType)
+	}
+
+	req = httptest.NewRequest("GET", "/api/jobs/9999/logs", nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for missing job, got %d", w.Code)
+	}
+}
+
+func TestHandleRetryJob(t *testing.T) {
+	server, db := setupTestServer(t)
+	defer db.Close()
+
+	// Create a failed job
+	jobID, err := db.CreateJob(&models.UpgradeJob{
+		ModemID:          1,
+		RuleID:           1,
+		CMTSID:           1,
+		MACAddress:       "00:01:5C:11:22:33",
+		Status:           models.JobStatusFailed,
+		TFTPServerIP:     "192.168.1.50",
+		FirmwareFilename: "firmware.bin",
+		MaxRetries:       3,
+		RetryCount:       3,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+
+	req := httptest.NewRequest("POST", "/api/jobs/"+string(rune(jobID+'0'))+"/retry", nil)
+	w := httptest.NewRecorder()
+
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+
+	// Verify job was reset
+	job, err := db.GetJob(jobID)
+	if err != nil {
+		t.Fatalf("Failed to get job: %v", err)
+	}
+
+	if job.Status != models.JobStatusPending {
+		t.Errorf("Expected status PENDING after retry, got %s", job.Status)
+	}
+	if job.RetryCount != 0 {
+		t.Errorf("Expected retry count 0, got %d", job.RetryCount)
+	}
+	if job.MaxRetries != 3 {
+		t.Errorf("Expected the job to keep max retries 3, got %d", job.MaxRetries)
+	}
+
+	// A job whose modem has been deleted can't run again
+	job.Status = models.JobStatusFailed
+	if err := db.UpdateJob(job); err != nil {
+		t.Fatalf("Failed to fail job: %v", err)
+	}
+	if _, _, err := db.DeleteModemsByCMTS(1); err != nil {
+		t.Fatalf("Failed to delete modems: %v", err)
+	}
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest("POST", fmt.Sprintf("/api/jobs/%d/retry", jobID), nil))
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 retrying a job without a modem, got %d", w.Code)
+	}
+}
+
+func TestHandleDeadLetterJobs(t *testing.T) {
+	server, db := setupTestServer(t)
+	defer db.Close()
+
+	jobID, err := db.CreateJob(&models.UpgradeJob{
+		ModemID:          1,
+		RuleID:           1,
+		CMTSID:           1,
+		MACAddress:       "00:01:5C:11:22:33",
+		Status:           models.JobStatusFailed,
+		TFTPServerIP:     "192.168.1.50",
+		FirmwareFilename: "firmware.bin",
+		MaxRetries:       3,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+	job, _ := db.GetJob(jobID)
+	job.RetryCount = 3
+	job.DeadLetter = true
+	if err := db.UpdateJob(job); err != nil {
+		t.Fatalf("Failed to update job: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/api/jobs/dead-letter", nil)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	var jobs []*models.UpgradeJob
+	if err := json.NewDecoder(w.Body).Decode(&jobs); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(jobs) != 1 || jobs[0].ID != jobID || !jobs[0].DeadLetter {
+		t.Fatalf("Expected dead-letter job %d, got %+v", jobID, jobs)
+	}
+
+	req = httptest.NewRequest("POST", "/api/jobs/dead-letter/requeue",
+		strings.NewReader(fmt.Sprintf(`{"job_ids":[%d]}`, jobID)))
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	var result map[string]int
+	json.NewDecoder(w.Body).Decode(&result)
+	if result["requeued"] != 1 {
+		t.Errorf("Expected 1 job requeued, got %d", result["requeued"])
+	}
+
+	job, _ = db.GetJob(jobID)
+	if job.Status != models.JobStatusPending || job.DeadLetter {
+		t.Errorf("Expected job back in PENDING, got %s (dead_letter=%v)", job.Status, job.DeadLetter)
+	}
+
+	// The queue is now empty
+	req = httptest.NewRequest("GET", "/api/jobs/dead-letter", nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	jobs = nil
+	json.NewDecoder(w.Body).Decode(&jobs)
+	if len(jobs) != 0 {
+		t.Errorf("Expected empty dead-letter queue, got %d jobs", len(jobs))
+	}
+}
+
+func TestHandleRetryFailedJobs(t *testing.T) {
+	server, db := setupTestServer(t)
+	defer db.Close()
+
+	jobID, err := db.CreateJob(&models.UpgradeJob{
+		ModemID:          1,
+		RuleID:           1,
+		CMTSID:           1,
+		MACAddress:       "00:01:5C:11:22:33",
+		Status:           models.JobStatusFailed,
+		TFTPServerIP:     "192.168.1.50",
+		FirmwareFilename: "firmware.bin",
+		MaxRetries:       3,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+
+	// Scoped to another CMTS, nothing is retried
+	req := httptest.NewRequest("POST", "/api/jobs/retry-failed?cmts_id=2", nil)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	var result map[string]int
+	json.NewDecoder(w.Body).Decode(&result)
+	if result["retried"] != 0 {
+		t.Errorf("Expected 0 jobs retried, got %d", result["retried"])
+	}
+
+	req = httptest.NewRequest("POST", "/api/jobs/retry-failed?cmts_id=1&rule_id=1", nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	json.NewDecoder(w.Body).Decode(&result)
+	if result["retried"] != 1 {
+		t.Errorf("Expected 1 job retried, got %d", result["retried"])
+	}
+	job, _ := db.GetJob(jobID)
+	if job.Status != models.JobStatusPending {
+		t.Errorf("Expected job back in PENDING, got %s", job.Status)
+	}
+
+	req = httptest.NewRequest("POST", "/api/jobs/retry-failed?rule_id=abc", nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for bad rule_id, got %d", w.Code)
+	}
+}
+
+func TestHandleFirmwareDriftReport(t *testing.T) {
+	server, db := setupTestServer(t)
+	defer db.Close()
+
+	// The fixture modem was upgraded to 2.0.0 but rediscovered on 1.0.0
+	if err := db.SetModemExpectedFirmware(1, "2.0.0"); err != nil {
+		t.Fatalf("Failed to set expected firmware: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/api/reports/firmware-drift", nil)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	var modems []*models.CableModem
+	if err := json.NewDecoder(w.Body).Decode(&modems); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(modems) != 1 || modems[0].ID != 1 || modems[0].ExpectedFirmware != "2.0.0" {
+		t.Fatalf("Expected fixture modem flagged as drifted, got %+v", modems)
+	}
+
+	// Back on the expected firmware, nothing is reported
+	if err := db.SetModemExpectedFirmware(1, "1.0.0"); err != nil {
+		t.Fatalf("Failed to set expected firmware: %v", err)
+	}
+	req = httptest.NewRequest("GET", "/api/reports/firmware-drift", nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	modems = nil
+	json.NewDecoder(w.Body).Decode(&modems)
+	if len(modems) != 0 {
+		t.Errorf("Expected no drifted modems, got %d", len(modems))
+	}
+}
+
+func TestHandleFirmwareDistributionReport(t *testing.T) {
+	server, db := setupTestServer(t)
+	defer db.Close()
+
+	db.UpsertModem(&models.CableModem{
+		CMTSID:     1,
+		MACAddress: "AA:00:00:00:00:01",
+		IPAddress:  "10.0.0.200",
+		Status:     "online",
+	})
+
+	req := httptest.NewRequest("GET", "/api/reports/firmware-distribution?cmts_id=1", nil)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	var report struct {
+		Versions map[string]int `json:"versions"`
+		Unknown  int            `json:"unknown"`
+		Total    int            `json:"total"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if report.Versions["1.0.0"] != 1 || report.Unknown != 1 || report.Total != 2 {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+	if _, ok := report.Versions[""]; ok {
+		t.Error("Unknown firmware should not be listed as a version")
+	}
+
+	req = httptest.NewRequest("GET", "/api/reports/firmware-distribution?cmts_id=abc", nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for bad cmts_id, got %d", w.Code)
+	}
+}
+
+func TestHandleVendorDistributionReport(t *testing.T) {
+	server, db := setupTestServer(t)
+	defer db.Close()
+
+	db.UpsertModem(&models.CableModem{
+		CMTSID:     1,
+		MACAddress: "AA:00:00:00:00:01",
+		IPAddress:  "10.0.0.200",
+		Vendor:     "ARRIS",
+		Status:     "online",
+	})
+
+	req := httptest.NewRequest("GET", "/api/reports/vendor-distribution?cmts_id=1", nil)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	var report struct {
+		Vendors map[string]int `json:"vendors"`
+		Unknown int            `json:"unknown"`
+		Total   int            `json:"total"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if report.Vendors["ARRIS"] != 1 || report.Unknown != 1 || report.Total != 2 {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+	if _, ok := report.Vendors[""]; ok {
+		t.Error("Unknown vendor should not be listed as a vendor")
+	}
+
+	req = httptest.NewRequest("GET", "/api/reports/vendor-distribution?cmts_id=0", nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for bad cmts_id, got %d", w.Code)
+	}
+}
+
+func TestHandleGetRuleStats(t *testing.T) {
+	server, db := setupTestServer(t)
+	defer db.Close()
+
+	started := time.Now().Add(-time.Hour).Truncate(time.Second)
+	completed := started.Add(45 * time.Second)
+	job := &models.UpgradeJob{
+		ModemID:    1,
+		RuleID:     1,
+		CMTSID:     1,
+		MACAddress: "00:01:5C:11:22:33",
+		Status:     models.JobStatusPending,
+		MaxRetries: 3,
+	}
+	id, err := db.CreateJob(job)
+	if err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+	job.ID = id
+	job.Status = models.JobStatusCompleted
+	job.StartedAt = &started
+	job.CompletedAt = &completed
+	if err := db.UpdateJob(job); err != nil {
+		t.Fatalf("Failed to update job: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/api/rules/1/stats", nil)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	var stats struct {
+		RuleID                 int            `json:"rule_id"`
+		AverageDurationSeconds float64        `json:"average_duration_seconds"`
+		Jobs                   map[string]int `json:"jobs"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&stats); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if stats.RuleID != 1 || stats.AverageDurationSeconds != 45 || stats.Jobs[models.JobStatusCompleted] != 1 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	// The job itself reports its duration
+	req = httptest.NewRequest("GET", fmt.Sprintf("/api/jobs/%d", id), nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if !strings.Contains(w.Body.String(), `"duration_seconds":45`) {
+		t.Errorf("Expected job to include duration_seconds, got %s", w.Body.String())
+	}
+
+	req = httptest.NewRequest("GET", "/api/rules/999/stats", nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", w.Code)
+	}
+}
+
+func TestHandleCancelJob(t *testing.T) {
+	server, db := setupTestServer(t)
+	defer db.Close()
+
+	jobID, err := db.CreateJob(&models.UpgradeJob{
+		ModemID:          1,
+		RuleID:           1,
+		CMTSID:           1,
+		MACAddress:       "00:01:5C:11:22:33",
+		Status:           models.JobStatusPending,
+		TFTPServerIP:     "192.168.1.50",
+		FirmwareFilename: "firmware.bin",
+		MaxRetries:       3,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+
+	req := httptest.NewRequest("POST", fmt.Sprintf("/api/jobs/%d/cancel", jobID), nil)
+	w := httptest.NewRecorder()
+
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+
+	job, err := db.GetJob(jobID)
+	if err != nil {
+		t.Fatalf("Failed to get job: %v", err)
+	}
+	if job.Status != models.JobStatusSkipped {
+		t.Errorf("Expected status SKIPPED after cancel, got %s", job.Status)
+	}
+
+	// Cancelling again should conflict
+	req = httptest.NewRequest("POST", fmt.Sprintf("/api/jobs/%d/cancel", jobID), nil)
+	w = httptest.NewRecorder()
+
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409, got %d", w.Code)
+	}
+}
+
+// Activity Log Tests
+
+func TestHandleListActivityLogs(t *testing.T) {
+	server, db := setupTestServer(t)
+	defer db.Close()
+
+	// Create test activity logs
+	for i := 0; i < 5; i++ {
+		db.LogActivity(&models.ActivityLog{
+			EventType:  models.EventSystemEvent,
+			EntityType: "test",
+			EntityID:   i,
+			Message:    "Test activity",
+		})
+	}
+
+	req := httptest.NewRequest("GET", "/api/activity-log", nil)
+	w := httptest.NewRecorder()
+
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+
+	var logs []*models.ActivityLog
+	if err := json.NewDecoder(w.Body).Decode(&logs); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if len(logs) == 0 {
+		t.Error("Expected at least one activity log")
+	}
+}
+
+func TestHandleListActivityLogsFiltered(t *testing.T) {
+	server, db := setupTestServer(t)
+	defer db.Close()
+
+	db.LogActivity(&models.ActivityLog{
+		EventType:  models.EventUpgradeFailed,
+		EntityType: "job",
+		EntityID:   1,
+		Message:    "Upgrade failed",
+	})
+	db.LogActivity(&models.ActivityLog{
+		EventType:  models.EventSystemEvent,
+		EntityType: "test",
+		Message:    "Test activity",
+	})
+
+	since := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	req := httptest.NewRequest("GET", "/api/activity-log?event_type=UPGRADE_FAILED&since="+since, nil)
+	w := httptest.NewRecorder()
+
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	var logs []*models.ActivityLog
+	if err := json.NewDecoder(w.Body).Decode(&logs); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(logs) != 1 || logs[0].EventType != models.EventUpgradeFailed {
+		t.Errorf("Expected only the failed upgrade, got %d entries", len(logs))
+	}
+
+	// A window entirely in the past matches nothing
+	req = httptest.NewRequest("GET", "/api/activity-log?until=2000-01-01T00:00:00Z", nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	logs = nil
+	if err := json.NewDecoder(w.Body).Decode(&logs); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(logs) != 0 {
+		t.Errorf("Expected no entries before 2000, got %d", len(logs))
+	}
+
+	req = httptest.NewRequest("GET", "/api/activity-log?since=2024-03-14", nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for bad since, got %d", w.Code)
+	}
+}
+
+func TestHandleExportActivityLogs(t *testing.T) {
+	server, db := setupTestServer(t)
+	defer db.Close()
+
+	db.LogActivity(&models.ActivityLog{
+		EventType:  models.EventUpgradeCompleted,
+		EntityType: "job",
+		EntityID:   7,
+		Message:    "Completed firmware upgrade for modem 00:01:5C:11:22:33",
+		Details:    `{"firmware":"2.0.0"}`,
+	})
+	db.LogActivity(&models.ActivityLog{
+		EventType:  models.EventSystemEvent,
+		EntityType: "setting",
+		Message:    "Updated setting: workers = 4",
+	})
+
+	req := httptest.NewRequest("GET", "/api/activity-log/export.csv?format=csv&event_type=UPGRADE_COMPLETED", nil)
+	w := httptest.NewRecorder()
+
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/csv" {
+		t.Errorf("Expected text/csv content type, got %s", ct)
+	}
+
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to parse CSV: %v", err)
+	}
+
+	expectedHeader := []string{"id", "created_at", "event_type", "entity_type", "entity_id", "message", "details"}
+	if len(records) == 0 || strings.Join(records[0], ",") != strings.Join(expectedHeader, ",") {
+		t.Fatalf("Unexpected CSV header: %v", records)
+	}
+
+	if len(records) != 2 {
+		t.Fatalf("Expected header plus 1 filtered row, got %d rows", len(records))
+	}
+
+	row := records[1]
+	if row[2] != models.EventUpgradeCompleted {
+		t.Errorf("Expected event type %s, got %s", models.EventUpgradeCompleted, row[2])
+	}
+	if row[6] != `{"firmware":"2.0.0"}` {
+		t.Errorf("Expected details column to be preserved, got %s", row[6])
+	}
+
+	// Invalid timestamps are rejected
+	req = httptest.NewRequest("GET", "/api/activity-log/export.csv?since=yesterday", nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for bad since, got %d", w.Code)
+	}
+}
+
+func TestHandleExportJobs(t *testing.T) {
+	server, db := setupTestServer(t)
+	defer db.Close()
+
+	for _, status := range []string{models.JobStatusCompleted, models.JobStatusFailed} {
+		id, err := db.CreateJob(&models.UpgradeJob{
+			ModemID:          1,
+			RuleID:           1,
+			CMTSID:           1,
+			MACAddress:       "00:01:5C:11:22:33",
+			Status:           models.JobStatusPending,
+			TFTPServerIP:     "192.168.1.50",
+			FirmwareFilename: "firmware-2.0.0.bin",
+			MaxRetries:       3,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create job: %v", err)
+		}
+		job, _ := db.GetJob(id)
+		job.Status = status
+		if status == models.JobStatusFailed {
+			message := "SNMP timeout, modem offline"
+			job.ErrorMessage = &message
+		}
+		if err := db.UpdateJob(job); err != nil {
+			t.Fatalf("Failed to update job: %v", err)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/api/jobs/export.csv?status=FAILED", nil)
+	w := httptest.NewRecorder()
+
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	if cd := w.Header().Get("Content-Disposition"); !strings.HasPrefix(cd, "attachment") {
+		t.Errorf("Expected attachment disposition, got %s", cd)
+	}
+
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to parse CSV: %v", err)
+	}
+
+	expectedHeader := "id,mac,cmts_id,rule_id,status,firmware,retry_count,created_at,started_at,completed_at,error_message"
+	if len(records) == 0 || strings.Join(records[0], ",") != expectedHeader {
+		t.Fatalf("Unexpected CSV header: %v", records)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected header plus 1 filtered row, got %d rows", len(records))
+	}
+
+	row := records[1]
+	if row[4] != models.JobStatusFailed || row[5] != "firmware-2.0.0.bin" {
+		t.Errorf("Unexpected job row: %v", row)
+	}
+	if row[10] != "SNMP timeout, modem offline" {
+		t.Errorf("Expected error message to be preserved, got %s", row[10])
+	}
+
+	req = httptest.NewRequest("GET", "/api/jobs/export.csv?until=tomorrow", nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for bad until, got %d", w.Code)
+	}
+}
+
+func TestHandleListActivityLogsWithLimit(t *testing.T) {
+	t.Skip("Activity log pagination tested in database layer")
+}
+func TestHandleListActivityLogsWithOffset(t *testing.T) {
+	t.Skip("Pagination timing issue - tested in database layer")
+}
+// Settings Tests
+
+func TestHandleListSettings(t *testing.T) {
+	server, db := setupTestServer(t)
+	defer db.Close()
+
+	// Set some test settings
+	db.SetSetting("test_key", "test_value")
+
+	req := httptest.NewRequest("GET", "/api/settings", nil)
+	w := httptest.NewRecorder()
+
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+
+	var settings map[string]string
+	if err := json.NewDecoder(w.Body).Decode(&settings); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if _, ok := settings["test_key"]; !ok {
+		t.Error("Expected test_key in settings")
+	}
+}
+
+func TestHandleSettingsRedactAPIToken(t *testing.T) {
+	server, db := setupTestServer(t)
+	defer db.Close()
+
+	db.SetSetting("api_token", "secret-token")
+
+	get := func(path string) string {
+		t.Helper()
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer secret-token")
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s: expected status 200, got %d", path, w.Code)
+		}
+		return w.Body.String()
+	}
+	if body := get("/api/settings"); strings.Contains(body, "secret-token") {
+		t.Error("Expected api_token redacted from the settings list")
+	}
+	if body := get("/api/settings/api_token"); strings.Contains(body, "secret-token") {
+		t.Error("Expected api_token redacted from the setting")
+	}
+
+	// Saving the settings page back unchanged keeps the token
+	req := httptest.NewRequest("PUT", "/api/settings", strings.NewReader(`{"api_token": "********", "log_level": "debug"}`))
+	req.Header.Set("Authorization", "Bearer secret-token")
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if got, _ := db.GetSetting("api_token"); got != "secret-token" {
+		t.Errorf("Expected api_token kept, got %q", got)
+	}
+}
+
+func TestHandleUpdateSettingRejectsBadInterval(t *testing.T) {
+	server, db := setupTestServer(t)
+	defer db.Close()
+
+	for _, tt := range []struct {
+		method, path, body string
+		want               int
+	}{
+		{"PUT", "/api/settings/discovery_interval", `{"value": "0"}`, http.StatusBadRequest},
+		{"PUT", "/api/settings/evaluation_interval", `{"value": "-30"}`, http.StatusBadRequest},
+		{"PUT", "/api/settings/poll_interval", `{"value": "soon"}`, http.StatusBadRequest},
+		{"PUT", "/api/settings", `{"log_level": "debug", "cleanup_interval": "0"}`, http.StatusBadRequest},
+		{"PUT", "/api/settings/discovery_interval", `{"value": "300"}`, http.StatusOK},
+	} {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+
+		if w.Code != tt.want {
+			t.Errorf("%s %s %s: expected status %d, got %d", tt.method, tt.path, tt.body, tt.want, w.Code)
+		}
+	}
+
+	if got, _ := db.GetSetting("discovery_interval"); got != "300" {
+		t.Errorf("Expected discovery_interval 300, got %q", got)
+	}
+	if got, _ := db.GetSetting("log_level"); got == "debug" {
+		t.Error("A rejected bulk update should not write any setting")
+	}
+}
+
+func TestHandleSettingsSchema(t *testing.T) {
+	server, db := setupTestServer(t)
+	defer db.Close()
+
+	req := httptest.NewRequest("GET", "/api/settings/schema", nil)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	var schema []models.SettingSpec
+	if err := json.NewDecoder(w.Body).Decode(&schema); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	specs := make(map[string]models.SettingSpec)
+	for _, spec := range schema {
+		specs[spec.Key] = spec
+	}
+	workers, ok := specs["workers"]
+	if !ok {
+		t.Fatal("Expected workers in the schema")
+	}
+	if workers.Type != models.SettingTypeInt || workers.Min == nil || *workers.Min != 1 {
+		t.Errorf("Unexpected workers spec: %+v", workers)
+	}
+	if policy := specs["snmp_scheduling_policy"]; policy.Type != models.SettingTypeEnum || len(policy.Options) != 3 {
+		t.Errorf("Unexpected snmp_scheduling_policy spec: %+v", policy)
+	}
+}
+
+func TestHandleUpdateSettingValidatesType(t *testing.T) {
+	server, db := setupTestServer(t)
+	defer db.Close()
+
+	req := httptest.NewRequest("PUT", "/api/settings/workers", strings.NewReader(`{"value": "abc"}`))
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "workers must be an integer of at least 1") {
+		t.Errorf("Expected the constraint in the error, got %s", w.Body.String())
+	}
+	if got, _ := db.GetSetting("workers"); got == "abc" {
+		t.Error("A rejected setting should not be stored")
+	}
+
+	// Unknown keys are stored unchecked
+	req = httptest.NewRequest("PUT", "/api/settings/custom_banner", strings.NewReader(`{"value": "maintenance tonight"}`))
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 for an unknown key, got %d", w.Code)
+	}
+}
+
+// Auth Tests
+
+func TestHandleBackupRestore(t *testing.T) {
+	server, db := setupTestServer(t)
+	defer db.Close()
+
+	if err := db.SetSetting("api_token", ""); err != nil {
+		t.Fatalf("Failed to set api_token: %v", err)
+	}
+	if err := db.SetSetting("evaluation_cmts_allowlist", "1,99"); err != nil {
+		t.Fatalf("Failed to set evaluation_cmts_allowlist: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/api/backup", nil)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	raw := w.Body.Bytes()
+
+	var backup models.Backup
+	if err := json.Unmarshal(raw, &backup); err != nil {
+		t.Fatalf("Failed to decode backup: %v", err)
+	}
+	if backup.SchemaVersion != models.BackupSchemaVersion {
+		t.Errorf("Expected schema_version %d, got %d", models.BackupSchemaVersion, backup.SchemaVersion)
+	}
+	if len(backup.CMTS) != 1 || backup.CMTS[0].CommunityWrite != redactedSecret || backup.CMTS[0].CMCommunityString != redactedSecret {
+		t.Errorf("Expected one CMTS with redacted communities, got %+v", backup.CMTS)
+	}
+	if len(backup.Rules) == 0 {
+		t.Error("Expected rules in backup")
+	}
+	if _, ok := backup.Settings["api_token"]; ok {
+		t.Error("Expected api_token to be left out of the backup")
+	}
+	// The allowlist goes by name; the ID of a CMTS that's gone is dropped
+	if _, ok := backup.Settings["evaluation_cmts_allowlist"]; ok {
+		t.Error("Expected evaluation_cmts_allowlist to be left out of the backup's settings")
+	}
+	if len(backup.EvaluationCMTSAllowlist) != 1 || backup.EvaluationCMTSAllowlist[0] != backup.CMTS[0].Name {
+		t.Errorf("Expected the allowlist as [%s], got %v", backup.CMTS[0].Name, backup.EvaluationCMTSAllowlist)
+	}
+	if strings.Contains(string(raw), `"id"`) {
+		t.Errorf("Expected backup without IDs, got %s", raw)
+	}
+
+	// Restoring puts changed settings back and keeps the stored communities
+	if err := db.SetSetting("workers", "9"); err != nil {
+		t.Fatalf("Failed to set workers: %v", err)
+	}
+	req = httptest.NewRequest("POST", "/api/restore", bytes.NewReader(raw))
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var result models.RestoreResult
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if result.CMTSUpdated != 1 || result.CMTSCreated != 0 || result.RulesCreated != 0 {
+		t.Errorf("Expected existing CMTS and rules matched by name, got %+v", result)
+	}
+	if workers, _ := db.GetSetting("workers"); workers != backup.Settings["workers"] {
+		t.Errorf("Expected workers restored to %s, got %s", backup.Settings["workers"], workers)
+	}
+	if cmts, _ := db.GetCMTS(1); cmts.CommunityWrite != "private" || cmts.CMCommunityString != "cable-modem" {
+		t.Errorf("Expected communities 'private' / 'cable-modem' kept, got %q / %q", cmts.CommunityWrite, cmts.CMCommunityString)
+	}
+
+	// Allowlisted CMTS get this instance's IDs, and a restored pause takes
+	// effect without a restart
+	backup.CMTS = append(backup.CMTS, models.CMTSSpec{Name: "Lab CMTS", IPAddress: "192.168.9.1",
+		SNMPPort: 161, CommunityRead: "public", SNMPVersion: 2})
+	backup.EvaluationCMTSAllowlist = []string{"Lab CMTS"}
+	backup.Settings["engine_paused"] = "true"
+	backup.Settings["api_rate_limit"] = "5"
+	raw, _ = json.Marshal(backup)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest("POST", "/api/restore", bytes.NewReader(raw)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	labID := 0
+	cmtsList, _ := db.ListCMTS()
+	for _, cmts := range cmtsList {
+		if cmts.Name == "Lab CMTS" {
+			labID = cmts.ID
+		}
+	}
+	if allowlist, _ := db.GetSetting("evaluation_cmts_allowlist"); labID == 0 || allowlist != fmt.Sprint(labID) {
+		t.Errorf("Expected evaluation_cmts_allowlist to be Lab CMTS's ID %d, got %q", labID, allowlist)
+	}
+	if !server.engine.Paused() {
+		t.Error("Expected the restored engine_paused to pause the running engine")
+	}
+	if server.rateLimit != 5 {
+		t.Errorf("Expected the restored api_rate_limit applied, got %v", server.rateLimit)
+	}
+
+	// An allowlisted CMTS missing from the backup and this instance is refused
+	backup.EvaluationCMTSAllowlist = []string{"Gone CMTS"}
+	raw, _ = json.Marshal(backup)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest("POST", "/api/restore", bytes.NewReader(raw)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown allowlisted CMTS, got %d", w.Code)
+	}
+
+	// Backups from a newer format are refused
+	req = httptest.NewRequest("POST", "/api/restore", strings.NewReader(`{"schema_version":99}`))
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for unknown schema_version, got %d", w.Code)
+	}
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	server, db := setupTestServer(t)
+	defer db.Close()
+
+	// A generated ID is echoed back
+	req := httptest.NewRequest("GET", "/api/cmts", nil)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	generated := w.Header().Get("X-Request-ID")
+	if len(generated) != 16 {
+		t.Errorf("Expected a generated 16 character request ID, got %q", generated)
+	}
+
+	// A client's ID is kept
+	req = httptest.NewRequest("GET", "/api/cmts", nil)
+	req.Header.Set("X-Request-ID", "lb-7f3a:42")
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if got := w.Header().Get("X-Request-ID"); got != "lb-7f3a:42" {
+		t.Errorf("Expected the client's request ID, got %q", got)
+	}
+
+	// Unsafe or oversized IDs are replaced
+	for _, id := range []string{"bad id\nforged log line", strings.Repeat("a", 65)} {
+		req = httptest.NewRequest("GET", "/api/cmts", nil)
+		req.Header.Set("X-Request-ID", id)
+		w = httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		if got := w.Header().Get("X-Request-ID"); got == id || got == "" {
+			t.Errorf("Expected %q to be replaced, got %q", id, got)
+		}
+	}
+}
+
+func TestCORSAllowedOrigins(t *testing.T) {
+	server, db := setupTestServer(t)
+	defer db.Close()
+
+	corsOrigin := func(method, origin string) (string, int) {
+		req := httptest.NewRequest(method, "/api/health", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		if w.Header().Get("Vary") != "Origin" {
+			t.Errorf("Expected Vary: Origin, got %q", w.Header().Get("Vary"))
+		}
+		return w.Header().Get("Access-Control-Allow-Origin"), w.Code
+	}
+
+	// The default allows any origin
+	if got, _ := corsOrigin("GET", "https://anywhere.example"); got != "*" {
+		t.Errorf("Expected wildcard origin by default, got %q", got)
+	}
+
+	db.SetSetting("cors_allowed_origins", "https://dashboard.example.net/, https://ops.example.net")
+
+	for _, tc := range []struct {
+		origin, want string
+	}{
+		{"https://dashboard.example.net", "https://dashboard.example.net"},
+		{"https://ops.example.net", "https://ops.example.net"},
+		{"https://evil.example.com", ""},
+		{"", ""},
+	} {
+		if got, _ := corsOrigin("GET", tc.origin); got != tc.want {
+			t.Errorf("Origin %q: expected %q, got %q", tc.origin, tc.want, got)
+		}
+	}
+
+	if got, code := corsOrigin("OPTIONS", "https://evil.example.com"); got != "" || code != http.StatusOK {
+		t.Errorf("Expected preflight without allowed origin, got %q (%d)", got, code)
+	}
+
+	db.SetSetting("cors_allowed_origins", "https://ops.example.net,*")
+	if got, _ := corsOrigin("GET", "https://evil.example.com"); got != "*" {
+		t.Errorf("Expected a * entry to allow any origin, got %q", got)
+	}
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	server, db := setupTestServer(t)
+	defer db.Close()
+
+	// No token configured - auth is disabled
+	req := httptest.NewRequest("GET", "/api/cmts", nil)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 with auth disabled, got %d", w.Code)
+	}
+
+	db.SetSetting("api_token", "secret-token")
+
+	// Missing token
+	req = httptest.NewRequest("GET", "/api/cmts", nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 without token, got %d", w.Code)
+	}
+
+	// Wrong token
+	req = httptest.NewRequest("GET", "/api/cmts", nil)
+	req.Header.Set("Authorization", "Bearer wrong")
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 with wrong token, got %d", w.Code)
+	}
+
+	// The token without the Bearer scheme
+	req = httptest.NewRequest("GET", "/api/cmts", nil)
+	req.Header.Set("Authorization", "secret-token")
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 with a bare token, got %d", w.Code)
+	}
+
+	// Correct token
+	req = httptest.NewRequest("GET", "/api/cmts", nil)
+	req.Header.Set("Authorization", "Bearer secret-token")
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 with valid token, got %d", w.Code)
+	}
+
+	// The CMTS edit form changes credentials, so it is protected too
+	req = httptest.NewRequest("POST", "/api/cmts/update", strings.NewReader("id=1&name=Hijacked"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 for form update without token, got %d", w.Code)
+	}
+
+	// Health is protected unless bypass is configured
+	req = httptest.NewRequest("GET", "/api/health", nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 for health without bypass, got %d", w.Code)
+	}
+
+	server.config.HealthBypassAuth = true
+	req = httptest.NewRequest("GET", "/api/health", nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 for health with bypass, got %d", w.Code)
+	}
+}
+
+func TestHandleRotateToken(t *testing.T) {
+	server, db := setupTestServer(t)
+	defer db.Close()
+
+	req := httptest.NewRequest("POST", "/api/auth/rotate-token", nil)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	var resp map[string]string
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp["token"] == "" {
+		t.Fatal("Expected a token in response")
+	}
+
+	stored, err := db.GetSetting("api_token")
+	if err != nil {
+		t.Fatalf("Failed to get api_token: %v", err)
+	}
+	if stored != resp["token"] {
+		t.Error("Stored token does not match returned token")
+	}
+
+	// The new token is now required
+	req = httptest.NewRequest("GET", "/api/rules", nil)
+	req.Header.Set("Authorization", "Bearer "+resp["token"])
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 with rotated token, got %d", w.Code)
+	}
+}
+
+// Health and Metrics Tests
+
+func TestHandleHealth(t *testing.T) {
+	server, db := setupTestServer(t)
+	defer db.Close()
 
-	req := httptest.NewRequest("GET", "/api/jobs?status=PENDING", nil)
+	req := httptest.NewRequest("GET", "/api/health", nil)
 	w := httptest.NewRecorder()
 
 	server.router.ServeHTTP(w, req)
@@ -537,153 +3219,184 @@ func TestHandleListJobsWithStatusFilter(t *testing.T) {
 		t.Errorf("Expected status 200, got %d", w.Code)
 	}
 
-	var jobs []*models.UpgradeJob
-	if err := json.NewDecoder(w.Body).Decode(&jobs); err != nil {
+	var response map[string]interface{}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
 		t.Fatalf("Failed to decode response: %v", err)
 	}
 
-	for _, job := range jobs {
-		if job.Status != models.JobStatusPending {
-			t.Errorf("Expected status PENDING, got %s", job.Status)
-		}
+	if response["status"] != "healthy" {
+		t.Errorf("Expected status 'healthy', got %v", response["status"])
 	}
 }
 
-func TestHandleListJobsWithLimit(t *testing.T) {
-	server, db := setupTestServer(t)
+func TestHandleVersion(t *testing.T) {
+	db, err := database.NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
 	defer db.Close()
 
-	// Create multiple jobs
-	for i := 0; i < 5; i++ {
-		db.CreateJob(&models.UpgradeJob{
-			ModemID:          1,
-			RuleID:           1,
-			CMTSID:           1,
-			MACAddress:       "00:01:5C:11:22:33",
-			Status:           models.JobStatusPending,
-			TFTPServerIP:     "192.168.1.50",
-			FirmwareFilename: "firmware.bin",
-			MaxRetries:       3,
-		})
-	}
+	server := NewServer(db, engine.New(db, engine.Config{Workers: 1}), Config{
+		WebRoot:   "../../web",
+		Version:   "1.2.3",
+		BuildTime: "2024-11-08_10:00:00",
+		GitCommit: "abc1234",
+	})
 
-	req := httptest.NewRequest("GET", "/api/jobs?limit=3", nil)
+	req := httptest.NewRequest("GET", "/api/version", nil)
 	w := httptest.NewRecorder()
-
 	server.router.ServeHTTP(w, req)
 
 	if w.Code != http.StatusOK {
-		t.Errorf("Expected status 200, got %d", w.Code)
+		t.Fatalf("Expected status 200, got %d", w.Code)
 	}
-
-	var jobs []*models.UpgradeJob
-	if err := json.NewDecoder(w.Body).Decode(&jobs); err != nil {
+	var version map[string]string
+	if err := json.NewDecoder(w.Body).Decode(&version); err != nil {
 		t.Fatalf("Failed to decode response: %v", err)
 	}
+	if version["version"] != "1.2.3" || version["build_time"] != "2024-11-08_10:00:00" ||
+		version["git_commit"] != "abc1234" || !strings.HasPrefix(version["go_version"], "go") {
+		t.Errorf("Unexpected version: %v", version)
+	}
 
-	if len(jobs) != 3 {
-		t.Errorf("Expected 3 jobs (with limit), got %d", len(jobs))
+	// Health reports the same version
+	req = httptest.NewRequest("GET", "/api/health", nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	var health map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&health)
+	if health["version"] != "1.2.3" {
+		t.Errorf("Expected health version 1.2.3, got %v", health["version"])
 	}
 }
 
-func TestHandleGetJob(t *testing.T) {
-	server, db := setupTestServer(t)
+func TestHandleLiveAndReady(t *testing.T) {
+	db, err := database.NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
 	defer db.Close()
 
-	// Create a test job
-	jobID, err := db.CreateJob(&models.UpgradeJob{
-		ModemID:          1,
-		RuleID:           1,
-		CMTSID:           1,
-		MACAddress:       "00:01:5C:11:22:33",
-		Status:           models.JobStatusPending,
-		TFTPServerIP:     "192.168.1.50",
-		FirmwareFilename: "firmware.bin",
-		MaxRetries:       3,
+	eng := engine.New(db, engine.Config{
+		Workers:                1,
+		PollInterval:           time.Hour,
+		InitialEvaluationDelay: 10 * time.Millisecond,
 	})
-	if err != nil {
-		t.Fatalf("Failed to create job: %v", err)
-	}
+	server := NewServer(db, eng, Config{Port: 8080, WebRoot: "../../web"})
 
-	req := httptest.NewRequest("GET", "/api/jobs/"+string(rune(jobID+'0')), nil)
-	w := httptest.NewRecorder()
+	// Token auth must not block orchestrator probes
+	db.SetSetting("api_token", "secret")
 
-	server.router.ServeHTTP(w, req)
+	probe := func(path string) int {
+		req := httptest.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		return w.Code
+	}
 
-	if w.Code != http.StatusOK {
-		t.Errorf("Expected status 200, got %d", w.Code)
+	if code := probe("/api/live"); code != http.StatusOK {
+		t.Errorf("Expected /api/live 200 before start, got %d", code)
+	}
+	if code := probe("/api/ready"); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected /api/ready 503 before start, got %d", code)
 	}
 
-	var job models.UpgradeJob
-	if err := json.NewDecoder(w.Body).Decode(&job); err != nil {
-		t.Fatalf("Failed to decode response: %v", err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go eng.Start(ctx)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for probe("/api/ready") != http.StatusOK {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected /api/ready to return 200 after engine started")
+		}
+		time.Sleep(10 * time.Millisecond)
 	}
 
-	if job.ID != jobID {
-		t.Errorf("Expected ID %d, got %d", jobID, job.ID)
+	if code := probe("/api/live"); code != http.StatusOK {
+		t.Errorf("Expected /api/live 200 after start, got %d", code)
 	}
 }
 
-func TestHandleRetryJob(t *testing.T) {
-	server, db := setupTestServer(t)
-	defer db.Close()
-
-	// Create a failed job
-	jobID, err := db.CreateJob(&models.UpgradeJob{
-		ModemID:          1,
-		RuleID:           1,
-		CMTSID:           1,
-		MACAddress:       "00:01:5C:11:22:33",
-		Status:           models.JobStatusFailed,
-		TFTPServerIP:     "192.168.1.50",
-		FirmwareFilename: "firmware.bin",
-		MaxRetries:       3,
-		RetryCount:       3,
-	})
+func TestHandleHealthSubsystems(t *testing.T) {
+	db, err := database.NewTestDB()
 	if err != nil {
-		t.Fatalf("Failed to create job: %v", err)
+		t.Fatalf("Failed to create test database: %v", err)
 	}
+	defer db.Close()
 
-	req := httptest.NewRequest("POST", "/api/jobs/"+string(rune(jobID+'0'))+"/retry", nil)
-	w := httptest.NewRecorder()
+	eng := engine.New(db, engine.Config{Workers: 2, ScheduleInterval: time.Minute})
+	server := NewServer(db, eng, Config{Port: 8080, WebRoot: "../../web"})
 
-	server.router.ServeHTTP(w, req)
+	health := func() (int, map[string]interface{}) {
+		req := httptest.NewRequest("GET", "/api/health", nil)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
 
-	if w.Code != http.StatusOK {
-		t.Errorf("Expected status 200, got %d", w.Code)
+		var resp struct {
+			Status     string                            `json:"status"`
+			Subsystems map[string]map[string]interface{} `json:"subsystems"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		statuses := map[string]interface{}{"status": resp.Status}
+		for name, subsystem := range resp.Subsystems {
+			statuses[name] = subsystem["status"]
+		}
+		return w.Code, statuses
 	}
 
-	// Verify job was reset
-	job, err := db.GetJob(jobID)
-	if err != nil {
-		t.Fatalf("Failed to get job: %v", err)
+	// An engine that hasn't started doesn't fail the health check
+	code, statuses := health()
+	if code != http.StatusOK || statuses["status"] != "healthy" || statuses["database"] != "ok" ||
+		statuses["engine"] != "starting" || statuses["workers"] != "starting" {
+		t.Errorf("Expected healthy while starting, got %d %v", code, statuses)
 	}
 
-	if job.Status != models.JobStatusPending {
-		t.Errorf("Expected status PENDING after retry, got %s", job.Status)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		eng.Start(ctx)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		code, statuses = health()
+		if statuses["engine"] == "ok" && statuses["workers"] == "ok" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected engine and workers ok after start, got %d %v", code, statuses)
+		}
+		time.Sleep(10 * time.Millisecond)
 	}
-	if job.RetryCount != 0 {
-		t.Errorf("Expected retry count 0, got %d", job.RetryCount)
+	if code != http.StatusOK || statuses["status"] != "healthy" {
+		t.Errorf("Expected healthy once running, got %d %v", code, statuses)
 	}
-}
 
-// Activity Log Tests
+	// Workers that have exited leave the service degraded
+	cancel()
+	<-done
+	deadline = time.Now().Add(5 * time.Second)
+	for statuses["workers"] != "degraded" {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected workers degraded after stop, got %v", statuses)
+		}
+		time.Sleep(10 * time.Millisecond)
+		code, statuses = health()
+	}
+	if code != http.StatusServiceUnavailable || statuses["status"] != "degraded" {
+		t.Errorf("Expected 503 degraded, got %d %v", code, statuses)
+	}
+}
 
-func TestHandleListActivityLogs(t *testing.T) {
+func TestHandleMetrics(t *testing.T) {
 	server, db := setupTestServer(t)
 	defer db.Close()
 
-	// Create test activity logs
-	for i := 0; i < 5; i++ {
-		db.LogActivity(&models.ActivityLog{
-			EventType:  models.EventSystemEvent,
-			EntityType: "test",
-			EntityID:   i,
-			Message:    "Test activity",
-		})
-	}
-
-	req := httptest.NewRequest("GET", "/api/activity-log", nil)
+	req := httptest.NewRequest("GET", "/api/metrics", nil)
 	w := httptest.NewRecorder()
 
 	server.router.ServeHTTP(w, req)
@@ -692,32 +3405,24 @@ func TestHandleListActivityLogs(t *testing.T) {
 		t.Errorf("Expected status 200, got %d", w.Code)
 	}
 
-	var logs []*models.ActivityLog
-	if err := json.NewDecoder(w.Body).Decode(&logs); err != nil {
+	var response map[string]interface{}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
 		t.Fatalf("Failed to decode response: %v", err)
 	}
 
-	if len(logs) == 0 {
-		t.Error("Expected at least one activity log")
+	if _, ok := response["cmts"]; !ok {
+		t.Error("Expected cmts in metrics")
+	}
+	if _, ok := response["jobs"]; !ok {
+		t.Error("Expected jobs in metrics")
 	}
 }
 
-func TestHandleListActivityLogsWithLimit(t *testing.T) {
-	t.Skip("Activity log pagination tested in database layer")
-}
-func TestHandleListActivityLogsWithOffset(t *testing.T) {
-	t.Skip("Pagination timing issue - tested in database layer")
-}
-// Settings Tests
-
-func TestHandleListSettings(t *testing.T) {
+func TestHandleDashboard(t *testing.T) {
 	server, db := setupTestServer(t)
 	defer db.Close()
 
-	// Set some test settings
-	db.SetSetting("test_key", "test_value")
-
-	req := httptest.NewRequest("GET", "/api/settings", nil)
+	req := httptest.NewRequest("GET", "/api/dashboard", nil)
 	w := httptest.NewRecorder()
 
 	server.router.ServeHTTP(w, req)
@@ -726,90 +3431,222 @@ func TestHandleListSettings(t *testing.T) {
 		t.Errorf("Expected status 200, got %d", w.Code)
 	}
 
-	var settings map[string]string
-	if err := json.NewDecoder(w.Body).Decode(&settings); err != nil {
+	var dashboard map[string]interface{}
+	if err := json.NewDecoder(w.Body).Decode(&dashboard); err != nil {
 		t.Fatalf("Failed to decode response: %v", err)
 	}
 
-	if _, ok := settings["test_key"]; !ok {
-		t.Error("Expected test_key in settings")
+	if _, ok := dashboard["total_cmts"]; !ok {
+		t.Error("Expected total_cmts in dashboard")
+	}
+	if _, ok := dashboard["total_modems"]; !ok {
+		t.Error("Expected total_modems in dashboard")
 	}
 }
 
-
-// Health and Metrics Tests
-
-func TestHandleHealth(t *testing.T) {
+func TestHandleEngineStatus(t *testing.T) {
 	server, db := setupTestServer(t)
 	defer db.Close()
 
-	req := httptest.NewRequest("GET", "/api/health", nil)
+	if err := server.engine.EvaluateRules(); err != nil {
+		t.Fatalf("Failed to evaluate rules: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/api/admin/engine", nil)
 	w := httptest.NewRecorder()
 
 	server.router.ServeHTTP(w, req)
 
 	if w.Code != http.StatusOK {
-		t.Errorf("Expected status 200, got %d", w.Code)
+		t.Fatalf("Expected status 200, got %d", w.Code)
 	}
 
-	var response map[string]interface{}
-	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+	var status map[string]interface{}
+	if err := json.NewDecoder(w.Body).Decode(&status); err != nil {
 		t.Fatalf("Failed to decode response: %v", err)
 	}
 
-	if response["status"] != "healthy" {
-		t.Errorf("Expected status 'healthy', got %v", response["status"])
+	for _, field := range []string{
+		"workers", "active_jobs", "queue_length", "queue_capacity", "max_per_cmts",
+		"active_per_cmts", "ready", "scheduler_heartbeats", "last_evaluation", "last_discovery",
+	} {
+		if _, ok := status[field]; !ok {
+			t.Errorf("Expected field %q in engine status", field)
+		}
+	}
+
+	if status["workers"] != float64(2) {
+		t.Errorf("Expected 2 workers, got %v", status["workers"])
+	}
+
+	evaluation, ok := status["last_evaluation"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected last_evaluation object, got %v", status["last_evaluation"])
+	}
+	if evaluation["jobs_created"] != float64(1) {
+		t.Errorf("Expected 1 job created in last evaluation, got %v", evaluation["jobs_created"])
+	}
+	if evaluation["rules"] != float64(1) {
+		t.Errorf("Expected 1 rule in last evaluation, got %v", evaluation["rules"])
+	}
+
+	// The same snapshot is served at /api/engine/status
+	req = httptest.NewRequest("GET", "/api/engine/status", nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 from /api/engine/status, got %d", w.Code)
+	}
+	status = nil
+	if err := json.NewDecoder(w.Body).Decode(&status); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	for _, field := range []string{"cmts_semaphores", "jobs_processed", "last_discovery_cycle", "last_evaluation_cycle"} {
+		if _, ok := status[field]; !ok {
+			t.Errorf("Expected field %q in engine status", field)
+		}
 	}
 }
 
-func TestHandleMetrics(t *testing.T) {
+func TestHandleEnginePauseResume(t *testing.T) {
 	server, db := setupTestServer(t)
 	defer db.Close()
 
-	req := httptest.NewRequest("GET", "/api/metrics", nil)
-	w := httptest.NewRecorder()
+	health := func() map[string]interface{} {
+		req := httptest.NewRequest("GET", "/api/health", nil)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+
+		var body map[string]interface{}
+		if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+			t.Fatalf("Failed to decode health response: %v", err)
+		}
+		return body
+	}
+
+	if health()["engine_paused"] != false {
+		t.Fatal("Expected engine_paused false before pausing")
+	}
 
+	req := httptest.NewRequest("POST", "/api/engine/pause", nil)
+	w := httptest.NewRecorder()
 	server.router.ServeHTTP(w, req)
 
 	if w.Code != http.StatusOK {
-		t.Errorf("Expected status 200, got %d", w.Code)
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	if health()["engine_paused"] != true {
+		t.Error("Expected engine_paused true after pausing")
+	}
+	if value, _ := db.GetSetting("engine_paused"); value != "true" {
+		t.Errorf("Expected engine_paused setting true, got %q", value)
 	}
 
-	var response map[string]interface{}
-	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
-		t.Fatalf("Failed to decode response: %v", err)
+	// Manual evaluation is refused while paused
+	req = httptest.NewRequest("POST", "/api/rules/evaluate", nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 while paused, got %d", w.Code)
 	}
 
-	if _, ok := response["cmts"]; !ok {
-		t.Error("Expected cmts in metrics")
+	req = httptest.NewRequest("POST", "/api/engine/resume", nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
 	}
-	if _, ok := response["jobs"]; !ok {
-		t.Error("Expected jobs in metrics")
+	if health()["engine_paused"] != false {
+		t.Error("Expected engine_paused false after resuming")
 	}
 }
 
-func TestHandleDashboard(t *testing.T) {
+func TestHandleCampaigns(t *testing.T) {
 	server, db := setupTestServer(t)
 	defer db.Close()
 
-	req := httptest.NewRequest("GET", "/api/dashboard", nil)
+	req := httptest.NewRequest("POST", "/api/campaigns", strings.NewReader(`{
+		"name": "Paced rollout",
+		"match_type": "MAC_RANGE",
+		"match_criteria": "{\"start_mac\":\"00:01:5C:00:00:00\",\"end_mac\":\"00:01:5C:FF:FF:FF\"}",
+		"tftp_server_ip": "192.168.1.50",
+		"firmware_filename": "firmware-v2.0.0.bin",
+		"rate_per_minute": -1
+	}`))
 	w := httptest.NewRecorder()
-
 	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400 for negative rate, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/api/campaigns", strings.NewReader(`{
+		"name": "Paced rollout",
+		"match_type": "MAC_RANGE",
+		"match_criteria": "{\"start_mac\":\"00:01:5C:00:00:00\",\"end_mac\":\"00:01:5C:FF:FF:FF\"}",
+		"tftp_server_ip": "192.168.1.50",
+		"firmware_filename": "firmware-v2.0.0.bin",
+		"rate_per_minute": 10
+	}`))
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var created struct {
+		ID int `json:"id"`
+	}
+	json.NewDecoder(w.Body).Decode(&created)
 
+	req = httptest.NewRequest("GET", fmt.Sprintf("/api/campaigns/%d", created.ID), nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
 	if w.Code != http.StatusOK {
-		t.Errorf("Expected status 200, got %d", w.Code)
+		t.Fatalf("Expected status 200, got %d", w.Code)
 	}
-
-	var dashboard map[string]interface{}
-	if err := json.NewDecoder(w.Body).Decode(&dashboard); err != nil {
+	var result struct {
+		Campaign models.Campaign `json:"campaign"`
+		Jobs     map[string]int  `json:"jobs"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
 		t.Fatalf("Failed to decode response: %v", err)
 	}
+	if result.Campaign.Status != models.CampaignStatusScheduled || result.Campaign.StartAt.IsZero() {
+		t.Errorf("Expected a scheduled campaign starting now, got %+v", result.Campaign)
+	}
+	if result.Jobs == nil {
+		t.Error("Expected job counts in the response")
+	}
 
-	if _, ok := dashboard["total_cmts"]; !ok {
-		t.Error("Expected total_cmts in dashboard")
+	req = httptest.NewRequest("GET", "/api/campaigns", nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	var campaigns []*models.Campaign
+	json.NewDecoder(w.Body).Decode(&campaigns)
+	if len(campaigns) != 1 {
+		t.Errorf("Expected 1 campaign, got %d", len(campaigns))
 	}
-	if _, ok := dashboard["total_modems"]; !ok {
-		t.Error("Expected total_modems in dashboard")
+
+	req = httptest.NewRequest("GET", "/api/campaigns/999", nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", w.Code)
+	}
+
+	cancelPath := fmt.Sprintf("/api/campaigns/%d/cancel", result.Campaign.ID)
+	req = httptest.NewRequest("POST", cancelPath, nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 cancelling campaign, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest("POST", cancelPath, nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 cancelling twice, got %d", w.Code)
 	}
 }
@@ -1,40 +1,66 @@
 package database
 
 import (
+	"crypto/cipher"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/awksedgreep/firmware-upgrader/internal/models"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/rs/zerolog/log"
 	_ "modernc.org/sqlite"
 )
 
 // DB represents the database connection
 type DB struct {
-	conn *sql.DB
+	conn   *sql.DB
+	driver string
+	// aead encrypts CMTS community strings at rest; nil stores plaintext
+	aead cipher.AEAD
 }
 
-// New creates a new database connection and initializes schema
+// New creates a new SQLite database connection and initializes schema
 func New(dbPath string) (*DB, error) {
-	conn, err := sql.Open("sqlite", dbPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
+	return Open(DriverSQLite, dbPath)
+}
+
+// Open connects to a database with the given driver and DSN and initializes
+// schema. DriverPostgres connects through pgx's database/sql driver.
+func Open(driver, dsn string) (*DB, error) {
+	if driver != DriverSQLite && driver != DriverPostgres {
+		return nil, fmt.Errorf("unsupported database driver %q", driver)
 	}
 
-	// Enable WAL mode for better concurrency
-	if _, err := conn.Exec("PRAGMA journal_mode=WAL"); err != nil {
-		return nil, fmt.Errorf("failed to enable WAL mode: %w", err)
+	sqlDriver := driver
+	if driver == DriverPostgres {
+		sqlDriver = "pgx"
 	}
 
-	// Set WAL autocheckpoint to smaller value to limit WAL file size
-	// Default is 1000 pages (~4MB), reducing to 100 pages (~400KB)
-	if _, err := conn.Exec("PRAGMA wal_autocheckpoint=100"); err != nil {
-		return nil, fmt.Errorf("failed to set WAL autocheckpoint: %w", err)
+	conn, err := sql.Open(sqlDriver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
-	// Increase busy timeout to handle concurrent writes
-	if _, err := conn.Exec("PRAGMA busy_timeout=5000"); err != nil {
-		return nil, fmt.Errorf("failed to set busy timeout: %w", err)
+	if driver == DriverSQLite {
+		// Enable WAL mode for better concurrency
+		if _, err := conn.Exec("PRAGMA journal_mode=WAL"); err != nil {
+			return nil, fmt.Errorf("failed to enable WAL mode: %w", err)
+		}
+
+		// Set WAL autocheckpoint to smaller value to limit WAL file size
+		// Default is 1000 pages (~4MB), reducing to 100 pages (~400KB)
+		if _, err := conn.Exec("PRAGMA wal_autocheckpoint=100"); err != nil {
+			return nil, fmt.Errorf("failed to set WAL autocheckpoint: %w", err)
+		}
+
+		// Increase busy timeout to handle concurrent writes
+		if _, err := conn.Exec("PRAGMA busy_timeout=5000"); err != nil {
+			return nil, fmt.Errorf("failed to set busy timeout: %w", err)
+		}
 	}
 
 	// Set connection pool settings
@@ -47,7 +73,7 @@ func New(dbPath string) (*DB, error) {
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	db := &DB{conn: conn}
+	db := &DB{conn: conn, driver: driver}
 
 	// Initialize schema
 	if err := db.migrate(); err != nil {
@@ -62,14 +88,34 @@ func (db *DB) Close() error {
 	return db.conn.Close()
 }
 
+// Ping verifies the database is reachable and migrations have been applied
+func (db *DB) Ping() error {
+	if err := db.conn.Ping(); err != nil {
+		return fmt.Errorf("database unreachable: %w", err)
+	}
+
+	var count int
+	if err := db.queryRow("SELECT COUNT(*) FROM settings").Scan(&count); err != nil {
+		return fmt.Errorf("schema not migrated: %w", err)
+	}
+	if count == 0 {
+		return fmt.Errorf("schema not migrated: default settings missing")
+	}
+
+	return nil
+}
+
 // NewTestDB creates an in-memory database for testing with fixtures
 func NewTestDB() (*DB, error) {
 	conn, err := sql.Open("sqlite", ":memory:")
 	if err != nil {
 		return nil, fmt.Errorf("failed to open test database: %w", err)
 	}
+	// Every :memory: connection is its own empty database, so keep the
+	// pool to one connection for tests that hit the DB concurrently
+	conn.SetMaxOpenConns(1)
 
-	db := &DB{conn: conn}
+	db := &DB{conn: conn, driver: DriverSQLite}
 
 	// Initialize schema
 	if err := db.migrate(); err != nil {
@@ -121,6 +167,7 @@ func (db *DB) LoadTestFixtures() error {
 		FirmwareFilename: "firmware-v2.0.0.bin",
 		Enabled:          true,
 		Priority:         100,
+		MaxRetries:       models.DefaultMaxRetries,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to create test rule: %w", err)
@@ -142,18 +189,28 @@ func (db *DB) migrate() error {
 		cm_community_string TEXT,
 		snmp_version INTEGER DEFAULT 2,
 		enabled BOOLEAN DEFAULT 1,
+		max_firmware_version TEXT DEFAULT '',
+		snmp_max_oids INTEGER DEFAULT 60,
 		created_at INTEGER NOT NULL,
-		updated_at INTEGER NOT NULL
+		updated_at INTEGER NOT NULL,
+		deleted_at INTEGER
 	);
 
 	CREATE TABLE IF NOT EXISTS cable_modem (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		cmts_id INTEGER NOT NULL,
 		mac_address TEXT UNIQUE NOT NULL,
+		if_index TEXT DEFAULT '',
+		if_descr TEXT DEFAULT '',
 		ip_address TEXT,
 		sysdescr TEXT,
 		current_firmware TEXT,
 		signal_level REAL,
+		ofdm_power REAL,
+		expected_firmware TEXT DEFAULT '',
+		config_file TEXT DEFAULT '',
+		vendor TEXT DEFAULT '',
+		tags TEXT DEFAULT '',
 		status TEXT,
 		last_seen INTEGER,
 		FOREIGN KEY (cmts_id) REFERENCES cmts(id) ON DELETE CASCADE
@@ -161,6 +218,19 @@ func (db *DB) migrate() error {
 
 	CREATE INDEX IF NOT EXISTS idx_cable_modem_mac ON cable_modem(mac_address);
 	CREATE INDEX IF NOT EXISTS idx_cable_modem_cmts ON cable_modem(cmts_id);
+	CREATE INDEX IF NOT EXISTS idx_cable_modem_firmware ON cable_modem(current_firmware);
+
+	CREATE TABLE IF NOT EXISTS modem_signal_history (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		modem_id INTEGER NOT NULL,
+		signal_level REAL,
+		ofdm_power REAL,
+		recorded_at INTEGER NOT NULL,
+		FOREIGN KEY (modem_id) REFERENCES cable_modem(id) ON DELETE CASCADE
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_signal_history_modem ON modem_signal_history(modem_id, recorded_at);
+	CREATE INDEX IF NOT EXISTS idx_signal_history_recorded ON modem_signal_history(recorded_at);
 
 	CREATE TABLE IF NOT EXISTS upgrade_rule (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -172,6 +242,15 @@ func (db *DB) migrate() error {
 		firmware_filename TEXT NOT NULL,
 		enabled BOOLEAN DEFAULT 1,
 		priority INTEGER DEFAULT 0,
+		dry_run BOOLEAN DEFAULT 0,
+		canary_percent INTEGER DEFAULT 0,
+		max_concurrent INTEGER DEFAULT 0,
+		admin_status_value INTEGER DEFAULT 0,
+		custom_upgrade_oid TEXT DEFAULT '',
+		transport_protocol TEXT DEFAULT '',
+		exclude BOOLEAN DEFAULT 0,
+		max_retries INTEGER DEFAULT 3,
+		upgrade_poll_interval INTEGER DEFAULT 0,
 		created_at INTEGER NOT NULL,
 		updated_at INTEGER NOT NULL
 	);
@@ -181,7 +260,7 @@ func (db *DB) migrate() error {
 
 	CREATE TABLE IF NOT EXISTS upgrade_job (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		modem_id INTEGER NOT NULL,
+		modem_id INTEGER, -- NULL once the modem is deleted, the job is kept as history
 		rule_id INTEGER NOT NULL,
 		cmts_id INTEGER NOT NULL,
 		mac_address TEXT NOT NULL,
@@ -194,13 +273,41 @@ func (db *DB) migrate() error {
 		created_at INTEGER NOT NULL,
 		started_at INTEGER,
 		completed_at INTEGER,
-		FOREIGN KEY (modem_id) REFERENCES cable_modem(id),
-		FOREIGN KEY (rule_id) REFERENCES upgrade_rule(id),
+		next_retry_at INTEGER,
+		dead_letter BOOLEAN DEFAULT 0,
+		campaign_id INTEGER, -- rule_id is 0 for campaign jobs, so it has no foreign key
+		admin_status_value INTEGER DEFAULT 0,
+		custom_upgrade_oid TEXT DEFAULT '',
+		transport_protocol TEXT DEFAULT '',
+		upgrade_poll_interval INTEGER DEFAULT 0,
+		trace_id TEXT DEFAULT '',
+		failure_details TEXT DEFAULT '',
+		FOREIGN KEY (modem_id) REFERENCES cable_modem(id) ON DELETE SET NULL,
 		FOREIGN KEY (cmts_id) REFERENCES cmts(id)
 	);
 
 	CREATE INDEX IF NOT EXISTS idx_upgrade_job_status ON upgrade_job(status);
 	CREATE INDEX IF NOT EXISTS idx_upgrade_job_mac ON upgrade_job(mac_address);
+	CREATE INDEX IF NOT EXISTS idx_upgrade_job_cmts ON upgrade_job(cmts_id, status);
+
+	CREATE TABLE IF NOT EXISTS campaign (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		match_type TEXT NOT NULL,
+		match_criteria TEXT NOT NULL,
+		tftp_server_ip TEXT NOT NULL,
+		firmware_filename TEXT NOT NULL,
+		start_at INTEGER NOT NULL,
+		rate_per_minute INTEGER NOT NULL,
+		status TEXT NOT NULL,
+		jobs_created INTEGER DEFAULT 0,
+		remaining INTEGER DEFAULT 0,
+		created_at INTEGER NOT NULL,
+		updated_at INTEGER NOT NULL,
+		completed_at INTEGER
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_campaign_status ON campaign(status);
 
 	CREATE TABLE IF NOT EXISTS activity_log (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -214,6 +321,7 @@ func (db *DB) migrate() error {
 
 	CREATE INDEX IF NOT EXISTS idx_activity_log_created ON activity_log(created_at DESC);
 	CREATE INDEX IF NOT EXISTS idx_activity_log_type ON activity_log(event_type);
+	CREATE INDEX IF NOT EXISTS idx_activity_log_entity ON activity_log(entity_type, entity_id);
 
 	CREATE TABLE IF NOT EXISTS settings (
 		key TEXT PRIMARY KEY,
@@ -222,28 +330,136 @@ func (db *DB) migrate() error {
 	);
 	`
 
-	if _, err := db.conn.Exec(schema); err != nil {
+	if _, err := db.conn.Exec(db.ddl(schema)); err != nil {
 		return fmt.Errorf("failed to create schema: %w", err)
 	}
 
+	// Columns added after the initial schema
+	if err := db.addColumnIfMissing("cmts", "deleted_at", "INTEGER"); err != nil {
+		return err
+	}
+	if err := db.addColumnIfMissing("upgrade_rule", "dry_run", "BOOLEAN DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := db.addColumnIfMissing("cmts", "max_firmware_version", "TEXT DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := db.addColumnIfMissing("upgrade_job", "next_retry_at", "INTEGER"); err != nil {
+		return err
+	}
+	if err := db.addColumnIfMissing("upgrade_job", "dead_letter", "BOOLEAN DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := db.addColumnIfMissing("cable_modem", "ofdm_power", "REAL"); err != nil {
+		return err
+	}
+	if err := db.addColumnIfMissing("upgrade_rule", "canary_percent", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := db.addColumnIfMissing("cable_modem", "expected_firmware", "TEXT DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := db.addColumnIfMissing("upgrade_job", "campaign_id", "INTEGER"); err != nil {
+		return err
+	}
+	if err := db.addColumnIfMissing("upgrade_rule", "max_concurrent", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+	for _, table := range []string{"upgrade_rule", "upgrade_job"} {
+		if err := db.addColumnIfMissing(table, "admin_status_value", "INTEGER DEFAULT 0"); err != nil {
+			return err
+		}
+		if err := db.addColumnIfMissing(table, "custom_upgrade_oid", "TEXT DEFAULT ''"); err != nil {
+			return err
+		}
+	}
+	if err := db.addColumnIfMissing("upgrade_rule", "exclude", "BOOLEAN DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := db.addColumnIfMissing("cable_modem", "tags", "TEXT DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := db.addColumnIfMissing("upgrade_job", "failure_details", "TEXT DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := db.addColumnIfMissing("cmts", "snmp_max_oids", "INTEGER DEFAULT 60"); err != nil {
+		return err
+	}
+	if err := db.addColumnIfMissing("upgrade_rule", "max_retries", "INTEGER DEFAULT 3"); err != nil {
+		return err
+	}
+	if err := db.addColumnIfMissing("cable_modem", "if_index", "TEXT DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := db.addColumnIfMissing("cable_modem", "if_descr", "TEXT DEFAULT ''"); err != nil {
+		return err
+	}
+	for _, table := range []string{"upgrade_rule", "upgrade_job"} {
+		if err := db.addColumnIfMissing(table, "transport_protocol", "TEXT DEFAULT ''"); err != nil {
+			return err
+		}
+		if err := db.addColumnIfMissing(table, "upgrade_poll_interval", "INTEGER DEFAULT 0"); err != nil {
+			return err
+		}
+	}
+	if err := db.addColumnIfMissing("upgrade_job", "trace_id", "TEXT DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := db.addColumnIfMissing("cable_modem", "config_file", "TEXT DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := db.addColumnIfMissing("cable_modem", "vendor", "TEXT DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := db.addCMTSIPIndex(); err != nil {
+		return err
+	}
+	if err := db.relaxJobModemKey(); err != nil {
+		return err
+	}
+
 	// Initialize default settings
 	defaults := map[string]string{
-		"workers":                 "5",
-		"discovery_interval":      "60",
-		"evaluation_interval":     "120",
-		"job_timeout":             "300",
-		"retry_attempts":          "3",
-		"signal_level_min":        "-15.0",
-		"signal_level_max":        "15.0",
-		"max_upgrades_per_cmts":   "10",
-		"log_level":               "info",
-		"cleanup_interval":        "3600", // seconds (1 hour)
-		"cleanup_offline_minutes": "10",   // mark offline after X minutes
-		"cleanup_delete_days":     "7",    // delete after X days offline
+		"workers":                   "5",
+		"poll_interval":             "30", // seconds between job queue polls
+		"discovery_interval":        "60",
+		"evaluation_interval":       "120",
+		"job_timeout":               "300",
+		"upgrade_poll_interval":     "10", // seconds between status checks on a running upgrade
+		"retry_attempts":            "3",
+		"retry_jitter":              "true", // randomize retry backoff by 0.5x to 1.5x
+		"retry_budget":              "100",  // max retries across all CMTS per window, 0 = unlimited
+		"retry_budget_per_cmts":     "25",   // max retries on one CMTS per window, 0 = unlimited
+		"retry_budget_window":       "3600", // seconds
+		"signal_level_min":          "-15.0",
+		"signal_level_max":          "15.0",
+		"eligible_statuses":         "online", // comma-separated modem statuses eligible for upgrade
+		"max_modems_per_cmts":       "100000", // abort a CMTS's discovery if it reports more modems
+		"oui_file":                  "",       // extra OUI to vendor mappings, empty = built-in table only
+		"max_upgrades_per_cmts":     "10",
+		"discovery_concurrency":     "5",     // max simultaneous CMTS discoveries, 0 = unlimited
+		"snmp_budget":               "0",     // max concurrent discoveries + upgrades, 0 = unlimited
+		"snmp_scheduling_policy":    "fair",  // fair, prioritize_upgrades or prioritize_discovery
+		"max_list_items":            "1000",  // cap on items returned by list endpoints
+		"job_retention_days":        "90",    // purge finished jobs and logs after X days, 0 = keep forever
+		"signal_history_days":       "7",     // keep modem signal history for X days, 0 = keep forever
+		"verify_firmware_exists":    "true",  // probe the TFTP server for the firmware file before upgrading
+		"engine_paused":             "false", // set by the pause/resume endpoints, survives restarts
+		"restart_workers_on_panic":  "true",  // recover a worker whose job panics instead of crashing
+		"log_level":                 "info",
+		"log_format":                "console", // console or json; the -log-format flag takes precedence
+		"cleanup_interval":          "3600",    // seconds (1 hour)
+		"cleanup_offline_minutes":   "10",      // mark offline after X minutes
+		"cleanup_delete_days":       "7",       // delete after X days offline
+		"api_token":                 "",        // empty disables API authentication
+		"api_rate_limit":            "0",       // requests per second per client IP, 0 = unlimited
+		"evaluation_cmts_allowlist": "",        // comma-separated CMTS IDs, empty = all
+		"webhook_url":               "",        // POSTed on upgrade completion and final failure, empty = off
+		"cors_allowed_origins":      "*",       // comma-separated origins allowed cross-origin, * = any
 	}
 
 	for key, value := range defaults {
-		_, err := db.conn.Exec(`
+		_, err := db.exec(`
 			INSERT INTO settings (key, value, updated_at)
 			VALUES (?, ?, ?)
 			ON CONFLICT(key) DO NOTHING
@@ -256,6 +472,161 @@ func (db *DB) migrate() error {
 	return nil
 }
 
+// addCMTSIPIndex makes IP addresses unique among CMTS that aren't deleted.
+// Databases from before this was enforced may already hold duplicates; they
+// are left unindexed, with a warning, until an operator resolves them.
+func (db *DB) addCMTSIPIndex() error {
+	var duplicates int
+	err := db.queryRow(`
+		SELECT COUNT(*) FROM (
+			SELECT ip_address FROM cmts WHERE deleted_at IS NULL
+			GROUP BY ip_address HAVING COUNT(*) > 1
+		) dup`).Scan(&duplicates)
+	if err != nil {
+		return fmt.Errorf("failed to check for duplicate CMTS IP addresses: %w", err)
+	}
+	if duplicates > 0 {
+		log.Warn().
+			Int("duplicate_ips", duplicates).
+			Msg("Several CMTS share an IP address; delete or readdress them to enforce unique CMTS IPs")
+		return nil
+	}
+
+	if _, err := db.conn.Exec(`
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_cmts_ip_address
+		ON cmts(ip_address) WHERE deleted_at IS NULL`); err != nil {
+		return fmt.Errorf("failed to index CMTS IP addresses: %w", err)
+	}
+	return nil
+}
+
+// relaxJobModemKey lets upgrade_job.modem_id go NULL when its modem is
+// deleted, so job history outlives the modem. Older schemas declared it NOT
+// NULL with a plain foreign key. PostgreSQL alters the constraint in place;
+// SQLite can't, so the table is rebuilt from its own CREATE statement.
+func (db *DB) relaxJobModemKey() error {
+	if db.postgres() {
+		var relaxed int
+		err := db.queryRow(`
+			SELECT COUNT(*) FROM pg_constraint
+			WHERE conname = 'upgrade_job_modem_id_fkey' AND confdeltype = 'n'`).Scan(&relaxed)
+		if err != nil {
+			return fmt.Errorf("failed to inspect upgrade_job.modem_id: %w", err)
+		}
+		if relaxed > 0 {
+			return nil
+		}
+		if _, err := db.conn.Exec(`
+			ALTER TABLE upgrade_job
+				ALTER COLUMN modem_id DROP NOT NULL,
+				DROP CONSTRAINT IF EXISTS upgrade_job_modem_id_fkey,
+				ADD CONSTRAINT upgrade_job_modem_id_fkey FOREIGN KEY (modem_id)
+					REFERENCES cable_modem(id) ON DELETE SET NULL`); err != nil {
+			return fmt.Errorf("failed to relax upgrade_job.modem_id: %w", err)
+		}
+		return nil
+	}
+
+	var notNull int
+	err := db.conn.QueryRow(`
+		SELECT "notnull" FROM pragma_table_info('upgrade_job') WHERE name = 'modem_id'`).Scan(&notNull)
+	if err != nil {
+		return fmt.Errorf("failed to inspect upgrade_job.modem_id: %w", err)
+	}
+	if notNull == 0 {
+		return nil
+	}
+
+	return db.WithTx(func(tx *Tx) error {
+		var table string
+		if err := tx.tx.QueryRow(`
+			SELECT sql FROM sqlite_master WHERE type = 'table' AND name = 'upgrade_job'`).Scan(&table); err != nil {
+			return fmt.Errorf("failed to read upgrade_job schema: %w", err)
+		}
+		var indexes []string
+		rows, err := tx.tx.Query(`
+			SELECT sql FROM sqlite_master
+			WHERE type = 'index' AND tbl_name = 'upgrade_job' AND sql IS NOT NULL`)
+		if err != nil {
+			return fmt.Errorf("failed to read upgrade_job indexes: %w", err)
+		}
+		for rows.Next() {
+			var index string
+			if err := rows.Scan(&index); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to read upgrade_job indexes: %w", err)
+			}
+			indexes = append(indexes, index)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to read upgrade_job indexes: %w", err)
+		}
+
+		table = strings.NewReplacer(
+			"modem_id INTEGER NOT NULL", "modem_id INTEGER",
+			"REFERENCES cable_modem(id),", "REFERENCES cable_modem(id) ON DELETE SET NULL,",
+		).Replace(strings.Replace(table, "upgrade_job", "upgrade_job_new", 1))
+
+		statements := []string{
+			table,
+			`INSERT INTO upgrade_job_new SELECT * FROM upgrade_job`,
+			`DROP TABLE upgrade_job`,
+			`ALTER TABLE upgrade_job_new RENAME TO upgrade_job`,
+		}
+		statements = append(statements, indexes...)
+		// SQLite never enforced the old key, so jobs may already point at
+		// modems deleted before this migration
+		statements = append(statements, `
+			UPDATE upgrade_job SET modem_id = NULL
+			WHERE modem_id NOT IN (SELECT id FROM cable_modem)`)
+		for _, stmt := range statements {
+			if _, err := tx.tx.Exec(stmt); err != nil {
+				return fmt.Errorf("failed to rebuild upgrade_job: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// addColumnIfMissing adds a column to an existing table created by an older schema
+func (db *DB) addColumnIfMissing(table, column, definition string) error {
+	if db.postgres() {
+		if _, err := db.conn.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s %s", table, column, db.ddl(definition))); err != nil {
+			return fmt.Errorf("failed to add column %s.%s: %w", table, column, err)
+		}
+		return nil
+	}
+
+	rows, err := db.conn.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return fmt.Errorf("failed to inspect table %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return fmt.Errorf("failed to inspect table %s: %w", table, err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to inspect table %s: %w", table, err)
+	}
+	rows.Close()
+
+	if _, err := db.conn.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+		return fmt.Errorf("failed to add column %s.%s: %w", table, column, err)
+	}
+
+	return nil
+}
+
 // CMTS operations
 
 // CreateCMTS creates a new CMTS
@@ -264,24 +635,95 @@ func (db *DB) CreateCMTS(cmts *models.CMTS) (int, error) {
 		return 0, err
 	}
 
+	communityWrite, cmCommunity, err := db.sealCommunities(cmts.CommunityWrite, cmts.CMCommunityString)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create CMTS: %w", err)
+	}
+
 	now := time.Now().Unix()
-	result, err := db.conn.Exec(`
+	id, err := db.insert(db.conn, `
 		INSERT INTO cmts (name, ip_address, snmp_port, community_read, community_write,
-			cm_community_string, snmp_version, enabled, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		cmts.Name, cmts.IPAddress, cmts.SNMPPort, cmts.CommunityRead, cmts.CommunityWrite,
-		cmts.CMCommunityString, cmts.SNMPVersion, cmts.Enabled, now, now)
+			cm_community_string, snmp_version, enabled, max_firmware_version, snmp_max_oids,
+			created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		cmts.Name, cmts.IPAddress, cmts.SNMPPort, cmts.CommunityRead, communityWrite,
+		cmCommunity, cmts.SNMPVersion, cmts.Enabled, cmts.MaxFirmwareVersion, cmts.MaxOids(), now, now)
 
+	if isUniqueViolation(err) {
+		return 0, models.ErrDuplicate
+	}
 	if err != nil {
 		return 0, fmt.Errorf("failed to create CMTS: %w", err)
 	}
 
-	id, err := result.LastInsertId()
+	return id, nil
+}
+
+// CreateCMTSBatch inserts several CMTS devices in a single transaction.
+// The returned slices are parallel to the input. An entry that fails
+// validation, or reuses the IP address of an existing CMTS or an earlier
+// entry, is skipped with an ID of 0 and its error (models.ErrDuplicate for
+// a reused IP); the rest are still created. Any other database error rolls
+// back the whole batch.
+func (db *DB) CreateCMTSBatch(list []*models.CMTS) ([]int, []error, error) {
+	tx, err := db.conn.Begin()
 	if err != nil {
-		return 0, err
+		return nil, nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	const insertCMTS = `
+		INSERT INTO cmts (name, ip_address, snmp_port, community_read, community_write,
+			cm_community_string, snmp_version, enabled, max_firmware_version, snmp_max_oids,
+			created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	now := time.Now().Unix()
+	ids := make([]int, len(list))
+	errs := make([]error, len(list))
+	for i, cmts := range list {
+		if cmts == nil {
+			errs[i] = fmt.Errorf("CMTS is required")
+			continue
+		}
+		if errs[i] = cmts.Validate(); errs[i] != nil {
+			continue
+		}
+
+		// Checked up front so one reused IP doesn't abort the transaction
+		var inUse int
+		if err := tx.QueryRow(db.rebind(`
+			SELECT COUNT(*) FROM cmts WHERE ip_address = ? AND deleted_at IS NULL`),
+			cmts.IPAddress).Scan(&inUse); err != nil {
+			return nil, nil, fmt.Errorf("failed to check CMTS %q: %w", cmts.Name, err)
+		}
+		if inUse > 0 {
+			errs[i] = models.ErrDuplicate
+			continue
+		}
+
+		communityWrite, cmCommunity, err := db.sealCommunities(cmts.CommunityWrite, cmts.CMCommunityString)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create CMTS %q: %w", cmts.Name, err)
+		}
+
+		id, err := db.insert(tx, insertCMTS,
+			cmts.Name, cmts.IPAddress, cmts.SNMPPort, cmts.CommunityRead, communityWrite,
+			cmCommunity, cmts.SNMPVersion, cmts.Enabled, cmts.MaxFirmwareVersion, cmts.MaxOids(), now, now)
+		if isUniqueViolation(err) {
+			return nil, nil, models.ErrDuplicate
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create CMTS %q: %w", cmts.Name, err)
+		}
+		ids[i] = id
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, nil, fmt.Errorf("failed to commit CMTS batch: %w", err)
 	}
 
-	return int(id), nil
+	return ids, errs, nil
 }
 
 // GetCMTS retrieves a CMTS by ID
@@ -289,13 +731,14 @@ func (db *DB) GetCMTS(id int) (*models.CMTS, error) {
 	var cmts models.CMTS
 	var createdAt, updatedAt int64
 
-	err := db.conn.QueryRow(`
+	err := db.queryRow(`
 		SELECT id, name, ip_address, snmp_port, community_read, community_write,
-			cm_community_string, snmp_version, enabled, created_at, updated_at
-		FROM cmts WHERE id = ?`, id).Scan(
+			cm_community_string, snmp_version, enabled, max_firmware_version,
+			COALESCE(snmp_max_oids, 0), created_at, updated_at
+		FROM cmts WHERE id = ? AND deleted_at IS NULL`, id).Scan(
 		&cmts.ID, &cmts.Name, &cmts.IPAddress, &cmts.SNMPPort, &cmts.CommunityRead,
 		&cmts.CommunityWrite, &cmts.CMCommunityString, &cmts.SNMPVersion,
-		&cmts.Enabled, &createdAt, &updatedAt)
+		&cmts.Enabled, &cmts.MaxFirmwareVersion, &cmts.SNMPMaxOids, &createdAt, &updatedAt)
 
 	if err == sql.ErrNoRows {
 		return nil, models.ErrNotFound
@@ -303,6 +746,9 @@ func (db *DB) GetCMTS(id int) (*models.CMTS, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to get CMTS: %w", err)
 	}
+	if err := db.openCommunities(&cmts.CommunityWrite, &cmts.CMCommunityString); err != nil {
+		return nil, fmt.Errorf("failed to get CMTS %d: %w", cmts.ID, err)
+	}
 
 	cmts.CreatedAt = time.Unix(createdAt, 0)
 	cmts.UpdatedAt = time.Unix(updatedAt, 0)
@@ -312,35 +758,115 @@ func (db *DB) GetCMTS(id int) (*models.CMTS, error) {
 
 // ListCMTS retrieves all CMTS devices
 func (db *DB) ListCMTS() ([]*models.CMTS, error) {
-	rows, err := db.conn.Query(`
-		SELECT id, name, ip_address, snmp_port, community_read, community_write,
-			cm_community_string, snmp_version, enabled, created_at, updated_at
-		FROM cmts ORDER BY name`)
+	return db.listCMTS(false)
+}
+
+// ListCMTSIncludingDeleted retrieves all CMTS devices, including soft-deleted ones
+func (db *DB) ListCMTSIncludingDeleted() ([]*models.CMTS, error) {
+	return db.listCMTS(true)
+}
+
+func (db *DB) listCMTS(includeDeleted bool) ([]*models.CMTS, error) {
+	query := `
+		SELECT ` + cmtsColumns + `
+		FROM cmts`
+	if !includeDeleted {
+		query += " WHERE deleted_at IS NULL"
+	}
+	query += " ORDER BY name"
+
+	rows, err := db.query(query)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to list CMTS: %w", err)
 	}
 	defer rows.Close()
 
+	return db.scanCMTSRows(rows)
+}
+
+// ListCMTSFiltered retrieves a page of CMTS devices ordered by name, along
+// with how many match in total. enabledOnly drops disabled CMTS and
+// nameContains keeps those whose name contains it, ignoring case. A limit
+// of 0 returns all matches from offset onwards.
+func (db *DB) ListCMTSFiltered(enabledOnly bool, nameContains string, limit, offset int) ([]*models.CMTS, int, error) {
+	where := " WHERE deleted_at IS NULL"
+	var args []interface{}
+	if enabledOnly {
+		where += " AND enabled = ?"
+		args = append(args, true)
+	}
+	if nameContains != "" {
+		escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(strings.ToLower(nameContains))
+		where += ` AND LOWER(name) LIKE ? ESCAPE '\'`
+		args = append(args, "%"+escaped+"%")
+	}
+
+	var total int
+	if err := db.queryRow("SELECT COUNT(*) FROM cmts"+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count CMTS: %w", err)
+	}
+
+	query := `
+		SELECT ` + cmtsColumns + `
+		FROM cmts` + where + " ORDER BY name"
+	if limit > 0 {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, limit, offset)
+	} else if offset > 0 {
+		query += " LIMIT " + db.noLimit() + " OFFSET ?"
+		args = append(args, offset)
+	}
+
+	rows, err := db.query(query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list CMTS: %w", err)
+	}
+	defer rows.Close()
+
+	cmtsList, err := db.scanCMTSRows(rows)
+	if err != nil {
+		return nil, 0, err
+	}
+	return cmtsList, total, nil
+}
+
+// cmtsColumns is the column list read by scanCMTSRows
+const cmtsColumns = `id, name, ip_address, snmp_port, community_read, community_write,
+			cm_community_string, snmp_version, enabled, max_firmware_version,
+			COALESCE(snmp_max_oids, 0), created_at, updated_at, deleted_at`
+
+// scanCMTSRows reads every CMTS selected with cmtsColumns, decrypting
+// their community strings
+func (db *DB) scanCMTSRows(rows *sql.Rows) ([]*models.CMTS, error) {
 	var cmtsList []*models.CMTS
 	for rows.Next() {
 		var cmts models.CMTS
 		var createdAt, updatedAt int64
+		var deletedAt sql.NullInt64
 
 		err := rows.Scan(&cmts.ID, &cmts.Name, &cmts.IPAddress, &cmts.SNMPPort,
 			&cmts.CommunityRead, &cmts.CommunityWrite, &cmts.CMCommunityString,
-			&cmts.SNMPVersion, &cmts.Enabled, &createdAt, &updatedAt)
+			&cmts.SNMPVersion, &cmts.Enabled, &cmts.MaxFirmwareVersion,
+			&cmts.SNMPMaxOids, &createdAt, &updatedAt, &deletedAt)
 
 		if err != nil {
 			return nil, err
 		}
+		if err := db.openCommunities(&cmts.CommunityWrite, &cmts.CMCommunityString); err != nil {
+			return nil, fmt.Errorf("failed to read CMTS %d: %w", cmts.ID, err)
+		}
 
 		cmts.CreatedAt = time.Unix(createdAt, 0)
 		cmts.UpdatedAt = time.Unix(updatedAt, 0)
+		if deletedAt.Valid {
+			t := time.Unix(deletedAt.Int64, 0)
+			cmts.DeletedAt = &t
+		}
 		cmtsList = append(cmtsList, &cmts)
 	}
 
-	return cmtsList, nil
+	return cmtsList, rows.Err()
 }
 
 // UpdateCMTS updates a CMTS
@@ -349,15 +875,24 @@ func (db *DB) UpdateCMTS(cmts *models.CMTS) error {
 		return err
 	}
 
+	communityWrite, cmCommunity, err := db.sealCommunities(cmts.CommunityWrite, cmts.CMCommunityString)
+	if err != nil {
+		return fmt.Errorf("failed to update CMTS: %w", err)
+	}
+
 	now := time.Now().Unix()
-	result, err := db.conn.Exec(`
+	result, err := db.exec(`
 		UPDATE cmts SET name = ?, ip_address = ?, snmp_port = ?, community_read = ?,
 			community_write = ?, cm_community_string = ?, snmp_version = ?, enabled = ?,
-			updated_at = ?
-		WHERE id = ?`,
-		cmts.Name, cmts.IPAddress, cmts.SNMPPort, cmts.CommunityRead, cmts.CommunityWrite,
-		cmts.CMCommunityString, cmts.SNMPVersion, cmts.Enabled, now, cmts.ID)
+			max_firmware_version = ?, snmp_max_oids = ?, updated_at = ?
+		WHERE id = ? AND deleted_at IS NULL`,
+		cmts.Name, cmts.IPAddress, cmts.SNMPPort, cmts.CommunityRead, communityWrite,
+		cmCommunity, cmts.SNMPVersion, cmts.Enabled, cmts.MaxFirmwareVersion,
+		cmts.MaxOids(), now, cmts.ID)
 
+	if isUniqueViolation(err) {
+		return models.ErrDuplicate
+	}
 	if err != nil {
 		return fmt.Errorf("failed to update CMTS: %w", err)
 	}
@@ -375,7 +910,10 @@ func (db *DB) UpdateCMTS(cmts *models.CMTS) error {
 
 // DeleteCMTS deletes a CMTS
 func (db *DB) DeleteCMTS(id int) error {
-	result, err := db.conn.Exec("DELETE FROM cmts WHERE id = ?", id)
+	now := time.Now().Unix()
+	result, err := db.exec(`
+		UPDATE cmts SET deleted_at = ?, updated_at = ?
+		WHERE id = ? AND deleted_at IS NULL`, now, now, id)
 	if err != nil {
 		return fmt.Errorf("failed to delete CMTS: %w", err)
 	}
@@ -391,95 +929,377 @@ func (db *DB) DeleteCMTS(id int) error {
 	return nil
 }
 
+// RestoreCMTS clears the soft-delete marker on a CMTS
+func (db *DB) RestoreCMTS(id int) error {
+	result, err := db.exec(`
+		UPDATE cmts SET deleted_at = NULL, updated_at = ?
+		WHERE id = ? AND deleted_at IS NOT NULL`, time.Now().Unix(), id)
+	if isUniqueViolation(err) {
+		return models.ErrDuplicate
+	}
+	if err != nil {
+		return fmt.Errorf("failed to restore CMTS: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return models.ErrNotFound
+	}
+
+	return nil
+}
+
 // Cable Modem operations
 
-// UpsertModem inserts or updates a cable modem
+// UpsertModem inserts or updates a cable modem, logging a MODEM_ONLINE or
+// MODEM_LOST activity if an existing modem came online or dropped off
 func (db *DB) UpsertModem(modem *models.CableModem) error {
-	now := time.Now().Unix()
+	return db.UpsertModems([]*models.CableModem{modem})
+}
 
-	_, err := db.conn.Exec(`
-		INSERT INTO cable_modem (cmts_id, mac_address, ip_address, sysdescr,
-			current_firmware, signal_level, status, last_seen)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+// UpsertModems inserts or updates modems in a single transaction, using
+// prepared statements so a large discovery parses its SQL once rather than
+// per modem. An empty sysDescr, firmware or config file keeps the stored
+// one, since discovery reports "" whenever a modem didn't answer, and so
+// does an empty vendor, so callers that don't look it up leave it alone.
+// Reported signal levels are appended to the modem's signal history when
+// they change, or at least every signalHistoryInterval while they hold.
+// Status transitions and moves between CMTS are collected as it goes and
+// logged together at the end, so a large discovery doesn't cost an extra
+// insert per modem that changed.
+func (db *DB) UpsertModems(modems []*models.CableModem) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	selectStmt, err := tx.Prepare(db.rebind(`
+		SELECT id, cmts_id, status, signal_level, ofdm_power,
+			(SELECT MAX(recorded_at) FROM modem_signal_history WHERE modem_id = cable_modem.id)
+		FROM cable_modem WHERE mac_address = ?`))
+	if err != nil {
+		return fmt.Errorf("failed to prepare modem lookup: %w", err)
+	}
+	defer selectStmt.Close()
+
+	upsertStmt, err := tx.Prepare(db.rebind(`
+		INSERT INTO cable_modem (cmts_id, mac_address, if_index, if_descr, ip_address,
+			sysdescr, current_firmware, config_file, vendor, signal_level, ofdm_power, status, last_seen)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 		ON CONFLICT(mac_address) DO UPDATE SET
 			cmts_id = excluded.cmts_id,
+			if_index = excluded.if_index,
+			if_descr = excluded.if_descr,
 			ip_address = excluded.ip_address,
-			sysdescr = excluded.sysdescr,
-			current_firmware = excluded.current_firmware,
+			sysdescr = COALESCE(NULLIF(excluded.sysdescr, ''), cable_modem.sysdescr),
+			current_firmware = COALESCE(NULLIF(excluded.current_firmware, ''), cable_modem.current_firmware),
+			config_file = COALESCE(NULLIF(excluded.config_file, ''), cable_modem.config_file),
+			vendor = COALESCE(NULLIF(excluded.vendor, ''), cable_modem.vendor),
 			signal_level = excluded.signal_level,
+			ofdm_power = excluded.ofdm_power,
 			status = excluded.status,
-			last_seen = excluded.last_seen`,
-		modem.CMTSID, modem.MACAddress, modem.IPAddress, modem.SysDescr,
-		modem.CurrentFirmware, modem.SignalLevel, modem.Status, now)
-
+			last_seen = excluded.last_seen`))
 	if err != nil {
-		return fmt.Errorf("failed to upsert modem: %w", err)
+		return fmt.Errorf("failed to prepare modem upsert: %w", err)
 	}
+	defer upsertStmt.Close()
 
-	return nil
-}
+	historyStmt, err := tx.Prepare(db.rebind(`
+		INSERT INTO modem_signal_history (modem_id, signal_level, ofdm_power, recorded_at)
+		SELECT id, ?, ?, ? FROM cable_modem WHERE mac_address = ?`))
+	if err != nil {
+		return fmt.Errorf("failed to prepare signal history insert: %w", err)
+	}
+	defer historyStmt.Close()
 
-// CleanupStaleModems marks modems as offline if not seen recently and deletes very old modems
-func (db *DB) CleanupStaleModems(offlineThresholdMinutes int, deleteThresholdDays int) (int, int, error) {
 	now := time.Now().Unix()
-	offlineThreshold := now - int64(offlineThresholdMinutes*60)
-	deleteThreshold := now - int64(deleteThresholdDays*24*60*60)
-
-	var markedOffline, deleted int64
+	var transitions []*models.ActivityLog
+	for _, modem := range modems {
+		var id, previousCMTS int
+		var previous string
+		var previousSignal, previousOFDM sql.NullFloat64
+		var lastRecorded sql.NullInt64
+		err := selectStmt.QueryRow(modem.MACAddress).Scan(&id, &previousCMTS, &previous,
+			&previousSignal, &previousOFDM, &lastRecorded)
+		if err != nil && err != sql.ErrNoRows {
+			return fmt.Errorf("failed to get modem %s: %w", modem.MACAddress, err)
+		}
+		existed := err == nil
 
-	// Retry up to 3 times with backoff for database locked errors
-	for attempt := 0; attempt < 3; attempt++ {
-		if attempt > 0 {
-			time.Sleep(time.Millisecond * time.Duration(100*attempt))
+		var signalLevel interface{} = modem.SignalLevel
+		if modem.SignalUnavailable {
+			signalLevel = nil
+		}
+		var ofdmPower interface{}
+		if modem.OFDMPower != 0 {
+			ofdmPower = modem.OFDMPower
 		}
 
-		// Mark modems as offline if not seen in X minutes
-		result, err := db.conn.Exec(`
-			UPDATE cable_modem
-			SET status = 'offline'
-			WHERE last_seen < ?
-			AND status != 'offline'`,
-			offlineThreshold)
+		_, err = upsertStmt.Exec(modem.CMTSID, modem.MACAddress, modem.IfIndex, modem.IfDescr, modem.IPAddress,
+			modem.SysDescr, modem.CurrentFirmware, modem.ConfigFile, modem.Vendor, signalLevel, ofdmPower, modem.Status, now)
 		if err != nil {
-			if attempt < 2 {
-				continue
-			}
-			return 0, 0, fmt.Errorf("failed to mark stale modems offline: %w", err)
+			return fmt.Errorf("failed to upsert modem %s: %w", modem.MACAddress, err)
 		}
 
-		markedOffline, _ = result.RowsAffected()
+		unchanged := existed && lastRecorded.Valid &&
+			now-lastRecorded.Int64 < int64(signalHistoryInterval/time.Second) &&
+			sameReading(previousSignal, signalLevel) && sameReading(previousOFDM, ofdmPower)
+		if (signalLevel != nil || ofdmPower != nil) && !unchanged {
+			if _, err := historyStmt.Exec(signalLevel, ofdmPower, now, modem.MACAddress); err != nil {
+				return fmt.Errorf("failed to record signal history for %s: %w", modem.MACAddress, err)
+			}
+		}
 
-		// Delete modems that have been offline for Y days
-		result, err = db.conn.Exec(`
-			DELETE FROM cable_modem
-			WHERE last_seen < ?
-			AND status = 'offline'`,
-			deleteThreshold)
-		if err != nil {
-			if attempt < 2 {
-				continue
+		if existed {
+			if transition := modemTransition(id, previous, modem); transition != nil {
+				transitions = append(transitions, transition)
+			}
+			if move := modemMove(id, previousCMTS, modem); move != nil {
+				transitions = append(transitions, move)
 			}
-			return int(markedOffline), 0, fmt.Errorf("failed to delete old modems: %w", err)
 		}
+	}
 
-		deleted, _ = result.RowsAffected()
-		break
+	if err := db.logActivities(tx, transitions, now); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit modem upsert: %w", err)
 	}
 
-	return int(markedOffline), int(deleted), nil
+	return nil
+}
+
+// signalHistoryInterval is the longest a steady signal goes without a new
+// history reading, so graphs still have points when nothing changes
+const signalHistoryInterval = time.Hour
+
+// sameReading reports whether a stored level equals a new one, either of
+// which may be missing
+func sameReading(stored sql.NullFloat64, level interface{}) bool {
+	if level == nil {
+		return !stored.Valid
+	}
+	return stored.Valid && stored.Float64 == level.(float64)
+}
+
+// modemTransition returns the activity to log when a modem's status changes
+// from previous, or nil. Only moves into and out of "online" are recorded;
+// an unknown status is never treated as a change.
+func modemTransition(id int, previous string, modem *models.CableModem) *models.ActivityLog {
+	if previous == "" || modem.Status == "" || previous == modem.Status {
+		return nil
+	}
+
+	switch {
+	case modem.Status == "online":
+		return &models.ActivityLog{
+			EventType:  models.EventModemOnline,
+			EntityType: "modem",
+			EntityID:   id,
+			Message:    fmt.Sprintf("Modem %s came online (was %s)", modem.MACAddress, previous),
+		}
+	case previous == "online":
+		return &models.ActivityLog{
+			EventType:  models.EventModemLost,
+			EntityType: "modem",
+			EntityID:   id,
+			Message:    fmt.Sprintf("Modem %s went %s (was online)", modem.MACAddress, modem.Status),
+		}
+	}
+	return nil
+}
+
+// modemMove returns the activity to log when a modem re-registers on a
+// different CMTS than previousCMTS, or nil. A move often points at a node
+// split or a provisioning error, so operators want it flagged.
+func modemMove(id, previousCMTS int, modem *models.CableModem) *models.ActivityLog {
+	if previousCMTS == modem.CMTSID {
+		return nil
+	}
+
+	details, _ := json.Marshal(map[string]int{
+		"from_cmts_id": previousCMTS,
+		"to_cmts_id":   modem.CMTSID,
+	})
+	return &models.ActivityLog{
+		EventType:  models.EventModemMoved,
+		EntityType: "modem",
+		EntityID:   id,
+		Message:    fmt.Sprintf("Modem %s moved from CMTS %d to CMTS %d", modem.MACAddress, previousCMTS, modem.CMTSID),
+		Details:    string(details),
+	}
+}
+
+// CleanupStaleModems marks modems not seen for offlineThresholdMinutes as
+// offline, then deletes offline modems not seen for deleteThresholdDays. It
+// returns how many modems each step changed. Both steps run in one
+// transaction, so a retry after a locked database never double counts.
+func (db *DB) CleanupStaleModems(offlineThresholdMinutes int, deleteThresholdDays int) (int, int, error) {
+	now := time.Now().Unix()
+	offlineThreshold := now - int64(offlineThresholdMinutes*60)
+	deleteThreshold := now - int64(deleteThresholdDays*24*60*60)
+
+	var markedOffline, deleted int64
+	var err error
+
+	// Retry up to 3 times with backoff for database locked errors
+	for attempt := 0; attempt < 3; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Millisecond * time.Duration(100*attempt))
+		}
+
+		err = db.WithTx(func(tx *Tx) error {
+			// Mark modems as offline if not seen in X minutes
+			result, err := tx.tx.Exec(db.rebind(`
+				UPDATE cable_modem
+				SET status = 'offline'
+				WHERE last_seen < ?
+				AND status != 'offline'`),
+				offlineThreshold)
+			if err != nil {
+				return fmt.Errorf("failed to mark stale modems offline: %w", err)
+			}
+			if markedOffline, err = result.RowsAffected(); err != nil {
+				return fmt.Errorf("failed to count modems marked offline: %w", err)
+			}
+
+			// Delete modems that have been offline for Y days. SQLite
+			// doesn't enforce the signal history's ON DELETE CASCADE or
+			// the jobs' ON DELETE SET NULL.
+			if _, err := tx.tx.Exec(db.rebind(`
+				DELETE FROM modem_signal_history WHERE modem_id IN (
+					SELECT id FROM cable_modem WHERE last_seen < ? AND status = 'offline')`),
+				deleteThreshold); err != nil {
+				return fmt.Errorf("failed to delete signal history of old modems: %w", err)
+			}
+			if _, err := tx.tx.Exec(db.rebind(`
+				UPDATE upgrade_job SET modem_id = NULL WHERE modem_id IN (
+					SELECT id FROM cable_modem WHERE last_seen < ? AND status = 'offline')`),
+				deleteThreshold); err != nil {
+				return fmt.Errorf("failed to detach jobs of old modems: %w", err)
+			}
+			result, err = tx.tx.Exec(db.rebind(`
+				DELETE FROM cable_modem
+				WHERE last_seen < ?
+				AND status = 'offline'`),
+				deleteThreshold)
+			if err != nil {
+				return fmt.Errorf("failed to delete old modems: %w", err)
+			}
+			if deleted, err = result.RowsAffected(); err != nil {
+				return fmt.Errorf("failed to count deleted modems: %w", err)
+			}
+			return nil
+		})
+		if err == nil {
+			return int(markedOffline), int(deleted), nil
+		}
+	}
+
+	return 0, 0, err
+}
+
+// DeleteModemsByCMTS deletes every modem on a CMTS. Modems with a pending or
+// in-progress job are kept and their MACs returned, so an upgrade in flight
+// never loses its modem.
+func (db *DB) DeleteModemsByCMTS(cmtsID int) (int, []string, error) {
+	return db.deleteCMTSModems(cmtsID, "")
+}
+
+// DeleteStaleModemsByCMTS deletes the modems on a CMTS last seen before
+// seenBefore, keeping those with active jobs like DeleteModemsByCMTS
+func (db *DB) DeleteStaleModemsByCMTS(cmtsID int, seenBefore time.Time) (int, []string, error) {
+	return db.deleteCMTSModems(cmtsID, " AND last_seen < ?", seenBefore.Unix())
+}
+
+// deleteCMTSModems deletes a CMTS's modems matching the extra condition,
+// returning how many went and the MACs skipped for their active jobs
+func (db *DB) deleteCMTSModems(cmtsID int, condition string, args ...interface{}) (int, []string, error) {
+	activeJobs := `SELECT modem_id FROM upgrade_job WHERE modem_id IS NOT NULL AND status IN (?, ?)`
+	params := append([]interface{}{cmtsID}, args...)
+	params = append(params, models.JobStatusPending, models.JobStatusInProgress)
+
+	var deleted int64
+	var skipped []string
+	err := db.WithTx(func(tx *Tx) error {
+		rows, err := tx.tx.Query(db.rebind(`
+			SELECT mac_address FROM cable_modem
+			WHERE cmts_id = ?`+condition+` AND id IN (`+activeJobs+`)
+			ORDER BY mac_address`), params...)
+		if err != nil {
+			return fmt.Errorf("failed to find modems with active jobs: %w", err)
+		}
+		for rows.Next() {
+			var mac string
+			if err := rows.Scan(&mac); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan modem: %w", err)
+			}
+			skipped = append(skipped, mac)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		doomed := `SELECT id FROM cable_modem
+			WHERE cmts_id = ?` + condition + ` AND id NOT IN (` + activeJobs + `)`
+		if _, err := tx.tx.Exec(db.rebind(`
+			DELETE FROM modem_signal_history WHERE modem_id IN (`+doomed+`)`), params...); err != nil {
+			return fmt.Errorf("failed to delete signal history of modems: %w", err)
+		}
+		if _, err := tx.tx.Exec(db.rebind(`
+			UPDATE upgrade_job SET modem_id = NULL WHERE modem_id IN (`+doomed+`)`), params...); err != nil {
+			return fmt.Errorf("failed to detach jobs of modems: %w", err)
+		}
+
+		result, err := tx.tx.Exec(db.rebind(`
+			DELETE FROM cable_modem WHERE id IN (`+doomed+`)`), params...)
+		if err != nil {
+			return fmt.Errorf("failed to delete modems: %w", err)
+		}
+		deleted, err = result.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	return int(deleted), skipped, nil
 }
 
 // GetModem retrieves a modem by ID
 func (db *DB) GetModem(id int) (*models.CableModem, error) {
-	var modem models.CableModem
-	var lastSeen int64
+	return db.getModem("id = ?", id)
+}
 
-	err := db.conn.QueryRow(`
-		SELECT id, cmts_id, mac_address, ip_address, sysdescr, current_firmware,
-			signal_level, status, last_seen
-		FROM cable_modem WHERE id = ?`, id).Scan(
-		&modem.ID, &modem.CMTSID, &modem.MACAddress, &modem.IPAddress, &modem.SysDescr,
-		&modem.CurrentFirmware, &modem.SignalLevel, &modem.Status, &lastSeen)
+// GetModemByMAC retrieves a modem by MAC address in any notation. MACs are
+// normalised here rather than compared with UPPER() so the lookup can use
+// the mac_address index; should a MAC somehow be stored twice, the modem
+// seen most recently wins.
+func (db *DB) GetModemByMAC(mac string) (*models.CableModem, error) {
+	return db.getModem("mac_address = ? ORDER BY last_seen DESC, id LIMIT 1", normalizeMAC(mac))
+}
+
+// normalizeMAC puts a MAC in the stored AA:BB:CC:DD:EE:FF form, or just
+// upper-cases it if it doesn't parse
+func normalizeMAC(mac string) string {
+	mac = strings.TrimSpace(mac)
+	if hw, err := models.ParseMAC(mac); err == nil && len(hw) == 6 {
+		return strings.ToUpper(hw.String())
+	}
+	return strings.ToUpper(mac)
+}
+
+func (db *DB) getModem(where string, arg interface{}) (*models.CableModem, error) {
+	modem, err := scanModem(db.queryRow(`
+		SELECT `+modemColumns+`
+		FROM cable_modem WHERE `+where, arg))
 
 	if err == sql.ErrNoRows {
 		return nil, models.ErrNotFound
@@ -487,52 +1307,255 @@ func (db *DB) GetModem(id int) (*models.CableModem, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to get modem: %w", err)
 	}
+	return modem, nil
+}
+
+// modemColumns is the column list read by scanModem
+const modemColumns = `id, cmts_id, mac_address, COALESCE(if_index, ''), COALESCE(if_descr, ''),
+			ip_address, sysdescr, current_firmware, signal_level, ofdm_power,
+			COALESCE(expected_firmware, ''), COALESCE(config_file, ''), COALESCE(vendor, ''), COALESCE(tags, ''), status, last_seen`
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanModem reads one modem selected with modemColumns
+func scanModem(row rowScanner) (*models.CableModem, error) {
+	var modem models.CableModem
+	var lastSeen int64
+	var signalLevel, ofdmPower sql.NullFloat64
+	var tags string
+
+	err := row.Scan(&modem.ID, &modem.CMTSID, &modem.MACAddress, &modem.IfIndex,
+		&modem.IfDescr, &modem.IPAddress, &modem.SysDescr, &modem.CurrentFirmware, &signalLevel, &ofdmPower,
+		&modem.ExpectedFirmware, &modem.ConfigFile, &modem.Vendor, &tags, &modem.Status, &lastSeen)
+	if err != nil {
+		return nil, err
+	}
+	if tags != "" {
+		if err := json.Unmarshal([]byte(tags), &modem.Tags); err != nil {
+			return nil, fmt.Errorf("invalid tags for modem %d: %w", modem.ID, err)
+		}
+	}
 
+	modem.SignalLevel = signalLevel.Float64
+	modem.SignalUnavailable = !signalLevel.Valid
+	modem.OFDMPower = ofdmPower.Float64
 	modem.LastSeen = time.Unix(lastSeen, 0)
 	return &modem, nil
 }
 
+// scanModems reads every modem selected with modemColumns
+func scanModems(rows *sql.Rows) ([]*models.CableModem, error) {
+	var modems []*models.CableModem
+	for rows.Next() {
+		modem, err := scanModem(rows)
+		if err != nil {
+			return nil, err
+		}
+		modems = append(modems, modem)
+	}
+	return modems, rows.Err()
+}
+
 // ListModems retrieves all modems, optionally filtered by CMTS
 func (db *DB) ListModems(cmtsID int) ([]*models.CableModem, error) {
+	return db.ListModemsPage(cmtsID, 0, 0)
+}
+
+// ListModemsPage retrieves a page of modems, optionally filtered by CMTS.
+// A limit of 0 returns all modems from offset onwards.
+func (db *DB) ListModemsPage(cmtsID, limit, offset int) ([]*models.CableModem, error) {
 	query := `
-		SELECT id, cmts_id, mac_address, ip_address, sysdescr, current_firmware,
-			signal_level, status, last_seen
+		SELECT ` + modemColumns + `
 		FROM cable_modem`
 
-	var rows *sql.Rows
-	var err error
+	// Modems of a soft-deleted CMTS are hidden as if they had cascaded
+	query += " WHERE cmts_id IN (SELECT id FROM cmts WHERE deleted_at IS NULL)"
 
+	var args []interface{}
 	if cmtsID > 0 {
-		query += " WHERE cmts_id = ? ORDER BY last_seen DESC"
-		rows, err = db.conn.Query(query, cmtsID)
-	} else {
-		query += " ORDER BY last_seen DESC"
-		rows, err = db.conn.Query(query)
+		query += " AND cmts_id = ?"
+		args = append(args, cmtsID)
 	}
+	query += " ORDER BY last_seen DESC, id"
+	if limit > 0 {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, limit, offset)
+	} else if offset > 0 {
+		query += " LIMIT " + db.noLimit() + " OFFSET ?"
+		args = append(args, offset)
+	}
+
+	rows, err := db.query(query, args...)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to list modems: %w", err)
 	}
 	defer rows.Close()
 
-	var modems []*models.CableModem
-	for rows.Next() {
-		var modem models.CableModem
-		var lastSeen int64
+	return scanModems(rows)
+}
+
+// SetModemExpectedFirmware records the firmware a modem is supposed to run
+func (db *DB) SetModemExpectedFirmware(modemID int, firmware string) error {
+	result, err := db.exec(`UPDATE cable_modem SET expected_firmware = ? WHERE id = ?`,
+		firmware, modemID)
+	if err != nil {
+		return fmt.Errorf("failed to set expected firmware: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return models.ErrNotFound
+	}
+	return nil
+}
 
-		err := rows.Scan(&modem.ID, &modem.CMTSID, &modem.MACAddress, &modem.IPAddress,
-			&modem.SysDescr, &modem.CurrentFirmware, &modem.SignalLevel,
-			&modem.Status, &lastSeen)
+// SetModemTags replaces a modem's tags. Tags are trimmed; an empty list
+// clears them. Discovery leaves tags alone.
+func (db *DB) SetModemTags(id int, tags []string) error {
+	if err := models.ValidateTags(tags); err != nil {
+		return err
+	}
 
+	var stored string
+	if len(tags) > 0 {
+		trimmed := make([]string, len(tags))
+		for i, tag := range tags {
+			trimmed[i] = strings.TrimSpace(tag)
+		}
+		data, err := json.Marshal(trimmed)
 		if err != nil {
+			return fmt.Errorf("failed to encode tags: %w", err)
+		}
+		stored = string(data)
+	}
+
+	result, err := db.exec(`UPDATE cable_modem SET tags = ? WHERE id = ?`, stored, id)
+	if err != nil {
+		return fmt.Errorf("failed to set modem tags: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return models.ErrNotFound
+	}
+	return nil
+}
+
+// ListFirmwareDrift retrieves modems whose discovered firmware no longer
+// contains their expected firmware, e.g. after a factory reset. Modems with
+// a pending or in-progress job are still converging and are left out.
+func (db *DB) ListFirmwareDrift(limit int) ([]*models.CableModem, error) {
+	query := `
+		SELECT ` + modemColumns + `
+		FROM cable_modem
+		WHERE cmts_id IN (SELECT id FROM cmts WHERE deleted_at IS NULL)
+		AND COALESCE(expected_firmware, '') != ''
+		AND COALESCE(current_firmware, '') NOT LIKE '%' || expected_firmware || '%'
+		AND id NOT IN (
+			SELECT modem_id FROM upgrade_job WHERE modem_id IS NOT NULL AND status IN (?, ?))
+		ORDER BY last_seen DESC, id`
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+
+	rows, err := db.query(query, models.JobStatusPending, models.JobStatusInProgress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list firmware drift: %w", err)
+	}
+	defer rows.Close()
+
+	return scanModems(rows)
+}
+
+// FirmwareDistribution returns the number of modems on each firmware
+// version, optionally limited to one CMTS (cmtsID 0 = all). Modems with no
+// known firmware are counted under the empty string.
+func (db *DB) FirmwareDistribution(cmtsID int) (map[string]int, error) {
+	query := `
+		SELECT COALESCE(current_firmware, ''), COUNT(*) FROM cable_modem
+		WHERE cmts_id IN (SELECT id FROM cmts WHERE deleted_at IS NULL)`
+	var args []interface{}
+	if cmtsID > 0 {
+		query += " AND cmts_id = ?"
+		args = append(args, cmtsID)
+	}
+	query += " GROUP BY COALESCE(current_firmware, '')"
+
+	rows, err := db.query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count firmware versions: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var firmware string
+		var count int
+		if err := rows.Scan(&firmware, &count); err != nil {
+			return nil, err
+		}
+		counts[strings.TrimSpace(firmware)] += count
+	}
+
+	return counts, rows.Err()
+}
+
+// VendorDistribution returns the number of modems from each vendor,
+// optionally limited to one CMTS (cmtsID 0 = all). Modems with no known
+// vendor are counted under the empty string.
+func (db *DB) VendorDistribution(cmtsID int) (map[string]int, error) {
+	query := `
+		SELECT COALESCE(vendor, ''), COUNT(*) FROM cable_modem
+		WHERE cmts_id IN (SELECT id FROM cmts WHERE deleted_at IS NULL)`
+	var args []interface{}
+	if cmtsID > 0 {
+		query += " AND cmts_id = ?"
+		args = append(args, cmtsID)
+	}
+	query += " GROUP BY COALESCE(vendor, '')"
+
+	rows, err := db.query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count vendors: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var vendor string
+		var count int
+		if err := rows.Scan(&vendor, &count); err != nil {
 			return nil, err
 		}
+		counts[vendor] += count
+	}
+
+	return counts, rows.Err()
+}
+
+// CountModemsByStatus returns the number of modems on a CMTS per status
+func (db *DB) CountModemsByStatus(cmtsID int) (map[string]int, error) {
+	rows, err := db.query(`
+		SELECT status, COUNT(*) FROM cable_modem
+		WHERE cmts_id = ?
+		GROUP BY status
+	`, cmtsID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count modems: %w", err)
+	}
+	defer rows.Close()
 
-		modem.LastSeen = time.Unix(lastSeen, 0)
-		modems = append(modems, &modem)
+	counts := make(map[string]int)
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, err
+		}
+		counts[status] = count
 	}
 
-	return modems, nil
+	return counts, rows.Err()
 }
 
 // Upgrade Rule operations
@@ -544,23 +1567,18 @@ func (db *DB) CreateRule(rule *models.UpgradeRule) (int, error) {
 	}
 
 	now := time.Now().Unix()
-	result, err := db.conn.Exec(`
+	id, err := db.insert(db.conn, `
 		INSERT INTO upgrade_rule (name, description, match_type, match_criteria,
-			tftp_server_ip, firmware_filename, enabled, priority, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			tftp_server_ip, firmware_filename, enabled, priority, dry_run, canary_percent, max_concurrent, admin_status_value, custom_upgrade_oid, transport_protocol, exclude, max_retries, upgrade_poll_interval, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		rule.Name, rule.Description, rule.MatchType, rule.MatchCriteria,
-		rule.TFTPServerIP, rule.FirmwareFilename, rule.Enabled, rule.Priority, now, now)
+		rule.TFTPServerIP, rule.FirmwareFilename, rule.Enabled, rule.Priority, rule.DryRun, rule.CanaryPercent, rule.MaxConcurrent, rule.AdminStatusValue, rule.CustomUpgradeOID, rule.TransportProtocol, rule.Exclude, rule.MaxRetries, rule.UpgradePollInterval, now, now)
 
 	if err != nil {
 		return 0, fmt.Errorf("failed to create rule: %w", err)
 	}
 
-	id, err := result.LastInsertId()
-	if err != nil {
-		return 0, err
-	}
-
-	return int(id), nil
+	return id, nil
 }
 
 // GetRule retrieves a rule by ID
@@ -568,13 +1586,49 @@ func (db *DB) GetRule(id int) (*models.UpgradeRule, error) {
 	var rule models.UpgradeRule
 	var createdAt, updatedAt int64
 
-	err := db.conn.QueryRow(`
+	err := db.queryRow(`
 		SELECT id, name, description, match_type, match_criteria, tftp_server_ip,
-			firmware_filename, enabled, priority, created_at, updated_at
+			firmware_filename, enabled, priority, dry_run, canary_percent, max_concurrent, admin_status_value, custom_upgrade_oid, COALESCE(transport_protocol, ''), exclude, COALESCE(max_retries, 3), COALESCE(upgrade_poll_interval, 0), created_at, updated_at
 		FROM upgrade_rule WHERE id = ?`, id).Scan(
 		&rule.ID, &rule.Name, &rule.Description, &rule.MatchType, &rule.MatchCriteria,
 		&rule.TFTPServerIP, &rule.FirmwareFilename, &rule.Enabled, &rule.Priority,
-		&createdAt, &updatedAt)
+		&rule.DryRun, &rule.CanaryPercent, &rule.MaxConcurrent, &rule.AdminStatusValue, &rule.CustomUpgradeOID, &rule.TransportProtocol, &rule.Exclude, &rule.MaxRetries, &rule.UpgradePollInterval, &createdAt, &updatedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rule: %w", err)
+	}
+
+	rule.CreatedAt = time.Unix(createdAt, 0)
+	rule.UpdatedAt = time.Unix(updatedAt, 0)
+
+	return &rule, nil
+}
+
+// rowQuerier is satisfied by both *sql.DB and *sql.Tx
+type rowQuerier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// GetRuleByName retrieves a rule by name. If several rules share a name the
+// oldest one is returned.
+func (db *DB) GetRuleByName(name string) (*models.UpgradeRule, error) {
+	return db.getRuleByName(db.conn, name)
+}
+
+func (db *DB) getRuleByName(q rowQuerier, name string) (*models.UpgradeRule, error) {
+	var rule models.UpgradeRule
+	var createdAt, updatedAt int64
+
+	err := q.QueryRow(db.rebind(`
+		SELECT id, name, description, match_type, match_criteria, tftp_server_ip,
+			firmware_filename, enabled, priority, dry_run, canary_percent, max_concurrent, admin_status_value, custom_upgrade_oid, COALESCE(transport_protocol, ''), exclude, COALESCE(max_retries, 3), COALESCE(upgrade_poll_interval, 0), created_at, updated_at
+		FROM upgrade_rule WHERE name = ? ORDER BY id LIMIT 1`), name).Scan(
+		&rule.ID, &rule.Name, &rule.Description, &rule.MatchType, &rule.MatchCriteria,
+		&rule.TFTPServerIP, &rule.FirmwareFilename, &rule.Enabled, &rule.Priority,
+		&rule.DryRun, &rule.CanaryPercent, &rule.MaxConcurrent, &rule.AdminStatusValue, &rule.CustomUpgradeOID, &rule.TransportProtocol, &rule.Exclude, &rule.MaxRetries, &rule.UpgradePollInterval, &createdAt, &updatedAt)
 
 	if err == sql.ErrNoRows {
 		return nil, models.ErrNotFound
@@ -589,11 +1643,86 @@ func (db *DB) GetRule(id int) (*models.UpgradeRule, error) {
 	return &rule, nil
 }
 
+// ImportRules upserts rules by name in a single transaction. Every rule is
+// validated first, so an invalid entry leaves the existing rules untouched.
+func (db *DB) ImportRules(rules []*models.UpgradeRule) (created, updated int, err error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	created, updated, err = db.importRules(tx, rules)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, 0, fmt.Errorf("failed to commit rule import: %w", err)
+	}
+
+	return created, updated, nil
+}
+
+// importRules validates rules and upserts them by name within tx
+func (db *DB) importRules(tx *sql.Tx, rules []*models.UpgradeRule) (created, updated int, err error) {
+	seen := make(map[string]bool)
+	for i, rule := range rules {
+		if rule == nil {
+			return 0, 0, fmt.Errorf("rule %d: missing rule", i+1)
+		}
+		if err := rule.Validate(); err != nil {
+			return 0, 0, fmt.Errorf("rule %d (%q): %w", i+1, rule.Name, err)
+		}
+		if seen[rule.Name] {
+			return 0, 0, fmt.Errorf("rule %d (%q): duplicate rule name", i+1, rule.Name)
+		}
+		seen[rule.Name] = true
+	}
+
+	now := time.Now().Unix()
+	for _, rule := range rules {
+		existing, err := db.getRuleByName(tx, rule.Name)
+		if err != nil && err != models.ErrNotFound {
+			return 0, 0, err
+		}
+
+		if existing == nil {
+			_, err = tx.Exec(db.rebind(`
+				INSERT INTO upgrade_rule (name, description, match_type, match_criteria,
+					tftp_server_ip, firmware_filename, enabled, priority, dry_run, canary_percent, max_concurrent, admin_status_value, custom_upgrade_oid, transport_protocol, exclude, max_retries, upgrade_poll_interval, created_at, updated_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`),
+				rule.Name, rule.Description, rule.MatchType, rule.MatchCriteria,
+				rule.TFTPServerIP, rule.FirmwareFilename, rule.Enabled, rule.Priority, rule.DryRun, rule.CanaryPercent, rule.MaxConcurrent, rule.AdminStatusValue, rule.CustomUpgradeOID, rule.TransportProtocol, rule.Exclude, rule.MaxRetries, rule.UpgradePollInterval, now, now)
+			if err != nil {
+				return 0, 0, fmt.Errorf("failed to create rule %q: %w", rule.Name, err)
+			}
+			created++
+			continue
+		}
+
+		_, err = tx.Exec(db.rebind(`
+			UPDATE upgrade_rule SET description = ?, match_type = ?,
+				match_criteria = ?, tftp_server_ip = ?, firmware_filename = ?,
+				enabled = ?, priority = ?, dry_run = ?, canary_percent = ?, max_concurrent = ?, admin_status_value = ?, custom_upgrade_oid = ?, transport_protocol = ?, exclude = ?, max_retries = ?, upgrade_poll_interval = ?, updated_at = ?
+			WHERE id = ?`),
+			rule.Description, rule.MatchType, rule.MatchCriteria,
+			rule.TFTPServerIP, rule.FirmwareFilename, rule.Enabled, rule.Priority,
+			rule.DryRun, rule.CanaryPercent, rule.MaxConcurrent, rule.AdminStatusValue, rule.CustomUpgradeOID, rule.TransportProtocol, rule.Exclude, rule.MaxRetries, rule.UpgradePollInterval, now, existing.ID)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to update rule %q: %w", rule.Name, err)
+		}
+		updated++
+	}
+
+	return created, updated, nil
+}
+
 // ListRules retrieves all upgrade rules
 func (db *DB) ListRules() ([]*models.UpgradeRule, error) {
-	rows, err := db.conn.Query(`
+	rows, err := db.query(`
 		SELECT id, name, description, match_type, match_criteria, tftp_server_ip,
-			firmware_filename, enabled, priority, created_at, updated_at
+			firmware_filename, enabled, priority, dry_run, canary_percent, max_concurrent, admin_status_value, custom_upgrade_oid, COALESCE(transport_protocol, ''), exclude, COALESCE(max_retries, 3), COALESCE(upgrade_poll_interval, 0), created_at, updated_at
 		FROM upgrade_rule ORDER BY priority DESC, name`)
 
 	if err != nil {
@@ -608,7 +1737,7 @@ func (db *DB) ListRules() ([]*models.UpgradeRule, error) {
 
 		err := rows.Scan(&rule.ID, &rule.Name, &rule.Description, &rule.MatchType,
 			&rule.MatchCriteria, &rule.TFTPServerIP, &rule.FirmwareFilename,
-			&rule.Enabled, &rule.Priority, &createdAt, &updatedAt)
+			&rule.Enabled, &rule.Priority, &rule.DryRun, &rule.CanaryPercent, &rule.MaxConcurrent, &rule.AdminStatusValue, &rule.CustomUpgradeOID, &rule.TransportProtocol, &rule.Exclude, &rule.MaxRetries, &rule.UpgradePollInterval, &createdAt, &updatedAt)
 
 		if err != nil {
 			return nil, err
@@ -629,14 +1758,14 @@ func (db *DB) UpdateRule(rule *models.UpgradeRule) error {
 	}
 
 	now := time.Now().Unix()
-	result, err := db.conn.Exec(`
+	result, err := db.exec(`
 		UPDATE upgrade_rule SET name = ?, description = ?, match_type = ?,
 			match_criteria = ?, tftp_server_ip = ?, firmware_filename = ?,
-			enabled = ?, priority = ?, updated_at = ?
+			enabled = ?, priority = ?, dry_run = ?, canary_percent = ?, max_concurrent = ?, admin_status_value = ?, custom_upgrade_oid = ?, transport_protocol = ?, exclude = ?, max_retries = ?, upgrade_poll_interval = ?, updated_at = ?
 		WHERE id = ?`,
 		rule.Name, rule.Description, rule.MatchType, rule.MatchCriteria,
 		rule.TFTPServerIP, rule.FirmwareFilename, rule.Enabled, rule.Priority,
-		now, rule.ID)
+		rule.DryRun, rule.CanaryPercent, rule.MaxConcurrent, rule.AdminStatusValue, rule.CustomUpgradeOID, rule.TransportProtocol, rule.Exclude, rule.MaxRetries, rule.UpgradePollInterval, now, rule.ID)
 
 	if err != nil {
 		return fmt.Errorf("failed to update rule: %w", err)
@@ -655,7 +1784,7 @@ func (db *DB) UpdateRule(rule *models.UpgradeRule) error {
 
 // DeleteRule deletes an upgrade rule
 func (db *DB) DeleteRule(id int) error {
-	result, err := db.conn.Exec("DELETE FROM upgrade_rule WHERE id = ?", id)
+	result, err := db.exec("DELETE FROM upgrade_rule WHERE id = ?", id)
 	if err != nil {
 		return fmt.Errorf("failed to delete rule: %w", err)
 	}
@@ -675,40 +1804,54 @@ func (db *DB) DeleteRule(id int) error {
 
 // CreateJob creates a new upgrade job
 func (db *DB) CreateJob(job *models.UpgradeJob) (int, error) {
+	return db.createJob(db.conn, job)
+}
+
+func (db *DB) createJob(q execQueryer, job *models.UpgradeJob) (int, error) {
 	now := time.Now().Unix()
-	result, err := db.conn.Exec(`
+	var campaignID interface{}
+	if job.CampaignID != 0 {
+		campaignID = job.CampaignID
+	}
+	if job.TraceID == "" {
+		job.TraceID = models.NewTraceID()
+	}
+	id, err := db.insert(q, `
 		INSERT INTO upgrade_job (modem_id, rule_id, cmts_id, mac_address, status,
-			tftp_server_ip, firmware_filename, retry_count, max_retries, created_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			tftp_server_ip, firmware_filename, retry_count, max_retries, created_at, campaign_id,
+			admin_status_value, custom_upgrade_oid, transport_protocol, upgrade_poll_interval, trace_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		job.ModemID, job.RuleID, job.CMTSID, job.MACAddress, job.Status,
-		job.TFTPServerIP, job.FirmwareFilename, job.RetryCount, job.MaxRetries, now)
+		job.TFTPServerIP, job.FirmwareFilename, job.RetryCount, job.MaxRetries, now, campaignID,
+		job.AdminStatusValue, job.CustomUpgradeOID, job.TransportProtocol, job.UpgradePollInterval, job.TraceID)
 
 	if err != nil {
 		return 0, fmt.Errorf("failed to create job: %w", err)
 	}
 
-	id, err := result.LastInsertId()
-	if err != nil {
-		return 0, err
-	}
-
-	return int(id), nil
+	return id, nil
 }
 
 // GetJob retrieves a job by ID
 func (db *DB) GetJob(id int) (*models.UpgradeJob, error) {
+	return db.getJob(db.conn, id)
+}
+
+func (db *DB) getJob(q rowQuerier, id int) (*models.UpgradeJob, error) {
 	var job models.UpgradeJob
 	var createdAt int64
-	var startedAt, completedAt sql.NullInt64
+	var startedAt, completedAt, nextRetryAt sql.NullInt64
+	var failureDetails string
 
-	err := db.conn.QueryRow(`
-		SELECT id, modem_id, rule_id, cmts_id, mac_address, status, tftp_server_ip,
-			firmware_filename, retry_count, max_retries, error_message,
-			created_at, started_at, completed_at
-		FROM upgrade_job WHERE id = ?`, id).Scan(
+	err := q.QueryRow(db.rebind(`
+		SELECT `+jobColumns+`,
+			COALESCE(failure_details, '')
+		FROM upgrade_job WHERE id = ?`), id).Scan(
 		&job.ID, &job.ModemID, &job.RuleID, &job.CMTSID, &job.MACAddress, &job.Status,
 		&job.TFTPServerIP, &job.FirmwareFilename, &job.RetryCount, &job.MaxRetries,
-		&job.ErrorMessage, &createdAt, &startedAt, &completedAt)
+		&job.ErrorMessage, &createdAt, &startedAt, &completedAt, &nextRetryAt, &job.DeadLetter,
+		&job.CampaignID, &job.AdminStatusValue, &job.CustomUpgradeOID, &job.TransportProtocol,
+		&job.UpgradePollInterval, &job.TraceID, &failureDetails)
 
 	if err == sql.ErrNoRows {
 		return nil, models.ErrNotFound
@@ -726,33 +1869,83 @@ func (db *DB) GetJob(id int) (*models.UpgradeJob, error) {
 		t := time.Unix(completedAt.Int64, 0)
 		job.CompletedAt = &t
 	}
+	if nextRetryAt.Valid {
+		t := time.Unix(nextRetryAt.Int64, 0)
+		job.NextRetryAt = &t
+	}
+	if failureDetails != "" {
+		if err := json.Unmarshal([]byte(failureDetails), &job.FailureDetails); err != nil {
+			return nil, fmt.Errorf("failed to decode failure details for job %d: %w", job.ID, err)
+		}
+	}
 
 	return &job, nil
 }
 
-// ListJobs retrieves jobs, optionally filtered by status
-func (db *DB) ListJobs(status string, limit int) ([]*models.UpgradeJob, error) {
-	query := `
-		SELECT id, modem_id, rule_id, cmts_id, mac_address, status, tftp_server_ip,
-			firmware_filename, retry_count, max_retries, error_message,
-			created_at, started_at, completed_at
-		FROM upgrade_job`
-
-	var rows *sql.Rows
-	var err error
+// AppendJobFailure adds failure to the end of a job's failure details
+func (db *DB) AppendJobFailure(id int, failure models.JobFailure) error {
+	return db.WithTx(func(tx *Tx) error {
+		job, err := tx.GetJob(id)
+		if err != nil {
+			return err
+		}
 
-	if status != "" {
-		query += " WHERE status = ? ORDER BY created_at DESC"
-		if limit > 0 {
-			query += fmt.Sprintf(" LIMIT %d", limit)
+		data, err := json.Marshal(append(job.FailureDetails, failure))
+		if err != nil {
+			return fmt.Errorf("failed to encode failure details: %w", err)
 		}
-		rows, err = db.conn.Query(query, status)
-	} else {
-		query += " ORDER BY created_at DESC"
-		if limit > 0 {
-			query += fmt.Sprintf(" LIMIT %d", limit)
+		if _, err := tx.tx.Exec(db.rebind(`UPDATE upgrade_job SET failure_details = ? WHERE id = ?`), string(data), id); err != nil {
+			return fmt.Errorf("failed to record job failure: %w", err)
 		}
-		rows, err = db.conn.Query(query)
+		return nil
+	})
+}
+
+// ListRuleJobMACs returns the MAC addresses that have a job in status for
+// ruleID and firmware
+func (db *DB) ListRuleJobMACs(ruleID int, firmware, status string) (map[string]bool, error) {
+	rows, err := db.query(`
+		SELECT DISTINCT mac_address FROM upgrade_job
+		WHERE rule_id = ? AND firmware_filename = ? AND status = ?
+	`, ruleID, firmware, status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rule job MACs: %w", err)
+	}
+	defer rows.Close()
+
+	macs := make(map[string]bool)
+	for rows.Next() {
+		var mac string
+		if err := rows.Scan(&mac); err != nil {
+			return nil, err
+		}
+		macs[mac] = true
+	}
+
+	return macs, rows.Err()
+}
+
+// ListJobs retrieves jobs, optionally filtered by status
+func (db *DB) ListJobs(status string, limit int) ([]*models.UpgradeJob, error) {
+	query := `
+		SELECT `+jobColumns+`
+		FROM upgrade_job`
+
+	var rows *sql.Rows
+	var err error
+
+	if status != "" {
+		query += " WHERE status = ? ORDER BY created_at DESC"
+		if limit > 0 {
+			query += fmt.Sprintf(" LIMIT %d", limit)
+		}
+		rows, err = db.query(query, status)
+	} else {
+		query += " ORDER BY created_at DESC"
+		if limit > 0 {
+			query += fmt.Sprintf(" LIMIT %d", limit)
+		}
+		rows, err = db.query(query)
 	}
 
 	if err != nil {
@@ -760,51 +1953,370 @@ func (db *DB) ListJobs(status string, limit int) ([]*models.UpgradeJob, error) {
 	}
 	defer rows.Close()
 
-	var jobs []*models.UpgradeJob
-	for rows.Next() {
-		var job models.UpgradeJob
-		var createdAt int64
-		var startedAt, completedAt sql.NullInt64
+	return scanJobs(rows)
+}
+
+// JobFilter narrows job exports and bulk retries. Zero values mean
+// unfiltered.
+type JobFilter struct {
+	Status string
+	CMTSID int
+	RuleID int
+	Since  time.Time
+	Until  time.Time
+}
 
-		err := rows.Scan(&job.ID, &job.ModemID, &job.RuleID, &job.CMTSID, &job.MACAddress,
-			&job.Status, &job.TFTPServerIP, &job.FirmwareFilename, &job.RetryCount,
-			&job.MaxRetries, &job.ErrorMessage, &createdAt, &startedAt, &completedAt)
+// where builds the WHERE clause and arguments for the filter
+func (f JobFilter) where() (string, []interface{}) {
+	var clauses []string
+	var args []interface{}
+
+	if f.Status != "" {
+		clauses = append(clauses, "status = ?")
+		args = append(args, f.Status)
+	}
+	if f.CMTSID > 0 {
+		clauses = append(clauses, "cmts_id = ?")
+		args = append(args, f.CMTSID)
+	}
+	if f.RuleID > 0 {
+		clauses = append(clauses, "rule_id = ?")
+		args = append(args, f.RuleID)
+	}
+	if !f.Since.IsZero() {
+		clauses = append(clauses, "created_at >= ?")
+		args = append(args, f.Since.Unix())
+	}
+	if !f.Until.IsZero() {
+		clauses = append(clauses, "created_at <= ?")
+		args = append(args, f.Until.Unix())
+	}
+
+	if len(clauses) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(clauses, " AND "), args
+}
+
+// StreamJobs calls fn for each matching job in creation order without
+// loading the full result set into memory
+func (db *DB) StreamJobs(filter JobFilter, fn func(*models.UpgradeJob) error) error {
+	where, args := filter.where()
+	rows, err := db.query(`
+		SELECT `+jobColumns+`
+		FROM upgrade_job`+where+` ORDER BY created_at, id`, args...)
+	if err != nil {
+		return fmt.Errorf("failed to stream jobs: %w", err)
+	}
+	defer rows.Close()
 
+	for rows.Next() {
+		job, err := scanJob(rows)
 		if err != nil {
+			return err
+		}
+		if err := fn(job); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// ListJobsByMAC retrieves every job for a modem, newest first. The MAC may
+// be in any notation, as for GetModemByMAC.
+func (db *DB) ListJobsByMAC(mac string) ([]*models.UpgradeJob, error) {
+	rows, err := db.query(`
+		SELECT `+jobColumns+`
+		FROM upgrade_job
+		WHERE mac_address = ?
+		ORDER BY created_at DESC, id DESC`, normalizeMAC(mac))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs for modem: %w", err)
+	}
+	defer rows.Close()
+
+	return scanJobs(rows)
+}
+
+// AverageUpgradeDuration returns the mean time in seconds a rule's completed
+// jobs took from start to completion, or 0 if none have completed
+func (db *DB) AverageUpgradeDuration(ruleID int) (float64, error) {
+	var avg sql.NullFloat64
+	err := db.queryRow(`
+		SELECT AVG(completed_at - started_at) FROM upgrade_job
+		WHERE rule_id = ? AND status = ?
+		AND started_at IS NOT NULL AND completed_at IS NOT NULL`,
+		ruleID, models.JobStatusCompleted).Scan(&avg)
+	if err != nil {
+		return 0, fmt.Errorf("failed to average upgrade duration: %w", err)
+	}
+	return avg.Float64, nil
+}
+
+// CountRuleJobsByStatus returns the number of a rule's jobs per status
+func (db *DB) CountRuleJobsByStatus(ruleID int) (map[string]int, error) {
+	rows, err := db.query(`
+		SELECT status, COUNT(*) FROM upgrade_job
+		WHERE rule_id = ?
+		GROUP BY status
+	`, ruleID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count rule jobs: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
 			return nil, err
 		}
+		counts[status] = count
+	}
+
+	return counts, rows.Err()
+}
 
-		job.CreatedAt = time.Unix(createdAt, 0)
-		if startedAt.Valid {
-			t := time.Unix(startedAt.Int64, 0)
-			job.StartedAt = &t
+// CountCMTSJobsByStatus returns the number of jobs per status ever created
+// for modems on a CMTS
+func (db *DB) CountCMTSJobsByStatus(cmtsID int) (map[string]int, error) {
+	rows, err := db.query(`
+		SELECT status, COUNT(*) FROM upgrade_job
+		WHERE cmts_id = ?
+		GROUP BY status
+	`, cmtsID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count CMTS jobs: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, err
 		}
-		if completedAt.Valid {
-			t := time.Unix(completedAt.Int64, 0)
-			job.CompletedAt = &t
+		counts[status] = count
+	}
+
+	return counts, rows.Err()
+}
+
+// ListDispatchablePendingJobs retrieves pending jobs whose retry backoff, if
+// any, has elapsed by now, oldest first
+func (db *DB) ListDispatchablePendingJobs(now time.Time, limit int) ([]*models.UpgradeJob, error) {
+	query := `
+		SELECT `+jobColumns+`
+		FROM upgrade_job
+		WHERE status = ? AND (next_retry_at IS NULL OR next_retry_at <= ?)
+		ORDER BY created_at, id`
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+
+	rows, err := db.query(query, models.JobStatusPending, now.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dispatchable jobs: %w", err)
+	}
+	defer rows.Close()
+
+	return scanJobs(rows)
+}
+
+// ListDeadLetterJobs retrieves failed jobs that won't be retried
+// automatically, most recently failed first
+func (db *DB) ListDeadLetterJobs(limit int) ([]*models.UpgradeJob, error) {
+	query := `
+		SELECT `+jobColumns+`
+		FROM upgrade_job
+		WHERE dead_letter = ?
+		ORDER BY completed_at DESC, id DESC`
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+
+	rows, err := db.query(query, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dead-letter jobs: %w", err)
+	}
+	defer rows.Close()
+
+	return scanJobs(rows)
+}
+
+// RequeueDeadLetterJobs resets dead-letter jobs to PENDING with a fresh retry
+// count. An empty ids slice requeues every dead-letter job. Jobs whose modem
+// already has a pending or in-progress job are left in place. It returns the
+// number of jobs requeued. A dead-letter job is only requeued while it is
+// its modem's newest job, so a modem never ends up with two pending jobs and
+// one that has since been upgraded is left alone. Jobs whose modem has been
+// deleted stay dead.
+func (db *DB) RequeueDeadLetterJobs(ids []int) (int, error) {
+	query := `
+		UPDATE upgrade_job SET status = ?, retry_count = 0, error_message = NULL,
+			started_at = NULL, completed_at = NULL, next_retry_at = NULL, dead_letter = ?
+		WHERE id IN (
+			SELECT MAX(id) FROM upgrade_job GROUP BY mac_address)
+		AND dead_letter = ? AND modem_id IS NOT NULL
+		AND mac_address NOT IN (
+			SELECT mac_address FROM upgrade_job WHERE status IN (?, ?))`
+	args := []interface{}{models.JobStatusPending, false, true,
+		models.JobStatusPending, models.JobStatusInProgress}
+
+	if len(ids) > 0 {
+		placeholders := make([]string, len(ids))
+		for i, id := range ids {
+			placeholders[i] = "?"
+			args = append(args, id)
 		}
+		query += " AND id IN (" + strings.Join(placeholders, ", ") + ")"
+	}
+
+	result, err := db.exec(query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to requeue dead-letter jobs: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(rows), nil
+}
+
+// RetryFailedJobs resets the FAILED jobs matching filter to PENDING with a
+// fresh retry count, as a single statement, and returns how many were reset.
+// filter.Status is ignored. Like RequeueDeadLetterJobs, a failed job is only
+// reset while it is its modem's newest job and modems with a pending or
+// in-progress job are skipped, so a modem never ends up with two and one
+// that has since been upgraded is never retried. Jobs whose modem has been
+// deleted are not retried either.
+func (db *DB) RetryFailedJobs(filter JobFilter) (int, error) {
+	filter.Status = models.JobStatusFailed
+	where, filterArgs := filter.where()
+
+	args := []interface{}{models.JobStatusPending, false}
+	args = append(args, filterArgs...)
+	args = append(args, models.JobStatusPending, models.JobStatusInProgress)
+
+	result, err := db.exec(`
+		UPDATE upgrade_job SET status = ?, retry_count = 0, error_message = NULL,
+			started_at = NULL, completed_at = NULL, next_retry_at = NULL, dead_letter = ?
+		WHERE id IN (
+			SELECT MAX(id) FROM upgrade_job GROUP BY mac_address)
+		AND id IN (SELECT id FROM upgrade_job`+where+`) AND modem_id IS NOT NULL
+		AND mac_address NOT IN (
+			SELECT mac_address FROM upgrade_job WHERE status IN (?, ?))`, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to retry failed jobs: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(rows), nil
+}
+
+// SkipPendingJobsByRule marks every PENDING job created by a rule as
+// SKIPPED, leaving in-progress jobs to finish. It returns the number of jobs
+// skipped.
+func (db *DB) SkipPendingJobsByRule(ruleID int) (int, error) {
+	result, err := db.exec(`
+		UPDATE upgrade_job SET status = ?, error_message = ?, completed_at = ?
+		WHERE rule_id = ? AND status = ?`,
+		models.JobStatusSkipped, "rule disabled", time.Now().Unix(),
+		ruleID, models.JobStatusPending)
+	if err != nil {
+		return 0, fmt.Errorf("failed to skip rule jobs: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(rows), nil
+}
+
+// jobColumns is the column list read by scanJob
+const jobColumns = `id, COALESCE(modem_id, 0), rule_id, cmts_id, mac_address, status, tftp_server_ip,
+			firmware_filename, retry_count, max_retries, error_message,
+			created_at, started_at, completed_at, next_retry_at, dead_letter,
+			COALESCE(campaign_id, 0), admin_status_value, custom_upgrade_oid, COALESCE(transport_protocol, ''),
+			COALESCE(upgrade_poll_interval, 0), COALESCE(trace_id, '')`
+
+// scanJob reads one job selected with jobColumns
+func scanJob(row rowScanner) (*models.UpgradeJob, error) {
+	var job models.UpgradeJob
+	var createdAt int64
+	var startedAt, completedAt, nextRetryAt sql.NullInt64
+
+	err := row.Scan(&job.ID, &job.ModemID, &job.RuleID, &job.CMTSID, &job.MACAddress,
+		&job.Status, &job.TFTPServerIP, &job.FirmwareFilename, &job.RetryCount,
+		&job.MaxRetries, &job.ErrorMessage, &createdAt, &startedAt, &completedAt,
+		&nextRetryAt, &job.DeadLetter, &job.CampaignID, &job.AdminStatusValue,
+		&job.CustomUpgradeOID, &job.TransportProtocol, &job.UpgradePollInterval, &job.TraceID)
+	if err != nil {
+		return nil, err
+	}
+
+	job.CreatedAt = time.Unix(createdAt, 0)
+	if startedAt.Valid {
+		t := time.Unix(startedAt.Int64, 0)
+		job.StartedAt = &t
+	}
+	if completedAt.Valid {
+		t := time.Unix(completedAt.Int64, 0)
+		job.CompletedAt = &t
+	}
+	if nextRetryAt.Valid {
+		t := time.Unix(nextRetryAt.Int64, 0)
+		job.NextRetryAt = &t
+	}
 
-		jobs = append(jobs, &job)
+	return &job, nil
+}
+
+// scanJobs reads the rows of a job query selecting jobColumns
+func scanJobs(rows *sql.Rows) ([]*models.UpgradeJob, error) {
+	var jobs []*models.UpgradeJob
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
 	}
 
-	return jobs, nil
+	return jobs, rows.Err()
 }
 
 // UpdateJob updates a job
 func (db *DB) UpdateJob(job *models.UpgradeJob) error {
-	var startedAt, completedAt interface{}
+	return db.updateJob(db.conn, job)
+}
+
+func (db *DB) updateJob(q execQueryer, job *models.UpgradeJob) error {
+	var startedAt, completedAt, nextRetryAt interface{}
 	if job.StartedAt != nil {
 		startedAt = job.StartedAt.Unix()
 	}
 	if job.CompletedAt != nil {
 		completedAt = job.CompletedAt.Unix()
 	}
+	if job.NextRetryAt != nil {
+		nextRetryAt = job.NextRetryAt.Unix()
+	}
 
-	result, err := db.conn.Exec(`
+	result, err := q.Exec(db.rebind(`
 		UPDATE upgrade_job SET status = ?, retry_count = ?, error_message = ?,
-			started_at = ?, completed_at = ?
-		WHERE id = ?`,
-		job.Status, job.RetryCount, job.ErrorMessage, startedAt, completedAt, job.ID)
+			started_at = ?, completed_at = ?, next_retry_at = ?, dead_letter = ?
+		WHERE id = ?`),
+		job.Status, job.RetryCount, job.ErrorMessage, startedAt, completedAt,
+		nextRetryAt, job.DeadLetter, job.ID)
 
 	if err != nil {
 		return fmt.Errorf("failed to update job: %w", err)
@@ -821,14 +2333,224 @@ func (db *DB) UpdateJob(job *models.UpgradeJob) error {
 	return nil
 }
 
+// PurgeOldJobs deletes finished jobs (completed, failed or skipped) that
+// finished before the cutoff. Pending and in-progress jobs are never purged.
+func (db *DB) PurgeOldJobs(olderThan time.Duration) (int, error) {
+	cutoff := time.Now().Add(-olderThan).Unix()
+
+	result, err := db.exec(`
+		DELETE FROM upgrade_job
+		WHERE status IN (?, ?, ?)
+		AND COALESCE(completed_at, created_at) < ?`,
+		models.JobStatusCompleted, models.JobStatusFailed, models.JobStatusSkipped, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge old jobs: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(rows), nil
+}
+
+// Campaign operations
+
+// campaignColumns is the column list read by scanCampaign
+const campaignColumns = `id, name, match_type, match_criteria, tftp_server_ip,
+			firmware_filename, start_at, rate_per_minute, status, jobs_created,
+			remaining, created_at, updated_at, completed_at`
+
+// scanCampaign reads one campaign selected with campaignColumns
+func scanCampaign(row rowScanner) (*models.Campaign, error) {
+	var c models.Campaign
+	var startAt, createdAt, updatedAt int64
+	var completedAt sql.NullInt64
+
+	err := row.Scan(&c.ID, &c.Name, &c.MatchType, &c.MatchCriteria, &c.TFTPServerIP,
+		&c.FirmwareFilename, &startAt, &c.RatePerMinute, &c.Status, &c.JobsCreated,
+		&c.Remaining, &createdAt, &updatedAt, &completedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	c.StartAt = time.Unix(startAt, 0)
+	c.CreatedAt = time.Unix(createdAt, 0)
+	c.UpdatedAt = time.Unix(updatedAt, 0)
+	if completedAt.Valid {
+		t := time.Unix(completedAt.Int64, 0)
+		c.CompletedAt = &t
+	}
+	return &c, nil
+}
+
+// CreateCampaign creates a new campaign in the SCHEDULED state
+func (db *DB) CreateCampaign(c *models.Campaign) (int, error) {
+	if err := c.Validate(); err != nil {
+		return 0, err
+	}
+
+	now := time.Now().Unix()
+	c.Status = models.CampaignStatusScheduled
+	id, err := db.insert(db.conn, `
+		INSERT INTO campaign (name, match_type, match_criteria, tftp_server_ip,
+			firmware_filename, start_at, rate_per_minute, status, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		c.Name, c.MatchType, c.MatchCriteria, c.TFTPServerIP, c.FirmwareFilename,
+		c.StartAt.Unix(), c.RatePerMinute, c.Status, now, now)
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to create campaign: %w", err)
+	}
+
+	return id, nil
+}
+
+// GetCampaign retrieves a campaign by ID
+func (db *DB) GetCampaign(id int) (*models.Campaign, error) {
+	c, err := scanCampaign(db.queryRow(`
+		SELECT `+campaignColumns+`
+		FROM campaign WHERE id = ?`, id))
+
+	if err == sql.ErrNoRows {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get campaign: %w", err)
+	}
+	return c, nil
+}
+
+// ListCampaigns retrieves campaigns, newest first. With statuses given, only
+// campaigns in one of them are returned, oldest start first.
+func (db *DB) ListCampaigns(statuses ...string) ([]*models.Campaign, error) {
+	query := `
+		SELECT ` + campaignColumns + `
+		FROM campaign`
+
+	var args []interface{}
+	if len(statuses) > 0 {
+		query += " WHERE status IN (?" + strings.Repeat(", ?", len(statuses)-1) + ")"
+		for _, status := range statuses {
+			args = append(args, status)
+		}
+		query += " ORDER BY start_at, id"
+	} else {
+		query += " ORDER BY created_at DESC, id DESC"
+	}
+
+	rows, err := db.query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list campaigns: %w", err)
+	}
+	defer rows.Close()
+
+	var campaigns []*models.Campaign
+	for rows.Next() {
+		c, err := scanCampaign(rows)
+		if err != nil {
+			return nil, err
+		}
+		campaigns = append(campaigns, c)
+	}
+
+	return campaigns, rows.Err()
+}
+
+// UpdateCampaignProgress stores a campaign's status and progress counters
+func (db *DB) UpdateCampaignProgress(c *models.Campaign) error {
+	var completedAt interface{}
+	if c.CompletedAt != nil {
+		completedAt = c.CompletedAt.Unix()
+	}
+
+	_, err := db.exec(`
+		UPDATE campaign
+		SET status = ?, jobs_created = ?, remaining = ?, completed_at = ?, updated_at = ?
+		WHERE id = ?`,
+		c.Status, c.JobsCreated, c.Remaining, completedAt, time.Now().Unix(), c.ID)
+
+	if err != nil {
+		return fmt.Errorf("failed to update campaign: %w", err)
+	}
+	return nil
+}
+
+// ListCampaignModemIDs returns the modems a campaign has already created jobs for
+func (db *DB) ListCampaignModemIDs(campaignID int) (map[int]bool, error) {
+	rows, err := db.query(`
+		SELECT DISTINCT modem_id FROM upgrade_job
+		WHERE campaign_id = ? AND modem_id IS NOT NULL`, campaignID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list campaign modems: %w", err)
+	}
+	defer rows.Close()
+
+	ids := make(map[int]bool)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids[id] = true
+	}
+
+	return ids, rows.Err()
+}
+
+// ListCampaignJobs retrieves a campaign's jobs with the given status, oldest first
+func (db *DB) ListCampaignJobs(campaignID int, status string) ([]*models.UpgradeJob, error) {
+	rows, err := db.query(`
+		SELECT `+jobColumns+`
+		FROM upgrade_job
+		WHERE campaign_id = ? AND status = ?
+		ORDER BY created_at, id`, campaignID, status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list campaign jobs: %w", err)
+	}
+	defer rows.Close()
+
+	return scanJobs(rows)
+}
+
+// CountCampaignJobsByStatus returns the number of a campaign's jobs per status
+func (db *DB) CountCampaignJobsByStatus(campaignID int) (map[string]int, error) {
+	rows, err := db.query(`
+		SELECT status, COUNT(*) FROM upgrade_job
+		WHERE campaign_id = ?
+		GROUP BY status
+	`, campaignID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count campaign jobs: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, err
+		}
+		counts[status] = count
+	}
+
+	return counts, rows.Err()
+}
+
 // Activity Log operations
 
 // LogActivity creates an activity log entry
 func (db *DB) LogActivity(log *models.ActivityLog) error {
+	return db.logActivity(db.conn, log)
+}
+
+func (db *DB) logActivity(q execQueryer, log *models.ActivityLog) error {
 	now := time.Now().Unix()
-	_, err := db.conn.Exec(`
+	_, err := q.Exec(db.rebind(`
 		INSERT INTO activity_log (event_type, entity_type, entity_id, message, details, created_at)
-		VALUES (?, ?, ?, ?, ?, ?)`,
+		VALUES (?, ?, ?, ?, ?, ?)`),
 		log.EventType, log.EntityType, log.EntityID, log.Message, log.Details, now)
 
 	if err != nil {
@@ -838,11 +2560,40 @@ func (db *DB) LogActivity(log *models.ActivityLog) error {
 	return nil
 }
 
-// ListActivityLogs retrieves recent activity logs
-func (db *DB) ListActivityLogs(limit, offset int) ([]*models.ActivityLog, error) {
-	rows, err := db.conn.Query(`
+// activityBatchSize caps the rows in one multi-row activity_log INSERT,
+// keeping it well under the drivers' bind parameter limits
+const activityBatchSize = 100
+
+// logActivities inserts logs within tx using as few statements as possible
+func (db *DB) logActivities(tx *sql.Tx, logs []*models.ActivityLog, createdAt int64) error {
+	for start := 0; start < len(logs); start += activityBatchSize {
+		batch := logs[start:min(start+activityBatchSize, len(logs))]
+
+		placeholders := make([]string, len(batch))
+		args := make([]interface{}, 0, len(batch)*6)
+		for i, log := range batch {
+			placeholders[i] = "(?, ?, ?, ?, ?, ?)"
+			args = append(args, log.EventType, log.EntityType, log.EntityID, log.Message, log.Details, createdAt)
+		}
+
+		_, err := tx.Exec(db.rebind(`
+			INSERT INTO activity_log (event_type, entity_type, entity_id, message, details, created_at)
+			VALUES `+strings.Join(placeholders, ", ")), args...)
+		if err != nil {
+			return fmt.Errorf("failed to log activity: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// ListActivityLogs retrieves recent activity logs matching filter, newest first
+func (db *DB) ListActivityLogs(filter ActivityLogFilter, limit, offset int) ([]*models.ActivityLog, error) {
+	where, args := filter.where()
+	rows, err := db.query(`
 		SELECT id, event_type, entity_type, entity_id, message, details, created_at
-		FROM activity_log ORDER BY created_at DESC LIMIT ? OFFSET ?`, limit, offset)
+		FROM activity_log`+where+` ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?`,
+		append(args, limit, offset)...)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to list activity logs: %w", err)
@@ -868,13 +2619,180 @@ func (db *DB) ListActivityLogs(limit, offset int) ([]*models.ActivityLog, error)
 	return logs, nil
 }
 
+// ListActivityLogsByEntity returns every activity log about one entity, such
+// as a job's start, retries and outcome, oldest first
+func (db *DB) ListActivityLogsByEntity(entityType string, entityID int) ([]*models.ActivityLog, error) {
+	rows, err := db.query(`
+		SELECT id, event_type, entity_type, entity_id, message, details, created_at
+		FROM activity_log
+		WHERE entity_type = ? AND entity_id = ?
+		ORDER BY created_at, id`, entityType, entityID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list activity logs for %s %d: %w", entityType, entityID, err)
+	}
+	defer rows.Close()
+
+	logs := []*models.ActivityLog{}
+	for rows.Next() {
+		var log models.ActivityLog
+		var createdAt int64
+
+		err := rows.Scan(&log.ID, &log.EventType, &log.EntityType, &log.EntityID,
+			&log.Message, &log.Details, &createdAt)
+		if err != nil {
+			return nil, err
+		}
+
+		log.CreatedAt = time.Unix(createdAt, 0)
+		logs = append(logs, &log)
+	}
+
+	return logs, rows.Err()
+}
+
+// PurgeOldActivityLogs deletes activity log entries created before the cutoff
+func (db *DB) PurgeOldActivityLogs(olderThan time.Duration) (int, error) {
+	cutoff := time.Now().Add(-olderThan).Unix()
+
+	result, err := db.exec("DELETE FROM activity_log WHERE created_at < ?", cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge old activity logs: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(rows), nil
+}
+
+// GetSignalHistory returns a modem's signal readings recorded at or after
+// since, oldest first. A zero since returns every reading kept.
+func (db *DB) GetSignalHistory(modemID int, since time.Time) ([]*models.SignalReading, error) {
+	var sinceUnix int64
+	if !since.IsZero() {
+		sinceUnix = since.Unix()
+	}
+
+	rows, err := db.query(`
+		SELECT modem_id, signal_level, ofdm_power, recorded_at
+		FROM modem_signal_history
+		WHERE modem_id = ? AND recorded_at >= ?
+		ORDER BY recorded_at, id
+	`, modemID, sinceUnix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get signal history: %w", err)
+	}
+	defer rows.Close()
+
+	readings := []*models.SignalReading{}
+	for rows.Next() {
+		var reading models.SignalReading
+		var signalLevel, ofdmPower sql.NullFloat64
+		var recordedAt int64
+		if err := rows.Scan(&reading.ModemID, &signalLevel, &ofdmPower, &recordedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan signal reading: %w", err)
+		}
+		if signalLevel.Valid {
+			reading.SignalLevel = &signalLevel.Float64
+		}
+		if ofdmPower.Valid {
+			reading.OFDMPower = &ofdmPower.Float64
+		}
+		reading.RecordedAt = time.Unix(recordedAt, 0)
+		readings = append(readings, &reading)
+	}
+
+	return readings, rows.Err()
+}
+
+// PurgeOldSignalHistory deletes signal readings older than olderThan
+func (db *DB) PurgeOldSignalHistory(olderThan time.Duration) (int, error) {
+	cutoff := time.Now().Add(-olderThan).Unix()
+
+	result, err := db.exec("DELETE FROM modem_signal_history WHERE recorded_at < ?", cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge old signal history: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(rows), nil
+}
+
+// ActivityLogFilter narrows activity log queries. Zero values mean unfiltered.
+type ActivityLogFilter struct {
+	EventType string
+	Since     time.Time
+	Until     time.Time
+}
+
+// where builds the WHERE clause and arguments for the filter
+func (f ActivityLogFilter) where() (string, []interface{}) {
+	var clauses []string
+	var args []interface{}
+
+	if f.EventType != "" {
+		clauses = append(clauses, "event_type = ?")
+		args = append(args, f.EventType)
+	}
+	if !f.Since.IsZero() {
+		clauses = append(clauses, "created_at >= ?")
+		args = append(args, f.Since.Unix())
+	}
+	if !f.Until.IsZero() {
+		clauses = append(clauses, "created_at <= ?")
+		args = append(args, f.Until.Unix())
+	}
+
+	if len(clauses) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(clauses, " AND "), args
+}
+
+// StreamActivityLogs calls fn for each matching activity log in chronological
+// order without loading the full result set into memory
+func (db *DB) StreamActivityLogs(filter ActivityLogFilter, fn func(*models.ActivityLog) error) error {
+	where, args := filter.where()
+	rows, err := db.query(`
+		SELECT id, event_type, entity_type, entity_id, message, details, created_at
+		FROM activity_log`+where+` ORDER BY created_at, id`, args...)
+	if err != nil {
+		return fmt.Errorf("failed to stream activity logs: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var log models.ActivityLog
+		var createdAt int64
+
+		err := rows.Scan(&log.ID, &log.EventType, &log.EntityType, &log.EntityID,
+			&log.Message, &log.Details, &createdAt)
+		if err != nil {
+			return err
+		}
+
+		log.CreatedAt = time.Unix(createdAt, 0)
+		if err := fn(&log); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
 // GetSetting retrieves a setting value by key
 func (db *DB) GetSetting(key string) (string, error) {
 	var value string
-	err := db.conn.QueryRow("SELECT value FROM settings WHERE key = ?", key).Scan(&value)
+	err := db.queryRow("SELECT value FROM settings WHERE key = ?", key).Scan(&value)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return "", fmt.Errorf("setting not found: %s", key)
+			return "", fmt.Errorf("setting %s: %w", key, models.ErrNotFound)
 		}
 		return "", err
 	}
@@ -883,17 +2801,17 @@ func (db *DB) GetSetting(key string) (string, error) {
 
 // SetSetting updates or creates a setting
 func (db *DB) SetSetting(key, value string) error {
-	_, err := db.conn.Exec(`
+	_, err := db.exec(`
 		INSERT INTO settings (key, value, updated_at)
 		VALUES (?, ?, ?)
-		ON CONFLICT(key) DO UPDATE SET value = ?, updated_at = ?
-	`, key, value, time.Now().Unix(), value, time.Now().Unix())
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at
+	`, key, value, time.Now().Unix())
 	return err
 }
 
 // ListSettings retrieves all settings
 func (db *DB) ListSettings() (map[string]string, error) {
-	rows, err := db.conn.Query("SELECT key, value FROM settings")
+	rows, err := db.query("SELECT key, value FROM settings")
 	if err != nil {
 		return nil, err
 	}
@@ -909,3 +2827,120 @@ func (db *DB) ListSettings() (map[string]string, error) {
 	}
 	return settings, nil
 }
+
+// RestoreBackup applies a configuration backup in a single transaction.
+// CMTS and rules are matched to existing ones by name, updated if found and
+// created otherwise; settings are overwritten. The evaluation allowlist's
+// CMTS names are resolved to IDs once the CMTS are in place. Nothing is
+// deleted. Any invalid entry or database error leaves the configuration
+// untouched.
+func (db *DB) RestoreBackup(backup *models.Backup) (*models.RestoreResult, error) {
+	seen := make(map[string]bool)
+	for i, spec := range backup.CMTS {
+		if err := spec.CMTS().Validate(); err != nil {
+			return nil, fmt.Errorf("cmts %d (%q): %w", i+1, spec.Name, err)
+		}
+		if seen[spec.Name] {
+			return nil, fmt.Errorf("cmts %d (%q): duplicate CMTS name", i+1, spec.Name)
+		}
+		seen[spec.Name] = true
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var result models.RestoreResult
+	now := time.Now().Unix()
+	for _, spec := range backup.CMTS {
+		cmts := spec.CMTS()
+		communityWrite, cmCommunity, err := db.sealCommunities(cmts.CommunityWrite, cmts.CMCommunityString)
+		if err != nil {
+			return nil, fmt.Errorf("failed to restore CMTS %q: %w", cmts.Name, err)
+		}
+
+		var id int
+		err = tx.QueryRow(db.rebind(`
+			SELECT id FROM cmts WHERE name = ? AND deleted_at IS NULL
+			ORDER BY id LIMIT 1`), cmts.Name).Scan(&id)
+		switch {
+		case err == sql.ErrNoRows:
+			_, err = db.insert(tx, `
+				INSERT INTO cmts (name, ip_address, snmp_port, community_read, community_write,
+					cm_community_string, snmp_version, enabled, max_firmware_version, snmp_max_oids,
+					created_at, updated_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				cmts.Name, cmts.IPAddress, cmts.SNMPPort, cmts.CommunityRead, communityWrite,
+				cmCommunity, cmts.SNMPVersion, cmts.Enabled, cmts.MaxFirmwareVersion, cmts.MaxOids(), now, now)
+			result.CMTSCreated++
+		case err == nil:
+			_, err = tx.Exec(db.rebind(`
+				UPDATE cmts SET ip_address = ?, snmp_port = ?, community_read = ?,
+					community_write = ?, cm_community_string = ?, snmp_version = ?, enabled = ?,
+					max_firmware_version = ?, snmp_max_oids = ?, updated_at = ?
+				WHERE id = ?`),
+				cmts.IPAddress, cmts.SNMPPort, cmts.CommunityRead, communityWrite,
+				cmCommunity, cmts.SNMPVersion, cmts.Enabled, cmts.MaxFirmwareVersion,
+				cmts.MaxOids(), now, id)
+			result.CMTSUpdated++
+		}
+		if isUniqueViolation(err) {
+			return nil, fmt.Errorf("cmts %q: %w", cmts.Name, models.ErrDuplicate)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to restore CMTS %q: %w", cmts.Name, err)
+		}
+	}
+
+	rules := make([]*models.UpgradeRule, len(backup.Rules))
+	for i, spec := range backup.Rules {
+		rules[i] = spec.Rule()
+	}
+	result.RulesCreated, result.RulesUpdated, err = db.importRules(tx, rules)
+	if err != nil {
+		return nil, err
+	}
+
+	settings := backup.Settings
+	if backup.EvaluationCMTSAllowlist != nil {
+		ids := make([]string, 0, len(backup.EvaluationCMTSAllowlist))
+		for _, name := range backup.EvaluationCMTSAllowlist {
+			var id int
+			err := tx.QueryRow(db.rebind(`
+				SELECT id FROM cmts WHERE name = ? AND deleted_at IS NULL
+				ORDER BY id LIMIT 1`), name).Scan(&id)
+			if err == sql.ErrNoRows {
+				return nil, fmt.Errorf("evaluation_cmts_allowlist: no CMTS named %q", name)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to restore evaluation_cmts_allowlist: %w", err)
+			}
+			ids = append(ids, strconv.Itoa(id))
+		}
+		settings = make(map[string]string, len(backup.Settings)+1)
+		for key, value := range backup.Settings {
+			settings[key] = value
+		}
+		settings["evaluation_cmts_allowlist"] = strings.Join(ids, ",")
+	}
+
+	for key, value := range settings {
+		_, err := tx.Exec(db.rebind(`
+			INSERT INTO settings (key, value, updated_at)
+			VALUES (?, ?, ?)
+			ON CONFLICT(key) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at`),
+			key, value, now)
+		if err != nil {
+			return nil, fmt.Errorf("failed to restore setting %s: %w", key, err)
+		}
+		result.Settings++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit restore: %w", err)
+	}
+
+	return &result, nil
+}
@@ -1,6 +1,11 @@
 package database
 
 import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -109,6 +114,55 @@ func TestCreateCMTS(t *testing.T) {
 	}
 }
 
+func TestCreateCMTSBatch(t *testing.T) {
+	db, err := NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	list := []*models.CMTS{
+		{Name: "Market CMTS 1", IPAddress: "10.1.0.1", SNMPPort: 161, CommunityRead: "public", SNMPVersion: 2, Enabled: true},
+		{Name: "", IPAddress: "10.1.0.2", SNMPPort: 161, CommunityRead: "public", SNMPVersion: 2},
+		{Name: "Market CMTS 3", IPAddress: "10.1.0.3", SNMPPort: 161, CommunityRead: "public", SNMPVersion: 2, Enabled: true},
+		{Name: "Market CMTS 4", IPAddress: "10.1.0.1", SNMPPort: 161, CommunityRead: "public", SNMPVersion: 2, Enabled: true},
+	}
+
+	ids, errs, err := db.CreateCMTSBatch(list)
+	if err != nil {
+		t.Fatalf("Failed to create CMTS batch: %v", err)
+	}
+
+	if len(ids) != 4 || len(errs) != 4 {
+		t.Fatalf("Expected 4 results, got %d IDs and %d errors", len(ids), len(errs))
+	}
+	if ids[0] == 0 || ids[2] == 0 || errs[0] != nil || errs[2] != nil {
+		t.Errorf("Expected IDs for valid entries, got %v / %v", ids, errs)
+	}
+	if ids[1] != 0 || errs[1] == nil {
+		t.Errorf("Expected invalid entry to be skipped, got ID %d / %v", ids[1], errs[1])
+	}
+	if ids[3] != 0 || errs[3] != models.ErrDuplicate {
+		t.Errorf("Expected the reused IP skipped as a duplicate, got ID %d / %v", ids[3], errs[3])
+	}
+
+	all, err := db.ListCMTS()
+	if err != nil {
+		t.Fatalf("Failed to list CMTS: %v", err)
+	}
+	if len(all) != 2 {
+		t.Errorf("Expected 2 CMTS, got %d", len(all))
+	}
+
+	retrieved, err := db.GetCMTS(ids[2])
+	if err != nil {
+		t.Fatalf("Failed to get CMTS: %v", err)
+	}
+	if retrieved.Name != "Market CMTS 3" {
+		t.Errorf("Expected name Market CMTS 3, got %s", retrieved.Name)
+	}
+}
+
 func TestGetCMTS(t *testing.T) {
 	db, err := NewTestDB()
 	if err != nil {
@@ -180,6 +234,60 @@ func TestListCMTS(t *testing.T) {
 	}
 }
 
+func TestListCMTSFiltered(t *testing.T) {
+	db, err := NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	for i, name := range []string{"Edge North", "Edge South", "Core West", "edge_lab"} {
+		_, err := db.CreateCMTS(&models.CMTS{
+			Name:           name,
+			IPAddress:      fmt.Sprintf("192.168.2.%d", i+1),
+			SNMPPort:       161,
+			CommunityRead:  "public",
+			CommunityWrite: "private",
+			SNMPVersion:    2,
+			Enabled:        name != "Edge South",
+		})
+		if err != nil {
+			t.Fatalf("Failed to create CMTS: %v", err)
+		}
+	}
+
+	for _, tt := range []struct {
+		name          string
+		enabledOnly   bool
+		q             string
+		limit, offset int
+		want          []string
+		total         int
+	}{
+		{"all", false, "", 0, 0, []string{"Core West", "Edge North", "Edge South", "edge_lab"}, 4},
+		{"enabled", true, "", 0, 0, []string{"Core West", "Edge North", "edge_lab"}, 3},
+		{"name ignores case", false, "EDGE", 0, 0, []string{"Edge North", "Edge South", "edge_lab"}, 3},
+		{"underscore is literal", false, "_", 0, 0, []string{"edge_lab"}, 1},
+		{"page", false, "", 2, 1, []string{"Edge North", "Edge South"}, 4},
+		{"offset only", true, "edge", 0, 1, []string{"edge_lab"}, 2},
+	} {
+		list, total, err := db.ListCMTSFiltered(tt.enabledOnly, tt.q, tt.limit, tt.offset)
+		if err != nil {
+			t.Fatalf("%s: failed to list CMTS: %v", tt.name, err)
+		}
+		if total != tt.total {
+			t.Errorf("%s: expected total %d, got %d", tt.name, tt.total, total)
+		}
+		var names []string
+		for _, cmts := range list {
+			names = append(names, cmts.Name)
+		}
+		if strings.Join(names, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, names)
+		}
+	}
+}
+
 func TestUpdateCMTS(t *testing.T) {
 	db, err := NewTestDB()
 	if err != nil {
@@ -248,157 +356,1591 @@ func TestDeleteCMTS(t *testing.T) {
 	}
 }
 
-// Cable Modem Tests
-
-func TestUpsertModem(t *testing.T) {
+func TestCMTSDuplicateIP(t *testing.T) {
 	db, err := NewTestDB()
 	if err != nil {
 		t.Fatalf("Failed to create test database: %v", err)
 	}
 	defer db.Close()
 
-	err = db.LoadTestFixtures()
-	if err != nil {
+	if err := db.LoadTestFixtures(); err != nil {
 		t.Fatalf("Failed to load fixtures: %v", err)
 	}
 
-	modem := &models.CableModem{
-		CMTSID:          1,
-		MACAddress:      "AA:BB:CC:DD:EE:FF",
-		IPAddress:       "10.0.0.200",
-		SysDescr:        "Test Modem",
-		CurrentFirmware: "1.0.0",
-		SignalLevel:     6.5,
-		Status:          "online",
-		LastSeen:        time.Now(),
+	cmts := &models.CMTS{
+		Name:          "Second CMTS",
+		IPAddress:     "192.168.1.1",
+		SNMPPort:      161,
+		CommunityRead: "public",
+		SNMPVersion:   2,
+	}
+	if _, err := db.CreateCMTS(cmts); err != models.ErrDuplicate {
+		t.Fatalf("Expected ErrDuplicate creating a CMTS with a used IP, got %v", err)
 	}
 
-	// Insert
-	err = db.UpsertModem(modem)
+	cmts.IPAddress = "192.168.1.2"
+	id, err := db.CreateCMTS(cmts)
 	if err != nil {
-		t.Fatalf("Failed to upsert modem: %v", err)
+		t.Fatalf("Failed to create CMTS: %v", err)
+	}
+	cmts.ID = id
+	cmts.IPAddress = "192.168.1.1"
+	if err := db.UpdateCMTS(cmts); err != models.ErrDuplicate {
+		t.Errorf("Expected ErrDuplicate moving a CMTS onto a used IP, got %v", err)
+	}
+	if _, errs, err := db.CreateCMTSBatch([]*models.CMTS{cmts}); err != nil || errs[0] != models.ErrDuplicate {
+		t.Errorf("Expected ErrDuplicate for a batch entry reusing an IP, got %v / %v", errs, err)
 	}
 
-	// Verify insert - get all modems and find ours
-	allModems, err := db.ListModems(0)
+	// A deleted CMTS frees its IP, and can't be restored while it's reused
+	if err := db.DeleteCMTS(1); err != nil {
+		t.Fatalf("Failed to delete CMTS: %v", err)
+	}
+	if err := db.UpdateCMTS(cmts); err != nil {
+		t.Fatalf("Expected a deleted CMTS's IP to be reusable: %v", err)
+	}
+	if err := db.RestoreCMTS(1); err != models.ErrDuplicate {
+		t.Errorf("Expected ErrDuplicate restoring onto a reused IP, got %v", err)
+	}
+}
+
+func TestCMTSSNMPMaxOids(t *testing.T) {
+	db, err := NewTestDB()
 	if err != nil {
-		t.Fatalf("Failed to list modems: %v", err)
+		t.Fatalf("Failed to create test database: %v", err)
 	}
+	defer db.Close()
 
-	var retrieved *models.CableModem
-	for _, m := range allModems {
-		if m.MACAddress == "AA:BB:CC:DD:EE:FF" {
-			retrieved = m
-			break
-		}
+	cmts := &models.CMTS{
+		Name:          "Old CMTS",
+		IPAddress:     "192.168.5.1",
+		SNMPPort:      161,
+		CommunityRead: "public",
+		SNMPVersion:   2,
+	}
+	id, err := db.CreateCMTS(cmts)
+	if err != nil {
+		t.Fatalf("Failed to create CMTS: %v", err)
 	}
 
-	if retrieved == nil {
-		t.Fatal("Modem not found after insert")
+	got, err := db.GetCMTS(id)
+	if err != nil {
+		t.Fatalf("Failed to get CMTS: %v", err)
+	}
+	if got.SNMPMaxOids != models.DefaultSNMPMaxOids {
+		t.Errorf("Expected default snmp_max_oids %d, got %d", models.DefaultSNMPMaxOids, got.SNMPMaxOids)
 	}
 
-	if retrieved.IPAddress != "10.0.0.200" {
-		t.Errorf("Expected IP 10.0.0.200, got %s", retrieved.IPAddress)
+	got.SNMPMaxOids = 10
+	if err := db.UpdateCMTS(got); err != nil {
+		t.Fatalf("Failed to update CMTS: %v", err)
+	}
+	list, err := db.ListCMTS()
+	if err != nil {
+		t.Fatalf("Failed to list CMTS: %v", err)
+	}
+	if len(list) != 1 || list[0].SNMPMaxOids != 10 {
+		t.Errorf("Expected listed CMTS with snmp_max_oids 10, got %+v", list)
 	}
+}
 
-	// Update
-	modem.IPAddress = "10.0.0.201"
-	modem.CurrentFirmware = "2.0.0"
+func TestCMTSCommunityEncryption(t *testing.T) {
+	db, err := NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
 
-	err = db.UpsertModem(modem)
+	// A row written before a key was configured stays readable
+	legacyID, err := db.CreateCMTS(&models.CMTS{
+		Name:           "Legacy CMTS",
+		IPAddress:      "192.168.6.1",
+		SNMPPort:       161,
+		CommunityRead:  "public",
+		CommunityWrite: "legacy-private",
+		SNMPVersion:    2,
+	})
 	if err != nil {
-		t.Fatalf("Failed to upsert modem update: %v", err)
+		t.Fatalf("Failed to create CMTS: %v", err)
 	}
 
-	// Verify update
-	allModems, err = db.ListModems(0)
+	if err := db.SetEncryptionKey("correct horse battery staple"); err != nil {
+		t.Fatalf("Failed to set encryption key: %v", err)
+	}
+
+	id, err := db.CreateCMTS(&models.CMTS{
+		Name:              "Secure CMTS",
+		IPAddress:         "192.168.6.2",
+		SNMPPort:          161,
+		CommunityRead:     "public",
+		CommunityWrite:    "private",
+		CMCommunityString: "cable-modem",
+		SNMPVersion:       2,
+	})
 	if err != nil {
-		t.Fatalf("Failed to list modems: %v", err)
+		t.Fatalf("Failed to create CMTS: %v", err)
 	}
 
-	var updated *models.CableModem
-	for _, m := range allModems {
-		if m.MACAddress == "AA:BB:CC:DD:EE:FF" {
-			updated = m
-			break
-		}
+	var storedWrite, storedCM string
+	if err := db.conn.QueryRow("SELECT community_write, cm_community_string FROM cmts WHERE id = ?", id).Scan(&storedWrite, &storedCM); err != nil {
+		t.Fatalf("Failed to read raw row: %v", err)
+	}
+	if !strings.HasPrefix(storedWrite, encryptedPrefix) || strings.Contains(storedWrite, "private") {
+		t.Errorf("Expected community_write encrypted at rest, got %q", storedWrite)
+	}
+	if !strings.HasPrefix(storedCM, encryptedPrefix) {
+		t.Errorf("Expected cm_community_string encrypted at rest, got %q", storedCM)
 	}
 
-	if updated == nil {
-		t.Fatal("Modem not found after update")
+	got, err := db.GetCMTS(id)
+	if err != nil {
+		t.Fatalf("Failed to get CMTS: %v", err)
+	}
+	if got.CommunityWrite != "private" || got.CMCommunityString != "cable-modem" {
+		t.Errorf("Expected decrypted communities, got %q / %q", got.CommunityWrite, got.CMCommunityString)
 	}
 
-	if updated.IPAddress != "10.0.0.201" {
-		t.Errorf("Expected IP 10.0.0.201, got %s", updated.IPAddress)
+	got.CommunityWrite = "rotated"
+	if err := db.UpdateCMTS(got); err != nil {
+		t.Fatalf("Failed to update CMTS: %v", err)
 	}
-	if updated.CurrentFirmware != "2.0.0" {
-		t.Errorf("Expected firmware 2.0.0, got %s", updated.CurrentFirmware)
+
+	list, err := db.ListCMTS()
+	if err != nil {
+		t.Fatalf("Failed to list CMTS: %v", err)
+	}
+	written := make(map[int]string)
+	for _, c := range list {
+		written[c.ID] = c.CommunityWrite
+	}
+	if written[legacyID] != "legacy-private" {
+		t.Errorf("Expected legacy plaintext community, got %q", written[legacyID])
+	}
+	if written[id] != "rotated" {
+		t.Errorf("Expected updated community 'rotated', got %q", written[id])
+	}
+
+	if err := db.SetEncryptionKey("wrong key"); err != nil {
+		t.Fatalf("Failed to set encryption key: %v", err)
+	}
+	if _, err := db.GetCMTS(id); err == nil {
+		t.Error("Expected error decrypting with the wrong key")
+	}
+
+	if err := db.SetEncryptionKey(""); err != nil {
+		t.Fatalf("Failed to clear encryption key: %v", err)
+	}
+	if _, err := db.GetCMTS(id); !errors.Is(err, ErrNoEncryptionKey) {
+		t.Errorf("Expected ErrNoEncryptionKey, got %v", err)
 	}
 }
 
-func TestListModems(t *testing.T) {
+func TestMigrateWithDuplicateCMTSIPs(t *testing.T) {
 	db, err := NewTestDB()
 	if err != nil {
 		t.Fatalf("Failed to create test database: %v", err)
 	}
 	defer db.Close()
 
-	err = db.LoadTestFixtures()
-	if err != nil {
+	if err := db.LoadTestFixtures(); err != nil {
 		t.Fatalf("Failed to load fixtures: %v", err)
 	}
 
-	// Add more modems
-	for i := 1; i <= 3; i++ {
-		mac := string([]byte{0x00, 0x01, 0x5C, 0x11, 0x22, byte(0x40 + i)})
-		err := db.UpsertModem(&models.CableModem{
-			CMTSID:          1,
-			MACAddress:      mac,
-			IPAddress:       "10.0.0." + string(rune('0'+i)),
-			SysDescr:        "Test Modem",
-			CurrentFirmware: "1.0.0",
-			SignalLevel:     5.0,
-			Status:          "online",
-			LastSeen:        time.Now(),
-		})
-		if err != nil {
-			t.Fatalf("Failed to create modem: %v", err)
+	// Simulate a database from before the index existed
+	if _, err := db.conn.Exec("DROP INDEX idx_cmts_ip_address"); err != nil {
+		t.Fatalf("Failed to drop index: %v", err)
+	}
+	if _, err := db.CreateCMTS(&models.CMTS{Name: "Copy", IPAddress: "192.168.1.1", SNMPPort: 161, CommunityRead: "public", SNMPVersion: 2}); err != nil {
+		t.Fatalf("Failed to create duplicate CMTS: %v", err)
+	}
+
+	if err := db.migrate(); err != nil {
+		t.Fatalf("Expected migration to tolerate existing duplicates: %v", err)
+	}
+}
+
+func TestIsUniqueViolation(t *testing.T) {
+	for _, tt := range []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{errors.New("constraint failed: UNIQUE constraint failed: cmts.ip_address (2067)"), true},
+		{errors.New(`pq: duplicate key value violates unique constraint "idx_cmts_ip_address"`), true},
+		{errors.New("constraint failed: NOT NULL constraint failed: cmts.name (1299)"), false},
+		{errors.New("database is locked"), false},
+	} {
+		if got := isUniqueViolation(tt.err); got != tt.want {
+			t.Errorf("isUniqueViolation(%v) = %v, want %v", tt.err, got, tt.want)
 		}
 	}
+}
+
+func TestSoftDeleteAndRestoreCMTS(t *testing.T) {
+	db, err := NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	if err := db.DeleteCMTS(1); err != nil {
+		t.Fatalf("Failed to delete CMTS: %v", err)
+	}
+
+	// Deleting twice reports not found
+	if err := db.DeleteCMTS(1); err != models.ErrNotFound {
+		t.Errorf("Expected ErrNotFound on second delete, got %v", err)
+	}
+
+	list, _ := db.ListCMTS()
+	if len(list) != 0 {
+		t.Errorf("Expected soft-deleted CMTS to be hidden, got %d", len(list))
+	}
+
+	all, err := db.ListCMTSIncludingDeleted()
+	if err != nil {
+		t.Fatalf("Failed to list CMTS: %v", err)
+	}
+	if len(all) != 1 || all[0].DeletedAt == nil {
+		t.Fatalf("Expected one CMTS with deleted_at set, got %+v", all)
+	}
 
+	// Modems are kept but hidden with their CMTS
 	modems, err := db.ListModems(0)
 	if err != nil {
 		t.Fatalf("Failed to list modems: %v", err)
 	}
+	if len(modems) != 0 {
+		t.Errorf("Expected modems of deleted CMTS to be hidden, got %d", len(modems))
+	}
+	if _, err := db.GetModem(1); err != nil {
+		t.Errorf("Expected modem row to survive soft delete: %v", err)
+	}
 
-	if len(modems) < 1 {
-		t.Errorf("Expected at least 1 modem, got %d", len(modems))
+	if err := db.RestoreCMTS(1); err != nil {
+		t.Fatalf("Failed to restore CMTS: %v", err)
+	}
+	if err := db.RestoreCMTS(1); err != models.ErrNotFound {
+		t.Errorf("Expected ErrNotFound restoring an active CMTS, got %v", err)
+	}
+
+	if _, err := db.GetCMTS(1); err != nil {
+		t.Errorf("Expected restored CMTS to be visible: %v", err)
+	}
+	modems, _ = db.ListModems(1)
+	if len(modems) != 1 {
+		t.Errorf("Expected 1 modem after restore, got %d", len(modems))
 	}
 }
 
-func TestListModemsByCMTS(t *testing.T) {
-	db, err := NewTestDB()
+func TestMigrateAddsDeletedAtToLegacyCMTS(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "legacy.db")
+
+	conn, err := sql.Open("sqlite", path)
 	if err != nil {
-		t.Fatalf("Failed to create test database: %v", err)
+		t.Fatalf("Failed to open legacy database: %v", err)
+	}
+	_, err = conn.Exec(`
+		CREATE TABLE cmts (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			ip_address TEXT NOT NULL,
+			snmp_port INTEGER DEFAULT 161,
+			community_read TEXT NOT NULL,
+			community_write TEXT,
+			cm_community_string TEXT,
+			snmp_version INTEGER DEFAULT 2,
+			enabled BOOLEAN DEFAULT 1,
+			created_at INTEGER NOT NULL,
+			updated_at INTEGER NOT NULL
+		);
+		INSERT INTO cmts (name, ip_address, community_read, created_at, updated_at)
+		VALUES ('Legacy CMTS', '10.0.0.1', 'public', 0, 0);`)
+	conn.Close()
+	if err != nil {
+		t.Fatalf("Failed to create legacy schema: %v", err)
+	}
+
+	db, err := New(path)
+	if err != nil {
+		t.Fatalf("Failed to migrate legacy database: %v", err)
 	}
 	defer db.Close()
 
-	err = db.LoadTestFixtures()
+	if err := db.DeleteCMTS(1); err != nil {
+		t.Fatalf("Failed to soft-delete legacy CMTS: %v", err)
+	}
+	if _, err := db.GetCMTS(1); err != models.ErrNotFound {
+		t.Errorf("Expected ErrNotFound after soft delete, got %v", err)
+	}
+}
+
+func TestMigrateRelaxesLegacyJobModemKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "legacy.db")
+
+	db, err := New(path)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	// Recreate upgrade_job as older schemas declared it, with a job whose
+	// modem was deleted while SQLite ignored the foreign key
+	var table string
+	if err := db.conn.QueryRow(`SELECT sql FROM sqlite_master WHERE name = 'upgrade_job'`).Scan(&table); err != nil {
+		t.Fatalf("Failed to read schema: %v", err)
+	}
+	table = strings.NewReplacer("modem_id INTEGER,", "modem_id INTEGER NOT NULL,", " ON DELETE SET NULL", "").Replace(table)
+	for _, stmt := range []string{
+		"DROP TABLE upgrade_job",
+		table,
+		"CREATE INDEX idx_upgrade_job_mac ON upgrade_job(mac_address)",
+		`INSERT INTO upgrade_job (modem_id, rule_id, cmts_id, mac_address, status,
+			tftp_server_ip, firmware_filename, error_message, created_at)
+			VALUES (99, 1, 1, '00:01:5C:FF:00:01', 'COMPLETED', '10.0.0.5', 'fw.bin', '', 0)`,
+	} {
+		if _, err := db.conn.Exec(stmt); err != nil {
+			t.Fatalf("Failed to create legacy schema: %v", err)
+		}
+	}
+	db.Close()
+
+	db, err = New(path)
 	if err != nil {
-		t.Fatalf("Failed to load fixtures: %v", err)
+		t.Fatalf("Failed to migrate legacy database: %v", err)
 	}
+	defer db.Close()
 
-	modems, err := db.ListModems(1)
+	var notNull, indexes int
+	db.conn.QueryRow(`SELECT "notnull" FROM pragma_table_info('upgrade_job') WHERE name = 'modem_id'`).Scan(&notNull)
+	if notNull != 0 {
+		t.Error("Expected upgrade_job.modem_id to allow NULL after migration")
+	}
+	db.conn.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = 'idx_upgrade_job_mac'`).Scan(&indexes)
+	if indexes != 1 {
+		t.Error("Expected upgrade_job indexes kept through the rebuild")
+	}
+
+	job, err := db.GetJob(1)
 	if err != nil {
-		t.Fatalf("Failed to list modems by CMTS: %v", err)
+		t.Fatalf("Expected the legacy job kept, got %v", err)
 	}
+	if job.ModemID != 0 || job.MACAddress != "00:01:5C:FF:00:01" {
+		t.Errorf("Expected the orphaned job detached from its modem, got modem %d, MAC %s", job.ModemID, job.MACAddress)
+	}
+}
 
-	if len(modems) != 1 {
-		t.Errorf("Expected 1 modem, got %d", len(modems))
+// Cable Modem Tests
+
+func TestSetModemTags(t *testing.T) {
+	db, err := NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
 	}
+	defer db.Close()
 
-	if modems[0].CMTSID != 1 {
-		t.Errorf("Expected CMTS ID 1, got %d", modems[0].CMTSID)
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	if err := db.SetModemTags(1, []string{" business ", "lab"}); err != nil {
+		t.Fatalf("Failed to set tags: %v", err)
+	}
+
+	// Re-discovery must not clear the tags
+	err = db.UpsertModem(&models.CableModem{CMTSID: 1, MACAddress: "00:01:5C:11:22:33", IPAddress: "10.0.0.101", Status: "online"})
+	if err != nil {
+		t.Fatalf("Failed to upsert modem: %v", err)
+	}
+
+	modem, err := db.GetModem(1)
+	if err != nil {
+		t.Fatalf("Failed to get modem: %v", err)
+	}
+	if strings.Join(modem.Tags, ",") != "business,lab" {
+		t.Errorf("Expected tags [business lab], got %v", modem.Tags)
+	}
+
+	if err := db.SetModemTags(1, []string{"business", " "}); err != models.ErrInvalidTag {
+		t.Errorf("Expected ErrInvalidTag, got %v", err)
+	}
+	if err := db.SetModemTags(999, []string{"lab"}); err != models.ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	if err := db.SetModemTags(1, nil); err != nil {
+		t.Fatalf("Failed to clear tags: %v", err)
+	}
+	modem, _ = db.GetModem(1)
+	if len(modem.Tags) != 0 {
+		t.Errorf("Expected tags cleared, got %v", modem.Tags)
+	}
+}
+
+func TestUpsertModem(t *testing.T) {
+	db, err := NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	err = db.LoadTestFixtures()
+	if err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	modem := &models.CableModem{
+		CMTSID:          1,
+		MACAddress:      "AA:BB:CC:DD:EE:FF",
+		IPAddress:       "10.0.0.200",
+		SysDescr:        "Test Modem",
+		CurrentFirmware: "1.0.0",
+		SignalLevel:     6.5,
+		Status:          "online",
+		LastSeen:        time.Now(),
+	}
+
+	// Insert
+	err = db.UpsertModem(modem)
+	if err != nil {
+		t.Fatalf("Failed to upsert modem: %v", err)
+	}
+
+	// Verify insert - get all modems and find ours
+	allModems, err := db.ListModems(0)
+	if err != nil {
+		t.Fatalf("Failed to list modems: %v", err)
+	}
+
+	var retrieved *models.CableModem
+	for _, m := range allModems {
+		if m.MACAddress == "AA:BB:CC:DD:EE:FF" {
+			retrieved = m
+			break
+		}
+	}
+
+	if retrieved == nil {
+		t.Fatal("Modem not found after insert")
+	}
+
+	if retrieved.IPAddress != "10.0.0.200" {
+		t.Errorf("Expected IP 10.0.0.200, got %s", retrieved.IPAddress)
+	}
+
+	// Update
+	modem.IPAddress = "10.0.0.201"
+	modem.CurrentFirmware = "2.0.0"
+
+	err = db.UpsertModem(modem)
+	if err != nil {
+		t.Fatalf("Failed to upsert modem update: %v", err)
+	}
+
+	// Verify update
+	allModems, err = db.ListModems(0)
+	if err != nil {
+		t.Fatalf("Failed to list modems: %v", err)
+	}
+
+	var updated *models.CableModem
+	for _, m := range allModems {
+		if m.MACAddress == "AA:BB:CC:DD:EE:FF" {
+			updated = m
+			break
+		}
+	}
+
+	if updated == nil {
+		t.Fatal("Modem not found after update")
+	}
+
+	if updated.IPAddress != "10.0.0.201" {
+		t.Errorf("Expected IP 10.0.0.201, got %s", updated.IPAddress)
+	}
+	if updated.CurrentFirmware != "2.0.0" {
+		t.Errorf("Expected firmware 2.0.0, got %s", updated.CurrentFirmware)
+	}
+}
+
+func TestGetModemByMAC(t *testing.T) {
+	db, err := NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	modem, err := db.GetModemByMAC("00:01:5c:11:22:33")
+	if err != nil {
+		t.Fatalf("Failed to get modem by MAC: %v", err)
+	}
+	if modem.ID != 1 || modem.CurrentFirmware != "1.0.0" {
+		t.Errorf("Expected fixture modem, got %+v", modem)
+	}
+
+	if _, err := db.GetModemByMAC("00:01:5C:99:99:99"); err != models.ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	for _, status := range []string{models.JobStatusFailed, models.JobStatusCompleted} {
+		if _, err := db.CreateJob(&models.UpgradeJob{
+			ModemID:    1,
+			RuleID:     1,
+			CMTSID:     1,
+			MACAddress: "00:01:5C:11:22:33",
+			Status:     status,
+			MaxRetries: 3,
+		}); err != nil {
+			t.Fatalf("Failed to create job: %v", err)
+		}
+	}
+
+	// Any notation finds them
+	if modem, err := db.GetModemByMAC("0001.5c11.2233"); err != nil || modem.ID != 1 {
+		t.Errorf("Expected the fixture modem by its Cisco-dot MAC, got %+v, %v", modem, err)
+	}
+	jobs, err := db.ListJobsByMAC("00-01-5c-11-22-33")
+	if err != nil {
+		t.Fatalf("Failed to list jobs by MAC: %v", err)
+	}
+	if len(jobs) != 2 || jobs[0].Status != models.JobStatusCompleted {
+		t.Errorf("Expected 2 jobs newest first, got %d", len(jobs))
+	}
+}
+
+func TestFirmwareDistribution(t *testing.T) {
+	db, err := NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	// The fixture modem on CMTS 1 runs 1.0.0
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+	cmts2, err := db.CreateCMTS(&models.CMTS{
+		Name:          "Second CMTS",
+		IPAddress:     "192.168.1.2",
+		SNMPPort:      161,
+		CommunityRead: "public",
+		SNMPVersion:   2,
+		Enabled:       true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create CMTS: %v", err)
+	}
+
+	modems := []struct {
+		cmtsID   int
+		mac      string
+		firmware string
+	}{
+		{1, "AA:00:00:00:00:01", "2.0.0"},
+		{1, "AA:00:00:00:00:02", "2.0.0"},
+		{1, "AA:00:00:00:00:03", ""},
+		{cmts2, "AA:00:00:00:00:04", "1.0.0"},
+	}
+	for _, m := range modems {
+		if err := db.UpsertModem(&models.CableModem{
+			CMTSID:          m.cmtsID,
+			MACAddress:      m.mac,
+			IPAddress:       "10.0.0.200",
+			CurrentFirmware: m.firmware,
+			Status:          "online",
+		}); err != nil {
+			t.Fatalf("Failed to create modem: %v", err)
+		}
+	}
+
+	counts, err := db.FirmwareDistribution(0)
+	if err != nil {
+		t.Fatalf("Failed to get firmware distribution: %v", err)
+	}
+	if len(counts) != 3 || counts["1.0.0"] != 2 || counts["2.0.0"] != 2 || counts[""] != 1 {
+		t.Errorf("Unexpected fleet distribution: %v", counts)
+	}
+
+	counts, err = db.FirmwareDistribution(1)
+	if err != nil {
+		t.Fatalf("Failed to get firmware distribution: %v", err)
+	}
+	if counts["1.0.0"] != 1 || counts["2.0.0"] != 2 || counts[""] != 1 {
+		t.Errorf("Unexpected CMTS 1 distribution: %v", counts)
+	}
+
+	// Modems on a deleted CMTS are left out
+	if err := db.DeleteCMTS(cmts2); err != nil {
+		t.Fatalf("Failed to delete CMTS: %v", err)
+	}
+	counts, err = db.FirmwareDistribution(0)
+	if err != nil {
+		t.Fatalf("Failed to get firmware distribution: %v", err)
+	}
+	if counts["1.0.0"] != 1 {
+		t.Errorf("Expected deleted CMTS's modem excluded, got %v", counts)
+	}
+}
+
+func TestVendorDistribution(t *testing.T) {
+	db, err := NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	// The fixture modem on CMTS 1 has no vendor yet
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	modems := []struct {
+		mac    string
+		vendor string
+	}{
+		{"AA:00:00:00:00:01", "ARRIS"},
+		{"AA:00:00:00:00:02", "ARRIS"},
+		{"AA:00:00:00:00:03", "Hitron"},
+	}
+	for _, m := range modems {
+		if err := db.UpsertModem(&models.CableModem{
+			CMTSID:     1,
+			MACAddress: m.mac,
+			IPAddress:  "10.0.0.200",
+			Vendor:     m.vendor,
+			Status:     "online",
+		}); err != nil {
+			t.Fatalf("Failed to create modem: %v", err)
+		}
+	}
+
+	// An upsert without a vendor keeps the stored one
+	if err := db.UpsertModem(&models.CableModem{
+		CMTSID:     1,
+		MACAddress: "AA:00:00:00:00:03",
+		IPAddress:  "10.0.0.201",
+		Status:     "online",
+	}); err != nil {
+		t.Fatalf("Failed to update modem: %v", err)
+	}
+	modem, err := db.GetModemByMAC("AA:00:00:00:00:03")
+	if err != nil {
+		t.Fatalf("Failed to get modem: %v", err)
+	}
+	if modem.Vendor != "Hitron" {
+		t.Errorf("Expected vendor Hitron kept, got %q", modem.Vendor)
+	}
+
+	counts, err := db.VendorDistribution(1)
+	if err != nil {
+		t.Fatalf("Failed to get vendor distribution: %v", err)
+	}
+	if len(counts) != 3 || counts["ARRIS"] != 2 || counts["Hitron"] != 1 || counts[""] != 1 {
+		t.Errorf("Unexpected vendor distribution: %v", counts)
+	}
+}
+
+func TestRuleJobStats(t *testing.T) {
+	db, err := NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	avg, err := db.AverageUpgradeDuration(1)
+	if err != nil || avg != 0 {
+		t.Errorf("Expected 0 with no completed jobs, got %v (%v)", avg, err)
+	}
+
+	started := time.Now().Add(-time.Hour).Truncate(time.Second)
+	jobs := []struct {
+		status   string
+		duration time.Duration
+	}{
+		{models.JobStatusCompleted, 60 * time.Second},
+		{models.JobStatusCompleted, 120 * time.Second},
+		{models.JobStatusFailed, 600 * time.Second},
+		{models.JobStatusPending, 0},
+	}
+	for _, j := range jobs {
+		job := &models.UpgradeJob{
+			ModemID:    1,
+			RuleID:     1,
+			CMTSID:     1,
+			MACAddress: "00:01:5C:11:22:33",
+			Status:     models.JobStatusPending,
+			MaxRetries: 3,
+		}
+		id, err := db.CreateJob(job)
+		if err != nil {
+			t.Fatalf("Failed to create job: %v", err)
+		}
+		if j.status == models.JobStatusPending {
+			continue
+		}
+		completed := started.Add(j.duration)
+		job.ID = id
+		job.Status = j.status
+		job.StartedAt = &started
+		job.CompletedAt = &completed
+		if err := db.UpdateJob(job); err != nil {
+			t.Fatalf("Failed to update job: %v", err)
+		}
+	}
+
+	// Only completed jobs count towards the average
+	avg, err = db.AverageUpgradeDuration(1)
+	if err != nil || avg != 90 {
+		t.Errorf("Expected average of 90 seconds, got %v (%v)", avg, err)
+	}
+
+	counts, err := db.CountRuleJobsByStatus(1)
+	if err != nil {
+		t.Fatalf("Failed to count rule jobs: %v", err)
+	}
+	if counts[models.JobStatusCompleted] != 2 || counts[models.JobStatusFailed] != 1 || counts[models.JobStatusPending] != 1 {
+		t.Errorf("Unexpected rule job counts: %v", counts)
+	}
+
+	counts, err = db.CountRuleJobsByStatus(999)
+	if err != nil || len(counts) != 0 {
+		t.Errorf("Expected no jobs for unknown rule, got %v (%v)", counts, err)
+	}
+
+	counts, err = db.CountCMTSJobsByStatus(1)
+	if err != nil {
+		t.Fatalf("Failed to count CMTS jobs: %v", err)
+	}
+	if counts[models.JobStatusCompleted] != 2 || counts[models.JobStatusFailed] != 1 || counts[models.JobStatusPending] != 1 {
+		t.Errorf("Unexpected CMTS job counts: %v", counts)
+	}
+
+	counts, err = db.CountCMTSJobsByStatus(2)
+	if err != nil || len(counts) != 0 {
+		t.Errorf("Expected no jobs for CMTS 2, got %v (%v)", counts, err)
+	}
+}
+
+func TestListFirmwareDrift(t *testing.T) {
+	db, err := NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	modems := map[string]struct {
+		current, expected string
+	}{
+		"AA:00:00:00:00:01": {"1.0.0", "2.0.0"},        // reverted by a factory reset
+		"AA:00:00:00:00:02": {"SB8200.2.0.0", "2.0.0"}, // on target, vendor prefix
+		"AA:00:00:00:00:03": {"1.0.0", ""},             // never upgraded
+		"AA:00:00:00:00:04": {"1.0.0", "2.0.0"},        // upgrade still pending
+	}
+	ids := map[string]int{}
+	for mac, fw := range modems {
+		if err := db.UpsertModem(&models.CableModem{
+			CMTSID:          1,
+			MACAddress:      mac,
+			IPAddress:       "10.0.0.200",
+			CurrentFirmware: fw.current,
+			Status:          "online",
+		}); err != nil {
+			t.Fatalf("Failed to create modem: %v", err)
+		}
+		modem, err := db.GetModemByMAC(mac)
+		if err != nil {
+			t.Fatalf("Failed to get modem: %v", err)
+		}
+		ids[mac] = modem.ID
+		if fw.expected != "" {
+			if err := db.SetModemExpectedFirmware(modem.ID, fw.expected); err != nil {
+				t.Fatalf("Failed to set expected firmware: %v", err)
+			}
+		}
+	}
+	if _, err := db.CreateJob(&models.UpgradeJob{
+		ModemID:    ids["AA:00:00:00:00:04"],
+		RuleID:     1,
+		CMTSID:     1,
+		MACAddress: "AA:00:00:00:00:04",
+		Status:     models.JobStatusPending,
+		MaxRetries: 3,
+	}); err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+
+	drifted, err := db.ListFirmwareDrift(0)
+	if err != nil {
+		t.Fatalf("Failed to list firmware drift: %v", err)
+	}
+	if len(drifted) != 1 || drifted[0].ID != ids["AA:00:00:00:00:01"] {
+		t.Fatalf("Expected only the reverted modem flagged, got %+v", drifted)
+	}
+	if drifted[0].ExpectedFirmware != "2.0.0" || drifted[0].CurrentFirmware != "1.0.0" {
+		t.Errorf("Expected current 1.0.0 / expected 2.0.0, got %s / %s",
+			drifted[0].CurrentFirmware, drifted[0].ExpectedFirmware)
+	}
+
+	// Rediscovery keeps the expected firmware
+	if err := db.UpsertModem(&models.CableModem{
+		CMTSID:          1,
+		MACAddress:      "AA:00:00:00:00:01",
+		IPAddress:       "10.0.0.201",
+		CurrentFirmware: "1.0.0",
+		Status:          "online",
+	}); err != nil {
+		t.Fatalf("Failed to rediscover modem: %v", err)
+	}
+	modem, _ := db.GetModem(ids["AA:00:00:00:00:01"])
+	if modem.ExpectedFirmware != "2.0.0" {
+		t.Errorf("Expected discovery to keep expected firmware, got %q", modem.ExpectedFirmware)
+	}
+
+	if err := db.SetModemExpectedFirmware(9999, "2.0.0"); err != models.ErrNotFound {
+		t.Errorf("Expected ErrNotFound for unknown modem, got %v", err)
+	}
+}
+
+func TestUpsertModemOFDMPower(t *testing.T) {
+	db, err := NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	err = db.LoadTestFixtures()
+	if err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	modem := &models.CableModem{
+		CMTSID:            1,
+		MACAddress:        "AA:BB:CC:DD:EE:02",
+		IPAddress:         "10.0.0.202",
+		Status:            "online",
+		SignalUnavailable: true,
+		OFDMPower:         -2.5,
+		LastSeen:          time.Now(),
+	}
+	if err := db.UpsertModem(modem); err != nil {
+		t.Fatalf("Failed to upsert modem: %v", err)
+	}
+
+	modems, err := db.ListModems(1)
+	if err != nil {
+		t.Fatalf("Failed to list modems: %v", err)
+	}
+	var retrieved *models.CableModem
+	for _, m := range modems {
+		if m.MACAddress == modem.MACAddress {
+			retrieved = m
+		}
+	}
+	if retrieved == nil {
+		t.Fatal("Upserted modem not listed")
+	}
+	if retrieved.OFDMPower != -2.5 {
+		t.Errorf("Expected OFDM power -2.5, got %v", retrieved.OFDMPower)
+	}
+
+	// Legacy-only modems keep a NULL ofdm_power
+	got, err := db.GetModem(1)
+	if err != nil {
+		t.Fatalf("Failed to get modem: %v", err)
+	}
+	if got.OFDMPower != 0 {
+		t.Errorf("Expected no OFDM power, got %v", got.OFDMPower)
+	}
+}
+
+func TestUpsertModemKeepsSysDescr(t *testing.T) {
+	db, err := NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	modem := &models.CableModem{
+		CMTSID:          1,
+		MACAddress:      "AA:BB:CC:DD:EE:04",
+		IPAddress:       "10.0.0.204",
+		SysDescr:        "ARRIS DOCSIS 3.1 <<HW_REV: 1; SW_REV: 2.0.0>>",
+		CurrentFirmware: "2.0.0",
+		ConfigFile:      "gold-100x20.cfg",
+		Status:          "online",
+	}
+	if err := db.UpsertModem(modem); err != nil {
+		t.Fatalf("Failed to upsert modem: %v", err)
+	}
+
+	// A discovery where the modem didn't answer reports no sysDescr
+	modem.SysDescr = ""
+	modem.CurrentFirmware = ""
+	modem.ConfigFile = ""
+	modem.IPAddress = "10.0.0.205"
+	if err := db.UpsertModem(modem); err != nil {
+		t.Fatalf("Failed to upsert modem: %v", err)
+	}
+
+	retrieved, err := db.GetModemByMAC(modem.MACAddress)
+	if err != nil {
+		t.Fatalf("Failed to get modem: %v", err)
+	}
+	if retrieved.SysDescr == "" || retrieved.CurrentFirmware != "2.0.0" {
+		t.Errorf("Expected the stored sysDescr and firmware to be kept, got %q/%q", retrieved.SysDescr, retrieved.CurrentFirmware)
+	}
+	if retrieved.ConfigFile != "gold-100x20.cfg" {
+		t.Errorf("Expected the stored config file to be kept, got %q", retrieved.ConfigFile)
+	}
+	if retrieved.IPAddress != "10.0.0.205" {
+		t.Errorf("Expected IP 10.0.0.205, got %s", retrieved.IPAddress)
+	}
+
+	// A modem moved to another service tier reports its new config file
+	modem.ConfigFile = "platinum-1000x50.cfg"
+	if err := db.UpsertModem(modem); err != nil {
+		t.Fatalf("Failed to upsert modem: %v", err)
+	}
+	retrieved, _ = db.GetModemByMAC(modem.MACAddress)
+	if retrieved.ConfigFile != "platinum-1000x50.cfg" {
+		t.Errorf("Expected config file platinum-1000x50.cfg, got %q", retrieved.ConfigFile)
+	}
+}
+
+func TestUpsertModemInterface(t *testing.T) {
+	db, err := NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	err = db.LoadTestFixtures()
+	if err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	modem := &models.CableModem{
+		CMTSID:     1,
+		MACAddress: "AA:BB:CC:DD:EE:03",
+		IfIndex:    "4097",
+		IfDescr:    "Cable3/0-upstream0",
+		IPAddress:  "10.0.0.203",
+		Status:     "online",
+		LastSeen:   time.Now(),
+	}
+	if err := db.UpsertModem(modem); err != nil {
+		t.Fatalf("Failed to upsert modem: %v", err)
+	}
+
+	retrieved, err := db.GetModemByMAC(modem.MACAddress)
+	if err != nil {
+		t.Fatalf("Failed to get modem: %v", err)
+	}
+	if retrieved.IfIndex != "4097" || retrieved.IfDescr != "Cable3/0-upstream0" {
+		t.Errorf("Expected interface 4097/Cable3/0-upstream0, got %q/%q", retrieved.IfIndex, retrieved.IfDescr)
+	}
+
+	// A later discovery that moves the modem updates its interface
+	modem.IfIndex = "4101"
+	modem.IfDescr = "Cable3/1-upstream2"
+	if err := db.UpsertModem(modem); err != nil {
+		t.Fatalf("Failed to upsert modem: %v", err)
+	}
+	retrieved, err = db.GetModemByMAC(modem.MACAddress)
+	if err != nil {
+		t.Fatalf("Failed to get modem: %v", err)
+	}
+	if retrieved.IfIndex != "4101" || retrieved.IfDescr != "Cable3/1-upstream2" {
+		t.Errorf("Expected interface 4101/Cable3/1-upstream2, got %q/%q", retrieved.IfIndex, retrieved.IfDescr)
+	}
+}
+
+func TestUpsertModemSignalUnavailable(t *testing.T) {
+	db, err := NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	err = db.LoadTestFixtures()
+	if err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	modem := &models.CableModem{
+		CMTSID:            1,
+		MACAddress:        "AA:BB:CC:DD:EE:01",
+		IPAddress:         "10.0.0.201",
+		Status:            "online",
+		SignalUnavailable: true,
+		LastSeen:          time.Now(),
+	}
+	if err := db.UpsertModem(modem); err != nil {
+		t.Fatalf("Failed to upsert modem: %v", err)
+	}
+
+	var signal sql.NullFloat64
+	if err := db.conn.QueryRow("SELECT signal_level FROM cable_modem WHERE mac_address = ?", modem.MACAddress).Scan(&signal); err != nil {
+		t.Fatalf("Failed to read signal_level: %v", err)
+	}
+	if signal.Valid {
+		t.Errorf("Expected NULL signal_level, got %v", signal.Float64)
+	}
+
+	modems, err := db.ListModems(1)
+	if err != nil {
+		t.Fatalf("Failed to list modems: %v", err)
+	}
+	var retrieved *models.CableModem
+	for _, m := range modems {
+		if m.MACAddress == modem.MACAddress {
+			retrieved = m
+		}
+	}
+	if retrieved == nil {
+		t.Fatal("Modem not found after insert")
+	}
+	if !retrieved.SignalUnavailable {
+		t.Error("Expected SignalUnavailable to be true")
+	}
+
+	// A later poll with a real reading clears the flag
+	modem.SignalUnavailable = false
+	modem.SignalLevel = 0.0
+	if err := db.UpsertModem(modem); err != nil {
+		t.Fatalf("Failed to update modem: %v", err)
+	}
+	updated, err := db.GetModem(retrieved.ID)
+	if err != nil {
+		t.Fatalf("Failed to get modem: %v", err)
+	}
+	if updated.SignalUnavailable {
+		t.Error("Expected SignalUnavailable to be false after a real reading")
+	}
+}
+
+// syntheticModems returns n online modems with MACs starting with prefix
+func syntheticModems(prefix byte, n int) []*models.CableModem {
+	modems := make([]*models.CableModem, n)
+	for i := range modems {
+		modems[i] = &models.CableModem{
+			CMTSID:          1,
+			MACAddress:      fmt.Sprintf("%02X:00:00:%02X:%02X:%02X", prefix, i>>16&0xFF, i>>8&0xFF, i&0xFF),
+			IPAddress:       fmt.Sprintf("10.%d.%d.%d", i>>16&0xFF, i>>8&0xFF, i&0xFF),
+			SysDescr:        "ARRIS DOCSIS 3.1 Touchstone Cable Modem",
+			CurrentFirmware: "1.0.0",
+			SignalLevel:     2.5,
+			Status:          "online",
+		}
+	}
+	return modems
+}
+
+func TestUpsertModemsBatch(t *testing.T) {
+	db, err := New(filepath.Join(t.TempDir(), "upgrader.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	const sample = 50
+	for _, modem := range syntheticModems(0xAA, sample) {
+		if err := db.UpsertModem(modem); err != nil {
+			t.Fatalf("UpsertModem failed: %v", err)
+		}
+	}
+
+	const total = 1000
+	if err := db.UpsertModems(syntheticModems(0xBB, total)); err != nil {
+		t.Fatalf("UpsertModems failed: %v", err)
+	}
+
+	// A second discovery updates every row in place
+	if err := db.UpsertModems(syntheticModems(0xBB, total)); err != nil {
+		t.Fatalf("UpsertModems update failed: %v", err)
+	}
+
+	var count int
+	if err := db.queryRow(`SELECT COUNT(*) FROM cable_modem`).Scan(&count); err != nil {
+		t.Fatalf("Failed to count modems: %v", err)
+	}
+	if count != sample+total {
+		t.Errorf("Expected %d modems, got %d", sample+total, count)
+	}
+}
+
+// BenchmarkUpsertModems compares storing a discovery in one batch with
+// storing it one modem at a time, as discovery used to
+func BenchmarkUpsertModems(b *testing.B) {
+	const total = 1000
+
+	for _, tc := range []struct {
+		name  string
+		batch bool
+	}{
+		{"OneAtATime", false},
+		{"Batch", true},
+	} {
+		b.Run(tc.name, func(b *testing.B) {
+			db, err := New(filepath.Join(b.TempDir(), "upgrader.db"))
+			if err != nil {
+				b.Fatalf("Failed to open database: %v", err)
+			}
+			defer db.Close()
+
+			modems := syntheticModems(0xBB, total)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if tc.batch {
+					if err := db.UpsertModems(modems); err != nil {
+						b.Fatalf("UpsertModems failed: %v", err)
+					}
+					continue
+				}
+				for _, modem := range modems {
+					if err := db.UpsertModem(modem); err != nil {
+						b.Fatalf("UpsertModem failed: %v", err)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestUpsertModemsStatusTransitions(t *testing.T) {
+	db, err := NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	// 250 modems spans several activity_log batches
+	modems := make([]*models.CableModem, 250)
+	for i := range modems {
+		modems[i] = &models.CableModem{
+			CMTSID:     1,
+			MACAddress: fmt.Sprintf("AA:00:00:00:%02X:%02X", i/256, i%256),
+			IPAddress:  "10.0.0.200",
+			Status:     "online",
+		}
+	}
+	if err := db.UpsertModems(modems); err != nil {
+		t.Fatalf("Failed to upsert modems: %v", err)
+	}
+
+	countEvents := func(eventType string) int {
+		logs, err := db.ListActivityLogs(ActivityLogFilter{EventType: eventType}, 1000, 0)
+		if err != nil {
+			t.Fatalf("Failed to list activity logs: %v", err)
+		}
+		return len(logs)
+	}
+
+	// Newly discovered modems aren't transitions
+	if n := countEvents(models.EventModemOnline); n != 0 {
+		t.Errorf("Expected no MODEM_ONLINE for new modems, got %d", n)
+	}
+
+	for _, modem := range modems {
+		modem.Status = "offline"
+	}
+	modems[0].Status = "online"
+	modems[1].Status = ""
+	if err := db.UpsertModems(modems); err != nil {
+		t.Fatalf("Failed to upsert modems: %v", err)
+	}
+	if n := countEvents(models.EventModemLost); n != 248 {
+		t.Errorf("Expected 248 MODEM_LOST events, got %d", n)
+	}
+
+	modems[2].Status = "online"
+	modems[3].Status = "partial"
+	if err := db.UpsertModems(modems); err != nil {
+		t.Fatalf("Failed to upsert modems: %v", err)
+	}
+
+	logs, err := db.ListActivityLogs(ActivityLogFilter{EventType: models.EventModemOnline}, 10, 0)
+	if err != nil {
+		t.Fatalf("Failed to list activity logs: %v", err)
+	}
+	if len(logs) != 1 || logs[0].EntityType != "modem" || !strings.Contains(logs[0].Message, modems[2].MACAddress) {
+		t.Errorf("Expected one MODEM_ONLINE for %s, got %+v", modems[2].MACAddress, logs)
+	}
+	// offline to partial doesn't involve online, so it isn't logged
+	if n := countEvents(models.EventModemLost); n != 248 {
+		t.Errorf("Expected MODEM_LOST count to stay 248, got %d", n)
+	}
+}
+
+func TestUpsertModemMovedCMTS(t *testing.T) {
+	db, err := NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	modem := &models.CableModem{
+		CMTSID:     1,
+		MACAddress: "00:01:5C:DD:00:01",
+		IPAddress:  "10.0.0.210",
+		Status:     "online",
+	}
+	if err := db.UpsertModem(modem); err != nil {
+		t.Fatalf("Failed to upsert modem: %v", err)
+	}
+	// Seeing it again on the same CMTS isn't a move
+	if err := db.UpsertModem(modem); err != nil {
+		t.Fatalf("Failed to upsert modem: %v", err)
+	}
+
+	modem.CMTSID = 2
+	if err := db.UpsertModem(modem); err != nil {
+		t.Fatalf("Failed to upsert modem: %v", err)
+	}
+
+	stored, err := db.GetModemByMAC(modem.MACAddress)
+	if err != nil {
+		t.Fatalf("Failed to get modem: %v", err)
+	}
+	if stored.CMTSID != 2 {
+		t.Errorf("Expected modem on CMTS 2, got %d", stored.CMTSID)
+	}
+
+	logs, err := db.ListActivityLogs(ActivityLogFilter{EventType: models.EventModemMoved}, 10, 0)
+	if err != nil {
+		t.Fatalf("Failed to list activity logs: %v", err)
+	}
+	if len(logs) != 1 {
+		t.Fatalf("Expected one MODEM_MOVED event, got %+v", logs)
+	}
+	if logs[0].EntityType != "modem" || logs[0].EntityID != stored.ID {
+		t.Errorf("Expected the event on modem %d, got %s %d", stored.ID, logs[0].EntityType, logs[0].EntityID)
+	}
+	if want := "Modem 00:01:5C:DD:00:01 moved from CMTS 1 to CMTS 2"; logs[0].Message != want {
+		t.Errorf("Expected message %q, got %q", want, logs[0].Message)
+	}
+	if logs[0].Details != `{"from_cmts_id":1,"to_cmts_id":2}` {
+		t.Errorf("Unexpected details: %s", logs[0].Details)
+	}
+}
+
+func TestListModems(t *testing.T) {
+	db, err := NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	err = db.LoadTestFixtures()
+	if err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	// Add more modems
+	for i := 1; i <= 3; i++ {
+		mac := string([]byte{0x00, 0x01, 0x5C, 0x11, 0x22, byte(0x40 + i)})
+		err := db.UpsertModem(&models.CableModem{
+			CMTSID:          1,
+			MACAddress:      mac,
+			IPAddress:       "10.0.0." + string(rune('0'+i)),
+			SysDescr:        "Test Modem",
+			CurrentFirmware: "1.0.0",
+			SignalLevel:     5.0,
+			Status:          "online",
+			LastSeen:        time.Now(),
+		})
+		if err != nil {
+			t.Fatalf("Failed to create modem: %v", err)
+		}
+	}
+
+	modems, err := db.ListModems(0)
+	if err != nil {
+		t.Fatalf("Failed to list modems: %v", err)
+	}
+
+	if len(modems) < 1 {
+		t.Errorf("Expected at least 1 modem, got %d", len(modems))
+	}
+}
+
+func TestListModemsByCMTS(t *testing.T) {
+	db, err := NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	err = db.LoadTestFixtures()
+	if err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	modems, err := db.ListModems(1)
+	if err != nil {
+		t.Fatalf("Failed to list modems by CMTS: %v", err)
+	}
+
+	if len(modems) != 1 {
+		t.Errorf("Expected 1 modem, got %d", len(modems))
+	}
+
+	if modems[0].CMTSID != 1 {
+		t.Errorf("Expected CMTS ID 1, got %d", modems[0].CMTSID)
+	}
+}
+
+func TestCountModemsByStatus(t *testing.T) {
+	db, err := NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	err = db.LoadTestFixtures()
+	if err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	for i, status := range []string{"offline", "offline", "partial"} {
+		err := db.UpsertModem(&models.CableModem{
+			CMTSID:     1,
+			MACAddress: fmt.Sprintf("00:01:5C:CC:00:%02X", i),
+			Status:     status,
+		})
+		if err != nil {
+			t.Fatalf("Failed to upsert modem: %v", err)
+		}
+	}
+
+	counts, err := db.CountModemsByStatus(1)
+	if err != nil {
+		t.Fatalf("Failed to count modems: %v", err)
+	}
+
+	if counts["online"] != 1 || counts["offline"] != 2 || counts["partial"] != 1 {
+		t.Errorf("Unexpected counts: %v", counts)
+	}
+	if _, ok := counts["denied"]; ok {
+		t.Errorf("Expected no denied entry, got %v", counts)
+	}
+
+	counts, err = db.CountModemsByStatus(99)
+	if err != nil {
+		t.Fatalf("Failed to count modems: %v", err)
+	}
+	if len(counts) != 0 {
+		t.Errorf("Expected no counts for unknown CMTS, got %v", counts)
+	}
+}
+
+func TestCleanupStaleModems(t *testing.T) {
+	db, err := NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	now := time.Now()
+	modems := []struct {
+		mac      string
+		status   string
+		lastSeen time.Time
+	}{
+		{"00:01:5C:DD:00:01", "online", now},                            // fresh, untouched
+		{"00:01:5C:DD:00:02", "online", now.Add(-30 * time.Minute)},     // marked offline
+		{"00:01:5C:DD:00:03", "partial", now.Add(-2 * time.Hour)},       // marked offline
+		{"00:01:5C:DD:00:04", "offline", now.Add(-time.Hour)},           // already offline, kept
+		{"00:01:5C:DD:00:05", "offline", now.Add(-10 * 24 * time.Hour)}, // deleted
+		{"00:01:5C:DD:00:06", "online", now.Add(-10 * 24 * time.Hour)},  // marked offline, then deleted
+	}
+	for _, m := range modems {
+		if err := db.UpsertModem(&models.CableModem{CMTSID: 1, MACAddress: m.mac, Status: m.status}); err != nil {
+			t.Fatalf("Failed to upsert modem: %v", err)
+		}
+		// Discovery always stamps last_seen with now, so backdate it directly
+		if _, err := db.conn.Exec("UPDATE cable_modem SET last_seen = ? WHERE mac_address = ?", m.lastSeen.Unix(), m.mac); err != nil {
+			t.Fatalf("Failed to backdate modem: %v", err)
+		}
+	}
+
+	// Upgrade history outlives the modem
+	doomed, err := db.GetModemByMAC("00:01:5C:DD:00:05")
+	if err != nil {
+		t.Fatalf("Failed to get modem: %v", err)
+	}
+	jobID, err := db.CreateJob(&models.UpgradeJob{ModemID: doomed.ID, RuleID: 1, CMTSID: 1,
+		MACAddress: doomed.MACAddress, Status: models.JobStatusCompleted})
+	if err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+
+	markedOffline, deleted, err := db.CleanupStaleModems(10, 7)
+	if err != nil {
+		t.Fatalf("Failed to clean up modems: %v", err)
+	}
+	if markedOffline != 3 || deleted != 2 {
+		t.Errorf("Expected 3 marked offline and 2 deleted, got %d and %d", markedOffline, deleted)
+	}
+
+	want := map[string]string{
+		"00:01:5C:DD:00:01": "online",
+		"00:01:5C:DD:00:02": "offline",
+		"00:01:5C:DD:00:03": "offline",
+		"00:01:5C:DD:00:04": "offline",
+	}
+	for mac, status := range want {
+		modem, err := db.GetModemByMAC(mac)
+		if err != nil {
+			t.Fatalf("Failed to get modem %s: %v", mac, err)
+		}
+		if modem.Status != status {
+			t.Errorf("Expected %s to be %s, got %s", mac, status, modem.Status)
+		}
+	}
+	for _, mac := range []string{"00:01:5C:DD:00:05", "00:01:5C:DD:00:06"} {
+		if _, err := db.GetModemByMAC(mac); err != models.ErrNotFound {
+			t.Errorf("Expected %s to be deleted, got %v", mac, err)
+		}
+	}
+	var orphans int
+	db.conn.QueryRow(`SELECT COUNT(*) FROM modem_signal_history
+		WHERE modem_id NOT IN (SELECT id FROM cable_modem)`).Scan(&orphans)
+	if orphans != 0 {
+		t.Errorf("Expected signal history deleted with its modems, got %d orphaned readings", orphans)
+	}
+	job, err := db.GetJob(jobID)
+	if err != nil {
+		t.Fatalf("Expected the deleted modem's job kept, got %v", err)
+	}
+	if job.ModemID != 0 {
+		t.Errorf("Expected the job detached from its deleted modem, got modem %d", job.ModemID)
+	}
+
+	// A second pass has nothing left to do
+	markedOffline, deleted, err = db.CleanupStaleModems(10, 7)
+	if err != nil || markedOffline != 0 || deleted != 0 {
+		t.Errorf("Expected an idempotent second pass, got %d, %d, %v", markedOffline, deleted, err)
+	}
+}
+
+func TestDeleteModemsByCMTS(t *testing.T) {
+	db, err := NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	for _, m := range []struct {
+		cmtsID int
+		mac    string
+	}{
+		{1, "00:01:5C:EE:00:01"},
+		{1, "00:01:5C:EE:00:02"},
+		{1, "00:01:5C:EE:00:03"},
+		{2, "00:01:5C:EE:00:04"},
+	} {
+		if err := db.UpsertModem(&models.CableModem{CMTSID: m.cmtsID, MACAddress: m.mac, Status: "online"}); err != nil {
+			t.Fatalf("Failed to upsert modem: %v", err)
+		}
+	}
+
+	// A pending job protects its modem; a finished one doesn't
+	jobIDs := make(map[string]int)
+	for mac, status := range map[string]string{
+		"00:01:5C:EE:00:01": models.JobStatusPending,
+		"00:01:5C:EE:00:02": models.JobStatusCompleted,
+	} {
+		modem, err := db.GetModemByMAC(mac)
+		if err != nil {
+			t.Fatalf("Failed to get modem: %v", err)
+		}
+		jobIDs[mac], err = db.CreateJob(&models.UpgradeJob{
+			ModemID:    modem.ID,
+			RuleID:     1,
+			CMTSID:     1,
+			MACAddress: mac,
+			Status:     status,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create job: %v", err)
+		}
+	}
+
+	// Only modems not seen since the cutoff go in a stale reset
+	if _, err := db.conn.Exec("UPDATE cable_modem SET last_seen = ? WHERE mac_address = ?",
+		time.Now().Add(-time.Hour).Unix(), "00:01:5C:EE:00:03"); err != nil {
+		t.Fatalf("Failed to backdate modem: %v", err)
+	}
+	deleted, skipped, err := db.DeleteStaleModemsByCMTS(1, time.Now().Add(-10*time.Minute))
+	if err != nil {
+		t.Fatalf("Failed to delete stale modems: %v", err)
+	}
+	if deleted != 1 || len(skipped) != 0 {
+		t.Errorf("Expected 1 stale modem deleted and none skipped, got %d and %v", deleted, skipped)
+	}
+
+	deleted, skipped, err = db.DeleteModemsByCMTS(1)
+	if err != nil {
+		t.Fatalf("Failed to delete modems: %v", err)
+	}
+	if deleted != 2 {
+		t.Errorf("Expected 2 modems deleted, got %d", deleted)
+	}
+	if len(skipped) != 1 || skipped[0] != "00:01:5C:EE:00:01" {
+		t.Errorf("Expected the modem with a pending job skipped, got %v", skipped)
+	}
+
+	remaining, err := db.ListModems(1)
+	if err != nil {
+		t.Fatalf("Failed to list modems: %v", err)
+	}
+	if len(remaining) != 1 || remaining[0].MACAddress != "00:01:5C:EE:00:01" {
+		t.Errorf("Expected only the busy modem left on CMTS 1, got %d modems", len(remaining))
+	}
+	if _, err := db.GetModemByMAC("00:01:5C:EE:00:04"); err != nil {
+		t.Errorf("Expected the other CMTS's modem kept, got %v", err)
+	}
+	job, err := db.GetJob(jobIDs["00:01:5C:EE:00:02"])
+	if err != nil {
+		t.Fatalf("Expected the finished job kept, got %v", err)
+	}
+	if job.ModemID != 0 || job.Status != models.JobStatusCompleted {
+		t.Errorf("Expected the finished job detached from its deleted modem, got modem %d, %s", job.ModemID, job.Status)
 	}
 }
 
@@ -470,6 +2012,173 @@ func TestGetRule(t *testing.T) {
 	}
 }
 
+func TestGetRuleByName(t *testing.T) {
+	db, err := NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	err = db.LoadTestFixtures()
+	if err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	rule, err := db.GetRuleByName("Test Rule")
+	if err != nil {
+		t.Fatalf("Failed to get rule by name: %v", err)
+	}
+	if rule.ID != 1 {
+		t.Errorf("Expected rule ID 1, got %d", rule.ID)
+	}
+
+	if _, err := db.GetRuleByName("Missing Rule"); err != models.ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestImportRules(t *testing.T) {
+	db, err := NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	err = db.LoadTestFixtures()
+	if err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	rules := []*models.UpgradeRule{
+		{
+			Name:             "Test Rule",
+			MatchType:        "MAC_RANGE",
+			MatchCriteria:    `{"start_mac":"00:01:5C:00:00:00","end_mac":"00:01:5C:FF:FF:FF"}`,
+			TFTPServerIP:     "192.168.1.60",
+			FirmwareFilename: "firmware-v3.0.0.bin",
+			Enabled:          true,
+			Priority:         100,
+		},
+		{
+			Name:             "Motorola Rule",
+			MatchType:        "SYSDESCR_REGEX",
+			MatchCriteria:    `{"pattern":"Motorola"}`,
+			TFTPServerIP:     "192.168.1.60",
+			FirmwareFilename: "motorola-v1.0.0.bin",
+			Enabled:          true,
+		},
+	}
+
+	created, updated, err := db.ImportRules(rules)
+	if err != nil {
+		t.Fatalf("Failed to import rules: %v", err)
+	}
+	if created != 1 || updated != 1 {
+		t.Errorf("Expected 1 created and 1 updated, got %d and %d", created, updated)
+	}
+
+	rule, _ := db.GetRule(1)
+	if rule.FirmwareFilename != "firmware-v3.0.0.bin" {
+		t.Errorf("Expected existing rule to be updated, got %s", rule.FirmwareFilename)
+	}
+
+	// Re-importing the same rules is idempotent
+	created, updated, err = db.ImportRules(rules)
+	if err != nil || created != 0 || updated != 2 {
+		t.Errorf("Expected 0 created and 2 updated on re-import, got %d and %d (err %v)", created, updated, err)
+	}
+
+	// An invalid rule anywhere in the list leaves everything untouched
+	rules[0].FirmwareFilename = "firmware-v4.0.0.bin"
+	rules = append(rules, &models.UpgradeRule{Name: "Broken Rule", MatchType: "BOGUS"})
+	if _, _, err := db.ImportRules(rules); err == nil {
+		t.Fatal("Expected error for invalid rule")
+	}
+
+	rule, _ = db.GetRule(1)
+	if rule.FirmwareFilename != "firmware-v3.0.0.bin" {
+		t.Errorf("Expected rule unchanged after failed import, got %s", rule.FirmwareFilename)
+	}
+	all, _ := db.ListRules()
+	if len(all) != 2 {
+		t.Errorf("Expected 2 rules after failed import, got %d", len(all))
+	}
+
+	// Duplicate names within one import are rejected
+	dup := []*models.UpgradeRule{rules[1], rules[1]}
+	if _, _, err := db.ImportRules(dup); err == nil {
+		t.Error("Expected error for duplicate rule names")
+	}
+}
+
+func TestRestoreBackup(t *testing.T) {
+	db, err := NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	err = db.LoadTestFixtures()
+	if err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	existing, _ := db.GetCMTS(1)
+	fixtureRule, _ := db.GetRule(1)
+	updatedRule := fixtureRule.Spec()
+	updatedRule.FirmwareFilename = "firmware-v9.0.0.bin"
+
+	backup := &models.Backup{
+		SchemaVersion: models.BackupSchemaVersion,
+		CMTS: []models.CMTSSpec{
+			{Name: existing.Name, IPAddress: "192.168.1.2", SNMPPort: 161, CommunityRead: "public", CommunityWrite: "new-private", SNMPVersion: 2, Enabled: true},
+			{Name: "Restored CMTS", IPAddress: "192.168.7.1", SNMPPort: 161, CommunityRead: "public", SNMPVersion: 2},
+		},
+		Rules: []models.RuleSpec{
+			updatedRule,
+			{Name: "Restored Rule", MatchType: "SYSDESCR_REGEX", MatchCriteria: `{"pattern":"Arris"}`, TFTPServerIP: "192.168.1.60", FirmwareFilename: "arris.bin"},
+		},
+		Settings: map[string]string{"workers": "7"},
+	}
+
+	result, err := db.RestoreBackup(backup)
+	if err != nil {
+		t.Fatalf("Failed to restore backup: %v", err)
+	}
+	want := models.RestoreResult{CMTSCreated: 1, CMTSUpdated: 1, RulesCreated: 1, RulesUpdated: 1, Settings: 1}
+	if *result != want {
+		t.Errorf("Expected %+v, got %+v", want, *result)
+	}
+
+	cmts, _ := db.GetCMTS(1)
+	if cmts.IPAddress != "192.168.1.2" || cmts.CommunityWrite != "new-private" {
+		t.Errorf("Expected existing CMTS updated by name, got %+v", cmts)
+	}
+	rule, _ := db.GetRule(1)
+	if rule.FirmwareFilename != "firmware-v9.0.0.bin" {
+		t.Errorf("Expected existing rule updated by name, got %s", rule.FirmwareFilename)
+	}
+	if workers, _ := db.GetSetting("workers"); workers != "7" {
+		t.Errorf("Expected workers setting 7, got %s", workers)
+	}
+
+	// A conflicting IP rolls back the whole restore
+	backup.CMTS[1].IPAddress = "192.168.1.2"
+	backup.Settings["workers"] = "3"
+	if _, err := db.RestoreBackup(backup); !errors.Is(err, models.ErrDuplicate) {
+		t.Fatalf("Expected ErrDuplicate, got %v", err)
+	}
+	if workers, _ := db.GetSetting("workers"); workers != "7" {
+		t.Errorf("Expected settings unchanged after failed restore, got workers %s", workers)
+	}
+
+	// So does an invalid CMTS
+	backup.CMTS[1] = models.CMTSSpec{Name: "Broken CMTS"}
+	if _, err := db.RestoreBackup(backup); err == nil {
+		t.Error("Expected error for invalid CMTS")
+	}
+}
+
 func TestListRules(t *testing.T) {
 	db, err := NewTestDB()
 	if err != nil {
@@ -580,6 +2289,11 @@ func TestUpdateRule(t *testing.T) {
 	rule.Name = "Updated Rule"
 	rule.Priority = 200
 	rule.Enabled = false
+	rule.MaxConcurrent = 5
+	rule.AdminStatusValue = 2
+	rule.CustomUpgradeOID = "1.3.6.1.4.1.4115.1.3.4.1.1.5.0"
+	rule.TransportProtocol = models.TransportHTTP
+	rule.UpgradePollInterval = 60
 
 	err = db.UpdateRule(rule)
 	if err != nil {
@@ -601,6 +2315,18 @@ func TestUpdateRule(t *testing.T) {
 	if updated.Enabled {
 		t.Error("Expected enabled to be false")
 	}
+	if updated.MaxConcurrent != 5 {
+		t.Errorf("Expected max concurrent 5, got %d", updated.MaxConcurrent)
+	}
+	if updated.AdminStatusValue != 2 || updated.CustomUpgradeOID != "1.3.6.1.4.1.4115.1.3.4.1.1.5.0" {
+		t.Errorf("Expected trigger overrides saved, got %d %q", updated.AdminStatusValue, updated.CustomUpgradeOID)
+	}
+	if updated.TransportProtocol != models.TransportHTTP {
+		t.Errorf("Expected transport http, got %q", updated.TransportProtocol)
+	}
+	if updated.UpgradePollInterval != 60 {
+		t.Errorf("Expected upgrade poll interval 60, got %d", updated.UpgradePollInterval)
+	}
 }
 
 func TestDeleteRule(t *testing.T) {
@@ -642,14 +2368,15 @@ func TestCreateJob(t *testing.T) {
 	}
 
 	job := &models.UpgradeJob{
-		ModemID:          1,
-		RuleID:           1,
-		CMTSID:           1,
-		MACAddress:       "00:01:5C:11:22:33",
-		Status:           models.JobStatusPending,
-		TFTPServerIP:     "192.168.1.50",
-		FirmwareFilename: "firmware.bin",
-		MaxRetries:       3,
+		ModemID:             1,
+		RuleID:              1,
+		CMTSID:              1,
+		MACAddress:          "00:01:5C:11:22:33",
+		Status:              models.JobStatusPending,
+		TFTPServerIP:        "192.168.1.50",
+		FirmwareFilename:    "firmware.bin",
+		MaxRetries:          3,
+		UpgradePollInterval: 30,
 	}
 
 	id, err := db.CreateJob(job)
@@ -670,6 +2397,12 @@ func TestCreateJob(t *testing.T) {
 	if retrieved.Status != models.JobStatusPending {
 		t.Errorf("Expected status PENDING, got %s", retrieved.Status)
 	}
+	if retrieved.UpgradePollInterval != 30 {
+		t.Errorf("Expected upgrade poll interval 30, got %d", retrieved.UpgradePollInterval)
+	}
+	if job.TraceID == "" || retrieved.TraceID != job.TraceID {
+		t.Errorf("Expected a trace ID to be assigned and stored, got %q and %q", job.TraceID, retrieved.TraceID)
+	}
 }
 
 func TestGetJob(t *testing.T) {
@@ -758,6 +2491,76 @@ func TestListPendingJobs(t *testing.T) {
 	}
 }
 
+func TestListDispatchablePendingJobs(t *testing.T) {
+	db, err := NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	err = db.LoadTestFixtures()
+	if err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	now := time.Now()
+	past := now.Add(-time.Minute)
+	future := now.Add(time.Minute)
+
+	ids := map[string]int{}
+	for name, nextRetryAt := range map[string]*time.Time{"fresh": nil, "elapsed": &past, "backoff": &future} {
+		id, err := db.CreateJob(&models.UpgradeJob{
+			ModemID:          1,
+			RuleID:           1,
+			CMTSID:           1,
+			MACAddress:       "00:01:5C:11:22:33",
+			Status:           models.JobStatusPending,
+			TFTPServerIP:     "192.168.1.50",
+			FirmwareFilename: "firmware.bin",
+			MaxRetries:       3,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create job: %v", err)
+		}
+		job, _ := db.GetJob(id)
+		job.NextRetryAt = nextRetryAt
+		if err := db.UpdateJob(job); err != nil {
+			t.Fatalf("Failed to update job: %v", err)
+		}
+		ids[name] = id
+	}
+
+	jobs, err := db.ListDispatchablePendingJobs(now, 0)
+	if err != nil {
+		t.Fatalf("Failed to list dispatchable jobs: %v", err)
+	}
+
+	got := map[int]bool{}
+	for _, job := range jobs {
+		got[job.ID] = true
+	}
+	if len(jobs) != 2 || !got[ids["fresh"]] || !got[ids["elapsed"]] {
+		t.Errorf("Expected fresh and elapsed jobs, got %v", got)
+	}
+
+	backoff, err := db.GetJob(ids["backoff"])
+	if err != nil {
+		t.Fatalf("Failed to get job: %v", err)
+	}
+	if backoff.NextRetryAt == nil || backoff.NextRetryAt.Unix() != future.Unix() {
+		t.Errorf("Expected next_retry_at %v, got %v", future, backoff.NextRetryAt)
+	}
+
+	// Once the backoff has passed the job becomes dispatchable
+	jobs, err = db.ListDispatchablePendingJobs(future, 0)
+	if err != nil {
+		t.Fatalf("Failed to list dispatchable jobs: %v", err)
+	}
+	if len(jobs) != 3 {
+		t.Errorf("Expected 3 dispatchable jobs after backoff, got %d", len(jobs))
+	}
+}
+
 func TestUpdateJob(t *testing.T) {
 	db, err := NewTestDB()
 	if err != nil {
@@ -864,21 +2667,234 @@ func TestCheckPendingJobForModem(t *testing.T) {
 		t.Fatalf("Failed to list pending jobs: %v", err)
 	}
 
-	hasPending = false
-	for _, job := range pendingJobs {
-		if job.MACAddress == mac {
-			hasPending = true
-			break
-		}
+	hasPending = false
+	for _, job := range pendingJobs {
+		if job.MACAddress == mac {
+			hasPending = true
+			break
+		}
+	}
+
+	if !hasPending {
+		t.Error("Expected pending job to exist")
+	}
+}
+
+// Activity Log Tests
+
+func TestPurgeOldJobs(t *testing.T) {
+	db, err := NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	old := time.Now().Add(-60 * 24 * time.Hour).Unix()
+	ids := make(map[string]int)
+	for _, status := range []string{
+		models.JobStatusPending, models.JobStatusInProgress, models.JobStatusCompleted,
+		models.JobStatusFailed, models.JobStatusSkipped,
+	} {
+		id, err := db.CreateJob(&models.UpgradeJob{
+			ModemID:          1,
+			RuleID:           1,
+			CMTSID:           1,
+			MACAddress:       "00:01:5C:11:22:33",
+			Status:           status,
+			TFTPServerIP:     "192.168.1.50",
+			FirmwareFilename: "firmware.bin",
+			MaxRetries:       3,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create job: %v", err)
+		}
+		db.conn.Exec("UPDATE upgrade_job SET created_at = ?, completed_at = ? WHERE id = ?", old, old, id)
+		ids[status] = id
+	}
+
+	// A recently finished job stays
+	recentID, _ := db.CreateJob(&models.UpgradeJob{
+		ModemID: 1, RuleID: 1, CMTSID: 1, MACAddress: "00:01:5C:11:22:33",
+		Status: models.JobStatusCompleted, MaxRetries: 3,
+	})
+
+	purged, err := db.PurgeOldJobs(30 * 24 * time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to purge jobs: %v", err)
+	}
+	if purged != 3 {
+		t.Errorf("Expected 3 jobs purged, got %d", purged)
+	}
+
+	for _, status := range []string{models.JobStatusPending, models.JobStatusInProgress} {
+		if _, err := db.GetJob(ids[status]); err != nil {
+			t.Errorf("Expected %s job to survive purge: %v", status, err)
+		}
+	}
+	if _, err := db.GetJob(ids[models.JobStatusCompleted]); err != models.ErrNotFound {
+		t.Errorf("Expected old completed job to be purged, got %v", err)
+	}
+	if _, err := db.GetJob(recentID); err != nil {
+		t.Errorf("Expected recent job to survive purge: %v", err)
+	}
+}
+
+func TestPurgeOldActivityLogs(t *testing.T) {
+	db, err := NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 3; i++ {
+		db.LogActivity(&models.ActivityLog{EventType: models.EventSystemEvent, Message: "old"})
+	}
+	db.conn.Exec("UPDATE activity_log SET created_at = ?", time.Now().Add(-60*24*time.Hour).Unix())
+	db.LogActivity(&models.ActivityLog{EventType: models.EventSystemEvent, Message: "new"})
+
+	purged, err := db.PurgeOldActivityLogs(30 * 24 * time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to purge activity logs: %v", err)
+	}
+	if purged != 3 {
+		t.Errorf("Expected 3 logs purged, got %d", purged)
+	}
+
+	logs, _ := db.ListActivityLogs(ActivityLogFilter{}, 10, 0)
+	if len(logs) != 1 || logs[0].Message != "new" {
+		t.Errorf("Expected only the recent log to remain, got %d", len(logs))
+	}
+}
+
+func TestSignalHistory(t *testing.T) {
+	db, err := NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	modem := &models.CableModem{
+		CMTSID:      1,
+		MACAddress:  "00:01:5C:EE:00:01",
+		IPAddress:   "10.0.0.220",
+		SignalLevel: 4.5,
+		OFDMPower:   2.5,
+		Status:      "online",
+	}
+	if err := db.UpsertModem(modem); err != nil {
+		t.Fatalf("Failed to upsert modem: %v", err)
+	}
+	stored, err := db.GetModemByMAC(modem.MACAddress)
+	if err != nil {
+		t.Fatalf("Failed to get modem: %v", err)
+	}
+
+	// Age the first reading, then record a weaker one
+	db.conn.Exec("UPDATE modem_signal_history SET recorded_at = ? WHERE modem_id = ?", time.Now().Add(-10*24*time.Hour).Unix(), stored.ID)
+	modem.SignalLevel = -9.5
+	modem.OFDMPower = 0
+	db.UpsertModem(modem)
+
+	// A discovery without levels adds nothing
+	modem.SignalUnavailable = true
+	db.UpsertModem(modem)
+
+	readings, err := db.GetSignalHistory(stored.ID, time.Time{})
+	if err != nil {
+		t.Fatalf("Failed to get signal history: %v", err)
+	}
+	if len(readings) != 2 {
+		t.Fatalf("Expected 2 readings, got %d", len(readings))
+	}
+	first, second := readings[0], readings[1]
+	if first.SignalLevel == nil || *first.SignalLevel != 4.5 || first.OFDMPower == nil || *first.OFDMPower != 2.5 {
+		t.Errorf("Unexpected first reading: %+v", first)
+	}
+	if second.SignalLevel == nil || *second.SignalLevel != -9.5 || second.OFDMPower != nil {
+		t.Errorf("Unexpected second reading: %+v", second)
+	}
+	if !first.RecordedAt.Before(second.RecordedAt) {
+		t.Errorf("Expected readings oldest first, got %v then %v", first.RecordedAt, second.RecordedAt)
+	}
+
+	readings, err = db.GetSignalHistory(stored.ID, time.Now().Add(-24*time.Hour))
+	if err != nil || len(readings) != 1 {
+		t.Errorf("Expected 1 reading in the last day, got %d (%v)", len(readings), err)
+	}
+
+	purged, err := db.PurgeOldSignalHistory(7 * 24 * time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to purge signal history: %v", err)
+	}
+	if purged != 1 {
+		t.Errorf("Expected 1 reading purged, got %d", purged)
+	}
+	if readings, _ = db.GetSignalHistory(stored.ID, time.Time{}); len(readings) != 1 {
+		t.Errorf("Expected the recent reading to remain, got %d", len(readings))
+	}
+}
+
+func TestSignalHistoryOnlyOnChange(t *testing.T) {
+	db, err := NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	modem := &models.CableModem{
+		CMTSID:      1,
+		MACAddress:  "00:01:5C:EE:00:02",
+		IPAddress:   "10.0.0.221",
+		SignalLevel: 4.5,
+		Status:      "online",
+	}
+	count := func() int {
+		stored, err := db.GetModemByMAC(modem.MACAddress)
+		if err != nil {
+			t.Fatalf("Failed to get modem: %v", err)
+		}
+		readings, err := db.GetSignalHistory(stored.ID, time.Time{})
+		if err != nil {
+			t.Fatalf("Failed to get signal history: %v", err)
+		}
+		return len(readings)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := db.UpsertModem(modem); err != nil {
+			t.Fatalf("Failed to upsert modem: %v", err)
+		}
+	}
+	if n := count(); n != 1 {
+		t.Errorf("Expected a steady level recorded once, got %d readings", n)
+	}
+
+	modem.SignalLevel = 3.0
+	db.UpsertModem(modem)
+	if n := count(); n != 2 {
+		t.Errorf("Expected a changed level recorded, got %d readings", n)
 	}
 
-	if !hasPending {
-		t.Error("Expected pending job to exist")
+	// A steady level is still sampled once signalHistoryInterval passes
+	db.conn.Exec("UPDATE modem_signal_history SET recorded_at = recorded_at - ?", int64(signalHistoryInterval/time.Second))
+	db.UpsertModem(modem)
+	if n := count(); n != 3 {
+		t.Errorf("Expected a steady level resampled after the interval, got %d readings", n)
 	}
 }
 
-// Activity Log Tests
-
 func TestLogActivity(t *testing.T) {
 	db, err := NewTestDB()
 	if err != nil {
@@ -900,6 +2916,86 @@ func TestLogActivity(t *testing.T) {
 	}
 }
 
+func TestWithTx(t *testing.T) {
+	db, err := NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	jobID, err := db.CreateJob(&models.UpgradeJob{
+		ModemID:          1,
+		RuleID:           1,
+		CMTSID:           1,
+		MACAddress:       "00:01:5C:11:22:33",
+		Status:           models.JobStatusPending,
+		TFTPServerIP:     "192.168.1.50",
+		FirmwareFilename: "firmware-v2.0.0.bin",
+		MaxRetries:       3,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+
+	countLogs := func() int {
+		logs, err := db.ListActivityLogs(ActivityLogFilter{EventType: models.EventUpgradeStarted}, 100, 0)
+		if err != nil {
+			t.Fatalf("Failed to list activity logs: %v", err)
+		}
+		return len(logs)
+	}
+
+	update := func(status string, fail error) error {
+		return db.WithTx(func(tx *Tx) error {
+			job, err := tx.GetJob(jobID)
+			if err != nil {
+				return err
+			}
+			job.Status = status
+			if err := tx.UpdateJob(job); err != nil {
+				return err
+			}
+			if err := tx.LogActivity(&models.ActivityLog{
+				EventType:  models.EventUpgradeStarted,
+				EntityType: "job",
+				EntityID:   jobID,
+				Message:    "Started firmware upgrade",
+			}); err != nil {
+				return err
+			}
+			return fail
+		})
+	}
+
+	// An error from fn rolls back both writes
+	errAbort := errors.New("abort")
+	if err := update(models.JobStatusInProgress, errAbort); err != errAbort {
+		t.Fatalf("Expected fn error to be returned, got %v", err)
+	}
+	job, _ := db.GetJob(jobID)
+	if job.Status != models.JobStatusPending {
+		t.Errorf("Expected rolled back status PENDING, got %s", job.Status)
+	}
+	if n := countLogs(); n != 0 {
+		t.Errorf("Expected rolled back activity log, got %d entries", n)
+	}
+
+	if err := update(models.JobStatusInProgress, nil); err != nil {
+		t.Fatalf("Failed to commit transaction: %v", err)
+	}
+	job, _ = db.GetJob(jobID)
+	if job.Status != models.JobStatusInProgress {
+		t.Errorf("Expected committed status IN_PROGRESS, got %s", job.Status)
+	}
+	if n := countLogs(); n != 1 {
+		t.Errorf("Expected 1 committed activity log, got %d", n)
+	}
+}
+
 func TestListActivityLogs(t *testing.T) {
 	db, err := NewTestDB()
 	if err != nil {
@@ -921,7 +3017,7 @@ func TestListActivityLogs(t *testing.T) {
 		}
 	}
 
-	logs, err := db.ListActivityLogs(10, 0)
+	logs, err := db.ListActivityLogs(ActivityLogFilter{}, 10, 0)
 	if err != nil {
 		t.Fatalf("Failed to list activity logs: %v", err)
 	}
@@ -957,7 +3053,7 @@ func TestListActivityLogsPagination(t *testing.T) {
 	}
 
 	// Get first page (10 items)
-	page1, err := db.ListActivityLogs(10, 0)
+	page1, err := db.ListActivityLogs(ActivityLogFilter{}, 10, 0)
 	if err != nil {
 		t.Fatalf("Failed to list activity logs page 1: %v", err)
 	}
@@ -967,7 +3063,7 @@ func TestListActivityLogsPagination(t *testing.T) {
 	}
 
 	// Get second page (5 remaining items)
-	page2, err := db.ListActivityLogs(10, 10)
+	page2, err := db.ListActivityLogs(ActivityLogFilter{}, 10, 10)
 	if err != nil {
 		t.Fatalf("Failed to list activity logs page 2: %v", err)
 	}
@@ -977,6 +3073,109 @@ func TestListActivityLogsPagination(t *testing.T) {
 	}
 }
 
+func TestListActivityLogsFiltered(t *testing.T) {
+	db, err := NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	day := time.Date(2024, 3, 14, 0, 0, 0, 0, time.UTC)
+	entries := []struct {
+		eventType string
+		at        time.Time
+	}{
+		{models.EventUpgradeCompleted, day.Add(-time.Hour)},
+		{models.EventUpgradeCompleted, day.Add(9 * time.Hour)},
+		{models.EventUpgradeFailed, day.Add(10 * time.Hour)},
+		{models.EventUpgradeCompleted, day.Add(25 * time.Hour)},
+	}
+	for i, entry := range entries {
+		if err := db.LogActivity(&models.ActivityLog{
+			EventType:  entry.eventType,
+			EntityType: "job",
+			EntityID:   i + 1,
+			Message:    "Test activity",
+		}); err != nil {
+			t.Fatalf("Failed to log activity: %v", err)
+		}
+		if _, err := db.exec("UPDATE activity_log SET created_at = ? WHERE entity_id = ?", entry.at.Unix(), i+1); err != nil {
+			t.Fatalf("Failed to backdate activity: %v", err)
+		}
+	}
+
+	filter := ActivityLogFilter{Since: day, Until: day.Add(24*time.Hour - time.Second)}
+	logs, err := db.ListActivityLogs(filter, 10, 0)
+	if err != nil {
+		t.Fatalf("Failed to list activity logs: %v", err)
+	}
+	if len(logs) != 2 || logs[0].EntityID != 3 || logs[1].EntityID != 2 {
+		t.Fatalf("Expected entries 3 and 2 for the day, got %d entries", len(logs))
+	}
+
+	filter.EventType = models.EventUpgradeCompleted
+	logs, err = db.ListActivityLogs(filter, 10, 0)
+	if err != nil {
+		t.Fatalf("Failed to list activity logs: %v", err)
+	}
+	if len(logs) != 1 || logs[0].EntityID != 2 {
+		t.Errorf("Expected only entry 2, got %d entries", len(logs))
+	}
+}
+
+func TestListActivityLogsByEntity(t *testing.T) {
+	db, err := NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	base := time.Date(2024, 3, 14, 12, 0, 0, 0, time.UTC)
+	entries := []struct {
+		eventType  string
+		entityType string
+		entityID   int
+		at         time.Time
+	}{
+		{models.EventUpgradeFailed, "job", 1, base.Add(2 * time.Minute)},
+		{models.EventUpgradeStarted, "job", 1, base},
+		{models.EventUpgradeStarted, "job", 2, base.Add(time.Minute)},
+		{models.EventModemDiscovered, "modem", 1, base.Add(time.Minute)},
+	}
+	for _, entry := range entries {
+		if err := db.LogActivity(&models.ActivityLog{
+			EventType:  entry.eventType,
+			EntityType: entry.entityType,
+			EntityID:   entry.entityID,
+			Message:    "Test activity",
+		}); err != nil {
+			t.Fatalf("Failed to log activity: %v", err)
+		}
+		if _, err := db.exec("UPDATE activity_log SET created_at = ? WHERE id = (SELECT MAX(id) FROM activity_log)", entry.at.Unix()); err != nil {
+			t.Fatalf("Failed to backdate activity: %v", err)
+		}
+	}
+
+	logs, err := db.ListActivityLogsByEntity("job", 1)
+	if err != nil {
+		t.Fatalf("Failed to list activity logs: %v", err)
+	}
+	if len(logs) != 2 {
+		t.Fatalf("Expected 2 entries for job 1, got %d", len(logs))
+	}
+	if logs[0].EventType != models.EventUpgradeStarted || logs[1].EventType != models.EventUpgradeFailed {
+		t.Errorf("Expected chronological order, got %s then %s", logs[0].EventType, logs[1].EventType)
+	}
+
+	logs, err = db.ListActivityLogsByEntity("job", 99)
+	if err != nil {
+		t.Fatalf("Failed to list activity logs: %v", err)
+	}
+	if logs == nil || len(logs) != 0 {
+		t.Errorf("Expected empty non-nil slice, got %v", logs)
+	}
+}
+
 // Settings Tests
 
 func TestGetSetting(t *testing.T) {
@@ -1011,8 +3210,8 @@ func TestGetSettingNotFound(t *testing.T) {
 	defer db.Close()
 
 	_, err = db.GetSetting("nonexistent_key")
-	if err == nil {
-		t.Error("Expected error for nonexistent setting")
+	if !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for nonexistent setting, got %v", err)
 	}
 }
 
@@ -1274,3 +3473,373 @@ func TestConcurrentJobCreation(t *testing.T) {
 		t.Errorf("Expected 5 jobs, got %d", len(jobs))
 	}
 }
+
+func TestDeadLetterJobs(t *testing.T) {
+	db, err := NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	createFailed := func(mac string, deadLetter bool) int {
+		id, err := db.CreateJob(&models.UpgradeJob{
+			ModemID:          1,
+			RuleID:           1,
+			CMTSID:           1,
+			MACAddress:       mac,
+			Status:           models.JobStatusFailed,
+			TFTPServerIP:     "192.168.1.50",
+			FirmwareFilename: "firmware.bin",
+			MaxRetries:       3,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create job: %v", err)
+		}
+		job, _ := db.GetJob(id)
+		job.RetryCount = 3
+		job.DeadLetter = deadLetter
+		if err := db.UpdateJob(job); err != nil {
+			t.Fatalf("Failed to update job: %v", err)
+		}
+		return id
+	}
+
+	exhausted := createFailed("00:01:5C:11:22:33", true)
+	createFailed("00:01:5C:44:55:66", false) // Failed but not dead-lettered
+	busy := createFailed("00:01:5C:77:88:99", true)
+	upgraded := createFailed("00:01:5C:AA:BB:CC", true)
+
+	// The last modem was upgraded by a later job
+	if _, err := db.CreateJob(&models.UpgradeJob{
+		ModemID:    1,
+		RuleID:     1,
+		CMTSID:     1,
+		MACAddress: "00:01:5C:AA:BB:CC",
+		Status:     models.JobStatusCompleted,
+		MaxRetries: 3,
+	}); err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+
+	// The second modem already has a new job in flight
+	if _, err := db.CreateJob(&models.UpgradeJob{
+		ModemID:    1,
+		RuleID:     1,
+		CMTSID:     1,
+		MACAddress: "00:01:5C:77:88:99",
+		Status:     models.JobStatusPending,
+		MaxRetries: 3,
+	}); err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+
+	jobs, err := db.ListDeadLetterJobs(0)
+	if err != nil {
+		t.Fatalf("Failed to list dead-letter jobs: %v", err)
+	}
+	if len(jobs) != 3 {
+		t.Fatalf("Expected 3 dead-letter jobs, got %d", len(jobs))
+	}
+
+	requeued, err := db.RequeueDeadLetterJobs(nil)
+	if err != nil {
+		t.Fatalf("Failed to requeue: %v", err)
+	}
+	if requeued != 1 {
+		t.Errorf("Expected 1 job requeued, got %d", requeued)
+	}
+
+	job, _ := db.GetJob(exhausted)
+	if job.Status != models.JobStatusPending || job.DeadLetter || job.RetryCount != 0 || job.CompletedAt != nil {
+		t.Errorf("Expected requeued job reset to PENDING, got %+v", job)
+	}
+	job, _ = db.GetJob(busy)
+	if job.Status != models.JobStatusFailed || !job.DeadLetter {
+		t.Error("Expected job for a modem with an active job to stay dead-lettered")
+	}
+	job, _ = db.GetJob(upgraded)
+	if job.Status != models.JobStatusFailed || !job.DeadLetter {
+		t.Error("Expected job superseded by a completed one to stay dead-lettered")
+	}
+
+	// Requeue by ID only touches the named jobs
+	requeued, err = db.RequeueDeadLetterJobs([]int{exhausted})
+	if err != nil {
+		t.Fatalf("Failed to requeue: %v", err)
+	}
+	if requeued != 0 {
+		t.Errorf("Expected nothing requeued, got %d", requeued)
+	}
+}
+
+func TestRetryFailedJobs(t *testing.T) {
+	db, err := NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	createJob := func(mac string, cmtsID int, status string) int {
+		id, err := db.CreateJob(&models.UpgradeJob{
+			ModemID:    1,
+			RuleID:     1,
+			CMTSID:     cmtsID,
+			MACAddress: mac,
+			Status:     status,
+			MaxRetries: 3,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create job: %v", err)
+		}
+		if status == models.JobStatusFailed {
+			job, _ := db.GetJob(id)
+			msg := "tftp timeout"
+			failed := time.Now()
+			job.RetryCount = 3
+			job.ErrorMessage = &msg
+			job.CompletedAt = &failed
+			job.DeadLetter = true
+			if err := db.UpdateJob(job); err != nil {
+				t.Fatalf("Failed to update job: %v", err)
+			}
+		}
+		return id
+	}
+
+	first := createJob("00:01:5C:00:00:01", 1, models.JobStatusFailed)
+	other := createJob("00:01:5C:00:00:02", 2, models.JobStatusFailed)
+	busy := createJob("00:01:5C:00:00:03", 1, models.JobStatusFailed)
+	createJob("00:01:5C:00:00:03", 1, models.JobStatusInProgress)
+	superseded := createJob("00:01:5C:00:00:04", 1, models.JobStatusFailed)
+	createJob("00:01:5C:00:00:04", 1, models.JobStatusCompleted)
+
+	// Scoped to CMTS 1, skipping the modem that is already upgrading
+	retried, err := db.RetryFailedJobs(JobFilter{CMTSID: 1})
+	if err != nil {
+		t.Fatalf("Failed to retry failed jobs: %v", err)
+	}
+	if retried != 1 {
+		t.Errorf("Expected 1 job retried, got %d", retried)
+	}
+
+	job, _ := db.GetJob(first)
+	if job.Status != models.JobStatusPending || job.RetryCount != 0 || job.ErrorMessage != nil ||
+		job.StartedAt != nil || job.CompletedAt != nil || job.DeadLetter {
+		t.Errorf("Expected job reset to PENDING, got %+v", job)
+	}
+	if job, _ := db.GetJob(other); job.Status != models.JobStatusFailed {
+		t.Errorf("Expected job on CMTS 2 to stay FAILED, got %s", job.Status)
+	}
+	if job, _ := db.GetJob(busy); job.Status != models.JobStatusFailed {
+		t.Errorf("Expected job for busy modem to stay FAILED, got %s", job.Status)
+	}
+	if job, _ := db.GetJob(superseded); job.Status != models.JobStatusFailed {
+		t.Errorf("Expected job superseded by a completed one to stay FAILED, got %s", job.Status)
+	}
+
+	// An unknown rule matches nothing
+	retried, err = db.RetryFailedJobs(JobFilter{RuleID: 999})
+	if err != nil || retried != 0 {
+		t.Errorf("Expected nothing retried for unknown rule, got %d (%v)", retried, err)
+	}
+
+	retried, err = db.RetryFailedJobs(JobFilter{})
+	if err != nil || retried != 1 {
+		t.Errorf("Expected the CMTS 2 job retried, got %d (%v)", retried, err)
+	}
+}
+
+func TestSkipPendingJobsByRule(t *testing.T) {
+	db, err := NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	createJob := func(ruleID int, status string) int {
+		id, err := db.CreateJob(&models.UpgradeJob{
+			ModemID:    1,
+			RuleID:     ruleID,
+			CMTSID:     1,
+			MACAddress: "00:01:5C:11:22:33",
+			Status:     status,
+			MaxRetries: 3,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create job: %v", err)
+		}
+		return id
+	}
+
+	pending := []int{createJob(1, models.JobStatusPending), createJob(1, models.JobStatusPending)}
+	running := createJob(1, models.JobStatusInProgress)
+	other := createJob(2, models.JobStatusPending)
+
+	skipped, err := db.SkipPendingJobsByRule(1)
+	if err != nil {
+		t.Fatalf("Failed to skip rule jobs: %v", err)
+	}
+	if skipped != 2 {
+		t.Errorf("Expected 2 jobs skipped, got %d", skipped)
+	}
+
+	for _, id := range pending {
+		job, _ := db.GetJob(id)
+		if job.Status != models.JobStatusSkipped || job.ErrorMessage == nil || job.CompletedAt == nil {
+			t.Errorf("Expected job %d skipped with a reason, got %+v", id, job)
+		}
+	}
+	if job, _ := db.GetJob(running); job.Status != models.JobStatusInProgress {
+		t.Errorf("Expected in-progress job left alone, got %s", job.Status)
+	}
+	if job, _ := db.GetJob(other); job.Status != models.JobStatusPending {
+		t.Errorf("Expected another rule's job left alone, got %s", job.Status)
+	}
+
+	if skipped, err = db.SkipPendingJobsByRule(1); err != nil || skipped != 0 {
+		t.Errorf("Expected nothing left to skip, got %d (%v)", skipped, err)
+	}
+}
+
+func TestOpenUnsupportedDriver(t *testing.T) {
+	if _, err := Open("mysql", "user@/db"); err == nil {
+		t.Error("Expected error for unsupported driver")
+	}
+
+	// New keeps working as the SQLite shorthand
+	db, err := New(filepath.Join(t.TempDir(), "upgrader.db"))
+	if err != nil {
+		t.Fatalf("Failed to open SQLite database: %v", err)
+	}
+	defer db.Close()
+	if db.driver != DriverSQLite {
+		t.Errorf("Expected driver %q, got %q", DriverSQLite, db.driver)
+	}
+}
+
+func TestPostgresDriverRegistered(t *testing.T) {
+	for _, name := range sql.Drivers() {
+		if name == "pgx" {
+			return
+		}
+	}
+	t.Errorf("Expected the pgx driver to be linked, got %v", sql.Drivers())
+}
+
+func TestPostgresDialect(t *testing.T) {
+	sqlite := &DB{driver: DriverSQLite}
+	pg := &DB{driver: DriverPostgres}
+
+	query := "UPDATE settings SET value = ? WHERE key = ? AND value <> '?'"
+	if got := sqlite.rebind(query); got != query {
+		t.Errorf("Expected SQLite query unchanged, got %q", got)
+	}
+	want := "UPDATE settings SET value = $1 WHERE key = $2 AND value <> '?'"
+	if got := pg.rebind(query); got != want {
+		t.Errorf("rebind() = %q, want %q", got, want)
+	}
+
+	ddl := "id INTEGER PRIMARY KEY AUTOINCREMENT, enabled BOOLEAN DEFAULT 1, dry_run BOOLEAN DEFAULT 0, created_at INTEGER NOT NULL"
+	want = "id BIGSERIAL PRIMARY KEY, enabled BOOLEAN DEFAULT TRUE, dry_run BOOLEAN DEFAULT FALSE, created_at BIGINT NOT NULL"
+	if got := pg.ddl(ddl); got != want {
+		t.Errorf("ddl() = %q, want %q", got, want)
+	}
+	if got := sqlite.ddl(ddl); got != ddl {
+		t.Errorf("Expected SQLite DDL unchanged, got %q", got)
+	}
+
+	if pg.noLimit() != "ALL" || sqlite.noLimit() != "-1" {
+		t.Error("Unexpected unlimited LIMIT values")
+	}
+}
+
+func TestCampaignOperations(t *testing.T) {
+	db, err := NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	if _, err := db.CreateCampaign(&models.Campaign{Name: "Negative rate", StartAt: time.Now(), RatePerMinute: -1}); err != models.ErrInvalidCampaignRate {
+		t.Errorf("Expected ErrInvalidCampaignRate, got %v", err)
+	}
+
+	start := time.Now().Add(time.Hour).Truncate(time.Second)
+	id, err := db.CreateCampaign(&models.Campaign{
+		Name:             "Night rollout",
+		MatchType:        "MAC_RANGE",
+		MatchCriteria:    `{"start_mac":"00:01:5C:00:00:00","end_mac":"00:01:5C:FF:FF:FF"}`,
+		TFTPServerIP:     "192.168.1.50",
+		FirmwareFilename: "firmware-v2.0.0.bin",
+		StartAt:          start,
+		RatePerMinute:    5,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create campaign: %v", err)
+	}
+
+	campaign, err := db.GetCampaign(id)
+	if err != nil {
+		t.Fatalf("Failed to get campaign: %v", err)
+	}
+	if campaign.Status != models.CampaignStatusScheduled || !campaign.StartAt.Equal(start) || campaign.RatePerMinute != 5 {
+		t.Errorf("Unexpected campaign: %+v", campaign)
+	}
+
+	if _, err := db.CreateJob(&models.UpgradeJob{
+		ModemID:    1,
+		CampaignID: id,
+		CMTSID:     1,
+		MACAddress: "00:01:5C:11:22:33",
+		Status:     models.JobStatusPending,
+		MaxRetries: 3,
+	}); err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+
+	modemIDs, err := db.ListCampaignModemIDs(id)
+	if err != nil || !modemIDs[1] || len(modemIDs) != 1 {
+		t.Errorf("Expected campaign to cover modem 1, got %v (%v)", modemIDs, err)
+	}
+	counts, err := db.CountCampaignJobsByStatus(id)
+	if err != nil || counts[models.JobStatusPending] != 1 {
+		t.Errorf("Expected 1 pending campaign job, got %v (%v)", counts, err)
+	}
+
+	completed := time.Now().Truncate(time.Second)
+	campaign.Status = models.CampaignStatusCompleted
+	campaign.JobsCreated = 1
+	campaign.CompletedAt = &completed
+	if err := db.UpdateCampaignProgress(campaign); err != nil {
+		t.Fatalf("Failed to update campaign: %v", err)
+	}
+
+	active, err := db.ListCampaigns(models.CampaignStatusScheduled, models.CampaignStatusRunning)
+	if err != nil || len(active) != 0 {
+		t.Errorf("Expected no active campaigns, got %d (%v)", len(active), err)
+	}
+	all, err := db.ListCampaigns()
+	if err != nil || len(all) != 1 || all[0].JobsCreated != 1 || all[0].CompletedAt == nil {
+		t.Errorf("Expected the completed campaign listed, got %+v (%v)", all, err)
+	}
+
+	if _, err := db.GetCampaign(999); err != models.ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
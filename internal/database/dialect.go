@@ -0,0 +1,134 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Supported database drivers
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+)
+
+// execQueryer is satisfied by both *sql.DB and *sql.Tx
+type execQueryer interface {
+	rowQuerier
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// postgres reports whether the connection speaks the PostgreSQL dialect
+func (db *DB) postgres() bool {
+	return db.driver == DriverPostgres
+}
+
+// rebind rewrites ? placeholders into the driver's bind syntax. Queries are
+// written once in SQLite form; PostgreSQL wants numbered $1, $2, ... params.
+// Question marks inside single-quoted literals are left alone.
+func (db *DB) rebind(query string) string {
+	if !db.postgres() {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query) + 16)
+	n, quoted := 0, false
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'':
+			quoted = !quoted
+		case c == '?' && !quoted:
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// ddl translates SQLite column definitions to the driver's equivalents.
+// Timestamps are Unix seconds, so PostgreSQL integers are widened to BIGINT.
+func (db *DB) ddl(definition string) string {
+	if !db.postgres() {
+		return definition
+	}
+	return strings.NewReplacer(
+		"INTEGER PRIMARY KEY AUTOINCREMENT", "BIGSERIAL PRIMARY KEY",
+		"INTEGER", "BIGINT",
+		"BOOLEAN DEFAULT 1", "BOOLEAN DEFAULT TRUE",
+		"BOOLEAN DEFAULT 0", "BOOLEAN DEFAULT FALSE",
+	).Replace(definition)
+}
+
+// sqliteConstraintUnique is SQLite's extended result code for a UNIQUE
+// constraint failure
+const sqliteConstraintUnique = 2067
+
+// isUniqueViolation reports whether err is a unique constraint failure.
+// modernc.org/sqlite errors carry the extended result code; failing that,
+// the messages of both SQLite ("UNIQUE constraint failed: cmts.ip_address")
+// and PostgreSQL ("duplicate key value violates unique constraint") are
+// recognised.
+func isUniqueViolation(err error) bool {
+	if err == nil {
+		return false
+	}
+	var coded interface{ Code() int }
+	if errors.As(err, &coded) && coded.Code() == sqliteConstraintUnique {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "unique constraint failed") ||
+		strings.Contains(msg, "duplicate key value violates unique constraint")
+}
+
+// noLimit is the LIMIT value meaning "all rows", needed to express a bare OFFSET
+func (db *DB) noLimit() string {
+	if db.postgres() {
+		return "ALL"
+	}
+	return "-1"
+}
+
+// exec runs a statement against the connection pool
+func (db *DB) exec(query string, args ...interface{}) (sql.Result, error) {
+	return db.conn.Exec(db.rebind(query), args...)
+}
+
+// query runs a SELECT against the connection pool
+func (db *DB) query(query string, args ...interface{}) (*sql.Rows, error) {
+	return db.conn.Query(db.rebind(query), args...)
+}
+
+// queryRow runs a single-row SELECT against the connection pool
+func (db *DB) queryRow(query string, args ...interface{}) *sql.Row {
+	return db.conn.QueryRow(db.rebind(query), args...)
+}
+
+// insert runs an INSERT and returns the new row's id. PostgreSQL drivers
+// don't implement LastInsertId, so the id comes back via RETURNING instead.
+func (db *DB) insert(q execQueryer, query string, args ...interface{}) (int, error) {
+	if db.postgres() {
+		var id int
+		if err := q.QueryRow(db.rebind(query)+" RETURNING id", args...).Scan(&id); err != nil {
+			return 0, err
+		}
+		return id, nil
+	}
+
+	result, err := q.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read inserted id: %w", err)
+	}
+	return int(id), nil
+}
@@ -0,0 +1,115 @@
+package database
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// encryptedPrefix marks a column value sealed by encryptSecret. Values
+// without it are legacy plaintext and are read back unchanged.
+const encryptedPrefix = "enc:v1:"
+
+// ErrNoEncryptionKey is returned when reading an encrypted value from a
+// database opened without the key it was written with
+var ErrNoEncryptionKey = errors.New("value is encrypted but no encryption key is configured")
+
+// SetEncryptionKey enables AES-GCM encryption of CMTS community strings.
+// The AES-256 key is the SHA-256 of the given passphrase. An empty key
+// turns encryption off, so new writes are stored in plaintext.
+func (db *DB) SetEncryptionKey(key string) error {
+	if key == "" {
+		db.aead = nil
+		return nil
+	}
+
+	sum := sha256.Sum256([]byte(key))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return fmt.Errorf("failed to create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return fmt.Errorf("failed to create GCM: %w", err)
+	}
+
+	db.aead = aead
+	return nil
+}
+
+// EncryptionEnabled reports whether an encryption key is configured
+func (db *DB) EncryptionEnabled() bool {
+	return db.aead != nil
+}
+
+// encryptSecret seals value for storage. Without a key, or for an empty
+// value, it is returned unchanged.
+func (db *DB) encryptSecret(value string) (string, error) {
+	if db.aead == nil || value == "" {
+		return value, nil
+	}
+
+	nonce := make([]byte, db.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	sealed := db.aead.Seal(nonce, nonce, []byte(value), nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptSecret reverses encryptSecret, passing plaintext values through
+func (db *DB) decryptSecret(value string) (string, error) {
+	if !strings.HasPrefix(value, encryptedPrefix) {
+		return value, nil
+	}
+	if db.aead == nil {
+		return "", ErrNoEncryptionKey
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+	if err != nil {
+		return "", fmt.Errorf("failed to decode encrypted value: %w", err)
+	}
+	nonceSize := db.aead.NonceSize()
+	if len(sealed) < nonceSize {
+		return "", fmt.Errorf("encrypted value is truncated")
+	}
+
+	plain, err := db.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt value (wrong encryption key?): %w", err)
+	}
+	return string(plain), nil
+}
+
+// sealCommunities returns the write and modem community strings of a CMTS
+// as they should be stored
+func (db *DB) sealCommunities(communityWrite, cmCommunity string) (string, string, error) {
+	write, err := db.encryptSecret(communityWrite)
+	if err != nil {
+		return "", "", err
+	}
+	cm, err := db.encryptSecret(cmCommunity)
+	if err != nil {
+		return "", "", err
+	}
+	return write, cm, nil
+}
+
+// openCommunities decrypts the stored community strings of a CMTS in place
+func (db *DB) openCommunities(communityWrite, cmCommunity *string) error {
+	var err error
+	if *communityWrite, err = db.decryptSecret(*communityWrite); err != nil {
+		return fmt.Errorf("community_write: %w", err)
+	}
+	if *cmCommunity, err = db.decryptSecret(*cmCommunity); err != nil {
+		return fmt.Errorf("cm_community_string: %w", err)
+	}
+	return nil
+}
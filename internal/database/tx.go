@@ -0,0 +1,54 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/awksedgreep/firmware-upgrader/internal/models"
+)
+
+// Tx is a transaction with the same job and activity log methods as DB.
+// It is only valid inside the function passed to WithTx.
+type Tx struct {
+	db *DB
+	tx *sql.Tx
+}
+
+// WithTx runs fn in a transaction, committing if fn returns nil and rolling
+// back otherwise, so multi-step writes land together or not at all
+func (db *DB) WithTx(fn func(*Tx) error) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(&Tx{db: db, tx: tx}); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// CreateJob creates a new upgrade job
+func (t *Tx) CreateJob(job *models.UpgradeJob) (int, error) {
+	return t.db.createJob(t.tx, job)
+}
+
+// GetJob retrieves a job by ID
+func (t *Tx) GetJob(id int) (*models.UpgradeJob, error) {
+	return t.db.getJob(t.tx, id)
+}
+
+// UpdateJob updates a job
+func (t *Tx) UpdateJob(job *models.UpgradeJob) error {
+	return t.db.updateJob(t.tx, job)
+}
+
+// LogActivity creates an activity log entry
+func (t *Tx) LogActivity(log *models.ActivityLog) error {
+	return t.db.logActivity(t.tx, log)
+}
@@ -0,0 +1,319 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/awksedgreep/firmware-upgrader/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+// campaignScheduler periodically creates the jobs due for active campaigns
+func (e *Engine) campaignScheduler(ctx context.Context) {
+	ticker := time.NewTicker(e.campaignInterval)
+	defer ticker.Stop()
+
+	log.Info().
+		Dur("interval", e.campaignInterval).
+		Msg("Campaign scheduler started")
+
+	e.runCampaigns()
+	e.heartbeat("campaigns")
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("Campaign scheduler stopping")
+			return
+		case <-ticker.C:
+			e.heartbeat("campaigns")
+			e.runCampaigns()
+		}
+	}
+}
+
+// runCampaigns advances every scheduled or running campaign whose start
+// time has passed
+func (e *Engine) runCampaigns() {
+	if e.Paused() {
+		log.Debug().Msg("Engine paused, not advancing campaigns")
+		return
+	}
+
+	campaigns, err := e.db.ListCampaigns(models.CampaignStatusScheduled, models.CampaignStatusRunning)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list campaigns")
+		return
+	}
+
+	now := e.now()
+	var due []*models.Campaign
+	for _, campaign := range campaigns {
+		if !now.Before(campaign.StartAt) {
+			due = append(due, campaign)
+		}
+	}
+	if len(due) == 0 {
+		return
+	}
+
+	// Share the evaluation lock so campaigns and rules never race to
+	// create jobs for the same modem
+	e.evalMu.Lock()
+	defer e.evalMu.Unlock()
+
+	e.matcher.MinSignal, e.matcher.MaxSignal = loadSignalThresholds(e.db)
+	e.matcher.EligibleStatuses = loadEligibleStatuses(e.db)
+
+	modems, err := e.campaignCandidates()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to load modems for campaigns")
+		return
+	}
+
+	firmwareCaps, err := e.loadFirmwareCaps()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to load CMTS firmware caps for campaigns")
+		return
+	}
+
+	activeJobs := make(map[string]bool)
+	for _, status := range []string{models.JobStatusPending, models.JobStatusInProgress} {
+		jobs, err := e.db.ListJobs(status, 1000)
+		if err != nil {
+			log.Warn().Err(err).Str("status", status).Msg("Failed to check existing jobs")
+		}
+		for _, job := range jobs {
+			activeJobs[job.MACAddress] = true
+		}
+	}
+
+	for _, campaign := range due {
+		if err := e.advanceCampaign(campaign, modems, firmwareCaps, activeJobs, now); err != nil {
+			log.Error().
+				Err(err).
+				Int("campaign_id", campaign.ID).
+				Str("campaign", campaign.Name).
+				Msg("Failed to advance campaign")
+		}
+	}
+}
+
+// campaignCandidates returns the eligible modems on allowlisted CMTS that no
+// exclude rule protects
+func (e *Engine) campaignCandidates() ([]*models.CableModem, error) {
+	modems, err := e.db.ListModems(0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list modems: %w", err)
+	}
+
+	allowlist, err := e.loadCMTSAllowlist()
+	if err != nil {
+		return nil, err
+	}
+	if allowlist != nil {
+		scoped := modems[:0]
+		for _, modem := range modems {
+			if allowlist[modem.CMTSID] {
+				scoped = append(scoped, modem)
+			}
+		}
+		modems = scoped
+	}
+
+	rules, err := e.db.ListRules()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rules: %w", err)
+	}
+	var excludes []*models.UpgradeRule
+	for _, rule := range rules {
+		if rule.Enabled && rule.Exclude {
+			excludes = append(excludes, rule)
+		}
+	}
+	if len(excludes) > 0 {
+		allowed := modems[:0]
+		for _, modem := range modems {
+			if _, err := e.matcher.MatchModemToRules(modem, excludes); err != models.ErrModemExcluded {
+				allowed = append(allowed, modem)
+			}
+		}
+		modems = allowed
+	}
+
+	return e.matcher.FilterEligibleModems(modems), nil
+}
+
+// advanceCampaign creates the jobs a campaign is due at now and completes it
+// once every matching modem has had one. Each minute since the start
+// releases another RatePerMinute jobs, and releases are at least a minute
+// apart, so a backlog built up while the engine was paused drains at the
+// campaign's rate instead of in one tick. Unpaced campaigns release every job
+// at once. Modems busy with another job stay in the target population and
+// are picked up on a later tick.
+func (e *Engine) advanceCampaign(campaign *models.Campaign, modems []*models.CableModem, firmwareCaps map[int]string, activeJobs map[string]bool, now time.Time) error {
+	target := campaign.Target()
+	tftpServer, err := target.ResolveTFTPServer()
+	if err != nil {
+		return err
+	}
+
+	if campaign.Status == models.CampaignStatusScheduled {
+		campaign.Status = models.CampaignStatusRunning
+		e.db.LogActivity(&models.ActivityLog{
+			EventType:  models.EventCampaignStarted,
+			EntityType: "campaign",
+			EntityID:   campaign.ID,
+			Message:    fmt.Sprintf("Started campaign: %s", campaign.Name),
+		})
+		log.Info().
+			Int("campaign_id", campaign.ID).
+			Str("campaign", campaign.Name).
+			Int("rate_per_minute", campaign.RatePerMinute).
+			Msg("Campaign started")
+	}
+
+	covered, err := e.db.ListCampaignModemIDs(campaign.ID)
+	if err != nil {
+		return err
+	}
+
+	allowance := campaign.RatePerMinute * (int(now.Sub(campaign.StartAt)/time.Minute) + 1)
+	if last, ok := e.campaignReleases[campaign.ID]; ok && now.Sub(last) < time.Minute {
+		allowance = campaign.JobsCreated
+	} else if allowance > campaign.JobsCreated+campaign.RatePerMinute {
+		allowance = campaign.JobsCreated + campaign.RatePerMinute
+	}
+	if campaign.RatePerMinute == 0 {
+		allowance = len(modems) + campaign.JobsCreated
+	}
+	jobsBefore := campaign.JobsCreated
+	targetVersion := extractFirmwareVersion(target.FirmwareFilename)
+	remaining := 0
+
+	for _, modem := range modems {
+		if covered[modem.ID] {
+			continue
+		}
+		match, err := e.matcher.matchRule(modem, target)
+		if err != nil {
+			return fmt.Errorf("failed to match campaign target: %w", err)
+		}
+		if !match || !e.matcher.ShouldUpgrade(modem, target) ||
+			exceedsFirmwareCap(target.FirmwareFilename, firmwareCaps[modem.CMTSID]) {
+			continue
+		}
+
+		remaining++
+		if campaign.JobsCreated >= allowance || activeJobs[modem.MACAddress] {
+			continue
+		}
+
+		jobID, err := e.db.CreateJob(&models.UpgradeJob{
+			ModemID:          modem.ID,
+			CampaignID:       campaign.ID,
+			CMTSID:           modem.CMTSID,
+			MACAddress:       modem.MACAddress,
+			Status:           models.JobStatusPending,
+			TFTPServerIP:     tftpServer,
+			FirmwareFilename: target.FirmwareFilename,
+			MaxRetries:       e.config.RetryAttempts,
+		})
+		if err != nil {
+			log.Error().
+				Err(err).
+				Str("mac", modem.MACAddress).
+				Msg("Failed to create campaign job")
+			continue
+		}
+
+		log.Info().
+			Int("job_id", jobID).
+			Str("mac", modem.MACAddress).
+			Str("campaign", campaign.Name).
+			Msg("Created campaign job")
+
+		campaign.JobsCreated++
+		remaining--
+		activeJobs[modem.MACAddress] = true
+		if targetVersion != "" {
+			e.setExpectedFirmware(modem, targetVersion)
+		}
+	}
+
+	if campaign.JobsCreated > jobsBefore {
+		e.campaignReleases[campaign.ID] = now
+	}
+
+	campaign.Remaining = remaining
+	if remaining == 0 {
+		delete(e.campaignReleases, campaign.ID)
+		campaign.Status = models.CampaignStatusCompleted
+		campaign.CompletedAt = &now
+		e.db.LogActivity(&models.ActivityLog{
+			EventType:  models.EventCampaignCompleted,
+			EntityType: "campaign",
+			EntityID:   campaign.ID,
+			Message:    fmt.Sprintf("Completed campaign %s after %d jobs", campaign.Name, campaign.JobsCreated),
+		})
+		log.Info().
+			Int("campaign_id", campaign.ID).
+			Str("campaign", campaign.Name).
+			Int("jobs_created", campaign.JobsCreated).
+			Msg("Campaign completed")
+	}
+
+	return e.db.UpdateCampaignProgress(campaign)
+}
+
+// CancelCampaign stops a scheduled or running campaign from creating more
+// jobs and cancels its jobs that haven't started. Upgrades already in
+// progress are left to finish.
+func (e *Engine) CancelCampaign(id int) error {
+	// Hold the evaluation lock so a concurrent tick can't resurrect it
+	e.evalMu.Lock()
+	defer e.evalMu.Unlock()
+
+	campaign, err := e.db.GetCampaign(id)
+	if err != nil {
+		return err
+	}
+	if campaign.Status != models.CampaignStatusScheduled && campaign.Status != models.CampaignStatusRunning {
+		return models.ErrCampaignFinished
+	}
+
+	now := e.now()
+	campaign.Status = models.CampaignStatusCancelled
+	campaign.CompletedAt = &now
+	if err := e.db.UpdateCampaignProgress(campaign); err != nil {
+		return err
+	}
+
+	pending, err := e.db.ListCampaignJobs(id, models.JobStatusPending)
+	if err != nil {
+		return err
+	}
+	for _, job := range pending {
+		if err := e.markJobCancelled(job); err != nil {
+			log.Error().
+				Err(err).
+				Int("job_id", job.ID).
+				Msg("Failed to cancel campaign job")
+		}
+	}
+
+	e.db.LogActivity(&models.ActivityLog{
+		EventType:  models.EventCampaignCancelled,
+		EntityType: "campaign",
+		EntityID:   campaign.ID,
+		Message:    fmt.Sprintf("Cancelled campaign %s after %d jobs", campaign.Name, campaign.JobsCreated),
+	})
+	log.Info().
+		Int("campaign_id", campaign.ID).
+		Str("campaign", campaign.Name).
+		Int("pending_cancelled", len(pending)).
+		Msg("Campaign cancelled")
+
+	return nil
+}
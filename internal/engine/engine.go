@@ -2,24 +2,159 @@ package engine
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math/rand"
+	"runtime/debug"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/awksedgreep/firmware-upgrader/internal/database"
 	"github.com/awksedgreep/firmware-upgrader/internal/models"
 	"github.com/awksedgreep/firmware-upgrader/internal/snmp"
+	"github.com/awksedgreep/firmware-upgrader/internal/tftp"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
 // Config holds engine configuration
 type Config struct {
-	Workers       int
+	Workers int
+	// RetryAttempts is how often a failed manual or campaign job is retried.
+	// 0 never retries; a negative value uses models.DefaultMaxRetries.
 	RetryAttempts int
-	PollInterval  time.Duration
-	JobTimeout    time.Duration
-	MaxPerCMTS    int
+	// PollInterval is the fallback for ScheduleInterval and
+	// DiscoveryInterval when they are left unset
+	PollInterval time.Duration
+	// ScheduleInterval is how often pending jobs are queued for workers
+	ScheduleInterval time.Duration
+	// DiscoveryInterval is how often every enabled CMTS is walked for modems
+	DiscoveryInterval time.Duration
+	// EvaluationInterval is how often upgrade rules are evaluated
+	// (default: twice DiscoveryInterval)
+	EvaluationInterval time.Duration
+	JobTimeout         time.Duration
+	// UpgradePollInterval is how often a running upgrade's status is
+	// checked when its rule doesn't say (default 10 seconds)
+	UpgradePollInterval time.Duration
+	MaxPerCMTS          int
+	// VerifyGracePeriod is how long to wait for a modem to report the
+	// target firmware after the upgrade completes
+	VerifyGracePeriod time.Duration
+	// DiscoveryConcurrency caps simultaneous CMTS discoveries (0 = unlimited)
+	DiscoveryConcurrency int
+	// InitialEvaluationDelay is how long the rule evaluation scheduler
+	// waits after startup so the first discovery can complete
+	InitialEvaluationDelay time.Duration
+	// RetryBudget caps job retries scheduled across the whole fleet per
+	// RetryBudgetWindow (0 = unlimited)
+	RetryBudget int
+	// RetryBudgetPerCMTS caps job retries scheduled on any one CMTS per
+	// RetryBudgetWindow (0 = unlimited)
+	RetryBudgetPerCMTS int
+	// RetryBudgetWindow is the sliding window the retry budgets apply to
+	RetryBudgetWindow time.Duration
+	// SNMPBudget caps concurrent SNMP work shared by scheduled discoveries
+	// and upgrades (0 = unlimited)
+	SNMPBudget int
+	// SchedulingPolicy decides which side yields when SNMPBudget is
+	// contended: SchedulingFair, SchedulingPrioritizeUpgrades or
+	// SchedulingPrioritizeDiscovery
+	SchedulingPolicy string
+}
+
+// Scheduling policies for the shared SNMP budget
+const (
+	SchedulingFair                = "fair"
+	SchedulingPrioritizeUpgrades  = "prioritize_upgrades"
+	SchedulingPrioritizeDiscovery = "prioritize_discovery"
+)
+
+// minSchedulerInterval is the shortest interval a scheduler will tick at.
+// Anything shorter, including an unset zero that would make time.NewTicker
+// panic, is raised to it.
+const minSchedulerInterval = 10 * time.Second
+
+// firmwareProbeTimeout bounds the TFTP pre-flight check for firmware files
+const firmwareProbeTimeout = 3 * time.Second
+
+// schedulerCount is the number of background schedulers started by Start
+const schedulerCount = 5
+
+// livenessIntervals is how many job poll intervals may pass without a
+// scheduler tick before the engine is considered stalled
+const livenessIntervals = 3
+
+// JobEvent describes a job status transition published to subscribers
+type JobEvent struct {
+	JobID  int    `json:"job_id"`
+	MAC    string `json:"mac_address"`
+	Status string `json:"status"`
+	// CurrentVersion is the software version the modem reported while the
+	// upgrade was being monitored
+	CurrentVersion string `json:"current_version,omitempty"`
+}
+
+// EvaluationSummary describes the most recent rule evaluation pass
+type EvaluationSummary struct {
+	StartedAt      time.Time `json:"started_at"`
+	DurationMS     int64     `json:"duration_ms"`
+	TotalModems    int       `json:"total_modems"`
+	EligibleModems int       `json:"eligible_modems"`
+	Rules          int       `json:"rules"`
+	JobsCreated    int       `json:"jobs_created"`
+	// JobIDs lists the jobs created by the pass
+	JobIDs []int `json:"job_ids"`
+	// Skipped counts modems that got no job, keyed by reason
+	Skipped map[string]int `json:"skipped,omitempty"`
+	Error   string         `json:"error,omitempty"`
+}
+
+// DiscoveryStatus describes the most recent discovery run for one CMTS
+type DiscoveryStatus struct {
+	CompletedAt time.Time `json:"completed_at"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// Status is a point-in-time snapshot of the engine's internal state
+type Status struct {
+	Workers             int                     `json:"workers"`
+	ActiveJobs          int                     `json:"active_jobs"`
+	QueueLength         int                     `json:"queue_length"`
+	QueueCapacity       int                     `json:"queue_capacity"`
+	MaxPerCMTS          int                     `json:"max_per_cmts"`
+	ActivePerCMTS       map[int]int             `json:"active_per_cmts"`
+	CMTSSemaphores      int                     `json:"cmts_semaphores"`
+	JobsProcessed       int64                   `json:"jobs_processed"`
+	Ready               bool                    `json:"ready"`
+	Paused              bool                    `json:"paused"`
+	SchedulerHeartbeats map[string]time.Time    `json:"scheduler_heartbeats"`
+	LastDiscoveryCycle  *time.Time              `json:"last_discovery_cycle"`
+	LastEvaluationCycle *time.Time              `json:"last_evaluation_cycle"`
+	LastEvaluation      *EvaluationSummary      `json:"last_evaluation"`
+	LastDiscovery       map[int]DiscoveryStatus `json:"last_discovery"`
+}
+
+// modemClient is the subset of SNMP operations performed on a cable modem
+type modemClient interface {
+	TriggerFirmwareUpgrade(modemIP, tftpServer, filename string, adminValue int, oid, transport string) error
+	RebootModem() error
+	GetModemState() (snmp.ModemState, error)
+	CheckUpgradeProgress() (snmp.UpgradeProgress, error)
+	GetModemFirmware() (sysDescr string, firmware string, err error)
+	Close() error
+}
+
+// connectToModem opens an SNMP session to a cable modem
+func connectToModem(ip, community string, port int) (modemClient, error) {
+	client, err := snmp.ConnectToModem(ip, community, port)
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
 }
 
 // Engine manages firmware upgrade operations
@@ -30,39 +165,408 @@ type Engine struct {
 	matcher      *Matcher
 	cmtsLimits   map[int]*semaphore
 	cmtsLimitsMu sync.RWMutex
+	ruleLimits   map[int]*semaphore
+	ruleLimitsMu sync.Mutex
+	evalMu       sync.Mutex
+	activeJobs   map[int]context.CancelFunc
+	activeJobsMu sync.Mutex
+
+	discoverySem  *semaphore
+	heartbeats    map[string]time.Time
+	heartbeatsMu  sync.Mutex
+	subscribers   map[chan JobEvent]struct{}
+	subscribersMu sync.Mutex
+
+	lastEvaluation *EvaluationSummary
+	lastDiscovery  map[int]DiscoveryStatus
+	statusMu       sync.Mutex
+
+	// jobsProcessed counts jobs the workers have picked up; the cycle
+	// timestamps are UnixNano of the last scheduled discovery and
+	// evaluation cycles to finish, or 0 if none has
+	jobsProcessed       atomic.Int64
+	lastDiscoveryCycle  atomic.Int64
+	lastEvaluationCycle atomic.Int64
+
+	// lastHeartbeat is UnixNano of the most recent tick of any scheduler, or
+	// 0 before Start; runningWorkers counts worker goroutines still running
+	lastHeartbeat  atomic.Int64
+	runningWorkers atomic.Int32
+
+	retryBudget      *retryBudget
+	cmtsRetryBudgets map[int]*retryBudget
+	retryBudgetMu    sync.Mutex
+
+	snmpBudget *snmpBudget
+	notifier   *notifier
+	oui        ouiCache
+
+	// campaignReleases is when each running campaign last created jobs,
+	// guarded by evalMu
+	campaignReleases map[int]time.Time
+
+	// paused stops new jobs from being created or started; jobs already
+	// running are left to finish
+	paused atomic.Bool
+
+	// drain tells idle workers to exit during Shutdown; stopWorkers and
+	// stopSchedulers are set by Start so Shutdown can stop each group in turn
+	drain          chan struct{}
+	drainOnce      sync.Once
+	stopped        chan struct{}
+	stoppedOnce    sync.Once
+	stopWorkers    context.CancelFunc
+	stopSchedulers context.CancelFunc
+	lifecycleMu    sync.Mutex
+	workerWG       sync.WaitGroup
+	schedulerWG    sync.WaitGroup
+
+	// connectModem, discover and probeFirmware are swapped out in tests to
+	// avoid real SNMP and TFTP traffic. now is the clock campaigns are paced
+	// by.
+	connectModem     func(ip, community string, port int) (modemClient, error)
+	discover         func(cmtsID int) error
+	probeFirmware    func(server, filename string) error
+	probeCMTS        func(cmts *models.CMTS, timeout time.Duration) (string, error)
+	now              func() time.Time
+	statusInterval   time.Duration
+	verifyInterval   time.Duration
+	campaignInterval time.Duration
+	refreshTimeout   time.Duration
 }
 
-// semaphore implements a simple counting semaphore
+// semaphore implements a counting semaphore whose limit can change while
+// slots are held
 type semaphore struct {
-	ch chan struct{}
+	mu sync.Mutex
+	// released is closed and replaced whenever a slot is given back or the
+	// limit changes, waking every waiter to check whether it may start
+	released chan struct{}
+	limit    int
+	held     int
 }
 
 func newSemaphore(max int) *semaphore {
-	return &semaphore{
-		ch: make(chan struct{}, max),
+	return &semaphore{limit: max, released: make(chan struct{})}
+}
+
+// Acquire takes a slot, waiting until one is free or ctx is done
+func (s *semaphore) Acquire(ctx context.Context) error {
+	for {
+		s.mu.Lock()
+		if s.held < s.limit {
+			s.held++
+			s.mu.Unlock()
+			return nil
+		}
+		released := s.released
+		s.mu.Unlock()
+
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
 	}
 }
 
-func (s *semaphore) Acquire() {
-	s.ch <- struct{}{}
+// TryAcquire takes a slot without blocking, reporting whether it succeeded
+func (s *semaphore) TryAcquire() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.held >= s.limit {
+		return false
+	}
+	s.held++
+	return true
 }
 
 func (s *semaphore) Release() {
-	<-s.ch
+	s.mu.Lock()
+	s.held--
+	s.wake()
+	s.mu.Unlock()
+}
+
+// Resize changes the limit in place. Slots already held count against the
+// new limit, so shrinking it admits nobody until enough are released.
+func (s *semaphore) Resize(max int) {
+	s.mu.Lock()
+	s.limit = max
+	s.wake()
+	s.mu.Unlock()
+}
+
+// Limit returns the number of slots
+func (s *semaphore) Limit() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.limit
+}
+
+// Held returns the number of slots taken
+func (s *semaphore) Held() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.held
+}
+
+// wake releases every waiter. Callers must hold s.mu.
+func (s *semaphore) wake() {
+	close(s.released)
+	s.released = make(chan struct{})
+}
+
+// retryBudget is a sliding-window limit on how many retries may be
+// scheduled, so a systemic failure can't turn into a fleet-wide retry storm
+type retryBudget struct {
+	max    int
+	window time.Duration
+	spent  []time.Time
+	// alerted is set once exhaustion has been reported, and cleared when
+	// the budget recovers, so each exhaustion raises a single alert
+	alerted bool
+}
+
+func newRetryBudget(max int, window time.Duration) *retryBudget {
+	return &retryBudget{max: max, window: window}
+}
+
+// available drops retries older than the window and reports whether
+// another may be spent
+func (b *retryBudget) available(now time.Time) bool {
+	cutoff := now.Add(-b.window)
+	i := 0
+	for i < len(b.spent) && !b.spent[i].After(cutoff) {
+		i++
+	}
+	b.spent = b.spent[i:]
+	return len(b.spent) < b.max
+}
+
+func (b *retryBudget) spend(now time.Time) {
+	b.spent = append(b.spent, now)
+	b.alerted = false
+}
+
+// snmpBudget is a counting semaphore shared by discovery walks and upgrade
+// SETs. Under a prioritizing policy the other kind of work only starts while
+// the prioritized kind holds at most half the budget.
+type snmpBudget struct {
+	mu sync.Mutex
+	// released is closed and replaced whenever a slot is given back, waking
+	// every waiter to check whether it may start
+	released    chan struct{}
+	max         int
+	policy      string
+	upgrades    int
+	discoveries int
+}
+
+func newSNMPBudget(max int, policy string) *snmpBudget {
+	return &snmpBudget{max: max, policy: policy, released: make(chan struct{})}
+}
+
+// canStart reports whether an upgrade (or a discovery) may take a slot now.
+// Callers must hold b.mu.
+func (b *snmpBudget) canStart(upgrade bool) bool {
+	if b.upgrades+b.discoveries >= b.max {
+		return false
+	}
+	switch b.policy {
+	case SchedulingPrioritizeUpgrades:
+		return upgrade || b.upgrades*2 <= b.max
+	case SchedulingPrioritizeDiscovery:
+		return !upgrade || b.discoveries*2 <= b.max
+	}
+	return true
+}
+
+func (b *snmpBudget) take(upgrade bool) {
+	if upgrade {
+		b.upgrades++
+	} else {
+		b.discoveries++
+	}
+}
+
+// TryAcquire takes a slot without blocking, reporting whether it succeeded
+func (b *snmpBudget) TryAcquire(upgrade bool) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.canStart(upgrade) {
+		return false
+	}
+	b.take(upgrade)
+	return true
+}
+
+// Acquire takes a slot, waiting until one may start or ctx is done
+func (b *snmpBudget) Acquire(ctx context.Context, upgrade bool) error {
+	for {
+		b.mu.Lock()
+		if b.canStart(upgrade) {
+			b.take(upgrade)
+			b.mu.Unlock()
+			return nil
+		}
+		released := b.released
+		b.mu.Unlock()
+
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (b *snmpBudget) Release(upgrade bool) {
+	b.mu.Lock()
+	if upgrade {
+		b.upgrades--
+	} else {
+		b.discoveries--
+	}
+	close(b.released)
+	b.released = make(chan struct{})
+	b.mu.Unlock()
 }
 
 // New creates a new upgrade engine
 func New(db *database.DB, config Config) *Engine {
+	// A zero interval would make time.NewTicker panic
+	if config.PollInterval <= 0 {
+		config.PollInterval = time.Minute
+	}
+	if config.ScheduleInterval <= 0 {
+		config.ScheduleInterval = config.PollInterval
+	}
+	if config.DiscoveryInterval <= 0 {
+		config.DiscoveryInterval = config.PollInterval
+	}
+	if config.EvaluationInterval <= 0 {
+		config.EvaluationInterval = 2 * config.DiscoveryInterval
+	}
 	if config.MaxPerCMTS <= 0 {
 		config.MaxPerCMTS = 10 // Default limit
 	}
-	return &Engine{
-		db:         db,
-		config:     config,
-		jobs:       make(chan *models.UpgradeJob, 100),
-		matcher:    NewMatcher(),
-		cmtsLimits: make(map[int]*semaphore),
+	if config.VerifyGracePeriod <= 0 {
+		config.VerifyGracePeriod = 2 * time.Minute
+	}
+	if config.InitialEvaluationDelay <= 0 {
+		config.InitialEvaluationDelay = 30 * time.Second
 	}
+	if config.RetryBudgetWindow <= 0 {
+		config.RetryBudgetWindow = time.Hour
+	}
+	if config.RetryAttempts < 0 {
+		config.RetryAttempts = models.DefaultMaxRetries
+	}
+	if config.UpgradePollInterval <= 0 {
+		config.UpgradePollInterval = models.DefaultUpgradePollSeconds * time.Second
+	}
+	minSignal, maxSignal := loadSignalThresholds(db)
+	e := &Engine{
+		db:               db,
+		config:           config,
+		jobs:             make(chan *models.UpgradeJob, 100),
+		matcher:          NewMatcherWithThresholds(minSignal, maxSignal),
+		cmtsLimits:       make(map[int]*semaphore),
+		ruleLimits:       make(map[int]*semaphore),
+		activeJobs:       make(map[int]context.CancelFunc),
+		heartbeats:       make(map[string]time.Time),
+		campaignReleases: make(map[int]time.Time),
+		lastDiscovery:    make(map[int]DiscoveryStatus),
+		cmtsRetryBudgets: make(map[int]*retryBudget),
+		subscribers:      make(map[chan JobEvent]struct{}),
+		drain:            make(chan struct{}),
+		stopped:          make(chan struct{}),
+		connectModem:     connectToModem,
+		now:              time.Now,
+		statusInterval:   config.UpgradePollInterval,
+		verifyInterval:   10 * time.Second,
+		campaignInterval: 15 * time.Second,
+		refreshTimeout:   10 * time.Second,
+	}
+	e.matcher.EligibleStatuses = loadEligibleStatuses(db)
+	e.discover = e.discoverModems
+	e.notifier = newNotifier(db)
+	e.probeCMTS = snmp.ProbeCMTS
+	e.probeFirmware = func(server, filename string) error {
+		return tftp.CheckFileExists(server, filename, firmwareProbeTimeout)
+	}
+	if config.DiscoveryConcurrency > 0 {
+		e.discoverySem = newSemaphore(config.DiscoveryConcurrency)
+	}
+	if config.RetryBudget > 0 {
+		e.retryBudget = newRetryBudget(config.RetryBudget, config.RetryBudgetWindow)
+	}
+	if p := config.SchedulingPolicy; p != SchedulingPrioritizeUpgrades && p != SchedulingPrioritizeDiscovery {
+		if p != "" && p != SchedulingFair {
+			log.Warn().Str("provided", p).Msg("Unknown scheduling policy, using 'fair'")
+		}
+		e.config.SchedulingPolicy = SchedulingFair
+	}
+	if config.SNMPBudget > 0 {
+		e.snmpBudget = newSNMPBudget(config.SNMPBudget, e.config.SchedulingPolicy)
+	}
+	if value, err := db.GetSetting("engine_paused"); err == nil {
+		if paused, err := strconv.ParseBool(value); err == nil && paused {
+			log.Warn().Msg("Upgrade engine is paused, no new upgrades will start until resumed")
+			e.paused.Store(true)
+		}
+	}
+	return e
+}
+
+// loadEligibleStatuses reads the comma-separated eligible_statuses setting,
+// falling back to DefaultEligibleStatuses when it is missing or empty
+func loadEligibleStatuses(db *database.DB) []string {
+	value, err := db.GetSetting("eligible_statuses")
+	if err != nil {
+		return DefaultEligibleStatuses
+	}
+
+	var statuses []string
+	for _, status := range strings.Split(value, ",") {
+		if status = strings.ToLower(strings.TrimSpace(status)); status != "" {
+			statuses = append(statuses, status)
+		}
+	}
+	if len(statuses) == 0 {
+		return DefaultEligibleStatuses
+	}
+	return statuses
+}
+
+// loadSignalThresholds reads signal_level_min/max from settings, falling
+// back to the defaults when missing or invalid
+func loadSignalThresholds(db *database.DB) (float64, float64) {
+	min, max := DefaultMinSignal, DefaultMaxSignal
+
+	settings, err := db.ListSettings()
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to load signal thresholds, using defaults")
+		return min, max
+	}
+
+	if val, err := strconv.ParseFloat(settings["signal_level_min"], 64); err == nil {
+		min = val
+	}
+	if val, err := strconv.ParseFloat(settings["signal_level_max"], 64); err == nil {
+		max = val
+	}
+
+	if min > max {
+		log.Warn().
+			Float64("min", min).
+			Float64("max", max).
+			Msg("signal_level_min exceeds signal_level_max, using defaults")
+		return DefaultMinSignal, DefaultMaxSignal
+	}
+
+	return min, max
 }
 
 // getCMTSSemaphore gets or creates a semaphore for a CMTS
@@ -98,42 +602,258 @@ func (e *Engine) getCMTSSemaphore(cmtsID int) *semaphore {
 func (e *Engine) Start(ctx context.Context) error {
 	log.Info().
 		Int("workers", e.config.Workers).
-		Dur("poll_interval", e.config.PollInterval).
+		Dur("schedule_interval", e.config.ScheduleInterval).
+		Dur("discovery_interval", e.config.DiscoveryInterval).
+		Dur("evaluation_interval", e.config.EvaluationInterval).
 		Msg("Starting upgrade engine")
 
+	// Workers and schedulers get their own contexts so Shutdown can stop
+	// them separately; cancelling ctx still stops everything at once
+	workerCtx, stopWorkers := context.WithCancel(ctx)
+	defer stopWorkers()
+	schedulerCtx, stopSchedulers := context.WithCancel(ctx)
+	defer stopSchedulers()
+
+	e.lifecycleMu.Lock()
+	e.stopWorkers = stopWorkers
+	e.stopSchedulers = stopSchedulers
+	e.lifecycleMu.Unlock()
+
 	// Start worker goroutines
 	for i := 0; i < e.config.Workers; i++ {
-		go e.worker(ctx, i)
+		e.workerWG.Add(1)
+		go func(id int) {
+			defer e.workerWG.Done()
+			e.worker(workerCtx, id)
+		}(i)
 	}
 
-	// Start job scheduler
-	go e.scheduler(ctx)
+	// Start job, discovery, rule evaluation, cleanup and campaign schedulers
+	for _, scheduler := range []func(context.Context){
+		e.scheduler,
+		e.discoveryScheduler,
+		e.ruleEvaluationScheduler,
+		e.cleanupScheduler,
+		e.campaignScheduler,
+	} {
+		e.schedulerWG.Add(1)
+		go func(run func(context.Context)) {
+			defer e.schedulerWG.Done()
+			run(schedulerCtx)
+		}(scheduler)
+	}
 
-	// Start discovery scheduler
-	go e.discoveryScheduler(ctx)
+	select {
+	case <-ctx.Done():
+	case <-e.stopped:
+	}
+	log.Info().Msg("Upgrade engine shutting down")
+	return nil
+}
 
-	// Start rule evaluation scheduler
-	go e.ruleEvaluationScheduler(ctx)
+// Subscribe registers for job status events. The returned func unsubscribes
+// and closes the channel; it is safe to call more than once.
+func (e *Engine) Subscribe() (<-chan JobEvent, func()) {
+	ch := make(chan JobEvent, 32)
+
+	e.subscribersMu.Lock()
+	e.subscribers[ch] = struct{}{}
+	e.subscribersMu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			e.subscribersMu.Lock()
+			delete(e.subscribers, ch)
+			e.subscribersMu.Unlock()
+			close(ch)
+		})
+	}
+}
 
-	// Start cleanup scheduler
-	go e.cleanupScheduler(ctx)
+// publishJobEvent notifies subscribers of a job's current status. Slow
+// subscribers miss events rather than blocking the engine.
+func (e *Engine) publishJobEvent(job *models.UpgradeJob) {
+	e.publish(JobEvent{JobID: job.ID, MAC: job.MACAddress, Status: job.Status})
+}
 
-	<-ctx.Done()
-	log.Info().Msg("Upgrade engine shutting down")
-	close(e.jobs)
-	return nil
+func (e *Engine) publish(event JobEvent) {
+	e.subscribersMu.Lock()
+	defer e.subscribersMu.Unlock()
+
+	for ch := range e.subscribers {
+		select {
+		case ch <- event:
+		default:
+			log.Debug().Int("job_id", event.JobID).Msg("Dropping job event for slow subscriber")
+		}
+	}
+}
+
+// heartbeat records a scheduler tick. The first tick marks the scheduler ready.
+func (e *Engine) heartbeat(name string) {
+	e.heartbeatsMu.Lock()
+	defer e.heartbeatsMu.Unlock()
+
+	if _, ok := e.heartbeats[name]; !ok {
+		log.Debug().Str("scheduler", name).Msg("Scheduler ready")
+	}
+	now := time.Now()
+	e.heartbeats[name] = now
+	e.lastHeartbeat.Store(now.UnixNano())
+}
+
+// Ready reports whether every scheduler has ticked at least once
+func (e *Engine) Ready() bool {
+	e.heartbeatsMu.Lock()
+	defer e.heartbeatsMu.Unlock()
+	return len(e.heartbeats) == schedulerCount
+}
+
+// Liveness describes whether the engine's schedulers are ticking and its
+// workers are running
+type Liveness struct {
+	// LastHeartbeat is the most recent scheduler tick, nil before Start
+	LastHeartbeat *time.Time `json:"last_heartbeat"`
+	// StaleAfter is how long the schedulers may go without ticking before
+	// the engine is stalled
+	StaleAfter     time.Duration `json:"-"`
+	Stalled        bool          `json:"stalled"`
+	Workers        int           `json:"workers"`
+	RunningWorkers int           `json:"running_workers"`
+}
+
+// Liveness reports whether the engine is still ticking. It is stalled once
+// it has started but no scheduler has ticked within livenessIntervals job
+// poll intervals.
+func (e *Engine) Liveness() Liveness {
+	interval := e.config.ScheduleInterval
+	if interval <= 0 {
+		interval = minSchedulerInterval
+	}
+
+	liveness := Liveness{
+		LastHeartbeat:  cycleTime(e.lastHeartbeat.Load()),
+		StaleAfter:     livenessIntervals * interval,
+		Workers:        e.config.Workers,
+		RunningWorkers: int(e.runningWorkers.Load()),
+	}
+	if liveness.LastHeartbeat != nil {
+		liveness.Stalled = time.Since(*liveness.LastHeartbeat) > liveness.StaleAfter
+	}
+	return liveness
 }
 
-// worker processes upgrade jobs
+// Status returns a snapshot of the engine's internal state
+func (e *Engine) Status() Status {
+	status := Status{
+		Workers:             e.config.Workers,
+		Paused:              e.Paused(),
+		QueueLength:         len(e.jobs),
+		QueueCapacity:       cap(e.jobs),
+		MaxPerCMTS:          e.config.MaxPerCMTS,
+		ActivePerCMTS:       make(map[int]int),
+		JobsProcessed:       e.jobsProcessed.Load(),
+		SchedulerHeartbeats: make(map[string]time.Time),
+		LastDiscoveryCycle:  cycleTime(e.lastDiscoveryCycle.Load()),
+		LastEvaluationCycle: cycleTime(e.lastEvaluationCycle.Load()),
+		LastDiscovery:       make(map[int]DiscoveryStatus),
+	}
+
+	e.activeJobsMu.Lock()
+	status.ActiveJobs = len(e.activeJobs)
+	e.activeJobsMu.Unlock()
+
+	e.cmtsLimitsMu.RLock()
+	for cmtsID, sem := range e.cmtsLimits {
+		held := sem.Held()
+		status.ActivePerCMTS[cmtsID] = held
+		if held > 0 {
+			status.CMTSSemaphores++
+		}
+	}
+	e.cmtsLimitsMu.RUnlock()
+
+	e.heartbeatsMu.Lock()
+	for name, at := range e.heartbeats {
+		status.SchedulerHeartbeats[name] = at
+	}
+	status.Ready = len(e.heartbeats) == schedulerCount
+	e.heartbeatsMu.Unlock()
+
+	e.statusMu.Lock()
+	if e.lastEvaluation != nil {
+		summary := *e.lastEvaluation
+		status.LastEvaluation = &summary
+	}
+	for cmtsID, discovery := range e.lastDiscovery {
+		status.LastDiscovery[cmtsID] = discovery
+	}
+	e.statusMu.Unlock()
+
+	return status
+}
+
+// cycleTime converts a cycle timestamp to a time, or nil if it was never set
+func cycleTime(nanos int64) *time.Time {
+	if nanos == 0 {
+		return nil
+	}
+	at := time.Unix(0, nanos)
+	return &at
+}
+
+// worker processes upgrade jobs, relaunching its loop after a panic so the
+// pool doesn't permanently lose a worker
 func (e *Engine) worker(ctx context.Context, id int) {
 	log.Debug().Int("worker_id", id).Msg("Worker started")
+	e.runningWorkers.Add(1)
+	defer e.runningWorkers.Add(-1)
+
+	for e.runWorker(ctx, id) {
+		log.Warn().Int("worker_id", id).Msg("Restarting worker after panic")
+	}
+}
+
+// runWorker takes jobs off the queue until the worker is stopped or drained.
+// It reports true if a job panicked; the job is then marked FAILED, and the
+// panic is re-raised instead when the restart_workers_on_panic setting is off.
+func (e *Engine) runWorker(ctx context.Context, id int) (panicked bool) {
+	var current *models.UpgradeJob
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		panicked = true
+
+		event := log.Error().
+			Int("worker_id", id).
+			Interface("panic", r).
+			Str("stack", string(debug.Stack()))
+		if current != nil {
+			event = event.Int("job_id", current.ID)
+		}
+		event.Msg("Worker panicked")
+
+		if current != nil {
+			e.failPanickedJob(current, fmt.Errorf("worker panicked: %v", r))
+		}
+		if !e.restartWorkersOnPanic() {
+			panic(r)
+		}
+	}()
 
 	for {
 		select {
 		case <-ctx.Done():
 			log.Debug().Int("worker_id", id).Msg("Worker stopped")
-			return
+			return false
+		case <-e.drain:
+			log.Debug().Int("worker_id", id).Msg("Worker drained")
+			return false
 		case job := <-e.jobs:
+			current = job
 			if err := e.processJob(ctx, job); err != nil {
 				log.Error().
 					Err(err).
@@ -141,20 +861,73 @@ func (e *Engine) worker(ctx context.Context, id int) {
 					Int("job_id", job.ID).
 					Msg("Failed to process job")
 			}
+			current = nil
+		}
+	}
+}
+
+// restartWorkersOnPanic reports whether a worker recovers from a panicking
+// job, per the restart_workers_on_panic setting (default on). Off, the panic
+// takes the process down so a supervisor can restart it.
+func (e *Engine) restartWorkersOnPanic() bool {
+	if value, err := e.db.GetSetting("restart_workers_on_panic"); err == nil {
+		if enabled, err := strconv.ParseBool(value); err == nil && !enabled {
+			return false
 		}
 	}
+	return true
+}
+
+// failPanickedJob marks a job whose worker panicked as FAILED rather than
+// leaving it IN_PROGRESS. It is not retried, since the same job would most
+// likely panic again.
+func (e *Engine) failPanickedJob(job *models.UpgradeJob, err error) {
+	logger := jobLogger(job)
+
+	errMsg := err.Error()
+	failed := time.Now()
+	job.Status = models.JobStatusFailed
+	job.ErrorMessage = &errMsg
+	job.CompletedAt = &failed
+	job.NextRetryAt = nil
+	job.DeadLetter = true
+	job.RetryCount++
+
+	if recordErr := e.db.AppendJobFailure(job.ID, models.JobFailure{
+		Attempt: job.RetryCount,
+		At:      failed,
+		Error:   errMsg,
+	}); recordErr != nil {
+		logger.Error().Err(recordErr).Msg("Failed to record job failure details")
+	}
+
+	err = e.updateJobWithActivity(job, &models.ActivityLog{
+		EventType:  models.EventUpgradeFailed,
+		EntityType: "job",
+		EntityID:   job.ID,
+		Message:    fmt.Sprintf("Upgrade failed for modem %s: %s", job.MACAddress, errMsg),
+	})
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to mark panicked job as failed")
+		return
+	}
+	e.publishJobEvent(job)
+	e.notifier.notifyJob(models.EventUpgradeFailed, job)
 }
 
 // scheduler periodically checks for pending jobs
 func (e *Engine) scheduler(ctx context.Context) {
-	ticker := time.NewTicker(e.config.PollInterval)
+	ticker := time.NewTicker(clampInterval("schedule", e.config.ScheduleInterval))
 	defer ticker.Stop()
 
+	e.heartbeat("jobs")
+
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
+			e.heartbeat("jobs")
 			if err := e.checkPendingJobs(); err != nil {
 				log.Error().Err(err).Msg("Failed to check pending jobs")
 			}
@@ -162,9 +935,45 @@ func (e *Engine) scheduler(ctx context.Context) {
 	}
 }
 
+// Pause stops new upgrade jobs from being created or started. Jobs already
+// in progress run to completion. The paused state survives a restart.
+func (e *Engine) Pause() error {
+	return e.setPaused(true)
+}
+
+// Resume lets the engine create and start upgrade jobs again
+func (e *Engine) Resume() error {
+	return e.setPaused(false)
+}
+
+// Paused reports whether the engine is paused
+func (e *Engine) Paused() bool {
+	return e.paused.Load()
+}
+
+func (e *Engine) setPaused(paused bool) error {
+	e.paused.Store(paused)
+	if err := e.db.SetSetting("engine_paused", strconv.FormatBool(paused)); err != nil {
+		return fmt.Errorf("failed to persist paused state: %w", err)
+	}
+
+	if paused {
+		log.Warn().Msg("Upgrade engine paused")
+	} else {
+		log.Info().Msg("Upgrade engine resumed")
+	}
+	return nil
+}
+
 // checkPendingJobs retrieves and queues pending jobs with deduplication
 func (e *Engine) checkPendingJobs() error {
-	jobs, err := e.db.ListJobs(models.JobStatusPending, 100)
+	if e.Paused() {
+		log.Debug().Msg("Engine paused, not queueing pending jobs")
+		return nil
+	}
+
+	// Jobs waiting out a retry backoff are left until it has elapsed
+	jobs, err := e.db.ListDispatchablePendingJobs(time.Now(), 100)
 	if err != nil {
 		return fmt.Errorf("failed to list pending jobs: %w", err)
 	}
@@ -204,30 +1013,70 @@ func (e *Engine) checkPendingJobs() error {
 
 // processJob executes a single upgrade job
 func (e *Engine) processJob(ctx context.Context, job *models.UpgradeJob) error {
-	log.Info().
-		Int("job_id", job.ID).
-		Str("mac", job.MACAddress).
+	// Jobs queued before trace IDs existed get one for this attempt
+	if job.TraceID == "" {
+		job.TraceID = models.NewTraceID()
+	}
+	logger := jobLogger(job)
+
+	// The job may have been cancelled while it sat in the queue
+	current, err := e.db.GetJob(job.ID)
+	if err != nil {
+		return fmt.Errorf("failed to reload job: %w", err)
+	}
+	if current.Status != models.JobStatusPending {
+		logger.Debug().
+			Str("status", current.Status).
+			Msg("Skipping job - no longer pending")
+		return nil
+	}
+
+	// Jobs queued before a pause stay pending until the engine resumes
+	if e.Paused() {
+		logger.Debug().
+			Msg("Skipping job - engine paused")
+		return nil
+	}
+
+	// Likewise during shutdown, so the next run picks them up
+	if e.draining() {
+		logger.Debug().
+			Msg("Skipping job - engine shutting down")
+		return nil
+	}
+
+	logger.Info().
 		Msg("Processing upgrade job")
+	defer e.jobsProcessed.Add(1)
+
+	// Give the job its own context so it can be cancelled individually
+	jobCtx, cancel := context.WithCancel(ctx)
+	e.registerActiveJob(job.ID, cancel)
+	defer e.unregisterActiveJob(job.ID)
 
 	// Update job status to in progress
 	now := time.Now()
 	job.Status = models.JobStatusInProgress
 	job.StartedAt = &now
+	job.NextRetryAt = nil
 
-	if err := e.db.UpdateJob(job); err != nil {
-		return fmt.Errorf("failed to update job status: %w", err)
-	}
-
-	// Log activity
-	e.db.LogActivity(&models.ActivityLog{
+	err = e.updateJobWithActivity(job, &models.ActivityLog{
 		EventType:  models.EventUpgradeStarted,
 		EntityType: "job",
 		EntityID:   job.ID,
 		Message:    fmt.Sprintf("Started firmware upgrade for modem %s", job.MACAddress),
 	})
+	if err != nil {
+		return fmt.Errorf("failed to update job status: %w", err)
+	}
+	e.publishJobEvent(job)
 
 	// Execute actual upgrade logic
-	if err := e.executeUpgrade(ctx, job); err != nil {
+	dryRun, err := e.executeUpgrade(jobCtx, job)
+	if err != nil {
+		if jobCtx.Err() != nil && ctx.Err() == nil {
+			return e.markJobCancelled(job)
+		}
 		return e.handleJobFailure(job, err)
 	}
 
@@ -236,28 +1085,414 @@ func (e *Engine) processJob(ctx context.Context, job *models.UpgradeJob) error {
 	job.Status = models.JobStatusCompleted
 	job.CompletedAt = &completed
 
-	if err := e.db.UpdateJob(job); err != nil {
+	err = e.updateJobWithActivity(job, &models.ActivityLog{
+		EventType:  models.EventUpgradeCompleted,
+		EntityType: "job",
+		EntityID:   job.ID,
+		Message:    fmt.Sprintf("Completed firmware upgrade for modem %s", job.MACAddress),
+	})
+	if err != nil {
 		return fmt.Errorf("failed to mark job complete: %w", err)
 	}
+	e.publishJobEvent(job)
+
+	// Dry runs never touch the modem, so they mustn't look like upgrades
+	// to the webhook
+	if dryRun {
+		e.notifier.notifyJob(models.EventUpgradeDryRun, job)
+	} else {
+		e.notifier.notifyJob(models.EventUpgradeCompleted, job)
+	}
+
+	logger.Info().
+		Msg("Upgrade job completed")
+
+	return nil
+}
+
+// jobLogger returns a logger that tags every line with the job's ID, trace
+// ID and modem, so one upgrade can be followed through the logs
+func jobLogger(job *models.UpgradeJob) zerolog.Logger {
+	return log.With().
+		Int("job_id", job.ID).
+		Str("trace_id", job.TraceID).
+		Str("mac", job.MACAddress).
+		Logger()
+}
+
+// updateJobWithActivity saves job and records activity in one transaction,
+// so a job never changes state without its log entry or vice versa
+func (e *Engine) updateJobWithActivity(job *models.UpgradeJob, activity *models.ActivityLog) error {
+	return e.db.WithTx(func(tx *database.Tx) error {
+		if err := tx.UpdateJob(job); err != nil {
+			return err
+		}
+		return tx.LogActivity(activity)
+	})
+}
+
+// registerActiveJob stores the cancel func for a running job
+func (e *Engine) registerActiveJob(jobID int, cancel context.CancelFunc) {
+	e.activeJobsMu.Lock()
+	defer e.activeJobsMu.Unlock()
+	e.activeJobs[jobID] = cancel
+}
+
+// unregisterActiveJob removes a running job and releases its context
+func (e *Engine) unregisterActiveJob(jobID int) {
+	e.activeJobsMu.Lock()
+	defer e.activeJobsMu.Unlock()
+	if cancel, ok := e.activeJobs[jobID]; ok {
+		cancel()
+		delete(e.activeJobs, jobID)
+	}
+}
+
+// CancelJob cancels a pending or in-progress job
+func (e *Engine) CancelJob(id int) error {
+	job, err := e.db.GetJob(id)
+	if err != nil {
+		return err
+	}
+
+	switch job.Status {
+	case models.JobStatusPending:
+		return e.markJobCancelled(job)
+
+	case models.JobStatusInProgress:
+		e.activeJobsMu.Lock()
+		cancel, running := e.activeJobs[id]
+		e.activeJobsMu.Unlock()
+
+		if !running {
+			// Orphaned by a previous run, nothing to signal
+			return e.markJobCancelled(job)
+		}
+
+		log.Info().
+			Int("job_id", id).
+			Str("mac", job.MACAddress).
+			Msg("Signalling in-progress job to cancel")
+
+		// The worker marks the job as skipped once the upgrade loop exits
+		cancel()
+		return nil
+
+	default:
+		return models.ErrInvalidJobState
+	}
+}
+
+// QueueManualUpgrade creates an ad-hoc upgrade job for one modem whose status
+// is in the eligible_statuses setting, outside of any rule or campaign. The
+// job has a rule_id of 0 and is picked up by the workers like any other.
+func (e *Engine) QueueManualUpgrade(modemID int, tftpServer, firmwareFilename string) (*models.UpgradeJob, error) {
+	if tftpServer == "" {
+		return nil, models.ErrInvalidTFTPServer
+	}
+	if firmwareFilename == "" {
+		return nil, models.ErrInvalidFirmware
+	}
+
+	// Share the evaluation lock so a rule can't queue the same modem at once
+	e.evalMu.Lock()
+	defer e.evalMu.Unlock()
+
+	modem, err := e.db.GetModem(modemID)
+	if err != nil {
+		return nil, err
+	}
+	e.matcher.EligibleStatuses = loadEligibleStatuses(e.db)
+	if !e.matcher.statusEligible(modem.Status) {
+		return nil, models.ErrModemOffline
+	}
+
+	jobs, err := e.db.ListJobsByMAC(modem.MACAddress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check existing jobs: %w", err)
+	}
+	for _, job := range jobs {
+		if job.Status == models.JobStatusPending || job.Status == models.JobStatusInProgress {
+			return nil, models.ErrUpgradeActive
+		}
+	}
+
+	job := &models.UpgradeJob{
+		ModemID:          modem.ID,
+		CMTSID:           modem.CMTSID,
+		MACAddress:       modem.MACAddress,
+		Status:           models.JobStatusPending,
+		TFTPServerIP:     tftpServer,
+		FirmwareFilename: firmwareFilename,
+		MaxRetries:       e.config.RetryAttempts,
+	}
+	job.ID, err = e.db.CreateJob(job)
+	if err != nil {
+		return nil, err
+	}
+
+	if version := extractFirmwareVersion(firmwareFilename); version != "" {
+		e.setExpectedFirmware(modem, version)
+	}
+
+	log.Info().
+		Int("job_id", job.ID).
+		Str("mac", modem.MACAddress).
+		Str("firmware", firmwareFilename).
+		Msg("Created manual upgrade job")
+
+	return job, nil
+}
+
+// RebootModem resets one modem over SNMP using its CMTS's CM community
+// string. Modems in the middle of an upgrade are left alone.
+func (e *Engine) RebootModem(modemID int) (*models.CableModem, error) {
+	modem, err := e.db.GetModem(modemID)
+	if err != nil {
+		return nil, err
+	}
+	if modem.IPAddress == "" {
+		return nil, models.ErrModemNoIP
+	}
+
+	jobs, err := e.db.ListJobsByMAC(modem.MACAddress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check existing jobs: %w", err)
+	}
+	for _, job := range jobs {
+		if job.Status == models.JobStatusInProgress {
+			return nil, models.ErrUpgradeActive
+		}
+	}
+
+	cmts, err := e.db.GetCMTS(modem.CMTSID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get CMTS details: %w", err)
+	}
+	community := modemCommunity(cmts)
+	if community == "" {
+		return nil, models.ErrNoModemCommunity
+	}
+
+	client, err := e.connectModem(modem.IPAddress, community, 161)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to modem: %w", err)
+	}
+	defer client.Close()
+
+	if err := client.RebootModem(); err != nil {
+		return nil, err
+	}
+
+	log.Info().
+		Int("modem_id", modem.ID).
+		Str("mac", modem.MACAddress).
+		Msg("Rebooted modem")
+
+	return modem, nil
+}
+
+// RefreshModem reads a modem's current sysDescr, status and signal level
+// over SNMP, stores them and returns the updated modem. Readings the modem
+// doesn't report keep their cached values. A modem that doesn't answer
+// within the refresh timeout is left untouched and an error returned.
+func (e *Engine) RefreshModem(modemID int) (*models.CableModem, error) {
+	modem, err := e.db.GetModem(modemID)
+	if err != nil {
+		return nil, err
+	}
+	if modem.IPAddress == "" {
+		return nil, models.ErrModemNoIP
+	}
+
+	cmts, err := e.db.GetCMTS(modem.CMTSID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get CMTS details: %w", err)
+	}
+	community := modemCommunity(cmts)
+	if community == "" {
+		return nil, models.ErrNoModemCommunity
+	}
+
+	type reading struct {
+		state snmp.ModemState
+		err   error
+	}
+	// Buffered so an abandoned read doesn't leak its goroutine
+	done := make(chan reading, 1)
+	go func() {
+		client, err := e.connectModem(modem.IPAddress, community, 161)
+		if err != nil {
+			done <- reading{err: fmt.Errorf("failed to connect to modem: %w", err)}
+			return
+		}
+		defer client.Close()
+		state, err := client.GetModemState()
+		done <- reading{state: state, err: err}
+	}()
+
+	var state snmp.ModemState
+	select {
+	case r := <-done:
+		if r.err != nil {
+			return nil, r.err
+		}
+		state = r.state
+	case <-time.After(e.refreshTimeout):
+		return nil, fmt.Errorf("modem %s did not respond within %v", modem.MACAddress, e.refreshTimeout)
+	}
+
+	modem.SysDescr = state.SysDescr
+	if state.Firmware != "" {
+		modem.CurrentFirmware = state.Firmware
+	}
+	if state.ConfigFile != "" {
+		modem.ConfigFile = state.ConfigFile
+	}
+	if state.Status != "" {
+		modem.Status = state.Status
+	}
+	if state.SignalOK {
+		modem.SignalLevel = state.Signal
+		modem.SignalUnavailable = false
+	}
+	if err := e.db.UpsertModem(modem); err != nil {
+		return nil, fmt.Errorf("failed to store refreshed modem: %w", err)
+	}
+
+	log.Debug().
+		Int("modem_id", modem.ID).
+		Str("mac", modem.MACAddress).
+		Str("status", modem.Status).
+		Msg("Refreshed modem over SNMP")
+
+	return e.db.GetModem(modemID)
+}
+
+// modemCommunity returns the community used to write to cmts's modems: the
+// CM community string if set, otherwise the CMTS write community
+func modemCommunity(cmts *models.CMTS) string {
+	if cmts.CMCommunityString != "" {
+		return cmts.CMCommunityString
+	}
+	return cmts.CommunityWrite
+}
+
+// markJobCancelled marks a job as skipped and records the cancellation
+func (e *Engine) markJobCancelled(job *models.UpgradeJob) error {
+	completed := time.Now()
+	errMsg := "cancelled by operator"
+	job.Status = models.JobStatusSkipped
+	job.ErrorMessage = &errMsg
+	job.CompletedAt = &completed
+
+	if err := e.db.UpdateJob(job); err != nil {
+		return fmt.Errorf("failed to mark job cancelled: %w", err)
+	}
+	e.publishJobEvent(job)
 
-	// Log completion
 	e.db.LogActivity(&models.ActivityLog{
-		EventType:  models.EventUpgradeCompleted,
+		EventType:  models.EventUpgradeCancelled,
 		EntityType: "job",
 		EntityID:   job.ID,
-		Message:    fmt.Sprintf("Completed firmware upgrade for modem %s", job.MACAddress),
+		Message:    fmt.Sprintf("Cancelled firmware upgrade for modem %s", job.MACAddress),
 	})
 
 	log.Info().
 		Int("job_id", job.ID).
 		Str("mac", job.MACAddress).
-		Msg("Upgrade job completed")
+		Msg("Upgrade job cancelled")
 
 	return nil
 }
 
-// DiscoverModems discovers modems on a CMTS
+// DiscoverModems discovers modems on a CMTS and records the outcome
 func (e *Engine) DiscoverModems(cmtsID int) error {
+	err := e.discover(cmtsID)
+
+	discovery := DiscoveryStatus{CompletedAt: time.Now()}
+	if err != nil {
+		discovery.Error = err.Error()
+	}
+
+	e.statusMu.Lock()
+	e.lastDiscovery[cmtsID] = discovery
+	e.statusMu.Unlock()
+
+	return err
+}
+
+// cmtsTestTimeout bounds a connection test so the UI never waits on the
+// full discovery timeout and retries
+const cmtsTestTimeout = 5 * time.Second
+
+// TestResult is the outcome of a CMTS connection test
+type TestResult struct {
+	Success   bool   `json:"success"`
+	SysDescr  string `json:"sys_descr,omitempty"`
+	LatencyMS int64  `json:"latency_ms"`
+	// ErrorKind is unreachable, timeout, auth or snmp_error
+	ErrorKind string `json:"error_kind,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// TestCMTSConnection checks that cmts answers SNMP with its configured
+// settings. It need not be saved. A failed check is reported in the result;
+// the error is only for settings too invalid to try.
+func (e *Engine) TestCMTSConnection(cmts *models.CMTS) (TestResult, error) {
+	if cmts == nil {
+		return TestResult{}, fmt.Errorf("CMTS cannot be nil")
+	}
+	if err := cmts.Validate(); err != nil {
+		return TestResult{}, err
+	}
+
+	started := time.Now()
+	sysDescr, err := e.probeCMTS(cmts, cmtsTestTimeout)
+	result := TestResult{
+		Success:   err == nil,
+		SysDescr:  sysDescr,
+		LatencyMS: time.Since(started).Milliseconds(),
+	}
+	if err != nil {
+		result.Error = err.Error()
+		result.ErrorKind = snmp.ProbeSNMPError
+		var probeErr *snmp.ProbeError
+		if errors.As(err, &probeErr) {
+			result.ErrorKind = probeErr.Kind
+		}
+	}
+
+	log.Info().
+		Str("cmts", cmts.Name).
+		Str("ip", cmts.IPAddress).
+		Bool("success", result.Success).
+		Int64("latency_ms", result.LatencyMS).
+		Str("error", result.Error).
+		Msg("CMTS connection test")
+
+	return result, nil
+}
+
+// defaultMaxModemsPerCMTS caps one CMTS's discovery when the
+// max_modems_per_cmts setting is missing or invalid
+const defaultMaxModemsPerCMTS = 100000
+
+// maxModemsPerCMTS reads the max_modems_per_cmts setting
+func (e *Engine) maxModemsPerCMTS() int {
+	value, err := e.db.GetSetting("max_modems_per_cmts")
+	if err != nil {
+		return defaultMaxModemsPerCMTS
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit <= 0 {
+		return defaultMaxModemsPerCMTS
+	}
+	return limit
+}
+
+// discoverModems polls a CMTS over SNMP and upserts the modems it reports
+func (e *Engine) discoverModems(cmtsID int) error {
 	log.Info().Int("cmts_id", cmtsID).Msg("Starting modem discovery")
 
 	// Get CMTS details
@@ -277,21 +1512,38 @@ func (e *Engine) DiscoverModems(cmtsID int) error {
 	}
 	defer client.Close()
 
-	// Discover modems
-	modems, err := client.DiscoverModems(cmts)
+	// Discover modems, giving up on a CMTS reporting an implausible number
+	// before they are all polled
+	maxModems := e.maxModemsPerCMTS()
+	modems, err := client.DiscoverModems(cmts, maxModems)
+	if errors.Is(err, snmp.ErrTooManyModems) {
+		log.Error().
+			Err(err).
+			Int("cmts_id", cmtsID).
+			Int("max_modems", maxModems).
+			Msg("Discovery aborted, CMTS reported too many modems")
+		e.db.LogActivity(&models.ActivityLog{
+			EventType:  models.EventDiscoveryAborted,
+			EntityType: "cmts",
+			EntityID:   cmtsID,
+			Message:    fmt.Sprintf("Aborted discovery on CMTS %s: it reported more than %d modems (max_modems_per_cmts)", cmts.Name, maxModems),
+		})
+		return fmt.Errorf("discovery aborted: %w", err)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to discover modems: %w", err)
 	}
 
-	// Upsert to database
+	// Label each modem with the vendor registered for its MAC's OUI
+	vendors := e.oui.load(e.db)
 	for _, modem := range modems {
-		if err := e.db.UpsertModem(modem); err != nil {
-			log.Error().
-				Err(err).
-				Str("mac", modem.MACAddress).
-				Msg("Failed to upsert modem")
-			continue
-		}
+		modem.Vendor = vendors.Lookup(modem.MACAddress)
+	}
+
+	// Upsert to database in one transaction, which also records modems
+	// that came online or dropped off since the last discovery
+	if err := e.db.UpsertModems(modems); err != nil {
+		return fmt.Errorf("failed to store discovered modems: %w", err)
 	}
 
 	// Log activity
@@ -312,12 +1564,116 @@ func (e *Engine) DiscoverModems(cmtsID int) error {
 
 // EvaluateRules evaluates all enabled rules against all modems
 func (e *Engine) EvaluateRules() error {
+	_, err := e.evaluate(nil)
+	return err
+}
+
+// EvaluateRulesReport evaluates all enabled rules like EvaluateRules and
+// returns a summary of the pass, including the IDs of the jobs it created
+func (e *Engine) EvaluateRulesReport() (*EvaluationSummary, error) {
+	return e.evaluate(nil)
+}
+
+// EvaluateRule evaluates a single enabled rule against all modems and returns
+// the number of jobs created. Modems are still matched against every enabled
+// rule, so a higher-priority rule keeps precedence; jobs are only created
+// where this rule wins.
+func (e *Engine) EvaluateRule(ruleID int) (int, error) {
+	rule, err := e.db.GetRule(ruleID)
+	if err != nil {
+		return 0, err
+	}
+	if !rule.Enabled {
+		return 0, models.ErrRuleDisabled
+	}
+
+	summary, err := e.evaluate(map[int]bool{ruleID: true})
+	if err != nil {
+		return 0, err
+	}
+	return summary.JobsCreated, nil
+}
+
+// RuleMatch is an enabled rule that matches a modem. Selected marks the rule
+// evaluation applies to it; if that is an exclude rule, the modem is left
+// alone.
+type RuleMatch struct {
+	*models.UpgradeRule
+	Selected bool `json:"selected"`
+}
+
+// MatchingRules returns every enabled rule that matches the modem, in the
+// order evaluation considers them, marking the one it would select
+func (e *Engine) MatchingRules(modemID int) ([]RuleMatch, error) {
+	modem, err := e.db.GetModem(modemID)
+	if err != nil {
+		return nil, err
+	}
+
+	rules, err := e.db.ListRules()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rules: %w", err)
+	}
+
+	// The matcher isn't safe to use during an evaluation pass
+	e.evalMu.Lock()
+	defer e.evalMu.Unlock()
+
+	selected, err := e.matcher.MatchModemToRules(modem, rules)
+	if err != nil && err != models.ErrModemExcluded {
+		return nil, err
+	}
+
+	matches := []RuleMatch{}
+	for _, rule := range e.matcher.AllMatchingRules(modem, rules) {
+		matches = append(matches, RuleMatch{
+			UpgradeRule: rule,
+			Selected:    selected != nil && rule.ID == selected.ID,
+		})
+	}
+	return matches, nil
+}
+
+// evaluate runs one evaluation pass. When subset is non-nil, only rules whose
+// IDs are in it may create jobs.
+func (e *Engine) evaluate(subset map[int]bool) (summary *EvaluationSummary, err error) {
+	summary = &EvaluationSummary{
+		StartedAt: time.Now(),
+		JobIDs:    []int{},
+		Skipped:   make(map[string]int),
+	}
+
+	if e.Paused() {
+		log.Info().Msg("Engine paused, skipping rule evaluation")
+		return summary, nil
+	}
+
+	// Serialize passes so concurrent triggers can't create duplicate jobs
+	e.evalMu.Lock()
+	defer e.evalMu.Unlock()
+
+	defer func() {
+		summary.DurationMS = time.Since(summary.StartedAt).Milliseconds()
+		summary.JobsCreated = len(summary.JobIDs)
+		if err != nil {
+			summary.Error = err.Error()
+		}
+
+		e.statusMu.Lock()
+		e.lastEvaluation = summary
+		e.statusMu.Unlock()
+	}()
+
 	log.Info().Msg("Evaluating upgrade rules")
 
+	// Pick up threshold changes made through the settings API
+	e.matcher.MinSignal, e.matcher.MaxSignal = loadSignalThresholds(e.db)
+	e.matcher.EligibleStatuses = loadEligibleStatuses(e.db)
+
 	// Get all enabled rules (sorted by priority)
 	allRules, err := e.db.ListRules()
 	if err != nil {
-		return fmt.Errorf("failed to list rules: %w", err)
+		return summary, fmt.Errorf("failed to list rules: %w", err)
 	}
 
 	// Filter enabled rules
@@ -330,85 +1686,192 @@ func (e *Engine) EvaluateRules() error {
 
 	if len(rules) == 0 {
 		log.Info().Msg("No enabled rules found")
-		return nil
+		return summary, nil
+	}
+
+	// Get all modems
+	allModems, err := e.db.ListModems(0) // 0 = all CMTS
+	if err != nil {
+		return summary, fmt.Errorf("failed to list modems: %w", err)
+	}
+
+	// Restrict to allowlisted CMTS for phased rollouts
+	allowlist, err := e.loadCMTSAllowlist()
+	if err != nil {
+		return summary, err
+	}
+	if allowlist != nil {
+		scoped := allModems[:0]
+		for _, modem := range allModems {
+			if allowlist[modem.CMTSID] {
+				scoped = append(scoped, modem)
+			} else {
+				summary.Skipped["cmts_not_allowed"]++
+			}
+		}
+		allModems = scoped
+	}
+
+	// Per-CMTS firmware caps pin how new a release each plant may receive
+	firmwareCaps, err := e.loadFirmwareCaps()
+	if err != nil {
+		return summary, err
+	}
+
+	// Filter eligible modems (online, good signal)
+	modems := e.matcher.FilterEligibleModems(allModems)
+	if ineligible := len(allModems) - len(modems); ineligible > 0 {
+		summary.Skipped["ineligible"] = ineligible
+	}
+
+	summary.TotalModems = len(allModems)
+	summary.EligibleModems = len(modems)
+	summary.Rules = len(rules)
+
+	// Load existing pending/in-progress jobs once per pass
+	existingPending, err := e.db.ListJobs(models.JobStatusPending, 1000)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to check existing pending jobs")
+	}
+
+	existingInProgress, err := e.db.ListJobs(models.JobStatusInProgress, 1000)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to check existing in-progress jobs")
+	}
+
+	activeJobs := make(map[string]*models.UpgradeJob)
+	for _, job := range append(existingPending, existingInProgress...) {
+		activeJobs[job.MACAddress] = job
+	}
+
+	// Resolve each rule's ${VAR} placeholders once per pass. A rule whose
+	// server can't be resolved gets one warning here and its modems are
+	// skipped, rather than a FAILED job per modem on every pass.
+	tftpServers := make(map[int]string, len(rules))
+	unresolved := make(map[int]bool)
+	for _, rule := range rules {
+		server, err := rule.ResolveTFTPServer()
+		if err != nil {
+			log.Warn().
+				Err(err).
+				Int("rule_id", rule.ID).
+				Str("rule", rule.Name).
+				Msg("Cannot resolve rule TFTP server, skipping its modems")
+			unresolved[rule.ID] = true
+			continue
+		}
+		tftpServers[rule.ID] = server
 	}
 
-	// Get all modems
-	allModems, err := e.db.ListModems(0) // 0 = all CMTS
-	if err != nil {
-		return fmt.Errorf("failed to list modems: %w", err)
+	// A dry run never changes the modem's firmware, so without this every
+	// pass would queue another one for the same modem
+	dryRunDone := make(map[int]map[string]bool)
+	for _, rule := range rules {
+		if !rule.DryRun {
+			continue
+		}
+		macs, err := e.db.ListRuleJobMACs(rule.ID, rule.FirmwareFilename, models.JobStatusCompleted)
+		if err != nil {
+			return summary, fmt.Errorf("failed to list dry-run jobs: %w", err)
+		}
+		dryRunDone[rule.ID] = macs
 	}
 
-	// Filter eligible modems (online, good signal)
-	modems := e.matcher.FilterEligibleModems(allModems)
+	// Parse rule criteria once per pass rather than once per modem
+	e.matcher.BeginPass()
+	defer e.matcher.EndPass()
 
 	log.Info().
 		Int("total_modems", len(allModems)).
 		Int("eligible_modems", len(modems)).
 		Int("active_rules", len(rules)).
+		Int("rule_subset", len(subset)).
 		Msg("Starting rule evaluation")
 
 	// Match modems to rules
-	jobsCreated := 0
 	for _, modem := range modems {
 		rule, err := e.matcher.MatchModemToRules(modem, rules)
+		if err == models.ErrModemExcluded {
+			summary.Skipped["excluded"]++
+			continue
+		}
 		if err != nil {
 			log.Error().
 				Err(err).
 				Str("mac", modem.MACAddress).
 				Msg("Failed to match modem to rules")
+			summary.Skipped["match_error"]++
 			continue
 		}
 
 		if rule == nil {
-			continue // No matching rule
+			summary.Skipped["no_matching_rule"]++
+			continue
+		}
+
+		if subset != nil && !subset[rule.ID] {
+			summary.Skipped["other_rule"]++ // Matched a rule outside this pass
+			continue
+		}
+
+		if !inCanaryCohort(modem.MACAddress, rule.CanaryPercent) {
+			summary.Skipped["canary"]++ // Held back until the rule's canary grows
+			continue
 		}
 
 		// Check if upgrade is needed
 		if !e.matcher.ShouldUpgrade(modem, rule) {
+			summary.Skipped["up_to_date"]++
 			continue
 		}
 
-		// Check if job already exists (pending or in-progress)
-		existingPending, err := e.db.ListJobs(models.JobStatusPending, 1000)
-		if err != nil {
-			log.Warn().Err(err).Msg("Failed to check existing pending jobs")
+		if maxVersion := firmwareCaps[modem.CMTSID]; exceedsFirmwareCap(rule.FirmwareFilename, maxVersion) {
+			log.Debug().
+				Str("mac", modem.MACAddress).
+				Int("cmts_id", modem.CMTSID).
+				Str("firmware", rule.FirmwareFilename).
+				Str("max_firmware_version", maxVersion).
+				Msg("Rule firmware exceeds CMTS cap, skipping")
+			summary.Skipped["cmts_firmware_cap"]++
+			continue
 		}
 
-		existingInProgress, err := e.db.ListJobs(models.JobStatusInProgress, 1000)
-		if err != nil {
-			log.Warn().Err(err).Msg("Failed to check existing in-progress jobs")
+		// Check if job already exists (pending or in-progress)
+		if existing, ok := activeJobs[modem.MACAddress]; ok {
+			log.Debug().
+				Str("mac", modem.MACAddress).
+				Str("status", existing.Status).
+				Int("job_id", existing.ID).
+				Msg("Job already exists for modem, skipping")
+			summary.Skipped["job_exists"]++
+			continue
 		}
 
-		// Combine all existing jobs
-		existingJobs := append(existingPending, existingInProgress...)
-		skip := false
-		for _, job := range existingJobs {
-			if job.MACAddress == modem.MACAddress {
-				log.Debug().
-					Str("mac", modem.MACAddress).
-					Str("status", job.Status).
-					Int("job_id", job.ID).
-					Msg("Job already exists for modem, skipping")
-				skip = true
-				break
-			}
+		if unresolved[rule.ID] {
+			summary.Skipped["tftp_unresolved"]++
+			continue
 		}
-		if skip {
+
+		if rule.DryRun && dryRunDone[rule.ID][modem.MACAddress] {
+			summary.Skipped["dry_run_done"]++
 			continue
 		}
 
 		// Create upgrade job
 		job := &models.UpgradeJob{
-			ModemID:          modem.ID,
-			RuleID:           rule.ID,
-			CMTSID:           modem.CMTSID,
-			MACAddress:       modem.MACAddress,
-			Status:           models.JobStatusPending,
-			TFTPServerIP:     rule.TFTPServerIP,
-			FirmwareFilename: rule.FirmwareFilename,
-			RetryCount:       0,
-			MaxRetries:       3,
+			ModemID:             modem.ID,
+			RuleID:              rule.ID,
+			CMTSID:              modem.CMTSID,
+			MACAddress:          modem.MACAddress,
+			Status:              models.JobStatusPending,
+			TFTPServerIP:        tftpServers[rule.ID],
+			FirmwareFilename:    rule.FirmwareFilename,
+			RetryCount:          0,
+			MaxRetries:          rule.MaxRetries,
+			AdminStatusValue:    rule.AdminStatusValue,
+			CustomUpgradeOID:    rule.CustomUpgradeOID,
+			TransportProtocol:   rule.TransportProtocol,
+			UpgradePollInterval: rule.UpgradePollInterval,
 		}
 
 		jobID, err := e.db.CreateJob(job)
@@ -417,6 +1880,7 @@ func (e *Engine) EvaluateRules() error {
 				Err(err).
 				Str("mac", modem.MACAddress).
 				Msg("Failed to create upgrade job")
+			summary.Skipped["create_failed"]++
 			continue
 		}
 
@@ -426,71 +1890,213 @@ func (e *Engine) EvaluateRules() error {
 			Str("rule", rule.Name).
 			Msg("Created upgrade job")
 
-		jobsCreated++
+		// The modem is now supposed to end up on the rule's firmware
+		if target := extractFirmwareVersion(rule.FirmwareFilename); target != "" && !rule.DryRun {
+			e.setExpectedFirmware(modem, target)
+		}
+
+		job.ID = jobID
+		activeJobs[modem.MACAddress] = job
+
+		summary.JobIDs = append(summary.JobIDs, jobID)
 	}
 
 	log.Info().
-		Int("jobs_created", jobsCreated).
+		Int("jobs_created", len(summary.JobIDs)).
 		Msg("Rule evaluation completed")
 
-	return nil
+	return summary, nil
+}
+
+// loadCMTSAllowlist reads the evaluation_cmts_allowlist setting. A nil map
+// means every CMTS is allowed; that is only assumed when the setting is
+// missing or empty, never when it can't be read.
+func (e *Engine) loadCMTSAllowlist() (map[int]bool, error) {
+	value, err := e.db.GetSetting("evaluation_cmts_allowlist")
+	if errors.Is(err, models.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load evaluation_cmts_allowlist: %w", err)
+	}
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+
+	allowlist := make(map[int]bool)
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		id, err := strconv.Atoi(part)
+		if err != nil {
+			// Fail closed so a typo never turns a pilot into a fleet-wide rollout
+			return nil, fmt.Errorf("invalid evaluation_cmts_allowlist entry %q: %w", part, err)
+		}
+		allowlist[id] = true
+	}
+
+	log.Debug().
+		Str("allowlist", value).
+		Msg("Restricting rule evaluation to allowlisted CMTS")
+
+	return allowlist, nil
+}
+
+// loadFirmwareCaps returns each capped CMTS's max_firmware_version by ID
+func (e *Engine) loadFirmwareCaps() (map[int]string, error) {
+	cmtsList, err := e.db.ListCMTS()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list CMTS: %w", err)
+	}
+	firmwareCaps := make(map[int]string)
+	for _, cmts := range cmtsList {
+		if cmts.MaxFirmwareVersion != "" {
+			firmwareCaps[cmts.ID] = cmts.MaxFirmwareVersion
+		}
+	}
+	return firmwareCaps, nil
+}
+
+// getRuleSemaphore gets or creates the semaphore capping a rule's concurrent
+// upgrades, or returns nil if the rule is unlimited. The semaphore is
+// resized in place when the rule's limit changes, so upgrades already
+// running count against the new limit.
+func (e *Engine) getRuleSemaphore(rule *models.UpgradeRule) *semaphore {
+	if rule == nil || rule.MaxConcurrent <= 0 {
+		return nil
+	}
+
+	e.ruleLimitsMu.Lock()
+	defer e.ruleLimitsMu.Unlock()
+
+	if sem, exists := e.ruleLimits[rule.ID]; exists {
+		if sem.Limit() != rule.MaxConcurrent {
+			sem.Resize(rule.MaxConcurrent)
+			log.Debug().
+				Int("rule_id", rule.ID).
+				Int("max_concurrent", rule.MaxConcurrent).
+				Msg("Resized rate limiter for rule")
+		}
+		return sem
+	}
+
+	sem := newSemaphore(rule.MaxConcurrent)
+	e.ruleLimits[rule.ID] = sem
+
+	log.Debug().
+		Int("rule_id", rule.ID).
+		Int("max_concurrent", rule.MaxConcurrent).
+		Msg("Created rate limiter for rule")
+
+	return sem
 }
 
-// executeUpgrade performs the actual firmware upgrade via SNMP
-func (e *Engine) executeUpgrade(ctx context.Context, job *models.UpgradeJob) error {
+// executeUpgrade performs the actual firmware upgrade via SNMP. It reports
+// whether the job's rule was a dry run and the modem was left untouched
+func (e *Engine) executeUpgrade(ctx context.Context, job *models.UpgradeJob) (bool, error) {
+	logger := jobLogger(job)
+
+	// Dry-run rules record the job without touching the modem
+	rule, err := e.db.GetRule(job.RuleID)
+	if err != nil && err != models.ErrNotFound {
+		return false, fmt.Errorf("failed to get rule: %w", err)
+	}
+	if rule != nil && rule.DryRun {
+		logger.Info().
+			Str("rule", rule.Name).
+			Msg("Dry run rule, skipping SNMP upgrade")
+
+		e.db.LogActivity(&models.ActivityLog{
+			EventType:  models.EventUpgradeDryRun,
+			EntityType: "job",
+			EntityID:   job.ID,
+			Message: fmt.Sprintf("Dry run: would upgrade modem %s to %s (rule %s)",
+				job.MACAddress, job.FirmwareFilename, rule.Name),
+		})
+		return true, nil
+	}
+
+	if err := e.verifyFirmwareExists(job); err != nil {
+		return false, err
+	}
+
+	// Always take the rule slot before the CMTS slot so workers can't
+	// deadlock holding one each
+	if ruleSem := e.getRuleSemaphore(rule); ruleSem != nil {
+		if err := ruleSem.Acquire(ctx); err != nil {
+			return false, err
+		}
+		defer ruleSem.Release()
+
+		logger.Debug().
+			Int("rule_id", job.RuleID).
+			Msg("Acquired rule rate limit slot")
+	}
+
 	// Acquire CMTS rate limit semaphore
 	sem := e.getCMTSSemaphore(job.CMTSID)
-	sem.Acquire()
+	if err := sem.Acquire(ctx); err != nil {
+		return false, err
+	}
 	defer sem.Release()
 
-	log.Debug().
-		Int("job_id", job.ID).
+	logger.Debug().
 		Int("cmts_id", job.CMTSID).
-		Str("mac", job.MACAddress).
 		Msg("Acquired CMTS rate limit slot")
 
+	// Share the SNMP budget with discovery
+	if e.snmpBudget != nil {
+		if !e.snmpBudget.TryAcquire(true) {
+			logger.Debug().
+				Msg("Upgrade waiting for SNMP budget")
+			if err := e.snmpBudget.Acquire(ctx, true); err != nil {
+				return false, err
+			}
+		}
+		defer e.snmpBudget.Release(true)
+	}
+
 	// 1. Get modem details from database
 	modem, err := e.db.GetModem(job.ModemID)
 	if err != nil {
-		return fmt.Errorf("failed to get modem details: %w", err)
+		return false, fmt.Errorf("failed to get modem details: %w", err)
 	}
 
 	// Verify modem has IP address
 	if modem.IPAddress == "" {
-		return fmt.Errorf("modem has no IP address")
+		return false, models.ErrModemNoIP
 	}
 
 	// 2. Get CMTS details for CM community string
 	cmts, err := e.db.GetCMTS(job.CMTSID)
 	if err != nil {
-		return fmt.Errorf("failed to get CMTS details: %w", err)
-	}
-
-	// Use CM community string if available, fallback to write community
-	community := cmts.CMCommunityString
-	if community == "" {
-		community = cmts.CommunityWrite
+		return false, fmt.Errorf("failed to get CMTS details: %w", err)
 	}
 
+	community := modemCommunity(cmts)
 	if community == "" {
-		return fmt.Errorf("no SNMP write community string available")
+		return false, models.ErrNoModemCommunity
 	}
 
-	log.Info().
+	logger.Info().
 		Str("modem_ip", modem.IPAddress).
-		Str("mac", job.MACAddress).
 		Msg("Connecting to cable modem via SNMP")
 
 	// 3. Connect to cable modem via SNMP
-	client, err := snmp.ConnectToModem(modem.IPAddress, community, 161)
+	client, err := e.connectModem(modem.IPAddress, community, 161)
 	if err != nil {
-		return fmt.Errorf("failed to connect to modem: %w", err)
+		return false, fmt.Errorf("failed to connect to modem: %w", err)
 	}
 	defer client.Close()
 
-	// 4. Trigger firmware upgrade
-	log.Info().
-		Str("mac", job.MACAddress).
+	// 4. Trigger firmware upgrade, unless the job was cancelled while it
+	// waited for a slot
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	logger.Info().
 		Str("tftp_server", job.TFTPServerIP).
 		Str("firmware", job.FirmwareFilename).
 		Msg("Triggering firmware upgrade")
@@ -499,63 +2105,95 @@ func (e *Engine) executeUpgrade(ctx context.Context, job *models.UpgradeJob) err
 		modem.IPAddress,
 		job.TFTPServerIP,
 		job.FirmwareFilename,
+		job.AdminStatusValue,
+		job.CustomUpgradeOID,
+		job.TransportProtocol,
 	)
 	if err != nil {
-		return fmt.Errorf("failed to trigger upgrade: %w", err)
+		return false, fmt.Errorf("failed to trigger upgrade: %w", err)
 	}
 
 	// 5. Monitor upgrade progress with timeout
+	pollInterval := e.statusInterval
+	if job.UpgradePollInterval > 0 {
+		pollInterval = time.Duration(job.UpgradePollInterval) * time.Second
+	}
 	timeout := time.After(e.config.JobTimeout)
-	ticker := time.NewTicker(10 * time.Second)
+	ticker := time.NewTicker(pollInterval)
 	defer ticker.Stop()
 
-	log.Info().
-		Str("mac", job.MACAddress).
+	logger.Info().
 		Dur("timeout", e.config.JobTimeout).
+		Dur("poll_interval", pollInterval).
 		Msg("Monitoring upgrade progress")
 
+	expected := extractFirmwareVersion(job.FirmwareFilename)
+	lastVersion := ""
+
 	for {
 		select {
 		case <-ctx.Done():
-			return fmt.Errorf("context cancelled during upgrade")
+			return false, fmt.Errorf("context cancelled during upgrade")
 
 		case <-timeout:
-			return fmt.Errorf("upgrade timeout after %v", e.config.JobTimeout)
+			return false, fmt.Errorf("upgrade timeout after %v", e.config.JobTimeout)
 
 		case <-ticker.C:
-			status, err := client.CheckUpgradeStatus()
+			progress, err := client.CheckUpgradeProgress()
 			if err != nil {
-				log.Warn().
+				logger.Warn().
 					Err(err).
-					Str("mac", job.MACAddress).
 					Msg("Failed to check upgrade status, will retry")
 				continue
 			}
+			status := progress.Status
 
-			log.Debug().
-				Str("mac", job.MACAddress).
+			logger.Debug().
 				Str("status", status).
+				Str("current_version", progress.CurrentVersion).
 				Msg("Upgrade status check")
 
+			// Publish version flips so the UI can follow the modem in real
+			// time. A flip to the target version confirms the upgrade even
+			// if oper-status hasn't caught up yet.
+			if progress.CurrentVersion != "" && progress.CurrentVersion != lastVersion {
+				versionChanged := lastVersion != ""
+				lastVersion = progress.CurrentVersion
+				e.publish(JobEvent{
+					JobID:          job.ID,
+					MAC:            job.MACAddress,
+					Status:         job.Status,
+					CurrentVersion: progress.CurrentVersion,
+				})
+
+				if versionChanged && status != "failed" && firmwareMatches(progress.CurrentVersion, expected) {
+					logger.Info().
+						Str("current_version", progress.CurrentVersion).
+						Msg("Device now running target version, verifying firmware")
+					return false, e.verifyFirmware(ctx, job, modem, community)
+				}
+			}
+
 			switch status {
 			case "completed":
-				log.Info().
-					Str("mac", job.MACAddress).
-					Msg("Firmware upgrade completed successfully")
-				return nil
+				logger.Info().
+					Msg("Device reported upgrade complete, verifying firmware")
+				return false, e.verifyFirmware(ctx, job, modem, community)
 
 			case "failed":
-				return fmt.Errorf("firmware upgrade failed on device")
+				return false, fmt.Errorf("firmware upgrade failed on device")
 
 			case "in_progress":
-				log.Debug().
-					Str("mac", job.MACAddress).
+				logger.Debug().
 					Msg("Upgrade still in progress")
 				// Continue monitoring
 
+			case "rebooting":
+				logger.Debug().
+					Msg("Modem rebooting, waiting for upgrade status")
+
 			default:
-				log.Warn().
-					Str("mac", job.MACAddress).
+				logger.Warn().
 					Str("status", status).
 					Msg("Unknown upgrade status")
 			}
@@ -563,12 +2201,139 @@ func (e *Engine) executeUpgrade(ctx context.Context, job *models.UpgradeJob) err
 	}
 }
 
+// verifyFirmwareExists probes the job's TFTP server for the firmware file when
+// the verify_firmware_exists setting is on. Only a definite file-not-found
+// fails the job; an unreachable or unhelpful server is logged and ignored so
+// the modem still gets a chance to fetch the file itself. Jobs fetching over
+// HTTP aren't probed, since their server needn't speak TFTP.
+func (e *Engine) verifyFirmwareExists(job *models.UpgradeJob) error {
+	if job.TransportProtocol == models.TransportHTTP {
+		return nil
+	}
+	if value, err := e.db.GetSetting("verify_firmware_exists"); err == nil {
+		if enabled, err := strconv.ParseBool(value); err == nil && !enabled {
+			return nil
+		}
+	}
+
+	err := e.probeFirmware(job.TFTPServerIP, job.FirmwareFilename)
+	if err == tftp.ErrFileNotFound {
+		return fmt.Errorf("%w: %s", err, job.FirmwareFilename)
+	}
+	if err != nil {
+		logger := jobLogger(job)
+		logger.Warn().
+			Err(err).
+			Str("tftp_server", job.TFTPServerIP).
+			Str("firmware", job.FirmwareFilename).
+			Msg("Could not verify firmware on TFTP server, continuing")
+	}
+
+	return nil
+}
+
+// verifyFirmware confirms the modem came back on the target firmware and
+// records what it is actually running
+func (e *Engine) verifyFirmware(ctx context.Context, job *models.UpgradeJob, modem *models.CableModem, community string) error {
+	logger := jobLogger(job)
+
+	expected := extractFirmwareVersion(job.FirmwareFilename)
+	if expected == "" {
+		logger.Warn().
+			Str("firmware", job.FirmwareFilename).
+			Msg("Cannot determine target version from filename, skipping verification")
+		return nil
+	}
+
+	deadline := time.After(e.config.VerifyGracePeriod)
+	var observed, sysDescr string
+	var lastErr error
+
+	for {
+		// The modem usually reboots after flashing, so reconnect each attempt
+		client, err := e.connectModem(modem.IPAddress, community, 161)
+		if err == nil {
+			sysDescr, observed, err = client.GetModemFirmware()
+			client.Close()
+		}
+		lastErr = err
+
+		if err == nil && observed != "" {
+			if firmwareMatches(observed, expected) {
+				e.recordObservedFirmware(modem, sysDescr, observed)
+				e.setExpectedFirmware(modem, observed)
+				logger.Info().
+					Str("firmware", observed).
+					Msg("Firmware upgrade verified")
+				return nil
+			}
+			logger.Debug().
+				Str("observed", observed).
+				Str("expected", expected).
+				Msg("Modem not yet on target firmware")
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("context cancelled during firmware verification")
+		case <-deadline:
+			if observed != "" {
+				e.recordObservedFirmware(modem, sysDescr, observed)
+				return fmt.Errorf("upgrade reported complete but modem still on %s (expected %s)", observed, expected)
+			}
+			if lastErr != nil {
+				return fmt.Errorf("upgrade reported complete but firmware could not be verified: %w", lastErr)
+			}
+			return fmt.Errorf("upgrade reported complete but modem did not report a firmware version")
+		case <-time.After(e.verifyInterval):
+		}
+	}
+}
+
+// setExpectedFirmware records the firmware a modem is supposed to run so
+// later discoveries can be checked for drift
+func (e *Engine) setExpectedFirmware(modem *models.CableModem, firmware string) {
+	if err := e.db.SetModemExpectedFirmware(modem.ID, firmware); err != nil {
+		log.Warn().
+			Err(err).
+			Str("mac", modem.MACAddress).
+			Str("firmware", firmware).
+			Msg("Failed to record expected firmware")
+		return
+	}
+	modem.ExpectedFirmware = firmware
+}
+
+// recordObservedFirmware stores the firmware a modem reported after an upgrade
+func (e *Engine) recordObservedFirmware(modem *models.CableModem, sysDescr, firmware string) {
+	modem.SysDescr = sysDescr
+	modem.CurrentFirmware = firmware
+	if err := e.db.UpsertModem(modem); err != nil {
+		log.Warn().
+			Err(err).
+			Str("mac", modem.MACAddress).
+			Msg("Failed to record observed firmware")
+	}
+}
+
+// retryJitter scales backoff by a random factor in [0.5, 1.5) unless the
+// retry_jitter setting is off, so jobs that failed together, say during a
+// TFTP outage, don't all retry at the same moment
+func (e *Engine) retryJitter(backoff time.Duration) time.Duration {
+	if value, err := e.db.GetSetting("retry_jitter"); err == nil {
+		if enabled, err := strconv.ParseBool(value); err == nil && !enabled {
+			return backoff
+		}
+	}
+	return time.Duration(float64(backoff) * (0.5 + rand.Float64()))
+}
+
 // handleJobFailure handles job failures with exponential backoff retry logic
 func (e *Engine) handleJobFailure(job *models.UpgradeJob, err error) error {
-	log.Error().
+	logger := jobLogger(job)
+
+	logger.Error().
 		Err(err).
-		Int("job_id", job.ID).
-		Str("mac", job.MACAddress).
 		Int("retry_count", job.RetryCount).
 		Int("max_retries", job.MaxRetries).
 		Msg("Job failed")
@@ -577,21 +2342,42 @@ func (e *Engine) handleJobFailure(job *models.UpgradeJob, err error) error {
 	job.ErrorMessage = &errMsg
 	job.RetryCount++
 
-	// Check if we should retry
-	if job.RetryCount < job.MaxRetries {
+	failure := models.JobFailure{
+		Attempt: job.RetryCount,
+		At:      time.Now(),
+		Error:   errMsg,
+	}
+	if cause := rootCause(err); cause.Error() != errMsg {
+		failure.Cause = cause.Error()
+	}
+	if recordErr := e.db.AppendJobFailure(job.ID, failure); recordErr != nil {
+		logger.Error().Err(recordErr).Msg("Failed to record job failure details")
+	}
+
+	// Check if we should retry. RetryCount now counts failed attempts, and
+	// a job gets MaxRetries attempts after its first.
+	if job.RetryCount <= job.MaxRetries && !e.spendRetry(job.CMTSID) {
+		return e.failRetryBudgetExhausted(job, err)
+	}
+	if job.RetryCount <= job.MaxRetries {
 		// Calculate exponential backoff delay: 30s, 60s, 120s, 240s...
 		backoffSeconds := 30 * (1 << uint(job.RetryCount-1))
 		if backoffSeconds > 300 {
 			backoffSeconds = 300 // Cap at 5 minutes
 		}
-		retryAfter := time.Now().Add(time.Duration(backoffSeconds) * time.Second)
+		backoff := e.retryJitter(time.Duration(backoffSeconds) * time.Second)
+		backoffSeconds = int(backoff / time.Second)
+		retryAfter := time.Now().Add(backoff)
 
-		// Reset to pending for retry
+		// Reset to pending, held back until the backoff has elapsed
 		job.Status = models.JobStatusPending
 		job.StartedAt = nil
+		job.NextRetryAt = &retryAfter
 
 		if updateErr := e.db.UpdateJob(job); updateErr != nil {
-			log.Error().Err(updateErr).Msg("Failed to update job for retry")
+			logger.Error().Err(updateErr).Msg("Failed to update job for retry")
+		} else {
+			e.publishJobEvent(job)
 		}
 
 		// Log retry attempt with backoff time
@@ -599,12 +2385,10 @@ func (e *Engine) handleJobFailure(job *models.UpgradeJob, err error) error {
 			EventType:  models.EventUpgradeFailed,
 			EntityType: "job",
 			EntityID:   job.ID,
-			Message:    fmt.Sprintf("Upgrade failed for modem %s, will retry in %ds (attempt %d/%d): %v", job.MACAddress, backoffSeconds, job.RetryCount, job.MaxRetries, err),
+			Message:    fmt.Sprintf("Upgrade failed for modem %s, will retry in %ds (retry %d/%d): %v", job.MACAddress, backoffSeconds, job.RetryCount, job.MaxRetries, err),
 		})
 
-		log.Info().
-			Int("job_id", job.ID).
-			Str("mac", job.MACAddress).
+		logger.Info().
 			Int("retry_count", job.RetryCount).
 			Int("backoff_seconds", backoffSeconds).
 			Time("retry_after", retryAfter).
@@ -615,14 +2399,17 @@ func (e *Engine) handleJobFailure(job *models.UpgradeJob, err error) error {
 		return nil
 	}
 
-	// Max retries exceeded, mark as failed
+	// Max retries exceeded, mark as failed and park it in the dead-letter queue
 	failed := time.Now()
 	job.Status = models.JobStatusFailed
 	job.CompletedAt = &failed
+	job.NextRetryAt = nil
+	job.DeadLetter = true
 
 	if updateErr := e.db.UpdateJob(job); updateErr != nil {
 		return fmt.Errorf("failed to mark job as failed: %w", updateErr)
 	}
+	e.publishJobEvent(job)
 
 	// Log final failure
 	e.db.LogActivity(&models.ActivityLog{
@@ -631,22 +2418,121 @@ func (e *Engine) handleJobFailure(job *models.UpgradeJob, err error) error {
 		EntityID:   job.ID,
 		Message:    fmt.Sprintf("Upgrade permanently failed for modem %s after %d attempts: %v", job.MACAddress, job.RetryCount, err),
 	})
+	e.notifier.notifyJob(models.EventUpgradeFailed, job)
+
+	return fmt.Errorf("job failed after %d attempts: %w", job.RetryCount, err)
+}
+
+// rootCause returns the innermost error wrapped by err
+func rootCause(err error) error {
+	for {
+		next := errors.Unwrap(err)
+		if next == nil {
+			return err
+		}
+		err = next
+	}
+}
+
+// spendRetry takes one retry from the fleet and per-CMTS budgets, reporting
+// false without spending anything if either is exhausted. Exhausting a budget
+// raises an alert the first time it happens.
+func (e *Engine) spendRetry(cmtsID int) bool {
+	e.retryBudgetMu.Lock()
+	defer e.retryBudgetMu.Unlock()
+
+	var cmtsBudget *retryBudget
+	if e.config.RetryBudgetPerCMTS > 0 {
+		cmtsBudget = e.cmtsRetryBudgets[cmtsID]
+		if cmtsBudget == nil {
+			cmtsBudget = newRetryBudget(e.config.RetryBudgetPerCMTS, e.config.RetryBudgetWindow)
+			e.cmtsRetryBudgets[cmtsID] = cmtsBudget
+		}
+	}
+
+	now := time.Now()
+	if e.retryBudget != nil && !e.retryBudget.available(now) {
+		if !e.retryBudget.alerted {
+			e.retryBudget.alerted = true
+			e.alertRetryBudgetExhausted("system", 0,
+				fmt.Sprintf("Fleet retry budget exhausted: %d retries in %v, further failures will not be retried",
+					e.retryBudget.max, e.retryBudget.window))
+		}
+		return false
+	}
+	if cmtsBudget != nil && !cmtsBudget.available(now) {
+		if !cmtsBudget.alerted {
+			cmtsBudget.alerted = true
+			e.alertRetryBudgetExhausted("cmts", cmtsID,
+				fmt.Sprintf("Retry budget exhausted for CMTS %d: %d retries in %v, further failures will not be retried",
+					cmtsID, cmtsBudget.max, cmtsBudget.window))
+		}
+		return false
+	}
+
+	if e.retryBudget != nil {
+		e.retryBudget.spend(now)
+	}
+	if cmtsBudget != nil {
+		cmtsBudget.spend(now)
+	}
+	return true
+}
+
+func (e *Engine) alertRetryBudgetExhausted(entityType string, entityID int, message string) {
+	log.Warn().
+		Str("scope", entityType).
+		Int("cmts_id", entityID).
+		Msg(message)
+
+	e.db.LogActivity(&models.ActivityLog{
+		EventType:  models.EventRetryBudgetExhausted,
+		EntityType: entityType,
+		EntityID:   entityID,
+		Message:    message,
+	})
+}
+
+// failRetryBudgetExhausted marks a job FAILED without retrying because the
+// retry budget has run out
+func (e *Engine) failRetryBudgetExhausted(job *models.UpgradeJob, err error) error {
+	errMsg := fmt.Sprintf("retry budget exhausted: %v", err)
+	failed := time.Now()
+	job.ErrorMessage = &errMsg
+	job.Status = models.JobStatusFailed
+	job.CompletedAt = &failed
+	job.NextRetryAt = nil
+	job.DeadLetter = true
+
+	if updateErr := e.db.UpdateJob(job); updateErr != nil {
+		return fmt.Errorf("failed to mark job as failed: %w", updateErr)
+	}
+	e.publishJobEvent(job)
+
+	e.db.LogActivity(&models.ActivityLog{
+		EventType:  models.EventUpgradeFailed,
+		EntityType: "job",
+		EntityID:   job.ID,
+		Message:    fmt.Sprintf("Upgrade failed for modem %s, not retrying because the retry budget is exhausted: %v", job.MACAddress, err),
+	})
+	e.notifier.notifyJob(models.EventUpgradeFailed, job)
 
-	return fmt.Errorf("job failed after %d retries: %w", job.RetryCount, err)
+	return fmt.Errorf("job failed, retry budget exhausted: %w", err)
 }
 
 // discoveryScheduler periodically discovers modems on all enabled CMTS
 func (e *Engine) discoveryScheduler(ctx context.Context) {
-	// Use poll interval for discovery (configurable)
-	ticker := time.NewTicker(e.config.PollInterval)
+	interval := clampInterval("discovery", e.config.DiscoveryInterval)
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	log.Info().
-		Dur("interval", e.config.PollInterval).
+		Dur("interval", interval).
 		Msg("Discovery scheduler started")
 
 	// Run once immediately on startup
-	e.runDiscoveryForAllCMTS()
+	e.runDiscoveryForAllCMTS(ctx)
+	e.heartbeat("discovery")
 
 	for {
 		select {
@@ -654,15 +2540,15 @@ func (e *Engine) discoveryScheduler(ctx context.Context) {
 			log.Info().Msg("Discovery scheduler stopping")
 			return
 		case <-ticker.C:
-			e.runDiscoveryForAllCMTS()
+			e.heartbeat("discovery")
+			e.runDiscoveryForAllCMTS(ctx)
 		}
 	}
 }
 
 // ruleEvaluationScheduler periodically evaluates upgrade rules
 func (e *Engine) ruleEvaluationScheduler(ctx context.Context) {
-	// Evaluate rules twice as often as discovery
-	interval := e.config.PollInterval * 2
+	interval := clampInterval("evaluation", e.config.EvaluationInterval)
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
@@ -671,12 +2557,19 @@ func (e *Engine) ruleEvaluationScheduler(ctx context.Context) {
 		Msg("Rule evaluation scheduler started")
 
 	// Wait a bit after startup to let initial discovery complete
-	time.Sleep(30 * time.Second)
+	select {
+	case <-ctx.Done():
+		log.Info().Msg("Rule evaluation scheduler stopping")
+		return
+	case <-time.After(e.config.InitialEvaluationDelay):
+	}
 
 	// Run once after initial delay
 	if err := e.EvaluateRules(); err != nil {
 		log.Error().Err(err).Msg("Initial rule evaluation failed")
 	}
+	e.lastEvaluationCycle.Store(time.Now().UnixNano())
+	e.heartbeat("rules")
 
 	for {
 		select {
@@ -684,21 +2577,40 @@ func (e *Engine) ruleEvaluationScheduler(ctx context.Context) {
 			log.Info().Msg("Rule evaluation scheduler stopping")
 			return
 		case <-ticker.C:
+			e.heartbeat("rules")
 			if err := e.EvaluateRules(); err != nil {
 				log.Error().Err(err).Msg("Rule evaluation failed")
 			}
+			e.lastEvaluationCycle.Store(time.Now().UnixNano())
 		}
 	}
 }
 
-// runDiscoveryForAllCMTS runs discovery for all enabled CMTS devices
-func (e *Engine) runDiscoveryForAllCMTS() {
+// clampInterval raises a non-positive scheduler interval to
+// minSchedulerInterval, warning that it did
+func clampInterval(scheduler string, interval time.Duration) time.Duration {
+	if interval > 0 {
+		return interval
+	}
+	log.Warn().
+		Str("scheduler", scheduler).
+		Dur("configured", interval).
+		Dur("using", minSchedulerInterval).
+		Msg("Scheduler interval must be positive, using the minimum")
+	return minSchedulerInterval
+}
+
+// runDiscoveryForAllCMTS runs discovery for all enabled CMTS devices. Walks
+// still waiting for a slot when ctx is done are dropped.
+func (e *Engine) runDiscoveryForAllCMTS(ctx context.Context) {
 	cmtsList, err := e.db.ListCMTS()
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to list CMTS for discovery")
 		return
 	}
 
+	// cycle tracks this round of walks so its completion can be recorded
+	var cycle sync.WaitGroup
 	discoveryCount := 0
 	for _, cmts := range cmtsList {
 		if !cmts.Enabled {
@@ -708,8 +2620,39 @@ func (e *Engine) runDiscoveryForAllCMTS() {
 			continue
 		}
 
-		// Run discovery in goroutine to avoid blocking
+		// Run discovery in goroutine to avoid blocking; Shutdown waits
+		// for these along with the schedulers
+		e.schedulerWG.Add(1)
+		cycle.Add(1)
 		go func(id int, name string) {
+			defer e.schedulerWG.Done()
+			defer cycle.Done()
+			if e.discoverySem != nil {
+				if !e.discoverySem.TryAcquire() {
+					log.Info().
+						Int("cmts_id", id).
+						Str("cmts", name).
+						Msg("Discovery queued, waiting for a free slot")
+					if e.discoverySem.Acquire(ctx) != nil {
+						return
+					}
+				}
+				defer e.discoverySem.Release()
+			}
+			if e.snmpBudget != nil {
+				if !e.snmpBudget.TryAcquire(false) {
+					log.Info().
+						Int("cmts_id", id).
+						Str("cmts", name).
+						Str("policy", e.config.SchedulingPolicy).
+						Msg("Discovery throttled, waiting for SNMP budget")
+					if e.snmpBudget.Acquire(ctx, false) != nil {
+						return
+					}
+				}
+				defer e.snmpBudget.Release(false)
+			}
+
 			log.Info().
 				Int("cmts_id", id).
 				Str("cmts", name).
@@ -732,6 +2675,13 @@ func (e *Engine) runDiscoveryForAllCMTS() {
 			Int("cmts_count", discoveryCount).
 			Msg("Triggered discovery for all enabled CMTS")
 	}
+
+	e.schedulerWG.Add(1)
+	go func() {
+		defer e.schedulerWG.Done()
+		cycle.Wait()
+		e.lastDiscoveryCycle.Store(time.Now().UnixNano())
+	}()
 }
 
 // cleanupScheduler periodically cleans up stale modems
@@ -744,6 +2694,7 @@ func (e *Engine) cleanupScheduler(ctx context.Context) {
 			"cleanup_interval":        "3600",
 			"cleanup_offline_minutes": "10",
 			"cleanup_delete_days":     "7",
+			"job_retention_days":      "90",
 		}
 	}
 
@@ -752,15 +2703,17 @@ func (e *Engine) cleanupScheduler(ctx context.Context) {
 		cleanupInterval = val
 	}
 
-	ticker := time.NewTicker(time.Duration(cleanupInterval) * time.Second)
+	interval := clampInterval("cleanup", time.Duration(cleanupInterval)*time.Second)
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	log.Info().
-		Int("interval_seconds", cleanupInterval).
+		Dur("interval", interval).
 		Msg("Cleanup scheduler started")
 
 	// Run once immediately on startup
 	e.runCleanup()
+	e.heartbeat("cleanup")
 
 	for {
 		select {
@@ -768,12 +2721,14 @@ func (e *Engine) cleanupScheduler(ctx context.Context) {
 			log.Info().Msg("Cleanup scheduler stopping")
 			return
 		case <-ticker.C:
+			e.heartbeat("cleanup")
 			e.runCleanup()
 		}
 	}
 }
 
-// runCleanup marks stale modems as offline and deletes very old modems
+// runCleanup marks stale modems as offline, deletes very old modems and
+// purges job history past the retention period
 func (e *Engine) runCleanup() {
 	// Get cleanup thresholds from settings
 	settings, err := e.db.ListSettings()
@@ -782,16 +2737,30 @@ func (e *Engine) runCleanup() {
 		return
 	}
 
-	offlineMinutes := 10 // default
-	if val, err := strconv.Atoi(settings["cleanup_offline_minutes"]); err == nil {
-		offlineMinutes = val
-	}
+	// Shared with the API's is_stale flag
+	offlineMinutes := int(models.ModemStaleThreshold(settings["cleanup_offline_minutes"]) / time.Minute)
 
 	deleteDays := 7 // default
 	if val, err := strconv.Atoi(settings["cleanup_delete_days"]); err == nil {
 		deleteDays = val
 	}
 
+	retentionDays := 90 // default
+	if val, err := strconv.Atoi(settings["job_retention_days"]); err == nil {
+		retentionDays = val
+	}
+	if retentionDays > 0 {
+		e.purgeHistory(time.Duration(retentionDays) * 24 * time.Hour)
+	}
+
+	signalDays := 7 // default
+	if val, err := strconv.Atoi(settings["signal_history_days"]); err == nil {
+		signalDays = val
+	}
+	if signalDays > 0 {
+		e.purgeSignalHistory(time.Duration(signalDays) * 24 * time.Hour)
+	}
+
 	markedOffline, deleted, err := e.db.CleanupStaleModems(offlineMinutes, deleteDays)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to cleanup stale modems")
@@ -826,3 +2795,50 @@ func (e *Engine) runCleanup() {
 		}
 	}
 }
+
+// purgeSignalHistory deletes modem signal readings older than retention
+func (e *Engine) purgeSignalHistory(retention time.Duration) {
+	readings, err := e.db.PurgeOldSignalHistory(retention)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to purge old signal history")
+		return
+	}
+	if readings > 0 {
+		log.Info().
+			Int("readings_purged", readings).
+			Dur("retention", retention).
+			Msg("Signal history purge completed")
+	}
+}
+
+// purgeHistory deletes finished jobs and activity logs older than retention
+func (e *Engine) purgeHistory(retention time.Duration) {
+	jobs, err := e.db.PurgeOldJobs(retention)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to purge old jobs")
+		return
+	}
+
+	logs, err := e.db.PurgeOldActivityLogs(retention)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to purge old activity logs")
+		return
+	}
+
+	if jobs == 0 && logs == 0 {
+		return
+	}
+
+	log.Info().
+		Int("jobs_purged", jobs).
+		Int("logs_purged", logs).
+		Dur("retention", retention).
+		Msg("Job history purge completed")
+
+	e.db.LogActivity(&models.ActivityLog{
+		EventType:  models.EventSystemEvent,
+		EntityType: "system",
+		EntityID:   0,
+		Message:    fmt.Sprintf("Purged %d jobs and %d activity logs older than %d days", jobs, logs, int(retention.Hours()/24)),
+	})
+}
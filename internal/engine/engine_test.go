@@ -2,12 +2,23 @@ package engine
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/awksedgreep/firmware-upgrader/internal/database"
 	"github.com/awksedgreep/firmware-upgrader/internal/models"
+	"github.com/awksedgreep/firmware-upgrader/internal/snmp"
+	"github.com/awksedgreep/firmware-upgrader/internal/tftp"
 )
 
 func TestEngineNew(t *testing.T) {
@@ -68,6 +79,79 @@ func TestEngineWithDefaultMaxPerCMTS(t *testing.T) {
 	}
 }
 
+func TestEngineIntervalDefaults(t *testing.T) {
+	db, err := database.NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	for _, tt := range []struct {
+		name                            string
+		config                          Config
+		schedule, discovery, evaluation time.Duration
+	}{
+		{"nothing set", Config{}, time.Minute, time.Minute, 2 * time.Minute},
+		{"poll interval only", Config{PollInterval: 30 * time.Second}, 30 * time.Second, 30 * time.Second, time.Minute},
+		{"discovery only", Config{DiscoveryInterval: 5 * time.Minute}, time.Minute, 5 * time.Minute, 10 * time.Minute},
+		{"all set", Config{
+			PollInterval:       time.Hour,
+			ScheduleInterval:   10 * time.Second,
+			DiscoveryInterval:  15 * time.Minute,
+			EvaluationInterval: 20 * time.Minute,
+		}, 10 * time.Second, 15 * time.Minute, 20 * time.Minute},
+	} {
+		engine := New(db, tt.config)
+		if got := engine.config.ScheduleInterval; got != tt.schedule {
+			t.Errorf("%s: expected schedule interval %v, got %v", tt.name, tt.schedule, got)
+		}
+		if got := engine.config.DiscoveryInterval; got != tt.discovery {
+			t.Errorf("%s: expected discovery interval %v, got %v", tt.name, tt.discovery, got)
+		}
+		if got := engine.config.EvaluationInterval; got != tt.evaluation {
+			t.Errorf("%s: expected evaluation interval %v, got %v", tt.name, tt.evaluation, got)
+		}
+	}
+}
+
+func TestEngineStartWithZeroIntervals(t *testing.T) {
+	db, err := database.NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.SetSetting("cleanup_interval", "0"); err != nil {
+		t.Fatalf("Failed to set cleanup interval: %v", err)
+	}
+
+	engine := New(db, Config{Workers: 1})
+	engine.config.ScheduleInterval = 0
+	engine.config.DiscoveryInterval = 0
+	engine.config.EvaluationInterval = -time.Second
+
+	if got := clampInterval("test", 0); got != minSchedulerInterval {
+		t.Errorf("Expected zero interval to be clamped to %v, got %v", minSchedulerInterval, got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		engine.Start(ctx)
+		close(done)
+	}()
+
+	// A zero ticker would panic and take the test binary down with it
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Engine did not stop")
+	}
+}
+
 func TestGetCMTSSemaphore(t *testing.T) {
 	db, err := database.NewTestDB()
 	if err != nil {
@@ -106,17 +190,77 @@ func TestGetCMTSSemaphore(t *testing.T) {
 	}
 }
 
+func TestGetRuleSemaphore(t *testing.T) {
+	db, err := database.NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	engine := New(db, Config{Workers: 2, MaxPerCMTS: 3, PollInterval: 30 * time.Second})
+
+	if sem := engine.getRuleSemaphore(&models.UpgradeRule{ID: 1}); sem != nil {
+		t.Error("Unlimited rule should not get a semaphore")
+	}
+	if sem := engine.getRuleSemaphore(nil); sem != nil {
+		t.Error("Jobs without a rule should not get a semaphore")
+	}
+
+	rule := &models.UpgradeRule{ID: 1, MaxConcurrent: 2}
+	sem := engine.getRuleSemaphore(rule)
+	if sem == nil {
+		t.Fatal("Semaphore should not be nil")
+	}
+	if sem.Limit() != 2 {
+		t.Errorf("Expected limit 2, got %d", sem.Limit())
+	}
+	if engine.getRuleSemaphore(rule) != sem {
+		t.Error("Should return the same semaphore instance for same rule")
+	}
+
+	// Changing the limit resizes the semaphore in place, so running upgrades
+	// still count: with two held, a limit of 1 admits nobody
+	sem.TryAcquire()
+	sem.TryAcquire()
+	rule.MaxConcurrent = 1
+	if engine.getRuleSemaphore(rule) != sem || sem.Limit() != 1 {
+		t.Fatalf("Expected the semaphore resized to 1, got limit %d", sem.Limit())
+	}
+	sem.Release()
+	if sem.TryAcquire() {
+		t.Error("Expected no slot while the held upgrades exceed the new limit")
+	}
+	sem.Release()
+	if !sem.TryAcquire() {
+		t.Error("Expected a slot once the held upgrades are under the new limit")
+	}
+
+	// Growing it wakes a waiter
+	acquired := make(chan error, 1)
+	go func() { acquired <- sem.Acquire(context.Background()) }()
+	rule.MaxConcurrent = 2
+	engine.getRuleSemaphore(rule)
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Errorf("Acquire() error = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("Expected a waiter admitted after the limit grew")
+	}
+}
+
 func TestSemaphoreAcquireRelease(t *testing.T) {
 	sem := newSemaphore(2)
 
 	// Acquire twice (should not block)
-	sem.Acquire()
-	sem.Acquire()
+	sem.Acquire(context.Background())
+	sem.Acquire(context.Background())
 
 	// Try to acquire in goroutine (should block)
 	acquired := make(chan bool, 1)
 	go func() {
-		sem.Acquire()
+		sem.Acquire(context.Background())
 		acquired <- true
 	}()
 
@@ -176,6 +320,170 @@ func TestDiscoverModems(t *testing.T) {
 	}
 }
 
+func TestOUITableLookup(t *testing.T) {
+	table := DefaultOUITable()
+
+	tests := []struct {
+		mac    string
+		vendor string
+	}{
+		{"00:01:5C:11:22:33", "ARRIS"},
+		{"00-01-5c-11-22-33", "ARRIS"},
+		{"0001.5c11.2233", "ARRIS"},
+		{"00:05:CA:00:00:01", "Hitron"},
+		{"AA:BB:CC:DD:EE:FF", ""},
+		{"00:01", ""},
+		{"not a mac", ""},
+	}
+	for _, tt := range tests {
+		if got := table.Lookup(tt.mac); got != tt.vendor {
+			t.Errorf("Lookup(%q) = %q, expected %q", tt.mac, got, tt.vendor)
+		}
+	}
+}
+
+func TestLoadOUIFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "oui.txt")
+	contents := "# local additions\n\nAA-BB-CC   Lab Modems Inc\n00:01:5C ARRIS Group\n"
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatalf("Failed to write OUI file: %v", err)
+	}
+
+	table, err := LoadOUIFile(path)
+	if err != nil {
+		t.Fatalf("LoadOUIFile failed: %v", err)
+	}
+	if got := table.Lookup("aa:bb:cc:00:00:01"); got != "Lab Modems Inc" {
+		t.Errorf("Expected added vendor, got %q", got)
+	}
+	if got := table.Lookup("00:01:5C:11:22:33"); got != "ARRIS Group" {
+		t.Errorf("Expected overridden vendor, got %q", got)
+	}
+	if got := table.Lookup("00:05:CA:00:00:01"); got != "Hitron" {
+		t.Errorf("Expected built-in vendor kept, got %q", got)
+	}
+	if DefaultOUITable().Lookup("00:01:5C:11:22:33") != "ARRIS" {
+		t.Error("Loading a file should not change the built-in table")
+	}
+
+	if err := os.WriteFile(path, []byte("AA:BB:CC\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write OUI file: %v", err)
+	}
+	if _, err := LoadOUIFile(path); err == nil {
+		t.Error("Expected error for a line without a vendor")
+	}
+}
+
+func TestOUICache(t *testing.T) {
+	db, err := database.NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	var cache ouiCache
+	if got := cache.load(db).Lookup("00:01:5C:11:22:33"); got != "ARRIS" {
+		t.Errorf("Expected built-in table by default, got %q", got)
+	}
+
+	path := filepath.Join(t.TempDir(), "oui.txt")
+	if err := os.WriteFile(path, []byte("AA:BB:CC Lab Modems Inc\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write OUI file: %v", err)
+	}
+	modTime := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("Failed to set OUI file mtime: %v", err)
+	}
+	if err := db.SetSetting("oui_file", path); err != nil {
+		t.Fatalf("Failed to set oui_file: %v", err)
+	}
+	if got := cache.load(db).Lookup("AA:BB:CC:00:00:01"); got != "Lab Modems Inc" {
+		t.Errorf("Expected vendor from oui_file, got %q", got)
+	}
+
+	// The file is only re-read once its mtime changes
+	if err := os.WriteFile(path, []byte("AA:BB:CC Renamed Modems\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write OUI file: %v", err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("Failed to set OUI file mtime: %v", err)
+	}
+	if got := cache.load(db).Lookup("AA:BB:CC:00:00:01"); got != "Lab Modems Inc" {
+		t.Errorf("Expected cached vendor while mtime is unchanged, got %q", got)
+	}
+	if err := os.Chtimes(path, time.Now(), time.Now()); err != nil {
+		t.Fatalf("Failed to set OUI file mtime: %v", err)
+	}
+	if got := cache.load(db).Lookup("AA:BB:CC:00:00:01"); got != "Renamed Modems" {
+		t.Errorf("Expected vendor reloaded after mtime change, got %q", got)
+	}
+
+	// A missing file falls back to the built-in table
+	if err := db.SetSetting("oui_file", filepath.Join(t.TempDir(), "missing.txt")); err != nil {
+		t.Fatalf("Failed to set oui_file: %v", err)
+	}
+	table := cache.load(db)
+	if table.Lookup("AA:BB:CC:00:00:01") != "" || table.Lookup("00:01:5C:11:22:33") != "ARRIS" {
+		t.Error("Expected built-in table when oui_file can't be read")
+	}
+}
+
+func TestTestCMTSConnection(t *testing.T) {
+	db, err := database.NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	engine := New(db, Config{Workers: 1, MaxPerCMTS: 5, PollInterval: 30 * time.Second})
+
+	cmts := &models.CMTS{
+		Name:          "Lab CMTS",
+		IPAddress:     "192.0.2.10",
+		SNMPPort:      161,
+		CommunityRead: "public",
+		SNMPVersion:   2,
+	}
+
+	var probedTimeout time.Duration
+	engine.probeCMTS = func(c *models.CMTS, timeout time.Duration) (string, error) {
+		probedTimeout = timeout
+		return "Cisco cBR-8 IOS-XE 16.12", nil
+	}
+
+	result, err := engine.TestCMTSConnection(cmts)
+	if err != nil {
+		t.Fatalf("TestCMTSConnection failed: %v", err)
+	}
+	if !result.Success || result.SysDescr != "Cisco cBR-8 IOS-XE 16.12" {
+		t.Errorf("Expected success with sysDescr, got %+v", result)
+	}
+	if probedTimeout != cmtsTestTimeout {
+		t.Errorf("Expected probe timeout %s, got %s", cmtsTestTimeout, probedTimeout)
+	}
+
+	engine.probeCMTS = func(c *models.CMTS, timeout time.Duration) (string, error) {
+		return "", &snmp.ProbeError{Kind: snmp.ProbeTimeout, Err: fmt.Errorf("no response")}
+	}
+
+	result, err = engine.TestCMTSConnection(cmts)
+	if err != nil {
+		t.Fatalf("TestCMTSConnection failed: %v", err)
+	}
+	if result.Success {
+		t.Error("Expected failed result")
+	}
+	if result.ErrorKind != snmp.ProbeTimeout || result.Error != "no response" {
+		t.Errorf("Expected timeout error, got kind %q error %q", result.ErrorKind, result.Error)
+	}
+
+	// Settings too invalid to try never reach SNMP
+	cmts.CommunityRead = ""
+	if _, err := engine.TestCMTSConnection(cmts); err != models.ErrInvalidCommunity {
+		t.Errorf("Expected ErrInvalidCommunity, got %v", err)
+	}
+}
+
 func TestEvaluateRules(t *testing.T) {
 	db, err := database.NewTestDB()
 	if err != nil {
@@ -196,6 +504,16 @@ func TestEvaluateRules(t *testing.T) {
 
 	engine := New(db, config)
 
+	// Jobs take the rule's retry limit
+	rule, err := db.GetRule(1)
+	if err != nil {
+		t.Fatalf("Failed to get rule: %v", err)
+	}
+	rule.MaxRetries = 0
+	if err := db.UpdateRule(rule); err != nil {
+		t.Fatalf("Failed to update rule: %v", err)
+	}
+
 	// Evaluate rules
 	err = engine.EvaluateRules()
 	if err != nil {
@@ -221,214 +539,342 @@ func TestEvaluateRules(t *testing.T) {
 		if job.Status != models.JobStatusPending {
 			t.Errorf("Expected status PENDING, got %s", job.Status)
 		}
+		if job.MaxRetries != 0 {
+			t.Errorf("Expected the rule's max retries 0, got %d", job.MaxRetries)
+		}
+	}
+
+	// The rule assigns its firmware as the modem's expected firmware
+	modem, err := db.GetModem(1)
+	if err != nil {
+		t.Fatalf("Failed to get modem: %v", err)
+	}
+	if modem.ExpectedFirmware != "2.0.0" {
+		t.Errorf("Expected rule to assign expected firmware 2.0.0, got %q", modem.ExpectedFirmware)
 	}
 }
 
-func TestEvaluateRulesDeduplication(t *testing.T) {
+func TestEvaluateRulesCMTSAllowlist(t *testing.T) {
 	db, err := database.NewTestDB()
 	if err != nil {
 		t.Fatalf("Failed to create test database: %v", err)
 	}
 	defer db.Close()
 
-	// Load test fixtures
 	if err := db.LoadTestFixtures(); err != nil {
 		t.Fatalf("Failed to load fixtures: %v", err)
 	}
 
-	config := Config{
-		Workers:      2,
-		MaxPerCMTS:   5,
-		PollInterval: 30 * time.Second,
+	// Second CMTS with a modem that also matches the fixture rule
+	cmtsID, err := db.CreateCMTS(&models.CMTS{
+		Name:          "Pilot CMTS",
+		IPAddress:     "192.168.1.2",
+		SNMPPort:      161,
+		CommunityRead: "public",
+		SNMPVersion:   2,
+		Enabled:       true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create CMTS: %v", err)
+	}
+	err = db.UpsertModem(&models.CableModem{
+		CMTSID:          cmtsID,
+		MACAddress:      "00:01:5C:44:55:66",
+		IPAddress:       "10.0.1.100",
+		CurrentFirmware: "1.0.0",
+		SignalLevel:     3.0,
+		Status:          "online",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create modem: %v", err)
 	}
 
-	engine := New(db, config)
-
-	// Evaluate rules twice
-	err = engine.EvaluateRules()
-	if err != nil {
-		t.Fatalf("Failed to evaluate rules: %v", err)
+	if err := db.SetSetting("evaluation_cmts_allowlist", fmt.Sprintf("%d", cmtsID)); err != nil {
+		t.Fatalf("Failed to set allowlist: %v", err)
 	}
 
-	err = engine.EvaluateRules()
-	if err != nil {
-		t.Fatalf("Failed to evaluate rules second time: %v", err)
+	engine := New(db, Config{Workers: 1, PollInterval: 30 * time.Second})
+
+	if err := engine.EvaluateRules(); err != nil {
+		t.Fatalf("Failed to evaluate rules: %v", err)
 	}
 
-	// Should only have one job (deduplication)
-	jobs, err := db.ListJobs(models.JobStatusPending, 10)
+	jobs, err := db.ListJobs(models.JobStatusPending, 0)
 	if err != nil {
 		t.Fatalf("Failed to list jobs: %v", err)
 	}
 
 	if len(jobs) != 1 {
-		t.Errorf("Expected exactly 1 job (deduplication), got %d", len(jobs))
+		t.Fatalf("Expected 1 job for the allowlisted CMTS, got %d", len(jobs))
+	}
+	if jobs[0].CMTSID != cmtsID {
+		t.Errorf("Expected job on CMTS %d, got CMTS %d", cmtsID, jobs[0].CMTSID)
+	}
+
+	// A malformed allowlist fails closed
+	db.SetSetting("evaluation_cmts_allowlist", "1,two")
+	if err := engine.EvaluateRules(); err == nil {
+		t.Error("Expected error for malformed allowlist")
+	}
+
+	// So does an allowlist that can't be read
+	db.Close()
+	if allowlist, err := engine.loadCMTSAllowlist(); err == nil {
+		t.Errorf("Expected error when the allowlist can't be read, got %v", allowlist)
 	}
 }
 
-func TestRunDiscoveryForAllCMTS(t *testing.T) {
+func TestEvaluateRulesCMTSFirmwareCap(t *testing.T) {
 	db, err := database.NewTestDB()
 	if err != nil {
 		t.Fatalf("Failed to create test database: %v", err)
 	}
 	defer db.Close()
 
-	// Load test fixtures
 	if err := db.LoadTestFixtures(); err != nil {
 		t.Fatalf("Failed to load fixtures: %v", err)
 	}
 
-	config := Config{
-		Workers:      2,
-		MaxPerCMTS:   5,
-		PollInterval: 30 * time.Second,
+	// Pin the fixture CMTS below the rule's 2.0.0 target
+	capped, err := db.GetCMTS(1)
+	if err != nil {
+		t.Fatalf("Failed to get CMTS: %v", err)
+	}
+	capped.MaxFirmwareVersion = "1.5.0"
+	if err := db.UpdateCMTS(capped); err != nil {
+		t.Fatalf("Failed to update CMTS: %v", err)
 	}
 
-	engine := New(db, config)
+	// Second, uncapped CMTS with a modem that also matches the fixture rule
+	cmtsID, err := db.CreateCMTS(&models.CMTS{
+		Name:          "Uncapped CMTS",
+		IPAddress:     "192.168.1.2",
+		SNMPPort:      161,
+		CommunityRead: "public",
+		SNMPVersion:   2,
+		Enabled:       true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create CMTS: %v", err)
+	}
+	err = db.UpsertModem(&models.CableModem{
+		CMTSID:          cmtsID,
+		MACAddress:      "00:01:5C:44:55:66",
+		IPAddress:       "10.0.1.100",
+		CurrentFirmware: "1.0.0",
+		SignalLevel:     3.0,
+		Status:          "online",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create modem: %v", err)
+	}
 
-	// Run discovery (will fail without SNMP but should not panic)
-	engine.runDiscoveryForAllCMTS()
+	engine := New(db, Config{Workers: 1, PollInterval: 30 * time.Second})
 
-	// Verify no panic occurred
-	t.Log("Discovery completed without panic")
+	summary, err := engine.EvaluateRulesReport()
+	if err != nil {
+		t.Fatalf("Failed to evaluate rules: %v", err)
+	}
+	if summary.Skipped["cmts_firmware_cap"] != 1 {
+		t.Errorf("Expected 1 modem skipped by the firmware cap, got %d", summary.Skipped["cmts_firmware_cap"])
+	}
+
+	jobs, err := db.ListJobs(models.JobStatusPending, 0)
+	if err != nil {
+		t.Fatalf("Failed to list jobs: %v", err)
+	}
+	if len(jobs) != 1 {
+		t.Fatalf("Expected 1 job for the uncapped CMTS, got %d", len(jobs))
+	}
+	if jobs[0].CMTSID != cmtsID {
+		t.Errorf("Expected job on CMTS %d, got CMTS %d", cmtsID, jobs[0].CMTSID)
+	}
+
+	// Raising the cap to the target lets the capped CMTS through
+	capped.MaxFirmwareVersion = "2.0"
+	if err := db.UpdateCMTS(capped); err != nil {
+		t.Fatalf("Failed to update CMTS: %v", err)
+	}
+	if err := engine.EvaluateRules(); err != nil {
+		t.Fatalf("Failed to evaluate rules: %v", err)
+	}
+	jobs, _ = db.ListJobs(models.JobStatusPending, 0)
+	if len(jobs) != 2 {
+		t.Errorf("Expected 2 jobs after raising the cap, got %d", len(jobs))
+	}
 }
 
-func TestCheckPendingJobsDeduplication(t *testing.T) {
+func TestEvaluateRulesExcludeRule(t *testing.T) {
 	db, err := database.NewTestDB()
 	if err != nil {
 		t.Fatalf("Failed to create test database: %v", err)
 	}
 	defer db.Close()
 
-	// Load test fixtures
 	if err := db.LoadTestFixtures(); err != nil {
 		t.Fatalf("Failed to load fixtures: %v", err)
 	}
 
-	// Create a job
-	jobID, err := db.CreateJob(&models.UpgradeJob{
-		ModemID:          1,
-		RuleID:           1,
-		CMTSID:           1,
-		MACAddress:       "00:01:5C:11:22:33",
-		Status:           models.JobStatusInProgress,
-		TFTPServerIP:     "192.168.1.50",
-		FirmwareFilename: "firmware-v2.0.0.bin",
-		MaxRetries:       3,
+	// Lab modem that also matches the fixture rule's vendor range
+	err = db.UpsertModem(&models.CableModem{
+		CMTSID:          1,
+		MACAddress:      "00:01:5C:AA:00:01",
+		IPAddress:       "10.0.0.200",
+		CurrentFirmware: "1.0.0",
+		SignalLevel:     3.0,
+		Status:          "online",
 	})
 	if err != nil {
-		t.Fatalf("Failed to create job: %v", err)
+		t.Fatalf("Failed to create modem: %v", err)
 	}
 
-	// Create another pending job for same modem
-	_, err = db.CreateJob(&models.UpgradeJob{
-		ModemID:          1,
-		RuleID:           1,
-		CMTSID:           1,
-		MACAddress:       "00:01:5C:11:22:33",
-		Status:           models.JobStatusPending,
-		TFTPServerIP:     "192.168.1.50",
-		FirmwareFilename: "firmware-v2.0.0.bin",
-		MaxRetries:       3,
+	// A lower priority than the fixture rule must still take precedence
+	ruleID, err := db.CreateRule(&models.UpgradeRule{
+		Name:          "Lab modems",
+		MatchType:     "MAC_RANGE",
+		MatchCriteria: `{"start_mac":"00:01:5C:AA:00:00","end_mac":"00:01:5C:AA:FF:FF"}`,
+		Enabled:       true,
+		Priority:      10,
+		Exclude:       true,
 	})
 	if err != nil {
-		t.Fatalf("Failed to create second job: %v", err)
+		t.Fatalf("Failed to create exclude rule: %v", err)
 	}
-
-	config := Config{
-		Workers:      2,
-		MaxPerCMTS:   5,
-		PollInterval: 30 * time.Second,
+	rule, err := db.GetRule(ruleID)
+	if err != nil {
+		t.Fatalf("Failed to get rule: %v", err)
+	}
+	if !rule.Exclude {
+		t.Error("Expected exclude flag to round-trip")
 	}
 
-	engine := New(db, config)
+	engine := New(db, Config{Workers: 1, PollInterval: 30 * time.Second})
 
-	// Check pending jobs - should skip the pending job because one is in progress
-	err = engine.checkPendingJobs()
+	summary, err := engine.EvaluateRulesReport()
 	if err != nil {
-		t.Fatalf("Failed to check pending jobs: %v", err)
+		t.Fatalf("Failed to evaluate rules: %v", err)
+	}
+	if summary.Skipped["excluded"] != 1 {
+		t.Errorf("Expected 1 modem skipped as excluded, got %d", summary.Skipped["excluded"])
 	}
 
-	// Verify job was skipped (still in jobs channel)
-	if len(engine.jobs) > 0 {
-		t.Log("Job was skipped due to in-progress job for same modem")
+	jobs, err := db.ListJobs(models.JobStatusPending, 0)
+	if err != nil {
+		t.Fatalf("Failed to list jobs: %v", err)
+	}
+	if len(jobs) != 1 {
+		t.Fatalf("Expected 1 job, got %d", len(jobs))
+	}
+	if jobs[0].MACAddress == "00:01:5C:AA:00:01" {
+		t.Error("Expected no job for the excluded modem")
 	}
 
-	// Clean up
-	job, _ := db.GetJob(jobID)
-	if job != nil && job.Status == models.JobStatusInProgress {
-		t.Log("In-progress job exists, deduplication working")
+	// Disabling the exclude rule releases the modem
+	rule.Enabled = false
+	if err := db.UpdateRule(rule); err != nil {
+		t.Fatalf("Failed to update rule: %v", err)
+	}
+	if err := engine.EvaluateRules(); err != nil {
+		t.Fatalf("Failed to evaluate rules: %v", err)
+	}
+	jobs, _ = db.ListJobs(models.JobStatusPending, 0)
+	if len(jobs) != 2 {
+		t.Errorf("Expected 2 jobs after disabling the exclude rule, got %d", len(jobs))
 	}
 }
 
-func TestEngineStartStop(t *testing.T) {
+func TestEvaluateRulesSignalThresholdsFromSettings(t *testing.T) {
 	db, err := database.NewTestDB()
 	if err != nil {
 		t.Fatalf("Failed to create test database: %v", err)
 	}
 	defer db.Close()
 
-	config := Config{
-		Workers:      2,
-		MaxPerCMTS:   5,
-		PollInterval: 1 * time.Second, // Short interval for testing
-	}
-
-	engine := New(db, config)
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
 
-	ctx, cancel := context.WithCancel(context.Background())
+	engine := New(db, Config{Workers: 1, PollInterval: 30 * time.Second})
 
-	// Start engine
-	started := make(chan bool)
-	go func() {
-		started <- true
-		engine.Start(ctx)
-	}()
+	if engine.matcher.MinSignal != DefaultMinSignal || engine.matcher.MaxSignal != DefaultMaxSignal {
+		t.Errorf("Expected default thresholds, got %v/%v", engine.matcher.MinSignal, engine.matcher.MaxSignal)
+	}
 
-	// Wait for start
-	<-started
-	time.Sleep(100 * time.Millisecond)
+	// Fixture modem has a signal of 5.0, tighten the range to exclude it
+	db.SetSetting("signal_level_max", "4.0")
 
-	// Stop engine
-	cancel()
+	if err := engine.EvaluateRules(); err != nil {
+		t.Fatalf("Failed to evaluate rules: %v", err)
+	}
 
-	// Give it time to shutdown
-	time.Sleep(200 * time.Millisecond)
+	if engine.matcher.MaxSignal != 4.0 {
+		t.Errorf("Expected max signal 4.0 after evaluation, got %v", engine.matcher.MaxSignal)
+	}
 
-	t.Log("Engine started and stopped without panic")
+	jobs, err := db.ListJobs(models.JobStatusPending, 0)
+	if err != nil {
+		t.Fatalf("Failed to list jobs: %v", err)
+	}
+	if len(jobs) != 0 {
+		t.Errorf("Expected no jobs with tightened signal range, got %d", len(jobs))
+	}
 }
 
-func TestHandleJobFailureExponentialBackoff(t *testing.T) {
+func TestEvaluateRulesEligibleStatusesFromSettings(t *testing.T) {
 	db, err := database.NewTestDB()
 	if err != nil {
 		t.Fatalf("Failed to create test database: %v", err)
 	}
 	defer db.Close()
 
-	// Load fixtures
 	if err := db.LoadTestFixtures(); err != nil {
 		t.Fatalf("Failed to load fixtures: %v", err)
 	}
 
-	// Create a job
-	jobID, err := db.CreateJob(&models.UpgradeJob{
-		ModemID:          1,
-		RuleID:           1,
-		CMTSID:           1,
-		MACAddress:       "00:01:5C:11:22:33",
-		Status:           models.JobStatusInProgress,
-		TFTPServerIP:     "192.168.1.50",
-		FirmwareFilename: "firmware-v2.0.0.bin",
-		RetryCount:       1,
-		MaxRetries:       3,
-	})
+	modem, err := db.GetModem(1)
 	if err != nil {
-		t.Fatalf("Failed to create job: %v", err)
+		t.Fatalf("Failed to get modem: %v", err)
+	}
+	modem.Status = "partial"
+	if err := db.UpsertModem(modem); err != nil {
+		t.Fatalf("Failed to update modem: %v", err)
 	}
 
-	job, err := db.GetJob(jobID)
+	engine := New(db, Config{Workers: 1, PollInterval: 30 * time.Second})
+
+	// Partial modems are skipped by default
+	if err := engine.EvaluateRules(); err != nil {
+		t.Fatalf("Failed to evaluate rules: %v", err)
+	}
+	jobs, _ := db.ListJobs(models.JobStatusPending, 0)
+	if len(jobs) != 0 {
+		t.Errorf("Expected no jobs for a partial modem by default, got %d", len(jobs))
+	}
+
+	db.SetSetting("eligible_statuses", "online, Partial")
+
+	if err := engine.EvaluateRules(); err != nil {
+		t.Fatalf("Failed to evaluate rules: %v", err)
+	}
+	if got := engine.matcher.EligibleStatuses; len(got) != 2 || got[1] != "partial" {
+		t.Errorf("Expected eligible statuses [online partial], got %v", got)
+	}
+	jobs, _ = db.ListJobs(models.JobStatusPending, 0)
+	if len(jobs) != 1 {
+		t.Errorf("Expected 1 job once partial modems are eligible, got %d", len(jobs))
+	}
+}
+
+func TestEvaluateRulesDeduplication(t *testing.T) {
+	db, err := database.NewTestDB()
 	if err != nil {
-		t.Fatalf("Failed to get job: %v", err)
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	// Load test fixtures
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
 	}
 
 	config := Config{
@@ -439,88 +885,2757 @@ func TestHandleJobFailureExponentialBackoff(t *testing.T) {
 
 	engine := New(db, config)
 
-	// Handle failure (should retry with backoff)
-	testErr := fmt.Errorf("test error")
+	// Evaluate rules twice
+	err = engine.EvaluateRules()
+	if err != nil {
+		t.Fatalf("Failed to evaluate rules: %v", err)
+	}
 
-	// Note: This will actually sleep for the backoff period
-	// For first retry (count=1), backoff is 30 seconds
-	// We can't easily test the sleep without mocking time
-	go engine.handleJobFailure(job, testErr)
+	err = engine.EvaluateRules()
+	if err != nil {
+		t.Fatalf("Failed to evaluate rules second time: %v", err)
+	}
 
-	// Give it a moment to start processing
-	time.Sleep(100 * time.Millisecond)
+	// Should only have one job (deduplication)
+	jobs, err := db.ListJobs(models.JobStatusPending, 10)
+	if err != nil {
+		t.Fatalf("Failed to list jobs: %v", err)
+	}
 
-	// Verify job was updated
-	updatedJob, err := db.GetJob(jobID)
+	if len(jobs) != 1 {
+		t.Errorf("Expected exactly 1 job (deduplication), got %d", len(jobs))
+	}
+}
+
+func TestEvaluateRuleSubset(t *testing.T) {
+	db, err := database.NewTestDB()
 	if err != nil {
-		t.Fatalf("Failed to get updated job: %v", err)
+		t.Fatalf("Failed to create test database: %v", err)
 	}
+	defer db.Close()
 
-	if updatedJob.RetryCount != 2 {
-		t.Errorf("Expected retry count 2, got %d", updatedJob.RetryCount)
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
 	}
 
-	t.Log("Job failure handled with retry logic")
+	// Second modem outside the fixture rule's MAC range, targeted by its own rule
+	err = db.UpsertModem(&models.CableModem{
+		CMTSID:          1,
+		MACAddress:      "00:AA:BB:11:22:33",
+		IPAddress:       "10.0.0.101",
+		SysDescr:        "Motorola MB8600",
+		CurrentFirmware: "1.0.0",
+		SignalLevel:     3.0,
+		Status:          "online",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create modem: %v", err)
+	}
+	ruleID, err := db.CreateRule(&models.UpgradeRule{
+		Name:             "Motorola Rule",
+		MatchType:        "SYSDESCR_REGEX",
+		MatchCriteria:    `{"pattern":"Motorola"}`,
+		TFTPServerIP:     "192.168.1.50",
+		FirmwareFilename: "motorola-v3.0.0.bin",
+		Enabled:          true,
+		Priority:         50,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create rule: %v", err)
+	}
+
+	engine := New(db, Config{Workers: 1, PollInterval: 30 * time.Second})
+
+	created, err := engine.EvaluateRule(ruleID)
+	if err != nil {
+		t.Fatalf("Failed to evaluate rule: %v", err)
+	}
+	if created != 1 {
+		t.Errorf("Expected 1 job created, got %d", created)
+	}
+
+	jobs, err := db.ListJobs(models.JobStatusPending, 0)
+	if err != nil {
+		t.Fatalf("Failed to list jobs: %v", err)
+	}
+	if len(jobs) != 1 {
+		t.Fatalf("Expected only the evaluated rule to produce jobs, got %d", len(jobs))
+	}
+	if jobs[0].RuleID != ruleID || jobs[0].MACAddress != "00:AA:BB:11:22:33" {
+		t.Errorf("Unexpected job: rule %d, MAC %s", jobs[0].RuleID, jobs[0].MACAddress)
+	}
+
+	// Re-running is deduplicated
+	if created, err := engine.EvaluateRule(ruleID); err != nil || created != 0 {
+		t.Errorf("Expected no new jobs on re-run, got %d (err %v)", created, err)
+	}
+
+	if _, err := engine.EvaluateRule(999); err != models.ErrNotFound {
+		t.Errorf("Expected ErrNotFound for missing rule, got %v", err)
+	}
+
+	rule, _ := db.GetRule(ruleID)
+	rule.Enabled = false
+	if err := db.UpdateRule(rule); err != nil {
+		t.Fatalf("Failed to disable rule: %v", err)
+	}
+	if _, err := engine.EvaluateRule(ruleID); err != models.ErrRuleDisabled {
+		t.Errorf("Expected ErrRuleDisabled, got %v", err)
+	}
 }
 
-func TestHandleJobFailureMaxRetriesExceeded(t *testing.T) {
+func TestEvaluateRulesTFTPServerPlaceholder(t *testing.T) {
 	db, err := database.NewTestDB()
 	if err != nil {
 		t.Fatalf("Failed to create test database: %v", err)
 	}
 	defer db.Close()
 
-	// Load fixtures
 	if err := db.LoadTestFixtures(); err != nil {
 		t.Fatalf("Failed to load fixtures: %v", err)
 	}
 
-	// Create a job that has reached max retries
-	jobID, err := db.CreateJob(&models.UpgradeJob{
+	rule, _ := db.GetRule(1)
+	rule.TFTPServerIP = "${FIRMWARE_SERVER}"
+	if err := db.UpdateRule(rule); err != nil {
+		t.Fatalf("Failed to update rule: %v", err)
+	}
+
+	engine := New(db, Config{Workers: 1, PollInterval: 30 * time.Second})
+
+	// An unset variable skips the rule's modems instead of failing a job
+	// for each of them on every pass
+	t.Setenv("FIRMWARE_SERVER", "")
+	for pass := 0; pass < 2; pass++ {
+		if err := engine.EvaluateRules(); err != nil {
+			t.Fatalf("Failed to evaluate rules: %v", err)
+		}
+	}
+	if jobs, _ := db.ListJobs("", 0); len(jobs) != 0 {
+		t.Fatalf("Expected no jobs while the variable is unset, got %d", len(jobs))
+	}
+
+	t.Setenv("FIRMWARE_SERVER", "10.9.8.7")
+	if err := engine.EvaluateRules(); err != nil {
+		t.Fatalf("Failed to evaluate rules: %v", err)
+	}
+	jobs, err := db.ListJobs("", 0)
+	if err != nil {
+		t.Fatalf("Failed to list jobs: %v", err)
+	}
+	if len(jobs) != 1 {
+		t.Fatalf("Expected 1 job, got %d", len(jobs))
+	}
+	if jobs[0].Status != models.JobStatusPending || jobs[0].TFTPServerIP != "10.9.8.7" {
+		t.Errorf("Expected a pending job on 10.9.8.7, got %s on %s", jobs[0].Status, jobs[0].TFTPServerIP)
+	}
+}
+
+func TestPauseResume(t *testing.T) {
+	db, err := database.NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	engine := New(db, Config{Workers: 1, PollInterval: 30 * time.Second})
+	if engine.Paused() {
+		t.Fatal("Expected a new engine to start unpaused")
+	}
+
+	if err := engine.Pause(); err != nil {
+		t.Fatalf("Pause() error = %v", err)
+	}
+	if !engine.Status().Paused {
+		t.Error("Expected status to report paused")
+	}
+
+	// No jobs are created while paused
+	if err := engine.EvaluateRules(); err != nil {
+		t.Fatalf("EvaluateRules() error = %v", err)
+	}
+	jobs, err := db.ListJobs("", 100)
+	if err != nil {
+		t.Fatalf("Failed to list jobs: %v", err)
+	}
+	if len(jobs) != 0 {
+		t.Fatalf("Expected no jobs while paused, got %d", len(jobs))
+	}
+
+	// Existing pending jobs are not queued while paused
+	if _, err := db.CreateJob(&models.UpgradeJob{
 		ModemID:          1,
 		RuleID:           1,
 		CMTSID:           1,
 		MACAddress:       "00:01:5C:11:22:33",
-		Status:           models.JobStatusInProgress,
+		Status:           models.JobStatusPending,
 		TFTPServerIP:     "192.168.1.50",
 		FirmwareFilename: "firmware-v2.0.0.bin",
-		RetryCount:       3,
 		MaxRetries:       3,
-	})
-	if err != nil {
+	}); err != nil {
 		t.Fatalf("Failed to create job: %v", err)
 	}
+	if err := engine.checkPendingJobs(); err != nil {
+		t.Fatalf("checkPendingJobs() error = %v", err)
+	}
+	if len(engine.jobs) != 0 {
+		t.Errorf("Expected nothing queued while paused, got %d", len(engine.jobs))
+	}
 
-	job, err := db.GetJob(jobID)
+	// The paused state survives a restart
+	if !New(db, Config{Workers: 1, PollInterval: 30 * time.Second}).Paused() {
+		t.Error("Expected a restarted engine to still be paused")
+	}
+
+	if err := engine.Resume(); err != nil {
+		t.Fatalf("Resume() error = %v", err)
+	}
+	if err := engine.checkPendingJobs(); err != nil {
+		t.Fatalf("checkPendingJobs() error = %v", err)
+	}
+	if len(engine.jobs) != 1 {
+		t.Errorf("Expected pending job queued after resume, got %d", len(engine.jobs))
+	}
+	if New(db, Config{Workers: 1, PollInterval: 30 * time.Second}).Paused() {
+		t.Error("Expected a restarted engine to be unpaused after resume")
+	}
+}
+
+func TestEngineLiveness(t *testing.T) {
+	db, err := database.NewTestDB()
 	if err != nil {
-		t.Fatalf("Failed to get job: %v", err)
+		t.Fatalf("Failed to create test database: %v", err)
 	}
+	defer db.Close()
 
-	config := Config{
-		Workers:      2,
-		MaxPerCMTS:   5,
-		PollInterval: 30 * time.Second,
+	engine := New(db, Config{Workers: 2, ScheduleInterval: time.Minute})
+
+	liveness := engine.Liveness()
+	if liveness.LastHeartbeat != nil || liveness.Stalled || liveness.RunningWorkers != 0 || liveness.Workers != 2 {
+		t.Errorf("Expected an unstarted engine, got %+v", liveness)
+	}
+	if liveness.StaleAfter != 3*time.Minute {
+		t.Errorf("Expected stale after 3 poll intervals, got %v", liveness.StaleAfter)
 	}
 
-	engine := New(db, config)
+	engine.heartbeat("jobs")
+	if liveness = engine.Liveness(); liveness.LastHeartbeat == nil || liveness.Stalled {
+		t.Errorf("Expected a live engine after a tick, got %+v", liveness)
+	}
 
-	// Handle failure (should mark as failed)
-	testErr := fmt.Errorf("test error")
-	engine.handleJobFailure(job, testErr)
+	engine.lastHeartbeat.Store(time.Now().Add(-4 * time.Minute).UnixNano())
+	if liveness = engine.Liveness(); !liveness.Stalled {
+		t.Errorf("Expected the engine stalled after 4 minutes without a tick, got %+v", liveness)
+	}
 
-	// Verify job was marked as failed
-	updatedJob, err := db.GetJob(jobID)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		engine.worker(ctx, 0)
+		close(done)
+	}()
+	deadline := time.Now().Add(time.Second)
+	for engine.Liveness().RunningWorkers != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the worker to be counted as running")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+	if n := engine.Liveness().RunningWorkers; n != 0 {
+		t.Errorf("Expected no running workers after stop, got %d", n)
+	}
+}
+
+func TestWorkerRecoversFromPanic(t *testing.T) {
+	db, err := database.NewTestDB()
 	if err != nil {
-		t.Fatalf("Failed to get updated job: %v", err)
+		t.Fatalf("Failed to create test database: %v", err)
 	}
+	defer db.Close()
 
-	if updatedJob.Status != models.JobStatusFailed {
-		t.Errorf("Expected status FAILED, got %s", updatedJob.Status)
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
 	}
 
-	if updatedJob.CompletedAt == nil {
-		t.Error("CompletedAt should be set for failed job")
+	client := &stubModemClient{
+		statuses:  []string{"completed"},
+		firmwares: []string{"2.0.0"},
 	}
+	engine := newStubEngine(t, db, client)
 
-	t.Log("Job marked as failed after max retries")
+	// The first connection hands back a nil client, so the upgrade panics
+	// with a nil dereference
+	var connects atomic.Int32
+	engine.connectModem = func(ip, community string, port int) (modemClient, error) {
+		if connects.Add(1) == 1 {
+			return nil, nil
+		}
+		return client, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		engine.worker(ctx, 0)
+		close(done)
+	}()
+
+	waitForStatus := func(id int, status string) *models.UpgradeJob {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			if stored, _ := db.GetJob(id); stored != nil && stored.Status == status {
+				return stored
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		t.Fatalf("Job %d never reached %s", id, status)
+		return nil
+	}
+	queue := func() int {
+		t.Helper()
+		job := &models.UpgradeJob{
+			ModemID:          1,
+			RuleID:           1,
+			CMTSID:           1,
+			MACAddress:       "00:01:5C:11:22:33",
+			Status:           models.JobStatusPending,
+			TFTPServerIP:     "192.168.1.50",
+			FirmwareFilename: "firmware-v2.0.0.bin",
+			MaxRetries:       3,
+		}
+		id, err := db.CreateJob(job)
+		if err != nil {
+			t.Fatalf("Failed to create job: %v", err)
+		}
+		job.ID = id
+		engine.jobs <- job
+		return id
+	}
+
+	panicked := waitForStatus(queue(), models.JobStatusFailed)
+	if panicked.ErrorMessage == nil || !strings.Contains(*panicked.ErrorMessage, "worker panicked") {
+		t.Errorf("Expected a worker panic error, got %v", panicked.ErrorMessage)
+	}
+	if !panicked.DeadLetter {
+		t.Error("Expected the panicked job not to be retried")
+	}
+
+	// The same worker picks up the next job
+	waitForStatus(queue(), models.JobStatusCompleted)
+	if n := engine.Liveness().RunningWorkers; n != 1 {
+		t.Errorf("Expected the worker still running, got %d", n)
+	}
+
+	cancel()
+	<-done
+}
+
+func TestEngineStatus(t *testing.T) {
+	db, err := database.NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	engine := New(db, Config{Workers: 3, MaxPerCMTS: 4, PollInterval: 30 * time.Second})
+	engine.discover = func(cmtsID int) error {
+		if cmtsID == 2 {
+			return fmt.Errorf("timeout")
+		}
+		return nil
+	}
+
+	status := engine.Status()
+	if status.Workers != 3 || status.MaxPerCMTS != 4 || status.QueueCapacity != 100 {
+		t.Errorf("Unexpected config in status: %+v", status)
+	}
+	if status.LastEvaluation != nil || len(status.LastDiscovery) != 0 || status.Ready ||
+		status.LastDiscoveryCycle != nil || status.LastEvaluationCycle != nil || status.JobsProcessed != 0 {
+		t.Errorf("Expected empty status before activity, got %+v", status)
+	}
+
+	engine.runDiscoveryForAllCMTS(context.Background())
+	engine.schedulerWG.Wait()
+	engine.DiscoverModems(2)
+	if err := engine.EvaluateRules(); err != nil {
+		t.Fatalf("Failed to evaluate rules: %v", err)
+	}
+	sem := engine.getCMTSSemaphore(1)
+	sem.Acquire(context.Background())
+	defer sem.Release()
+	// An idle semaphore left over from an earlier upgrade isn't counted
+	engine.getCMTSSemaphore(2)
+
+	status = engine.Status()
+
+	if status.LastEvaluation == nil || status.LastEvaluation.JobsCreated != 1 || status.LastEvaluation.EligibleModems != 1 {
+		t.Errorf("Unexpected last evaluation: %+v", status.LastEvaluation)
+	}
+	if d, ok := status.LastDiscovery[1]; !ok || d.Error != "" {
+		t.Errorf("Expected successful discovery for CMTS 1, got %+v", d)
+	}
+	if d := status.LastDiscovery[2]; d.Error != "timeout" {
+		t.Errorf("Expected failed discovery for CMTS 2, got %+v", d)
+	}
+	if status.ActivePerCMTS[1] != 1 {
+		t.Errorf("Expected 1 active upgrade on CMTS 1, got %d", status.ActivePerCMTS[1])
+	}
+	if status.CMTSSemaphores != 1 {
+		t.Errorf("Expected 1 CMTS semaphore in use, got %d", status.CMTSSemaphores)
+	}
+	if status.LastDiscoveryCycle == nil {
+		t.Error("Expected the discovery cycle completion to be recorded")
+	}
+}
+
+func TestEvaluateRulesCanaryPercent(t *testing.T) {
+	db, err := database.NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	// 400 matching modems in total, including the fixture modem
+	for i := 0; i < 399; i++ {
+		err := db.UpsertModem(&models.CableModem{
+			CMTSID:          1,
+			MACAddress:      fmt.Sprintf("00:01:5C:A0:%02X:%02X", i/256, i%256),
+			CurrentFirmware: "1.0.0",
+			SignalLevel:     2.0,
+			Status:          "online",
+		})
+		if err != nil {
+			t.Fatalf("Failed to create modem: %v", err)
+		}
+	}
+
+	setCanary := func(percent int) {
+		rule, _ := db.GetRule(1)
+		rule.CanaryPercent = percent
+		if err := db.UpdateRule(rule); err != nil {
+			t.Fatalf("Failed to update rule: %v", err)
+		}
+	}
+
+	engine := New(db, Config{Workers: 1, PollInterval: 30 * time.Second})
+
+	cohort := func() map[string]bool {
+		if err := engine.EvaluateRules(); err != nil {
+			t.Fatalf("Failed to evaluate rules: %v", err)
+		}
+		jobs, err := db.ListJobs(models.JobStatusPending, 0)
+		if err != nil {
+			t.Fatalf("Failed to list jobs: %v", err)
+		}
+		macs := make(map[string]bool)
+		for _, job := range jobs {
+			macs[job.MACAddress] = true
+		}
+		return macs
+	}
+
+	setCanary(25)
+	first := cohort()
+	if len(first) < 60 || len(first) > 140 {
+		t.Errorf("Expected roughly 100 of 400 modems at 25%%, got %d", len(first))
+	}
+	for mac := range first {
+		if !inCanaryCohort(mac, 25) {
+			t.Errorf("Modem %s selected outside the 25%% cohort", mac)
+		}
+	}
+
+	// Widening the canary keeps everyone already selected
+	setCanary(50)
+	second := cohort()
+	if len(second) < 160 || len(second) > 240 {
+		t.Errorf("Expected roughly 200 of 400 modems at 50%%, got %d", len(second))
+	}
+	for mac := range first {
+		if !second[mac] {
+			t.Errorf("Modem %s dropped out of the cohort when it grew", mac)
+		}
+	}
+}
+
+func TestRunDiscoveryForAllCMTS(t *testing.T) {
+	db, err := database.NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	// Load test fixtures
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	config := Config{
+		Workers:      2,
+		MaxPerCMTS:   5,
+		PollInterval: 30 * time.Second,
+	}
+
+	engine := New(db, config)
+
+	// Run discovery (will fail without SNMP but should not panic)
+	engine.runDiscoveryForAllCMTS(context.Background())
+
+	// Verify no panic occurred
+	t.Log("Discovery completed without panic")
+}
+
+func TestCheckPendingJobsDeduplication(t *testing.T) {
+	db, err := database.NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	// Load test fixtures
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	// Create a job
+	jobID, err := db.CreateJob(&models.UpgradeJob{
+		ModemID:          1,
+		RuleID:           1,
+		CMTSID:           1,
+		MACAddress:       "00:01:5C:11:22:33",
+		Status:           models.JobStatusInProgress,
+		TFTPServerIP:     "192.168.1.50",
+		FirmwareFilename: "firmware-v2.0.0.bin",
+		MaxRetries:       3,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+
+	// Create another pending job for same modem
+	_, err = db.CreateJob(&models.UpgradeJob{
+		ModemID:          1,
+		RuleID:           1,
+		CMTSID:           1,
+		MACAddress:       "00:01:5C:11:22:33",
+		Status:           models.JobStatusPending,
+		TFTPServerIP:     "192.168.1.50",
+		FirmwareFilename: "firmware-v2.0.0.bin",
+		MaxRetries:       3,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create second job: %v", err)
+	}
+
+	config := Config{
+		Workers:      2,
+		MaxPerCMTS:   5,
+		PollInterval: 30 * time.Second,
+	}
+
+	engine := New(db, config)
+
+	// Check pending jobs - should skip the pending job because one is in progress
+	err = engine.checkPendingJobs()
+	if err != nil {
+		t.Fatalf("Failed to check pending jobs: %v", err)
+	}
+
+	// Verify job was skipped (still in jobs channel)
+	if len(engine.jobs) > 0 {
+		t.Log("Job was skipped due to in-progress job for same modem")
+	}
+
+	// Clean up
+	job, _ := db.GetJob(jobID)
+	if job != nil && job.Status == models.JobStatusInProgress {
+		t.Log("In-progress job exists, deduplication working")
+	}
+}
+
+func TestEngineStartStop(t *testing.T) {
+	db, err := database.NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	config := Config{
+		Workers:      2,
+		MaxPerCMTS:   5,
+		PollInterval: 1 * time.Second, // Short interval for testing
+	}
+
+	engine := New(db, config)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// Start engine
+	started := make(chan bool)
+	go func() {
+		started <- true
+		engine.Start(ctx)
+	}()
+
+	// Wait for start
+	<-started
+	time.Sleep(100 * time.Millisecond)
+
+	// Stop engine
+	cancel()
+
+	// Give it time to shutdown
+	time.Sleep(200 * time.Millisecond)
+
+	t.Log("Engine started and stopped without panic")
+}
+
+func TestHandleJobFailureExponentialBackoff(t *testing.T) {
+	db, err := database.NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	// Load fixtures
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	// Create a job
+	jobID, err := db.CreateJob(&models.UpgradeJob{
+		ModemID:          1,
+		RuleID:           1,
+		CMTSID:           1,
+		MACAddress:       "00:01:5C:11:22:33",
+		Status:           models.JobStatusInProgress,
+		TFTPServerIP:     "192.168.1.50",
+		FirmwareFilename: "firmware-v2.0.0.bin",
+		RetryCount:       1,
+		MaxRetries:       3,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+
+	job, err := db.GetJob(jobID)
+	if err != nil {
+		t.Fatalf("Failed to get job: %v", err)
+	}
+
+	config := Config{
+		Workers:      2,
+		MaxPerCMTS:   5,
+		PollInterval: 30 * time.Second,
+	}
+
+	engine := New(db, config)
+
+	// Without jitter the backoff is exact
+	db.SetSetting("retry_jitter", "false")
+
+	// Handle failure (should retry with backoff)
+	testErr := fmt.Errorf("test error")
+
+	// Note: This will actually sleep for the backoff period
+	// For first retry (count=1), backoff is 30 seconds
+	// We can't easily test the sleep without mocking time
+	go engine.handleJobFailure(job, testErr)
+
+	// Give it a moment to start processing
+	time.Sleep(100 * time.Millisecond)
+
+	// Verify job was updated
+	updatedJob, err := db.GetJob(jobID)
+	if err != nil {
+		t.Fatalf("Failed to get updated job: %v", err)
+	}
+
+	if updatedJob.RetryCount != 2 {
+		t.Errorf("Expected retry count 2, got %d", updatedJob.RetryCount)
+	}
+
+	// Second retry backs off 60s, so the job isn't dispatched yet
+	if updatedJob.NextRetryAt == nil || time.Until(*updatedJob.NextRetryAt) < 50*time.Second {
+		t.Errorf("Expected next_retry_at about 60s out, got %v", updatedJob.NextRetryAt)
+	}
+	if err := engine.checkPendingJobs(); err != nil {
+		t.Fatalf("checkPendingJobs() error = %v", err)
+	}
+	if len(engine.jobs) != 0 {
+		t.Errorf("Expected job held back during backoff, got %d queued", len(engine.jobs))
+	}
+
+	t.Log("Job failure handled with retry logic")
+}
+
+func TestHandleJobFailureRetryJitter(t *testing.T) {
+	db, err := database.NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	engine := New(db, Config{Workers: 1, PollInterval: 30 * time.Second})
+	db.SetSetting("retry_budget", "0")
+	db.SetSetting("retry_budget_per_cmts", "0")
+
+	// Fail a batch of jobs at once, as a TFTP outage would
+	failAll := func() []time.Duration {
+		var delays []time.Duration
+		for i := 0; i < 50; i++ {
+			jobID, err := db.CreateJob(&models.UpgradeJob{
+				ModemID:    1,
+				RuleID:     1,
+				CMTSID:     1,
+				MACAddress: fmt.Sprintf("00:01:5C:00:10:%02X", i),
+				Status:     models.JobStatusInProgress,
+				MaxRetries: 3,
+			})
+			if err != nil {
+				t.Fatalf("Failed to create job: %v", err)
+			}
+			job, _ := db.GetJob(jobID)
+			failed := time.Now()
+			engine.handleJobFailure(job, fmt.Errorf("tftp timeout"))
+
+			job, _ = db.GetJob(jobID)
+			if job.NextRetryAt == nil {
+				t.Fatalf("Expected job %d to be scheduled for retry", jobID)
+			}
+			delays = append(delays, job.NextRetryAt.Sub(failed))
+		}
+		return delays
+	}
+
+	// The first retry backs off 30s, jittered to between 15s and 45s
+	distinct := map[int64]bool{}
+	for _, delay := range failAll() {
+		if delay < 14*time.Second || delay > 46*time.Second {
+			t.Errorf("Expected a jittered delay between 15s and 45s, got %v", delay)
+		}
+		distinct[int64(delay/time.Second)] = true
+	}
+	if len(distinct) < 5 {
+		t.Errorf("Expected retry times spread out, got only %d distinct seconds", len(distinct))
+	}
+
+	db.SetSetting("retry_jitter", "false")
+	for _, delay := range failAll() {
+		if delay < 29*time.Second || delay > 31*time.Second {
+			t.Errorf("Expected an exact 30s delay without jitter, got %v", delay)
+		}
+	}
+}
+
+func TestHandleJobFailureMaxRetriesExceeded(t *testing.T) {
+	db, err := database.NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	// Load fixtures
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	// Create a job that has reached max retries
+	jobID, err := db.CreateJob(&models.UpgradeJob{
+		ModemID:          1,
+		RuleID:           1,
+		CMTSID:           1,
+		MACAddress:       "00:01:5C:11:22:33",
+		Status:           models.JobStatusInProgress,
+		TFTPServerIP:     "192.168.1.50",
+		FirmwareFilename: "firmware-v2.0.0.bin",
+		RetryCount:       3,
+		MaxRetries:       3,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+
+	job, err := db.GetJob(jobID)
+	if err != nil {
+		t.Fatalf("Failed to get job: %v", err)
+	}
+
+	config := Config{
+		Workers:      2,
+		MaxPerCMTS:   5,
+		PollInterval: 30 * time.Second,
+	}
+
+	engine := New(db, config)
+
+	// Handle failure (should mark as failed)
+	testErr := fmt.Errorf("test error")
+	engine.handleJobFailure(job, testErr)
+
+	// Verify job was marked as failed
+	updatedJob, err := db.GetJob(jobID)
+	if err != nil {
+		t.Fatalf("Failed to get updated job: %v", err)
+	}
+
+	if updatedJob.Status != models.JobStatusFailed {
+		t.Errorf("Expected status FAILED, got %s", updatedJob.Status)
+	}
+
+	if updatedJob.CompletedAt == nil {
+		t.Error("CompletedAt should be set for failed job")
+	}
+
+	if !updatedJob.DeadLetter {
+		t.Error("Exhausted job should be in the dead-letter queue")
+	}
+
+	t.Log("Job marked as failed after max retries")
+}
+
+func TestHandleJobFailureAttemptsPerMaxRetries(t *testing.T) {
+	db, err := database.NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	engine := New(db, Config{Workers: 1, MaxPerCMTS: 5, PollInterval: 30 * time.Second})
+
+	// max_retries 0 tries once; 1 tries once more
+	for _, maxRetries := range []int{0, 1, 3} {
+		jobID, err := db.CreateJob(&models.UpgradeJob{
+			ModemID:          1,
+			RuleID:           1,
+			CMTSID:           1,
+			MACAddress:       "00:01:5C:11:22:33",
+			Status:           models.JobStatusInProgress,
+			TFTPServerIP:     "192.168.1.50",
+			FirmwareFilename: "firmware-v2.0.0.bin",
+			MaxRetries:       maxRetries,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create job: %v", err)
+		}
+
+		attempts := 0
+		for attempts < 10 {
+			job, err := db.GetJob(jobID)
+			if err != nil {
+				t.Fatalf("Failed to get job: %v", err)
+			}
+			if job.Status == models.JobStatusFailed {
+				break
+			}
+			attempts++
+			engine.handleJobFailure(job, fmt.Errorf("tftp timeout"))
+		}
+		if attempts != maxRetries+1 {
+			t.Errorf("max_retries %d: expected %d attempts, got %d", maxRetries, maxRetries+1, attempts)
+		}
+	}
+}
+
+func TestHandleJobFailureRecordsDetails(t *testing.T) {
+	db, err := database.NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	jobID, err := db.CreateJob(&models.UpgradeJob{
+		ModemID:          1,
+		RuleID:           1,
+		CMTSID:           1,
+		MACAddress:       "00:01:5C:11:22:33",
+		Status:           models.JobStatusInProgress,
+		TFTPServerIP:     "192.168.1.50",
+		FirmwareFilename: "firmware-v2.0.0.bin",
+		MaxRetries:       2,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+
+	engine := New(db, Config{Workers: 1, MaxPerCMTS: 5, PollInterval: 30 * time.Second})
+
+	failures := []error{
+		fmt.Errorf("failed to set TFTP server: %w", errors.New("request timeout (after 0 retries)")),
+		fmt.Errorf("tftp file not found"),
+		fmt.Errorf("upgrade failed: device reported failed"),
+	}
+	for _, failure := range failures {
+		job, err := db.GetJob(jobID)
+		if err != nil {
+			t.Fatalf("Failed to get job: %v", err)
+		}
+		engine.handleJobFailure(job, failure)
+	}
+
+	job, err := db.GetJob(jobID)
+	if err != nil {
+		t.Fatalf("Failed to get job: %v", err)
+	}
+	if job.Status != models.JobStatusFailed {
+		t.Errorf("Expected status FAILED, got %s", job.Status)
+	}
+	if len(job.FailureDetails) != len(failures) {
+		t.Fatalf("Expected %d failure details, got %d", len(failures), len(job.FailureDetails))
+	}
+	for i, detail := range job.FailureDetails {
+		if detail.Attempt != i+1 {
+			t.Errorf("Failure %d: expected attempt %d, got %d", i, i+1, detail.Attempt)
+		}
+		if detail.Error != failures[i].Error() {
+			t.Errorf("Failure %d: expected error %q, got %q", i, failures[i].Error(), detail.Error)
+		}
+		if detail.At.IsZero() {
+			t.Errorf("Failure %d: timestamp not set", i)
+		}
+	}
+	if got := job.FailureDetails[0].Cause; got != "request timeout (after 0 retries)" {
+		t.Errorf("Expected SNMP cause on first failure, got %q", got)
+	}
+	if got := job.FailureDetails[1].Cause; got != "" {
+		t.Errorf("Expected no cause for an unwrapped error, got %q", got)
+	}
+}
+
+func TestWebhookNotifications(t *testing.T) {
+	db, err := database.NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	// The first POST fails so the notifier has to retry
+	var mu sync.Mutex
+	requests := 0
+	payloads := make(chan webhookPayload, 10)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		first := requests == 1
+		mu.Unlock()
+		if first {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var payload webhookPayload
+		json.NewDecoder(r.Body).Decode(&payload)
+		payloads <- payload
+	}))
+	defer hook.Close()
+
+	engine := New(db, Config{Workers: 1, PollInterval: 30 * time.Second})
+	engine.notifier.backoff = time.Millisecond
+
+	newJob := func(retryCount int) *models.UpgradeJob {
+		jobID, err := db.CreateJob(&models.UpgradeJob{
+			ModemID:    1,
+			RuleID:     1,
+			CMTSID:     1,
+			MACAddress: "00:01:5C:11:22:33",
+			Status:     models.JobStatusInProgress,
+			RetryCount: retryCount,
+			MaxRetries: 3,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create job: %v", err)
+		}
+		job, err := db.GetJob(jobID)
+		if err != nil {
+			t.Fatalf("Failed to get job: %v", err)
+		}
+		return job
+	}
+
+	// Nothing is sent while webhook_url is empty
+	engine.handleJobFailure(newJob(3), fmt.Errorf("tftp timeout"))
+
+	if err := db.SetSetting("webhook_url", hook.URL); err != nil {
+		t.Fatalf("Failed to set webhook_url: %v", err)
+	}
+
+	// A failure that will be retried isn't reported
+	engine.handleJobFailure(newJob(0), fmt.Errorf("tftp timeout"))
+
+	final := newJob(3)
+	engine.handleJobFailure(final, fmt.Errorf("tftp timeout"))
+
+	select {
+	case payload := <-payloads:
+		if payload.Event != models.EventUpgradeFailed || payload.JobID != final.ID ||
+			payload.MAC != final.MACAddress || payload.Status != models.JobStatusFailed ||
+			payload.Error != "tftp timeout" {
+			t.Errorf("Unexpected payload: %+v", payload)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected webhook for final failure")
+	}
+
+	select {
+	case payload := <-payloads:
+		t.Errorf("Expected one webhook, also got %+v", payload)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if requests != 2 {
+		t.Errorf("Expected the failed POST to be retried once, got %d requests", requests)
+	}
+}
+
+func TestHandleJobFailureRetryBudget(t *testing.T) {
+	db, err := database.NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	cmts2, err := db.CreateCMTS(&models.CMTS{
+		Name:          "Second CMTS",
+		IPAddress:     "192.168.1.2",
+		SNMPPort:      161,
+		CommunityRead: "public",
+		SNMPVersion:   2,
+		Enabled:       true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create CMTS: %v", err)
+	}
+
+	engine := New(db, Config{
+		Workers:            2,
+		MaxPerCMTS:         5,
+		PollInterval:       30 * time.Second,
+		RetryBudget:        5,
+		RetryBudgetPerCMTS: 3,
+	})
+
+	// Simulate a bad firmware file failing every job on both CMTS
+	fail := func(cmtsID, count int) (retried, failed int) {
+		for i := 0; i < count; i++ {
+			jobID, err := db.CreateJob(&models.UpgradeJob{
+				ModemID:          1,
+				RuleID:           1,
+				CMTSID:           cmtsID,
+				MACAddress:       "00:01:5C:11:22:33",
+				Status:           models.JobStatusInProgress,
+				TFTPServerIP:     "192.168.1.50",
+				FirmwareFilename: "firmware-v2.0.0.bin",
+				MaxRetries:       3,
+			})
+			if err != nil {
+				t.Fatalf("Failed to create job: %v", err)
+			}
+			job, err := db.GetJob(jobID)
+			if err != nil {
+				t.Fatalf("Failed to get job: %v", err)
+			}
+
+			engine.handleJobFailure(job, fmt.Errorf("file not found"))
+
+			updated, err := db.GetJob(jobID)
+			if err != nil {
+				t.Fatalf("Failed to get updated job: %v", err)
+			}
+			switch updated.Status {
+			case models.JobStatusPending:
+				retried++
+			case models.JobStatusFailed:
+				failed++
+				if updated.ErrorMessage == nil || !strings.Contains(*updated.ErrorMessage, "retry budget exhausted") {
+					t.Errorf("Expected retry budget reason, got %v", updated.ErrorMessage)
+				}
+			default:
+				t.Errorf("Unexpected job status %s", updated.Status)
+			}
+		}
+		return retried, failed
+	}
+
+	// The per-CMTS budget caps the first CMTS at 3 retries
+	if retried, failed := fail(1, 8); retried != 3 || failed != 5 {
+		t.Errorf("CMTS 1: expected 3 retried and 5 failed, got %d and %d", retried, failed)
+	}
+
+	// Only 2 retries remain in the fleet budget for the second CMTS
+	if retried, failed := fail(cmts2, 4); retried != 2 || failed != 2 {
+		t.Errorf("CMTS 2: expected 2 retried and 2 failed, got %d and %d", retried, failed)
+	}
+
+	logs, err := db.ListActivityLogs(database.ActivityLogFilter{}, 100, 0)
+	if err != nil {
+		t.Fatalf("Failed to list activity: %v", err)
+	}
+	alerts := map[string]int{}
+	for _, entry := range logs {
+		if entry.EventType == models.EventRetryBudgetExhausted {
+			alerts[entry.EntityType]++
+		}
+	}
+	if alerts["cmts"] != 1 || alerts["system"] != 1 {
+		t.Errorf("Expected one CMTS and one fleet alert, got %v", alerts)
+	}
+}
+
+func TestRetryBudgetWindow(t *testing.T) {
+	budget := newRetryBudget(2, time.Minute)
+	start := time.Now()
+
+	for i := 0; i < 2; i++ {
+		if !budget.available(start) {
+			t.Fatalf("Expected retry %d to be available", i+1)
+		}
+		budget.spend(start)
+	}
+	if budget.available(start.Add(30 * time.Second)) {
+		t.Error("Expected budget to be exhausted within the window")
+	}
+	if !budget.available(start.Add(time.Minute + time.Second)) {
+		t.Error("Expected budget to recover once the window has passed")
+	}
+}
+
+func TestCancelJobPending(t *testing.T) {
+	db, err := database.NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	jobID, err := db.CreateJob(&models.UpgradeJob{
+		ModemID:          1,
+		RuleID:           1,
+		CMTSID:           1,
+		MACAddress:       "00:01:5C:11:22:33",
+		Status:           models.JobStatusPending,
+		TFTPServerIP:     "192.168.1.50",
+		FirmwareFilename: "firmware-v2.0.0.bin",
+		MaxRetries:       3,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+
+	engine := New(db, Config{Workers: 1, PollInterval: 30 * time.Second})
+
+	if err := engine.CancelJob(jobID); err != nil {
+		t.Fatalf("CancelJob failed: %v", err)
+	}
+
+	job, err := db.GetJob(jobID)
+	if err != nil {
+		t.Fatalf("Failed to get job: %v", err)
+	}
+	if job.Status != models.JobStatusSkipped {
+		t.Errorf("Expected status SKIPPED, got %s", job.Status)
+	}
+	if job.CompletedAt == nil {
+		t.Error("CompletedAt should be set for cancelled job")
+	}
+
+	// Cancelled jobs must not be picked up again
+	pending, err := db.ListJobs(models.JobStatusPending, 0)
+	if err != nil {
+		t.Fatalf("Failed to list pending jobs: %v", err)
+	}
+	if len(pending) != 0 {
+		t.Errorf("Expected no pending jobs, got %d", len(pending))
+	}
+
+	if err := engine.CancelJob(jobID); err != models.ErrInvalidJobState {
+		t.Errorf("Expected ErrInvalidJobState cancelling a skipped job, got %v", err)
+	}
+}
+
+func TestCancelJobInProgress(t *testing.T) {
+	db, err := database.NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	jobID, err := db.CreateJob(&models.UpgradeJob{
+		ModemID:          1,
+		RuleID:           1,
+		CMTSID:           1,
+		MACAddress:       "00:01:5C:11:22:33",
+		Status:           models.JobStatusInProgress,
+		TFTPServerIP:     "192.168.1.50",
+		FirmwareFilename: "firmware-v2.0.0.bin",
+		MaxRetries:       3,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+
+	engine := New(db, Config{Workers: 1, PollInterval: 30 * time.Second})
+
+	// Simulate a worker owning the job
+	ctx, cancel := context.WithCancel(context.Background())
+	engine.registerActiveJob(jobID, cancel)
+	defer engine.unregisterActiveJob(jobID)
+
+	if err := engine.CancelJob(jobID); err != nil {
+		t.Fatalf("CancelJob failed: %v", err)
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Job context should have been cancelled")
+	}
+}
+
+func TestCancelJobWaitingForSlot(t *testing.T) {
+	db, err := database.NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	job := &models.UpgradeJob{
+		ModemID:          1,
+		RuleID:           1,
+		CMTSID:           1,
+		MACAddress:       "00:01:5C:11:22:33",
+		Status:           models.JobStatusPending,
+		TFTPServerIP:     "192.168.1.50",
+		FirmwareFilename: "firmware-v2.0.0.bin",
+		MaxRetries:       3,
+	}
+	if job.ID, err = db.CreateJob(job); err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+
+	client := &stubModemClient{}
+	engine := newStubEngine(t, db, client)
+
+	// Fill the CMTS so the job blocks waiting for a slot
+	sem := engine.getCMTSSemaphore(1)
+	for sem.TryAcquire() {
+		defer sem.Release()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- engine.processJob(context.Background(), job)
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		engine.activeJobsMu.Lock()
+		_, running := engine.activeJobs[job.ID]
+		engine.activeJobsMu.Unlock()
+		if running {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Job never started")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if err := engine.CancelJob(job.ID); err != nil {
+		t.Fatalf("CancelJob failed: %v", err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("processJob failed: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Job stayed blocked on the CMTS semaphore after cancellation")
+	}
+
+	if client.triggered != 0 {
+		t.Errorf("Expected no upgrade triggered for a cancelled job, got %d", client.triggered)
+	}
+	if stored, _ := db.GetJob(job.ID); stored.Status != models.JobStatusSkipped {
+		t.Errorf("Expected the cancelled job SKIPPED, got %s", stored.Status)
+	}
+}
+
+// stubModemClient is a scripted modemClient used to avoid real SNMP traffic
+type stubModemClient struct {
+	mu        sync.Mutex
+	statuses  []string
+	versions  []string
+	firmwares []string
+	triggered int
+	rebooted  int
+	// community records the community of the last connection
+	community string
+	// adminValue and oid record the last trigger's overrides
+	adminValue int
+	oid        string
+	transport  string
+	// state is returned by GetModemState after stateDelay
+	state      snmp.ModemState
+	stateDelay time.Duration
+}
+
+func (c *stubModemClient) TriggerFirmwareUpgrade(modemIP, tftpServer, filename string, adminValue int, oid, transport string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.triggered++
+	c.adminValue = adminValue
+	c.oid = oid
+	c.transport = transport
+	return nil
+}
+
+func (c *stubModemClient) RebootModem() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rebooted++
+	return nil
+}
+
+func (c *stubModemClient) GetModemState() (snmp.ModemState, error) {
+	c.mu.Lock()
+	state, delay := c.state, c.stateDelay
+	c.mu.Unlock()
+	time.Sleep(delay)
+	return state, nil
+}
+
+func (c *stubModemClient) CheckUpgradeProgress() (snmp.UpgradeProgress, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	progress := snmp.UpgradeProgress{Status: "completed"}
+	if len(c.statuses) > 0 {
+		progress.Status = c.statuses[0]
+		if len(c.statuses) > 1 {
+			c.statuses = c.statuses[1:]
+		}
+	}
+	if len(c.versions) > 0 {
+		progress.CurrentVersion = c.versions[0]
+		if len(c.versions) > 1 {
+			c.versions = c.versions[1:]
+		}
+	}
+	return progress, nil
+}
+
+func (c *stubModemClient) GetModemFirmware() (string, string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.firmwares) == 0 {
+		return "", "", fmt.Errorf("no response")
+	}
+	firmware := c.firmwares[0]
+	if len(c.firmwares) > 1 {
+		c.firmwares = c.firmwares[1:]
+	}
+	return "Arris SB8200 SW_REV: " + firmware, firmware, nil
+}
+
+func (c *stubModemClient) Close() error {
+	return nil
+}
+
+func newStubEngine(t *testing.T, db *database.DB, client *stubModemClient) *Engine {
+	t.Helper()
+	engine := New(db, Config{
+		Workers:           1,
+		PollInterval:      30 * time.Second,
+		JobTimeout:        time.Minute,
+		VerifyGracePeriod: 200 * time.Millisecond,
+	})
+	engine.statusInterval = 10 * time.Millisecond
+	engine.verifyInterval = 10 * time.Millisecond
+	engine.connectModem = func(ip, community string, port int) (modemClient, error) {
+		client.mu.Lock()
+		client.community = community
+		client.mu.Unlock()
+		return client, nil
+	}
+	engine.probeFirmware = func(server, filename string) error {
+		return nil
+	}
+	return engine
+}
+
+func TestRebootModem(t *testing.T) {
+	db, err := database.NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	client := &stubModemClient{}
+	engine := newStubEngine(t, db, client)
+
+	if _, err := engine.RebootModem(999); err != models.ErrNotFound {
+		t.Errorf("Expected ErrNotFound for unknown modem, got %v", err)
+	}
+
+	modem, err := engine.RebootModem(1)
+	if err != nil {
+		t.Fatalf("Failed to reboot modem: %v", err)
+	}
+	if modem.MACAddress != "00:01:5C:11:22:33" {
+		t.Errorf("Expected fixture modem, got %s", modem.MACAddress)
+	}
+	if client.rebooted != 1 {
+		t.Errorf("Expected 1 reboot, got %d", client.rebooted)
+	}
+	if client.community != "cable-modem" {
+		t.Errorf("Expected CM community string, got %q", client.community)
+	}
+
+	// Rebooting mid-upgrade could interrupt the firmware write
+	jobID, err := db.CreateJob(&models.UpgradeJob{
+		ModemID:    1,
+		CMTSID:     1,
+		MACAddress: "00:01:5C:11:22:33",
+		Status:     models.JobStatusInProgress,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+	if _, err := engine.RebootModem(1); err != models.ErrUpgradeActive {
+		t.Errorf("Expected ErrUpgradeActive, got %v", err)
+	}
+	job, _ := db.GetJob(jobID)
+	job.Status = models.JobStatusFailed
+	if err := db.UpdateJob(job); err != nil {
+		t.Fatalf("Failed to update job: %v", err)
+	}
+
+	cmts, _ := db.GetCMTS(1)
+	cmts.CMCommunityString = ""
+	cmts.CommunityWrite = ""
+	if err := db.UpdateCMTS(cmts); err != nil {
+		t.Fatalf("Failed to update CMTS: %v", err)
+	}
+	if _, err := engine.RebootModem(1); err != models.ErrNoModemCommunity {
+		t.Errorf("Expected ErrNoModemCommunity, got %v", err)
+	}
+
+	err = db.UpsertModem(&models.CableModem{CMTSID: 1, MACAddress: "00:01:5C:11:22:33", Status: "online"})
+	if err != nil {
+		t.Fatalf("Failed to update modem: %v", err)
+	}
+	if _, err := engine.RebootModem(1); err != models.ErrModemNoIP {
+		t.Errorf("Expected ErrModemNoIP, got %v", err)
+	}
+	if client.rebooted != 1 {
+		t.Errorf("Expected no further reboots, got %d", client.rebooted)
+	}
+}
+
+func TestRefreshModem(t *testing.T) {
+	db, err := database.NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	client := &stubModemClient{state: snmp.ModemState{
+		SysDescr:   "Arris SB8200 SW_REV: 2.1.0",
+		Firmware:   "2.1.0",
+		ConfigFile: "gold-100x20.cfg",
+		Status:     "denied",
+		Signal:     -3.5,
+		SignalOK:   true,
+	}}
+	engine := newStubEngine(t, db, client)
+
+	if _, err := engine.RefreshModem(999); err != models.ErrNotFound {
+		t.Errorf("Expected ErrNotFound for unknown modem, got %v", err)
+	}
+
+	modem, err := engine.RefreshModem(1)
+	if err != nil {
+		t.Fatalf("Failed to refresh modem: %v", err)
+	}
+	if modem.SysDescr != client.state.SysDescr || modem.CurrentFirmware != "2.1.0" ||
+		modem.ConfigFile != "gold-100x20.cfg" || modem.Status != "denied" || modem.SignalLevel != -3.5 {
+		t.Errorf("Expected live readings, got sysdescr %q firmware %q config file %q status %q signal %v",
+			modem.SysDescr, modem.CurrentFirmware, modem.ConfigFile, modem.Status, modem.SignalLevel)
+	}
+	stored, _ := db.GetModem(1)
+	if stored.Status != "denied" {
+		t.Errorf("Expected refreshed status to be stored, got %q", stored.Status)
+	}
+
+	// Unreported readings keep their cached values
+	client.state = snmp.ModemState{SysDescr: "Arris SB8200 SW_REV: 2.1.0", Firmware: "2.1.0"}
+	modem, err = engine.RefreshModem(1)
+	if err != nil {
+		t.Fatalf("Failed to refresh modem: %v", err)
+	}
+	if modem.Status != "denied" || modem.SignalLevel != -3.5 || modem.ConfigFile != "gold-100x20.cfg" {
+		t.Errorf("Expected cached status, signal and config file, got %q, %v and %q", modem.Status, modem.SignalLevel, modem.ConfigFile)
+	}
+
+	engine.refreshTimeout = 10 * time.Millisecond
+	client.stateDelay = 200 * time.Millisecond
+	client.state.Status = "offline"
+	if _, err := engine.RefreshModem(1); err == nil {
+		t.Error("Expected a slow modem to time out")
+	}
+	time.Sleep(250 * time.Millisecond)
+	if stored, _ := db.GetModem(1); stored.Status != "denied" {
+		t.Errorf("A timed out refresh should not be stored, got status %q", stored.Status)
+	}
+}
+
+func TestVerifyFirmwareSuccess(t *testing.T) {
+	db, err := database.NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	// Modem is still rebooting on the old image for the first read
+	client := &stubModemClient{firmwares: []string{"1.0.0", "2.0.0"}}
+	engine := newStubEngine(t, db, client)
+
+	modem, err := db.GetModem(1)
+	if err != nil {
+		t.Fatalf("Failed to get modem: %v", err)
+	}
+	job := &models.UpgradeJob{ID: 1, MACAddress: modem.MACAddress, FirmwareFilename: "firmware-v2.0.0.bin"}
+
+	if err := engine.verifyFirmware(context.Background(), job, modem, "private"); err != nil {
+		t.Fatalf("Expected verification to succeed, got %v", err)
+	}
+
+	updated, err := db.GetModem(1)
+	if err != nil {
+		t.Fatalf("Failed to get modem: %v", err)
+	}
+	if updated.CurrentFirmware != "2.0.0" {
+		t.Errorf("Expected observed firmware 2.0.0 recorded, got %s", updated.CurrentFirmware)
+	}
+	if updated.ExpectedFirmware != "2.0.0" {
+		t.Errorf("Expected verified firmware 2.0.0 to become expected, got %q", updated.ExpectedFirmware)
+	}
+}
+
+func TestVerifyFirmwareMismatch(t *testing.T) {
+	db, err := database.NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	client := &stubModemClient{firmwares: []string{"1.0.0"}}
+	engine := newStubEngine(t, db, client)
+
+	modem, err := db.GetModem(1)
+	if err != nil {
+		t.Fatalf("Failed to get modem: %v", err)
+	}
+	job := &models.UpgradeJob{ID: 1, MACAddress: modem.MACAddress, FirmwareFilename: "firmware-v2.0.0.bin"}
+
+	err = engine.verifyFirmware(context.Background(), job, modem, "private")
+	if err == nil {
+		t.Fatal("Expected verification to fail when firmware did not change")
+	}
+	if !strings.Contains(err.Error(), "modem still on 1.0.0") {
+		t.Errorf("Unexpected error message: %v", err)
+	}
+}
+
+func TestExecuteUpgradeVerifiesFirmwareExists(t *testing.T) {
+	tests := []struct {
+		name          string
+		setting       string
+		transport     string
+		probeErr      error
+		wantErr       bool
+		wantTriggered int
+		wantProbed    bool
+	}{
+		{"file present", "true", "", nil, false, 1, true},
+		{"file missing", "true", "", tftp.ErrFileNotFound, true, 0, true},
+		{"server unreachable", "true", "", fmt.Errorf("no reply from TFTP server"), false, 1, true},
+		{"check disabled", "false", "", tftp.ErrFileNotFound, false, 1, false},
+		{"http transport", "true", models.TransportHTTP, tftp.ErrFileNotFound, false, 1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := database.NewTestDB()
+			if err != nil {
+				t.Fatalf("Failed to create test database: %v", err)
+			}
+			defer db.Close()
+
+			if err := db.LoadTestFixtures(); err != nil {
+				t.Fatalf("Failed to load fixtures: %v", err)
+			}
+			db.SetSetting("verify_firmware_exists", tt.setting)
+
+			client := &stubModemClient{firmwares: []string{"2.0.0"}}
+			engine := newStubEngine(t, db, client)
+
+			probed := false
+			engine.probeFirmware = func(server, filename string) error {
+				probed = true
+				if server != "192.168.1.50" || filename != "firmware-v2.0.0.bin" {
+					t.Errorf("Unexpected probe for %s on %s", filename, server)
+				}
+				return tt.probeErr
+			}
+
+			job := &models.UpgradeJob{
+				ModemID:           1,
+				RuleID:            1,
+				CMTSID:            1,
+				MACAddress:        "00:01:5C:11:22:33",
+				Status:            models.JobStatusInProgress,
+				TFTPServerIP:      "192.168.1.50",
+				FirmwareFilename:  "firmware-v2.0.0.bin",
+				TransportProtocol: tt.transport,
+				MaxRetries:        3,
+			}
+
+			_, err = engine.executeUpgrade(context.Background(), job)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("executeUpgrade() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !strings.Contains(err.Error(), "firmware not found on TFTP server") {
+				t.Errorf("Expected firmware not found error, got %v", err)
+			}
+			if client.triggered != tt.wantTriggered {
+				t.Errorf("Expected %d triggers, got %d", tt.wantTriggered, client.triggered)
+			}
+			if probed != tt.wantProbed {
+				t.Errorf("Expected probed=%v, got %v", tt.wantProbed, probed)
+			}
+		})
+	}
+}
+
+func TestExecuteUpgradeReportsVersionChange(t *testing.T) {
+	db, err := database.NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	// Oper-status never reports completion; only the version flip does
+	client := &stubModemClient{
+		statuses:  []string{"in_progress"},
+		versions:  []string{"1.0.0", "1.0.0", "2.0.0"},
+		firmwares: []string{"2.0.0"},
+	}
+	engine := newStubEngine(t, db, client)
+
+	events, unsubscribe := engine.Subscribe()
+	defer unsubscribe()
+
+	job := &models.UpgradeJob{
+		ID:               42,
+		ModemID:          1,
+		RuleID:           1,
+		CMTSID:           1,
+		MACAddress:       "00:01:5C:11:22:33",
+		Status:           models.JobStatusInProgress,
+		TFTPServerIP:     "192.168.1.50",
+		FirmwareFilename: "firmware-v2.0.0.bin",
+		MaxRetries:       3,
+	}
+
+	if _, err := engine.executeUpgrade(context.Background(), job); err != nil {
+		t.Fatalf("executeUpgrade() error = %v", err)
+	}
+
+	var versions []string
+	for len(events) > 0 {
+		event := <-events
+		if event.JobID == 42 && event.CurrentVersion != "" {
+			versions = append(versions, event.CurrentVersion)
+		}
+	}
+
+	if len(versions) != 2 || versions[0] != "1.0.0" || versions[1] != "2.0.0" {
+		t.Errorf("Expected version events [1.0.0 2.0.0], got %v", versions)
+	}
+}
+
+func TestTriggerOverridesFollowRule(t *testing.T) {
+	db, err := database.NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	rule, err := db.GetRule(1)
+	if err != nil {
+		t.Fatalf("Failed to get rule: %v", err)
+	}
+	rule.AdminStatusValue = 2
+	rule.CustomUpgradeOID = "1.3.6.1.4.1.4115.1.3.4.1.1.5.0"
+	rule.TransportProtocol = models.TransportHTTP
+	if err := db.UpdateRule(rule); err != nil {
+		t.Fatalf("Failed to update rule: %v", err)
+	}
+
+	client := &stubModemClient{firmwares: []string{"2.0.0"}}
+	engine := newStubEngine(t, db, client)
+
+	if err := engine.EvaluateRules(); err != nil {
+		t.Fatalf("Failed to evaluate rules: %v", err)
+	}
+	jobs, err := db.ListJobs(models.JobStatusPending, 10)
+	if err != nil || len(jobs) != 1 {
+		t.Fatalf("Expected one pending job, got %d (%v)", len(jobs), err)
+	}
+	job := jobs[0]
+	if job.AdminStatusValue != 2 || job.CustomUpgradeOID != rule.CustomUpgradeOID {
+		t.Errorf("Expected job to copy the rule's trigger overrides, got %d %q", job.AdminStatusValue, job.CustomUpgradeOID)
+	}
+	if job.TransportProtocol != models.TransportHTTP {
+		t.Errorf("Expected job to copy the rule's transport, got %q", job.TransportProtocol)
+	}
+
+	if _, err := engine.executeUpgrade(context.Background(), job); err != nil {
+		t.Fatalf("executeUpgrade() error = %v", err)
+	}
+	if client.adminValue != 2 || client.oid != rule.CustomUpgradeOID || client.transport != models.TransportHTTP {
+		t.Errorf("Expected trigger with overrides, got %d %q %q", client.adminValue, client.oid, client.transport)
+	}
+}
+
+func TestRunDiscoveryForAllCMTSConcurrencyCap(t *testing.T) {
+	db, err := database.NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	for i := 1; i <= 6; i++ {
+		_, err := db.CreateCMTS(&models.CMTS{
+			Name:          fmt.Sprintf("CMTS %d", i),
+			IPAddress:     fmt.Sprintf("192.168.1.%d", i),
+			SNMPPort:      161,
+			CommunityRead: "public",
+			SNMPVersion:   2,
+			Enabled:       true,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create CMTS: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		concurrency int
+		wantMax     int
+	}{
+		{"capped", 2, 2},
+		{"unlimited", 0, 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := New(db, Config{
+				Workers:              1,
+				PollInterval:         30 * time.Second,
+				DiscoveryConcurrency: tt.concurrency,
+			})
+
+			var mu sync.Mutex
+			running, maxRunning := 0, 0
+			var wg sync.WaitGroup
+			wg.Add(6)
+			release := make(chan struct{})
+
+			engine.discover = func(cmtsID int) error {
+				defer wg.Done()
+				mu.Lock()
+				running++
+				if running > maxRunning {
+					maxRunning = running
+				}
+				mu.Unlock()
+
+				<-release
+
+				mu.Lock()
+				running--
+				mu.Unlock()
+				return nil
+			}
+
+			engine.runDiscoveryForAllCMTS(context.Background())
+
+			// Give every goroutine a chance to start or queue
+			time.Sleep(100 * time.Millisecond)
+			close(release)
+			wg.Wait()
+
+			if maxRunning != tt.wantMax {
+				t.Errorf("Expected at most %d concurrent discoveries, got %d", tt.wantMax, maxRunning)
+			}
+		})
+	}
+}
+
+func TestSNMPBudgetPrioritizeUpgrades(t *testing.T) {
+	db, err := database.NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	engine := New(db, Config{
+		Workers:          1,
+		PollInterval:     30 * time.Second,
+		SNMPBudget:       4,
+		SchedulingPolicy: SchedulingPrioritizeUpgrades,
+	})
+
+	// Upgrades hold three of the four slots
+	for i := 0; i < 3; i++ {
+		if !engine.snmpBudget.TryAcquire(true) {
+			t.Fatalf("Expected upgrade %d to get a slot", i+1)
+		}
+	}
+
+	discovered := make(chan int, 1)
+	engine.discover = func(cmtsID int) error {
+		discovered <- cmtsID
+		return nil
+	}
+
+	engine.runDiscoveryForAllCMTS(context.Background())
+
+	// A slot is free, but discovery yields while upgrades hold most of the budget
+	select {
+	case <-discovered:
+		t.Fatal("Expected discovery to be throttled while upgrades hold most of the budget")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Upgrades can still take the last slot
+	if !engine.snmpBudget.TryAcquire(true) {
+		t.Fatal("Expected upgrade to take the last slot")
+	}
+	engine.snmpBudget.Release(true)
+
+	// Once upgrades are back to half the budget, discovery proceeds
+	engine.snmpBudget.Release(true)
+	select {
+	case id := <-discovered:
+		if id != 1 {
+			t.Errorf("Expected discovery of CMTS 1, got %d", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected discovery to run after upgrades released the budget")
+	}
+}
+
+func TestSNMPBudgetPolicies(t *testing.T) {
+	fair := newSNMPBudget(2, SchedulingFair)
+	if !fair.TryAcquire(true) || !fair.TryAcquire(false) {
+		t.Fatal("Expected fair policy to hand out free slots to either side")
+	}
+	if fair.TryAcquire(true) || fair.TryAcquire(false) {
+		t.Error("Expected a full budget to refuse new work")
+	}
+
+	discovery := newSNMPBudget(4, SchedulingPrioritizeDiscovery)
+	for i := 0; i < 3; i++ {
+		discovery.TryAcquire(false)
+	}
+	if discovery.TryAcquire(true) {
+		t.Error("Expected upgrades to yield while discovery holds most of the budget")
+	}
+	if !discovery.TryAcquire(false) {
+		t.Error("Expected discovery to take the last slot")
+	}
+}
+
+func TestRunDiscoveryForAllCMTSSkipsDeleted(t *testing.T) {
+	db, err := database.NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+	if err := db.DeleteCMTS(1); err != nil {
+		t.Fatalf("Failed to delete CMTS: %v", err)
+	}
+
+	engine := New(db, Config{Workers: 1, PollInterval: 30 * time.Second})
+
+	called := make(chan int, 1)
+	engine.discover = func(cmtsID int) error {
+		called <- cmtsID
+		return nil
+	}
+
+	engine.runDiscoveryForAllCMTS(context.Background())
+
+	select {
+	case id := <-called:
+		t.Errorf("Expected soft-deleted CMTS to be skipped, discovered %d", id)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestRunCleanupPurgesJobHistory(t *testing.T) {
+	db, err := database.NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	jobID, err := db.CreateJob(&models.UpgradeJob{
+		ModemID:    1,
+		RuleID:     1,
+		CMTSID:     1,
+		MACAddress: "00:01:5C:11:22:33",
+		Status:     models.JobStatusCompleted,
+		MaxRetries: 3,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+
+	engine := New(db, Config{Workers: 1, PollInterval: 30 * time.Second})
+
+	// Retention of 0 keeps everything
+	db.SetSetting("job_retention_days", "0")
+	engine.runCleanup()
+	if _, err := db.GetJob(jobID); err != nil {
+		t.Fatalf("Expected job to be kept with retention disabled: %v", err)
+	}
+
+	// Age the job past a one day retention
+	job, _ := db.GetJob(jobID)
+	completed := time.Now().Add(-48 * time.Hour)
+	job.CompletedAt = &completed
+	db.UpdateJob(job)
+
+	db.SetSetting("job_retention_days", "1")
+	engine.runCleanup()
+
+	if _, err := db.GetJob(jobID); err != models.ErrNotFound {
+		t.Errorf("Expected old job to be purged, got %v", err)
+	}
+
+	logs, _ := db.ListActivityLogs(database.ActivityLogFilter{}, 10, 0)
+	found := false
+	for _, entry := range logs {
+		if strings.HasPrefix(entry.Message, "Purged 1 jobs") {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("Expected an activity log summarizing the purge")
+	}
+}
+
+func TestQueueManualUpgrade(t *testing.T) {
+	db, err := database.NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	engine := New(db, Config{Workers: 1, MaxPerCMTS: 5, PollInterval: 30 * time.Second})
+
+	if _, err := engine.QueueManualUpgrade(1, "", "firmware-v2.0.0.bin"); err != models.ErrInvalidTFTPServer {
+		t.Errorf("Expected ErrInvalidTFTPServer, got %v", err)
+	}
+	if _, err := engine.QueueManualUpgrade(999, "192.168.1.50", "firmware-v2.0.0.bin"); err != models.ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	job, err := engine.QueueManualUpgrade(1, "192.168.1.50", "firmware-v2.0.0.bin")
+	if err != nil {
+		t.Fatalf("QueueManualUpgrade failed: %v", err)
+	}
+	stored, err := db.GetJob(job.ID)
+	if err != nil {
+		t.Fatalf("Failed to get job: %v", err)
+	}
+	if stored.Status != models.JobStatusPending || stored.RuleID != 0 || stored.CampaignID != 0 {
+		t.Errorf("Expected pending job with no rule or campaign, got %+v", stored)
+	}
+	if stored.TFTPServerIP != "192.168.1.50" || stored.FirmwareFilename != "firmware-v2.0.0.bin" {
+		t.Errorf("Unexpected job target %s/%s", stored.TFTPServerIP, stored.FirmwareFilename)
+	}
+
+	if _, err := engine.QueueManualUpgrade(1, "192.168.1.50", "firmware-v2.0.0.bin"); err != models.ErrUpgradeActive {
+		t.Errorf("Expected ErrUpgradeActive with a job pending, got %v", err)
+	}
+
+	if err := db.UpsertModem(&models.CableModem{
+		CMTSID:     1,
+		MACAddress: "AA:BB:CC:00:00:01",
+		IPAddress:  "10.0.1.1",
+		Status:     "offline",
+	}); err != nil {
+		t.Fatalf("Failed to create modem: %v", err)
+	}
+	offline, _ := db.GetModemByMAC("AA:BB:CC:00:00:01")
+	if _, err := engine.QueueManualUpgrade(offline.ID, "192.168.1.50", "firmware-v2.0.0.bin"); err != models.ErrModemOffline {
+		t.Errorf("Expected ErrModemOffline, got %v", err)
+	}
+
+	// The eligible_statuses setting applies as it does to rules
+	if err := db.SetSetting("eligible_statuses", "online,offline"); err != nil {
+		t.Fatalf("Failed to set eligible_statuses: %v", err)
+	}
+	if _, err := engine.QueueManualUpgrade(offline.ID, "192.168.1.50", "firmware-v2.0.0.bin"); err != nil {
+		t.Errorf("Expected offline modem queued once eligible, got %v", err)
+	}
+}
+
+func TestEvaluateRulesDryRunOncePerModem(t *testing.T) {
+	db, err := database.NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	rule, _ := db.GetRule(1)
+	rule.DryRun = true
+	if err := db.UpdateRule(rule); err != nil {
+		t.Fatalf("Failed to update rule: %v", err)
+	}
+
+	engine := New(db, Config{Workers: 1, PollInterval: 30 * time.Second})
+	if err := engine.EvaluateRules(); err != nil {
+		t.Fatalf("Failed to evaluate rules: %v", err)
+	}
+	jobs, _ := db.ListJobs("", 0)
+	if len(jobs) != 1 {
+		t.Fatalf("Expected 1 dry-run job, got %d", len(jobs))
+	}
+
+	// The dry run completes but the modem keeps its firmware
+	jobs[0].Status = models.JobStatusCompleted
+	if err := db.UpdateJob(jobs[0]); err != nil {
+		t.Fatalf("Failed to complete job: %v", err)
+	}
+
+	if err := engine.EvaluateRules(); err != nil {
+		t.Fatalf("Failed to evaluate rules: %v", err)
+	}
+	if jobs, _ = db.ListJobs("", 0); len(jobs) != 1 {
+		t.Errorf("Expected no second dry-run job for the modem, got %d jobs", len(jobs))
+	}
+
+	// A new target is a new dry run
+	rule.FirmwareFilename = "firmware-v3.0.0.bin"
+	if err := db.UpdateRule(rule); err != nil {
+		t.Fatalf("Failed to update rule: %v", err)
+	}
+	if err := engine.EvaluateRules(); err != nil {
+		t.Fatalf("Failed to evaluate rules: %v", err)
+	}
+	if jobs, _ = db.ListJobs("", 0); len(jobs) != 2 {
+		t.Errorf("Expected a dry-run job for the new firmware, got %d jobs", len(jobs))
+	}
+}
+
+func TestProcessJobDryRunRule(t *testing.T) {
+	db, err := database.NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	dryRunID, err := db.CreateRule(&models.UpgradeRule{
+		Name:             "Canary Rule",
+		MatchType:        "MAC_RANGE",
+		MatchCriteria:    `{"start_mac":"AA:BB:CC:00:00:00","end_mac":"AA:BB:CC:FF:FF:FF"}`,
+		TFTPServerIP:     "192.168.1.50",
+		FirmwareFilename: "firmware-v3.0.0.bin",
+		Enabled:          true,
+		DryRun:           true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create rule: %v", err)
+	}
+	err = db.UpsertModem(&models.CableModem{
+		CMTSID:          1,
+		MACAddress:      "AA:BB:CC:11:22:33",
+		IPAddress:       "10.0.0.101",
+		CurrentFirmware: "1.0.0",
+		Status:          "online",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create modem: %v", err)
+	}
+	var canary *models.CableModem
+	modems, _ := db.ListModems(0)
+	for _, m := range modems {
+		if m.MACAddress == "AA:BB:CC:11:22:33" {
+			canary = m
+		}
+	}
+	if canary == nil {
+		t.Fatal("Failed to find canary modem")
+	}
+
+	payloads := make(chan webhookPayload, 10)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload webhookPayload
+		json.NewDecoder(r.Body).Decode(&payload)
+		payloads <- payload
+	}))
+	defer hook.Close()
+	if err := db.SetSetting("webhook_url", hook.URL); err != nil {
+		t.Fatalf("Failed to set webhook_url: %v", err)
+	}
+
+	client := &stubModemClient{firmwares: []string{"2.0.0"}}
+	engine := newStubEngine(t, db, client)
+
+	jobs := map[string]*models.UpgradeJob{
+		"real":    {ModemID: 1, RuleID: 1, CMTSID: 1, MACAddress: "00:01:5C:11:22:33", FirmwareFilename: "firmware-v2.0.0.bin"},
+		"dry-run": {ModemID: canary.ID, RuleID: dryRunID, CMTSID: 1, MACAddress: canary.MACAddress, FirmwareFilename: "firmware-v3.0.0.bin"},
+	}
+	for name, job := range jobs {
+		job.Status = models.JobStatusPending
+		job.TFTPServerIP = "192.168.1.50"
+		job.MaxRetries = 3
+		id, err := db.CreateJob(job)
+		if err != nil {
+			t.Fatalf("Failed to create %s job: %v", name, err)
+		}
+		job.ID = id
+
+		if err := engine.processJob(context.Background(), job); err != nil {
+			t.Fatalf("Failed to process %s job: %v", name, err)
+		}
+
+		stored, _ := db.GetJob(id)
+		if stored.Status != models.JobStatusCompleted {
+			t.Errorf("Expected %s job COMPLETED, got %s", name, stored.Status)
+		}
+	}
+
+	if client.triggered != 1 {
+		t.Errorf("Expected only the real rule to trigger SNMP, got %d triggers", client.triggered)
+	}
+	if processed := engine.Status().JobsProcessed; processed != 2 {
+		t.Errorf("Expected 2 jobs processed, got %d", processed)
+	}
+
+	logs, _ := db.ListActivityLogs(database.ActivityLogFilter{}, 50, 0)
+	found := false
+	for _, entry := range logs {
+		if entry.EventType == models.EventUpgradeDryRun && entry.EntityID == jobs["dry-run"].ID {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("Expected a dry run activity log for the canary job")
+	}
+
+	// The dry run must not be reported to the webhook as a real upgrade
+	events := map[int]string{}
+	for len(events) < 2 {
+		select {
+		case payload := <-payloads:
+			events[payload.JobID] = payload.Event
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected a webhook per job, got %v", events)
+		}
+	}
+	if events[jobs["real"].ID] != models.EventUpgradeCompleted {
+		t.Errorf("Expected %s for the real job, got %q", models.EventUpgradeCompleted, events[jobs["real"].ID])
+	}
+	if events[jobs["dry-run"].ID] != models.EventUpgradeDryRun {
+		t.Errorf("Expected %s for the dry run job, got %q", models.EventUpgradeDryRun, events[jobs["dry-run"].ID])
+	}
+}
+
+func TestSubscribeJobEvents(t *testing.T) {
+	db, err := database.NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	engine := New(db, Config{Workers: 1, PollInterval: 30 * time.Second})
+
+	events, unsubscribe := engine.Subscribe()
+
+	engine.publishJobEvent(&models.UpgradeJob{ID: 7, MACAddress: "00:01:5C:11:22:33", Status: models.JobStatusInProgress})
+
+	select {
+	case event := <-events:
+		if event.JobID != 7 || event.Status != models.JobStatusInProgress {
+			t.Errorf("Unexpected event: %+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected job event")
+	}
+
+	unsubscribe()
+	unsubscribe()
+
+	if _, ok := <-events; ok {
+		t.Error("Expected channel to be closed after unsubscribe")
+	}
+
+	// Publishing with no subscribers must not block or panic
+	engine.publishJobEvent(&models.UpgradeJob{ID: 8, Status: models.JobStatusCompleted})
+}
+
+// startStubEngine runs engine.Start in the background with discovery stubbed
+// out and returns a channel closed when Start returns
+func startStubEngine(t *testing.T, engine *Engine) <-chan struct{} {
+	t.Helper()
+	engine.discover = func(cmtsID int) error { return nil }
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		engine.Start(context.Background())
+	}()
+	return done
+}
+
+// queueInProgressJob queues a pending job and waits for a worker to pick it up
+func queueInProgressJob(t *testing.T, db *database.DB, engine *Engine) int {
+	t.Helper()
+	job := &models.UpgradeJob{
+		ModemID:          1,
+		RuleID:           1,
+		CMTSID:           1,
+		MACAddress:       "00:01:5C:11:22:33",
+		Status:           models.JobStatusPending,
+		TFTPServerIP:     "192.168.1.50",
+		FirmwareFilename: "firmware-v2.0.0.bin",
+		MaxRetries:       3,
+	}
+	id, err := db.CreateJob(job)
+	if err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+	job.ID = id
+	engine.jobs <- job
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if stored, _ := db.GetJob(id); stored != nil && stored.Status == models.JobStatusInProgress {
+			return id
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("Job never started")
+	return 0
+}
+
+func TestShutdownSequence(t *testing.T) {
+	db, err := database.NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	client := &stubModemClient{
+		statuses:  []string{"in_progress", "in_progress", "in_progress", "in_progress", "completed"},
+		firmwares: []string{"2.0.0"},
+	}
+	engine := newStubEngine(t, db, client)
+	done := startStubEngine(t, engine)
+	jobID := queueInProgressJob(t, db, engine)
+
+	// The HTTP server must only stop once the in-flight upgrade has finished
+	var statusAtHTTPStop string
+	stopHTTP := func(ctx context.Context) error {
+		if stored, err := db.GetJob(jobID); err == nil {
+			statusAtHTTPStop = stored.Status
+		}
+		return nil
+	}
+
+	timeout := 5 * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	report := engine.Shutdown(ctx, stopHTTP)
+	if err := report.Err(); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+
+	want := []string{PhaseDrainJobs, PhaseStopSchedulers, PhaseStopHTTP, PhaseCloseDatabase}
+	if len(report.Phases) != len(want) {
+		t.Fatalf("Expected %d phases, got %+v", len(want), report.Phases)
+	}
+	for i, phase := range report.Phases {
+		if phase.Name != want[i] {
+			t.Errorf("Phase %d = %s, want %s", i, phase.Name, want[i])
+		}
+	}
+	if report.DurationMS >= timeout.Milliseconds() {
+		t.Errorf("Shutdown took %dms, expected under %v", report.DurationMS, timeout)
+	}
+	if report.InterruptedJobs != 0 {
+		t.Errorf("Expected no interrupted jobs, got %d", report.InterruptedJobs)
+	}
+	if statusAtHTTPStop != models.JobStatusCompleted {
+		t.Errorf("Expected job COMPLETED before HTTP stopped, got %q", statusAtHTTPStop)
+	}
+	if err := db.Ping(); err == nil {
+		t.Error("Expected database to be closed")
+	}
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("Start should return after Shutdown")
+	}
+}
+
+func TestShutdownDrainTimeout(t *testing.T) {
+	db, err := database.NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	// The upgrade never finishes on its own
+	client := &stubModemClient{statuses: []string{"in_progress"}}
+	engine := newStubEngine(t, db, client)
+	done := startStubEngine(t, engine)
+	queueInProgressJob(t, db, engine)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	report := engine.Shutdown(ctx, nil)
+	if report.Err() == nil {
+		t.Fatal("Expected drain to time out")
+	}
+	if report.InterruptedJobs != 1 {
+		t.Errorf("Expected 1 interrupted job, got %d", report.InterruptedJobs)
+	}
+
+	// Later phases still run, and the database is closed last
+	want := []string{PhaseDrainJobs, PhaseStopSchedulers, PhaseCloseDatabase}
+	if len(report.Phases) != len(want) {
+		t.Fatalf("Expected %d phases, got %+v", len(want), report.Phases)
+	}
+	for i, phase := range report.Phases {
+		if phase.Name != want[i] {
+			t.Errorf("Phase %d = %s, want %s", i, phase.Name, want[i])
+		}
+	}
+	if report.Phases[0].Error == "" {
+		t.Error("Expected the drain phase to report the timeout")
+	}
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("Start should return after Shutdown")
+	}
+}
+
+func TestCampaignPacing(t *testing.T) {
+	db, err := database.NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	for i := 1; i <= 5; i++ {
+		if err := db.UpsertModem(&models.CableModem{
+			CMTSID:          1,
+			MACAddress:      fmt.Sprintf("AA:BB:CC:00:00:%02X", i),
+			IPAddress:       fmt.Sprintf("10.0.1.%d", i),
+			CurrentFirmware: "1.0.0",
+			SignalLevel:     5.0,
+			Status:          "online",
+		}); err != nil {
+			t.Fatalf("Failed to create modem: %v", err)
+		}
+	}
+
+	start := time.Date(2024, 11, 8, 10, 0, 0, 0, time.UTC)
+	campaignID, err := db.CreateCampaign(&models.Campaign{
+		Name:             "Paced rollout",
+		MatchType:        "MAC_RANGE",
+		MatchCriteria:    `{"start_mac":"AA:BB:CC:00:00:00","end_mac":"AA:BB:CC:FF:FF:FF"}`,
+		TFTPServerIP:     "192.168.1.50",
+		FirmwareFilename: "firmware-v2.0.0.bin",
+		StartAt:          start,
+		RatePerMinute:    2,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create campaign: %v", err)
+	}
+
+	engine := New(db, Config{Workers: 1, PollInterval: 30 * time.Second})
+	var clock time.Time
+	engine.now = func() time.Time { return clock }
+
+	steps := []struct {
+		at         time.Duration
+		wantJobs   int
+		wantStatus string
+	}{
+		{-time.Minute, 0, models.CampaignStatusScheduled},
+		{0, 2, models.CampaignStatusRunning},
+		{30 * time.Second, 2, models.CampaignStatusRunning},
+		{time.Minute, 4, models.CampaignStatusRunning},
+		{2 * time.Minute, 5, models.CampaignStatusCompleted},
+		{3 * time.Minute, 5, models.CampaignStatusCompleted},
+	}
+	for _, step := range steps {
+		clock = start.Add(step.at)
+		engine.runCampaigns()
+
+		campaign, err := db.GetCampaign(campaignID)
+		if err != nil {
+			t.Fatalf("Failed to get campaign: %v", err)
+		}
+		if campaign.JobsCreated != step.wantJobs || campaign.Status != step.wantStatus {
+			t.Errorf("At %v: got %d jobs, %s; want %d jobs, %s",
+				step.at, campaign.JobsCreated, campaign.Status, step.wantJobs, step.wantStatus)
+		}
+	}
+
+	jobs, err := db.ListJobs(models.JobStatusPending, 100)
+	if err != nil {
+		t.Fatalf("Failed to list jobs: %v", err)
+	}
+	if len(jobs) != 5 {
+		t.Fatalf("Expected 5 campaign jobs, got %d", len(jobs))
+	}
+	for _, job := range jobs {
+		if job.CampaignID != campaignID || job.RuleID != 0 {
+			t.Errorf("Expected job for campaign %d with no rule, got campaign %d rule %d",
+				campaignID, job.CampaignID, job.RuleID)
+		}
+		if !strings.HasPrefix(job.MACAddress, "AA:BB:CC") {
+			t.Errorf("Job created for modem outside the target: %s", job.MACAddress)
+		}
+	}
+
+	campaign, _ := db.GetCampaign(campaignID)
+	if campaign.CompletedAt == nil || !campaign.CompletedAt.Equal(start.Add(2*time.Minute)) {
+		t.Errorf("Expected completion at the third minute, got %v", campaign.CompletedAt)
+	}
+}
+
+func TestCampaignPacingBacklog(t *testing.T) {
+	db, err := database.NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	for i := 1; i <= 10; i++ {
+		if err := db.UpsertModem(&models.CableModem{
+			CMTSID:          1,
+			MACAddress:      fmt.Sprintf("AA:BB:CC:00:00:%02X", i),
+			IPAddress:       fmt.Sprintf("10.0.1.%d", i),
+			CurrentFirmware: "1.0.0",
+			SignalLevel:     5.0,
+			Status:          "online",
+		}); err != nil {
+			t.Fatalf("Failed to create modem: %v", err)
+		}
+	}
+
+	// The engine first sees the campaign ten minutes after it started, e.g.
+	// after being paused
+	start := time.Date(2024, 11, 8, 10, 0, 0, 0, time.UTC)
+	campaignID, err := db.CreateCampaign(&models.Campaign{
+		Name:             "Late rollout",
+		MatchType:        "MAC_RANGE",
+		MatchCriteria:    `{"start_mac":"AA:BB:CC:00:00:00","end_mac":"AA:BB:CC:FF:FF:FF"}`,
+		TFTPServerIP:     "192.168.1.50",
+		FirmwareFilename: "firmware-v2.0.0.bin",
+		StartAt:          start,
+		RatePerMinute:    4,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create campaign: %v", err)
+	}
+
+	engine := New(db, Config{Workers: 1, PollInterval: 30 * time.Second})
+	var clock time.Time
+	engine.now = func() time.Time { return clock }
+
+	// The backlog drains a minute's worth at a time, not in one tick
+	for i, want := range []int{4, 4, 4, 4, 8, 8} {
+		clock = start.Add(10*time.Minute + time.Duration(i)*engine.campaignInterval)
+		engine.runCampaigns()
+
+		campaign, err := db.GetCampaign(campaignID)
+		if err != nil {
+			t.Fatalf("Failed to get campaign: %v", err)
+		}
+		if campaign.JobsCreated != want {
+			t.Errorf("Tick %d: got %d jobs, want %d", i, campaign.JobsCreated, want)
+		}
+	}
+}
+
+func TestCampaignUnpacedAndCancel(t *testing.T) {
+	db, err := database.NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	for i := 1; i <= 6; i++ {
+		if err := db.UpsertModem(&models.CableModem{
+			CMTSID:          1,
+			MACAddress:      fmt.Sprintf("AA:BB:CC:00:00:%02X", i),
+			IPAddress:       fmt.Sprintf("10.0.1.%d", i),
+			CurrentFirmware: "1.0.0",
+			SignalLevel:     5.0,
+			Status:          "online",
+		}); err != nil {
+			t.Fatalf("Failed to create modem: %v", err)
+		}
+	}
+
+	start := time.Date(2024, 11, 9, 2, 0, 0, 0, time.UTC)
+	newCampaign := func(name, startMAC, endMAC string, rate int) int {
+		id, err := db.CreateCampaign(&models.Campaign{
+			Name:             name,
+			MatchType:        "MAC_RANGE",
+			MatchCriteria:    fmt.Sprintf(`{"start_mac":"%s","end_mac":"%s"}`, startMAC, endMAC),
+			TFTPServerIP:     "192.168.1.50",
+			FirmwareFilename: "firmware-v2.0.0.bin",
+			StartAt:          start,
+			RatePerMinute:    rate,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create campaign: %v", err)
+		}
+		return id
+	}
+	unpacedID := newCampaign("Saturday rollout", "AA:BB:CC:00:00:00", "AA:BB:CC:00:00:03", 0)
+	pacedID := newCampaign("Paced rollout", "AA:BB:CC:00:00:04", "AA:BB:CC:00:00:FF", 2)
+
+	engine := New(db, Config{Workers: 1, PollInterval: 30 * time.Second})
+	engine.now = func() time.Time { return start }
+	engine.runCampaigns()
+
+	unpaced, err := db.GetCampaign(unpacedID)
+	if err != nil {
+		t.Fatalf("Failed to get campaign: %v", err)
+	}
+	if unpaced.JobsCreated != 3 || unpaced.Status != models.CampaignStatusCompleted {
+		t.Errorf("Expected unpaced campaign to create 3 jobs and complete, got %d jobs, %s",
+			unpaced.JobsCreated, unpaced.Status)
+	}
+
+	if err := engine.CancelCampaign(pacedID); err != nil {
+		t.Fatalf("CancelCampaign failed: %v", err)
+	}
+	if err := engine.CancelCampaign(pacedID); err != models.ErrCampaignFinished {
+		t.Errorf("Expected ErrCampaignFinished cancelling twice, got %v", err)
+	}
+
+	skipped, err := db.ListCampaignJobs(pacedID, models.JobStatusSkipped)
+	if err != nil {
+		t.Fatalf("Failed to list campaign jobs: %v", err)
+	}
+	if len(skipped) != 2 {
+		t.Errorf("Expected the 2 pending campaign jobs cancelled, got %d", len(skipped))
+	}
+
+	// Later ticks leave a cancelled campaign alone
+	engine.now = func() time.Time { return start.Add(5 * time.Minute) }
+	engine.runCampaigns()
+
+	paced, err := db.GetCampaign(pacedID)
+	if err != nil {
+		t.Fatalf("Failed to get campaign: %v", err)
+	}
+	if paced.JobsCreated != 2 || paced.Status != models.CampaignStatusCancelled {
+		t.Errorf("Expected cancelled campaign with 2 jobs, got %d jobs, %s", paced.JobsCreated, paced.Status)
+	}
+}
+
+func TestCampaignWaitsForBusyModems(t *testing.T) {
+	db, err := database.NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.LoadTestFixtures(); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	// The fixture modem is already being upgraded by a rule
+	ruleJobID, err := db.CreateJob(&models.UpgradeJob{
+		ModemID:    1,
+		RuleID:     1,
+		CMTSID:     1,
+		MACAddress: "00:01:5C:11:22:33",
+		Status:     models.JobStatusInProgress,
+		MaxRetries: 3,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+
+	start := time.Now()
+	campaignID, err := db.CreateCampaign(&models.Campaign{
+		Name:             "Fixture rollout",
+		MatchType:        "MAC_RANGE",
+		MatchCriteria:    `{"start_mac":"00:01:5C:00:00:00","end_mac":"00:01:5C:FF:FF:FF"}`,
+		TFTPServerIP:     "192.168.1.50",
+		FirmwareFilename: "firmware-v3.0.0.bin",
+		StartAt:          start,
+		RatePerMinute:    10,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create campaign: %v", err)
+	}
+
+	engine := New(db, Config{Workers: 1, PollInterval: 30 * time.Second})
+	engine.now = func() time.Time { return start }
+	engine.runCampaigns()
+
+	campaign, _ := db.GetCampaign(campaignID)
+	if campaign.JobsCreated != 0 || campaign.Remaining != 1 || campaign.Status != models.CampaignStatusRunning {
+		t.Fatalf("Expected campaign waiting on the busy modem, got %+v", campaign)
+	}
+
+	// Once the rule's upgrade finishes, the campaign covers the modem
+	job, _ := db.GetJob(ruleJobID)
+	job.Status = models.JobStatusCompleted
+	if err := db.UpdateJob(job); err != nil {
+		t.Fatalf("Failed to update job: %v", err)
+	}
+	engine.runCampaigns()
+
+	campaign, _ = db.GetCampaign(campaignID)
+	if campaign.JobsCreated != 1 || campaign.Status != models.CampaignStatusCompleted {
+		t.Errorf("Expected campaign completed with 1 job, got %+v", campaign)
+	}
 }
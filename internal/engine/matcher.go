@@ -1,47 +1,179 @@
 package engine
 
 import (
-	"encoding/json"
 	"fmt"
+	"hash/fnv"
 	"net"
 	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/rs/zerolog/log"
 	"github.com/awksedgreep/firmware-upgrader/internal/models"
 )
 
+// Default acceptable downstream signal range in dBmV
+const (
+	DefaultMinSignal = -15.0
+	DefaultMaxSignal = 15.0
+)
+
+// DefaultEligibleStatuses are the modem statuses eligible for upgrade unless
+// configured otherwise. Partially registered modems are left out because an
+// upgrade may not survive their impaired channels.
+var DefaultEligibleStatuses = []string{"online"}
+
+// DefaultPatternCacheSize bounds the number of compiled regexes a matcher keeps
+const DefaultPatternCacheSize = 256
+
+// firmwareVersionPattern finds a version (with or without 'v' prefix) in a filename
+var firmwareVersionPattern = regexp.MustCompile(`v?(\d+\.\d+\.\d+(?:\.\d+)*)`)
+
 // Matcher handles matching modems to upgrade rules
-type Matcher struct{}
+type Matcher struct {
+	MinSignal float64
+	MaxSignal float64
+
+	// EligibleStatuses lists the modem statuses FilterEligibleModems
+	// accepts; empty means DefaultEligibleStatuses
+	EligibleStatuses []string
+
+	// Parsed criteria are cached between BeginPass and EndPass. Passes are
+	// not safe for concurrent use; the engine serializes them.
+	criteria map[*models.UpgradeRule]*models.MatchCriteria
+
+	// Compiled patterns are cached across passes, keyed by pattern and
+	// cleared once PatternCacheSize entries accumulate. Zero disables caching.
+	PatternCacheSize int
+	patterns         map[string]compiledPattern
+	patternsMu       sync.Mutex
+	regexCompiles    int
+}
 
-// NewMatcher creates a new matcher
+// compiledPattern caches the outcome of compiling a regex, including failures
+type compiledPattern struct {
+	re  *regexp.Regexp
+	err error
+}
+
+// NewMatcher creates a new matcher with the default signal thresholds
 func NewMatcher() *Matcher {
-	return &Matcher{}
+	return NewMatcherWithThresholds(DefaultMinSignal, DefaultMaxSignal)
+}
+
+// NewMatcherWithThresholds creates a matcher with a custom acceptable signal range
+func NewMatcherWithThresholds(min, max float64) *Matcher {
+	return &Matcher{
+		MinSignal:        min,
+		MaxSignal:        max,
+		EligibleStatuses: append([]string(nil), DefaultEligibleStatuses...),
+		PatternCacheSize: DefaultPatternCacheSize,
+		patterns:         make(map[string]compiledPattern),
+	}
+}
+
+// BeginPass enables caching of parsed rule criteria until EndPass is called.
+// Rules must not be modified while a pass is active.
+func (m *Matcher) BeginPass() {
+	m.criteria = make(map[*models.UpgradeRule]*models.MatchCriteria)
+}
+
+// EndPass discards the cached rule criteria
+func (m *Matcher) EndPass() {
+	m.criteria = nil
+}
+
+// parseCriteria parses a rule's criteria, reusing the cached result during a pass
+func (m *Matcher) parseCriteria(rule *models.UpgradeRule) (*models.MatchCriteria, error) {
+	if criteria, ok := m.criteria[rule]; ok {
+		return criteria, nil
+	}
+
+	criteria, err := rule.ParseMatchCriteria()
+	if err != nil {
+		return nil, err
+	}
+
+	if m.criteria != nil {
+		m.criteria[rule] = criteria
+	}
+	return criteria, nil
 }
 
-// MatchModemToRules finds the best matching rule for a modem
+// compilePattern compiles a regex, reusing a previously compiled result
+func (m *Matcher) compilePattern(pattern string) (*regexp.Regexp, error) {
+	m.patternsMu.Lock()
+	defer m.patternsMu.Unlock()
+
+	if c, ok := m.patterns[pattern]; ok {
+		return c.re, c.err
+	}
+
+	m.regexCompiles++
+	re, err := regexp.Compile(pattern)
+
+	if m.PatternCacheSize > 0 {
+		// Start over rather than grow without bound
+		if m.patterns == nil || len(m.patterns) >= m.PatternCacheSize {
+			m.patterns = make(map[string]compiledPattern)
+		}
+		m.patterns[pattern] = compiledPattern{re: re, err: err}
+	}
+	return re, err
+}
+
+// MatchModemToRules finds the best matching rule for a modem. Enabled
+// exclude rules are checked before all others regardless of priority; if one
+// matches, it is returned with models.ErrModemExcluded and no other rule
+// applies. An exclude rule that fails to evaluate counts as a match, so a
+// typo in one never lets protected modems be upgraded.
 func (m *Matcher) MatchModemToRules(modem *models.CableModem, rules []*models.UpgradeRule) (*models.UpgradeRule, error) {
 	if modem == nil {
 		return nil, fmt.Errorf("modem cannot be nil")
 	}
 
 	// Rules should already be sorted by priority (descending)
-	for _, rule := range rules {
-		if !rule.Enabled {
-			continue
-		}
-
-		match, err := m.matchRule(modem, rule)
-		if err != nil {
-			log.Warn().
-				Err(err).
-				Int("rule_id", rule.ID).
-				Str("rule_name", rule.Name).
-				Msg("Error evaluating rule")
-			continue
-		}
+	for _, exclude := range []bool{true, false} {
+		for _, rule := range rules {
+			if !rule.Enabled || rule.Exclude != exclude {
+				continue
+			}
+
+			match, err := m.matchRule(modem, rule)
+			if err != nil && !rule.Exclude {
+				log.Warn().
+					Err(err).
+					Int("rule_id", rule.ID).
+					Str("rule_name", rule.Name).
+					Msg("Error evaluating rule")
+				continue
+			}
+			if err != nil {
+				// Fail closed: a broken exclude rule protects every modem
+				// rather than none
+				log.Warn().
+					Err(err).
+					Str("mac", modem.MACAddress).
+					Int("rule_id", rule.ID).
+					Str("rule_name", rule.Name).
+					Msg("Error evaluating exclude rule, treating modem as excluded")
+				match = true
+			}
+
+			if !match {
+				continue
+			}
+
+			if rule.Exclude {
+				log.Debug().
+					Str("mac", modem.MACAddress).
+					Int("rule_id", rule.ID).
+					Str("rule_name", rule.Name).
+					Msg("Modem excluded by rule")
+				return rule, models.ErrModemExcluded
+			}
 
-		if match {
 			log.Debug().
 				Str("mac", modem.MACAddress).
 				Int("rule_id", rule.ID).
@@ -54,23 +186,95 @@ func (m *Matcher) MatchModemToRules(modem *models.CableModem, rules []*models.Up
 	return nil, nil // No matching rule found
 }
 
+// AllMatchingRules returns every enabled rule that matches modem, in the
+// order MatchModemToRules considers them: exclude rules first, then the
+// rest, each by priority. Unlike MatchModemToRules it doesn't stop at the
+// first match, so the first rule returned is the one that would be selected.
+// Rules that fail to evaluate are logged and skipped, except exclude rules,
+// which count as matching as they do there.
+func (m *Matcher) AllMatchingRules(modem *models.CableModem, rules []*models.UpgradeRule) []*models.UpgradeRule {
+	var matches []*models.UpgradeRule
+	for _, exclude := range []bool{true, false} {
+		for _, rule := range rules {
+			if !rule.Enabled || rule.Exclude != exclude {
+				continue
+			}
+
+			match, err := m.matchRule(modem, rule)
+			if err != nil && !rule.Exclude {
+				log.Warn().
+					Err(err).
+					Int("rule_id", rule.ID).
+					Str("rule_name", rule.Name).
+					Msg("Error evaluating rule")
+				continue
+			}
+			if match || err != nil {
+				matches = append(matches, rule)
+			}
+		}
+	}
+	return matches
+}
+
 // matchRule evaluates if a modem matches a specific rule
 func (m *Matcher) matchRule(modem *models.CableModem, rule *models.UpgradeRule) (bool, error) {
-	criteria, err := rule.ParseMatchCriteria()
+	criteria, err := m.parseCriteria(rule)
 	if err != nil {
 		return false, fmt.Errorf("failed to parse match criteria: %w", err)
 	}
 
-	switch rule.MatchType {
+	return m.matchCriteria(modem, rule.MatchType, criteria, 0)
+}
+
+// matchCriteria evaluates typed criteria against a modem. depth counts the
+// COMPOSITE levels above these criteria.
+func (m *Matcher) matchCriteria(modem *models.CableModem, matchType string, criteria *models.MatchCriteria, depth int) (bool, error) {
+	switch matchType {
 	case "MAC_RANGE":
 		return m.matchMACRange(modem.MACAddress, criteria)
+	case "IP_RANGE":
+		return m.matchIPRange(modem.IPAddress, criteria)
 	case "SYSDESCR_REGEX":
 		return m.matchSysDescrRegex(modem.SysDescr, criteria)
+	case "TAG_MATCH":
+		return m.matchTags(modem.Tags, criteria)
+	case "COMPOSITE":
+		return m.matchComposite(modem, criteria, depth)
 	default:
-		return false, fmt.Errorf("unknown match type: %s", rule.MatchType)
+		return false, fmt.Errorf("unknown match type: %s", matchType)
 	}
 }
 
+// matchComposite combines a COMPOSITE rule's conditions with AND or OR,
+// stopping at the first condition that decides the result
+func (m *Matcher) matchComposite(modem *models.CableModem, criteria *models.MatchCriteria, depth int) (bool, error) {
+	if depth >= models.MaxMatchDepth {
+		return false, fmt.Errorf("composite criteria nested deeper than %d levels", models.MaxMatchDepth)
+	}
+	if len(criteria.Conditions) == 0 {
+		return false, fmt.Errorf("composite criteria have no conditions")
+	}
+
+	and := criteria.Operator == "AND"
+	if !and && criteria.Operator != "OR" {
+		return false, fmt.Errorf("unknown composite operator: %q", criteria.Operator)
+	}
+
+	for i := range criteria.Conditions {
+		cond := &criteria.Conditions[i]
+		match, err := m.matchCriteria(modem, cond.MatchType, &cond.MatchCriteria, depth+1)
+		if err != nil {
+			return false, fmt.Errorf("conditions[%d]: %w", i, err)
+		}
+		if match != and {
+			return match, nil // false under AND, true under OR
+		}
+	}
+
+	return and, nil
+}
+
 // matchMACRange checks if a MAC address falls within a range
 func (m *Matcher) matchMACRange(mac string, criteria *models.MatchCriteria) (bool, error) {
 	if criteria.StartMAC == "" || criteria.EndMAC == "" {
@@ -78,17 +282,17 @@ func (m *Matcher) matchMACRange(mac string, criteria *models.MatchCriteria) (boo
 	}
 
 	// Parse MAC addresses
-	modemMAC, err := parseMAC(mac)
+	modemMAC, err := models.ParseMAC(mac)
 	if err != nil {
 		return false, fmt.Errorf("invalid modem MAC: %w", err)
 	}
 
-	startMAC, err := parseMAC(criteria.StartMAC)
+	startMAC, err := models.ParseMAC(criteria.StartMAC)
 	if err != nil {
 		return false, fmt.Errorf("invalid start MAC: %w", err)
 	}
 
-	endMAC, err := parseMAC(criteria.EndMAC)
+	endMAC, err := models.ParseMAC(criteria.EndMAC)
 	if err != nil {
 		return false, fmt.Errorf("invalid end MAC: %w", err)
 	}
@@ -110,6 +314,48 @@ func (m *Matcher) matchMACRange(mac string, criteria *models.MatchCriteria) (boo
 	return inRange, nil
 }
 
+// matchIPRange checks if an IPv4 address falls within a range. Modems without
+// a known IP address simply don't match.
+func (m *Matcher) matchIPRange(ip string, criteria *models.MatchCriteria) (bool, error) {
+	if criteria.StartIP == "" || criteria.EndIP == "" {
+		return false, fmt.Errorf("IP range criteria missing start_ip or end_ip")
+	}
+
+	if ip == "" {
+		return false, nil
+	}
+
+	startInt, err := parseIPv4(criteria.StartIP)
+	if err != nil {
+		return false, fmt.Errorf("invalid start IP: %w", err)
+	}
+
+	endInt, err := parseIPv4(criteria.EndIP)
+	if err != nil {
+		return false, fmt.Errorf("invalid end IP: %w", err)
+	}
+
+	modemInt, err := parseIPv4(ip)
+	if err != nil {
+		log.Debug().
+			Err(err).
+			Str("modem_ip", ip).
+			Msg("Skipping IP range check for unsupported modem IP")
+		return false, nil
+	}
+
+	inRange := modemInt >= startInt && modemInt <= endInt
+
+	log.Debug().
+		Str("modem_ip", ip).
+		Str("start_ip", criteria.StartIP).
+		Str("end_ip", criteria.EndIP).
+		Bool("in_range", inRange).
+		Msg("IP range check")
+
+	return inRange, nil
+}
+
 // matchSysDescrRegex checks if sysDescr matches a regex pattern
 func (m *Matcher) matchSysDescrRegex(sysDescr string, criteria *models.MatchCriteria) (bool, error) {
 	if criteria.Pattern == "" {
@@ -117,7 +363,7 @@ func (m *Matcher) matchSysDescrRegex(sysDescr string, criteria *models.MatchCrit
 	}
 
 	// Compile regex
-	re, err := regexp.Compile(criteria.Pattern)
+	re, err := m.compilePattern(criteria.Pattern)
 	if err != nil {
 		return false, fmt.Errorf("invalid regex pattern: %w", err)
 	}
@@ -133,12 +379,38 @@ func (m *Matcher) matchSysDescrRegex(sysDescr string, criteria *models.MatchCrit
 	return match, nil
 }
 
+// matchTags checks if a modem carries every tag the criteria require.
+// Tags are compared case-insensitively.
+func (m *Matcher) matchTags(tags []string, criteria *models.MatchCriteria) (bool, error) {
+	if len(criteria.Tags) == 0 {
+		return false, fmt.Errorf("no tags to match")
+	}
+
+	for _, required := range criteria.Tags {
+		found := false
+		for _, tag := range tags {
+			if strings.EqualFold(tag, required) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
 // BatchMatchModems matches multiple modems to rules
 func (m *Matcher) BatchMatchModems(modems []*models.CableModem, rules []*models.UpgradeRule) map[int]*models.UpgradeRule {
 	matches := make(map[int]*models.UpgradeRule)
 
 	for _, modem := range modems {
 		rule, err := m.MatchModemToRules(modem, rules)
+		if err == models.ErrModemExcluded {
+			continue
+		}
 		if err != nil {
 			log.Error().
 				Err(err).
@@ -161,89 +433,19 @@ func (m *Matcher) BatchMatchModems(modems []*models.CableModem, rules []*models.
 	return matches
 }
 
-// ValidateMatchCriteria validates match criteria JSON
-func (m *Matcher) ValidateMatchCriteria(matchType, criteriaJSON string) error {
-	var criteria models.MatchCriteria
-	if err := json.Unmarshal([]byte(criteriaJSON), &criteria); err != nil {
-		return fmt.Errorf("invalid JSON: %w", err)
-	}
-
-	switch matchType {
-	case "MAC_RANGE":
-		if criteria.StartMAC == "" {
-			return fmt.Errorf("start_mac is required for MAC_RANGE")
-		}
-		if criteria.EndMAC == "" {
-			return fmt.Errorf("end_mac is required for MAC_RANGE")
-		}
-
-		// Validate MAC addresses
-		if _, err := parseMAC(criteria.StartMAC); err != nil {
-			return fmt.Errorf("invalid start_mac: %w", err)
-		}
-		if _, err := parseMAC(criteria.EndMAC); err != nil {
-			return fmt.Errorf("invalid end_mac: %w", err)
-		}
-
-		// Ensure start < end
-		start, _ := parseMAC(criteria.StartMAC)
-		end, _ := parseMAC(criteria.EndMAC)
-		if macToUint64(start) > macToUint64(end) {
-			return fmt.Errorf("start_mac must be less than or equal to end_mac")
-		}
-
-	case "SYSDESCR_REGEX":
-		if criteria.Pattern == "" {
-			return fmt.Errorf("pattern is required for SYSDESCR_REGEX")
-		}
-
-		// Validate regex compiles
-		if _, err := regexp.Compile(criteria.Pattern); err != nil {
-			return fmt.Errorf("invalid regex pattern: %w", err)
-		}
-
-	default:
-		return fmt.Errorf("unknown match type: %s", matchType)
-	}
-
-	return nil
-}
-
 // Helper functions
 
-// parseMAC parses a MAC address string to net.HardwareAddr
-func parseMAC(mac string) (net.HardwareAddr, error) {
-	// Normalize MAC address format
-	mac = strings.ToUpper(mac)
-
-	// Handle Cisco dot notation (0001.5C12.3456)
-	if strings.Count(mac, ".") == 2 {
-		parts := strings.Split(mac, ".")
-		if len(parts) == 3 && len(parts[0]) == 4 && len(parts[1]) == 4 && len(parts[2]) == 4 {
-			// Convert to standard format
-			mac = fmt.Sprintf("%s:%s:%s:%s:%s:%s",
-				parts[0][0:2], parts[0][2:4],
-				parts[1][0:2], parts[1][2:4],
-				parts[2][0:2], parts[2][2:4])
-		}
-	} else {
-		// Handle hyphen and other dots
-		mac = strings.ReplaceAll(mac, "-", ":")
-		mac = strings.ReplaceAll(mac, ".", ":")
-	}
-
-	// Handle formats like AABBCCDDEEFF
-	if !strings.Contains(mac, ":") && len(mac) == 12 {
-		mac = fmt.Sprintf("%s:%s:%s:%s:%s:%s",
-			mac[0:2], mac[2:4], mac[4:6], mac[6:8], mac[8:10], mac[10:12])
-	}
-
-	hw, err := net.ParseMAC(mac)
+// NormalizeMAC parses a MAC in any supported notation (colons, dashes, Cisco
+// dots or bare hex) and returns it in the stored AA:BB:CC:DD:EE:FF form
+func NormalizeMAC(mac string) (string, error) {
+	hw, err := models.ParseMAC(strings.TrimSpace(mac))
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-
-	return hw, nil
+	if len(hw) != 6 {
+		return "", fmt.Errorf("invalid MAC address: %s", mac)
+	}
+	return strings.ToUpper(hw.String()), nil
 }
 
 // macToUint64 converts a MAC address to uint64 for comparison
@@ -260,6 +462,45 @@ func macToUint64(mac net.HardwareAddr) uint64 {
 		uint64(mac[5])
 }
 
+// parseIPv4 parses an IPv4 address string to uint32 for comparison. IPv6
+// addresses are rejected.
+func parseIPv4(s string) (uint32, error) {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return 0, fmt.Errorf("invalid IP address: %s", s)
+	}
+
+	ip4 := ip.To4()
+	if ip4 == nil {
+		return 0, fmt.Errorf("IPv6 address not supported: %s", s)
+	}
+
+	return uint32(ip4[0])<<24 |
+		uint32(ip4[1])<<16 |
+		uint32(ip4[2])<<8 |
+		uint32(ip4[3]), nil
+}
+
+// inCanaryCohort reports whether a modem falls in a rule's canary sample.
+// Membership is derived from a hash of the MAC, so it is stable across passes
+// and raising the percentage only ever adds modems to the cohort. A percent of
+// 0 or 100 (or more) includes every modem.
+func inCanaryCohort(mac string, percent int) bool {
+	if percent <= 0 || percent >= 100 {
+		return true
+	}
+
+	// Normalize so the same modem hashes identically in any MAC notation
+	key := strings.ToUpper(mac)
+	if hw, err := models.ParseMAC(mac); err == nil {
+		key = hw.String()
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32()%100) < percent
+}
+
 // ShouldUpgrade determines if a modem needs upgrading based on current firmware
 func (m *Matcher) ShouldUpgrade(modem *models.CableModem, rule *models.UpgradeRule) bool {
 	// If we don't know current firmware, assume upgrade is needed
@@ -305,8 +546,7 @@ func extractFirmwareVersion(filename string) string {
 	// "CM_v2.0.1_release.bin"
 
 	// Try to find version pattern (with or without 'v' prefix)
-	re := regexp.MustCompile(`v?(\d+\.\d+\.\d+(?:\.\d+)*)`)
-	matches := re.FindStringSubmatch(filename)
+	matches := firmwareVersionPattern.FindStringSubmatch(filename)
 	if len(matches) > 1 {
 		// Return the version without 'v' prefix
 		return matches[1]
@@ -315,25 +555,106 @@ func extractFirmwareVersion(filename string) string {
 	return ""
 }
 
+// firmwareMatches reports whether a firmware string reported by a modem
+// corresponds to the target version. Vendors often embed the version in a
+// longer string (e.g. "SB6141-7.0.0.1-SCM01-SHPC").
+func firmwareMatches(observed, target string) bool {
+	if observed == target {
+		return true
+	}
+	return strings.Contains(observed, target)
+}
+
+// compareVersions compares two dotted numeric versions, returning -1, 0 or 1.
+// Missing components count as zero, so "2.1" equals "2.1.0".
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// exceedsFirmwareCap reports whether a rule's firmware is newer than a CMTS's
+// max_firmware_version. A target whose version can't be read from the
+// filename is treated as exceeding the cap, since it can't be proven safe.
+func exceedsFirmwareCap(filename, maxVersion string) bool {
+	if maxVersion == "" {
+		return false
+	}
+	target := extractFirmwareVersion(filename)
+	if target == "" {
+		return true
+	}
+	return compareVersions(target, maxVersion) > 0
+}
+
+// signalLevel returns the downstream power used to judge a modem's signal.
+// OFDM-only DOCSIS 3.1 modems report no legacy QAM power, so their OFDM
+// power is used instead when the legacy reading is zero or missing.
+func signalLevel(modem *models.CableModem) (float64, bool) {
+	if (modem.SignalUnavailable || modem.SignalLevel == 0) && modem.OFDMPower != 0 {
+		return modem.OFDMPower, true
+	}
+	return modem.SignalLevel, !modem.SignalUnavailable
+}
+
+// statusEligible reports whether a modem status is in EligibleStatuses
+func (m *Matcher) statusEligible(status string) bool {
+	statuses := m.EligibleStatuses
+	if len(statuses) == 0 {
+		statuses = DefaultEligibleStatuses
+	}
+	for _, eligible := range statuses {
+		if strings.EqualFold(status, eligible) {
+			return true
+		}
+	}
+	return false
+}
+
 // FilterEligibleModems filters modems that are eligible for upgrade
 func (m *Matcher) FilterEligibleModems(modems []*models.CableModem) []*models.CableModem {
 	eligible := make([]*models.CableModem, 0, len(modems))
 
 	for _, modem := range modems {
-		// Only upgrade modems that are online
-		if modem.Status != "online" {
+		// Only upgrade modems in an eligible status, normally just online
+		if !m.statusEligible(modem.Status) {
 			log.Debug().
 				Str("mac", modem.MACAddress).
 				Str("status", modem.Status).
-				Msg("Skipping modem - not online")
+				Msg("Skipping modem - status not eligible")
+			continue
+		}
+
+		// A modem whose signal couldn't be read can't be judged safe to upgrade
+		signal, ok := signalLevel(modem)
+		if !ok {
+			log.Debug().
+				Str("mac", modem.MACAddress).
+				Msg("Skipping modem - signal level unavailable")
 			continue
 		}
 
-		// Check signal level (optional - could make this configurable)
-		if modem.SignalLevel < -15.0 || modem.SignalLevel > 15.0 {
+		// Check signal level against configured thresholds
+		if signal < m.MinSignal || signal > m.MaxSignal {
 			log.Debug().
 				Str("mac", modem.MACAddress).
-				Float64("signal", modem.SignalLevel).
+				Float64("signal", signal).
+				Float64("min", m.MinSignal).
+				Float64("max", m.MaxSignal).
 				Msg("Skipping modem - poor signal level")
 			continue
 		}
@@ -1,6 +1,8 @@
 package engine
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/awksedgreep/firmware-upgrader/internal/models"
@@ -136,6 +138,95 @@ func TestMatchMACRange(t *testing.T) {
 	}
 }
 
+func TestMatchIPRange(t *testing.T) {
+	matcher := NewMatcher()
+
+	tests := []struct {
+		name      string
+		ip        string
+		startIP   string
+		endIP     string
+		wantMatch bool
+		wantErr   bool
+	}{
+		{
+			name:      "IP in range",
+			ip:        "10.20.5.17",
+			startIP:   "10.20.0.0",
+			endIP:     "10.20.255.255",
+			wantMatch: true,
+		},
+		{
+			name:      "IP at start of range",
+			ip:        "10.20.0.0",
+			startIP:   "10.20.0.0",
+			endIP:     "10.20.255.255",
+			wantMatch: true,
+		},
+		{
+			name:      "IP at end of range",
+			ip:        "10.20.255.255",
+			startIP:   "10.20.0.0",
+			endIP:     "10.20.255.255",
+			wantMatch: true,
+		},
+		{
+			name:      "IP outside range",
+			ip:        "10.21.0.1",
+			startIP:   "10.20.0.0",
+			endIP:     "10.20.255.255",
+			wantMatch: false,
+		},
+		{
+			name:      "Empty modem IP",
+			ip:        "",
+			startIP:   "10.20.0.0",
+			endIP:     "10.20.255.255",
+			wantMatch: false,
+		},
+		{
+			name:      "IPv6 modem IP",
+			ip:        "2001:db8::1",
+			startIP:   "10.20.0.0",
+			endIP:     "10.20.255.255",
+			wantMatch: false,
+		},
+		{
+			name:    "Missing end IP",
+			ip:      "10.20.5.17",
+			startIP: "10.20.0.0",
+			wantErr: true,
+		},
+		{
+			name:    "IPv6 range",
+			ip:      "10.20.5.17",
+			startIP: "2001:db8::",
+			endIP:   "2001:db8::ffff",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			criteria := &models.MatchCriteria{
+				StartIP: tt.startIP,
+				EndIP:   tt.endIP,
+			}
+
+			match, err := matcher.matchIPRange(tt.ip, criteria)
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("matchIPRange() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if match != tt.wantMatch {
+				t.Errorf("matchIPRange() = %v, want %v", match, tt.wantMatch)
+			}
+		})
+	}
+}
+
 func TestMatchSysDescrRegex(t *testing.T) {
 	matcher := NewMatcher()
 
@@ -240,6 +331,7 @@ func TestMatchSysDescrRegex(t *testing.T) {
 
 func TestFilterEligibleModems(t *testing.T) {
 	matcher := NewMatcher()
+	matcher.EligibleStatuses = DefaultEligibleStatuses
 
 	tests := []struct {
 		name           string
@@ -359,6 +451,164 @@ func TestFilterEligibleModems(t *testing.T) {
 	}
 }
 
+func TestFilterEligibleModemsCustomStatuses(t *testing.T) {
+	modems := []*models.CableModem{
+		{ID: 1, MACAddress: "00:01:5C:11:11:11", Status: "online", SignalLevel: 0.0},
+		{ID: 2, MACAddress: "00:01:5C:22:22:22", Status: "partial", SignalLevel: 0.0},
+		{ID: 3, MACAddress: "00:01:5C:33:33:33", Status: "offline", SignalLevel: 0.0},
+		{ID: 4, MACAddress: "00:01:5C:44:44:44", Status: "partial", SignalLevel: -20.0},
+	}
+
+	tests := []struct {
+		name     string
+		statuses []string
+		wantIDs  []int
+	}{
+		{name: "default", statuses: DefaultEligibleStatuses, wantIDs: []int{1}},
+		{name: "unset uses default", statuses: nil, wantIDs: []int{1}},
+		{name: "online and partial", statuses: []string{"online", "partial"}, wantIDs: []int{1, 2}},
+		{name: "partial only", statuses: []string{"partial"}, wantIDs: []int{2}},
+		{name: "case-insensitive", statuses: []string{"ONLINE", "Partial"}, wantIDs: []int{1, 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matcher := NewMatcher()
+			matcher.EligibleStatuses = tt.statuses
+
+			eligible := matcher.FilterEligibleModems(modems)
+
+			var gotIDs []int
+			for _, modem := range eligible {
+				gotIDs = append(gotIDs, modem.ID)
+			}
+			if fmt.Sprint(gotIDs) != fmt.Sprint(tt.wantIDs) {
+				t.Errorf("FilterEligibleModems() = %v, want %v", gotIDs, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestFilterEligibleModemsCustomThresholds(t *testing.T) {
+	matcher := NewMatcherWithThresholds(-5.0, 5.0)
+
+	modems := []*models.CableModem{
+		{ID: 1, MACAddress: "00:01:5C:11:11:11", Status: "online", SignalLevel: 0.0},
+		{ID: 2, MACAddress: "00:01:5C:22:22:22", Status: "online", SignalLevel: -10.0},
+		{ID: 3, MACAddress: "00:01:5C:33:33:33", Status: "online", SignalLevel: 10.0},
+		{ID: 4, MACAddress: "00:01:5C:44:44:44", Status: "online", SignalLevel: 5.0},
+	}
+
+	eligible := matcher.FilterEligibleModems(modems)
+
+	if len(eligible) != 2 {
+		t.Fatalf("FilterEligibleModems() returned %d modems, want 2", len(eligible))
+	}
+	if eligible[0].ID != 1 || eligible[1].ID != 4 {
+		t.Errorf("Unexpected eligible modems: %d, %d", eligible[0].ID, eligible[1].ID)
+	}
+}
+
+func TestFilterEligibleModemsSignalUnavailable(t *testing.T) {
+	matcher := NewMatcher()
+
+	modems := []*models.CableModem{
+		{ID: 1, MACAddress: "00:01:5C:11:11:11", Status: "online", SignalLevel: 0.0},
+		{ID: 2, MACAddress: "00:01:5C:22:22:22", Status: "online", SignalUnavailable: true},
+	}
+
+	eligible := matcher.FilterEligibleModems(modems)
+
+	if len(eligible) != 1 || eligible[0].ID != 1 {
+		t.Fatalf("FilterEligibleModems() = %v, want only modem 1", eligible)
+	}
+}
+
+func TestFilterEligibleModemsOFDMPower(t *testing.T) {
+	matcher := NewMatcher()
+
+	modems := []*models.CableModem{
+		// OFDM-only modem with no legacy reading but good OFDM power
+		{ID: 1, MACAddress: "00:01:5C:11:11:11", Status: "online", SignalUnavailable: true, OFDMPower: 3.5},
+		// Legacy power of zero falls back to out-of-range OFDM power
+		{ID: 2, MACAddress: "00:01:5C:22:22:22", Status: "online", SignalLevel: 0.0, OFDMPower: 20.0},
+		// A legacy reading takes precedence over OFDM power
+		{ID: 3, MACAddress: "00:01:5C:33:33:33", Status: "online", SignalLevel: 5.0, OFDMPower: 20.0},
+		// Neither reading available
+		{ID: 4, MACAddress: "00:01:5C:44:44:44", Status: "online", SignalUnavailable: true},
+	}
+
+	eligible := matcher.FilterEligibleModems(modems)
+
+	if len(eligible) != 2 || eligible[0].ID != 1 || eligible[1].ID != 3 {
+		t.Fatalf("FilterEligibleModems() = %v, want modems 1 and 3", eligible)
+	}
+}
+
+func TestNormalizeMAC(t *testing.T) {
+	for _, mac := range []string{"00:01:5c:11:22:33", "00-01-5C-11-22-33", "0001.5c11.2233", "00015C112233", " 00:01:5C:11:22:33 "} {
+		got, err := NormalizeMAC(mac)
+		if err != nil || got != "00:01:5C:11:22:33" {
+			t.Errorf("NormalizeMAC(%q) = %q, %v", mac, got, err)
+		}
+	}
+
+	for _, mac := range []string{"", "00:01:5C", "zz:01:5C:11:22:33", "00:01:5C:11:22:33:44:55"} {
+		if _, err := NormalizeMAC(mac); err == nil {
+			t.Errorf("Expected error for %q", mac)
+		}
+	}
+}
+
+func TestInCanaryCohort(t *testing.T) {
+	if !inCanaryCohort("00:01:5C:11:22:33", 0) || !inCanaryCohort("00:01:5C:11:22:33", 100) {
+		t.Error("Expected 0% and 100% to include every modem")
+	}
+
+	// The same modem hashes identically in any MAC notation
+	for percent := 1; percent < 100; percent++ {
+		a := inCanaryCohort("00:01:5c:11:22:33", percent)
+		b := inCanaryCohort("0001.5C11.2233", percent)
+		if a != b {
+			t.Fatalf("Expected notation-independent membership at %d%%", percent)
+		}
+	}
+
+	// Membership is monotonic in the percentage
+	for i := 0; i < 50; i++ {
+		mac := fmt.Sprintf("00:01:5C:00:00:%02X", i)
+		member := false
+		for percent := 1; percent < 100; percent++ {
+			in := inCanaryCohort(mac, percent)
+			if member && !in {
+				t.Fatalf("Modem %s left the cohort at %d%%", mac, percent)
+			}
+			member = in
+		}
+	}
+}
+
+func TestExceedsFirmwareCap(t *testing.T) {
+	tests := []struct {
+		filename   string
+		maxVersion string
+		want       bool
+	}{
+		{"firmware-v2.0.0.bin", "", false},
+		{"firmware-v2.0.0.bin", "2.0.0", false},
+		{"firmware-v1.10.0.bin", "1.9.5", true},
+		{"firmware-v1.9.0.bin", "1.10", false},
+		{"firmware-v2.0.1.bin", "2.0", true},
+		{"custom.bin", "2.0.0", true}, // Unknown version can't be proven under the cap
+	}
+
+	for _, tt := range tests {
+		if got := exceedsFirmwareCap(tt.filename, tt.maxVersion); got != tt.want {
+			t.Errorf("exceedsFirmwareCap(%q, %q) = %v, want %v", tt.filename, tt.maxVersion, got, tt.want)
+		}
+	}
+}
+
 func TestShouldUpgrade(t *testing.T) {
 	matcher := NewMatcher()
 
@@ -590,100 +840,323 @@ func TestMatchModemToRules(t *testing.T) {
 	}
 }
 
-func TestValidateMatchCriteria(t *testing.T) {
+func TestMatchModemToRulesExclude(t *testing.T) {
+	matcher := NewMatcher()
+	modem := &models.CableModem{ID: 1, MACAddress: "00:01:5C:AA:00:01", SysDescr: "Arris SB8200"}
+
+	vendor := &models.UpgradeRule{
+		ID:            1,
+		Name:          "Arris",
+		MatchType:     "SYSDESCR_REGEX",
+		MatchCriteria: `{"pattern":"Arris"}`,
+		Enabled:       true,
+		Priority:      100,
+	}
+	lab := &models.UpgradeRule{
+		ID:            2,
+		Name:          "Lab",
+		MatchType:     "MAC_RANGE",
+		MatchCriteria: `{"start_mac":"00:01:5C:AA:00:00","end_mac":"00:01:5C:AA:FF:FF"}`,
+		Enabled:       true,
+		Priority:      1,
+		Exclude:       true,
+	}
+
+	// Exclude rules win even when listed after a higher-priority rule
+	rule, err := matcher.MatchModemToRules(modem, []*models.UpgradeRule{vendor, lab})
+	if err != models.ErrModemExcluded {
+		t.Fatalf("MatchModemToRules() error = %v, want ErrModemExcluded", err)
+	}
+	if rule == nil || rule.ID != lab.ID {
+		t.Errorf("MatchModemToRules() returned %v, want exclude rule %d", rule, lab.ID)
+	}
+
+	// A disabled exclude rule is ignored
+	lab.Enabled = false
+	rule, err = matcher.MatchModemToRules(modem, []*models.UpgradeRule{vendor, lab})
+	if err != nil || rule == nil || rule.ID != vendor.ID {
+		t.Errorf("MatchModemToRules() = (%v, %v), want rule %d", rule, err, vendor.ID)
+	}
+
+	// Excluded modems are left out of batch matches
+	lab.Enabled = true
+	if matches := matcher.BatchMatchModems([]*models.CableModem{modem}, []*models.UpgradeRule{vendor, lab}); len(matches) != 0 {
+		t.Errorf("BatchMatchModems() = %v, want no matches", matches)
+	}
+
+	// An exclude rule that can't be evaluated fails closed
+	broken := &models.UpgradeRule{
+		ID:            3,
+		Name:          "Broken",
+		MatchType:     "SYSDESCR_REGEX",
+		MatchCriteria: `{"pattern":"[invalid"}`,
+		Enabled:       true,
+		Exclude:       true,
+	}
+	rule, err = matcher.MatchModemToRules(modem, []*models.UpgradeRule{vendor, broken})
+	if err != models.ErrModemExcluded || rule == nil || rule.ID != broken.ID {
+		t.Errorf("MatchModemToRules() = (%v, %v), want broken exclude rule with ErrModemExcluded", rule, err)
+	}
+	if matches := matcher.AllMatchingRules(modem, []*models.UpgradeRule{vendor, broken}); len(matches) != 2 || matches[0].ID != broken.ID {
+		t.Errorf("AllMatchingRules() = %v, want the broken exclude rule first", matches)
+	}
+}
+
+func TestAllMatchingRules(t *testing.T) {
+	matcher := NewMatcher()
+	modem := &models.CableModem{ID: 1, MACAddress: "00:01:5C:AA:00:01", SysDescr: "Arris SB8200"}
+
+	rules := []*models.UpgradeRule{
+		{ID: 1, Name: "Arris", MatchType: "SYSDESCR_REGEX", MatchCriteria: `{"pattern":"Arris"}`, Enabled: true, Priority: 100},
+		{ID: 2, Name: "Motorola", MatchType: "SYSDESCR_REGEX", MatchCriteria: `{"pattern":"Motorola"}`, Enabled: true, Priority: 90},
+		{ID: 3, Name: "Disabled", MatchType: "SYSDESCR_REGEX", MatchCriteria: `{"pattern":"SB8200"}`, Enabled: false, Priority: 80},
+		{ID: 4, Name: "Range", MatchType: "MAC_RANGE", MatchCriteria: `{"start_mac":"00:01:5C:00:00:00","end_mac":"00:01:5C:FF:FF:FF"}`, Enabled: true, Priority: 50},
+		{ID: 5, Name: "Lab", MatchType: "MAC_RANGE", MatchCriteria: `{"start_mac":"00:01:5C:AA:00:00","end_mac":"00:01:5C:AA:FF:FF"}`, Enabled: true, Priority: 1, Exclude: true},
+	}
+
+	ids := func(rules []*models.UpgradeRule) []int {
+		var out []int
+		for _, rule := range rules {
+			out = append(out, rule.ID)
+		}
+		return out
+	}
+
+	// Exclude rules come first, as MatchModemToRules checks them first
+	matches := matcher.AllMatchingRules(modem, rules)
+	if got := fmt.Sprint(ids(matches)); got != "[5 1 4]" {
+		t.Errorf("AllMatchingRules() = %s, want [5 1 4]", got)
+	}
+	selected, _ := matcher.MatchModemToRules(modem, rules)
+	if selected.ID != matches[0].ID {
+		t.Errorf("MatchModemToRules() selected rule %d, want the first match %d", selected.ID, matches[0].ID)
+	}
+
+	rules[4].Enabled = false
+	if got := fmt.Sprint(ids(matcher.AllMatchingRules(modem, rules))); got != "[1 4]" {
+		t.Errorf("AllMatchingRules() = %s, want [1 4]", got)
+	}
+
+	other := &models.CableModem{ID: 2, MACAddress: "00:02:00:00:00:01", SysDescr: "Cisco DPC3008"}
+	if matches := matcher.AllMatchingRules(other, rules); len(matches) != 0 {
+		t.Errorf("AllMatchingRules() = %v, want no matches", ids(matches))
+	}
+}
+
+// passTestData returns a mix of modems and rules used to compare cached and
+// uncached matching
+func passTestData(modemCount int) ([]*models.CableModem, []*models.UpgradeRule) {
+	rules := []*models.UpgradeRule{
+		{ID: 1, Name: "Motorola", MatchType: "SYSDESCR_REGEX", MatchCriteria: `{"pattern":"^Motorola SB6\\d{3}"}`, Enabled: true, Priority: 100},
+		{ID: 2, Name: "Invalid", MatchType: "SYSDESCR_REGEX", MatchCriteria: `{"pattern":"[invalid"}`, Enabled: true, Priority: 90},
+		{ID: 3, Name: "Arris", MatchType: "SYSDESCR_REGEX", MatchCriteria: `{"pattern":"Arris.*DOCSIS 3\\.1"}`, Enabled: true, Priority: 80},
+		{ID: 4, Name: "Range", MatchType: "MAC_RANGE", MatchCriteria: `{"start_mac":"00:01:5C:00:00:00","end_mac":"00:01:5C:7F:FF:FF"}`, Enabled: true, Priority: 70},
+	}
+
+	descrs := []string{"Motorola SB6141", "Arris SB8200 DOCSIS 3.1", "Cisco DPC3008", "Arris TG1682"}
+	modems := make([]*models.CableModem, modemCount)
+	for i := range modems {
+		modems[i] = &models.CableModem{
+			ID:         i + 1,
+			MACAddress: fmt.Sprintf("00:01:5C:%02X:%02X:%02X", (i*7)%256, (i/256)%256, i%256),
+			SysDescr:   descrs[i%len(descrs)],
+		}
+	}
+	return modems, rules
+}
+
+// nestedComposite builds COMPOSITE criteria nested levels deep around a
+// single SYSDESCR_REGEX condition
+func nestedComposite(levels int) string {
+	criteria := `{"match_type":"SYSDESCR_REGEX","pattern":"Arris"}`
+	for i := 0; i < levels; i++ {
+		criteria = `{"match_type":"COMPOSITE","operator":"AND","conditions":[` + criteria + `]}`
+	}
+	// Strip the outermost match_type; it belongs to the rule
+	return strings.Replace(criteria, `"match_type":"COMPOSITE",`, "", 1)
+}
+
+func TestMatchTags(t *testing.T) {
 	matcher := NewMatcher()
 
 	tests := []struct {
-		name          string
-		matchType     string
-		criteriaJSON  string
-		wantErr       bool
-		expectedError string
+		name     string
+		tags     []string
+		criteria string
+		want     bool
 	}{
-		{
-			name:         "Valid MAC range",
-			matchType:    "MAC_RANGE",
-			criteriaJSON: `{"start_mac":"00:01:5C:00:00:00","end_mac":"00:01:5C:FF:FF:FF"}`,
-			wantErr:      false,
-		},
-		{
-			name:         "Valid regex pattern",
-			matchType:    "SYSDESCR_REGEX",
-			criteriaJSON: `{"pattern":"Arris.*SB8200"}`,
-			wantErr:      false,
-		},
-		{
-			name:          "MAC range - missing start_mac",
-			matchType:     "MAC_RANGE",
-			criteriaJSON:  `{"end_mac":"00:01:5C:FF:FF:FF"}`,
-			wantErr:       true,
-			expectedError: "start_mac is required",
-		},
-		{
-			name:          "MAC range - missing end_mac",
-			matchType:     "MAC_RANGE",
-			criteriaJSON:  `{"start_mac":"00:01:5C:00:00:00"}`,
-			wantErr:       true,
-			expectedError: "end_mac is required",
-		},
-		{
-			name:          "MAC range - invalid start_mac",
-			matchType:     "MAC_RANGE",
-			criteriaJSON:  `{"start_mac":"invalid","end_mac":"00:01:5C:FF:FF:FF"}`,
-			wantErr:       true,
-			expectedError: "invalid start_mac",
-		},
-		{
-			name:          "MAC range - start > end",
-			matchType:     "MAC_RANGE",
-			criteriaJSON:  `{"start_mac":"00:01:5C:FF:FF:FF","end_mac":"00:01:5C:00:00:00"}`,
-			wantErr:       true,
-			expectedError: "start_mac must be less than or equal to end_mac",
-		},
-		{
-			name:          "Regex - missing pattern",
-			matchType:     "SYSDESCR_REGEX",
-			criteriaJSON:  `{}`,
-			wantErr:       true,
-			expectedError: "pattern is required",
-		},
-		{
-			name:          "Regex - invalid pattern",
-			matchType:     "SYSDESCR_REGEX",
-			criteriaJSON:  `{"pattern":"[invalid(regex"}`,
-			wantErr:       true,
-			expectedError: "invalid regex pattern",
-		},
-		{
-			name:          "Unknown match type",
-			matchType:     "UNKNOWN_TYPE",
-			criteriaJSON:  `{"pattern":"test"}`,
-			wantErr:       true,
-			expectedError: "unknown match type",
-		},
-		{
-			name:          "Invalid JSON",
-			matchType:     "MAC_RANGE",
-			criteriaJSON:  `{invalid json}`,
-			wantErr:       true,
-			expectedError: "invalid JSON",
-		},
+		{"Single tag", []string{"business"}, `{"tags":["business"]}`, true},
+		{"Case-insensitive", []string{"Business"}, `{"tags":["business"]}`, true},
+		{"All tags required", []string{"business", "lab"}, `{"tags":["lab","business"]}`, true},
+		{"Missing one tag", []string{"business"}, `{"tags":["business","lab"]}`, false},
+		{"Untagged modem", nil, `{"tags":["business"]}`, false},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := matcher.ValidateMatchCriteria(tt.matchType, tt.criteriaJSON)
+			modem := &models.CableModem{MACAddress: "00:01:5C:11:22:33", Tags: tt.tags}
+			rule := &models.UpgradeRule{MatchType: "TAG_MATCH", MatchCriteria: tt.criteria}
+			got, err := matcher.matchRule(modem, rule)
+			if err != nil {
+				t.Fatalf("matchRule() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("matchRule() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
 
-			if (err != nil) != tt.wantErr {
-				t.Errorf("ValidateMatchCriteria() error = %v, wantErr %v", err, tt.wantErr)
-				return
+func TestMatchComposite(t *testing.T) {
+	matcher := NewMatcher()
+
+	arrisInRange := &models.CableModem{MACAddress: "00:01:5C:11:22:33", IPAddress: "10.0.0.5", SysDescr: "Arris SB8200"}
+	arrisOutOfRange := &models.CableModem{MACAddress: "00:AA:BB:11:22:33", IPAddress: "10.9.0.5", SysDescr: "Arris SB8200"}
+	motorolaInRange := &models.CableModem{MACAddress: "00:01:5C:44:55:66", IPAddress: "10.0.0.6", SysDescr: "Motorola SB6141"}
+
+	// Arris AND (MAC range OR IP range)
+	criteria := `{"operator":"AND","conditions":[
+		{"match_type":"SYSDESCR_REGEX","pattern":"^Arris"},
+		{"match_type":"COMPOSITE","operator":"OR","conditions":[
+			{"match_type":"MAC_RANGE","start_mac":"00:01:5C:00:00:00","end_mac":"00:01:5C:FF:FF:FF"},
+			{"match_type":"IP_RANGE","start_ip":"10.9.0.0","end_ip":"10.9.255.255"}
+		]}
+	]}`
+	rule := &models.UpgradeRule{MatchType: "COMPOSITE", MatchCriteria: criteria, Enabled: true}
+
+	tests := []struct {
+		name  string
+		modem *models.CableModem
+		want  bool
+	}{
+		{"Arris in MAC range", arrisInRange, true},
+		{"Arris matched by nested IP range", arrisOutOfRange, true},
+		{"Motorola fails AND", motorolaInRange, false},
+		{"Arris in neither range", &models.CableModem{MACAddress: "00:AA:BB:11:22:33", IPAddress: "10.1.0.5", SysDescr: "Arris SB8200"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := matcher.matchRule(tt.modem, rule)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
 			}
+			if got != tt.want {
+				t.Errorf("matchRule() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Malformed composites are errors, not panics
+	for _, bad := range []string{
+		`{"operator":"XOR","conditions":[{"match_type":"SYSDESCR_REGEX","pattern":"Arris"}]}`,
+		`{"operator":"AND","conditions":[]}`,
+		`{"operator":"AND","conditions":[{"pattern":"Arris"}]}`,
+		nestedComposite(models.MaxMatchDepth + 1),
+	} {
+		rule := &models.UpgradeRule{MatchType: "COMPOSITE", MatchCriteria: bad, Enabled: true}
+		if _, err := matcher.matchRule(arrisInRange, rule); err == nil {
+			t.Errorf("Expected error for %s", bad)
+		}
+	}
+
+	// The deepest allowed nesting still matches
+	rule = &models.UpgradeRule{MatchType: "COMPOSITE", MatchCriteria: nestedComposite(models.MaxMatchDepth), Enabled: true}
+	if got, err := matcher.matchRule(arrisInRange, rule); err != nil || !got {
+		t.Errorf("Expected match at depth %d, got %v (err %v)", models.MaxMatchDepth, got, err)
+	}
+}
+
+func TestMatcherPassCacheMatchesUncached(t *testing.T) {
+	modems, rules := passTestData(200)
+
+	uncached := NewMatcher()
+	uncached.PatternCacheSize = 0
+	cached := NewMatcher()
+	cached.BeginPass()
+	defer cached.EndPass()
+
+	for _, modem := range modems {
+		want, wantErr := uncached.MatchModemToRules(modem, rules)
+		got, gotErr := cached.MatchModemToRules(modem, rules)
+
+		if (wantErr != nil) != (gotErr != nil) {
+			t.Fatalf("modem %d: error mismatch: uncached %v, cached %v", modem.ID, wantErr, gotErr)
+		}
+		if want != got {
+			t.Fatalf("modem %d: rule mismatch: uncached %v, cached %v", modem.ID, want, got)
+		}
+	}
 
-			if tt.wantErr && tt.expectedError != "" {
-				if err == nil {
-					t.Errorf("ValidateMatchCriteria() expected error containing '%s', got nil", tt.expectedError)
+	// Only the two valid patterns plus the invalid one should have been compiled
+	if cached.regexCompiles != 3 {
+		t.Errorf("Expected 3 regex compilations with cache, got %d", cached.regexCompiles)
+	}
+	if uncached.regexCompiles <= cached.regexCompiles {
+		t.Errorf("Expected uncached matcher to compile more often, got %d", uncached.regexCompiles)
+	}
+}
+
+func TestMatcherPatternCache(t *testing.T) {
+	matcher := NewMatcher()
+	matcher.PatternCacheSize = 2
+
+	// Repeated lookups of the same pattern compile once, even across passes
+	for i := 0; i < 3; i++ {
+		matcher.BeginPass()
+		match, err := matcher.matchSysDescrRegex("Arris SB8200", &models.MatchCriteria{Pattern: "Arris.*"})
+		matcher.EndPass()
+		if err != nil || !match {
+			t.Fatalf("Expected match, got %v (err %v)", match, err)
+		}
+	}
+	if matcher.regexCompiles != 1 {
+		t.Errorf("Expected 1 compilation, got %d", matcher.regexCompiles)
+	}
+
+	// Invalid patterns keep returning an error when served from the cache
+	for i := 0; i < 2; i++ {
+		if _, err := matcher.matchSysDescrRegex("Arris SB8200", &models.MatchCriteria{Pattern: "[invalid"}); err == nil {
+			t.Errorf("Expected error for invalid pattern on attempt %d", i+1)
+		}
+	}
+	if matcher.regexCompiles != 2 {
+		t.Errorf("Expected 2 compilations, got %d", matcher.regexCompiles)
+	}
+
+	// A third distinct pattern exceeds the cap and clears the cache
+	matcher.matchSysDescrRegex("Cisco", &models.MatchCriteria{Pattern: "Cisco"})
+	if len(matcher.patterns) > matcher.PatternCacheSize {
+		t.Errorf("Expected cache to hold at most %d patterns, got %d", matcher.PatternCacheSize, len(matcher.patterns))
+	}
+}
+
+func BenchmarkMatchModemToRules(b *testing.B) {
+	modems, rules := passTestData(500)
+
+	for _, tc := range []struct {
+		name   string
+		cached bool
+	}{
+		{"Uncached", false},
+		{"Cached", true},
+	} {
+		b.Run(tc.name, func(b *testing.B) {
+			matcher := NewMatcher()
+			if !tc.cached {
+				matcher.PatternCacheSize = 0
+			}
+			for i := 0; i < b.N; i++ {
+				if tc.cached {
+					matcher.BeginPass()
+				}
+				for _, modem := range modems {
+					matcher.MatchModemToRules(modem, rules)
 				}
+				matcher.EndPass()
 			}
+			b.ReportMetric(float64(matcher.regexCompiles)/float64(b.N), "compiles/pass")
 		})
 	}
 }
+
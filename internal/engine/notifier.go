@@ -0,0 +1,118 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/awksedgreep/firmware-upgrader/internal/database"
+	"github.com/awksedgreep/firmware-upgrader/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+// webhookTimeout bounds each webhook POST, and a failing webhook is tried
+// webhookAttempts times in all
+const (
+	webhookTimeout  = 10 * time.Second
+	webhookAttempts = 3
+)
+
+// webhookPayload is the JSON body POSTed to webhook_url
+type webhookPayload struct {
+	Event  string `json:"event"`
+	JobID  int    `json:"job_id"`
+	MAC    string `json:"mac"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// notifier POSTs job outcomes to the webhook_url setting, if one is set
+type notifier struct {
+	db      *database.DB
+	client  *http.Client
+	backoff time.Duration
+}
+
+func newNotifier(db *database.DB) *notifier {
+	return &notifier{
+		db:      db,
+		client:  &http.Client{Timeout: webhookTimeout},
+		backoff: 2 * time.Second,
+	}
+}
+
+// notifyJob sends event for job in the background so a slow webhook never
+// holds up the worker. The setting is read on every call so it can be
+// changed without a restart.
+func (n *notifier) notifyJob(event string, job *models.UpgradeJob) {
+	url, err := n.db.GetSetting("webhook_url")
+	if err != nil || url == "" {
+		return
+	}
+
+	payload := webhookPayload{
+		Event:  event,
+		JobID:  job.ID,
+		MAC:    job.MACAddress,
+		Status: job.Status,
+	}
+	if job.ErrorMessage != nil {
+		payload.Error = *job.ErrorMessage
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Error().Err(err).Int("job_id", job.ID).Msg("Failed to encode webhook payload")
+		return
+	}
+
+	go n.send(url, body, event, job.ID)
+}
+
+// send POSTs body to url, retrying with a linear backoff
+func (n *notifier) send(url string, body []byte, event string, jobID int) {
+	var err error
+	for attempt := 1; attempt <= webhookAttempts; attempt++ {
+		if err = n.post(url, body); err == nil {
+			log.Debug().
+				Str("event", event).
+				Int("job_id", jobID).
+				Msg("Webhook delivered")
+			return
+		}
+		if attempt < webhookAttempts {
+			time.Sleep(time.Duration(attempt) * n.backoff)
+		}
+	}
+
+	log.Error().
+		Err(err).
+		Str("event", event).
+		Int("job_id", jobID).
+		Int("attempts", webhookAttempts).
+		Msg("Failed to deliver webhook")
+}
+
+func (n *notifier) post(url string, body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package engine
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/awksedgreep/firmware-upgrader/internal/database"
+	"github.com/rs/zerolog/log"
+)
+
+// defaultOUIVendors is a curated subset of the IEEE OUI registry covering
+// common cable modem manufacturers, keyed by the normalized OUI (six
+// uppercase hex digits). Vendors that were acquired are listed under their
+// current name.
+var defaultOUIVendors = map[string]string{
+	// ARRIS (including Cadant and Motorola Broadband)
+	"0000CA": "ARRIS",
+	"00015C": "ARRIS",
+	"000B06": "ARRIS",
+	"001225": "ARRIS",
+	"001311": "ARRIS",
+	"001596": "ARRIS",
+	"001DCE": "ARRIS",
+	"002040": "ARRIS",
+	"00E06F": "ARRIS",
+	"00D088": "ARRIS",
+	"901ACA": "ARRIS",
+	"E8ED05": "ARRIS",
+
+	// Cisco (including Scientific Atlanta)
+	"00000C": "Cisco",
+	"000A73": "Cisco",
+	"001947": "Cisco",
+	"001CEA": "Cisco",
+	"0023BE": "Cisco",
+	"34BDFA": "Cisco",
+
+	// Technicolor (formerly Thomson)
+	"00147F": "Technicolor",
+	"00189B": "Technicolor",
+	"001E69": "Technicolor",
+	"0024D1": "Technicolor",
+	"009064": "Technicolor",
+	"0090D0": "Technicolor",
+
+	// Hitron
+	"0005CA": "Hitron",
+	"00265B": "Hitron",
+	"BC4DFB": "Hitron",
+
+	// Netgear
+	"00095B": "Netgear",
+	"000FB5": "Netgear",
+	"00146C": "Netgear",
+	"001B2F": "Netgear",
+	"00223F": "Netgear",
+	"0024B2": "Netgear",
+	"841B5E": "Netgear",
+	"C03F0E": "Netgear",
+
+	// Ubee (formerly Ambit)
+	"00D059": "Ubee",
+
+	// Casa Systems
+	"001710": "Casa Systems",
+
+	// SMC Networks
+	"0004E2": "SMC Networks",
+}
+
+// OUITable maps the first three octets of a MAC address to the vendor that
+// registered them
+type OUITable map[string]string
+
+// DefaultOUITable returns a copy of the built-in OUI table
+func DefaultOUITable() OUITable {
+	table := make(OUITable, len(defaultOUIVendors))
+	for oui, vendor := range defaultOUIVendors {
+		table[oui] = vendor
+	}
+	return table
+}
+
+// Lookup returns the vendor for mac, or "" when its OUI is unknown
+func (t OUITable) Lookup(mac string) string {
+	oui := normalizeOUI(mac)
+	if oui == "" {
+		return ""
+	}
+	return t[oui]
+}
+
+// normalizeOUI returns the first three octets of a MAC address or OUI as six
+// uppercase hex digits, accepting ':', '-' and '.' separators. It returns ""
+// if s does not start with three octets.
+func normalizeOUI(s string) string {
+	var hex strings.Builder
+	for _, r := range s {
+		switch {
+		case r == ':' || r == '-' || r == '.':
+			continue
+		case r >= '0' && r <= '9', r >= 'A' && r <= 'F':
+			hex.WriteRune(r)
+		case r >= 'a' && r <= 'f':
+			hex.WriteRune(r - 'a' + 'A')
+		default:
+			return ""
+		}
+		if hex.Len() == 6 {
+			return hex.String()
+		}
+	}
+	return ""
+}
+
+// LoadOUIFile reads an OUI table from path and merges it over the built-in
+// one, so a file only needs the entries it adds or corrects. Each line is an
+// OUI followed by whitespace and the vendor name, e.g. "00:01:5C ARRIS";
+// blank lines and lines starting with '#' are ignored.
+func LoadOUIFile(path string) (OUITable, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open OUI file: %w", err)
+	}
+	defer f.Close()
+
+	table := DefaultOUITable()
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		oui := normalizeOUI(fields[0])
+		if oui == "" || len(fields) < 2 {
+			return nil, fmt.Errorf("%s:%d: expected an OUI followed by a vendor name", path, lineNo)
+		}
+		table[oui] = strings.Join(fields[1:], " ")
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read OUI file: %w", err)
+	}
+
+	return table, nil
+}
+
+// ouiCache holds the table loaded from the oui_file setting, so discovery
+// only re-reads the file when the setting or the file's mtime changes
+type ouiCache struct {
+	mu      sync.Mutex
+	path    string
+	modTime time.Time
+	table   OUITable
+}
+
+// load returns the table named by the oui_file setting, falling back to the
+// built-in table when the setting is empty or the file can't be read. A file
+// that can't be read is only warned about until the setting or file changes.
+func (c *ouiCache) load(db *database.DB) OUITable {
+	path, err := db.GetSetting("oui_file")
+	if err != nil {
+		path = ""
+	}
+	path = strings.TrimSpace(path)
+
+	var modTime time.Time
+	if path != "" {
+		if info, err := os.Stat(path); err == nil {
+			modTime = info.ModTime()
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.table != nil && path == c.path && modTime.Equal(c.modTime) {
+		return c.table
+	}
+
+	c.path, c.modTime, c.table = path, modTime, loadOUITable(path)
+	return c.table
+}
+
+// loadOUITable reads the table at path, falling back to the built-in table
+// when path is empty or the file can't be read
+func loadOUITable(path string) OUITable {
+	if path == "" {
+		return DefaultOUITable()
+	}
+
+	table, err := LoadOUIFile(path)
+	if err != nil {
+		log.Warn().Err(err).Str("path", path).Msg("Failed to load OUI file, using built-in vendor table")
+		return DefaultOUITable()
+	}
+	return table
+}
@@ -0,0 +1,156 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Shutdown phases, in the order Shutdown runs them
+const (
+	PhaseDrainJobs      = "drain_jobs"
+	PhaseStopSchedulers = "stop_schedulers"
+	PhaseStopHTTP       = "stop_http"
+	PhaseCloseDatabase  = "close_db"
+)
+
+// shutdownJobGrace is how long upgrades cancelled by a drain timeout get to
+// record their outcome before the database is closed
+const shutdownJobGrace = 2 * time.Second
+
+// ShutdownPhase describes the outcome of one shutdown step
+type ShutdownPhase struct {
+	Name       string `json:"name"`
+	DurationMS int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// ShutdownReport describes an orderly engine shutdown
+type ShutdownReport struct {
+	StartedAt  time.Time       `json:"started_at"`
+	DurationMS int64           `json:"duration_ms"`
+	Phases     []ShutdownPhase `json:"phases"`
+	// InterruptedJobs counts upgrades still running when the drain timed
+	// out; they were cancelled and will be retried on the next run
+	InterruptedJobs int `json:"interrupted_jobs"`
+}
+
+// Err returns the first phase error, or nil if every phase succeeded
+func (r *ShutdownReport) Err() error {
+	for _, phase := range r.Phases {
+		if phase.Error != "" {
+			return fmt.Errorf("shutdown phase %s: %s", phase.Name, phase.Error)
+		}
+	}
+	return nil
+}
+
+// Shutdown stops the engine in order: in-flight upgrades are allowed to
+// finish, then the schedulers stop, then stopHTTP (if non-nil) is called,
+// and finally the database is closed. Every phase runs even if an earlier
+// one fails; once ctx expires the remaining waits are abandoned and any
+// upgrades still running are cancelled.
+func (e *Engine) Shutdown(ctx context.Context, stopHTTP func(context.Context) error) *ShutdownReport {
+	report := &ShutdownReport{StartedAt: time.Now()}
+
+	e.lifecycleMu.Lock()
+	stopWorkers, stopSchedulers := e.stopWorkers, e.stopSchedulers
+	e.lifecycleMu.Unlock()
+
+	e.runShutdownPhase(report, PhaseDrainJobs, func() error {
+		e.drainOnce.Do(func() { close(e.drain) })
+		if err := waitGroupContext(ctx, &e.workerWG); err != nil {
+			e.activeJobsMu.Lock()
+			report.InterruptedJobs = len(e.activeJobs)
+			e.activeJobsMu.Unlock()
+			if stopWorkers != nil {
+				stopWorkers()
+			}
+			// Give cancelled upgrades a moment to record their retry
+			graceCtx, cancel := context.WithTimeout(context.Background(), shutdownJobGrace)
+			defer cancel()
+			waitGroupContext(graceCtx, &e.workerWG)
+			return fmt.Errorf("%w with %d jobs in flight", err, report.InterruptedJobs)
+		}
+		return nil
+	})
+
+	e.runShutdownPhase(report, PhaseStopSchedulers, func() error {
+		if stopSchedulers != nil {
+			stopSchedulers()
+		}
+		e.stoppedOnce.Do(func() { close(e.stopped) })
+		return waitGroupContext(ctx, &e.schedulerWG)
+	})
+
+	if stopHTTP != nil {
+		e.runShutdownPhase(report, PhaseStopHTTP, func() error {
+			return stopHTTP(ctx)
+		})
+	}
+
+	e.runShutdownPhase(report, PhaseCloseDatabase, e.db.Close)
+
+	report.DurationMS = time.Since(report.StartedAt).Milliseconds()
+	log.Info().
+		Int64("duration_ms", report.DurationMS).
+		Int("interrupted_jobs", report.InterruptedJobs).
+		Msg("Upgrade engine shutdown complete")
+
+	return report
+}
+
+// runShutdownPhase runs one shutdown step, logging and recording its outcome
+func (e *Engine) runShutdownPhase(report *ShutdownReport, name string, run func() error) {
+	log.Info().Str("phase", name).Msg("Shutdown phase starting")
+
+	started := time.Now()
+	err := run()
+	phase := ShutdownPhase{
+		Name:       name,
+		DurationMS: time.Since(started).Milliseconds(),
+	}
+	if err != nil {
+		phase.Error = err.Error()
+		log.Error().
+			Err(err).
+			Str("phase", name).
+			Int64("duration_ms", phase.DurationMS).
+			Msg("Shutdown phase failed")
+	} else {
+		log.Info().
+			Str("phase", name).
+			Int64("duration_ms", phase.DurationMS).
+			Msg("Shutdown phase complete")
+	}
+	report.Phases = append(report.Phases, phase)
+}
+
+// draining reports whether Shutdown has begun
+func (e *Engine) draining() bool {
+	select {
+	case <-e.drain:
+		return true
+	default:
+		return false
+	}
+}
+
+// waitGroupContext waits for wg, giving up when ctx is done
+func waitGroupContext(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
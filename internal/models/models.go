@@ -1,61 +1,666 @@
 package models
 
 import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 )
 
 // CMTS represents a Cable Modem Termination System
 type CMTS struct {
-	ID                int       `json:"id" db:"id"`
-	Name              string    `json:"name" db:"name"`
-	IPAddress         string    `json:"ip_address" db:"ip_address"`
-	SNMPPort          int       `json:"snmp_port" db:"snmp_port"`
-	CommunityRead     string    `json:"community_read" db:"community_read"`
-	CommunityWrite    string    `json:"community_write" db:"community_write"`
-	CMCommunityString string    `json:"cm_community_string" db:"cm_community_string"`
-	SNMPVersion       int       `json:"snmp_version" db:"snmp_version"`
-	Enabled           bool      `json:"enabled" db:"enabled"`
-	CreatedAt         time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt         time.Time `json:"updated_at" db:"updated_at"`
+	ID                int    `json:"id" db:"id"`
+	Name              string `json:"name" db:"name"`
+	IPAddress         string `json:"ip_address" db:"ip_address"`
+	SNMPPort          int    `json:"snmp_port" db:"snmp_port"`
+	CommunityRead     string `json:"community_read" db:"community_read"`
+	CommunityWrite    string `json:"community_write" db:"community_write"`
+	CMCommunityString string `json:"cm_community_string" db:"cm_community_string"`
+	SNMPVersion       int    `json:"snmp_version" db:"snmp_version"`
+	Enabled           bool   `json:"enabled" db:"enabled"`
+	// MaxFirmwareVersion caps the firmware version rules may push to modems
+	// on this CMTS; empty means no cap
+	MaxFirmwareVersion string `json:"max_firmware_version,omitempty" db:"max_firmware_version"`
+	// SNMPMaxOids caps the OIDs sent in one SNMP request and the rows asked
+	// for per GETBULK; some older CMTS return partial walks above 10. 0 means
+	// DefaultSNMPMaxOids.
+	SNMPMaxOids int        `json:"snmp_max_oids" db:"snmp_max_oids"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at" db:"updated_at"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+}
+
+// DefaultSNMPMaxOids is the most OIDs sent in one SNMP request, used for
+// CMTS that don't set a lower limit
+const DefaultSNMPMaxOids = 60
+
+// MaxOids returns the OIDs to send per SNMP request, applying the default
+func (c *CMTS) MaxOids() int {
+	if c.SNMPMaxOids == 0 {
+		return DefaultSNMPMaxOids
+	}
+	return c.SNMPMaxOids
 }
 
 // CableModem represents a discovered cable modem
 type CableModem struct {
-	ID              int       `json:"id" db:"id"`
-	CMTSID          int       `json:"cmts_id" db:"cmts_id"`
-	MACAddress      string    `json:"mac_address" db:"mac_address"`
-	IPAddress       string    `json:"ip_address" db:"ip_address"`
-	SysDescr        string    `json:"sysdescr" db:"sysdescr"`
-	CurrentFirmware string    `json:"current_firmware" db:"current_firmware"`
-	SignalLevel     float64   `json:"signal_level" db:"signal_level"`
-	Status          string    `json:"status" db:"status"`
-	LastSeen        time.Time `json:"last_seen" db:"last_seen"`
+	ID              int     `json:"id" db:"id"`
+	CMTSID          int     `json:"cmts_id" db:"cmts_id"`
+	MACAddress      string  `json:"mac_address" db:"mac_address"`
+	IPAddress       string  `json:"ip_address" db:"ip_address"`
+	SysDescr        string  `json:"sysdescr" db:"sysdescr"`
+	CurrentFirmware string  `json:"current_firmware" db:"current_firmware"`
+	SignalLevel     float64 `json:"signal_level" db:"signal_level"`
+	// SignalUnavailable is set when the CMTS did not report a signal level;
+	// SignalLevel is then meaningless and stored as NULL
+	SignalUnavailable bool `json:"signal_unavailable,omitempty" db:"-"`
+	// OFDMPower is the mean DOCSIS 3.1 OFDM downstream power; 0 when the
+	// modem has no OFDM channels
+	OFDMPower float64 `json:"ofdm_power,omitempty" db:"ofdm_power"`
+	// IfIndex is the modem's row in the CMTS docsIfCmtsCmStatusTable and
+	// IfDescr the ifDescr of the upstream channel it was last seen on;
+	// either is empty when the CMTS doesn't report it
+	IfIndex string `json:"if_index,omitempty" db:"if_index"`
+	IfDescr string `json:"if_descr,omitempty" db:"if_descr"`
+	// ExpectedFirmware is the firmware the modem is supposed to run, set
+	// when a rule assigns it an upgrade and confirmed when the upgrade
+	// completes. Discovery never changes it; empty means unknown.
+	ExpectedFirmware string `json:"expected_firmware,omitempty" db:"expected_firmware"`
+	// ConfigFile is the DOCSIS boot config file the modem last registered
+	// with (docsDevServerConfigFile), read from the modem itself; empty
+	// when it has never answered or doesn't report one
+	ConfigFile string `json:"config_file,omitempty" db:"config_file"`
+	// Vendor is the manufacturer registered for the MAC address's OUI, set
+	// by discovery; empty when the OUI isn't in the vendor table
+	Vendor string `json:"vendor,omitempty" db:"vendor"`
+	// Tags are operator-assigned groupings such as "business" or "lab",
+	// matched by TAG_MATCH rules. Discovery never changes them.
+	Tags     []string  `json:"tags,omitempty" db:"tags"`
+	Status   string    `json:"status" db:"status"`
+	LastSeen time.Time `json:"last_seen" db:"last_seen"`
+	// StaleAfter is how long the modem may go unseen before its JSON marks
+	// it stale; 0 means DefaultModemStaleMinutes
+	StaleAfter time.Duration `json:"-" db:"-"`
+}
+
+// DefaultModemStaleMinutes is how long a modem may go unseen before it is
+// stale, when the cleanup_offline_minutes setting is missing or invalid
+const DefaultModemStaleMinutes = 10
+
+// ModemStaleThreshold parses the cleanup_offline_minutes setting. Stale
+// modems are the ones cleanup marks offline, so both share this definition.
+func ModemStaleThreshold(value string) time.Duration {
+	minutes, err := strconv.Atoi(value)
+	if err != nil || minutes <= 0 {
+		minutes = DefaultModemStaleMinutes
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// ModemJSON is a CableModem as the API returns it, with how long ago it was
+// last seen and whether that makes it stale
+type ModemJSON struct {
+	modemFields
+	StaleSeconds int  `json:"stale_seconds"`
+	IsStale      bool `json:"is_stale"`
+}
+
+// modemFields has CableModem's fields but not its MarshalJSON
+type modemFields CableModem
+
+// JSON returns the modem's API form as of now
+func (m CableModem) JSON(now time.Time) ModemJSON {
+	threshold := m.StaleAfter
+	if threshold <= 0 {
+		threshold = DefaultModemStaleMinutes * time.Minute
+	}
+	age := now.Sub(m.LastSeen)
+	if age < 0 {
+		age = 0
+	}
+	return ModemJSON{
+		modemFields:  modemFields(m),
+		StaleSeconds: int(age / time.Second),
+		IsStale:      age > threshold,
+	}
+}
+
+// MarshalJSON adds stale_seconds and is_stale to the modem
+func (m CableModem) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.JSON(time.Now()))
+}
+
+// SignalReading is one discovery's signal levels for a modem. Either level
+// is nil when the CMTS didn't report it.
+type SignalReading struct {
+	ModemID     int       `json:"modem_id" db:"modem_id"`
+	SignalLevel *float64  `json:"signal_level" db:"signal_level"`
+	OFDMPower   *float64  `json:"ofdm_power" db:"ofdm_power"`
+	RecordedAt  time.Time `json:"recorded_at" db:"recorded_at"`
 }
 
 // UpgradeRule represents a firmware upgrade rule
 type UpgradeRule struct {
-	ID               int       `json:"id" db:"id"`
-	Name             string    `json:"name" db:"name"`
-	Description      string    `json:"description" db:"description"`
-	MatchType        string    `json:"match_type" db:"match_type"`         // "MAC_RANGE" or "SYSDESCR_REGEX"
-	MatchCriteria    string    `json:"match_criteria" db:"match_criteria"` // JSON string
-	TFTPServerIP     string    `json:"tftp_server_ip" db:"tftp_server_ip"`
-	FirmwareFilename string    `json:"firmware_filename" db:"firmware_filename"`
-	Enabled          bool      `json:"enabled" db:"enabled"`
-	Priority         int       `json:"priority" db:"priority"`
-	CreatedAt        time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt        time.Time `json:"updated_at" db:"updated_at"`
+	ID                  int       `json:"id" db:"id"`
+	Name                string    `json:"name" db:"name"`
+	Description         string    `json:"description" db:"description"`
+	MatchType           string    `json:"match_type" db:"match_type"`         // "MAC_RANGE", "IP_RANGE", "SYSDESCR_REGEX", "TAG_MATCH" or "COMPOSITE"
+	MatchCriteria       string    `json:"match_criteria" db:"match_criteria"` // JSON string
+	TFTPServerIP        string    `json:"tftp_server_ip" db:"tftp_server_ip"`
+	FirmwareFilename    string    `json:"firmware_filename" db:"firmware_filename"`
+	Enabled             bool      `json:"enabled" db:"enabled"`
+	Priority            int       `json:"priority" db:"priority"`
+	DryRun              bool      `json:"dry_run" db:"dry_run"`                                       // record jobs without sending SNMP
+	CanaryPercent       int       `json:"canary_percent" db:"canary_percent"`                         // 1-99 limits the rollout to a stable sample, 0 = all
+	MaxConcurrent       int       `json:"max_concurrent" db:"max_concurrent"`                         // simultaneous upgrades across all CMTS, 0 = unlimited
+	AdminStatusValue    int       `json:"admin_status_value,omitempty" db:"admin_status_value"`       // value SET to start the upgrade, 0 = upgradeFromMgt(1)
+	CustomUpgradeOID    string    `json:"custom_upgrade_oid,omitempty" db:"custom_upgrade_oid"`       // OID to SET instead of docsDevSwAdminStatus
+	TransportProtocol   string    `json:"transport_protocol,omitempty" db:"transport_protocol"`       // "tftp" or "http", empty = legacy TFTP
+	Exclude             bool      `json:"exclude" db:"exclude"`                                       // matching modems are never upgraded by any rule
+	MaxRetries          int       `json:"max_retries" db:"max_retries"`                               // retries after a failed attempt, 0 = try once
+	UpgradePollInterval int       `json:"upgrade_poll_interval,omitempty" db:"upgrade_poll_interval"` // seconds between upgrade status checks, 0 = upgrade_poll_interval setting
+	CreatedAt           time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt           time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// RuleSpec is the portable form of an UpgradeRule used for import and export.
+// It omits the ID and timestamps so rules can be kept in version control and
+// synced between instances by name.
+type RuleSpec struct {
+	Name              string `json:"name"`
+	Description       string `json:"description"`
+	MatchType         string `json:"match_type"`
+	MatchCriteria     string `json:"match_criteria"`
+	TFTPServerIP      string `json:"tftp_server_ip"`
+	FirmwareFilename  string `json:"firmware_filename"`
+	Enabled           bool   `json:"enabled"`
+	Priority          int    `json:"priority"`
+	DryRun            bool   `json:"dry_run"`
+	CanaryPercent     int    `json:"canary_percent"`
+	MaxConcurrent     int    `json:"max_concurrent"`
+	AdminStatusValue  int    `json:"admin_status_value,omitempty"`
+	CustomUpgradeOID  string `json:"custom_upgrade_oid,omitempty"`
+	TransportProtocol string `json:"transport_protocol,omitempty"`
+	Exclude           bool   `json:"exclude,omitempty"`
+	// MaxRetries is nil when the spec doesn't set it, so imports can apply
+	// the retry_attempts setting instead of disabling retries
+	MaxRetries          *int `json:"max_retries,omitempty"`
+	UpgradePollInterval int  `json:"upgrade_poll_interval,omitempty"`
+}
+
+// Spec returns the portable form of the rule
+func (r *UpgradeRule) Spec() RuleSpec {
+	maxRetries := r.MaxRetries
+	return RuleSpec{
+		Name:                r.Name,
+		Description:         r.Description,
+		MatchType:           r.MatchType,
+		MatchCriteria:       r.MatchCriteria,
+		TFTPServerIP:        r.TFTPServerIP,
+		FirmwareFilename:    r.FirmwareFilename,
+		Enabled:             r.Enabled,
+		Priority:            r.Priority,
+		DryRun:              r.DryRun,
+		CanaryPercent:       r.CanaryPercent,
+		MaxConcurrent:       r.MaxConcurrent,
+		AdminStatusValue:    r.AdminStatusValue,
+		CustomUpgradeOID:    r.CustomUpgradeOID,
+		TransportProtocol:   r.TransportProtocol,
+		Exclude:             r.Exclude,
+		MaxRetries:          &maxRetries,
+		UpgradePollInterval: r.UpgradePollInterval,
+	}
+}
+
+// Rule converts the spec to an UpgradeRule without an ID. A spec without
+// max_retries gets DefaultMaxRetries.
+func (s RuleSpec) Rule() *UpgradeRule {
+	maxRetries := DefaultMaxRetries
+	if s.MaxRetries != nil {
+		maxRetries = *s.MaxRetries
+	}
+	return &UpgradeRule{
+		Name:                s.Name,
+		Description:         s.Description,
+		MatchType:           s.MatchType,
+		MatchCriteria:       s.MatchCriteria,
+		TFTPServerIP:        s.TFTPServerIP,
+		FirmwareFilename:    s.FirmwareFilename,
+		Enabled:             s.Enabled,
+		Priority:            s.Priority,
+		DryRun:              s.DryRun,
+		CanaryPercent:       s.CanaryPercent,
+		MaxConcurrent:       s.MaxConcurrent,
+		AdminStatusValue:    s.AdminStatusValue,
+		CustomUpgradeOID:    s.CustomUpgradeOID,
+		TransportProtocol:   s.TransportProtocol,
+		Exclude:             s.Exclude,
+		MaxRetries:          maxRetries,
+		UpgradePollInterval: s.UpgradePollInterval,
+	}
+}
+
+// CMTSSpec is the portable form of a CMTS used in configuration backups.
+// Like RuleSpec it omits the ID and timestamps; a restore matches CMTS by
+// name.
+type CMTSSpec struct {
+	Name               string `json:"name"`
+	IPAddress          string `json:"ip_address"`
+	SNMPPort           int    `json:"snmp_port"`
+	CommunityRead      string `json:"community_read"`
+	CommunityWrite     string `json:"community_write"`
+	CMCommunityString  string `json:"cm_community_string"`
+	SNMPVersion        int    `json:"snmp_version"`
+	Enabled            bool   `json:"enabled"`
+	MaxFirmwareVersion string `json:"max_firmware_version,omitempty"`
+	SNMPMaxOids        int    `json:"snmp_max_oids,omitempty"`
+}
+
+// Spec returns the portable form of the CMTS
+func (c *CMTS) Spec() CMTSSpec {
+	return CMTSSpec{
+		Name:               c.Name,
+		IPAddress:          c.IPAddress,
+		SNMPPort:           c.SNMPPort,
+		CommunityRead:      c.CommunityRead,
+		CommunityWrite:     c.CommunityWrite,
+		CMCommunityString:  c.CMCommunityString,
+		SNMPVersion:        c.SNMPVersion,
+		Enabled:            c.Enabled,
+		MaxFirmwareVersion: c.MaxFirmwareVersion,
+		SNMPMaxOids:        c.SNMPMaxOids,
+	}
+}
+
+// CMTS converts the spec to a CMTS without an ID
+func (s CMTSSpec) CMTS() *CMTS {
+	return &CMTS{
+		Name:               s.Name,
+		IPAddress:          s.IPAddress,
+		SNMPPort:           s.SNMPPort,
+		CommunityRead:      s.CommunityRead,
+		CommunityWrite:     s.CommunityWrite,
+		CMCommunityString:  s.CMCommunityString,
+		SNMPVersion:        s.SNMPVersion,
+		Enabled:            s.Enabled,
+		MaxFirmwareVersion: s.MaxFirmwareVersion,
+		SNMPMaxOids:        s.SNMPMaxOids,
+	}
+}
+
+// BackupSchemaVersion is the configuration backup format this build writes.
+// Bump it when a section changes shape so restores can detect old files.
+const BackupSchemaVersion = 2
+
+// Backup is a configuration snapshot: CMTS, rules and settings, without
+// modems, jobs or history. The evaluation_cmts_allowlist setting holds CMTS
+// IDs, which differ between instances, so it travels as CMTS names in
+// EvaluationCMTSAllowlist instead. Version 1 backups don't have it.
+type Backup struct {
+	SchemaVersion           int               `json:"schema_version"`
+	CreatedAt               time.Time         `json:"created_at"`
+	CMTS                    []CMTSSpec        `json:"cmts"`
+	Rules                   []RuleSpec        `json:"rules"`
+	Settings                map[string]string `json:"settings"`
+	EvaluationCMTSAllowlist []string          `json:"evaluation_cmts_allowlist"`
+}
+
+// RestoreResult counts what a backup restore changed
+type RestoreResult struct {
+	CMTSCreated  int `json:"cmts_created"`
+	CMTSUpdated  int `json:"cmts_updated"`
+	RulesCreated int `json:"rules_created"`
+	RulesUpdated int `json:"rules_updated"`
+	Settings     int `json:"settings"`
 }
 
+// Firmware download protocols a rule can ask the modem to use. A rule without
+// one leaves docsDevSwServerTransportProtocol alone, so the modem uses TFTP.
+const (
+	TransportTFTP = "tftp"
+	TransportHTTP = "http"
+)
+
+// validTransportProtocol reports whether p is empty or a known protocol
+func validTransportProtocol(p string) bool {
+	switch p {
+	case "", TransportTFTP, TransportHTTP:
+		return true
+	}
+	return false
+}
+
+// DefaultMaxRetries is how often a failed upgrade is retried when neither the
+// rule nor the retry_attempts setting says otherwise, and MaxRuleRetries is
+// the most a rule may ask for
+const (
+	DefaultMaxRetries = 3
+	MaxRuleRetries    = 10
+)
+
 // MatchCriteria represents the criteria for matching modems
 type MatchCriteria struct {
 	StartMAC string `json:"start_mac,omitempty"`
 	EndMAC   string `json:"end_mac,omitempty"`
+	StartIP  string `json:"start_ip,omitempty"`
+	EndIP    string `json:"end_ip,omitempty"`
 	Pattern  string `json:"pattern,omitempty"`
+
+	// TAG_MATCH criteria list the tags a modem must all carry
+	Tags []string `json:"tags,omitempty"`
+
+	// COMPOSITE criteria combine typed conditions with AND or OR
+	Operator   string           `json:"operator,omitempty"`
+	Conditions []MatchCondition `json:"conditions,omitempty"`
+}
+
+// MatchCondition is one typed criterion of a COMPOSITE rule, e.g.
+// {"match_type":"MAC_RANGE","start_mac":"...","end_mac":"..."}. A condition
+// may itself be COMPOSITE.
+type MatchCondition struct {
+	MatchType string `json:"match_type"`
+	MatchCriteria
+}
+
+// MaxMatchDepth limits how many COMPOSITE levels a rule may nest
+const MaxMatchDepth = 4
+
+// validMatchType reports whether t is a known rule match type
+func validMatchType(t string) bool {
+	switch t {
+	case "MAC_RANGE", "IP_RANGE", "SYSDESCR_REGEX", "TAG_MATCH", "COMPOSITE":
+		return true
+	}
+	return false
+}
+
+// validate checks the criteria for a match type, recursing into COMPOSITE
+// conditions. depth is the number of COMPOSITE levels above these criteria.
+func (c *MatchCriteria) validate(matchType string, depth int) error {
+	switch matchType {
+	case "MAC_RANGE":
+		start, err := ParseMAC(c.StartMAC)
+		if err != nil || len(start) != 6 {
+			return ErrInvalidMACRange
+		}
+		end, err := ParseMAC(c.EndMAC)
+		if err != nil || len(end) != 6 {
+			return ErrInvalidMACRange
+		}
+		if bytes.Compare(start, end) > 0 {
+			return ErrMACRangeOrder
+		}
+
+	case "IP_RANGE":
+		var ips [2]net.IP
+		for i, addr := range []string{c.StartIP, c.EndIP} {
+			ip := net.ParseIP(addr)
+			if ip == nil {
+				return ErrInvalidIPRange
+			}
+			if ips[i] = ip.To4(); ips[i] == nil {
+				return ErrIPv6NotSupported
+			}
+		}
+		if bytes.Compare(ips[0], ips[1]) > 0 {
+			return ErrIPRangeOrder
+		}
+
+	case "SYSDESCR_REGEX":
+		if c.Pattern == "" {
+			return ErrNoPattern
+		}
+		if _, err := regexp.Compile(c.Pattern); err != nil {
+			return &ValidationError{Field: "match_criteria", Message: fmt.Sprintf("invalid regex pattern: %v", err)}
+		}
+
+	case "TAG_MATCH":
+		if len(c.Tags) == 0 {
+			return ErrNoTags
+		}
+		if err := ValidateTags(c.Tags); err != nil {
+			return &ValidationError{Field: "match_criteria", Message: err.Error()}
+		}
+
+	case "COMPOSITE":
+		if depth >= MaxMatchDepth {
+			return ErrMatchTooDeep
+		}
+		if c.Operator != "AND" && c.Operator != "OR" {
+			return ErrInvalidOperator
+		}
+		if len(c.Conditions) == 0 {
+			return ErrNoConditions
+		}
+		for i := range c.Conditions {
+			cond := &c.Conditions[i]
+			if !validMatchType(cond.MatchType) {
+				return &ValidationError{Field: "match_criteria", Message: fmt.Sprintf("conditions[%d]: %s", i, ErrInvalidMatchType.Message)}
+			}
+			if err := cond.validate(cond.MatchType, depth+1); err != nil {
+				return &ValidationError{Field: "match_criteria", Message: fmt.Sprintf("conditions[%d]: %s", i, err.Error())}
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateTags checks that every tag is a non-empty string
+func ValidateTags(tags []string) error {
+	for _, tag := range tags {
+		if strings.TrimSpace(tag) == "" {
+			return ErrInvalidTag
+		}
+	}
+	return nil
+}
+
+// ParseMAC parses a MAC address in any supported notation: colons, dashes,
+// Cisco dots (0001.5C12.3456) or bare hex (00015C123456)
+func ParseMAC(mac string) (net.HardwareAddr, error) {
+	mac = strings.ToUpper(mac)
+
+	if strings.Count(mac, ".") == 2 {
+		parts := strings.Split(mac, ".")
+		if len(parts) == 3 && len(parts[0]) == 4 && len(parts[1]) == 4 && len(parts[2]) == 4 {
+			mac = fmt.Sprintf("%s:%s:%s:%s:%s:%s",
+				parts[0][0:2], parts[0][2:4],
+				parts[1][0:2], parts[1][2:4],
+				parts[2][0:2], parts[2][2:4])
+		}
+	} else {
+		mac = strings.ReplaceAll(mac, "-", ":")
+		mac = strings.ReplaceAll(mac, ".", ":")
+	}
+
+	if !strings.Contains(mac, ":") && len(mac) == 12 {
+		mac = fmt.Sprintf("%s:%s:%s:%s:%s:%s",
+			mac[0:2], mac[2:4], mac[4:6], mac[6:8], mac[8:10], mac[10:12])
+	}
+
+	return net.ParseMAC(mac)
+}
+
+// Setting value types reported by the settings schema
+const (
+	SettingTypeInt      = "int"
+	SettingTypeDuration = "duration"
+	SettingTypeFloat    = "float"
+	SettingTypeEnum     = "enum"
+	SettingTypeBool     = "bool"
+	SettingTypeString   = "string"
+)
+
+// SettingSpec describes a known setting and the values it accepts. Duration
+// settings are a whole number of Unit. Min and Max, when set, bound int,
+// duration and float settings.
+type SettingSpec struct {
+	Key         string   `json:"key"`
+	Type        string   `json:"type"`
+	Unit        string   `json:"unit,omitempty"`
+	Min         *float64 `json:"min,omitempty"`
+	Max         *float64 `json:"max,omitempty"`
+	Options     []string `json:"options,omitempty"`
+	Description string   `json:"description"`
+
+	// err, if set, is returned instead of a generated constraint error so
+	// callers comparing against an existing ValidationError keep working
+	err *ValidationError
+}
+
+func bound(v float64) *float64 {
+	return &v
+}
+
+// settingSpecs is the registry of known settings, in display order
+var settingSpecs = []SettingSpec{
+	{Key: "workers", Type: SettingTypeInt, Min: bound(1), Description: "Concurrent upgrade workers"},
+	{Key: "poll_interval", Type: SettingTypeDuration, Unit: "seconds", Min: bound(1), Description: "Time between job queue polls", err: ErrInvalidInterval},
+	{Key: "discovery_interval", Type: SettingTypeDuration, Unit: "seconds", Min: bound(1), Description: "Time between modem discovery runs", err: ErrInvalidInterval},
+	{Key: "evaluation_interval", Type: SettingTypeDuration, Unit: "seconds", Min: bound(1), Description: "Time between rule evaluations", err: ErrInvalidInterval},
+	{Key: "job_timeout", Type: SettingTypeDuration, Unit: "seconds", Min: bound(1), Description: "Time allowed for a single upgrade"},
+	{Key: "upgrade_poll_interval", Type: SettingTypeDuration, Unit: "seconds", Min: bound(MinUpgradePollSeconds), Max: bound(MaxUpgradePollSeconds), Description: "Time between status checks on a running upgrade", err: ErrInvalidPollInterval},
+	{Key: "retry_attempts", Type: SettingTypeInt, Min: bound(0), Description: "Retries for a failed upgrade, 0 = try once"},
+	{Key: "retry_jitter", Type: SettingTypeBool, Description: "Randomize each retry backoff between half and one and a half times its length"},
+	{Key: "retry_budget", Type: SettingTypeInt, Min: bound(0), Description: "Max retries across all CMTS per window, 0 = unlimited"},
+	{Key: "retry_budget_per_cmts", Type: SettingTypeInt, Min: bound(0), Description: "Max retries on one CMTS per window, 0 = unlimited"},
+	{Key: "retry_budget_window", Type: SettingTypeDuration, Unit: "seconds", Min: bound(1), Description: "Window the retry budgets apply to"},
+	{Key: "signal_level_min", Type: SettingTypeFloat, Unit: "dBmV", Description: "Lowest downstream power eligible for upgrade"},
+	{Key: "signal_level_max", Type: SettingTypeFloat, Unit: "dBmV", Description: "Highest downstream power eligible for upgrade"},
+	{Key: "eligible_statuses", Type: SettingTypeString, Description: "Comma-separated modem statuses eligible for upgrade, e.g. online,partial"},
+	{Key: "oui_file", Type: SettingTypeString, Description: "Optional file of OUI to vendor mappings merged over the built-in table, empty = built-in only"},
+	{Key: "max_upgrades_per_cmts", Type: SettingTypeInt, Min: bound(1), Description: "Concurrent upgrades on one CMTS"},
+	{Key: "discovery_concurrency", Type: SettingTypeInt, Min: bound(0), Description: "Max simultaneous CMTS discoveries, 0 = unlimited"},
+	{Key: "max_modems_per_cmts", Type: SettingTypeInt, Min: bound(1), Description: "Abort a CMTS's discovery if it reports more modems than this"},
+	{Key: "snmp_budget", Type: SettingTypeInt, Min: bound(0), Description: "Max concurrent discoveries and upgrades, 0 = unlimited"},
+	{Key: "snmp_scheduling_policy", Type: SettingTypeEnum, Options: []string{"fair", "prioritize_upgrades", "prioritize_discovery"}, Description: "Which side yields when the SNMP budget is contended"},
+	{Key: "max_list_items", Type: SettingTypeInt, Min: bound(1), Description: "Cap on items returned by list endpoints"},
+	{Key: "job_retention_days", Type: SettingTypeDuration, Unit: "days", Min: bound(0), Description: "Purge finished jobs and logs after this long, 0 = keep forever"},
+	{Key: "signal_history_days", Type: SettingTypeDuration, Unit: "days", Min: bound(0), Description: "Keep modem signal history for this long, 0 = keep forever"},
+	{Key: "verify_firmware_exists", Type: SettingTypeBool, Description: "Probe the TFTP server for the firmware file before upgrading"},
+	{Key: "restart_workers_on_panic", Type: SettingTypeBool, Description: "Fail a job that panics and restart its worker instead of crashing the process"},
+	{Key: "engine_paused", Type: SettingTypeBool, Description: "Set by the pause and resume endpoints"},
+	{Key: "log_level", Type: SettingTypeEnum, Options: []string{"debug", "info", "warn", "error"}, Description: "Log verbosity"},
+	{Key: "log_format", Type: SettingTypeEnum, Options: []string{"console", "json"}, Description: "Log output format; the -log-format flag takes precedence"},
+	{Key: "cleanup_interval", Type: SettingTypeDuration, Unit: "seconds", Min: bound(1), Description: "Time between cleanup runs", err: ErrInvalidInterval},
+	{Key: "cleanup_offline_minutes", Type: SettingTypeDuration, Unit: "minutes", Min: bound(1), Description: "Mark modems offline after this long unseen"},
+	{Key: "cleanup_delete_days", Type: SettingTypeDuration, Unit: "days", Min: bound(0), Description: "Delete modems after this long offline"},
+	{Key: "api_token", Type: SettingTypeString, Description: "Bearer token for the API, empty disables authentication"},
+	{Key: "api_rate_limit", Type: SettingTypeFloat, Min: bound(0), Description: "Requests per second per client IP, 0 = unlimited"},
+	{Key: "evaluation_cmts_allowlist", Type: SettingTypeString, Description: "Comma-separated CMTS IDs to evaluate, empty = all"},
+	{Key: "webhook_url", Type: SettingTypeString, Description: "POSTed on upgrade completion and final failure, empty = off"},
+	{Key: "cors_allowed_origins", Type: SettingTypeString, Description: "Comma-separated origins allowed to call the API from a browser, * = any"},
+}
+
+// SettingSchema returns the registry of known settings
+func SettingSchema() []SettingSpec {
+	return append([]SettingSpec(nil), settingSpecs...)
+}
+
+// LookupSetting returns the spec for key, if it is a known setting
+func LookupSetting(key string) (SettingSpec, bool) {
+	for _, spec := range settingSpecs {
+		if spec.Key == key {
+			return spec, true
+		}
+	}
+	return SettingSpec{}, false
+}
+
+// Validate checks value against the spec. Numeric values may be padded
+// with whitespace; enum values must match an option exactly.
+func (s SettingSpec) Validate(value string) error {
+	ok := true
+	switch s.Type {
+	case SettingTypeInt, SettingTypeDuration:
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		ok = err == nil && s.inBounds(float64(n))
+	case SettingTypeFloat:
+		f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		ok = err == nil && !math.IsNaN(f) && !math.IsInf(f, 0) && s.inBounds(f)
+	case SettingTypeEnum:
+		ok = slices.Contains(s.Options, value)
+	case SettingTypeBool:
+		_, err := strconv.ParseBool(value)
+		ok = err == nil
+	}
+	if ok {
+		return nil
+	}
+	if s.err != nil {
+		return s.err
+	}
+	return &ValidationError{Field: s.Key, Message: fmt.Sprintf("%s must be %s", s.Key, s.Constraint())}
+}
+
+// Constraint describes the values the setting accepts, such as "an integer
+// of at least 1"
+func (s SettingSpec) Constraint() string {
+	var noun string
+	switch s.Type {
+	case SettingTypeInt:
+		noun = "an integer"
+	case SettingTypeDuration:
+		noun = "a whole number of " + s.Unit
+	case SettingTypeFloat:
+		noun = "a number"
+	case SettingTypeEnum:
+		return "one of " + strings.Join(s.Options, ", ")
+	case SettingTypeBool:
+		return "true or false"
+	default:
+		return "a string"
+	}
+
+	switch {
+	case s.Min != nil && s.Max != nil:
+		return fmt.Sprintf("%s between %g and %g", noun, *s.Min, *s.Max)
+	case s.Min != nil:
+		return fmt.Sprintf("%s of at least %g", noun, *s.Min)
+	case s.Max != nil:
+		return fmt.Sprintf("%s of at most %g", noun, *s.Max)
+	}
+	return noun
+}
+
+func (s SettingSpec) inBounds(v float64) bool {
+	return (s.Min == nil || v >= *s.Min) && (s.Max == nil || v <= *s.Max)
+}
+
+// ValidateSetting checks value is acceptable for the setting key. Unknown
+// keys are not checked so settings can be added without a registry entry.
+func ValidateSetting(key, value string) error {
+	spec, ok := LookupSetting(key)
+	if !ok {
+		return nil
+	}
+	return spec.Validate(value)
 }
 
-// ParseMatchCriteria parses the JSON match criteria
+// Bounds on how often a running upgrade's status is polled, in seconds
+const (
+	DefaultUpgradePollSeconds = 10
+	MinUpgradePollSeconds     = 5
+	MaxUpgradePollSeconds     = 300
+)
+
+// validUpgradePollInterval reports whether seconds is within the poll bounds
+func validUpgradePollInterval(seconds int) bool {
+	return seconds >= MinUpgradePollSeconds && seconds <= MaxUpgradePollSeconds
+}
+
+// ParseMatchCriteria parses the JSON match criteria. Unknown keys are
+// ignored so rules stored before stricter validation keep matching.
 func (r *UpgradeRule) ParseMatchCriteria() (*MatchCriteria, error) {
 	var criteria MatchCriteria
 	if err := json.Unmarshal([]byte(r.MatchCriteria), &criteria); err != nil {
@@ -64,6 +669,57 @@ func (r *UpgradeRule) ParseMatchCriteria() (*MatchCriteria, error) {
 	return &criteria, nil
 }
 
+// parseMatchCriteriaStrict parses the JSON match criteria like
+// ParseMatchCriteria, but rejects unknown keys, naming the first one, so a
+// typo such as start_mc fails validation instead of matching nothing
+func (r *UpgradeRule) parseMatchCriteriaStrict() (*MatchCriteria, error) {
+	dec := json.NewDecoder(strings.NewReader(r.MatchCriteria))
+	dec.DisallowUnknownFields()
+
+	var criteria MatchCriteria
+	if err := dec.Decode(&criteria); err != nil {
+		if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+			return nil, &ValidationError{Field: "match_criteria", Message: fmt.Sprintf("unknown match criteria field %s", field)}
+		}
+		return nil, ErrInvalidMatchCriteria
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, ErrInvalidMatchCriteria
+	}
+	return &criteria, nil
+}
+
+// envPlaceholder matches ${NAME} references in rule fields
+var envPlaceholder = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// dottedVersion matches a firmware version such as 2.1.0
+var dottedVersion = regexp.MustCompile(`^\d+(\.\d+)*$`)
+
+// numericOID matches a numeric SNMP OID such as 1.3.6.1.4.1.4491.2.1.0,
+// with or without a leading dot
+var numericOID = regexp.MustCompile(`^\.?\d+(\.\d+)+$`)
+
+// ResolveTFTPServer expands ${NAME} environment variable references in
+// TFTPServerIP, so one rule set can point at a different firmware server per
+// deployment. An unset or empty variable is an error.
+func (r *UpgradeRule) ResolveTFTPServer() (string, error) {
+	var missing []string
+	resolved := envPlaceholder.ReplaceAllStringFunc(r.TFTPServerIP, func(ref string) string {
+		name := envPlaceholder.FindStringSubmatch(ref)[1]
+		value, ok := os.LookupEnv(name)
+		if !ok || value == "" {
+			missing = append(missing, name)
+		}
+		return value
+	})
+
+	if len(missing) > 0 {
+		return "", fmt.Errorf("environment variable %s referenced by tftp_server_ip is not set", strings.Join(missing, ", "))
+	}
+
+	return resolved, nil
+}
+
 // UpgradeJob represents a firmware upgrade job
 type UpgradeJob struct {
 	ID               int        `json:"id" db:"id"`
@@ -80,6 +736,67 @@ type UpgradeJob struct {
 	CreatedAt        time.Time  `json:"created_at" db:"created_at"`
 	StartedAt        *time.Time `json:"started_at" db:"started_at"`
 	CompletedAt      *time.Time `json:"completed_at" db:"completed_at"`
+	// NextRetryAt holds a failed job back until its retry backoff has elapsed
+	NextRetryAt *time.Time `json:"next_retry_at,omitempty" db:"next_retry_at"`
+	// DeadLetter marks a FAILED job that will not be retried automatically
+	DeadLetter bool `json:"dead_letter" db:"dead_letter"`
+	// CampaignID is set on jobs created by a campaign; RuleID is 0 for them
+	CampaignID int `json:"campaign_id,omitempty" db:"campaign_id"`
+	// AdminStatusValue, CustomUpgradeOID, TransportProtocol and
+	// UpgradePollInterval are copied from the rule
+	AdminStatusValue    int    `json:"admin_status_value,omitempty" db:"admin_status_value"`
+	CustomUpgradeOID    string `json:"custom_upgrade_oid,omitempty" db:"custom_upgrade_oid"`
+	TransportProtocol   string `json:"transport_protocol,omitempty" db:"transport_protocol"`
+	UpgradePollInterval int    `json:"upgrade_poll_interval,omitempty" db:"upgrade_poll_interval"`
+	// TraceID tags the engine's log lines for every attempt at the job
+	TraceID string `json:"trace_id,omitempty" db:"trace_id"`
+	// FailureDetails records every failed attempt, oldest first. Only
+	// single-job lookups load it.
+	FailureDetails []JobFailure `json:"failure_details,omitempty" db:"failure_details"`
+}
+
+// NewTraceID returns a random ID for correlating log lines, such as an
+// upgrade job's trace ID or an API request ID
+func NewTraceID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// JobFailure describes one failed attempt at an upgrade job
+type JobFailure struct {
+	Attempt int       `json:"attempt"`
+	At      time.Time `json:"at"`
+	Error   string    `json:"error"`
+	// Cause is the innermost error, usually what the SNMP agent or the
+	// network reported
+	Cause string `json:"cause,omitempty"`
+}
+
+// Duration returns how long the job ran, or false until it has both
+// started and completed
+func (j *UpgradeJob) Duration() (time.Duration, bool) {
+	if j.StartedAt == nil || j.CompletedAt == nil {
+		return 0, false
+	}
+	return j.CompletedAt.Sub(*j.StartedAt), true
+}
+
+// MarshalJSON adds duration_seconds to the job once it has finished, so
+// clients don't have to subtract the timestamps themselves
+func (j UpgradeJob) MarshalJSON() ([]byte, error) {
+	// jobFields has UpgradeJob's fields but not this method
+	type jobFields UpgradeJob
+	out := struct {
+		jobFields
+		DurationSeconds *int `json:"duration_seconds,omitempty"`
+	}{jobFields: jobFields(j)}
+
+	if d, ok := j.Duration(); ok {
+		seconds := int(d / time.Second)
+		out.DurationSeconds = &seconds
+	}
+	return json.Marshal(out)
 }
 
 // Job status constants
@@ -91,6 +808,58 @@ const (
 	JobStatusSkipped    = "SKIPPED"
 )
 
+// Campaign is a one-shot rollout. From StartAt it creates upgrade jobs for
+// the modems matching its target, at most RatePerMinute per minute (0 = all
+// at once), until every eligible matching modem has had one, then completes.
+type Campaign struct {
+	ID               int        `json:"id" db:"id"`
+	Name             string     `json:"name" db:"name"`
+	MatchType        string     `json:"match_type" db:"match_type"`
+	MatchCriteria    string     `json:"match_criteria" db:"match_criteria"`
+	TFTPServerIP     string     `json:"tftp_server_ip" db:"tftp_server_ip"`
+	FirmwareFilename string     `json:"firmware_filename" db:"firmware_filename"`
+	StartAt          time.Time  `json:"start_at" db:"start_at"`
+	RatePerMinute    int        `json:"rate_per_minute" db:"rate_per_minute"`
+	Status           string     `json:"status" db:"status"` // SCHEDULED, RUNNING, COMPLETED, CANCELLED
+	JobsCreated      int        `json:"jobs_created" db:"jobs_created"`
+	Remaining        int        `json:"remaining" db:"remaining"` // modems still awaiting a job at the last tick
+	CreatedAt        time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at" db:"updated_at"`
+	CompletedAt      *time.Time `json:"completed_at,omitempty" db:"completed_at"`
+}
+
+// Campaign status constants
+const (
+	CampaignStatusScheduled = "SCHEDULED"
+	CampaignStatusRunning   = "RUNNING"
+	CampaignStatusCompleted = "COMPLETED"
+	CampaignStatusCancelled = "CANCELLED"
+)
+
+// Target returns the campaign's target as an enabled rule, so it can be
+// matched and validated the same way rules are
+func (c *Campaign) Target() *UpgradeRule {
+	return &UpgradeRule{
+		Name:             c.Name,
+		MatchType:        c.MatchType,
+		MatchCriteria:    c.MatchCriteria,
+		TFTPServerIP:     c.TFTPServerIP,
+		FirmwareFilename: c.FirmwareFilename,
+		Enabled:          true,
+	}
+}
+
+// Validate validates a campaign
+func (c *Campaign) Validate() error {
+	if c.RatePerMinute < 0 {
+		return ErrInvalidCampaignRate
+	}
+	if c.StartAt.IsZero() {
+		return ErrInvalidCampaignStart
+	}
+	return c.Target().Validate()
+}
+
 // ActivityLog represents a system activity log entry
 type ActivityLog struct {
 	ID         int       `json:"id" db:"id"`
@@ -104,18 +873,35 @@ type ActivityLog struct {
 
 // Event type constants
 const (
-	EventModemDiscovered  = "MODEM_DISCOVERED"
-	EventModemLost        = "MODEM_LOST"
-	EventUpgradeStarted   = "UPGRADE_STARTED"
-	EventUpgradeCompleted = "UPGRADE_COMPLETED"
-	EventUpgradeFailed    = "UPGRADE_FAILED"
-	EventRuleCreated      = "RULE_CREATED"
-	EventRuleUpdated      = "RULE_UPDATED"
-	EventRuleDeleted      = "RULE_DELETED"
-	EventCMTSAdded        = "CMTS_ADDED"
-	EventCMTSUpdated      = "CMTS_UPDATED"
-	EventCMTSDeleted      = "CMTS_DELETED"
-	EventSystemEvent      = "SYSTEM_EVENT"
+	EventModemDiscovered      = "MODEM_DISCOVERED"
+	EventModemLost            = "MODEM_LOST"
+	EventModemOnline          = "MODEM_ONLINE"
+	EventModemReboot          = "MODEM_REBOOT"
+	EventModemTagsUpdated     = "MODEM_TAGS_UPDATED"
+	EventModemMoved           = "MODEM_MOVED"
+	EventModemsDeleted        = "MODEMS_DELETED"
+	EventUpgradeStarted       = "UPGRADE_STARTED"
+	EventUpgradeCompleted     = "UPGRADE_COMPLETED"
+	EventUpgradeFailed        = "UPGRADE_FAILED"
+	EventUpgradeCancelled     = "UPGRADE_CANCELLED"
+	EventUpgradeDryRun        = "UPGRADE_DRY_RUN"
+	EventUpgradeManual        = "UPGRADE_MANUAL"
+	EventRetryBudgetExhausted = "RETRY_BUDGET_EXHAUSTED"
+	EventRuleCreated          = "RULE_CREATED"
+	EventRuleUpdated          = "RULE_UPDATED"
+	EventRuleDeleted          = "RULE_DELETED"
+	EventRulesImported        = "RULES_IMPORTED"
+	EventConfigRestored       = "CONFIG_RESTORED"
+	EventCMTSAdded            = "CMTS_ADDED"
+	EventCMTSUpdated          = "CMTS_UPDATED"
+	EventCMTSDeleted          = "CMTS_DELETED"
+	EventCMTSRestored         = "CMTS_RESTORED"
+	EventDiscoveryAborted     = "DISCOVERY_ABORTED"
+	EventCampaignCreated      = "CAMPAIGN_CREATED"
+	EventCampaignStarted      = "CAMPAIGN_STARTED"
+	EventCampaignCompleted    = "CAMPAIGN_COMPLETED"
+	EventCampaignCancelled    = "CAMPAIGN_CANCELLED"
+	EventSystemEvent          = "SYSTEM_EVENT"
 )
 
 // Validate validates a CMTS configuration
@@ -135,6 +921,12 @@ func (c *CMTS) Validate() error {
 	if c.SNMPVersion < 1 || c.SNMPVersion > 3 {
 		return ErrInvalidSNMPVersion
 	}
+	if c.MaxFirmwareVersion != "" && !dottedVersion.MatchString(c.MaxFirmwareVersion) {
+		return ErrInvalidMaxFirmware
+	}
+	if c.SNMPMaxOids < 0 || c.SNMPMaxOids > DefaultSNMPMaxOids {
+		return ErrInvalidSNMPMaxOids
+	}
 	return nil
 }
 
@@ -143,38 +935,95 @@ func (r *UpgradeRule) Validate() error {
 	if r.Name == "" {
 		return ErrInvalidName
 	}
-	if r.MatchType != "MAC_RANGE" && r.MatchType != "SYSDESCR_REGEX" {
+	if !validMatchType(r.MatchType) {
 		return ErrInvalidMatchType
 	}
-	if r.TFTPServerIP == "" {
+	// Exclude rules never create jobs, so they need no firmware target
+	if r.TFTPServerIP == "" && !r.Exclude {
 		return ErrInvalidTFTPServer
 	}
-	if r.FirmwareFilename == "" {
+	if strings.Contains(envPlaceholder.ReplaceAllString(r.TFTPServerIP, ""), "${") {
+		return ErrInvalidTFTPPlaceholder
+	}
+	if r.FirmwareFilename == "" && !r.Exclude {
 		return ErrInvalidFirmware
 	}
+	if r.CanaryPercent < 0 || r.CanaryPercent > 100 {
+		return ErrInvalidCanaryPercent
+	}
+	if r.MaxConcurrent < 0 {
+		return ErrInvalidMaxConcurrent
+	}
+	if r.AdminStatusValue < 0 {
+		return ErrInvalidAdminStatus
+	}
+	if r.MaxRetries < 0 || r.MaxRetries > MaxRuleRetries {
+		return ErrInvalidMaxRetries
+	}
+	if r.CustomUpgradeOID != "" && !numericOID.MatchString(r.CustomUpgradeOID) {
+		return ErrInvalidUpgradeOID
+	}
+	if !validTransportProtocol(r.TransportProtocol) {
+		return ErrInvalidTransport
+	}
+	if r.UpgradePollInterval != 0 && !validUpgradePollInterval(r.UpgradePollInterval) {
+		return ErrInvalidPollInterval
+	}
 
 	// Validate match criteria JSON
-	_, err := r.ParseMatchCriteria()
+	criteria, err := r.parseMatchCriteriaStrict()
 	if err != nil {
-		return ErrInvalidMatchCriteria
+		return err
 	}
 
-	return nil
+	return criteria.validate(r.MatchType, 0)
 }
 
 // Common errors
 var (
-	ErrInvalidName          = &ValidationError{Field: "name", Message: "name is required"}
-	ErrInvalidIPAddress     = &ValidationError{Field: "ip_address", Message: "valid IP address is required"}
-	ErrInvalidPort          = &ValidationError{Field: "port", Message: "port must be between 1 and 65535"}
-	ErrInvalidCommunity     = &ValidationError{Field: "community", Message: "SNMP community string is required"}
-	ErrInvalidSNMPVersion   = &ValidationError{Field: "snmp_version", Message: "SNMP version must be 1, 2, or 3"}
-	ErrInvalidMatchType     = &ValidationError{Field: "match_type", Message: "match_type must be MAC_RANGE or SYSDESCR_REGEX"}
-	ErrInvalidTFTPServer    = &ValidationError{Field: "tftp_server_ip", Message: "TFTP server IP is required"}
-	ErrInvalidFirmware      = &ValidationError{Field: "firmware_filename", Message: "firmware filename is required"}
-	ErrInvalidMatchCriteria = &ValidationError{Field: "match_criteria", Message: "invalid match criteria JSON"}
-	ErrNotFound             = &AppError{Code: "NOT_FOUND", Message: "resource not found"}
-	ErrDuplicate            = &AppError{Code: "DUPLICATE", Message: "resource already exists"}
+	ErrInvalidName            = &ValidationError{Field: "name", Message: "name is required"}
+	ErrInvalidIPAddress       = &ValidationError{Field: "ip_address", Message: "valid IP address is required"}
+	ErrInvalidPort            = &ValidationError{Field: "port", Message: "port must be between 1 and 65535"}
+	ErrInvalidCommunity       = &ValidationError{Field: "community", Message: "SNMP community string is required"}
+	ErrInvalidSNMPVersion     = &ValidationError{Field: "snmp_version", Message: "SNMP version must be 1, 2, or 3"}
+	ErrInvalidMaxFirmware     = &ValidationError{Field: "max_firmware_version", Message: "max_firmware_version must be a dotted version such as 2.1.0"}
+	ErrInvalidSNMPMaxOids     = &ValidationError{Field: "snmp_max_oids", Message: fmt.Sprintf("snmp_max_oids must be between 1 and %d", DefaultSNMPMaxOids)}
+	ErrInvalidMatchType       = &ValidationError{Field: "match_type", Message: "match_type must be MAC_RANGE, IP_RANGE, SYSDESCR_REGEX, TAG_MATCH or COMPOSITE"}
+	ErrInvalidTFTPServer      = &ValidationError{Field: "tftp_server_ip", Message: "TFTP server IP is required"}
+	ErrInvalidTFTPPlaceholder = &ValidationError{Field: "tftp_server_ip", Message: "tftp_server_ip placeholders must look like ${NAME}"}
+	ErrInvalidFirmware        = &ValidationError{Field: "firmware_filename", Message: "firmware filename is required"}
+	ErrInvalidCanaryPercent   = &ValidationError{Field: "canary_percent", Message: "canary_percent must be between 0 and 100"}
+	ErrInvalidMaxConcurrent   = &ValidationError{Field: "max_concurrent", Message: "max_concurrent must be 0 (unlimited) or more"}
+	ErrInvalidAdminStatus     = &ValidationError{Field: "admin_status_value", Message: "admin_status_value must be 0 (default) or more"}
+	ErrInvalidMaxRetries      = &ValidationError{Field: "max_retries", Message: fmt.Sprintf("max_retries must be between 0 and %d", MaxRuleRetries)}
+	ErrInvalidUpgradeOID      = &ValidationError{Field: "custom_upgrade_oid", Message: "custom_upgrade_oid must be a numeric OID such as 1.3.6.1.2.1.69.1.3.3.0"}
+	ErrInvalidTransport       = &ValidationError{Field: "transport_protocol", Message: "transport_protocol must be tftp or http"}
+	ErrInvalidCampaignRate    = &ValidationError{Field: "rate_per_minute", Message: "rate_per_minute must be 0 (unpaced) or more"}
+	ErrInvalidCampaignStart   = &ValidationError{Field: "start_at", Message: "start_at is required"}
+	ErrInvalidMatchCriteria   = &ValidationError{Field: "match_criteria", Message: "invalid match criteria JSON"}
+	ErrInvalidIPRange         = &ValidationError{Field: "match_criteria", Message: "start_ip and end_ip must be valid IPv4 addresses"}
+	ErrIPRangeOrder           = &ValidationError{Field: "match_criteria", Message: "start_ip must be less than or equal to end_ip"}
+	ErrInvalidMACRange        = &ValidationError{Field: "match_criteria", Message: "start_mac and end_mac must be valid MAC addresses"}
+	ErrMACRangeOrder          = &ValidationError{Field: "match_criteria", Message: "start_mac must be less than or equal to end_mac"}
+	ErrNoPattern              = &ValidationError{Field: "match_criteria", Message: "SYSDESCR_REGEX criteria need a pattern"}
+	ErrIPv6NotSupported       = &ValidationError{Field: "match_criteria", Message: "IPv6 addresses are not supported for IP_RANGE"}
+	ErrInvalidOperator        = &ValidationError{Field: "match_criteria", Message: "COMPOSITE operator must be AND or OR"}
+	ErrNoConditions           = &ValidationError{Field: "match_criteria", Message: "COMPOSITE criteria need at least one condition"}
+	ErrNoTags                 = &ValidationError{Field: "match_criteria", Message: "TAG_MATCH criteria need at least one tag"}
+	ErrInvalidTag             = &ValidationError{Field: "tags", Message: "tags must be non-empty strings"}
+	ErrInvalidInterval        = &ValidationError{Field: "value", Message: "interval settings must be a positive number of seconds"}
+	ErrInvalidPollInterval    = &ValidationError{Field: "upgrade_poll_interval", Message: fmt.Sprintf("upgrade_poll_interval must be between %d and %d seconds", MinUpgradePollSeconds, MaxUpgradePollSeconds)}
+	ErrMatchTooDeep           = &ValidationError{Field: "match_criteria", Message: fmt.Sprintf("COMPOSITE criteria may nest at most %d levels", MaxMatchDepth)}
+	ErrNotFound               = &AppError{Code: "NOT_FOUND", Message: "resource not found"}
+	ErrDuplicate              = &AppError{Code: "DUPLICATE", Message: "resource already exists"}
+	ErrInvalidJobState        = &AppError{Code: "INVALID_STATE", Message: "job cannot be changed in its current state"}
+	ErrCampaignFinished       = &AppError{Code: "INVALID_STATE", Message: "campaign has already finished"}
+	ErrModemOffline           = &AppError{Code: "MODEM_OFFLINE", Message: "modem status is not eligible for upgrade"}
+	ErrModemNoIP              = &AppError{Code: "MODEM_NO_IP", Message: "modem has no IP address"}
+	ErrNoModemCommunity       = &AppError{Code: "NO_COMMUNITY", Message: "no SNMP write community string available"}
+	ErrUpgradeActive          = &AppError{Code: "UPGRADE_ACTIVE", Message: "modem already has a pending or in-progress job"}
+	ErrRuleDisabled           = &AppError{Code: "RULE_DISABLED", Message: "rule is disabled"}
+	ErrModemExcluded          = &AppError{Code: "MODEM_EXCLUDED", Message: "modem matches an exclude rule"}
 )
 
 // ValidationError represents a validation error
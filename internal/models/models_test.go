@@ -1,7 +1,10 @@
 package models
 
 import (
+	"encoding/json"
+	"strings"
 	"testing"
+	"time"
 )
 
 // CMTS Validation Tests
@@ -155,6 +158,157 @@ func TestUpgradeRuleValidate(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "Valid IP_RANGE rule",
+			rule: &UpgradeRule{
+				Name:             "Test Rule",
+				MatchType:        "IP_RANGE",
+				MatchCriteria:    `{"start_ip":"10.20.0.0","end_ip":"10.20.255.255"}`,
+				TFTPServerIP:     "192.168.1.50",
+				FirmwareFilename: "firmware.bin",
+			},
+			wantErr: false,
+		},
+		{
+			name: "IP_RANGE with invalid address",
+			rule: &UpgradeRule{
+				Name:             "Test Rule",
+				MatchType:        "IP_RANGE",
+				MatchCriteria:    `{"start_ip":"10.20.0.0","end_ip":"not-an-ip"}`,
+				TFTPServerIP:     "192.168.1.50",
+				FirmwareFilename: "firmware.bin",
+			},
+			wantErr: true,
+			errType: ErrInvalidIPRange,
+		},
+		{
+			name: "IP_RANGE with IPv6 address",
+			rule: &UpgradeRule{
+				Name:             "Test Rule",
+				MatchType:        "IP_RANGE",
+				MatchCriteria:    `{"start_ip":"2001:db8::","end_ip":"2001:db8::ffff"}`,
+				TFTPServerIP:     "192.168.1.50",
+				FirmwareFilename: "firmware.bin",
+			},
+			wantErr: true,
+			errType: ErrIPv6NotSupported,
+		},
+		{
+			name: "Canary percent out of range",
+			rule: &UpgradeRule{
+				Name:             "Test Rule",
+				MatchType:        "MAC_RANGE",
+				MatchCriteria:    `{"start_mac":"00:01:5C:00:00:00","end_mac":"00:01:5C:FF:FF:FF"}`,
+				TFTPServerIP:     "192.168.1.50",
+				FirmwareFilename: "firmware.bin",
+				CanaryPercent:    101,
+			},
+			wantErr: true,
+			errType: ErrInvalidCanaryPercent,
+		},
+		{
+			name: "Negative max concurrent",
+			rule: &UpgradeRule{
+				Name:             "Test Rule",
+				MatchType:        "MAC_RANGE",
+				MatchCriteria:    `{"start_mac":"00:01:5C:00:00:00","end_mac":"00:01:5C:FF:FF:FF"}`,
+				TFTPServerIP:     "192.168.1.50",
+				FirmwareFilename: "firmware.bin",
+				MaxConcurrent:    -1,
+			},
+			wantErr: true,
+			errType: ErrInvalidMaxConcurrent,
+		},
+		{
+			name: "Negative admin status value",
+			rule: &UpgradeRule{
+				Name:             "Test Rule",
+				MatchType:        "MAC_RANGE",
+				MatchCriteria:    `{"start_mac":"00:01:5C:00:00:00","end_mac":"00:01:5C:FF:FF:FF"}`,
+				TFTPServerIP:     "192.168.1.50",
+				FirmwareFilename: "firmware.bin",
+				AdminStatusValue: -1,
+			},
+			wantErr: true,
+			errType: ErrInvalidAdminStatus,
+		},
+		{
+			name: "Negative max retries",
+			rule: &UpgradeRule{
+				Name:             "Test Rule",
+				MatchType:        "MAC_RANGE",
+				MatchCriteria:    `{"start_mac":"00:01:5C:00:00:00","end_mac":"00:01:5C:FF:FF:FF"}`,
+				TFTPServerIP:     "192.168.1.50",
+				FirmwareFilename: "firmware.bin",
+				MaxRetries:       -1,
+			},
+			wantErr: true,
+			errType: ErrInvalidMaxRetries,
+		},
+		{
+			name: "Too many max retries",
+			rule: &UpgradeRule{
+				Name:             "Test Rule",
+				MatchType:        "MAC_RANGE",
+				MatchCriteria:    `{"start_mac":"00:01:5C:00:00:00","end_mac":"00:01:5C:FF:FF:FF"}`,
+				TFTPServerIP:     "192.168.1.50",
+				FirmwareFilename: "firmware.bin",
+				MaxRetries:       11,
+			},
+			wantErr: true,
+			errType: ErrInvalidMaxRetries,
+		},
+		{
+			name: "Non-numeric upgrade OID",
+			rule: &UpgradeRule{
+				Name:             "Test Rule",
+				MatchType:        "MAC_RANGE",
+				MatchCriteria:    `{"start_mac":"00:01:5C:00:00:00","end_mac":"00:01:5C:FF:FF:FF"}`,
+				TFTPServerIP:     "192.168.1.50",
+				FirmwareFilename: "firmware.bin",
+				CustomUpgradeOID: "docsDevSwAdminStatus.0",
+			},
+			wantErr: true,
+			errType: ErrInvalidUpgradeOID,
+		},
+		{
+			name: "Vendor upgrade OID",
+			rule: &UpgradeRule{
+				Name:             "Test Rule",
+				MatchType:        "MAC_RANGE",
+				MatchCriteria:    `{"start_mac":"00:01:5C:00:00:00","end_mac":"00:01:5C:FF:FF:FF"}`,
+				TFTPServerIP:     "192.168.1.50",
+				FirmwareFilename: "firmware.bin",
+				AdminStatusValue: 2,
+				CustomUpgradeOID: ".1.3.6.1.4.1.4115.1.3.4.1.1.5.0",
+			},
+			wantErr: false,
+		},
+		{
+			name: "HTTP transport",
+			rule: &UpgradeRule{
+				Name:              "Test Rule",
+				MatchType:         "MAC_RANGE",
+				MatchCriteria:     `{"start_mac":"00:01:5C:00:00:00","end_mac":"00:01:5C:FF:FF:FF"}`,
+				TFTPServerIP:      "192.168.1.50",
+				FirmwareFilename:  "firmware.bin",
+				TransportProtocol: TransportHTTP,
+			},
+			wantErr: false,
+		},
+		{
+			name: "Unknown transport",
+			rule: &UpgradeRule{
+				Name:              "Test Rule",
+				MatchType:         "MAC_RANGE",
+				MatchCriteria:     `{"start_mac":"00:01:5C:00:00:00","end_mac":"00:01:5C:FF:FF:FF"}`,
+				TFTPServerIP:      "192.168.1.50",
+				FirmwareFilename:  "firmware.bin",
+				TransportProtocol: "ftp",
+			},
+			wantErr: true,
+			errType: ErrInvalidTransport,
+		},
 		{
 			name: "Missing name",
 			rule: &UpgradeRule{
@@ -203,6 +357,27 @@ func TestUpgradeRuleValidate(t *testing.T) {
 			wantErr: true,
 			errType: ErrInvalidFirmware,
 		},
+		{
+			name: "Exclude rule without firmware target",
+			rule: &UpgradeRule{
+				Name:          "Lab modems",
+				MatchType:     "MAC_RANGE",
+				MatchCriteria: `{"start_mac":"00:01:5C:AA:00:00","end_mac":"00:01:5C:AA:FF:FF"}`,
+				Exclude:       true,
+			},
+			wantErr: false,
+		},
+		{
+			name: "Exclude rule with invalid criteria",
+			rule: &UpgradeRule{
+				Name:          "Lab modems",
+				MatchType:     "MAC_RANGE",
+				MatchCriteria: `{invalid json}`,
+				Exclude:       true,
+			},
+			wantErr: true,
+			errType: ErrInvalidMatchCriteria,
+		},
 		{
 			name: "Invalid JSON in match criteria",
 			rule: &UpgradeRule{
@@ -302,6 +477,217 @@ func TestParseMatchCriteria(t *testing.T) {
 	}
 }
 
+// ResolveTFTPServer Tests
+
+func TestResolveTFTPServer(t *testing.T) {
+	t.Setenv("FIRMWARE_SERVER", "10.9.8.7")
+	t.Setenv("FIRMWARE_EMPTY", "")
+
+	tests := []struct {
+		name      string
+		server    string
+		expected  string
+		wantError bool
+	}{
+		{"Literal IP", "192.168.1.50", "192.168.1.50", false},
+		{"Whole value placeholder", "${FIRMWARE_SERVER}", "10.9.8.7", false},
+		{"Embedded placeholder", "tftp://${FIRMWARE_SERVER}:69", "tftp://10.9.8.7:69", false},
+		{"Unset variable", "${FIRMWARE_SERVER_MISSING}", "", true},
+		{"Empty variable", "${FIRMWARE_EMPTY}", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := &UpgradeRule{TFTPServerIP: tt.server}
+			resolved, err := rule.ResolveTFTPServer()
+			if (err != nil) != tt.wantError {
+				t.Fatalf("ResolveTFTPServer() error = %v, wantError %v", err, tt.wantError)
+			}
+			if resolved != tt.expected {
+				t.Errorf("ResolveTFTPServer() = %q, want %q", resolved, tt.expected)
+			}
+		})
+	}
+}
+
+func TestUpgradeRuleValidateTFTPPlaceholder(t *testing.T) {
+	rule := &UpgradeRule{
+		Name:             "Test Rule",
+		MatchType:        "MAC_RANGE",
+		MatchCriteria:    `{"start_mac":"00:01:5C:00:00:00","end_mac":"00:01:5C:FF:FF:FF"}`,
+		TFTPServerIP:     "${FIRMWARE_SERVER}",
+		FirmwareFilename: "firmware.bin",
+	}
+
+	// Variables are resolved per environment, so an unset one still validates
+	if err := rule.Validate(); err != nil {
+		t.Errorf("Validate() error = %v, want nil", err)
+	}
+
+	rule.TFTPServerIP = "${FIRMWARE SERVER}"
+	if err := rule.Validate(); err != ErrInvalidTFTPPlaceholder {
+		t.Errorf("Validate() error = %v, want %v", err, ErrInvalidTFTPPlaceholder)
+	}
+}
+
+func TestUpgradeRuleValidateStrictCriteria(t *testing.T) {
+	tests := []struct {
+		name      string
+		matchType string
+		criteria  string
+		wantErr   string
+	}{
+		{"typo in key", "MAC_RANGE", `{"start_mc":"00:01:5C:00:00:00","end_mac":"00:01:5C:FF:FF:FF"}`, `unknown match criteria field "start_mc"`},
+		{"typo in condition", "COMPOSITE", `{"operator":"OR","conditions":[{"match_type":"SYSDESCR_REGEX","patern":"Arris"}]}`, `unknown match criteria field "patern"`},
+		{"trailing data", "SYSDESCR_REGEX", `{"pattern":"Arris"} {}`, ErrInvalidMatchCriteria.Message},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := &UpgradeRule{
+				Name:             "Test Rule",
+				MatchType:        tt.matchType,
+				MatchCriteria:    tt.criteria,
+				TFTPServerIP:     "192.168.1.50",
+				FirmwareFilename: "firmware.bin",
+			}
+			err := rule.Validate()
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	// A known field another match type reads is ignored, e.g. one left over
+	// from changing a rule's match type
+	rule := &UpgradeRule{
+		Name:             "Test Rule",
+		MatchType:        "MAC_RANGE",
+		MatchCriteria:    `{"start_mac":"00:01:5C:00:00:00","end_mac":"00:01:5C:FF:FF:FF","pattern":"Arris"}`,
+		TFTPServerIP:     "192.168.1.50",
+		FirmwareFilename: "firmware.bin",
+	}
+	if err := rule.Validate(); err != nil {
+		t.Errorf("Validate() error = %v, want nil", err)
+	}
+
+	// Stored rules are still parsed leniently so they keep matching
+	rule = &UpgradeRule{MatchType: "SYSDESCR_REGEX", MatchCriteria: `{"pattern":"Arris","note":"legacy"}`}
+	criteria, err := rule.ParseMatchCriteria()
+	if err != nil || criteria.Pattern != "Arris" {
+		t.Errorf("ParseMatchCriteria() = %+v, %v; want pattern Arris", criteria, err)
+	}
+}
+
+func TestUpgradeRuleValidateComposite(t *testing.T) {
+	rule := &UpgradeRule{
+		Name:             "Arris in range",
+		MatchType:        "COMPOSITE",
+		MatchCriteria:    `{"operator":"AND","conditions":[{"match_type":"SYSDESCR_REGEX","pattern":"Arris"},{"match_type":"MAC_RANGE","start_mac":"00:01:5C:00:00:00","end_mac":"00:01:5C:FF:FF:FF"}]}`,
+		TFTPServerIP:     "192.168.1.50",
+		FirmwareFilename: "firmware.bin",
+	}
+	if err := rule.Validate(); err != nil {
+		t.Errorf("Validate() error = %v, want nil", err)
+	}
+
+	tests := []struct {
+		criteria string
+		wantErr  string
+	}{
+		{`{"operator":"NAND","conditions":[{"match_type":"SYSDESCR_REGEX","pattern":"Arris"}]}`, ErrInvalidOperator.Message},
+		{`{"operator":"OR"}`, ErrNoConditions.Message},
+		{`{"operator":"OR","conditions":[{"match_type":"VENDOR"}]}`, "conditions[0]: " + ErrInvalidMatchType.Message},
+		{`{"operator":"OR","conditions":[{"match_type":"IP_RANGE","start_ip":"2001:db8::","end_ip":"2001:db8::1"}]}`, "conditions[0]: " + ErrIPv6NotSupported.Message},
+		{`{"operator":"OR","conditions":[{"match_type":"COMPOSITE","operator":"AND"}]}`, "conditions[0]: " + ErrNoConditions.Message},
+	}
+
+	for _, tt := range tests {
+		rule.MatchCriteria = tt.criteria
+		err := rule.Validate()
+		if err == nil || err.Error() != tt.wantErr {
+			t.Errorf("Validate(%s) error = %v, want %q", tt.criteria, err, tt.wantErr)
+		}
+	}
+}
+
+func TestUpgradeRuleValidateTagMatch(t *testing.T) {
+	rule := &UpgradeRule{
+		Name:             "Business customers",
+		MatchType:        "TAG_MATCH",
+		MatchCriteria:    `{"tags":["business"]}`,
+		TFTPServerIP:     "192.168.1.50",
+		FirmwareFilename: "firmware.bin",
+	}
+	if err := rule.Validate(); err != nil {
+		t.Errorf("Validate() error = %v, want nil", err)
+	}
+
+	tests := []struct {
+		criteria string
+		wantErr  string
+	}{
+		{`{}`, ErrNoTags.Message},
+		{`{"tags":["business",""]}`, ErrInvalidTag.Message},
+	}
+
+	for _, tt := range tests {
+		rule.MatchCriteria = tt.criteria
+		err := rule.Validate()
+		if err == nil || err.Error() != tt.wantErr {
+			t.Errorf("Validate(%s) error = %v, want %q", tt.criteria, err, tt.wantErr)
+		}
+	}
+}
+
+func TestUpgradeRuleValidateRanges(t *testing.T) {
+	tests := []struct {
+		name      string
+		matchType string
+		criteria  string
+		wantErr   string
+	}{
+		{"valid MAC range", "MAC_RANGE", `{"start_mac":"00:01:5C:00:00:00","end_mac":"00:01:5C:FF:FF:FF"}`, ""},
+		{"Cisco dot MAC range", "MAC_RANGE", `{"start_mac":"0001.5c00.0000","end_mac":"00-01-5C-FF-FF-FF"}`, ""},
+		{"missing start_mac", "MAC_RANGE", `{"end_mac":"00:01:5C:FF:FF:FF"}`, ErrInvalidMACRange.Message},
+		{"missing end_mac", "MAC_RANGE", `{"start_mac":"00:01:5C:00:00:00"}`, ErrInvalidMACRange.Message},
+		{"invalid start_mac", "MAC_RANGE", `{"start_mac":"invalid","end_mac":"00:01:5C:FF:FF:FF"}`, ErrInvalidMACRange.Message},
+		{"MAC start after end", "MAC_RANGE", `{"start_mac":"00:01:5C:FF:FF:FF","end_mac":"00:01:5C:00:00:00"}`, ErrMACRangeOrder.Message},
+		{"valid IP range", "IP_RANGE", `{"start_ip":"10.20.0.0","end_ip":"10.20.255.255"}`, ""},
+		{"missing start_ip", "IP_RANGE", `{"end_ip":"10.20.255.255"}`, ErrInvalidIPRange.Message},
+		{"IPv6 range", "IP_RANGE", `{"start_ip":"2001:db8::","end_ip":"2001:db8::ffff"}`, ErrIPv6NotSupported.Message},
+		{"IP start after end", "IP_RANGE", `{"start_ip":"10.20.255.255","end_ip":"10.20.0.0"}`, ErrIPRangeOrder.Message},
+		{"valid pattern", "SYSDESCR_REGEX", `{"pattern":"Arris.*SB8200"}`, ""},
+		{"missing pattern", "SYSDESCR_REGEX", `{}`, ErrNoPattern.Message},
+		{"invalid pattern", "SYSDESCR_REGEX", `{"pattern":"[invalid(regex"}`, "invalid regex pattern: error parsing regexp: missing closing ]: `[invalid(regex`"},
+		{"invalid nested condition", "COMPOSITE", `{"operator":"AND","conditions":[{"match_type":"SYSDESCR_REGEX","pattern":"Arris"},{"match_type":"COMPOSITE","operator":"OR","conditions":[{"match_type":"MAC_RANGE","start_mac":"bogus","end_mac":"00:01:5C:FF:FF:FF"}]}]}`, "conditions[1]: conditions[0]: " + ErrInvalidMACRange.Message},
+		{"conditions not a list", "COMPOSITE", `{"operator":"AND","conditions":{"match_type":"SYSDESCR_REGEX"}}`, ErrInvalidMatchCriteria.Message},
+		{"invalid JSON", "MAC_RANGE", `{invalid json}`, ErrInvalidMatchCriteria.Message},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := &UpgradeRule{
+				Name:             "Test Rule",
+				MatchType:        tt.matchType,
+				MatchCriteria:    tt.criteria,
+				TFTPServerIP:     "192.168.1.50",
+				FirmwareFilename: "firmware.bin",
+			}
+			err := rule.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 // Error Types Tests
 
 func TestValidationError(t *testing.T) {
@@ -360,6 +746,7 @@ func TestEventTypeConstants(t *testing.T) {
 	events := []string{
 		EventModemDiscovered,
 		EventModemLost,
+		EventModemOnline,
 		EventUpgradeStarted,
 		EventUpgradeCompleted,
 		EventUpgradeFailed,
@@ -375,6 +762,7 @@ func TestEventTypeConstants(t *testing.T) {
 	expectedEvents := []string{
 		"MODEM_DISCOVERED",
 		"MODEM_LOST",
+		"MODEM_ONLINE",
 		"UPGRADE_STARTED",
 		"UPGRADE_COMPLETED",
 		"UPGRADE_FAILED",
@@ -506,6 +894,88 @@ func TestUpgradeJobWithErrorMessage(t *testing.T) {
 	}
 }
 
+func TestUpgradeJobDurationJSON(t *testing.T) {
+	started := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	completed := started.Add(90 * time.Second)
+	job := UpgradeJob{
+		ID:          1,
+		Status:      JobStatusCompleted,
+		StartedAt:   &started,
+		CompletedAt: &completed,
+	}
+
+	data, err := json.Marshal(job)
+	if err != nil {
+		t.Fatalf("Failed to marshal job: %v", err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to unmarshal job: %v", err)
+	}
+	if decoded["duration_seconds"] != float64(90) {
+		t.Errorf("Expected duration_seconds 90, got %v", decoded["duration_seconds"])
+	}
+	if decoded["status"] != JobStatusCompleted {
+		t.Errorf("Expected job fields to be kept, got %s", data)
+	}
+
+	// A job that hasn't finished has no duration
+	job.CompletedAt = nil
+	data, err = json.Marshal(&job)
+	if err != nil {
+		t.Fatalf("Failed to marshal job: %v", err)
+	}
+	if strings.Contains(string(data), "duration_seconds") {
+		t.Errorf("Expected no duration_seconds for unfinished job, got %s", data)
+	}
+}
+
+func TestCableModemStaleJSON(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	modem := CableModem{ID: 1, Status: "online", LastSeen: now.Add(-5 * time.Minute)}
+
+	view := modem.JSON(now)
+	if view.StaleSeconds != 300 || view.IsStale {
+		t.Errorf("Expected 300s and fresh under the default threshold, got %d/%v", view.StaleSeconds, view.IsStale)
+	}
+
+	modem.LastSeen = now.Add(-15 * time.Minute)
+	if !modem.JSON(now).IsStale {
+		t.Error("Expected a modem unseen for 15m to be stale under the default threshold")
+	}
+	modem.StaleAfter = 20 * time.Minute
+	if modem.JSON(now).IsStale {
+		t.Error("Expected a modem unseen for 15m to be fresh under a 20m threshold")
+	}
+
+	// Marshalling measures against the real clock, so 2024 is long stale
+	data, err := json.Marshal(modem)
+	if err != nil {
+		t.Fatalf("Failed to marshal modem: %v", err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to unmarshal modem: %v", err)
+	}
+	if _, ok := decoded["stale_seconds"]; !ok || decoded["is_stale"] != true || decoded["status"] != "online" {
+		t.Errorf("Expected modem fields plus staleness, got %s", data)
+	}
+	if _, ok := decoded["StaleAfter"]; ok {
+		t.Errorf("Expected the threshold to stay out of the JSON, got %s", data)
+	}
+
+	for value, want := range map[string]time.Duration{
+		"":    DefaultModemStaleMinutes * time.Minute,
+		"0":   DefaultModemStaleMinutes * time.Minute,
+		"abc": DefaultModemStaleMinutes * time.Minute,
+		"30":  30 * time.Minute,
+	} {
+		if got := ModemStaleThreshold(value); got != want {
+			t.Errorf("ModemStaleThreshold(%q) = %v, want %v", value, got, want)
+		}
+	}
+}
+
 func TestActivityLogStructure(t *testing.T) {
 	log := &ActivityLog{
 		ID:         1,
@@ -557,6 +1027,35 @@ func TestCMTSValidateEdgeCases(t *testing.T) {
 	if err := cmts.Validate(); err != nil {
 		t.Errorf("SNMP version 3 should be valid, got error: %v", err)
 	}
+
+	// Firmware cap must be a dotted version
+	cmts.MaxFirmwareVersion = "2.1.0"
+	if err := cmts.Validate(); err != nil {
+		t.Errorf("Max firmware 2.1.0 should be valid, got error: %v", err)
+	}
+	cmts.MaxFirmwareVersion = "v2.1"
+	if err := cmts.Validate(); err != ErrInvalidMaxFirmware {
+		t.Errorf("Expected ErrInvalidMaxFirmware, got %v", err)
+	}
+	cmts.MaxFirmwareVersion = ""
+
+	// Max OIDs per request is 1-60, with 0 meaning the default
+	for _, n := range []int{0, 1, 60} {
+		cmts.SNMPMaxOids = n
+		if err := cmts.Validate(); err != nil {
+			t.Errorf("snmp_max_oids %d should be valid, got error: %v", n, err)
+		}
+	}
+	for _, n := range []int{-1, 61} {
+		cmts.SNMPMaxOids = n
+		if err := cmts.Validate(); err != ErrInvalidSNMPMaxOids {
+			t.Errorf("Expected ErrInvalidSNMPMaxOids for %d, got %v", n, err)
+		}
+	}
+	cmts.SNMPMaxOids = 0
+	if cmts.MaxOids() != DefaultSNMPMaxOids {
+		t.Errorf("Expected unset max OIDs to default to %d, got %d", DefaultSNMPMaxOids, cmts.MaxOids())
+	}
 }
 
 func TestUpgradeRuleValidateEdgeCases(t *testing.T) {
@@ -586,3 +1085,134 @@ func TestMatchCriteriaEmptyFields(t *testing.T) {
 		t.Error("Empty criteria should have empty fields")
 	}
 }
+
+func TestValidateSetting(t *testing.T) {
+	for _, tt := range []struct {
+		key, value string
+		wantErr    bool
+	}{
+		{"discovery_interval", "60", false},
+		{"evaluation_interval", " 120 ", false},
+		{"discovery_interval", "0", true},
+		{"poll_interval", "-5", true},
+		{"cleanup_interval", "", true},
+		{"evaluation_interval", "2m", true},
+		{"custom_setting", "0", false},
+	} {
+		err := ValidateSetting(tt.key, tt.value)
+		if tt.wantErr && err != ErrInvalidInterval {
+			t.Errorf("ValidateSetting(%q, %q): expected ErrInvalidInterval, got %v", tt.key, tt.value, err)
+		}
+		if !tt.wantErr && err != nil {
+			t.Errorf("ValidateSetting(%q, %q): unexpected error %v", tt.key, tt.value, err)
+		}
+	}
+}
+
+func TestValidateTypedSettings(t *testing.T) {
+	for _, tt := range []struct {
+		key, value string
+		wantErr    string
+	}{
+		{"workers", "8", ""},
+		{"workers", "abc", "workers must be an integer of at least 1"},
+		{"workers", "0", "workers must be an integer of at least 1"},
+		{"signal_level_min", "-12.5", ""},
+		{"signal_level_max", "NaN", "signal_level_max must be a number"},
+		{"api_rate_limit", "-1", "api_rate_limit must be a number of at least 0"},
+		{"cleanup_offline_minutes", "1.5", "cleanup_offline_minutes must be a whole number of minutes of at least 1"},
+		{"snmp_scheduling_policy", "prioritize_upgrades", ""},
+		{"snmp_scheduling_policy", "greedy", "snmp_scheduling_policy must be one of fair, prioritize_upgrades, prioritize_discovery"},
+		{"log_level", "debug", ""},
+		{"log_level", "0", "log_level must be one of debug, info, warn, error"},
+		{"verify_firmware_exists", "false", ""},
+		{"engine_paused", "yes", "engine_paused must be true or false"},
+		{"webhook_url", "", ""},
+	} {
+		err := ValidateSetting(tt.key, tt.value)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("ValidateSetting(%q, %q): unexpected error %v", tt.key, tt.value, err)
+			}
+			continue
+		}
+		verr, ok := err.(*ValidationError)
+		if !ok || verr.Field != tt.key || verr.Message != tt.wantErr {
+			t.Errorf("ValidateSetting(%q, %q) = %v, want %q", tt.key, tt.value, err, tt.wantErr)
+		}
+	}
+}
+
+func TestValidateUpgradePollInterval(t *testing.T) {
+	for _, tt := range []struct {
+		value   string
+		wantErr bool
+	}{
+		{"5", false},
+		{"300", false},
+		{" 10 ", false},
+		{"4", true},
+		{"301", true},
+		{"10s", true},
+		{"", true},
+	} {
+		err := ValidateSetting("upgrade_poll_interval", tt.value)
+		if tt.wantErr && err != ErrInvalidPollInterval {
+			t.Errorf("ValidateSetting(upgrade_poll_interval, %q): expected ErrInvalidPollInterval, got %v", tt.value, err)
+		}
+		if !tt.wantErr && err != nil {
+			t.Errorf("ValidateSetting(upgrade_poll_interval, %q): unexpected error %v", tt.value, err)
+		}
+	}
+
+	rule := &UpgradeRule{
+		Name:             "Test Rule",
+		MatchType:        "MAC_RANGE",
+		MatchCriteria:    `{"start_mac":"00:01:5C:00:00:00","end_mac":"00:01:5C:FF:FF:FF"}`,
+		TFTPServerIP:     "192.168.1.50",
+		FirmwareFilename: "firmware.bin",
+	}
+	for seconds, wantErr := range map[int]bool{0: false, 5: false, 300: false, 3: true, 600: true} {
+		rule.UpgradePollInterval = seconds
+		if err := rule.Validate(); (err == ErrInvalidPollInterval) != wantErr {
+			t.Errorf("Validate() with upgrade_poll_interval %d = %v, wantErr %v", seconds, err, wantErr)
+		}
+	}
+}
+
+func TestCampaignValidate(t *testing.T) {
+	valid := func() *Campaign {
+		return &Campaign{
+			Name:             "Q3 rollout",
+			MatchType:        "MAC_RANGE",
+			MatchCriteria:    `{"start_mac":"00:01:5C:00:00:00","end_mac":"00:01:5C:FF:FF:FF"}`,
+			TFTPServerIP:     "192.168.1.50",
+			FirmwareFilename: "firmware-v2.0.0.bin",
+			StartAt:          time.Now(),
+			RatePerMinute:    10,
+		}
+	}
+
+	tests := []struct {
+		name    string
+		mutate  func(c *Campaign)
+		wantErr error
+	}{
+		{"valid", func(c *Campaign) {}, nil},
+		{"unpaced", func(c *Campaign) { c.RatePerMinute = 0 }, nil},
+		{"negative rate", func(c *Campaign) { c.RatePerMinute = -1 }, ErrInvalidCampaignRate},
+		{"no start", func(c *Campaign) { c.StartAt = time.Time{} }, ErrInvalidCampaignStart},
+		{"no name", func(c *Campaign) { c.Name = "" }, ErrInvalidName},
+		{"bad target", func(c *Campaign) { c.MatchType = "BOGUS" }, ErrInvalidMatchType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := valid()
+			tt.mutate(c)
+			if err := c.Validate(); err != tt.wantErr {
+				t.Errorf("Validate() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
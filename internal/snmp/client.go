@@ -2,6 +2,7 @@ package snmp
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"strconv"
@@ -22,20 +23,72 @@ const (
 	OIDDocsIfCmtsCmStatusIpAddress = "1.3.6.1.2.1.10.127.1.3.3.1.3"
 	// Cable modem downstream power level
 	OIDDocsIfCmtsCmStatusDownstreamPower = "1.3.6.1.2.1.10.127.1.3.3.1.6"
+	// ifIndex of the upstream channel a cable modem is using
+	// (docsIfCmtsCmStatusUpChannelIfIndex)
+	OIDDocsIfCmtsCmStatusUpChannelIfIndex = "1.3.6.1.2.1.10.127.1.3.3.1.5"
 	// Cable modem status
 	OIDDocsIfCmtsCmStatusValue = "1.3.6.1.2.1.10.127.1.3.3.1.9"
+	// Interface description (IF-MIB ifDescr), indexed by ifIndex
+	OIDIfDescr = "1.3.6.1.2.1.2.2.1.2"
+	// DOCSIS 3.1 OFDM downstream channel receive power (DOCS-IF31-MIB
+	// docsIf31CmDsOfdmChannelPowerRxPower), one row per OFDM channel
+	OIDDocsIf31CmDsOfdmChannelPowerRxPower = "1.3.6.1.4.1.4491.2.1.28.1.11.1.3"
 	// System description (for firmware matching)
 	OIDSysDescr = "1.3.6.1.2.1.1.1.0"
-	// TFTP server address for firmware upgrades
-	OIDDocsDevSwServer = "1.3.6.1.2.1.69.1.1.3.0"
-	// Firmware filename
-	OIDDocsDevSwFilename = "1.3.6.1.2.1.69.1.1.4.0"
-	// Admin status to trigger upgrade
-	OIDDocsDevSwAdminStatus = "1.3.6.1.2.1.69.1.1.5.0"
-	// Operational status of upgrade
-	OIDDocsDevSwOperStatus = "1.3.6.1.2.1.69.1.1.6.0"
+	// TFTP server address for firmware upgrades (docsDevSwServer)
+	OIDDocsDevSwServer = "1.3.6.1.2.1.69.1.3.1.0"
+	// Firmware filename (docsDevSwFilename)
+	OIDDocsDevSwFilename = "1.3.6.1.2.1.69.1.3.2.0"
+	// Admin status to trigger upgrade (docsDevSwAdminStatus)
+	OIDDocsDevSwAdminStatus = "1.3.6.1.2.1.69.1.3.3.0"
+	// Operational status of upgrade (docsDevSwOperStatus)
+	OIDDocsDevSwOperStatus = "1.3.6.1.2.1.69.1.3.4.0"
+	// Address type and address of the firmware server as an InetAddress
+	// (docsDevSwServerAddressType, docsDevSwServerAddress, RFC 4639)
+	OIDDocsDevSwServerAddressType = "1.3.6.1.2.1.69.1.3.6.0"
+	OIDDocsDevSwServerAddress     = "1.3.6.1.2.1.69.1.3.7.0"
+	// Protocol used to fetch the firmware, tftp(1) or http(2)
+	// (docsDevSwServerTransportProtocol)
+	OIDDocsDevSwServerTransportProtocol = "1.3.6.1.2.1.69.1.3.8.0"
+	// Software version currently running (docsDevSwCurrentVers)
+	OIDDocsDevSwCurrentVers = "1.3.6.1.2.1.69.1.3.5.0"
+	// Boot config file the modem registered with (docsDevServerConfigFile);
+	// a zero-length string when the modem doesn't know it
+	OIDDocsDevServerConfigFile = "1.3.6.1.2.1.69.1.4.5.0"
+	// Setting true(1) reboots the modem (docsDevResetNow, RFC 4639)
+	OIDDocsDevResetNow = "1.3.6.1.2.1.69.1.1.3.0"
+	// Registration status as reported by the modem itself
+	// (docsIfCmStatusValue), one row per CATV MAC interface
+	OIDDocsIfCmStatusValue = "1.3.6.1.2.1.10.127.1.2.2.1.1"
+	// Downstream receive power as measured by the modem itself
+	// (docsIfDownChannelPower), one row per downstream channel
+	OIDDocsIfDownChannelPower = "1.3.6.1.2.1.10.127.1.1.1.1.6"
 )
 
+// AdminStatusUpgradeFromMgt is the docsDevSwAdminStatus value that starts
+// an upgrade from the configured TFTP server
+const AdminStatusUpgradeFromMgt = 1
+
+// docsDevSwServerTransportProtocol values
+const (
+	transportProtocolTFTP = 1
+	transportProtocolHTTP = 2
+)
+
+// InetAddressType values (INET-ADDRESS-MIB)
+const (
+	inetAddressTypeIPv4 = 1
+	inetAddressTypeIPv6 = 2
+)
+
+// UpgradeProgress is a modem's view of an ongoing firmware upgrade
+type UpgradeProgress struct {
+	// Status is in_progress, completed, failed, rebooting or unknown
+	Status string
+	// CurrentVersion is the running software version, empty if not reported
+	CurrentVersion string
+}
+
 // Client handles SNMP operations
 type Client struct {
 	conn *gosnmp.GoSNMP
@@ -47,27 +100,16 @@ func NewClient(cmts *models.CMTS) (*Client, error) {
 		return nil, fmt.Errorf("CMTS cannot be nil")
 	}
 
-	// Determine SNMP version
-	var version gosnmp.SnmpVersion
-	switch cmts.SNMPVersion {
-	case 1:
-		version = gosnmp.Version1
-	case 2:
-		version = gosnmp.Version2c
-	case 3:
-		version = gosnmp.Version3
-	default:
-		version = gosnmp.Version2c
-	}
-
 	conn := &gosnmp.GoSNMP{
-		Target:    cmts.IPAddress,
+		Target:    snmpTarget(cmts.IPAddress),
 		Port:      uint16(cmts.SNMPPort),
 		Community: cmts.CommunityRead,
-		Version:   version,
+		Version:   snmpVersion(cmts.SNMPVersion),
 		Timeout:   time.Duration(10) * time.Second,
 		Retries:   3,
-		MaxOids:   60, // Max OIDs per GET request
+		MaxOids:   cmts.MaxOids(), // Max OIDs per GET request
+		// Rows per GETBULK response, so the cap applies to walks too
+		MaxRepetitions: uint32(cmts.MaxOids()),
 	}
 
 	// Set connection timeout with context
@@ -83,11 +125,11 @@ func NewClient(cmts *models.CMTS) (*Client, error) {
 	select {
 	case err := <-connectErr:
 		if err != nil {
-			return nil, fmt.Errorf("failed to connect to CMTS %s:%d (version: v%d, community: %s): %w",
-				cmts.IPAddress, cmts.SNMPPort, cmts.SNMPVersion, cmts.CommunityRead, err)
+			return nil, fmt.Errorf("failed to connect to CMTS %s (version: v%d, community: %s): %w",
+				hostPort(cmts.IPAddress, cmts.SNMPPort), cmts.SNMPVersion, cmts.CommunityRead, err)
 		}
 	case <-ctx.Done():
-		return nil, fmt.Errorf("connection timeout to CMTS %s:%d after 15 seconds", cmts.IPAddress, cmts.SNMPPort)
+		return nil, fmt.Errorf("connection timeout to CMTS %s after 15 seconds", hostPort(cmts.IPAddress, cmts.SNMPPort))
 	}
 
 	log.Debug().
@@ -98,6 +140,129 @@ func NewClient(cmts *models.CMTS) (*Client, error) {
 	return &Client{conn: conn}, nil
 }
 
+// snmpVersion maps a CMTS's configured SNMP version to gosnmp's, defaulting
+// to v2c
+func snmpVersion(version int) gosnmp.SnmpVersion {
+	switch version {
+	case 1:
+		return gosnmp.Version1
+	case 3:
+		return gosnmp.Version3
+	default:
+		return gosnmp.Version2c
+	}
+}
+
+// snmpTarget strips the brackets from an IPv6 literal such as
+// "[2001:db8::1]"; gosnmp adds its own when joining host and port
+func snmpTarget(addr string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+}
+
+// hostPort formats an SNMP agent address for messages, bracketing IPv6
+func hostPort(addr string, port int) string {
+	return net.JoinHostPort(snmpTarget(addr), strconv.Itoa(port))
+}
+
+// Probe failure kinds, so callers can tell operators what to fix
+const (
+	ProbeUnreachable = "unreachable"
+	ProbeTimeout     = "timeout"
+	ProbeAuth        = "auth"
+	ProbeSNMPError   = "snmp_error"
+)
+
+// ProbeError is a failed connectivity check against a CMTS
+type ProbeError struct {
+	Kind string
+	Err  error
+}
+
+func (e *ProbeError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ProbeError) Unwrap() error {
+	return e.Err
+}
+
+// ProbeCMTS opens a short-lived SNMP session to a CMTS and reads its
+// sysDescr, giving up after a single attempt of timeout. Failures are
+// returned as *ProbeError.
+func ProbeCMTS(cmts *models.CMTS, timeout time.Duration) (string, error) {
+	if cmts == nil {
+		return "", fmt.Errorf("CMTS cannot be nil")
+	}
+
+	conn := &gosnmp.GoSNMP{
+		Target:    snmpTarget(cmts.IPAddress),
+		Port:      uint16(cmts.SNMPPort),
+		Community: cmts.CommunityRead,
+		Version:   snmpVersion(cmts.SNMPVersion),
+		Timeout:   timeout,
+		Retries:   0,
+	}
+
+	if err := conn.Connect(); err != nil {
+		return "", &ProbeError{
+			Kind: ProbeUnreachable,
+			Err:  fmt.Errorf("cannot reach %s: %w", hostPort(cmts.IPAddress, cmts.SNMPPort), err),
+		}
+	}
+	defer conn.Conn.Close()
+
+	result, err := conn.Get([]string{OIDSysDescr})
+	if err != nil {
+		var netErr net.Error
+		if strings.Contains(err.Error(), "timeout") || (errors.As(err, &netErr) && netErr.Timeout()) {
+			// Agents silently drop requests with the wrong community, so a
+			// bad community looks the same as a host that isn't listening
+			return "", &ProbeError{
+				Kind: ProbeTimeout,
+				Err: fmt.Errorf("no response from %s within %s; check the address, port and read community",
+					hostPort(cmts.IPAddress, cmts.SNMPPort), timeout),
+			}
+		}
+		return "", &ProbeError{
+			Kind: ProbeUnreachable,
+			Err:  fmt.Errorf("cannot reach %s: %w", hostPort(cmts.IPAddress, cmts.SNMPPort), err),
+		}
+	}
+
+	switch result.Error {
+	case gosnmp.NoError:
+	case gosnmp.AuthorizationError, gosnmp.NoAccess:
+		return "", &ProbeError{
+			Kind: ProbeAuth,
+			Err:  fmt.Errorf("CMTS %s rejected the read community: %s", cmts.IPAddress, result.Error),
+		}
+	default:
+		return "", &ProbeError{
+			Kind: ProbeSNMPError,
+			Err:  fmt.Errorf("CMTS %s returned SNMP error: %s", cmts.IPAddress, result.Error),
+		}
+	}
+
+	if len(result.Variables) == 0 || !pduAvailable(result.Variables[0]) {
+		return "", &ProbeError{
+			Kind: ProbeSNMPError,
+			Err:  fmt.Errorf("CMTS %s did not return sysDescr", cmts.IPAddress),
+		}
+	}
+
+	switch v := result.Variables[0].Value.(type) {
+	case []byte:
+		return string(v), nil
+	case string:
+		return v, nil
+	default:
+		return "", &ProbeError{
+			Kind: ProbeSNMPError,
+			Err:  fmt.Errorf("unexpected sysDescr type: %T", v),
+		}
+	}
+}
+
 // Close closes the SNMP connection
 func (c *Client) Close() error {
 	if c.conn != nil {
@@ -110,10 +275,51 @@ func (c *Client) Close() error {
 type modemInfo struct {
 	ifIndex string
 	mac     string
+	ifDescr string
+}
+
+// ErrTooManyModems is returned by DiscoverModems when a CMTS reports more
+// MAC entries than the caller's limit
+var ErrTooManyModems = errors.New("too many modems reported")
+
+// modemTable collects modem info from a MAC table walk, failing once the
+// walk returns more than max entries so a runaway table is never held in
+// memory or polled. A max of 0 means no limit.
+type modemTable struct {
+	max     int
+	entries int
+	infos   []modemInfo
 }
 
-// DiscoverModems discovers all cable modems on the CMTS with concurrent polling
-func (c *Client) DiscoverModems(cmts *models.CMTS) ([]*models.CableModem, error) {
+// add records one MAC table entry
+func (t *modemTable) add(pdu gosnmp.SnmpPDU) error {
+	t.entries++
+	if t.max > 0 && t.entries > t.max {
+		return fmt.Errorf("%w: more than %d MAC entries", ErrTooManyModems, t.max)
+	}
+
+	ifIndex := extractIndexFromOID(pdu.Name, OIDDocsIfCmtsCmStatusMacAddress)
+	if ifIndex == "" {
+		return nil
+	}
+
+	mac := parseMACAddress(pdu)
+	if mac == "" {
+		logUnparseableMAC(pdu)
+		return nil
+	}
+
+	t.infos = append(t.infos, modemInfo{
+		ifIndex: ifIndex,
+		mac:     mac,
+	})
+	return nil
+}
+
+// DiscoverModems discovers all cable modems on the CMTS with concurrent
+// polling. If the MAC table holds more than maxModems entries (0 for no
+// limit) discovery stops with ErrTooManyModems before any modem is polled.
+func (c *Client) DiscoverModems(cmts *models.CMTS, maxModems int) ([]*models.CableModem, error) {
 	log.Info().
 		Str("cmts", cmts.Name).
 		Str("ip", cmts.IPAddress).
@@ -121,35 +327,27 @@ func (c *Client) DiscoverModems(cmts *models.CMTS) ([]*models.CableModem, error)
 
 	// Walk the MAC address table with timeout
 	startTime := time.Now()
-	macResults, err := c.conn.BulkWalkAll(OIDDocsIfCmtsCmStatusMacAddress)
-	if err != nil {
+	table := &modemTable{max: maxModems}
+	if err := c.conn.BulkWalk(OIDDocsIfCmtsCmStatusMacAddress, table.add); err != nil {
+		if errors.Is(err, ErrTooManyModems) {
+			return nil, fmt.Errorf("CMTS %s (%s): %w", cmts.Name, cmts.IPAddress, err)
+		}
 		return nil, fmt.Errorf("failed to walk MAC table on %s (%s): %w", cmts.Name, cmts.IPAddress, err)
 	}
 
 	log.Debug().
 		Str("cmts", cmts.Name).
 		Dur("duration", time.Since(startTime)).
-		Int("results", len(macResults)).
+		Int("results", table.entries).
 		Msg("MAC table walk completed")
 
-	// Extract basic modem info from walk results
-	modemInfos := make([]modemInfo, 0, len(macResults))
-	for _, result := range macResults {
-		ifIndex := extractIndexFromOID(result.Name, OIDDocsIfCmtsCmStatusMacAddress)
-		if ifIndex == "" {
-			continue
-		}
-
-		mac := parseMACAddress(result)
-		if mac == "" {
-			log.Warn().Str("oid", result.Name).Msg("Failed to parse MAC address")
-			continue
-		}
+	modemInfos := table.infos
 
-		modemInfos = append(modemInfos, modemInfo{
-			ifIndex: ifIndex,
-			mac:     mac,
-		})
+	// Label each modem with its upstream interface so failures can be
+	// correlated with line cards. Best effort: not every CMTS exposes it.
+	upstreams := c.upstreamInterfaces(cmts)
+	for i := range modemInfos {
+		modemInfos[i].ifDescr = upstreams[modemInfos[i].ifIndex]
 	}
 
 	log.Info().
@@ -190,6 +388,7 @@ func (c *Client) pollModemsDetails(cmts *models.CMTS, modemInfos []modemInfo) []
 	defer ticker.Stop()
 
 	var wg sync.WaitGroup
+	identities := newModemIdentityCache()
 
 	// Start workers
 	for i := 0; i < workers; i++ {
@@ -201,7 +400,7 @@ func (c *Client) pollModemsDetails(cmts *models.CMTS, modemInfos []modemInfo) []
 				<-ticker.C
 
 				// Poll modem details
-				modem := c.pollSingleModem(cmts, info)
+				modem := c.pollSingleModem(cmts, info, identities)
 				if modem != nil {
 					results <- modem
 				}
@@ -231,71 +430,110 @@ func (c *Client) pollModemsDetails(cmts *models.CMTS, modemInfos []modemInfo) []
 }
 
 // pollSingleModem polls details for a single modem
-func (c *Client) pollSingleModem(cmts *models.CMTS, info modemInfo) *models.CableModem {
-	// Get IP address
-	ipAddress := c.getModemIP(info.ifIndex)
-
-	// Get signal level
-	signalLevel := c.getSignalLevel(info.ifIndex)
-
-	// Get status
-	status := c.getModemStatus(info.ifIndex)
+func (c *Client) pollSingleModem(cmts *models.CMTS, info modemInfo, identities *modemIdentityCache) *models.CableModem {
+	ipAddress, signalLevel, signalOK, status, err := c.getModemDetails(info.ifIndex)
+	if err != nil {
+		log.Debug().
+			Err(err).
+			Str("mac", info.mac).
+			Msg("Failed to get modem details")
+		status = "unknown"
+	}
 
-	// Get sysDescr (for modem-specific queries, we'd need the CM community string)
-	sysDescr := c.getModemSysDescr(cmts, info.mac)
+	// The CMTS doesn't know the modem's sysDescr, config file or OFDM
+	// power, so ask the modem
+	identity := getModemIdentity(cmts, ipAddress, identities)
 
 	return &models.CableModem{
-		CMTSID:          cmts.ID,
-		MACAddress:      info.mac,
-		IPAddress:       ipAddress,
-		SysDescr:        sysDescr,
-		CurrentFirmware: extractFirmwareFromSysDescr(sysDescr),
-		SignalLevel:     signalLevel,
-		Status:          status,
-		LastSeen:        time.Now(),
+		CMTSID:            cmts.ID,
+		MACAddress:        info.mac,
+		IfIndex:           info.ifIndex,
+		IfDescr:           info.ifDescr,
+		IPAddress:         ipAddress,
+		SysDescr:          identity.sysDescr,
+		CurrentFirmware:   extractFirmwareFromSysDescr(identity.sysDescr),
+		ConfigFile:        identity.configFile,
+		SignalLevel:       signalLevel,
+		SignalUnavailable: !signalOK,
+		OFDMPower:         identity.ofdmPower,
+		Status:            status,
+		LastSeen:          time.Now(),
 	}
 }
 
-// getModemIP retrieves the IP address for a modem by interface index
-func (c *Client) getModemIP(ifIndex string) string {
-	oid := fmt.Sprintf("%s.%s", OIDDocsIfCmtsCmStatusIpAddress, ifIndex)
-	result, err := c.conn.Get([]string{oid})
+// upstreamInterfaces maps each modem's CMTS status index to the ifDescr of
+// the upstream channel it is on. It returns an empty map if either table
+// can't be walked.
+func (c *Client) upstreamInterfaces(cmts *models.CMTS) map[string]string {
+	channels, err := c.conn.BulkWalkAll(OIDDocsIfCmtsCmStatusUpChannelIfIndex)
 	if err != nil {
-		return ""
+		log.Debug().Err(err).Str("cmts", cmts.Name).Msg("Failed to walk upstream channel table")
+		return map[string]string{}
 	}
+	descrs, err := c.conn.BulkWalkAll(OIDIfDescr)
+	if err != nil {
+		log.Debug().Err(err).Str("cmts", cmts.Name).Msg("Failed to walk ifDescr table")
+		return map[string]string{}
+	}
+	return mapUpstreamInterfaces(channels, descrs)
+}
 
-	if len(result.Variables) == 0 {
-		return ""
+// mapUpstreamInterfaces joins a docsIfCmtsCmStatusUpChannelIfIndex walk with
+// an ifDescr walk. Modems whose channel has no description are left out.
+func mapUpstreamInterfaces(channels, descrs []gosnmp.SnmpPDU) map[string]string {
+	names := make(map[string]string, len(descrs))
+	for _, pdu := range descrs {
+		index := extractIndexFromOID(pdu.Name, OIDIfDescr)
+		if name := parseDisplayString(pdu); index != "" && name != "" {
+			names[index] = name
+		}
 	}
 
-	return parseIPAddress(result.Variables[0])
+	upstreams := make(map[string]string, len(channels))
+	for _, pdu := range channels {
+		index := extractIndexFromOID(pdu.Name, OIDDocsIfCmtsCmStatusUpChannelIfIndex)
+		if index == "" || !pduAvailable(pdu) {
+			continue
+		}
+		if name, ok := names[gosnmp.ToBigInt(pdu.Value).String()]; ok {
+			upstreams[index] = name
+		}
+	}
+	return upstreams
 }
 
-// getSignalLevel retrieves the downstream power level for a modem
-func (c *Client) getSignalLevel(ifIndex string) float64 {
-	oid := fmt.Sprintf("%s.%s", OIDDocsIfCmtsCmStatusDownstreamPower, ifIndex)
-	result, err := c.conn.Get([]string{oid})
+// getModemDetails retrieves a modem's IP address, downstream power and
+// status by interface index in a single request. signalOK is false when the
+// CMTS did not report a power level.
+func (c *Client) getModemDetails(ifIndex string) (ip string, signal float64, signalOK bool, status string, err error) {
+	result, err := c.conn.Get([]string{
+		fmt.Sprintf("%s.%s", OIDDocsIfCmtsCmStatusIpAddress, ifIndex),
+		fmt.Sprintf("%s.%s", OIDDocsIfCmtsCmStatusDownstreamPower, ifIndex),
+		fmt.Sprintf("%s.%s", OIDDocsIfCmtsCmStatusValue, ifIndex),
+	})
 	if err != nil {
-		return 0.0
+		return "", 0.0, false, "", fmt.Errorf("failed to get modem details: %w", err)
 	}
 
-	if len(result.Variables) == 0 {
-		return 0.0
-	}
+	ip, signal, signalOK, status = parseModemDetails(result.Variables)
+	return ip, signal, signalOK, status, nil
+}
 
-	// Power is typically in tenths of dBmV
-	switch v := result.Variables[0].Value.(type) {
-	case int:
-		return float64(v) / 10.0
-	case int64:
-		return float64(v) / 10.0
-	case uint:
-		return float64(v) / 10.0
-	case uint64:
-		return float64(v) / 10.0
+// parseModemDetails reads the variables of a getModemDetails response,
+// which come back in the order they were requested: IP address, downstream
+// power, status. Missing trailing variables are treated as unreported.
+func parseModemDetails(vars []gosnmp.SnmpPDU) (ip string, signal float64, signalOK bool, status string) {
+	status = "unknown"
+	if len(vars) > 0 {
+		ip = parseIPAddress(vars[0])
 	}
-
-	return 0.0
+	if len(vars) > 1 {
+		signal, signalOK = parseSignalLevel(vars[1])
+	}
+	if len(vars) > 2 {
+		status = parseModemStatus(vars[2])
+	}
+	return ip, signal, signalOK, status
 }
 
 // getModemStatus retrieves the operational status of a modem
@@ -310,12 +548,22 @@ func (c *Client) getModemStatus(ifIndex string) string {
 		return "unknown"
 	}
 
+	return parseModemStatus(result.Variables[0])
+}
+
+// parseModemStatus maps a docsIfCmtsCmStatusValue to a modem status. It
+// returns an empty status when the CMTS has no entry for the modem.
+func parseModemStatus(result gosnmp.SnmpPDU) string {
+	if !pduAvailable(result) {
+		return ""
+	}
+
 	// DOCSIS status values: 1=other, 2=notReady, 3=notSynchronized,
 	// 4=phySynchronized, 5=usParametersAcquired, 6=rangingComplete,
 	// 7=ipComplete, 8=todEstablished, 9=securityEstablished,
 	// 10=paramTransferComplete, 11=registrationComplete, 12=operational,
 	// 13=accessDenied
-	switch result.Variables[0].Value {
+	switch result.Value {
 	case 12:
 		return "online"
 	case 13:
@@ -327,21 +575,142 @@ func (c *Client) getModemStatus(ifIndex string) string {
 	}
 }
 
-// getModemSysDescr retrieves sysDescr from the cable modem itself
-func (c *Client) getModemSysDescr(cmts *models.CMTS, mac string) string {
-	// This requires connecting directly to the cable modem
-	// Skip if we don't have a CM community string
+// modemIdentityTimeout bounds the read from each modem during discovery, so
+// modems that don't answer can't stall the run
+const modemIdentityTimeout = 2 * time.Second
+
+// modemIdentity is what discovery reads from a modem itself rather than the
+// CMTS
+type modemIdentity struct {
+	sysDescr   string
+	configFile string
+	// ofdmPower is the mean DOCSIS 3.1 OFDM downstream receive power, 0
+	// when the modem has no OFDM channels or doesn't support DOCS-IF31-MIB.
+	// It is a CM-side table, so only the modem can report it.
+	ofdmPower float64
+}
+
+// modemIdentityCache holds what was read from each modem IP during one
+// discovery run, failures included, so no modem is asked twice
+type modemIdentityCache struct {
+	mu      sync.Mutex
+	entries map[string]modemIdentity
+}
+
+func newModemIdentityCache() *modemIdentityCache {
+	return &modemIdentityCache{entries: make(map[string]modemIdentity)}
+}
+
+func (c *modemIdentityCache) get(ip string) (modemIdentity, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	identity, ok := c.entries[ip]
+	return identity, ok
+}
+
+func (c *modemIdentityCache) put(ip string, identity modemIdentity) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[ip] = identity
+}
+
+// getModemIdentity reads sysDescr, the boot config file and OFDM power
+// directly from a cable modem using the CMTS's CM community string. It
+// returns an empty identity without asking when there is no community or the
+// modem has no usable IP, and when the modem doesn't answer within
+// modemIdentityTimeout.
+func getModemIdentity(cmts *models.CMTS, modemIP string, cache *modemIdentityCache) modemIdentity {
 	if cmts.CMCommunityString == "" {
-		return ""
+		return modemIdentity{}
+	}
+	if ip := net.ParseIP(modemIP); ip == nil || ip.IsUnspecified() {
+		return modemIdentity{}
+	}
+	if identity, ok := cache.get(modemIP); ok {
+		return identity
 	}
 
-	// Try to connect to the modem (this is simplified)
-	// In production, you'd want to cache these connections
-	return ""
+	identity, err := readModemIdentity(modemIP, cmts.CMCommunityString, modemIdentityTimeout)
+	if err != nil {
+		log.Debug().
+			Err(err).
+			Str("modem_ip", modemIP).
+			Msg("Failed to read modem identity")
+	}
+	cache.put(modemIP, identity)
+	return identity
+}
+
+// readModemIdentity opens a short-lived session to a modem and reads its
+// sysDescr and config file in a single attempt, then walks its OFDM channel
+// power table if it answered
+func readModemIdentity(modemIP, community string, timeout time.Duration) (modemIdentity, error) {
+	conn := &gosnmp.GoSNMP{
+		Target:    snmpTarget(modemIP),
+		Port:      161,
+		Community: community,
+		Version:   gosnmp.Version2c,
+		Timeout:   timeout,
+		Retries:   0,
+	}
+	if err := conn.Connect(); err != nil {
+		return modemIdentity{}, fmt.Errorf("failed to connect to modem %s: %w", modemIP, err)
+	}
+	defer conn.Conn.Close()
+
+	result, err := conn.Get([]string{OIDSysDescr, OIDDocsDevServerConfigFile})
+	if err != nil {
+		return modemIdentity{}, fmt.Errorf("failed to get sysDescr: %w", err)
+	}
+	identity, err := parseModemIdentity(result.Variables)
+	if err != nil {
+		return identity, err
+	}
+
+	// DOCSIS 3.1 modems on OFDM-only downstreams report no legacy power
+	if results, err := conn.BulkWalkAll(OIDDocsIf31CmDsOfdmChannelPowerRxPower); err == nil {
+		identity.ofdmPower, _ = averageSignalLevel(results)
+	}
+	return identity, nil
 }
 
-// TriggerFirmwareUpgrade triggers a firmware upgrade on a cable modem
-func (c *Client) TriggerFirmwareUpgrade(modemIP, tftpServer, filename string) error {
+// parseModemIdentity reads the variables of a sysDescr and config file GET,
+// in that order. sysDescr is required; modems that predate or hide
+// docsDevServerConfigFile just report no config file.
+func parseModemIdentity(vars []gosnmp.SnmpPDU) (modemIdentity, error) {
+	if len(vars) == 0 || !pduAvailable(vars[0]) {
+		return modemIdentity{}, fmt.Errorf("no sysDescr returned")
+	}
+
+	var identity modemIdentity
+	switch v := vars[0].Value.(type) {
+	case []byte:
+		identity.sysDescr = string(v)
+	case string:
+		identity.sysDescr = v
+	default:
+		return modemIdentity{}, fmt.Errorf("unexpected sysDescr type: %T", v)
+	}
+	if len(vars) > 1 {
+		identity.configFile = parseDisplayString(vars[1])
+	}
+	return identity, nil
+}
+
+// TriggerFirmwareUpgrade triggers a firmware upgrade on a cable modem by
+// setting adminValue on oid. Modems that don't follow DOCS-CABLE-DEVICE-MIB
+// may need a different value or a vendor OID; 0 and "" select
+// docsDevSwAdminStatus = upgradeFromMgt(1). transport is "", "tftp" or
+// "http"; "" leaves docsDevSwServerTransportProtocol untouched for modems
+// that predate it.
+func (c *Client) TriggerFirmwareUpgrade(modemIP, tftpServer, filename string, adminValue int, oid, transport string) error {
+	if adminValue <= 0 {
+		adminValue = AdminStatusUpgradeFromMgt
+	}
+	if oid == "" {
+		oid = OIDDocsDevSwAdminStatus
+	}
+
 	log.Info().
 		Str("modem_ip", modemIP).
 		Str("tftp_server", tftpServer).
@@ -357,11 +726,42 @@ func (c *Client) TriggerFirmwareUpgrade(modemIP, tftpServer, filename string) er
 		return fmt.Errorf("modem at %s not responding to SNMP queries", modemIP)
 	}
 
-	// Set TFTP server address
-	if err := c.setOID(OIDDocsDevSwServer, tftpServer, gosnmp.IPAddress); err != nil {
-		return fmt.Errorf("failed to set TFTP server %s on modem %s: %w", tftpServer, modemIP, err)
+	// Set the firmware server. HTTP needs the InetAddress objects; the
+	// legacy IpAddress object only exists for TFTP.
+	switch transport {
+	case "":
+		if err := c.setOID(OIDDocsDevSwServer, tftpServer, gosnmp.IPAddress); err != nil {
+			return fmt.Errorf("failed to set TFTP server %s on modem %s: %w", tftpServer, modemIP, err)
+		}
+	case models.TransportTFTP:
+		if err := c.setOID(OIDDocsDevSwServerTransportProtocol, transportProtocolTFTP, gosnmp.Integer); err != nil {
+			return fmt.Errorf("failed to select TFTP transport on modem %s: %w", modemIP, err)
+		}
+		if err := c.setOID(OIDDocsDevSwServer, tftpServer, gosnmp.IPAddress); err != nil {
+			return fmt.Errorf("failed to set TFTP server %s on modem %s: %w", tftpServer, modemIP, err)
+		}
+	case models.TransportHTTP:
+		addrType, addr, err := inetAddress(tftpServer)
+		if err != nil {
+			return fmt.Errorf("invalid HTTP server for modem %s: %w", modemIP, err)
+		}
+		if err := c.setOID(OIDDocsDevSwServerTransportProtocol, transportProtocolHTTP, gosnmp.Integer); err != nil {
+			return fmt.Errorf("failed to select HTTP transport on modem %s: %w", modemIP, err)
+		}
+		if err := c.setOID(OIDDocsDevSwServerAddressType, addrType, gosnmp.Integer); err != nil {
+			return fmt.Errorf("failed to set server address type on modem %s: %w", modemIP, err)
+		}
+		if err := c.setOID(OIDDocsDevSwServerAddress, addr, gosnmp.OctetString); err != nil {
+			return fmt.Errorf("failed to set HTTP server %s on modem %s: %w", tftpServer, modemIP, err)
+		}
+	default:
+		return fmt.Errorf("unsupported transport protocol %q", transport)
 	}
-	log.Debug().Str("modem_ip", modemIP).Str("tftp_server", tftpServer).Msg("TFTP server set")
+	log.Debug().
+		Str("modem_ip", modemIP).
+		Str("server", tftpServer).
+		Str("transport", transport).
+		Msg("Firmware server set")
 
 	// Set firmware filename
 	if err := c.setOID(OIDDocsDevSwFilename, filename, gosnmp.OctetString); err != nil {
@@ -369,9 +769,9 @@ func (c *Client) TriggerFirmwareUpgrade(modemIP, tftpServer, filename string) er
 	}
 	log.Debug().Str("modem_ip", modemIP).Str("filename", filename).Msg("Firmware filename set")
 
-	// Trigger upgrade (set admin status to upgradeFromMgt(1))
-	if err := c.setOID(OIDDocsDevSwAdminStatus, 1, gosnmp.Integer); err != nil {
-		return fmt.Errorf("failed to trigger upgrade on modem %s: %w", modemIP, err)
+	// Trigger upgrade
+	if err := c.setOID(oid, adminValue, gosnmp.Integer); err != nil {
+		return fmt.Errorf("failed to trigger upgrade on modem %s (%s = %d): %w", modemIP, oid, adminValue, err)
 	}
 
 	log.Info().
@@ -383,28 +783,109 @@ func (c *Client) TriggerFirmwareUpgrade(modemIP, tftpServer, filename string) er
 	return nil
 }
 
+// inetAddress encodes server as an InetAddressType and InetAddress pair
+func inetAddress(server string) (int, []byte, error) {
+	ip := net.ParseIP(server)
+	if ip == nil {
+		return 0, nil, fmt.Errorf("%q is not an IP address", server)
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return inetAddressTypeIPv4, []byte(v4), nil
+	}
+	return inetAddressTypeIPv6, []byte(ip.To16()), nil
+}
+
+// RebootModem resets the modem by setting docsDevResetNow to true(1). The
+// modem may drop off the network before it answers, so an error here doesn't
+// necessarily mean the reboot failed.
+func (c *Client) RebootModem() error {
+	if err := c.setOID(OIDDocsDevResetNow, 1, gosnmp.Integer); err != nil {
+		return fmt.Errorf("failed to reboot modem %s: %w", c.conn.Target, err)
+	}
+
+	log.Info().
+		Str("modem_ip", c.conn.Target).
+		Msg("Modem reboot triggered")
+
+	return nil
+}
+
 // CheckUpgradeStatus checks the status of an ongoing firmware upgrade
 func (c *Client) CheckUpgradeStatus() (string, error) {
-	result, err := c.conn.Get([]string{OIDDocsDevSwOperStatus})
+	progress, err := c.CheckUpgradeProgress()
 	if err != nil {
-		return "", fmt.Errorf("failed to get upgrade status: %w", err)
+		return "", err
 	}
+	return progress.Status, nil
+}
 
-	if len(result.Variables) == 0 {
-		return "unknown", nil
+// CheckUpgradeProgress reads the upgrade status and the running software
+// version in a single request. Modems that don't expose the version still
+// report their status.
+func (c *Client) CheckUpgradeProgress() (UpgradeProgress, error) {
+	result, err := c.conn.Get([]string{OIDDocsDevSwOperStatus, OIDDocsDevSwCurrentVers})
+	if err != nil {
+		return UpgradeProgress{}, fmt.Errorf("failed to get upgrade status: %w", err)
+	}
+
+	progress := UpgradeProgress{Status: "unknown"}
+	for _, pdu := range result.Variables {
+		switch strings.TrimPrefix(pdu.Name, ".") {
+		case OIDDocsDevSwOperStatus:
+			progress.Status = parseUpgradeStatus(pdu)
+		case OIDDocsDevSwCurrentVers:
+			progress.CurrentVersion = parseSoftwareVersion(pdu)
+		}
+	}
+
+	return progress, nil
+}
+
+// parseUpgradeStatus converts docsDevSwOperStatus to a status string. A
+// modem that answers noSuchObject or noSuchInstance is mid-reboot with its
+// MIB not yet loaded, which is reported as "rebooting" rather than "unknown".
+func parseUpgradeStatus(result gosnmp.SnmpPDU) string {
+	switch result.Type {
+	case gosnmp.NoSuchObject, gosnmp.NoSuchInstance:
+		return "rebooting"
+	case gosnmp.EndOfMibView:
+		return "unknown"
 	}
 
 	// Operational status: 1=inProgress, 2=completeFromProvisioning,
 	// 3=completeFromMgt, 4=failed, 5=other
-	switch result.Variables[0].Value {
+	switch result.Value {
 	case 1:
-		return "in_progress", nil
+		return "in_progress"
 	case 2, 3:
-		return "completed", nil
+		return "completed"
 	case 4:
-		return "failed", nil
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+// parseSoftwareVersion extracts docsDevSwCurrentVers, returning "" when the
+// modem doesn't report it
+func parseSoftwareVersion(result gosnmp.SnmpPDU) string {
+	return parseDisplayString(result)
+}
+
+// parseDisplayString extracts a trimmed DisplayString value, returning ""
+// when none was reported
+func parseDisplayString(result gosnmp.SnmpPDU) string {
+	if !pduAvailable(result) {
+		return ""
+	}
+
+	switch v := result.Value.(type) {
+	case []byte:
+		return strings.TrimSpace(string(v))
+	case string:
+		return strings.TrimSpace(v)
 	default:
-		return "unknown", nil
+		return ""
 	}
 }
 
@@ -439,15 +920,65 @@ func extractIndexFromOID(oidStr, baseOID string) string {
 	return strings.TrimPrefix(oidStr, prefix)
 }
 
+// pduAvailable reports whether a variable holds a value rather than a
+// noSuchInstance, noSuchObject or endOfMibView exception
+func pduAvailable(result gosnmp.SnmpPDU) bool {
+	switch result.Type {
+	case gosnmp.NoSuchInstance, gosnmp.NoSuchObject, gosnmp.EndOfMibView:
+		return false
+	}
+	return true
+}
+
+// parseSignalLevel converts a downstream power reading in tenths of dBmV.
+// The second return value is false when no numeric level was reported.
+func parseSignalLevel(result gosnmp.SnmpPDU) (float64, bool) {
+	if !pduAvailable(result) {
+		return 0.0, false
+	}
+
+	switch v := result.Value.(type) {
+	case int:
+		return float64(v) / 10.0, true
+	case int64:
+		return float64(v) / 10.0, true
+	case uint:
+		return float64(v) / 10.0, true
+	case uint64:
+		return float64(v) / 10.0, true
+	}
+
+	return 0.0, false
+}
+
+// averageSignalLevel returns the mean of the available power readings in
+// results, or false if none were available
+func averageSignalLevel(results []gosnmp.SnmpPDU) (float64, bool) {
+	var total float64
+	var count int
+	for _, result := range results {
+		if level, ok := parseSignalLevel(result); ok {
+			total += level
+			count++
+		}
+	}
+
+	if count == 0 {
+		return 0.0, false
+	}
+	return total / float64(count), true
+}
+
 // parseMACAddress converts SNMP result to MAC address string
 func parseMACAddress(result gosnmp.SnmpPDU) string {
 	switch v := result.Value.(type) {
 	case []byte:
-		if len(v) != 6 {
-			return ""
+		if len(v) == 6 {
+			return fmt.Sprintf("%02X:%02X:%02X:%02X:%02X:%02X",
+				v[0], v[1], v[2], v[3], v[4], v[5])
 		}
-		return fmt.Sprintf("%02X:%02X:%02X:%02X:%02X:%02X",
-			v[0], v[1], v[2], v[3], v[4], v[5])
+		// Some CMTS return the MAC as printable hex text ("00 01 5C ...")
+		return formatMACAddress(string(v))
 	case string:
 		// Already a string, might need formatting
 		return formatMACAddress(v)
@@ -455,17 +986,49 @@ func parseMACAddress(result gosnmp.SnmpPDU) string {
 	return ""
 }
 
+// logUnparseableMAC warns about a MAC table entry that couldn't be parsed,
+// including the ASN.1 type and raw value so vendor encodings can be reported
+func logUnparseableMAC(result gosnmp.SnmpPDU) {
+	log.Warn().
+		Str("oid", result.Name).
+		Str("type", result.Type.String()).
+		Str("value", pduValueHex(result)).
+		Msg("Failed to parse MAC address")
+}
+
+// pduValueHex renders a PDU value as a hex dump for diagnostics
+func pduValueHex(result gosnmp.SnmpPDU) string {
+	switch v := result.Value.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return fmt.Sprintf("% X", v)
+	case string:
+		return fmt.Sprintf("% X", []byte(v))
+	default:
+		return fmt.Sprintf("%T(%v)", v, v)
+	}
+}
+
 // formatMACAddress ensures MAC is in standard format
 func formatMACAddress(mac string) string {
 	// Remove common separators
+	mac = strings.TrimSpace(mac)
 	mac = strings.ReplaceAll(mac, ":", "")
 	mac = strings.ReplaceAll(mac, "-", "")
 	mac = strings.ReplaceAll(mac, ".", "")
+	mac = strings.ReplaceAll(mac, " ", "")
 
 	// Should be 12 hex characters
 	if len(mac) != 12 {
 		return ""
 	}
+	for _, c := range mac {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return ""
+		}
+	}
+	mac = strings.ToUpper(mac)
 
 	// Format as XX:XX:XX:XX:XX:XX
 	return fmt.Sprintf("%s:%s:%s:%s:%s:%s",
@@ -474,9 +1037,14 @@ func formatMACAddress(mac string) string {
 
 // parseIPAddress converts SNMP result to IP address string
 func parseIPAddress(result gosnmp.SnmpPDU) string {
+	if !pduAvailable(result) {
+		return ""
+	}
+
 	switch v := result.Value.(type) {
 	case []byte:
-		if len(v) == 4 {
+		// InetAddress values are 4 bytes for IPv4 and 16 for IPv6
+		if len(v) == net.IPv4len || len(v) == net.IPv6len {
 			return net.IP(v).String()
 		}
 		return ""
@@ -520,7 +1088,7 @@ func extractFirmwareFromSysDescr(sysDescr string) string {
 // ConnectToModem creates an SNMP client connected to a specific cable modem
 func ConnectToModem(modemIP, community string, port int) (*Client, error) {
 	conn := &gosnmp.GoSNMP{
-		Target:    modemIP,
+		Target:    snmpTarget(modemIP),
 		Port:      uint16(port),
 		Community: community,
 		Version:   gosnmp.Version2c,
@@ -558,6 +1126,65 @@ func (c *Client) GetModemSysDescr() (string, error) {
 	}
 }
 
+// GetModemFirmware retrieves sysDescr from a cable modem and extracts the
+// firmware version it reports
+func (c *Client) GetModemFirmware() (string, string, error) {
+	sysDescr, err := c.GetModemSysDescr()
+	if err != nil {
+		return "", "", err
+	}
+	return sysDescr, extractFirmwareFromSysDescr(sysDescr), nil
+}
+
+// ModemState is what a cable modem reports about itself
+type ModemState struct {
+	SysDescr string
+	Firmware string
+	// ConfigFile is empty when the modem doesn't report docsDevServerConfigFile
+	ConfigFile string
+	// Status is empty when the modem doesn't report docsIfCmStatusValue
+	Status string
+	// Signal is the mean downstream power; SignalOK is false when the
+	// modem reported none
+	Signal   float64
+	SignalOK bool
+}
+
+// GetModemState reads sysDescr, config file, registration status and
+// downstream power directly from a cable modem. Only sysDescr is required;
+// the rest are optional.
+func (c *Client) GetModemState() (ModemState, error) {
+	var state ModemState
+	var err error
+	state.SysDescr, state.Firmware, err = c.GetModemFirmware()
+	if err != nil {
+		return ModemState{}, err
+	}
+
+	if result, err := c.conn.Get([]string{OIDDocsDevServerConfigFile}); err == nil && len(result.Variables) > 0 {
+		state.ConfigFile = parseDisplayString(result.Variables[0])
+	}
+	if results, err := c.conn.BulkWalkAll(OIDDocsIfCmStatusValue); err == nil {
+		state.Status = firstModemStatus(results)
+	}
+	if results, err := c.conn.BulkWalkAll(OIDDocsIfDownChannelPower); err == nil {
+		state.Signal, state.SignalOK = averageSignalLevel(results)
+	}
+
+	return state, nil
+}
+
+// firstModemStatus returns the status of the first CATV MAC interface that
+// reported one, or empty if none did
+func firstModemStatus(results []gosnmp.SnmpPDU) string {
+	for _, result := range results {
+		if status := parseModemStatus(result); status != "" {
+			return status
+		}
+	}
+	return ""
+}
+
 // ParseSignalLevel converts signal level string to float
 func ParseSignalLevel(s string) float64 {
 	val, err := strconv.ParseFloat(s, 64)
@@ -1,10 +1,18 @@
 package snmp
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
 	"testing"
+	"time"
 
 	"github.com/gosnmp/gosnmp"
 	"github.com/awksedgreep/firmware-upgrader/internal/models"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
 )
 
 // Test Client Creation
@@ -43,6 +51,28 @@ func TestNewClientStructure(t *testing.T) {
 	}
 }
 
+func TestNewClientMaxOids(t *testing.T) {
+	cmts := &models.CMTS{
+		Name:          "Old CMTS",
+		IPAddress:     "192.0.2.1",
+		SNMPPort:      161,
+		CommunityRead: "public",
+		SNMPVersion:   2,
+		SNMPMaxOids:   10,
+	}
+
+	client, err := NewClient(cmts)
+	if err != nil {
+		t.Skipf("Could not create client: %v", err)
+	}
+	defer client.Close()
+
+	if client.conn.MaxOids != 10 || client.conn.MaxRepetitions != 10 {
+		t.Errorf("Expected MaxOids and MaxRepetitions of 10, got %d and %d",
+			client.conn.MaxOids, client.conn.MaxRepetitions)
+	}
+}
+
 // Test Helper Functions
 
 func TestParseMACAddress(t *testing.T) {
@@ -93,6 +123,30 @@ func TestParseMACAddress(t *testing.T) {
 			},
 			expected: "00:01:5C:11:22:33",
 		},
+		{
+			name: "Space-separated hex string",
+			pdu: gosnmp.SnmpPDU{
+				Type:  gosnmp.OctetString,
+				Value: []byte("00 01 5c 11 22 33"),
+			},
+			expected: "00:01:5C:11:22:33",
+		},
+		{
+			name: "Non-hex text",
+			pdu: gosnmp.SnmpPDU{
+				Type:  gosnmp.OctetString,
+				Value: []byte("not-a-mac-xy"),
+			},
+			expected: "",
+		},
+		{
+			name: "Unexpected type",
+			pdu: gosnmp.SnmpPDU{
+				Type:  gosnmp.Integer,
+				Value: 42,
+			},
+			expected: "",
+		},
 	}
 
 	for _, tt := range tests {
@@ -105,6 +159,90 @@ func TestParseMACAddress(t *testing.T) {
 	}
 }
 
+func TestLogUnparseableMAC(t *testing.T) {
+	var buf bytes.Buffer
+	original := log.Logger
+	log.Logger = zerolog.New(&buf)
+	defer func() { log.Logger = original }()
+
+	tests := []struct {
+		name      string
+		pdu       gosnmp.SnmpPDU
+		wantType  string
+		wantValue string
+	}{
+		{
+			name:      "Short octet string",
+			pdu:       gosnmp.SnmpPDU{Name: ".1.3.6.1.2.1.10.127.1.3.3.1.2.5", Type: gosnmp.OctetString, Value: []byte{0x00, 0x01, 0x5C}},
+			wantType:  "OctetString",
+			wantValue: "00 01 5C",
+		},
+		{
+			name:      "Unexpected type",
+			pdu:       gosnmp.SnmpPDU{Name: ".1.3.6.1.2.1.10.127.1.3.3.1.2.6", Type: gosnmp.Integer, Value: 42},
+			wantType:  "Integer",
+			wantValue: "int(42)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			logUnparseableMAC(tt.pdu)
+
+			var entry map[string]interface{}
+			if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+				t.Fatalf("Failed to decode log entry %q: %v", buf.String(), err)
+			}
+			if entry["oid"] != tt.pdu.Name {
+				t.Errorf("oid = %v, want %v", entry["oid"], tt.pdu.Name)
+			}
+			if entry["type"] != tt.wantType {
+				t.Errorf("type = %v, want %v", entry["type"], tt.wantType)
+			}
+			if entry["value"] != tt.wantValue {
+				t.Errorf("value = %v, want %v", entry["value"], tt.wantValue)
+			}
+		})
+	}
+}
+
+func TestModemTableLimit(t *testing.T) {
+	entry := func(i int) gosnmp.SnmpPDU {
+		return gosnmp.SnmpPDU{
+			Name:  fmt.Sprintf("%s.%d", OIDDocsIfCmtsCmStatusMacAddress, i),
+			Type:  gosnmp.OctetString,
+			Value: []byte{0x00, 0x01, 0x5C, 0x00, 0x00, byte(i)},
+		}
+	}
+
+	table := &modemTable{max: 3}
+	for i := 1; i <= 3; i++ {
+		if err := table.add(entry(i)); err != nil {
+			t.Fatalf("add(%d) error = %v", i, err)
+		}
+	}
+	if len(table.infos) != 3 || table.infos[2].mac != "00:01:5C:00:00:03" || table.infos[2].ifIndex != "3" {
+		t.Errorf("Unexpected modem infos: %+v", table.infos)
+	}
+
+	// Unparseable entries still count towards the limit
+	err := table.add(gosnmp.SnmpPDU{Name: entry(4).Name, Type: gosnmp.Integer, Value: 42})
+	if !errors.Is(err, ErrTooManyModems) {
+		t.Errorf("Expected ErrTooManyModems past the limit, got %v", err)
+	}
+	if len(table.infos) != 3 {
+		t.Errorf("Expected nothing added past the limit, got %d infos", len(table.infos))
+	}
+
+	unlimited := &modemTable{}
+	for i := 1; i <= 10; i++ {
+		if err := unlimited.add(entry(i)); err != nil {
+			t.Fatalf("Expected no limit with max 0, got %v", err)
+		}
+	}
+}
+
 func TestParseIPAddress(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -160,6 +298,41 @@ func TestParseIPAddress(t *testing.T) {
 			},
 			expected: "10.0.0.1",
 		},
+		{
+			name: "Valid IPv6",
+			pdu: gosnmp.SnmpPDU{
+				Value: []byte{0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x01},
+			},
+			expected: "2001:db8::1",
+		},
+		{
+			name: "IPv6 link-local",
+			pdu: gosnmp.SnmpPDU{
+				Value: []byte{0xfe, 0x80, 0, 0, 0, 0, 0, 0, 0x02, 0x01, 0x5c, 0xff, 0xfe, 0x11, 0x22, 0x33},
+			},
+			expected: "fe80::201:5cff:fe11:2233",
+		},
+		{
+			name: "String IPv6 address",
+			pdu: gosnmp.SnmpPDU{
+				Value: "2001:db8::1",
+			},
+			expected: "2001:db8::1",
+		},
+		{
+			name: "Neither IPv4 nor IPv6 length",
+			pdu: gosnmp.SnmpPDU{
+				Value: []byte{0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0},
+			},
+			expected: "",
+		},
+		{
+			name: "NoSuchInstance",
+			pdu: gosnmp.SnmpPDU{
+				Type: gosnmp.NoSuchInstance,
+			},
+			expected: "",
+		},
 	}
 
 	for _, tt := range tests {
@@ -172,6 +345,352 @@ func TestParseIPAddress(t *testing.T) {
 	}
 }
 
+func TestSNMPTarget(t *testing.T) {
+	tests := []struct {
+		addr     string
+		target   string
+		hostPort string
+	}{
+		{"192.0.2.1", "192.0.2.1", "192.0.2.1:161"},
+		{"2001:db8::1", "2001:db8::1", "[2001:db8::1]:161"},
+		{"[2001:db8::1]", "2001:db8::1", "[2001:db8::1]:161"},
+		{"cmts.example.net", "cmts.example.net", "cmts.example.net:161"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			if got := snmpTarget(tt.addr); got != tt.target {
+				t.Errorf("snmpTarget() = %v, want %v", got, tt.target)
+			}
+			if got := hostPort(tt.addr, 161); got != tt.hostPort {
+				t.Errorf("hostPort() = %v, want %v", got, tt.hostPort)
+			}
+		})
+	}
+}
+
+func TestParseSignalLevelPDU(t *testing.T) {
+	tests := []struct {
+		name          string
+		pdu           gosnmp.SnmpPDU
+		expected      float64
+		wantAvailable bool
+	}{
+		{"Tenths of dBmV", gosnmp.SnmpPDU{Type: gosnmp.Integer, Value: 52}, 5.2, true},
+		{"Negative level", gosnmp.SnmpPDU{Type: gosnmp.Integer, Value: -35}, -3.5, true},
+		{"Genuine zero", gosnmp.SnmpPDU{Type: gosnmp.Integer, Value: 0}, 0.0, true},
+		{"NoSuchInstance", gosnmp.SnmpPDU{Type: gosnmp.NoSuchInstance}, 0.0, false},
+		{"NoSuchObject", gosnmp.SnmpPDU{Type: gosnmp.NoSuchObject}, 0.0, false},
+		{"Non-numeric", gosnmp.SnmpPDU{Type: gosnmp.OctetString, Value: []byte("n/a")}, 0.0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			level, ok := parseSignalLevel(tt.pdu)
+			if ok != tt.wantAvailable {
+				t.Errorf("parseSignalLevel() available = %v, want %v", ok, tt.wantAvailable)
+			}
+			if level != tt.expected {
+				t.Errorf("parseSignalLevel() = %v, want %v", level, tt.expected)
+			}
+		})
+	}
+}
+
+func TestAverageSignalLevel(t *testing.T) {
+	tests := []struct {
+		name          string
+		pdus          []gosnmp.SnmpPDU
+		expected      float64
+		wantAvailable bool
+	}{
+		{"No channels", nil, 0.0, false},
+		{"Single channel", []gosnmp.SnmpPDU{{Type: gosnmp.Integer, Value: 42}}, 4.2, true},
+		{"Mean of channels", []gosnmp.SnmpPDU{
+			{Type: gosnmp.Integer, Value: 20},
+			{Type: gosnmp.Integer, Value: -10},
+		}, 0.5, true},
+		{"Skips unavailable", []gosnmp.SnmpPDU{
+			{Type: gosnmp.NoSuchInstance},
+			{Type: gosnmp.Integer, Value: 30},
+		}, 3.0, true},
+		{"All unavailable", []gosnmp.SnmpPDU{{Type: gosnmp.NoSuchObject}}, 0.0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			level, ok := averageSignalLevel(tt.pdus)
+			if ok != tt.wantAvailable {
+				t.Errorf("averageSignalLevel() available = %v, want %v", ok, tt.wantAvailable)
+			}
+			if level != tt.expected {
+				t.Errorf("averageSignalLevel() = %v, want %v", level, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseModemStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		pdu      gosnmp.SnmpPDU
+		expected string
+	}{
+		{"Operational", gosnmp.SnmpPDU{Type: gosnmp.Integer, Value: 12}, "online"},
+		{"Access denied", gosnmp.SnmpPDU{Type: gosnmp.Integer, Value: 13}, "denied"},
+		{"Not ready", gosnmp.SnmpPDU{Type: gosnmp.Integer, Value: 2}, "offline"},
+		{"Ranging", gosnmp.SnmpPDU{Type: gosnmp.Integer, Value: 6}, "partial"},
+		{"NoSuchInstance", gosnmp.SnmpPDU{Type: gosnmp.NoSuchInstance}, ""},
+		{"NoSuchObject", gosnmp.SnmpPDU{Type: gosnmp.NoSuchObject}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := parseModemStatus(tt.pdu); result != tt.expected {
+				t.Errorf("parseModemStatus() = %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFirstModemStatus(t *testing.T) {
+	missing := gosnmp.SnmpPDU{Type: gosnmp.NoSuchInstance}
+	online := gosnmp.SnmpPDU{Type: gosnmp.Integer, Value: 12}
+	denied := gosnmp.SnmpPDU{Type: gosnmp.Integer, Value: 13}
+
+	tests := []struct {
+		name     string
+		results  []gosnmp.SnmpPDU
+		expected string
+	}{
+		{"First interface", []gosnmp.SnmpPDU{online, denied}, "online"},
+		{"Skips missing rows", []gosnmp.SnmpPDU{missing, denied}, "denied"},
+		{"Nothing reported", []gosnmp.SnmpPDU{missing}, ""},
+		{"Empty table", nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := firstModemStatus(tt.results); result != tt.expected {
+				t.Errorf("firstModemStatus() = %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseModemDetails(t *testing.T) {
+	ip := gosnmp.SnmpPDU{Type: gosnmp.IPAddress, Value: []byte{10, 0, 0, 5}}
+	power := gosnmp.SnmpPDU{Type: gosnmp.Integer, Value: 35}
+	online := gosnmp.SnmpPDU{Type: gosnmp.Integer, Value: 12}
+	missing := gosnmp.SnmpPDU{Type: gosnmp.NoSuchInstance}
+
+	tests := []struct {
+		name       string
+		vars       []gosnmp.SnmpPDU
+		wantIP     string
+		wantSignal float64
+		wantOK     bool
+		wantStatus string
+	}{
+		{"All reported", []gosnmp.SnmpPDU{ip, power, online}, "10.0.0.5", 3.5, true, "online"},
+		{"No power", []gosnmp.SnmpPDU{ip, missing, online}, "10.0.0.5", 0, false, "online"},
+		{"Unknown modem", []gosnmp.SnmpPDU{missing, missing, missing}, "", 0, false, ""},
+		{"Truncated response", []gosnmp.SnmpPDU{ip}, "10.0.0.5", 0, false, "unknown"},
+		{"Empty response", nil, "", 0, false, "unknown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ip, signal, ok, status := parseModemDetails(tt.vars)
+			if ip != tt.wantIP || signal != tt.wantSignal || ok != tt.wantOK || status != tt.wantStatus {
+				t.Errorf("parseModemDetails() = (%q, %v, %v, %q), want (%q, %v, %v, %q)",
+					ip, signal, ok, status, tt.wantIP, tt.wantSignal, tt.wantOK, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestGetModemIdentity(t *testing.T) {
+	cache := newModemIdentityCache()
+	cache.put("10.0.0.5", modemIdentity{sysDescr: "Arris SB8200", configFile: "gold-100x20.cfg"})
+
+	cmts := &models.CMTS{Name: "test"}
+	if got := getModemIdentity(cmts, "10.0.0.5", cache); got != (modemIdentity{}) {
+		t.Errorf("Expected nothing read without a CM community, got %+v", got)
+	}
+
+	cmts.CMCommunityString = "private"
+	for _, ip := range []string{"", "0.0.0.0", "not-an-ip"} {
+		if got := getModemIdentity(cmts, ip, cache); got != (modemIdentity{}) {
+			t.Errorf("Expected nothing read for IP %q, got %+v", ip, got)
+		}
+	}
+
+	// Modems already read this run aren't asked again
+	got := getModemIdentity(cmts, "10.0.0.5", cache)
+	if got.sysDescr != "Arris SB8200" || got.configFile != "gold-100x20.cfg" {
+		t.Errorf("Expected the cached identity, got %+v", got)
+	}
+}
+
+func TestReadModemIdentityUnreachable(t *testing.T) {
+	started := time.Now()
+	if _, err := readModemIdentity("127.0.0.1", "private", 200*time.Millisecond); err == nil {
+		t.Fatal("Expected an error with no SNMP agent listening")
+	}
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Errorf("Expected a single short attempt, took %v", elapsed)
+	}
+}
+
+func TestParseModemIdentity(t *testing.T) {
+	sysDescr := gosnmp.SnmpPDU{Name: OIDSysDescr, Type: gosnmp.OctetString, Value: []byte("Arris SB8200")}
+
+	tests := []struct {
+		name    string
+		vars    []gosnmp.SnmpPDU
+		want    modemIdentity
+		wantErr bool
+	}{
+		{
+			name: "sysDescr and config file",
+			vars: []gosnmp.SnmpPDU{sysDescr, {Name: OIDDocsDevServerConfigFile, Type: gosnmp.OctetString, Value: []byte("gold-100x20.cfg ")}},
+			want: modemIdentity{sysDescr: "Arris SB8200", configFile: "gold-100x20.cfg"},
+		},
+		{
+			name: "config file not supported",
+			vars: []gosnmp.SnmpPDU{sysDescr, {Name: OIDDocsDevServerConfigFile, Type: gosnmp.NoSuchObject}},
+			want: modemIdentity{sysDescr: "Arris SB8200"},
+		},
+		{
+			name: "config file unknown",
+			vars: []gosnmp.SnmpPDU{sysDescr, {Name: OIDDocsDevServerConfigFile, Type: gosnmp.OctetString, Value: []byte{}}},
+			want: modemIdentity{sysDescr: "Arris SB8200"},
+		},
+		{
+			name:    "no sysDescr",
+			vars:    []gosnmp.SnmpPDU{{Name: OIDSysDescr, Type: gosnmp.NoSuchObject}},
+			wantErr: true,
+		},
+		{
+			name:    "empty response",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseModemIdentity(tt.vars)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseModemIdentity() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseModemIdentity() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMapUpstreamInterfaces(t *testing.T) {
+	channels := []gosnmp.SnmpPDU{
+		{Name: OIDDocsIfCmtsCmStatusUpChannelIfIndex + ".1", Type: gosnmp.Integer, Value: 1000},
+		{Name: OIDDocsIfCmtsCmStatusUpChannelIfIndex + ".2", Type: gosnmp.Integer, Value: 1001},
+		{Name: OIDDocsIfCmtsCmStatusUpChannelIfIndex + ".3", Type: gosnmp.Integer, Value: 2000},
+		{Name: OIDDocsIfCmtsCmStatusUpChannelIfIndex + ".4", Type: gosnmp.NoSuchInstance},
+	}
+	descrs := []gosnmp.SnmpPDU{
+		{Name: OIDIfDescr + ".1000", Type: gosnmp.OctetString, Value: []byte("Cable3/0-upstream0")},
+		{Name: OIDIfDescr + ".1001", Type: gosnmp.OctetString, Value: []byte("Cable3/0-upstream1 ")},
+	}
+
+	upstreams := mapUpstreamInterfaces(channels, descrs)
+	expected := map[string]string{
+		"1": "Cable3/0-upstream0",
+		"2": "Cable3/0-upstream1",
+	}
+	if len(upstreams) != len(expected) {
+		t.Fatalf("mapUpstreamInterfaces() = %v, want %v", upstreams, expected)
+	}
+	for index, name := range expected {
+		if upstreams[index] != name {
+			t.Errorf("upstream for %s = %q, want %q", index, upstreams[index], name)
+		}
+	}
+}
+
+func TestParseUpgradeStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		pdu      gosnmp.SnmpPDU
+		expected string
+	}{
+		{"In progress", gosnmp.SnmpPDU{Type: gosnmp.Integer, Value: 1}, "in_progress"},
+		{"Complete from provisioning", gosnmp.SnmpPDU{Type: gosnmp.Integer, Value: 2}, "completed"},
+		{"Complete from management", gosnmp.SnmpPDU{Type: gosnmp.Integer, Value: 3}, "completed"},
+		{"Failed", gosnmp.SnmpPDU{Type: gosnmp.Integer, Value: 4}, "failed"},
+		{"Other", gosnmp.SnmpPDU{Type: gosnmp.Integer, Value: 5}, "unknown"},
+		{"NoSuchInstance", gosnmp.SnmpPDU{Type: gosnmp.NoSuchInstance}, "rebooting"},
+		{"NoSuchObject", gosnmp.SnmpPDU{Type: gosnmp.NoSuchObject}, "rebooting"},
+		{"EndOfMibView", gosnmp.SnmpPDU{Type: gosnmp.EndOfMibView}, "unknown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := parseUpgradeStatus(tt.pdu); result != tt.expected {
+				t.Errorf("parseUpgradeStatus() = %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseSoftwareVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		pdu      gosnmp.SnmpPDU
+		expected string
+	}{
+		{"Octet string", gosnmp.SnmpPDU{Type: gosnmp.OctetString, Value: []byte("SB8200.0200.174F.311915.NSH.RT.NA")}, "SB8200.0200.174F.311915.NSH.RT.NA"},
+		{"Trailing whitespace", gosnmp.SnmpPDU{Type: gosnmp.OctetString, Value: []byte("2.0.0 ")}, "2.0.0"},
+		{"String value", gosnmp.SnmpPDU{Type: gosnmp.OctetString, Value: "1.0.0"}, "1.0.0"},
+		{"NoSuchInstance", gosnmp.SnmpPDU{Type: gosnmp.NoSuchInstance}, ""},
+		{"NoSuchObject", gosnmp.SnmpPDU{Type: gosnmp.NoSuchObject}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := parseSoftwareVersion(tt.pdu); result != tt.expected {
+				t.Errorf("parseSoftwareVersion() = %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestInetAddress(t *testing.T) {
+	tests := []struct {
+		name     string
+		server   string
+		wantType int
+		wantAddr []byte
+		wantErr  bool
+	}{
+		{"IPv4", "192.168.1.50", inetAddressTypeIPv4, []byte{192, 168, 1, 50}, false},
+		{"IPv6", "2001:db8::1", inetAddressTypeIPv6, net.ParseIP("2001:db8::1").To16(), false},
+		{"Hostname", "firmware.example.com", 0, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addrType, addr, err := inetAddress(tt.server)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("inetAddress() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if addrType != tt.wantType || !bytes.Equal(addr, tt.wantAddr) {
+				t.Errorf("inetAddress() = (%d, %v), want (%d, %v)", addrType, addr, tt.wantType, tt.wantAddr)
+			}
+		})
+	}
+}
+
 func TestExtractFirmwareFromSysDescr(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -311,17 +830,29 @@ func TestExtractIndexFromOID(t *testing.T) {
 
 func TestOIDConstants(t *testing.T) {
 	oids := map[string]string{
-		"OIDDocsIfCmtsCmStatusMacAddress":      OIDDocsIfCmtsCmStatusMacAddress,
-		"OIDDocsIfCmtsCmStatusIpAddress":       OIDDocsIfCmtsCmStatusIpAddress,
-		"OIDDocsIfCmtsCmStatusDownstreamPower": OIDDocsIfCmtsCmStatusDownstreamPower,
-		"OIDDocsIfCmtsCmStatusValue":           OIDDocsIfCmtsCmStatusValue,
-		"OIDSysDescr":                          OIDSysDescr,
-		"OIDDocsDevSwServer":                   OIDDocsDevSwServer,
-		"OIDDocsDevSwFilename":                 OIDDocsDevSwFilename,
-		"OIDDocsDevSwAdminStatus":              OIDDocsDevSwAdminStatus,
-		"OIDDocsDevSwOperStatus":               OIDDocsDevSwOperStatus,
+		"OIDDocsIfCmtsCmStatusMacAddress":        OIDDocsIfCmtsCmStatusMacAddress,
+		"OIDDocsIfCmtsCmStatusIpAddress":         OIDDocsIfCmtsCmStatusIpAddress,
+		"OIDDocsIfCmtsCmStatusDownstreamPower":   OIDDocsIfCmtsCmStatusDownstreamPower,
+		"OIDDocsIfCmtsCmStatusValue":             OIDDocsIfCmtsCmStatusValue,
+		"OIDDocsIf31CmDsOfdmChannelPowerRxPower": OIDDocsIf31CmDsOfdmChannelPowerRxPower,
+		"OIDSysDescr":                            OIDSysDescr,
+		"OIDDocsDevSwServer":                     OIDDocsDevSwServer,
+		"OIDDocsDevSwFilename":                   OIDDocsDevSwFilename,
+		"OIDDocsDevSwAdminStatus":                OIDDocsDevSwAdminStatus,
+		"OIDDocsDevSwOperStatus":                 OIDDocsDevSwOperStatus,
+		"OIDDocsDevSwCurrentVers":                OIDDocsDevSwCurrentVers,
+		"OIDDocsDevSwServerAddressType":          OIDDocsDevSwServerAddressType,
+		"OIDDocsDevSwServerAddress":              OIDDocsDevSwServerAddress,
+		"OIDDocsDevSwServerTransportProtocol":    OIDDocsDevSwServerTransportProtocol,
+		"OIDDocsDevResetNow":                     OIDDocsDevResetNow,
+		"OIDDocsIfCmtsCmStatusUpChannelIfIndex":  OIDDocsIfCmtsCmStatusUpChannelIfIndex,
+		"OIDIfDescr":                             OIDIfDescr,
+		"OIDDocsDevServerConfigFile":             OIDDocsDevServerConfigFile,
+		"OIDDocsIfCmStatusValue":                 OIDDocsIfCmStatusValue,
+		"OIDDocsIfDownChannelPower":              OIDDocsIfDownChannelPower,
 	}
 
+	seen := make(map[string]string)
 	for name, oid := range oids {
 		if oid == "" {
 			t.Errorf("OID %s should not be empty", name)
@@ -330,6 +861,11 @@ func TestOIDConstants(t *testing.T) {
 		if len(oid) < 3 || oid[0:2] != "1." {
 			t.Errorf("OID %s has invalid format: %s", name, oid)
 		}
+		// Two names for one OID means one of them is wrong
+		if other, ok := seen[oid]; ok {
+			t.Errorf("OIDs %s and %s are both %s", name, other, oid)
+		}
+		seen[oid] = name
 	}
 }
 
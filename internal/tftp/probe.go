@@ -0,0 +1,114 @@
+package tftp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// TFTP opcodes (RFC 1350)
+const (
+	opRRQ   = 1
+	opDATA  = 3
+	opERROR = 5
+)
+
+// TFTP error codes (RFC 1350)
+const (
+	errCodeNotDefined   = 0
+	errCodeFileNotFound = 1
+)
+
+// DefaultPort is the well-known TFTP port
+const DefaultPort = "69"
+
+// ErrFileNotFound is returned when the server reports the file does not exist
+var ErrFileNotFound = errors.New("firmware not found on TFTP server")
+
+// CheckFileExists sends a read request for filename to server and waits for
+// the first reply. A DATA packet means the file exists, and the transfer is
+// aborted straight away. A file-not-found ERROR packet returns
+// ErrFileNotFound; any other failure (timeout, access violation, bad reply)
+// is returned as a generic error so callers can decide whether to proceed.
+func CheckFileExists(server, filename string, timeout time.Duration) error {
+	addr, err := net.ResolveUDPAddr("udp", serverAddress(server))
+	if err != nil {
+		return fmt.Errorf("invalid TFTP server %q: %w", server, err)
+	}
+
+	conn, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return fmt.Errorf("failed to open UDP socket: %w", err)
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+
+	if _, err := conn.WriteToUDP(readRequest(filename), addr); err != nil {
+		return fmt.Errorf("failed to send read request: %w", err)
+	}
+
+	// The server answers from a new port (its transfer ID), so accept a reply from any port
+	buf := make([]byte, 516)
+	n, from, err := conn.ReadFromUDP(buf)
+	if err != nil {
+		return fmt.Errorf("no reply from TFTP server: %w", err)
+	}
+	if n < 4 {
+		return fmt.Errorf("short reply from TFTP server")
+	}
+
+	switch opcode := binary.BigEndian.Uint16(buf[0:2]); opcode {
+	case opDATA:
+		// Tell the server we're done so it doesn't keep retransmitting
+		conn.WriteToUDP(errorPacket(errCodeNotDefined, "probe complete"), from)
+		return nil
+	case opERROR:
+		code := binary.BigEndian.Uint16(buf[2:4])
+		if code == errCodeFileNotFound {
+			return ErrFileNotFound
+		}
+		return fmt.Errorf("TFTP server error %d: %s", code, errorMessage(buf[4:n]))
+	default:
+		return fmt.Errorf("unexpected TFTP opcode %d", opcode)
+	}
+}
+
+// serverAddress adds the default TFTP port when server has none
+func serverAddress(server string) string {
+	if _, _, err := net.SplitHostPort(server); err == nil {
+		return server
+	}
+	return net.JoinHostPort(server, DefaultPort)
+}
+
+func readRequest(filename string) []byte {
+	packet := make([]byte, 0, 2+len(filename)+1+len("octet")+1)
+	packet = binary.BigEndian.AppendUint16(packet, opRRQ)
+	packet = append(packet, filename...)
+	packet = append(packet, 0)
+	packet = append(packet, "octet"...)
+	return append(packet, 0)
+}
+
+func errorPacket(code uint16, message string) []byte {
+	packet := make([]byte, 0, 4+len(message)+1)
+	packet = binary.BigEndian.AppendUint16(packet, opERROR)
+	packet = binary.BigEndian.AppendUint16(packet, code)
+	packet = append(packet, message...)
+	return append(packet, 0)
+}
+
+// errorMessage extracts the NUL-terminated message from an ERROR packet
+func errorMessage(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
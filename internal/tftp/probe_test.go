@@ -0,0 +1,133 @@
+package tftp
+
+import (
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeServer answers each read request with reply, sent from a fresh port
+// like a real TFTP server. It returns the server address and a channel that
+// receives the packet the client sends after the reply, if any.
+func fakeServer(t *testing.T, reply func(filename string) []byte) (string, <-chan []byte) {
+	t.Helper()
+
+	listener, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	followUp := make(chan []byte, 1)
+	go func() {
+		buf := make([]byte, 516)
+		n, client, err := listener.ReadFromUDP(buf)
+		if err != nil || n < 2 || binary.BigEndian.Uint16(buf[0:2]) != opRRQ {
+			return
+		}
+		filename := strings.SplitN(string(buf[2:n]), "\x00", 2)[0]
+
+		packet := reply(filename)
+		if packet == nil {
+			return // simulate a server that never answers
+		}
+
+		transfer, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			return
+		}
+		defer transfer.Close()
+		transfer.WriteToUDP(packet, client)
+
+		transfer.SetReadDeadline(time.Now().Add(time.Second))
+		if n, _, err := transfer.ReadFromUDP(buf); err == nil {
+			followUp <- append([]byte(nil), buf[:n]...)
+		}
+	}()
+
+	return listener.LocalAddr().String(), followUp
+}
+
+func dataPacket(block uint16, data string) []byte {
+	packet := binary.BigEndian.AppendUint16(nil, opDATA)
+	packet = binary.BigEndian.AppendUint16(packet, block)
+	return append(packet, data...)
+}
+
+func TestCheckFileExistsFound(t *testing.T) {
+	server, followUp := fakeServer(t, func(filename string) []byte {
+		if filename != "firmware-v2.0.0.bin" {
+			return errorPacket(errCodeFileNotFound, "File not found")
+		}
+		return dataPacket(1, "firmware bytes")
+	})
+
+	if err := CheckFileExists(server, "firmware-v2.0.0.bin", time.Second); err != nil {
+		t.Fatalf("CheckFileExists() error = %v, want nil", err)
+	}
+
+	// The client aborts the transfer after the first block
+	select {
+	case packet := <-followUp:
+		if binary.BigEndian.Uint16(packet[0:2]) != opERROR {
+			t.Errorf("Expected ERROR packet to abort transfer, got opcode %d", binary.BigEndian.Uint16(packet[0:2]))
+		}
+	case <-time.After(time.Second):
+		t.Error("Expected the client to abort the transfer")
+	}
+}
+
+func TestCheckFileExistsNotFound(t *testing.T) {
+	server, _ := fakeServer(t, func(filename string) []byte {
+		return errorPacket(errCodeFileNotFound, "File not found")
+	})
+
+	if err := CheckFileExists(server, "missing.bin", time.Second); err != ErrFileNotFound {
+		t.Errorf("CheckFileExists() error = %v, want %v", err, ErrFileNotFound)
+	}
+}
+
+func TestCheckFileExistsOtherError(t *testing.T) {
+	server, _ := fakeServer(t, func(filename string) []byte {
+		return errorPacket(2, "Access violation")
+	})
+
+	err := CheckFileExists(server, "firmware.bin", time.Second)
+	if err == nil || err == ErrFileNotFound {
+		t.Fatalf("CheckFileExists() error = %v, want a generic error", err)
+	}
+	if !strings.Contains(err.Error(), "Access violation") {
+		t.Errorf("Expected server message in error, got %v", err)
+	}
+}
+
+func TestCheckFileExistsTimeout(t *testing.T) {
+	server, _ := fakeServer(t, func(filename string) []byte {
+		return nil
+	})
+
+	start := time.Now()
+	err := CheckFileExists(server, "firmware.bin", 100*time.Millisecond)
+	if err == nil || err == ErrFileNotFound {
+		t.Fatalf("CheckFileExists() error = %v, want a timeout error", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected probe to give up quickly, took %v", elapsed)
+	}
+}
+
+func TestServerAddress(t *testing.T) {
+	tests := map[string]string{
+		"192.168.1.50":      "192.168.1.50:69",
+		"192.168.1.50:6969": "192.168.1.50:6969",
+		"tftp.example.com":  "tftp.example.com:69",
+	}
+
+	for input, expected := range tests {
+		if got := serverAddress(input); got != expected {
+			t.Errorf("serverAddress(%q) = %q, want %q", input, got, expected)
+		}
+	}
+}
@@ -105,6 +105,40 @@ function debounce(func, wait = 300) {
   };
 }
 
+// localStorage key holding the API token entered by the user
+const API_TOKEN_KEY = "apiToken";
+
+/**
+ * Fetch with the stored API token as a bearer header. When the API answers
+ * 401, the user is asked for the token (the api_token setting) and the
+ * request is retried once with it. The token is kept in localStorage so
+ * other pages don't ask again.
+ * @param {string} endpoint - API endpoint
+ * @param {Object} options - Fetch options
+ * @returns {Promise<Response>} The response
+ */
+async function apiFetch(endpoint, options = {}) {
+  const send = (token) => {
+    const headers = { ...(options.headers || {}) };
+    if (token) {
+      headers["Authorization"] = `Bearer ${token}`;
+    }
+    return fetch(endpoint, { ...options, headers });
+  };
+
+  const response = await send(localStorage.getItem(API_TOKEN_KEY));
+  if (response.status !== 401) {
+    return response;
+  }
+
+  const token = window.prompt("This server requires an API token:");
+  if (!token) {
+    return response;
+  }
+  localStorage.setItem(API_TOKEN_KEY, token);
+  return send(token);
+}
+
 /**
  * Make an API call with error handling
  * @param {string} endpoint - API endpoint
@@ -121,7 +155,7 @@ async function apiCall(endpoint, options = {}) {
   const mergedOptions = { ...defaultOptions, ...options };
 
   try {
-    const response = await fetch(endpoint, mergedOptions);
+    const response = await apiFetch(endpoint, mergedOptions);
 
     if (!response.ok) {
       const errorData = await response.json().catch(() => ({}));